@@ -68,6 +68,7 @@ buildx.ndm: bootstrap install-dep-nonsudo clean build.common
 	@echo '--> Building node-disk-manager binary...'
 	@pwd
 	@CTLNAME=${NODE_DISK_MANAGER} BUILDPATH=${BUILD_PATH_NDM} BUILDX=true sh -c "'$(PWD)/build/build.sh'"
+	@CTLNAME=${NDMCTL} BUILDPATH=${BUILD_PATH_NDMCTL} BUILDX=true KEEP_BIN=true sh -c "'$(PWD)/build/build.sh'"
 	@echo '--> Built binary.'
 	@echo
 
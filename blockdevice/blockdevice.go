@@ -101,6 +101,10 @@ type BlockDevice struct {
 	// optional
 	Labels map[string]string
 
+	// Annotations for this blockdevice. These annotations will be used on the k8s resource
+	// that is created. optional
+	Annotations map[string]string
+
 	// FSInfo contains the file system related information of this
 	// BlockDevice if it exists
 	FSInfo FileSystemInformation
@@ -152,6 +156,17 @@ type SMARTStats struct {
 
 	// PercentEnduranceUsed stores the endurance used in percent
 	PercentEnduranceUsed float64
+
+	// AvailableSpareValid specifies whether the available spare is reported
+	// by the device
+	AvailableSpareValid bool
+
+	// AvailableSpare stores the remaining spare capacity in percent
+	AvailableSpare uint8
+
+	// FailureIndicators stores the raw values of the SMART attributes that are
+	// used to predict the failure of an ATA device, keyed by the indicator
+	FailureIndicators map[string]uint64
 }
 
 // Identifier represents the various identifiers that can be used to
@@ -288,6 +303,14 @@ type DeviceAttribute struct {
 	// WWN
 	WWN string
 
+	// DMUUID is the UUID of the device mapper device, as reported by udev
+	// (DM_UUID). e.g mpath-3600..., LVM-...
+	DMUUID string
+
+	// PlatformID is a stable identifier of the device assigned by the platform, for
+	// devices which do not have a WWN. e.g the UID of a DASD on s390x
+	PlatformID string
+
 	// Vendor
 	Vendor string
 
@@ -303,6 +326,10 @@ type DeviceAttribute struct {
 
 	// Compliance is implemented specifications version i.e. SPC-1, SPC-2, etc
 	Compliance string
+
+	// SED is the TCG Security Subsystem Class of a self-encrypting drive, like
+	// Opal2 or Enterprise, empty if the drive does not encrypt its media
+	SED string
 }
 
 // DevLink represents a type of dev link for a device. A device can have multiple
@@ -412,6 +439,27 @@ type Status struct {
 
 	// ClaimPhase is the phase of this BD when is it is being used by NDM consumers
 	ClaimPhase string
+
+	// SkippedProbes is the list of probes that were not run on this BD because
+	// they failed repeatedly on it
+	SkippedProbes []string
+
+	// Flapping is set if the BD has been attached and detached repeatedly
+	// within a short period of time
+	Flapping bool
+
+	// UUIDCollision describes the conflict, if the UUID generated for this BD
+	// was already in use by another device
+	UUIDCollision string
+
+	// OriginalUUID is the UUID that was generated for this BD, before it was
+	// disambiguated due to a collision
+	OriginalUUID string
+
+	// ClaimNamespace and ClaimName identify the claim which has claimed this
+	// BD. Empty if the BD is not claimed.
+	ClaimNamespace string
+	ClaimName      string
 }
 
 const (
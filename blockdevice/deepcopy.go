@@ -0,0 +1,62 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdevice
+
+// DeepCopy returns a copy of the blockdevice which does not share its maps
+// and slices, so that the copy can be modified independently
+func (b *BlockDevice) DeepCopy() *BlockDevice {
+	out := *b
+	out.NodeAttributes = copyStringMap(b.NodeAttributes)
+	out.Labels = copyStringMap(b.Labels)
+	out.Annotations = copyStringMap(b.Annotations)
+	out.FSInfo.MountPoint = copyStrings(b.FSInfo.MountPoint)
+	if b.DevLinks != nil {
+		out.DevLinks = make([]DevLink, len(b.DevLinks))
+		for i, devLink := range b.DevLinks {
+			out.DevLinks[i] = DevLink{Kind: devLink.Kind, Links: copyStrings(devLink.Links)}
+		}
+	}
+	out.DependentDevices.Partitions = copyStrings(b.DependentDevices.Partitions)
+	out.DependentDevices.Holders = copyStrings(b.DependentDevices.Holders)
+	out.DependentDevices.Slaves = copyStrings(b.DependentDevices.Slaves)
+	if b.SMARTInfo.FailureIndicators != nil {
+		out.SMARTInfo.FailureIndicators = make(map[string]uint64, len(b.SMARTInfo.FailureIndicators))
+		for k, v := range b.SMARTInfo.FailureIndicators {
+			out.SMARTInfo.FailureIndicators[k] = v
+		}
+	}
+	out.Status.SkippedProbes = copyStrings(b.Status.SkippedProbes)
+	return &out
+}
+
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	return append(make([]string, 0, len(in)), in...)
+}
@@ -147,8 +147,12 @@ fi;
 XC_ARCHS=("${XC_ARCH// / }")
 XC_OSS=("${XC_OS// / }")
 
-echo "==> Removing old bin contents..."
-deleteOldContents
+# The binaries built earlier are kept when more than one binary is shipped in
+# an image, eg: ndm and ndmctl
+if [[ -z "${KEEP_BIN}" ]]; then
+    echo "==> Removing old bin contents..."
+    deleteOldContents
+fi
 
 # If its dev mode, only build for ourself
 if [[ -n "${NDM_AGENT_DEV}" ]]; then
@@ -0,0 +1,226 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// maxOwnerDepth is the max no. of owners followed from an object, which
+// guards against the reference cycles
+const maxOwnerDepth = 10
+
+// blameCmd represents the blame command
+var blameCmd = &cobra.Command{
+	Use:   "blame <blockdevice>",
+	Short: "Show the claim, owners and pods using a blockdevice",
+	Long: `Resolves the chain from the blockdevice to its claim, the owners of the claim
+through the owner references and the pods on the node of the blockdevice owned by
+them, to find the consumer of the blockdevice before a maintenance`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(output, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return blame(c, args[0], os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(blameCmd)
+	cli.AddOutputFlag(blameCmd, &output, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+}
+
+// owner is an object in the owner chain of a claim or pod
+type owner struct {
+	kind string
+	name string
+	uid  types.UID
+}
+
+func (o owner) String() string {
+	return o.kind + "/" + o.name
+}
+
+// blameReport is the chain of objects using a blockdevice
+type blameReport struct {
+	BlockDevice string `json:"blockDevice"`
+	Path        string `json:"path"`
+	Node        string `json:"node"`
+	// Claim is the namespace/name of the claim of the blockdevice
+	Claim string `json:"claim,omitempty"`
+	// ClaimFound is false if the claim reference is left behind
+	ClaimFound bool       `json:"claimFound"`
+	ClaimPhase string     `json:"claimPhase,omitempty"`
+	Owners     []string   `json:"owners"`
+	Pods       []blamePod `json:"pods"`
+}
+
+// blamePod is a pod using a blockdevice
+type blamePod struct {
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Phase     v1.PodPhase `json:"phase"`
+}
+
+// blame prints the chain of objects using the blockdevice
+func blame(c client.Client, name string, out io.Writer) error {
+	bd := &apis.BlockDevice{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, bd); err != nil {
+		return fmt.Errorf("unable to get blockdevice %s: %v", name, err)
+	}
+	report := blameReport{
+		BlockDevice: bd.Name,
+		Path:        bd.Spec.Path,
+		Node:        bd.Spec.NodeAttributes.NodeName,
+		Owners:      make([]string, 0),
+		Pods:        make([]blamePod, 0),
+	}
+	if bd.Spec.ClaimRef != nil {
+		claimNamespace := bd.Spec.ClaimRef.Namespace
+		if len(claimNamespace) == 0 {
+			claimNamespace = bd.Namespace
+		}
+		report.Claim = claimNamespace + "/" + bd.Spec.ClaimRef.Name
+		bdc := &apis.BlockDeviceClaim{}
+		// the claim reference is left behind till the blockdevice is released
+		err := c.Get(context.TODO(), types.NamespacedName{Namespace: claimNamespace, Name: bd.Spec.ClaimRef.Name}, bdc)
+		if err == nil {
+			report.ClaimFound = true
+			report.ClaimPhase = string(bdc.Status.Phase)
+			owners := getOwners(c, bdc.Namespace, bdc.OwnerReferences, 0)
+			for _, o := range owners {
+				report.Owners = append(report.Owners, o.String())
+			}
+			pods, err := getPods(c, bdc, bd.Spec.NodeAttributes.NodeName, owners)
+			if err != nil {
+				return err
+			}
+			for _, pod := range pods {
+				report.Pods = append(report.Pods, blamePod{pod.Namespace, pod.Name, pod.Status.Phase})
+			}
+		}
+	}
+	if output == cli.OutputJSON || output == cli.OutputYAML {
+		return cli.PrintObject(out, output, report)
+	}
+	return printBlame(out, report)
+}
+
+// printBlame prints the chain of objects using the blockdevice as text
+func printBlame(out io.Writer, report blameReport) error {
+	w := cli.NewTabWriter(out)
+	fmt.Fprintf(w, "BlockDevice:\t%s (%s on %s)\n", report.BlockDevice, cli.OrNone(report.Path),
+		cli.OrNone(report.Node))
+	switch {
+	case len(report.Claim) == 0:
+		fmt.Fprintf(w, "Claim:\t%s\n", cli.None)
+		return w.Flush()
+	case !report.ClaimFound:
+		fmt.Fprintf(w, "Claim:\t%s (not found)\n", report.Claim)
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "Claim:\t%s (%s)\n", report.Claim, cli.OrNone(report.ClaimPhase))
+
+	if len(report.Owners) == 0 {
+		fmt.Fprintf(w, "Owners:\t%s\n", cli.None)
+	} else {
+		fmt.Fprintf(w, "Owners:\t%s\n", strings.Join(report.Owners, " -> "))
+	}
+	if len(report.Pods) == 0 {
+		fmt.Fprintf(w, "Pods:\t%s\n", cli.None)
+	}
+	for i, pod := range report.Pods {
+		label := ""
+		if i == 0 {
+			label = "Pods:"
+		}
+		fmt.Fprintf(w, "%s\t%s/%s (%s)\n", label, pod.Namespace, pod.Name, pod.Phase)
+	}
+	return w.Flush()
+}
+
+// getOwners returns the owners of an object in the namespace, followed by
+// the owners of those owners. The owners that cannot be fetched, eg: when
+// the kind is not known, are returned without their owners.
+func getOwners(c client.Client, namespace string, refs []metav1.OwnerReference, depth int) []owner {
+	owners := make([]owner, 0)
+	if depth == maxOwnerDepth {
+		return owners
+	}
+	for _, ref := range refs {
+		owners = append(owners, owner{kind: ref.Kind, name: ref.Name, uid: ref.UID})
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+		if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: ref.Name}, obj); err != nil {
+			continue
+		}
+		owners = append(owners, getOwners(c, namespace, obj.GetOwnerReferences(), depth+1)...)
+	}
+	return owners
+}
+
+// getPods returns the pods in the namespace of the claim that are owned by
+// the claim or one of its owners. Only the pods on the node are considered,
+// since the blockdevice can only be used there.
+func getPods(c client.Client, bdc *apis.BlockDeviceClaim, nodeName string, owners []owner) ([]v1.Pod, error) {
+	uids := map[types.UID]bool{bdc.UID: true}
+	for _, o := range owners {
+		uids[o.uid] = true
+	}
+
+	podList := &v1.PodList{}
+	if err := c.List(context.TODO(), podList, client.InNamespace(bdc.Namespace)); err != nil {
+		return nil, fmt.Errorf("unable to list pods: %v", err)
+	}
+	pods := make([]v1.Pod, 0)
+	for _, pod := range podList.Items {
+		if len(nodeName) != 0 && pod.Spec.NodeName != nodeName {
+			continue
+		}
+		if uids[pod.UID] {
+			pods = append(pods, pod)
+			continue
+		}
+		for _, o := range getOwners(c, pod.Namespace, pod.OwnerReferences, 0) {
+			if uids[o.uid] {
+				pods = append(pods, pod)
+				break
+			}
+		}
+	}
+	return pods, nil
+}
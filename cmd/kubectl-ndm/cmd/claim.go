@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// claimOptions are the options of the claim to be created
+type claimOptions struct {
+	name       string
+	capacity   string
+	node       string
+	driveType  string
+	deviceType string
+}
+
+var claimOpts claimOptions
+
+// claimFormats are the output formats of the claim command
+var claimFormats = []string{cli.OutputText, cli.OutputJSON, cli.OutputYAML}
+
+// claimCmd represents the claim command
+var claimCmd = &cobra.Command{
+	Use:   "claim",
+	Short: "Create a blockdevice claim",
+	Long: `Create a blockdevice claim for a blockdevice with the capacity, on the node
+if given. The claims cannot select the blockdevices by the drive type, so the smallest
+unclaimed blockdevice of the drive type with the capacity is selected by the plugin
+and claimed by name, if the drive type is given`,
+	Example: `  kubectl ndm claim --capacity 1Ti --type ssd --node worker-2`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(output, claimFormats...); err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return createClaim(c, claimOpts, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(claimCmd)
+	claimCmd.Flags().StringVar(&claimOpts.name, "name", "",
+		"Name of the claim. A name is generated if empty")
+	claimCmd.Flags().StringVar(&claimOpts.capacity, "capacity", "",
+		"Capacity of the blockdevice, eg: 500Gi")
+	claimCmd.Flags().StringVar(&claimOpts.node, "node", "",
+		"Node on which the blockdevice is claimed, any node if empty")
+	claimCmd.Flags().StringVar(&claimOpts.driveType, "type", "",
+		"Drive type of the blockdevice, ssd, hdd or nvme")
+	claimCmd.Flags().StringVar(&claimOpts.deviceType, "device-type", "",
+		"Device type of the blockdevice, eg: disk, partition")
+	cli.AddOutputFlag(claimCmd, &output, claimFormats...)
+	_ = claimCmd.MarkFlagRequired("capacity")
+}
+
+// createClaim creates the claim and prints its name, or the claim itself
+// for the json and yaml output
+func createClaim(c client.Client, opts claimOptions, out io.Writer) error {
+	bdc, err := cli.NewClaim(c, cli.ClaimOptions{
+		Namespace:  namespace,
+		Name:       opts.name,
+		Capacity:   opts.capacity,
+		Node:       opts.node,
+		DriveType:  opts.driveType,
+		DeviceType: opts.deviceType,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Create(context.TODO(), bdc); err != nil {
+		return fmt.Errorf("unable to create blockdevice claim %s: %v", bdc.Name, err)
+	}
+	if output == cli.OutputJSON || output == cli.OutputYAML {
+		return cli.PrintObject(out, output, bdc)
+	}
+	if len(bdc.Spec.BlockDeviceName) != 0 {
+		_, err = fmt.Fprintf(out, "blockdeviceclaim/%s created for blockdevice %s\n", bdc.Name, bdc.Spec.BlockDeviceName)
+	} else {
+		_, err = fmt.Fprintf(out, "blockdeviceclaim/%s created\n", bdc.Name)
+	}
+	return err
+}
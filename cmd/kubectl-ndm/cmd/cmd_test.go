@@ -0,0 +1,325 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var testNow = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestBlockDevice(name, nodeName, driveType string, capacity uint64, claimState apis.DeviceClaimState) *apis.BlockDevice {
+	bd := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         defaultNamespace,
+			CreationTimestamp: metav1.NewTime(testNow.Add(-time.Hour)),
+		},
+	}
+	bd.Spec.NodeAttributes.NodeName = nodeName
+	bd.Spec.Path = "/dev/" + name
+	bd.Spec.Details.DeviceType = "disk"
+	bd.Spec.Details.DriveType = driveType
+	bd.Spec.Capacity.Storage = capacity
+	bd.Status.State = apis.BlockDeviceActive
+	bd.Status.ClaimState = claimState
+	return bd
+}
+
+func newTestClient(objects ...runtime.Object) client.Client {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{}, &apis.BlockDeviceList{},
+		&apis.BlockDeviceClaim{}, &apis.BlockDeviceClaimList{})
+	s.AddKnownTypes(v1.SchemeGroupVersion, &v1.Event{}, &v1.EventList{}, &v1.Pod{}, &v1.PodList{})
+	s.AddKnownTypes(appsv1.SchemeGroupVersion, &appsv1.Deployment{}, &appsv1.ReplicaSet{})
+	return fake.NewFakeClientWithScheme(s, objects...)
+}
+
+func newTestObjects() []runtime.Object {
+	claimed := newTestBlockDevice("sdb", "node1", "SSD", 1<<40, apis.BlockDeviceClaimed)
+	claimed.Spec.ClaimRef = &v1.ObjectReference{Name: "bdc-1", Namespace: defaultNamespace}
+	claimed.Labels = map[string]string{"kubernetes.io/hostname": "node1"}
+	bdc := &apis.BlockDeviceClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "bdc-1",
+			Namespace:         defaultNamespace,
+			CreationTimestamp: metav1.NewTime(testNow.Add(-10 * time.Minute)),
+		},
+	}
+	bdc.Spec.BlockDeviceName = "sdb"
+	bdc.Spec.BlockDeviceNodeAttributes.NodeName = "node1"
+	bdc.Spec.Resources.Requests = v1.ResourceList{apis.ResourceStorage: resource.MustParse("500Gi")}
+	bdc.Status.Phase = apis.BlockDeviceClaimStatusDone
+	event := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "sdb.1", Namespace: defaultNamespace},
+		InvolvedObject: v1.ObjectReference{Kind: "BlockDevice", Name: "sdb"},
+		Type:           v1.EventTypeWarning,
+		Reason:         "HealthThresholdExceeded",
+		Message:        "temperature 70 is above the threshold 60",
+		Source:         v1.EventSource{Component: "ndm"},
+		LastTimestamp:  metav1.NewTime(testNow.Add(-5 * time.Minute)),
+	}
+	return []runtime.Object{
+		newTestBlockDevice("sda", "node2", "HDD", 4<<40, apis.BlockDeviceUnclaimed),
+		claimed,
+		newTestBlockDevice("sdc", "node1", "SSD", 2<<40, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("sdd", "node1", "SSD", 8<<40, apis.BlockDeviceUnclaimed),
+		bdc, event,
+	}
+}
+
+func TestGet(t *testing.T) {
+	c := newTestClient(newTestObjects()...)
+
+	var out strings.Builder
+	require.NoError(t, getDevices(c, &out, testNow))
+	assert.Equal(t, `NAME  NODE   PATH      SIZE  DRIVE TYPE  CLAIMSTATE  STATUS  AGE
+sdb   node1  /dev/sdb  1Ti   SSD         Claimed     Active  60m
+sdc   node1  /dev/sdc  2Ti   SSD         Unclaimed   Active  60m
+sdd   node1  /dev/sdd  8Ti   SSD         Unclaimed   Active  60m
+sda   node2  /dev/sda  4Ti   HDD         Unclaimed   Active  60m
+`, out.String())
+
+	nodeName = "node2"
+	defer func() { nodeName = "" }()
+	out.Reset()
+	require.NoError(t, getDevices(c, &out, testNow))
+	assert.Equal(t, `NAME  NODE   PATH      SIZE  DRIVE TYPE  CLAIMSTATE  STATUS  AGE
+sda   node2  /dev/sda  4Ti   HDD         Unclaimed   Active  60m
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, getClaims(c, &out, testNow))
+	assert.Equal(t, "No blockdevice claims found in openebs namespace.\n", out.String())
+
+	nodeName = ""
+	out.Reset()
+	require.NoError(t, getClaims(c, &out, testNow))
+	assert.Equal(t, `NAME   BLOCKDEVICE  PHASE  NODE   CAPACITY  AGE
+bdc-1  sdb          Bound  node1  500Gi     10m
+`, out.String())
+
+	output = cli.OutputWide
+	defer func() { output = cli.OutputText }()
+	out.Reset()
+	require.NoError(t, getClaims(c, &out, testNow))
+	assert.Equal(t, `NAME   BLOCKDEVICE  PHASE  NODE   CAPACITY  AGE  DEVICE TYPE  SELECTOR
+bdc-1  sdb          Bound  node1  500Gi     10m  <none>       <none>
+`, out.String())
+	nodeName = "node2"
+	out.Reset()
+	require.NoError(t, getDevices(c, &out, testNow))
+	assert.Equal(t, `NAME  NODE   PATH      SIZE  DRIVE TYPE  CLAIMSTATE  STATUS  AGE  DEVICE TYPE  MODEL   SERIAL  FSTYPE  CLAIM
+sda   node2  /dev/sda  4Ti   HDD         Unclaimed   Active  60m  disk         <none>  <none>  <none>  <none>
+`, out.String())
+
+	output = cli.OutputJSON
+	out.Reset()
+	require.NoError(t, getDevices(c, &out, testNow))
+	bdList := &apis.BlockDeviceList{}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), bdList))
+	assert.Equal(t, "BlockDeviceList", bdList.Kind)
+	require.Len(t, bdList.Items, 1)
+	assert.Equal(t, "BlockDevice", bdList.Items[0].Kind)
+	assert.Equal(t, "/dev/sda", bdList.Items[0].Spec.Path)
+}
+
+func TestDescribe(t *testing.T) {
+	c := newTestClient(newTestObjects()...)
+
+	var out strings.Builder
+	require.NoError(t, describeDevice(c, "sdb", &out, testNow))
+	assert.Equal(t, `Name:           sdb
+Namespace:      openebs
+Node:           node1
+Path:           /dev/sdb
+Capacity:       1Ti
+Device Type:    disk
+Drive Type:     SSD
+Model:          <none>
+Vendor:         <none>
+Serial:         <none>
+Firmware:       <none>
+SED:            <none>
+Filesystem:     <none>
+Mountpoint:     <none>
+State:          Active
+Claim State:    Claimed
+Unschedulable:  false
+Claim:          bdc-1 (Bound)
+Labels:         kubernetes.io/hostname=node1
+Created:        60m ago
+Events:
+  TYPE     REASON                   AGE  FROM  MESSAGE
+  Warning  HealthThresholdExceeded  5m   ndm   temperature 70 is above the threshold 60
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, describeClaim(c, "bdc-1", &out, testNow))
+	assert.Contains(t, out.String(), "BlockDevice:  sdb (/dev/sdb on node1, 1Ti)\n")
+	assert.True(t, strings.HasSuffix(out.String(), "Events:\t<none>\n"))
+
+	assert.Error(t, describeDevice(c, "sdx", &out, testNow))
+}
+
+func TestCreateClaim(t *testing.T) {
+	c := newTestClient(newTestObjects()...)
+
+	// the smallest unclaimed ssd with the capacity is claimed by name
+	var out strings.Builder
+	require.NoError(t, createClaim(c, claimOptions{name: "bdc-2", capacity: "1500Gi", driveType: "ssd"}, &out))
+	assert.Equal(t, "blockdeviceclaim/bdc-2 created for blockdevice sdc\n", out.String())
+	bdc := &apis.BlockDeviceClaim{}
+	require.NoError(t, c.Get(context.TODO(), types.NamespacedName{Namespace: defaultNamespace, Name: "bdc-2"}, bdc))
+	assert.Equal(t, "sdc", bdc.Spec.BlockDeviceName)
+	assert.Equal(t, "node1", bdc.Spec.BlockDeviceNodeAttributes.NodeName)
+
+	// the blockdevice is selected by the operator without a drive type
+	out.Reset()
+	require.NoError(t, createClaim(c, claimOptions{capacity: "1Ti", node: "node2"}, &out))
+	assert.True(t, strings.HasPrefix(out.String(), "blockdeviceclaim/bdc-"))
+	bdcList := &apis.BlockDeviceClaimList{}
+	require.NoError(t, c.List(context.TODO(), bdcList))
+	assert.Len(t, bdcList.Items, 3)
+
+	// the created claim is printed for the json output
+	output = cli.OutputJSON
+	defer func() { output = cli.OutputText }()
+	out.Reset()
+	require.NoError(t, createClaim(c, claimOptions{name: "bdc-3", capacity: "1Ti", node: "node2"}, &out))
+	bdc = &apis.BlockDeviceClaim{}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), bdc))
+	assert.Equal(t, "bdc-3", bdc.Name)
+	assert.Equal(t, "node2", bdc.Spec.BlockDeviceNodeAttributes.NodeName)
+	output = cli.OutputText
+
+	assert.EqualError(t, createClaim(c, claimOptions{capacity: "10Ti", driveType: "ssd"}, &out),
+		"no unclaimed ssd blockdevice with capacity 10Ti found")
+	assert.EqualError(t, createClaim(c, claimOptions{capacity: "big"}, &out), `invalid capacity "big"`)
+}
+
+func TestBlame(t *testing.T) {
+	objects := newTestObjects()
+	bdc := objects[4].(*apis.BlockDeviceClaim)
+	bdc.UID = "bdc-1-uid"
+	bdc.OwnerReferences = []metav1.OwnerReference{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "pool", UID: "pool-uid"},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool", Namespace: defaultNamespace, UID: "pool-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "cstor.openebs.io/v1", Kind: "CStorPoolCluster", Name: "cspc", UID: "cspc-uid"},
+			}},
+	}
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool-7d9f", Namespace: defaultNamespace, UID: "rs-uid",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "Deployment", Name: "pool", UID: "pool-uid"},
+			}},
+	}
+	newPod := func(name, nodeName string) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: defaultNamespace,
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "pool-7d9f", UID: "rs-uid"},
+				}},
+		}
+		pod.Spec.NodeName = nodeName
+		pod.Status.Phase = v1.PodRunning
+		return pod
+	}
+	unrelated := newPod("ndm-x2x4k", "node1")
+	unrelated.OwnerReferences = nil
+	c := newTestClient(append(objects, deployment, replicaSet,
+		newPod("pool-7d9f-abcde", "node1"), newPod("pool-7d9f-fghij", "node2"), unrelated)...)
+
+	var out strings.Builder
+	require.NoError(t, blame(c, "sdb", &out))
+	assert.Equal(t, `BlockDevice:  sdb (/dev/sdb on node1)
+Claim:        openebs/bdc-1 (Bound)
+Owners:       Deployment/pool -> CStorPoolCluster/cspc
+Pods:         openebs/pool-7d9f-abcde (Running)
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, blame(c, "sdc", &out))
+	assert.Equal(t, `BlockDevice:  sdc (/dev/sdc on node1)
+Claim:        <none>
+`, out.String())
+
+	output = cli.OutputYAML
+	defer func() { output = cli.OutputText }()
+	out.Reset()
+	require.NoError(t, blame(c, "sdb", &out))
+	assert.Equal(t, `blockDevice: sdb
+claim: openebs/bdc-1
+claimFound: true
+claimPhase: Bound
+node: node1
+owners:
+- Deployment/pool
+- CStorPoolCluster/cspc
+path: /dev/sdb
+pods:
+- name: pool-7d9f-abcde
+  namespace: openebs
+  phase: Running
+`, out.String())
+}
+
+func TestCordon(t *testing.T) {
+	c := newTestClient(newTestObjects()...)
+
+	var out strings.Builder
+	require.NoError(t, setUnschedulable(c, "sdc", true, &out))
+	require.NoError(t, setUnschedulable(c, "sdc", true, &out))
+	assert.Equal(t, "blockdevice/sdc cordoned\nblockdevice/sdc already cordoned\n", out.String())
+
+	// the cordoned blockdevice is shown as unschedulable and is not selected for a claim
+	out.Reset()
+	require.NoError(t, getDevices(c, &out, testNow))
+	assert.Contains(t, out.String(), "sdc   node1  /dev/sdc  2Ti   SSD         Unclaimed   Active,SchedulingDisabled  60m\n")
+	out.Reset()
+	require.NoError(t, createClaim(c, claimOptions{name: "bdc-2", capacity: "1500Gi", driveType: "ssd"}, &out))
+	assert.Equal(t, "blockdeviceclaim/bdc-2 created for blockdevice sdd\n", out.String())
+
+	out.Reset()
+	require.NoError(t, setUnschedulable(c, "sdc", false, &out))
+	assert.Equal(t, "blockdevice/sdc uncordoned\n", out.String())
+	bd := &apis.BlockDevice{}
+	require.NoError(t, c.Get(context.TODO(), types.NamespacedName{Namespace: defaultNamespace, Name: "sdc"}, bd))
+	assert.False(t, bd.Spec.Unschedulable)
+
+	assert.Error(t, setUnschedulable(c, "sdx", true, &out))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cordonCmd represents the cordon command
+var cordonCmd = &cobra.Command{
+	Use:   "cordon <blockdevice>",
+	Short: "Mark a blockdevice as unschedulable for new claims",
+	Long: `Mark a blockdevice as unschedulable, so that it is not claimed by new claims,
+eg: before the disk is replaced. The existing claim of the blockdevice is not affected`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return setUnschedulable(c, args[0], true, os.Stdout)
+	},
+}
+
+// uncordonCmd represents the uncordon command
+var uncordonCmd = &cobra.Command{
+	Use:   "uncordon <blockdevice>",
+	Short: "Mark a blockdevice as schedulable for new claims",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return setUnschedulable(c, args[0], false, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cordonCmd, uncordonCmd)
+}
+
+// setUnschedulable cordons or uncordons the blockdevice
+func setUnschedulable(c client.Client, name string, unschedulable bool, out io.Writer) error {
+	bd := &apis.BlockDevice{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, bd); err != nil {
+		return fmt.Errorf("unable to get blockdevice %s: %v", name, err)
+	}
+	action := "cordoned"
+	if !unschedulable {
+		action = "uncordoned"
+	}
+	if bd.Spec.Unschedulable == unschedulable {
+		_, err := fmt.Fprintf(out, "blockdevice/%s already %s\n", name, action)
+		return err
+	}
+
+	bdCopy := bd.DeepCopy()
+	bdCopy.Spec.Unschedulable = unschedulable
+	if err := c.Patch(context.TODO(), bdCopy, client.MergeFrom(bd)); err != nil {
+		return fmt.Errorf("unable to update blockdevice %s: %v", name, err)
+	}
+	_, err := fmt.Fprintf(out, "blockdevice/%s %s\n", name, action)
+	return err
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// describeCmd represents the describe command
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "Show the details of a blockdevice or claim, with its events",
+}
+
+// describeDeviceCmd represents the describe device command
+var describeDeviceCmd = &cobra.Command{
+	Use:     "device <name>",
+	Aliases: []string{"blockdevice", "bd"},
+	Short:   "Show the details of a blockdevice, with its claim and events",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return describeDevice(c, args[0], os.Stdout, time.Now())
+	},
+}
+
+// describeClaimCmd represents the describe claim command
+var describeClaimCmd = &cobra.Command{
+	Use:     "claim <name>",
+	Aliases: []string{"blockdeviceclaim", "bdc"},
+	Short:   "Show the details of a blockdevice claim, with its blockdevice and events",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return describeClaim(c, args[0], os.Stdout, time.Now())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+	describeCmd.AddCommand(describeDeviceCmd, describeClaimCmd)
+}
+
+// describeDevice prints the details of the blockdevice
+func describeDevice(c client.Client, name string, out io.Writer, now time.Time) error {
+	bd := &apis.BlockDevice{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, bd); err != nil {
+		return fmt.Errorf("unable to get blockdevice %s: %v", name, err)
+	}
+
+	w := cli.NewTabWriter(out)
+	fmt.Fprintf(w, "Name:\t%s\n", bd.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", bd.Namespace)
+	fmt.Fprintf(w, "Node:\t%s\n", cli.OrNone(bd.Spec.NodeAttributes.NodeName))
+	fmt.Fprintf(w, "Path:\t%s\n", cli.OrNone(bd.Spec.Path))
+	fmt.Fprintf(w, "Capacity:\t%s\n", cli.Capacity(bd.Spec.Capacity.Storage))
+	fmt.Fprintf(w, "Device Type:\t%s\n", cli.OrNone(bd.Spec.Details.DeviceType))
+	fmt.Fprintf(w, "Drive Type:\t%s\n", cli.OrNone(bd.Spec.Details.DriveType))
+	fmt.Fprintf(w, "Model:\t%s\n", cli.OrNone(bd.Spec.Details.Model))
+	fmt.Fprintf(w, "Vendor:\t%s\n", cli.OrNone(bd.Spec.Details.Vendor))
+	fmt.Fprintf(w, "Serial:\t%s\n", cli.OrNone(bd.Spec.Details.Serial))
+	fmt.Fprintf(w, "Firmware:\t%s\n", cli.OrNone(bd.Spec.Details.FirmwareRevision))
+	fmt.Fprintf(w, "SED:\t%s\n", cli.OrNone(bd.Spec.Details.SED))
+	fmt.Fprintf(w, "Filesystem:\t%s\n", cli.OrNone(bd.Spec.FileSystem.Type))
+	fmt.Fprintf(w, "Mountpoint:\t%s\n", cli.OrNone(bd.Spec.FileSystem.Mountpoint))
+	fmt.Fprintf(w, "State:\t%s\n", bd.Status.State)
+	fmt.Fprintf(w, "Claim State:\t%s\n", bd.Status.ClaimState)
+	fmt.Fprintf(w, "Unschedulable:\t%t\n", bd.Spec.Unschedulable)
+	if bd.Spec.ClaimRef != nil {
+		claim := bd.Spec.ClaimRef.Name
+		bdc := &apis.BlockDeviceClaim{}
+		err := c.Get(context.TODO(),
+			types.NamespacedName{Namespace: bd.Spec.ClaimRef.Namespace, Name: bd.Spec.ClaimRef.Name}, bdc)
+		if err == nil {
+			claim += " (" + string(bdc.Status.Phase) + ")"
+		}
+		fmt.Fprintf(w, "Claim:\t%s\n", claim)
+	} else {
+		fmt.Fprintf(w, "Claim:\t%s\n", cli.None)
+	}
+	fmt.Fprintf(w, "Labels:\t%s\n", formatLabels(bd.Labels))
+	fmt.Fprintf(w, "Created:\t%s ago\n", cli.Age(bd.CreationTimestamp.Time, now))
+	if len(bd.Status.Conditions) != 0 {
+		fmt.Fprintln(w, "Conditions:")
+		fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tMESSAGE")
+		for _, condition := range bd.Status.Conditions {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", condition.Type, condition.Status,
+				cli.OrNone(condition.Reason), condition.Message)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return printEvents(c, out, "BlockDevice", bd.Name, now)
+}
+
+// describeClaim prints the details of the blockdevice claim
+func describeClaim(c client.Client, name string, out io.Writer, now time.Time) error {
+	bdc := &apis.BlockDeviceClaim{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, bdc); err != nil {
+		return fmt.Errorf("unable to get blockdevice claim %s: %v", name, err)
+	}
+
+	w := cli.NewTabWriter(out)
+	fmt.Fprintf(w, "Name:\t%s\n", bdc.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", bdc.Namespace)
+	fmt.Fprintf(w, "Phase:\t%s\n", cli.OrNone(string(bdc.Status.Phase)))
+	fmt.Fprintf(w, "Node:\t%s\n", cli.OrNone(claimNodeName(bdc)))
+	fmt.Fprintf(w, "Capacity:\t%s\n", requestedCapacity(bdc))
+	fmt.Fprintf(w, "Device Type:\t%s\n", cli.OrNone(bdc.Spec.DeviceType))
+	fmt.Fprintf(w, "Volume Mode:\t%s\n", cli.OrNone(string(bdc.Spec.Details.BlockVolumeMode)))
+	if bdc.Spec.Selector != nil {
+		fmt.Fprintf(w, "Selector:\t%s\n", formatLabels(bdc.Spec.Selector.MatchLabels))
+	}
+	blockDevice := cli.OrNone(bdc.Spec.BlockDeviceName)
+	if len(bdc.Spec.BlockDeviceName) != 0 {
+		bd := &apis.BlockDevice{}
+		err := c.Get(context.TODO(), types.NamespacedName{Namespace: bdc.Namespace, Name: bdc.Spec.BlockDeviceName}, bd)
+		if err == nil {
+			blockDevice += fmt.Sprintf(" (%s on %s, %s)", cli.OrNone(bd.Spec.Path),
+				cli.OrNone(bd.Spec.NodeAttributes.NodeName), cli.Capacity(bd.Spec.Capacity.Storage))
+		}
+	}
+	fmt.Fprintf(w, "BlockDevice:\t%s\n", blockDevice)
+	fmt.Fprintf(w, "Labels:\t%s\n", formatLabels(bdc.Labels))
+	fmt.Fprintf(w, "Created:\t%s ago\n", cli.Age(bdc.CreationTimestamp.Time, now))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return printEvents(c, out, "BlockDeviceClaim", bdc.Name, now)
+}
+
+// printEvents prints the events of the object in the namespace, oldest first
+func printEvents(c client.Client, out io.Writer, kind, name string, now time.Time) error {
+	eventList := &v1.EventList{}
+	if err := c.List(context.TODO(), eventList, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("unable to list events: %v", err)
+	}
+	events := make([]v1.Event, 0)
+	for _, event := range eventList.Items {
+		if event.InvolvedObject.Kind == kind && event.InvolvedObject.Name == name {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		_, err := fmt.Fprintf(out, "Events:\t%s\n", cli.None)
+		return err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+
+	fmt.Fprintln(out, "Events:")
+	w := cli.NewTabWriter(out)
+	fmt.Fprintln(w, "  TYPE\tREASON\tAGE\tFROM\tMESSAGE")
+	for _, event := range events {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", event.Type, event.Reason,
+			cli.Age(event.LastTimestamp.Time, now), cli.OrNone(event.Source.Component),
+			strings.TrimSpace(event.Message))
+	}
+	return w.Flush()
+}
+
+// formatLabels returns the labels as comma separated key=value pairs, sorted by key
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return cli.OrNone(strings.Join(pairs, ","))
+}
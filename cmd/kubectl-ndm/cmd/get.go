@@ -0,0 +1,246 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nodeName is the node whose blockdevices or claims are listed, all nodes if empty
+var nodeName string
+
+// getFormats are the formats of the blockdevices and claims
+var getFormats = []string{cli.OutputText, cli.OutputWide, cli.OutputJSON, cli.OutputYAML}
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get",
+	Short: "List the blockdevices or claims",
+}
+
+// getDevicesCmd represents the get devices command
+var getDevicesCmd = &cobra.Command{
+	Use:     "devices",
+	Aliases: []string{"device", "blockdevices", "blockdevice", "bd"},
+	Short:   "List the blockdevices, sorted by node",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(output, getFormats...); err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return getDevices(c, os.Stdout, time.Now())
+	},
+}
+
+// getClaimsCmd represents the get claims command
+var getClaimsCmd = &cobra.Command{
+	Use:     "claims",
+	Aliases: []string{"claim", "blockdeviceclaims", "blockdeviceclaim", "bdc"},
+	Short:   "List the blockdevice claims",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(output, getFormats...); err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return getClaims(c, os.Stdout, time.Now())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	getCmd.AddCommand(getDevicesCmd, getClaimsCmd)
+	getCmd.PersistentFlags().StringVar(&nodeName, "node", "",
+		"List only the blockdevices or claims of the node")
+	cli.AddOutputFlag(getDevicesCmd, &output, getFormats...)
+	cli.AddOutputFlag(getClaimsCmd, &output, getFormats...)
+}
+
+// listBlockDevices returns the blockdevices in the namespace on the node, or
+// on all the nodes if the node name is empty, sorted by node and name
+func listBlockDevices(c client.Client, nodeName string) ([]apis.BlockDevice, error) {
+	bdList := &apis.BlockDeviceList{}
+	if err := c.List(context.TODO(), bdList, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("unable to list blockdevices: %v", err)
+	}
+	devices := make([]apis.BlockDevice, 0, len(bdList.Items))
+	for _, bd := range bdList.Items {
+		if len(nodeName) == 0 || bd.Spec.NodeAttributes.NodeName == nodeName {
+			devices = append(devices, bd)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Spec.NodeAttributes.NodeName != devices[j].Spec.NodeAttributes.NodeName {
+			return devices[i].Spec.NodeAttributes.NodeName < devices[j].Spec.NodeAttributes.NodeName
+		}
+		return devices[i].Name < devices[j].Name
+	})
+	return devices, nil
+}
+
+// claimNodeName returns the node of the blockdevice requested by the claim
+func claimNodeName(bdc *apis.BlockDeviceClaim) string {
+	if len(bdc.Spec.BlockDeviceNodeAttributes.NodeName) != 0 {
+		return bdc.Spec.BlockDeviceNodeAttributes.NodeName
+	}
+	if len(bdc.Spec.BlockDeviceNodeAttributes.HostName) != 0 {
+		return bdc.Spec.BlockDeviceNodeAttributes.HostName
+	}
+	return bdc.Spec.HostName
+}
+
+// requestedCapacity returns the capacity requested by the claim
+func requestedCapacity(bdc *apis.BlockDeviceClaim) string {
+	if storage, ok := bdc.Spec.Resources.Requests[apis.ResourceStorage]; ok {
+		return storage.String()
+	}
+	return cli.None
+}
+
+// getDevices prints the blockdevices as a table, with the device type, model,
+// serial, filesystem and claim in the wide format, or as a list in json or yaml
+func getDevices(c client.Client, out io.Writer, now time.Time) error {
+	devices, err := listBlockDevices(c, nodeName)
+	if err != nil {
+		return err
+	}
+	if output == cli.OutputJSON || output == cli.OutputYAML {
+		bdList := &apis.BlockDeviceList{Items: devices}
+		bdList.SetGroupVersionKind(apis.SchemeGroupVersion.WithKind("BlockDeviceList"))
+		for i := range bdList.Items {
+			bdList.Items[i].SetGroupVersionKind(apis.SchemeGroupVersion.WithKind("BlockDevice"))
+		}
+		return cli.PrintObject(out, output, bdList)
+	}
+	if len(devices) == 0 {
+		_, err := fmt.Fprintf(out, "No blockdevices found in %s namespace.\n", namespace)
+		return err
+	}
+	w := cli.NewTabWriter(out)
+	wide := output == cli.OutputWide
+	fmt.Fprint(w, "NAME\tNODE\tPATH\tSIZE\tDRIVE TYPE\tCLAIMSTATE\tSTATUS\tAGE")
+	if wide {
+		fmt.Fprint(w, "\tDEVICE TYPE\tMODEL\tSERIAL\tFSTYPE\tCLAIM")
+	}
+	fmt.Fprintln(w)
+	for _, bd := range devices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+			bd.Name,
+			cli.OrNone(bd.Spec.NodeAttributes.NodeName),
+			cli.OrNone(bd.Spec.Path),
+			cli.Capacity(bd.Spec.Capacity.Storage),
+			cli.OrNone(bd.Spec.Details.DriveType),
+			bd.Status.ClaimState,
+			deviceStatus(&bd),
+			cli.Age(bd.CreationTimestamp.Time, now))
+		if wide {
+			claim := cli.None
+			if bd.Spec.ClaimRef != nil {
+				claim = bd.Spec.ClaimRef.Name
+			}
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s",
+				cli.OrNone(bd.Spec.Details.DeviceType),
+				cli.OrNone(bd.Spec.Details.Model),
+				cli.OrNone(bd.Spec.Details.Serial),
+				cli.OrNone(bd.Spec.FileSystem.Type),
+				claim)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// deviceStatus returns the state of the blockdevice, with SchedulingDisabled if
+// the blockdevice is cordoned
+func deviceStatus(bd *apis.BlockDevice) string {
+	if bd.Spec.Unschedulable {
+		return string(bd.Status.State) + ",SchedulingDisabled"
+	}
+	return string(bd.Status.State)
+}
+
+// getClaims prints the blockdevice claims as a table, with the device type and
+// selector in the wide format, or as a list in json or yaml
+func getClaims(c client.Client, out io.Writer, now time.Time) error {
+	bdcList := &apis.BlockDeviceClaimList{}
+	if err := c.List(context.TODO(), bdcList, client.InNamespace(namespace)); err != nil {
+		return fmt.Errorf("unable to list blockdevice claims: %v", err)
+	}
+	claims := make([]apis.BlockDeviceClaim, 0, len(bdcList.Items))
+	for _, bdc := range bdcList.Items {
+		if len(nodeName) == 0 || claimNodeName(&bdc) == nodeName {
+			claims = append(claims, bdc)
+		}
+	}
+	sort.Slice(claims, func(i, j int) bool { return claims[i].Name < claims[j].Name })
+	if output == cli.OutputJSON || output == cli.OutputYAML {
+		bdcList := &apis.BlockDeviceClaimList{Items: claims}
+		bdcList.SetGroupVersionKind(apis.SchemeGroupVersion.WithKind("BlockDeviceClaimList"))
+		for i := range bdcList.Items {
+			bdcList.Items[i].SetGroupVersionKind(apis.SchemeGroupVersion.WithKind("BlockDeviceClaim"))
+		}
+		return cli.PrintObject(out, output, bdcList)
+	}
+	if len(claims) == 0 {
+		_, err := fmt.Fprintf(out, "No blockdevice claims found in %s namespace.\n", namespace)
+		return err
+	}
+
+	w := cli.NewTabWriter(out)
+	wide := output == cli.OutputWide
+	fmt.Fprint(w, "NAME\tBLOCKDEVICE\tPHASE\tNODE\tCAPACITY\tAGE")
+	if wide {
+		fmt.Fprint(w, "\tDEVICE TYPE\tSELECTOR")
+	}
+	fmt.Fprintln(w)
+	for i, bdc := range claims {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s",
+			bdc.Name,
+			cli.OrNone(bdc.Spec.BlockDeviceName),
+			cli.OrNone(string(bdc.Status.Phase)),
+			cli.OrNone(claimNodeName(&claims[i])),
+			requestedCapacity(&claims[i]),
+			cli.Age(bdc.CreationTimestamp.Time, now))
+		if wide {
+			selector := cli.None
+			if bdc.Spec.Selector != nil {
+				selector = metav1.FormatLabelSelector(bdc.Spec.Selector)
+			}
+			fmt.Fprintf(w, "\t%s\t%s", cli.OrNone(bdc.Spec.DeviceType), selector)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	goflag "flag"
+	"fmt"
+	"os"
+
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultNamespace is the namespace in which NDM is installed by default
+const defaultNamespace = "openebs"
+
+var (
+	// namespace is the namespace of the blockdevices and claims
+	namespace string
+	// output is the output format of the command
+	output = cli.OutputText
+)
+
+// newClient returns the client of the API server, replaced in the tests
+var newClient = func() (client.Client, error) {
+	return cli.NewKubeClient()
+}
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "kubectl-ndm",
+	Short: "kubectl ndm manages the blockdevices and blockdevice claims of NDM",
+	Long: `kubectl ndm is a kubectl plugin to view the blockdevices and claims of NDM, and
+to claim the blockdevices, with output assembled from the blockdevices, claims and events.
+Install it by placing the kubectl-ndm binary in the PATH`,
+	SilenceUsage: true,
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	initFlags()
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// initFlags initializes the flags. This adds the flagset to the global
+// cobra flagset
+func initFlags() {
+	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
+
+	// HACK: without the following line, the logs will be prefixed with an error
+	// https://github.com/kubernetes/kubernetes/issues/17162#issuecomment-225596212
+	_ = goflag.CommandLine.Parse([]string{})
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", defaultNamespace,
+		"Namespace of the blockdevices and claims")
+	rootCmd.AddCommand(cli.NewCompletionCmd(rootCmd))
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"context"
 	"flag"
+	"net/http"
 	"os"
 	"runtime"
 	"time"
@@ -27,20 +28,22 @@ import (
 	"github.com/openebs/node-disk-manager/pkg/controller"
 	"github.com/openebs/node-disk-manager/pkg/env"
 	ndmlogger "github.com/openebs/node-disk-manager/pkg/logs"
+	"github.com/openebs/node-disk-manager/pkg/server"
 	"github.com/openebs/node-disk-manager/pkg/setup"
 	"github.com/openebs/node-disk-manager/pkg/upgrade"
-	"github.com/openebs/node-disk-manager/pkg/upgrade/v040_041"
-	"github.com/openebs/node-disk-manager/pkg/upgrade/v041_042"
 	"github.com/openebs/node-disk-manager/pkg/version"
 
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	"github.com/operator-framework/operator-sdk/pkg/leader"
 	"github.com/operator-framework/operator-sdk/pkg/ready"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/pflag"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
 )
@@ -48,6 +51,13 @@ import (
 //ReconciliationInterval defines the triggering interval for reconciliation operation
 const ReconciliationInterval = 5 * time.Second
 
+// metricsAddress is the address on which the metrics of the operator are served
+var metricsAddress = "0"
+
+// secureServing are the options to serve the metrics of the operator over TLS
+// and to authenticate the clients, same as the exporter and the daemon
+var secureServing server.SecureOptions
+
 func printVersion() {
 	klog.Infof("Go Version: %s", runtime.Version())
 	klog.Infof("Go OS/Arch: %s/%s", runtime.GOOS, runtime.GOARCH)
@@ -59,7 +69,11 @@ func printVersion() {
 func main() {
 	// define klog flags
 	klog.InitFlags(nil)
-	flag.Parse()
+	flag.StringVar(&metricsAddress, "metrics-address", metricsAddress,
+		"Address(ip:port) on which the metrics of the operator are served. Disabled if 0")
+	secureServing.AddFlags(pflag.CommandLine)
+	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
+	pflag.Parse()
 
 	// The logger instantiated here can be changed to any logger
 	// implementing the logr.Logger interface. This logger will
@@ -73,6 +87,11 @@ func main() {
 
 	printVersion()
 
+	if err := secureServing.Validate(); err != nil {
+		klog.Errorf("Invalid secure serving options: %v", err)
+		os.Exit(1)
+	}
+
 	namespace, err := k8sutil.GetWatchNamespace()
 	if err != nil {
 		klog.Errorf("Failed to get watch namespace: %v", err)
@@ -99,7 +118,9 @@ func main() {
 
 	reconInterval := ReconciliationInterval
 
-	// Create a new Cmd to provide shared dependencies and start components
+	// Create a new Cmd to provide shared dependencies and start components.
+	// The metrics are served by the operator instead of the manager, so that
+	// the secure serving options are applied.
 	mgr, err := manager.New(cfg, manager.Options{Namespace: namespace, SyncPeriod: &reconInterval, MetricsBindAddress: "0"})
 	if err != nil {
 		klog.Errorf("Failed to create a new manager: %v", err)
@@ -154,16 +175,38 @@ func main() {
 
 	klog.Info("Starting the ndm-operator...")
 
+	stopCh := signals.SetupSignalHandler()
+	if metricsAddress != "0" {
+		go serveMetrics(metricsAddress, secureServing, stopCh)
+	}
+
 	// Start the Cmd
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stopCh); err != nil {
 		klog.Errorf("Manager exited non-zero: %v", err)
 		os.Exit(1)
 	}
 }
 
+// serveMetrics serves the metrics registered with the controller-runtime registry
+// on the given address till the stop channel is closed
+func serveMetrics(address string, secure server.SecureOptions, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", secure.Handler(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+	httpServer := &http.Server{Addr: address, Handler: mux}
+	go func() {
+		<-stopCh
+		if err := httpServer.Shutdown(context.Background()); err != nil {
+			klog.Errorf("Error stopping the metrics server: %v", err)
+		}
+	}()
+
+	klog.Infof("Serving metrics on %s", address)
+	if err := secure.ListenAndServe(httpServer); err != nil && err != http.ErrServerClosed {
+		klog.Errorf("Error serving metrics: %v", err)
+	}
+}
+
 // performUpgrade performs the upgrade operations
 func performUpgrade(client client.Client) error {
-	v040_v041UpgradeTask := v040_041.NewUpgradeTask("0.4.0", "0.4.1", client)
-	v041_v042UpgradeTask := v041_042.NewUpgradeTask("0.4.1", "0.4.2", client)
-	return upgrade.RunUpgrade(v040_v041UpgradeTask, v041_v042UpgradeTask)
+	return upgrade.RunUpgrade(upgrade.Tasks(client)...)
 }
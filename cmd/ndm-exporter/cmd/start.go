@@ -18,7 +18,9 @@ package cmd
 
 import (
 	"github.com/openebs/node-disk-manager/ndm-exporter"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
 	"github.com/openebs/node-disk-manager/pkg/util"
+	"github.com/openebs/node-disk-manager/pkg/wear"
 	"github.com/spf13/cobra"
 )
 
@@ -38,7 +40,8 @@ func init() {
 
 	startCmd.PersistentFlags().StringVar(&exporter.Mode, "mode",
 		ndm_exporter.ClusterLevel,
-		`Mode in which the exporter need to be started (cluster / node)`)
+		`Mode in which the exporter need to be started (cluster / node / standalone). `+
+			`The standalone mode runs on a node without kubernetes`)
 
 	startCmd.PersistentFlags().StringVar(&exporter.Server.ListenPort, "port",
 		ndm_exporter.Port,
@@ -47,4 +50,74 @@ func init() {
 	startCmd.PersistentFlags().StringVar(&exporter.Server.MetricsPath, "metrics",
 		ndm_exporter.MetricsPath,
 		"The URL end point at which metrics is available (/metrics, /endpoint)")
+
+	startCmd.PersistentFlags().DurationVar(&exporter.DiskStatsInterval, "diskstats-interval",
+		ndm_exporter.DiskStatsInterval,
+		"Interval at which the IO statistics of the devices are sampled in node mode. Disabled if 0")
+
+	startCmd.PersistentFlags().StringToStringVar(&exporter.CollectionIntervals, "collection-intervals",
+		nil,
+		"Min. interval between the collections of a family of metrics from a device in node mode, "+
+			"eg: temperature=1m,endurance=1h,nvme=5m,selftest=1h. Collected on every scrape if not set")
+
+	startCmd.PersistentFlags().StringSliceVar(&exporter.DisabledCollections, "disabled-collections",
+		nil,
+		"Families of metrics that are not collected in node mode "+
+			"(temperature, endurance, nvme, diskstats, selftest, filesystem, failurerisk)")
+
+	startCmd.PersistentFlags().IntVar(&exporter.DeviceLimit, "device-limit",
+		0,
+		"Max. no. of devices on the node for which temperature, endurance and nvme metrics are collected. No limit if 0")
+
+	startCmd.PersistentFlags().DurationVar(&exporter.WearSampleInterval, "wear-sample-interval",
+		wear.DefaultSampleInterval,
+		"Min. interval between the samples of the endurance used by the SSDs in node mode, "+
+			"from which the days to wear out are estimated. Disabled if 0")
+
+	startCmd.PersistentFlags().StringVar(&exporter.HostRoot, "host-root",
+		"",
+		"Path at which the root filesystem of the host is mounted, to collect the usage of the "+
+			"filesystems mounted from the devices in node mode. Not required in standalone mode")
+
+	startCmd.PersistentFlags().BoolVar(&exporter.FailurePrediction, "failure-prediction",
+		false,
+		"Score the risk of failure of the ATA devices from the SMART attributes in node mode")
+
+	startCmd.PersistentFlags().StringToStringVar(&exporter.FailureRiskWeights, "failure-risk-weights",
+		nil,
+		"Weights of the failure indicators in the risk of failure, between 0 and 1, "+
+			"eg: pending_sectors=0.3,crc_errors=0.1. The default weights are used if not set")
+
+	startCmd.PersistentFlags().BoolVar(&exporter.PartitionMetrics, "partition-metrics",
+		false,
+		"Collect the IO statistics and the filesystem usage of each partition of the disks in standalone mode. "+
+			"In node mode, the partitions are reported if they have blockdevices")
+
+	startCmd.PersistentFlags().BoolVar(&exporter.LeaderElect, "leader-elect",
+		false,
+		"Elect a leader among the replicas of the exporter in cluster mode. Only the leader "+
+			"exports the metrics of the blockdevices, so that they are not duplicated")
+
+	startCmd.PersistentFlags().BoolVar(&labels.LegacyLabels, "legacy-labels",
+		true,
+		"Also set the blockdevicename, nodename and hostname labels of the earlier releases on the device metrics. "+
+			"Deprecated, the legacy labels will be removed in the next release")
+
+	startCmd.PersistentFlags().BoolVar(&exporter.StateMetrics, "state-metrics",
+		true,
+		"Export an info series with the state of each blockdevice and blockdevice claim in cluster mode")
+
+	startCmd.PersistentFlags().StringVar(&exporter.LeaderElectionID, "leader-election-id",
+		ndm_exporter.LeaderElectionID,
+		"Name of the lease used for the leader election, in the namespace of the exporter")
+
+	exporter.Server.Secure.AddFlags(startCmd.PersistentFlags())
+
+	exporter.MetricsFilter.AddFlags(startCmd.PersistentFlags())
+
+	exporter.Push.AddFlags(startCmd.PersistentFlags())
+
+	startCmd.PersistentFlags().BoolVar(&exporter.PushOnly, "push-only",
+		false,
+		"Only push the metrics to --push-url, without serving the metrics endpoint")
 }
@@ -18,6 +18,7 @@ package command
 
 import (
 	goflag "flag"
+	"strings"
 
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
 	"github.com/openebs/node-disk-manager/pkg/features"
@@ -56,12 +57,14 @@ func NewNodeDiskManager() (*cobra.Command, error) {
 		"Path to config file")
 	cmd.PersistentFlags().StringSliceVar(&options.FeatureGate, "feature-gates",
 		nil,
-		"FeatureGates to be enabled or disabled")
+		"A set of key=value pairs separated by comma that describe feature gates "+
+			"for experimental features. Options are:\n"+strings.Join(features.KnownFeatures(), "\n"))
 	_ = goflag.CommandLine.Parse([]string{})
 
 	cmd.AddCommand(
 		NewCmdBlockDevice(), //Add new command on block device
 		NewCmdStart(),       //Add new command to start the ndm controller
+		NewCmdHelper(),      //Add new command to start the privileged helper
 	)
 
 	return cmd, nil
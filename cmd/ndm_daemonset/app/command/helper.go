@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package command
+
+import (
+	"os"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/probe"
+	"github.com/openebs/node-disk-manager/pkg/helper"
+	"github.com/openebs/node-disk-manager/pkg/udevevent"
+
+	"github.com/spf13/cobra"
+	"k8s.io/klog"
+)
+
+// NewCmdHelper starts the privileged helper of the ndm daemon
+func NewCmdHelper() *cobra.Command {
+	address := helper.DefaultAddress
+
+	getCmd := &cobra.Command{
+		Use:   "helper",
+		Short: "Privileged helper of the node disk controller",
+		Long: ` runs the probes which need raw access to the devices, the udev monitor and
+ the partitioning of the devices via "ndm helper" command, so that "ndm start"
+ can run unprivileged with --helper-address `,
+		Run: func(cmd *cobra.Command, args []string) {
+			// the events are sent to the daemon when it watches them
+			go udevevent.Monitor()
+			server := probe.NewHelperServer()
+			if err := server.Serve(address); err != nil {
+				klog.Errorf("unable to serve the helper at %s: %v", address, err)
+				os.Exit(1)
+			}
+		},
+	}
+	getCmd.Flags().StringVar(&address, "address", address,
+		"Path of the socket on which the helper is served")
+
+	return getCmd
+}
@@ -33,6 +33,7 @@ import (
 
 //NewCmdStart starts the ndm controller
 func NewCmdStart() *cobra.Command {
+	var validateConfig bool
 
 	//var target string
 	getCmd := &cobra.Command{
@@ -40,6 +41,34 @@ func NewCmdStart() *cobra.Command {
 		Short: "Node disk controller",
 		Long:  ` watches for ndm custom resources via "ndm start" command `,
 		Run: func(cmd *cobra.Command, args []string) {
+			// only validate the config and exit, used for checking the config in CI
+			if validateConfig {
+				if err := controller.ValidateNDMConfigFile(options.ConfigFilePath); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				fmt.Printf("config %s is valid\n", options.ConfigFilePath)
+				os.Exit(0)
+			}
+
+			if err := controller.SecureServing.Validate(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if err := controller.MetricsFilter.Validate(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if err := controller.MetricsFilter.LoadHashKey(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if len(controller.FakeInventoryPath) != 0 && !controller.FakeProbe {
+				fmt.Println("--fake-inventory can be used only with --fake-probe")
+				os.Exit(1)
+			}
+
 			ctrl, err := controller.NewController()
 			if err != nil {
 				fmt.Println(err)
@@ -56,13 +85,41 @@ func NewCmdStart() *cobra.Command {
 				fmt.Println(err)
 				os.Exit(1)
 			}
+			// run the privileged probes using the helper, if configured
+			if err := probe.ConnectHelper(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
 			// Broadcast starts broadcasting controller pointer. Using this
 			// each probe and filter registers themselves.
 			ctrl.Broadcast()
 			// Start starts registering of filters present in RegisteredFilters
 			filter.Start(filter.RegisteredFilters)
-			// Start starts registering of probes present in RegisteredProbes
-			probe.Start(probe.RegisteredProbes)
+			// reload the filters and probes when the config changes
+			ctrl.AddConfigReloadHandler(controller.ApplyLogConfig)
+			ctrl.AddConfigReloadHandler(controller.ApplyTracingConfig)
+			ctrl.AddConfigReloadHandler(controller.ApplyMetricsConfig)
+			ctrl.AddConfigReloadHandler(filter.Reload)
+			if controller.FakeProbe {
+				// discover the devices from the inventory instead of the node
+				if len(controller.FakeInventoryPath) != 0 {
+					deviceList, err := controller.ReadInventory(controller.FakeInventoryPath)
+					if err == nil {
+						err = ctrl.SetFakeInventory(deviceList)
+					}
+					if err != nil {
+						fmt.Println(err)
+						os.Exit(1)
+					}
+				}
+				probe.Start(probe.FakeProbes)
+			} else {
+				// Start starts registering of probes present in RegisteredProbes
+				probe.Start(probe.RegisteredProbes)
+				ctrl.AddConfigReloadHandler(probe.Reload)
+			}
+			// recreate the deleted blockdevices of attached devices by scanning the devices
+			ctrl.SetRecreateHandler(probe.Rescan)
 			ctrl.Start()
 
 		},
@@ -71,6 +128,61 @@ func NewCmdStart() *cobra.Command {
 	getCmd.PersistentFlags().StringVar(&grpc.Address, "api-service-address",
 		grpc.DefaultAddress,
 		"Address(ip:port) for api service")
+	getCmd.PersistentFlags().StringVar(&controller.MetricsAddress, "metrics-address",
+		"",
+		"Address(ip:port) on which the metrics and the devices on the node (/v1/devices) are served, not served if empty")
+	getCmd.PersistentFlags().StringVar(&controller.HealthAddress, "health-address",
+		"",
+		"Address(ip:port) on which the /healthz and /readyz endpoints are served, not served if empty")
+	getCmd.PersistentFlags().StringVar(&controller.JournalPath, "journal-path",
+		controller.JournalPath,
+		"Path of the file in which the processed devices are journaled, to detect changes while the daemon was down. Not used if empty")
+	getCmd.PersistentFlags().IntVar(&controller.WriteQueueSize, "write-queue-size",
+		controller.WriteQueueSize,
+		"Max no. of blockdevice writes queued while the API server is unreachable. Writes are not queued if 0")
+	getCmd.PersistentFlags().DurationVar(&controller.RemovalGracePeriod, "removal-grace-period",
+		controller.RemovalGracePeriod,
+		"Duration for which the blockdevice of a removed device is kept Unknown before it is made Inactive. Made Inactive immediately if 0")
+	getCmd.PersistentFlags().BoolVar(&controller.RBDClaimable, "rbd-claimable",
+		controller.RBDClaimable,
+		"Make the blockdevices of mapped ceph rbd images claimable without giving the ceph-rbd block-device-tag in the claim")
+	getCmd.PersistentFlags().StringVar(&controller.BlockDeviceNamespace, "blockdevice-namespace",
+		controller.BlockDeviceNamespace,
+		"Namespace in which the blockdevices are created. The namespace in which NDM is installed is used if empty")
+	getCmd.PersistentFlags().BoolVar(&controller.NodeOwnerReference, "node-owner-reference",
+		controller.NodeOwnerReference,
+		"Set the node as the owner of the blockdevices, so that they are garbage collected when the node is deleted")
+	getCmd.PersistentFlags().StringVar(&probe.HelperAddress, "helper-address",
+		probe.HelperAddress,
+		"Path of the socket of the privileged helper which runs the probes needing raw access to the devices. The probes are run by the daemon if empty")
+	getCmd.PersistentFlags().BoolVar(&controller.DisableSGIO, "disable-sg-io",
+		controller.DisableSGIO,
+		"Disable the probes which send SCSI commands to the devices using the SG_IO ioctl")
+	getCmd.PersistentFlags().BoolVar(&controller.ReadOnlyDeviceAccess, "read-only-device-access",
+		controller.ReadOnlyDeviceAccess,
+		"Open the devices only for reading. Disables SG_IO and the creation of GPT partitions on devices which cannot be identified")
+	getCmd.PersistentFlags().StringSliceVar(&controller.AllowedDevicePaths, "allowed-device-paths",
+		controller.AllowedDevicePaths,
+		"Glob patterns of the device nodes which may be opened by the probes or partitioned, eg: /dev/sd*,/dev/nvme*. All devices are allowed if empty")
+	getCmd.PersistentFlags().StringSliceVar(&controller.AllowedHostPaths, "allowed-host-paths",
+		controller.AllowedHostPaths,
+		"Glob patterns of the host paths mounted in the pod which may be accessed, like the mounts of the host, the journal and the sparse file directories. A path is allowed if it or a parent directory matches. All paths are allowed if empty")
+	getCmd.PersistentFlags().BoolVar(&controller.DryRun, "dry-run",
+		controller.DryRun,
+		"Discover and probe the devices without writing to the API server, the devices or the host. No partitions, sparse files, loop devices or journal are written. The blockdevices are logged, and served at /blockdevices on the metrics address")
+	getCmd.PersistentFlags().BoolVar(&controller.FakeProbe, "fake-probe",
+		controller.FakeProbe,
+		"Discover the devices from an inventory exported using ndmctl instead of the devices on the node, to reproduce the discovery on another node. The inventory is loaded using --fake-inventory or ndmctl inventory import")
+	getCmd.PersistentFlags().StringVar(&controller.FakeInventoryPath, "fake-inventory",
+		controller.FakeInventoryPath,
+		"Path of the inventory of devices loaded at startup in the fake probe mode")
+	getCmd.PersistentFlags().StringVar(&controller.APISocket, "api-socket",
+		controller.APISocket,
+		"Path of the unix socket on which the local api used by ndmctl is served. Disabled if empty")
+	controller.SecureServing.AddFlags(getCmd.PersistentFlags())
+	controller.MetricsFilter.AddFlags(getCmd.PersistentFlags())
+	getCmd.Flags().BoolVar(&validateConfig, "validate-config", false,
+		"Validate the config file and exit")
 
 	return getCmd
 }
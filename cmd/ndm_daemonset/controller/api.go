@@ -0,0 +1,46 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+)
+
+// DefaultAPISocket is the default path of the socket of the local api of the daemon
+const DefaultAPISocket = "/run/ndm/ndm.sock"
+
+// APISocket is the path of the unix socket on which the local api of the daemon
+// is served, used by ndmctl on the node. The api is not served if it is empty.
+var APISocket = DefaultAPISocket
+
+// apiHandler returns the handler of the local api of the daemon
+func (c *Controller) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(DevicesPath, c.devicesHandler)
+	mux.HandleFunc(RescanPath, c.rescanHandler)
+	mux.HandleFunc(InventoryPath, c.inventoryHandler)
+	mux.HandleFunc(SparsePath, c.sparseHandler)
+	return mux
+}
+
+// serveAPI serves the local api on APISocket till the stop channel is closed
+func (c *Controller) serveAPI(stopCh <-chan struct{}) {
+	if len(APISocket) == 0 {
+		return
+	}
+	serveUnix("api", APISocket, c.apiHandler(), stopCh)
+}
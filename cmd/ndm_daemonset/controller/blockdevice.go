@@ -17,8 +17,11 @@ limitations under the License.
 package controller
 
 import (
+	"strings"
+
 	bd "github.com/openebs/node-disk-manager/blockdevice"
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -45,10 +48,22 @@ type DeviceInfo struct {
 	PhysicalBlockSize  uint32   // PhysicalBlockSize is the physical block size in bytes
 	HardwareSectorSize uint32   // HardwareSectorSize is the hardware sector size in bytes
 	Compliance         string   // Compliance is implemented specifications version i.e. SPC-1, SPC-2, etc
+	SED                string   // SED is the TCG Security Subsystem Class of a self-encrypting drive
 	DeviceType         string   // DeviceType represents the type of device, like disk/sparse/partition
 	DriveType          string   // DriveType represents the type of backing drive HDD/SSD
 	PartitionType      string   // Partition type if the blockdevice is a partition
 	FileSystemInfo     FSInfo   // FileSystem info of the blockdevice like FSType and MountPoint
+	SkippedProbes      []string // SkippedProbes are the probes that were not run on the blockdevice
+	Flapping           bool     // Flapping is set if the blockdevice is repeatedly attached and detached
+	UUIDCollision      string   // UUIDCollision describes the conflict if the UUID had to be disambiguated
+	OriginalUUID       string   // OriginalUUID is the UUID generated before disambiguation
+	Partitions         []string // Partitions are the paths of the partitions of the blockdevice
+
+	// Optional annotations that can be added to the blockdevice resource
+	Annotations map[string]string
+
+	// HealthAlerts are the health thresholds crossed by the blockdevice
+	HealthAlerts []HealthAlert
 }
 
 // NewDeviceInfo returns a pointer of empty DeviceInfo
@@ -88,10 +103,17 @@ func (di *DeviceInfo) getObjectMeta() metav1.ObjectMeta {
 	objectMeta.Labels[KubernetesHostNameLabel] = di.NodeAttributes[HostNameKey]
 	objectMeta.Labels[NDMDeviceTypeKey] = NDMDefaultDeviceType
 	objectMeta.Labels[NDMManagedKey] = TrueString
+	objectMeta.Labels[ManagedByLabel] = ManagedByValue
 	// adding custom labels
 	for k, v := range di.Labels {
 		objectMeta.Labels[k] = v
 	}
+	for k, v := range di.Annotations {
+		objectMeta.Annotations[k] = v
+	}
+	if len(di.OriginalUUID) != 0 {
+		objectMeta.Annotations[OriginalUUIDAnnotation] = di.OriginalUUID
+	}
 	return objectMeta
 }
 
@@ -114,6 +136,33 @@ func (di *DeviceInfo) getStatus() apis.DeviceStatus {
 		ClaimState: apis.BlockDeviceUnclaimed,
 		State:      NDMActive,
 	}
+	if len(di.SkippedProbes) != 0 {
+		deviceStatus.SetCondition(apis.BlockDeviceCondition{
+			Type:    apis.BlockDeviceProbeSkipped,
+			Status:  v1.ConditionTrue,
+			Reason:  "ProbeFailures",
+			Message: "probes skipped due to repeated failures: " + strings.Join(di.SkippedProbes, ", "),
+		})
+	}
+	if di.Flapping {
+		deviceStatus.SetCondition(apis.BlockDeviceCondition{
+			Type:    apis.BlockDeviceFlapping,
+			Status:  v1.ConditionTrue,
+			Reason:  "RepeatedAttachDetach",
+			Message: "blockdevice has been attached and detached repeatedly",
+		})
+	}
+	if len(di.UUIDCollision) != 0 {
+		deviceStatus.SetCondition(apis.BlockDeviceCondition{
+			Type:    apis.BlockDeviceUUIDCollision,
+			Status:  v1.ConditionTrue,
+			Reason:  "DuplicateUUID",
+			Message: di.UUIDCollision,
+		})
+	}
+	if len(di.HealthAlerts) != 0 {
+		deviceStatus.SetCondition(healthThresholdCondition(di.HealthAlerts))
+	}
 	return deviceStatus
 }
 
@@ -129,11 +178,20 @@ func (di *DeviceInfo) getDeviceSpec() apis.DeviceSpec {
 	deviceSpec.Details = di.getDeviceDetails()
 	deviceSpec.Capacity = di.getDeviceCapacity()
 	deviceSpec.DevLinks = di.getDeviceLinks()
-	deviceSpec.Partitioned = NDMNotPartitioned
+	deviceSpec.Partitioned = getPartitioned(di.Partitions)
+	deviceSpec.Partitions = di.Partitions
 	deviceSpec.FileSystem = di.FileSystemInfo.getFileSystemInfo()
 	return deviceSpec
 }
 
+// getPartitioned returns if the blockdevice has partitions (Yes/No)
+func getPartitioned(partitions []string) string {
+	if len(partitions) != 0 {
+		return NDMPartitioned
+	}
+	return NDMNotPartitioned
+}
+
 // getPath returns path of the blockdevice like (/dev/sda , /dev/sdb ...).
 // It is used to populate data of BlockDevice struct of BlockDevice CR.
 func (di *DeviceInfo) getPath() string {
@@ -150,6 +208,7 @@ func (di *DeviceInfo) getDeviceDetails() apis.DeviceDetails {
 	deviceDetails.Vendor = di.Vendor
 	deviceDetails.FirmwareRevision = di.FirmwareRevision
 	deviceDetails.Compliance = di.Compliance
+	deviceDetails.SED = di.SED
 	deviceDetails.DeviceType = di.DeviceType
 	deviceDetails.DriveType = di.DriveType
 	deviceDetails.LogicalBlockSize = di.LogicalBlockSize
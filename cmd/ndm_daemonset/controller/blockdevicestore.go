@@ -20,12 +20,15 @@ import (
 	"context"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
+	"reflect"
 
+	bd "github.com/openebs/node-disk-manager/blockdevice"
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/logs"
 	"github.com/openebs/node-disk-manager/pkg/util"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -38,18 +41,23 @@ func (c *Controller) CreateBlockDevice(blockDevice apis.BlockDevice) error {
 	blockDevice.SetNamespace(c.Namespace)
 
 	blockDeviceCopy := blockDevice.DeepCopy()
+	c.updateStatsEpoch(blockDeviceCopy)
+	c.setOwnerReference(blockDeviceCopy)
 	err := c.Clientset.Create(context.TODO(), blockDeviceCopy)
 	if err == nil {
-		klog.Infof("eventcode=%s msg=%s rname=%v",
-			"ndm.blockdevice.create.success", "Created blockdevice object in etcd",
-			blockDeviceCopy.ObjectMeta.Name)
+		blockDeviceLogger(blockDeviceCopy).Info("Created blockdevice object in etcd",
+			"eventcode", "ndm.blockdevice.create.success")
+		c.recordBlockDevice(blockDeviceCopy)
+		c.recordHealthThresholdEvent(nil, blockDeviceCopy)
 		return err
 	}
 
 	if !errors.IsAlreadyExists(err) {
-		klog.Errorf("eventcode=%s msg=%s : %v rname=%v",
-			"ndm.blockdevice.create.failure", "Creation of blockdevice object failed",
-			err, blockDeviceCopy.ObjectMeta.Name)
+		blockDeviceLogger(blockDeviceCopy).Error(err, "Creation of blockdevice object failed",
+			"eventcode", "ndm.blockdevice.create.failure")
+		if c.queueWrite(queuedPush, &blockDevice, err) {
+			return nil
+		}
 		return err
 	}
 
@@ -64,7 +72,7 @@ func (c *Controller) CreateBlockDevice(blockDevice apis.BlockDevice) error {
 	}
 
 	if !errors.IsConflict(err) {
-		klog.Error("Updating of BlockDevice Object failed: ", err)
+		logger.Errorf("Updating of BlockDevice Object failed: %v", err)
 		return err
 	}
 
@@ -72,11 +80,12 @@ func (c *Controller) CreateBlockDevice(blockDevice apis.BlockDevice) error {
 	 * Update might failed due to to resource version mismatch which
 	 * can happen if some other entity updating same resource in parallel.
 	 */
+	APIRequestRetriesTotal.WithLabelValues(RetryReasonConflict).Inc()
 	err = c.UpdateBlockDevice(blockDevice, nil)
 	if err == nil {
 		return err
 	}
-	klog.Error("Update to blockdevice object failed: ", blockDevice.ObjectMeta.Name)
+	logger.Errorf("Update to blockdevice object failed: %v", blockDevice.ObjectMeta.Name)
 	return nil
 }
 
@@ -91,26 +100,80 @@ func (c *Controller) UpdateBlockDevice(blockDevice apis.BlockDevice, oldBlockDev
 			Namespace: oldBlockDevice.Namespace,
 			Name:      oldBlockDevice.Name}, oldBlockDevice)
 		if err != nil {
-			klog.Errorf("eventcode=%s msg=%s : %v, err:%v rname=%v",
-				"ndm.blockdevice.update.failure",
-				"Failed to update block device : unable to get blockdevice object",
-				oldBlockDevice.ObjectMeta.Name, err, blockDeviceCopy.ObjectMeta.Name)
+			blockDeviceLogger(blockDeviceCopy).Error(err, "Unable to get blockdevice object for update",
+				"eventcode", "ndm.blockdevice.update.failure")
+			if c.queueWrite(queuedPush, &blockDevice, err) {
+				return nil
+			}
 			return err
 		}
 	}
 
 	blockDeviceCopy = mergeBlockDeviceData(*blockDeviceCopy, *oldBlockDevice)
+	c.updateStatsEpoch(blockDeviceCopy)
+	c.setOwnerReference(blockDeviceCopy)
 
 	err = c.Clientset.Update(context.TODO(), blockDeviceCopy)
 	if err != nil {
-		klog.Errorf("eventcode=%s msg=%s : %v rname=%v",
-			"ndm.blockdevice.update.failure", "Unable to update blockdevice object",
-			err, blockDeviceCopy.ObjectMeta.Name)
+		blockDeviceLogger(blockDeviceCopy).Error(err, "Unable to update blockdevice object",
+			"eventcode", "ndm.blockdevice.update.failure")
+		if c.queueWrite(queuedPush, &blockDevice, err) {
+			return nil
+		}
+		return err
+	}
+	blockDeviceLogger(blockDeviceCopy).Info("Updated blockdevice object",
+		"eventcode", "ndm.blockdevice.update.success")
+	c.recordPathChange(oldBlockDevice, blockDeviceCopy)
+	c.recordHealthThresholdEvent(oldBlockDevice, blockDeviceCopy)
+	c.recordBlockDevice(blockDeviceCopy)
+	return nil
+}
+
+// UpdateBlockDeviceFileSystem patches only the filesystem details of the BlockDevice
+// resource with the details of the device. Other fields of the resource are not changed.
+func (c *Controller) UpdateBlockDeviceFileSystem(blockDevice *apis.BlockDevice, device *bd.BlockDevice) error {
+	fsInfo := c.NewDeviceInfoFromBlockDevice(device).FileSystemInfo.getFileSystemInfo()
+	if blockDevice.Spec.FileSystem == fsInfo {
+		logger.V(4).Infof("filesystem of %s is unchanged", blockDevice.Name)
+		return nil
+	}
+
+	blockDeviceCopy := blockDevice.DeepCopy()
+	blockDeviceCopy.Spec.FileSystem = fsInfo
+	err := c.Clientset.Patch(context.TODO(), blockDeviceCopy, client.MergeFrom(blockDevice))
+	if err != nil {
+		blockDeviceLogger(blockDevice).Error(err, "Unable to patch filesystem of blockdevice object",
+			"eventcode", "ndm.blockdevice.filesystem.update.failure")
 		return err
 	}
-	klog.Infof("eventcode=%s msg=%s rname=%v",
-		"ndm.blockdevice.update.success", "Updated blockdevice object",
-		blockDeviceCopy.ObjectMeta.Name)
+	blockDeviceLogger(blockDevice).Info("Updated filesystem of blockdevice object",
+		"eventcode", "ndm.blockdevice.filesystem.update.success",
+		"type", fsInfo.Type, "mountpoint", fsInfo.Mountpoint)
+	return nil
+}
+
+// UpdateBlockDevicePartitions patches only the partition details of the BlockDevice
+// resource. Other fields of the resource are not changed.
+func (c *Controller) UpdateBlockDevicePartitions(blockDevice *apis.BlockDevice, partitions []string) error {
+	partitioned := getPartitioned(partitions)
+	if blockDevice.Spec.Partitioned == partitioned &&
+		reflect.DeepEqual(blockDevice.Spec.Partitions, partitions) {
+		logger.V(4).Infof("partitions of %s are unchanged", blockDevice.Name)
+		return nil
+	}
+
+	blockDeviceCopy := blockDevice.DeepCopy()
+	blockDeviceCopy.Spec.Partitioned = partitioned
+	blockDeviceCopy.Spec.Partitions = partitions
+	err := c.Clientset.Patch(context.TODO(), blockDeviceCopy, client.MergeFrom(blockDevice))
+	if err != nil {
+		blockDeviceLogger(blockDevice).Error(err, "Unable to patch partitions of blockdevice object",
+			"eventcode", "ndm.blockdevice.partitions.update.failure")
+		return err
+	}
+	blockDeviceLogger(blockDevice).Info("Updated partitions of blockdevice object",
+		"eventcode", "ndm.blockdevice.partitions.update.success", "partitions", partitions)
 	return nil
 }
 
@@ -119,16 +182,17 @@ func (c *Controller) DeactivateBlockDevice(blockDevice apis.BlockDevice) {
 
 	blockDeviceCopy := blockDevice.DeepCopy()
 	blockDeviceCopy.Status.State = NDMInactive
+	delete(blockDeviceCopy.Annotations, HeartbeatExpiredAnnotation)
 	err := c.Clientset.Update(context.TODO(), blockDeviceCopy)
 	if err != nil {
-		klog.Errorf("eventcode=%s msg=%s : %v rname=%v ",
-			"ndm.blockdevice.deactivate.failure", "Unable to deactivate blockdevice",
-			err, blockDeviceCopy.ObjectMeta.Name)
+		blockDeviceLogger(blockDeviceCopy).Error(err, "Unable to deactivate blockdevice",
+			"eventcode", "ndm.blockdevice.deactivate.failure")
+		c.queueWrite(queuedDeactivate, blockDeviceCopy, err)
 		return
 	}
-	klog.Infof("eventcode=%s msg=%s rname=%v",
-		"ndm.blockdevice.deactivate.success", "Deactivated blockdevice",
-		blockDeviceCopy.ObjectMeta.Name)
+	blockDeviceLogger(blockDeviceCopy).Info("Deactivated blockdevice",
+		"eventcode", "ndm.blockdevice.deactivate.success")
+	c.recordBlockDevice(blockDeviceCopy)
 }
 
 // GetBlockDevice get Disk resource from etcd
@@ -138,10 +202,10 @@ func (c *Controller) GetBlockDevice(name string) (*apis.BlockDevice, error) {
 		client.ObjectKey{Namespace: c.Namespace, Name: name}, dvr)
 
 	if err != nil {
-		klog.Error("Unable to get blockdevice object : ", err)
+		logger.Errorf("Unable to get blockdevice object : %v", err)
 		return nil, err
 	}
-	klog.Info("Got blockdevice object : ", name)
+	logger.Infof("Got blockdevice object : %v", name)
 	return dvr, nil
 }
 
@@ -154,15 +218,19 @@ func (c *Controller) DeleteBlockDevice(name string) {
 		},
 	}
 
+	// a queued write would create the blockdevice again
+	c.dropQueuedWrite(name)
+	c.recordDeletion(name, true)
 	err := c.Clientset.Delete(context.TODO(), blockDevice)
 	if err != nil {
-		klog.Errorf("eventcode=%s msg=%s : %v rname=%v",
-			"ndm.blockdevice.delete.failure", "Unable to delete blockdevice object",
-			err, name)
+		c.recordDeletion(name, false)
+		logger.Error(err, "Unable to delete blockdevice object",
+			"eventcode", "ndm.blockdevice.delete.failure", logs.UUIDKey, name, logs.ResourceNameKey, name)
 		return
 	}
-	klog.Infof("eventcode=%s msg=%s rname=%v",
-		"ndm.blockdevice.delete.success", "Deleted blockdevice object ", name)
+	logger.Info("Deleted blockdevice object",
+		"eventcode", "ndm.blockdevice.delete.success", logs.UUIDKey, name, logs.ResourceNameKey, name)
+	c.journal.remove(name)
 }
 
 // ListBlockDeviceResource queries the etcd for the devices
@@ -228,17 +296,37 @@ func (c *Controller) GetExistingBlockDeviceResource(blockDeviceList *apis.BlockD
 // DeactivateStaleBlockDeviceResource deactivates the stale entry from etcd.
 // It gets list of resources which are present in system and queries etcd to get
 // list of active resources. Active resource which is present in etcd not in
-// system that will be marked as inactive.
-func (c *Controller) DeactivateStaleBlockDeviceResource(devices []string) {
-	listDevices := append(devices, GetActiveSparseBlockDevicesUUID(c.NodeAttributes[HostNameKey])...)
+// system that will be marked as inactive. On the first scan after startup, the
+// same list is used to take the snapshot for the startup drift, and the devices
+// which were removed while the daemon was not running are found from the journal
+// using the device paths detected by the scan.
+func (c *Controller) DeactivateStaleBlockDeviceResource(devices, devPaths []string) {
+	listDevices := append(devices, GetActiveSparseBlockDevicesUUID(c.getUUIDHostName(), c.sparseFileDirs())...)
 	blockDeviceList, err := c.ListBlockDeviceResource(false)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to list the blockdevices")
 		return
 	}
+	c.startDrift(blockDeviceList.Items)
+	removedWhileDown := c.journal.missingDevices(devPaths)
 	for _, item := range blockDeviceList.Items {
-		if !util.Contains(listDevices, item.ObjectMeta.Name) {
-			c.DeactivateBlockDevice(item)
+		// blockdevices with a disambiguated UUID are identified by their original UUID
+		if originalUUID, ok := item.Annotations[OriginalUUIDAnnotation]; ok &&
+			util.Contains(listDevices, originalUUID) {
+			continue
+		}
+		if util.Contains(listDevices, item.ObjectMeta.Name) {
+			continue
+		}
+		if item.Status.State == NDMInactive {
+			c.recordBlockDevice(&item)
+			continue
+		}
+		c.DeactivateBlockDevice(item)
+		if util.Contains(removedWhileDown, item.Name) {
+			blockDeviceLogger(&item).Info("blockdevice was removed while the daemon was not running")
+			c.NodeEventf(v1.EventTypeNormal, "DeviceRemovedWhileDown",
+				"Deactivated %s, %s was removed while the daemon was not running", item.Name, item.Spec.Path)
 		}
 	}
 }
@@ -261,16 +349,18 @@ func (c *Controller) PushBlockDeviceResource(oldBlockDevice *apis.BlockDevice,
 func (c *Controller) MarkBlockDeviceStatusToUnknown() {
 	blockDeviceList, err := c.ListBlockDeviceResource(false)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to list the blockdevices")
 		return
 	}
 	for _, item := range blockDeviceList.Items {
 		blockDeviceCopy := item.DeepCopy()
 		blockDeviceCopy.Status.State = NDMUnknown
+		// the daemon is shutting down, the blockdevice is not to be made
+		// Active by the operator when the heartbeat lease is renewed
+		delete(blockDeviceCopy.Annotations, HeartbeatExpiredAnnotation)
 		err := c.Clientset.Update(context.TODO(), blockDeviceCopy)
 		if err == nil {
-			klog.Error("Status marked unknown for blockdevice object: ",
-				blockDeviceCopy.ObjectMeta.Name)
+			logger.Infof("Status marked unknown for blockdevice object: %v", blockDeviceCopy.ObjectMeta.Name)
 		}
 	}
 }
@@ -283,21 +373,50 @@ func (c *Controller) MarkBlockDeviceStatusToUnknown() {
 func mergeBlockDeviceData(newBD, oldBD apis.BlockDevice) *apis.BlockDevice {
 	oldBD.TypeMeta = newBD.TypeMeta
 	oldBD.ObjectMeta = mergeMetadata(newBD.ObjectMeta, oldBD.ObjectMeta)
+	conditions := mergeConditions(newBD.Status, oldBD.Status)
 	// if the device is in use, only the below fields will be updated.
 	if oldBD.Status.ClaimState != apis.BlockDeviceUnclaimed {
-		klog.V(4).Infof("device: %s is in use, updating only relevant fields", newBD.Spec.Path)
+		logger.V(4).Infof("device: %s is in use, updating only relevant fields", newBD.Spec.Path)
 		oldBD.Spec.NodeAttributes = newBD.Spec.NodeAttributes
 		oldBD.Spec.Capacity.Storage = newBD.Spec.Capacity.Storage
 		oldBD.Spec.Path = newBD.Spec.Path
 		oldBD.Spec.DevLinks = newBD.Spec.DevLinks
 		oldBD.Status.State = newBD.Status.State
 	} else {
+		// the blockdevice is cordoned by the user, which is kept as is
+		unschedulable := oldBD.Spec.Unschedulable
 		oldBD.Spec = newBD.Spec
+		oldBD.Spec.Unschedulable = unschedulable
 		oldBD.Status = newBD.Status
 	}
+	oldBD.Status.Conditions = conditions
 	return &oldBD
 }
 
+// daemonConditionTypes are the blockdevice conditions owned by the NDM daemon.
+// Conditions of other types are set by other components and are preserved
+// when the daemon updates the resource.
+var daemonConditionTypes = []apis.BlockDeviceConditionType{
+	apis.BlockDeviceProbeSkipped,
+	apis.BlockDeviceFlapping,
+	apis.BlockDeviceUUIDCollision,
+	apis.BlockDeviceHealthThresholdExceeded,
+}
+
+// mergeConditions takes the existing conditions and updates the conditions
+// owned by the daemon with those from the new status.
+func mergeConditions(newStatus, oldStatus apis.DeviceStatus) []apis.BlockDeviceCondition {
+	merged := oldStatus.DeepCopy()
+	for _, condType := range daemonConditionTypes {
+		if cond := newStatus.GetCondition(condType); cond != nil {
+			merged.SetCondition(*cond)
+		} else {
+			merged.RemoveCondition(condType)
+		}
+	}
+	return merged.Conditions
+}
+
 // mergeMetadata merges oldMetadata with newMetadata. It takes old metadata and
 // update it's value with the help of new metadata.
 func mergeMetadata(newMetadata, oldMetadata metav1.ObjectMeta) metav1.ObjectMeta {
@@ -314,7 +433,7 @@ func mergeMetadata(newMetadata, oldMetadata metav1.ObjectMeta) metav1.ObjectMeta
 	// - deletionGracePeriodSeconds - populated by the system we should use old object.
 	// - labels - we will patch older labels with new labels.
 	// - annotations - we will patch older annotations with new annotations.
-	// - ownerReferences as ndm-ds is not adding ownerReferences we can go with old object.
+	// - ownerReferences - we can use old object, the node owner is set after the merge.
 	// - initializers ^^^
 	// - finalizers ^^^
 	// - clusterName - no patch required we can use old object.
@@ -336,3 +455,12 @@ func mergeMetadata(newMetadata, oldMetadata metav1.ObjectMeta) metav1.ObjectMeta
 
 	return oldMetadata
 }
+
+// blockDeviceLogger returns a logger with the uuid, resource name, path and node
+// of the blockdevice
+func blockDeviceLogger(blockDevice *apis.BlockDevice) logs.Logger {
+	return logger.WithValues(logs.UUIDKey, blockDevice.Name,
+		logs.ResourceNameKey, blockDevice.Name,
+		logs.PathKey, blockDevice.Spec.Path,
+		logs.NodeKey, blockDevice.Spec.NodeAttributes.NodeName)
+}
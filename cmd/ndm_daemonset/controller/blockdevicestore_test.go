@@ -18,9 +18,12 @@ package controller
 
 import (
 	"testing"
+	"time"
 
+	bd "github.com/openebs/node-disk-manager/blockdevice"
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -409,6 +412,7 @@ func TestPushDeviceResource(t *testing.T) {
 	fakeDr.ObjectMeta.Labels[KubernetesHostNameLabel] = fakeController.NodeAttributes[HostNameKey]
 	fakeDr.ObjectMeta.Labels[NDMDeviceTypeKey] = NDMDefaultDeviceType
 	fakeDr.ObjectMeta.Labels[NDMManagedKey] = TrueString
+	fakeDr.ObjectMeta.Labels[ManagedByLabel] = ManagedByValue
 
 	// Pass 1st argument as nil then it creates one disk resource
 	fakeController.PushBlockDeviceResource(nil, deviceDetails)
@@ -463,7 +467,7 @@ func TestDeactivateStaleDeviceResource(t *testing.T) {
 	// Add one resource's uuid so state of the other resource should be inactive.
 	deviceList := make([]string, 0)
 	deviceList = append(deviceList, newFakeDeviceUID)
-	fakeController.DeactivateStaleBlockDeviceResource(deviceList)
+	fakeController.DeactivateStaleBlockDeviceResource(deviceList, nil)
 	dr.Status.State = NDMInactive
 
 	// Retrieve blockdevice resource
@@ -501,6 +505,8 @@ func TestMarkDeviceStatusToUnknown(t *testing.T) {
 	dr := mockEmptyDeviceCr()
 	dr.ObjectMeta.Labels[KubernetesHostNameLabel] = fakeController.NodeAttributes[HostNameKey]
 	dr.ObjectMeta.Labels[NDMDeviceTypeKey] = NDMDefaultDeviceType
+	// the blockdevice was marked unknown by the operator on the expiry of the heartbeat
+	dr.ObjectMeta.Annotations = map[string]string{HeartbeatExpiredAnnotation: time.Now().String()}
 	fakeController.CreateBlockDevice(dr)
 
 	fakeController.MarkBlockDeviceStatusToUnknown()
@@ -508,6 +514,7 @@ func TestMarkDeviceStatusToUnknown(t *testing.T) {
 
 	// Retrieve blockdevice resource
 	cdr, err := fakeController.GetBlockDevice(fakeDeviceUID)
+	assert.NotContains(t, cdr.Annotations, HeartbeatExpiredAnnotation)
 
 	tests := map[string]struct {
 		actualDevice   apis.BlockDevice
@@ -525,6 +532,44 @@ func TestMarkDeviceStatusToUnknown(t *testing.T) {
 	}
 }
 
+func TestMergeBlockDeviceConditions(t *testing.T) {
+	cleanupCondition := apis.BlockDeviceCondition{
+		Type:   "CleanupInProgress",
+		Status: v1.ConditionTrue,
+	}
+	skippedCondition := apis.BlockDeviceCondition{
+		Type:    apis.BlockDeviceProbeSkipped,
+		Status:  v1.ConditionTrue,
+		Message: "probes skipped due to repeated failures: smart probe",
+	}
+
+	oldBD := mockEmptyDeviceCr()
+	oldBD.Status.Conditions = []apis.BlockDeviceCondition{cleanupCondition, skippedCondition}
+	newBD := mockEmptyDeviceCr()
+
+	// daemon owned conditions not present in the new BD are removed,
+	// other conditions are retained
+	merged := mergeBlockDeviceData(newBD, oldBD)
+	assert.Equal(t, []apis.BlockDeviceCondition{cleanupCondition}, merged.Status.Conditions)
+
+	newBD.Status.SetCondition(skippedCondition)
+	merged = mergeBlockDeviceData(newBD, *merged)
+	assert.Equal(t, 2, len(merged.Status.Conditions))
+	assert.NotNil(t, merged.Status.GetCondition(apis.BlockDeviceProbeSkipped))
+}
+
+func TestMergeBlockDeviceUnschedulable(t *testing.T) {
+	oldBD := mockEmptyDeviceCr()
+	oldBD.Spec.Unschedulable = true
+	newBD := mockEmptyDeviceCr()
+	newBD.Spec.Path = "/dev/sdz"
+
+	// the blockdevice stays cordoned when the daemon updates it
+	merged := mergeBlockDeviceData(newBD, oldBD)
+	assert.True(t, merged.Spec.Unschedulable)
+	assert.Equal(t, "/dev/sdz", merged.Spec.Path)
+}
+
 // compareBlockDevice is the custom blockdevice comparison function. Only those values that need to be checked
 // for equality will be checked here. Resource version field will not be checked as it
 // will be updated on every write. Refer https://github.com/kubernetes-sigs/controller-runtime/pull/620
@@ -542,3 +587,38 @@ func compareBlockDeviceList(t *testing.T, bdList1, bdList2 apis.BlockDeviceList)
 		compareBlockDevice(t, bdList1.Items[i], bdList2.Items[i])
 	}
 }
+
+func TestUpdateBlockDeviceFileSystem(t *testing.T) {
+	fakeNdmClient := CreateFakeClient(t)
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      fakeNdmClient,
+	}
+
+	devR := mockEmptyDeviceCr()
+	devR.Name = "blockdevice-fs"
+	devR.Spec.Path = "/dev/sdf"
+	devR.Spec.Details.Serial = "S1"
+	devR.Spec.FileSystem = apis.FileSystemInfo{Type: "ext4", Mountpoint: "/mnt/data"}
+	fakeController.CreateBlockDevice(devR)
+	existing, err := fakeController.GetBlockDevice(devR.Name)
+	assert.NoError(t, err)
+
+	// filesystem removed using wipefs
+	device := &bd.BlockDevice{}
+	device.DevPath = "/dev/sdf"
+	assert.NoError(t, fakeController.UpdateBlockDeviceFileSystem(existing, device))
+	updated, err := fakeController.GetBlockDevice(devR.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, apis.FileSystemInfo{}, updated.Spec.FileSystem)
+	// other fields are not changed
+	assert.Equal(t, "/dev/sdf", updated.Spec.Path)
+	assert.Equal(t, "S1", updated.Spec.Details.Serial)
+
+	// filesystem created using mkfs
+	device.FSInfo.FileSystem = "xfs"
+	assert.NoError(t, fakeController.UpdateBlockDeviceFileSystem(updated, device))
+	updated, err = fakeController.GetBlockDevice(devR.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, apis.FileSystemInfo{Type: "xfs"}, updated.Spec.FileSystem)
+}
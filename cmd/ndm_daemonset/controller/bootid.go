@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+)
+
+const (
+	// BootIDAnnotation is the boot ID of the node when the blockdevice was last updated
+	BootIDAnnotation = "ndm.io/boot-id"
+	// StatsEpochAnnotation is incremented every time the node on which the blockdevice
+	// is attached reboots. The cumulative statistics of the device, like the no. of bytes
+	// read and written, are reset on reboot. Consumers of the statistics can use the epoch
+	// to detect a reset of the counters.
+	StatsEpochAnnotation = "ndm.io/stats-epoch"
+)
+
+// bootIDPath is the path of the file having the boot ID, which changes on every boot
+var bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// getBootID gets the boot ID of the node
+func getBootID() (string, error) {
+	bootID, err := ioutil.ReadFile(bootIDPath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bootID)), nil
+}
+
+// setBootID reads the boot ID of the node. The stats epoch of the blockdevices
+// is not maintained if the boot ID cannot be read.
+func (c *Controller) setBootID() {
+	bootID, err := getBootID()
+	if err != nil {
+		logger.Warningf("unable to get boot id, stats epoch of blockdevices will not be updated: %v", err)
+		return
+	}
+	c.bootID = bootID
+}
+
+// updateStatsEpoch annotates the blockdevice with the boot ID of the node. The stats
+// epoch is incremented if the blockdevice was last updated during an earlier boot.
+func (c *Controller) updateStatsEpoch(blockDevice *apis.BlockDevice) {
+	if c.bootID == "" {
+		return
+	}
+	if blockDevice.Annotations == nil {
+		blockDevice.Annotations = make(map[string]string)
+	}
+	lastBootID, ok := blockDevice.Annotations[BootIDAnnotation]
+	if ok && lastBootID == c.bootID {
+		return
+	}
+
+	epoch := 0
+	if ok {
+		lastEpoch, err := strconv.Atoi(blockDevice.Annotations[StatsEpochAnnotation])
+		if err != nil {
+			logger.Warningf("invalid stats epoch %q of blockdevice %s",
+				blockDevice.Annotations[StatsEpochAnnotation], blockDevice.Name)
+		}
+		epoch = lastEpoch + 1
+		logger.Infof("node rebooted since blockdevice %s was last updated, stats epoch is %d",
+			blockDevice.Name, epoch)
+	}
+	blockDevice.Annotations[BootIDAnnotation] = c.bootID
+	blockDevice.Annotations[StatsEpochAnnotation] = strconv.Itoa(epoch)
+}
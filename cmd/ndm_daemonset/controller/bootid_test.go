@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateStatsEpoch(t *testing.T) {
+	tests := map[string]struct {
+		bootID      string
+		annotations map[string]string
+		want        map[string]string
+	}{
+		"boot id not available": {
+			bootID:      "",
+			annotations: nil,
+			want:        nil,
+		},
+		"new blockdevice": {
+			bootID:      "boot-1",
+			annotations: nil,
+			want: map[string]string{
+				BootIDAnnotation:     "boot-1",
+				StatsEpochAnnotation: "0",
+			},
+		},
+		"same boot": {
+			bootID: "boot-1",
+			annotations: map[string]string{
+				BootIDAnnotation:     "boot-1",
+				StatsEpochAnnotation: "3",
+			},
+			want: map[string]string{
+				BootIDAnnotation:     "boot-1",
+				StatsEpochAnnotation: "3",
+			},
+		},
+		"node rebooted": {
+			bootID: "boot-2",
+			annotations: map[string]string{
+				BootIDAnnotation:     "boot-1",
+				StatsEpochAnnotation: "3",
+			},
+			want: map[string]string{
+				BootIDAnnotation:     "boot-2",
+				StatsEpochAnnotation: "4",
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &Controller{bootID: test.bootID}
+			bd := &apis.BlockDevice{}
+			bd.Annotations = test.annotations
+			c.updateStatsEpoch(bd)
+			assert.Equal(t, test.want, bd.Annotations)
+		})
+	}
+}
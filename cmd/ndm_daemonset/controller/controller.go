@@ -26,9 +26,13 @@ import (
 
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/pkg/apis"
+	"github.com/openebs/node-disk-manager/pkg/features"
+	"github.com/openebs/node-disk-manager/pkg/logs"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
@@ -73,8 +77,19 @@ const (
 	NDMDeviceTypeKey = "ndm.io/blockdevice-type"
 	// NDMManagedKey specifies blockdevice cr should be managed by ndm or not.
 	NDMManagedKey = "ndm.io/managed"
+	// RBDPoolAnnotation is the pool of the ceph rbd image mapped to the blockdevice
+	RBDPoolAnnotation = "ndm.io/rbd-pool"
+	// RBDImageAnnotation is the ceph rbd image mapped to the blockdevice
+	RBDImageAnnotation = "ndm.io/rbd-image"
+	// RBDBlockDeviceTag is the block-device-tag of the blockdevices of ceph rbd images.
+	// Blockdevices having the tag are claimed only if the tag is given in the claim.
+	RBDBlockDeviceTag = "ceph-rbd"
 )
 
+// RBDClaimable makes the blockdevices of ceph rbd images claimable. By default they
+// are tagged with RBDBlockDeviceTag, so that mapped images are not claimed as local disks.
+var RBDClaimable = false
+
 const (
 	// NDMDefaultDiskType will be used to initialize the disk type.
 	NDMDefaultDiskType = "disk"
@@ -87,6 +102,9 @@ const (
 	CRDRetryInterval = 10 * time.Second
 )
 
+// logger is the structured logger of the controller
+var logger = logs.Module("controller")
+
 // ControllerBroadcastChannel is used to send a copy of controller object to each probe.
 // Each probe can get the copy of controller struct any time they need to read the channel.
 var ControllerBroadcastChannel = make(chan *Controller)
@@ -114,6 +132,57 @@ type Controller struct {
 	NodeAttributes map[string]string
 	// BDHierarchy stores the hierarchy of devices on this node
 	BDHierarchy blockdevice.Hierarchy
+	// Recorder is used to record events on the resources managed by NDM
+	Recorder record.EventRecorder
+	// probeBreaker keeps track of probe failures on each device
+	probeBreaker *probeCircuitBreaker
+	// configLock guards NDMConfig, which is replaced when the config is reloaded
+	configLock sync.RWMutex
+	// configFilePath is the path of the config file, used to reload the config
+	configFilePath string
+	// configData is the content of the config file that was last loaded
+	configData []byte
+	// configReloadHandlers are called when the config is reloaded
+	configReloadHandlers []ConfigReloadHandler
+	// metricsGatherer gathers the served metrics, filtered as per the config
+	metricsGatherer metricsGatherer
+	// nodeProbeStates are the probe states set using the node labels and
+	// annotations, which override the probe states in the config
+	nodeProbeStates map[string]string
+	// health holds the health checks of the daemon
+	health healthState
+	// journal keeps the last processed state of the blockdevices on the node
+	journal *deviceJournal
+	// drift tracks the blockdevices from the first scan after startup
+	drift startupDrift
+	// writeQueue holds the blockdevice writes that failed while the API
+	// server was unreachable
+	writeQueue writeQueue
+	// removals holds the blockdevices of the removed devices which are in
+	// the removal grace period
+	removals removalGrace
+	// selfHeal recreates the deleted blockdevices of the attached devices
+	selfHeal selfHeal
+	// bootID is the boot ID of the node, used to detect reboots of the node
+	bootID string
+	// nodeOwner is the node set as the owner of the blockdevices
+	nodeOwner nodeOwner
+	// uuidHostName is the identity of the node from the default source, used
+	// in the UUIDs generated for the node
+	uuidHostName string
+	// nodeIdentities are the identities of the node from all the sources, with
+	// which the blockdevices of the node may have been created
+	nodeIdentities []string
+	// dryRun is the client dropping the writes, if running in dry run mode
+	dryRun *dryRunClient
+	// devices are the devices processed by the daemon, served at DevicesPath
+	devices deviceInventory
+	// rescan triggers the scans of the devices on demand
+	rescan rescanState
+	// fakeInventory are the devices discovered in the fake probe mode
+	fakeInventory fakeInventory
+	// sparseFiles serializes the changes to the sparse files made using the api
+	sparseFiles sparseFiles
 }
 
 // NewController returns a controller pointer for any error case it will return nil
@@ -131,6 +200,9 @@ func NewController() (*Controller, error) {
 		return controller, err
 	}
 	controller.Namespace = ns
+	if BlockDeviceNamespace != "" {
+		controller.Namespace = BlockDeviceNamespace
+	}
 
 	mgr, err := manager.New(controller.config, manager.Options{Namespace: controller.Namespace, MetricsBindAddress: "0"})
 	if err != nil {
@@ -142,6 +214,12 @@ func NewController() (*Controller, error) {
 		return controller, err
 	}
 
+	controller.Recorder = mgr.GetEventRecorderFor("node-disk-manager")
+	if DryRun {
+		// events are not written to the API server in dry run mode
+		controller.Recorder = &record.FakeRecorder{}
+	}
+
 	_, err = controller.newClientSet()
 	if err != nil {
 		return controller, err
@@ -155,7 +233,9 @@ func NewController() (*Controller, error) {
 // on the controller
 func (c *Controller) SetControllerOptions(opts NDMOptions) error {
 	// set the config for running NDM daemon
-	c.SetNDMConfig(opts)
+	if err := c.SetNDMConfig(opts); err != nil {
+		return err
+	}
 
 	c.Filters = make([]*Filter, 0)
 	c.Probes = make([]*Probe, 0)
@@ -164,9 +244,46 @@ func (c *Controller) SetControllerOptions(opts NDMOptions) error {
 	if err := c.setNodeAttributes(); err != nil {
 		return err
 	}
+	// relabel the blockdevices created with a different node identity
+	if err := c.MigrateNodeIdentity(); err != nil {
+		logger.Error(err, "unable to migrate the node identity")
+	}
+	c.setNodeProbeStates()
+	c.setBootID()
+	if JournalPath != "" && !IsHostPathAllowed(JournalPath) {
+		logger.Warningf("journal %s is not in the allowed host paths, the journal is disabled", JournalPath)
+	} else if JournalPath != "" {
+		c.journal = openJournal(JournalPath)
+	}
+	if err := ApplyLogConfig(c); err != nil {
+		return err
+	}
+	if err := ApplyTracingConfig(c); err != nil {
+		return err
+	}
+	c.recordFeatureGates()
+	c.addDefaultHealthChecks()
 	return nil
 }
 
+// IsFeatureEnabled returns true if the feature is enabled in the feature gates
+// of the daemon
+func (c *Controller) IsFeatureEnabled(f features.Feature) bool {
+	return features.FeatureGates.IsEnabled(f)
+}
+
+// recordFeatureGates logs the state of the feature gates and exposes it as a metric
+func (c *Controller) recordFeatureGates() {
+	logger.Infof("feature gates: %s", features.FeatureGates)
+	for f, isEnabled := range features.FeatureGates {
+		value := 0.0
+		if isEnabled {
+			value = 1
+		}
+		FeatureEnabled.WithLabelValues(string(f)).Set(value)
+	}
+}
+
 // newClientSet set Clientset field in Controller struct
 // if it gets Client from config. It returns the generated
 // client, else it returns error
@@ -175,6 +292,11 @@ func (c *Controller) newClientSet() (client.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	clientSet = newInstrumentedClient(clientSet)
+	if DryRun {
+		c.dryRun = newDryRunClient(clientSet)
+		clientSet = c.dryRun
+	}
 	c.Clientset = clientSet
 	return clientSet, nil
 }
@@ -195,7 +317,7 @@ func (c *Controller) setNodeAttributes() error {
 }
 
 // setHostName set NodeAttribute field in Controller struct
-// from the labels in node object
+// from the node object, using the node identity in the config
 func (c *Controller) setHostName() error {
 	nodeName := c.NodeAttributes[NodeNameKey]
 	// get the node object and fetch the hostname label from the
@@ -205,14 +327,20 @@ func (c *Controller) setHostName() error {
 	if err != nil {
 		return err
 	}
+	c.nodeOwner = nodeOwner{name: node.Name, uid: node.UID}
 
-	// if the label is not present, or hostname is an empty string,
-	// use nodename as hostname
-	if hostName, ok := node.Labels[KubernetesHostNameLabel]; !ok || hostName == "" {
-		c.NodeAttributes[HostNameKey] = nodeName
-	} else {
-		c.NodeAttributes[HostNameKey] = hostName
+	var identity *NodeIdentityConfig
+	if ndmConfig := c.GetNDMConfig(); ndmConfig != nil {
+		identity = ndmConfig.NodeIdentity
 	}
+	hostName, err := getNodeIdentity(node, identity)
+	if err != nil {
+		return err
+	}
+	c.NodeAttributes[HostNameKey] = hostName
+	// the default source does not return an error
+	c.uuidHostName, _ = getNodeIdentity(node, nil)
+	c.nodeIdentities = getNodeIdentities(node, identity)
 	return nil
 }
 
@@ -241,12 +369,12 @@ func (c *Controller) WaitForBlockDeviceCRD() {
 	for {
 		_, err := c.ListBlockDeviceResource(false)
 		if err != nil {
-			klog.Errorf("BlockDevice CRD is not available yet. Retrying after %v, error: %v", CRDRetryInterval, err)
+			logger.Errorf("BlockDevice CRD is not available yet. Retrying after %v, error: %v", CRDRetryInterval, err)
 			time.Sleep(CRDRetryInterval)
 			c.newClientSet()
 			continue
 		}
-		klog.Info("BlockDevice CRD is available")
+		logger.Infof("BlockDevice CRD is available")
 		break
 	}
 }
@@ -256,6 +384,20 @@ func (c *Controller) Start() {
 	c.InitializeSparseFiles()
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
+	// apply the changes of the sparse files of the node
+	go c.WatchSparseFiles(stopCh)
+	// renew the heartbeat lease, so that the operator can detect when
+	// this daemon stops reporting
+	go c.StartHeartbeat(stopCh)
+	// reload the config when the configmap is updated
+	go c.WatchNDMConfig(stopCh)
+	// recreate the blockdevices of attached devices, if they are deleted
+	go c.WatchBlockDeviceDeletion(stopCh)
+	// rescan the devices when requested on the node
+	go c.WatchRescanRequests(stopCh)
+	go c.serveMetrics(stopCh)
+	go c.serveHealth(stopCh)
+	go c.serveAPI(stopCh)
 	if err := c.run(2, stopCh); err != nil {
 		klog.Fatalf("error running controller: %s", err.Error())
 	}
@@ -276,16 +418,42 @@ func (c *Controller) Broadcast() {
 
 // run waits until it gets any interrupt signals
 func (c *Controller) run(threadiness int, stopCh <-chan struct{}) error {
-	klog.Info("started the controller")
+	logger.Infof("started the controller")
 	<-stopCh
-	klog.Info("changing the state to unknown before shutting down.")
+	logger.Infof("changing the state to unknown before shutting down.")
 	// Changing the state to unknown before shutting down. Similar as when one pod is
 	// running and you stopped kubelet it will make pod status unknown.
 	c.MarkBlockDeviceStatusToUnknown()
-	klog.Info("shutting down the controller")
+	logger.Infof("shutting down the controller")
 	return nil
 }
 
+// Eventf records an event on the given object, if an event recorder
+// is configured
+func (c *Controller) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if c.Recorder == nil {
+		return
+	}
+	c.Recorder.Eventf(object, eventType, reason, messageFmt, args...)
+}
+
+// NodeEventf records an event on the node on which the daemon is running
+func (c *Controller) NodeEventf(eventType, reason, messageFmt string, args ...interface{}) {
+	if c.Recorder == nil || c.Clientset == nil {
+		return
+	}
+	// the event is recorded on the node object fetched from the API server,
+	// so that it refers to the actual UID of the node
+	nodeName := c.NodeAttributes[NodeNameKey]
+	node := &v1.Node{}
+	err := c.Clientset.Get(context.TODO(), client.ObjectKey{Namespace: "", Name: nodeName}, node)
+	if err != nil {
+		logger.Errorf("unable to record %s event on node %s: %v", reason, nodeName, err)
+		return
+	}
+	c.Eventf(node, eventType, reason, messageFmt, args...)
+}
+
 // Lock takes a lock on Controller struct
 func (c *Controller) Lock() {
 	c.Mutex.Lock()
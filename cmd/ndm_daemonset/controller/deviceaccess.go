@@ -0,0 +1,221 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DisableSGIO disables the probes which send SCSI commands to the devices
+// using the SG_IO ioctl, like the smart and seachest probes
+var DisableSGIO = false
+
+// ReadOnlyDeviceAccess makes NDM open the device nodes only for reading. The
+// probes using SG_IO are disabled as they open the devices for writing, and
+// GPT partitions are not created on the devices which cannot be identified.
+var ReadOnlyDeviceAccess = false
+
+// AllowedDevicePaths are the glob patterns of the device nodes NDM may open, eg:
+// /dev/sd*. The devices not allowed are discovered using the udev database,
+// but are not opened by the probes nor partitioned. All devices are allowed if
+// empty.
+var AllowedDevicePaths []string
+
+// AllowedHostPaths are the glob patterns of the host paths, mounted in the pod,
+// which NDM may read or write, like the mounts of the host, the journal and the
+// sparse file directories. A path is allowed if it or one of its parent
+// directories matches a pattern. All paths are allowed if empty.
+var AllowedHostPaths []string
+
+// capabilities needed for accessing the devices
+const (
+	capSysRawIO = 17
+	capSysAdmin = 21
+)
+
+// capabilityNames are the names of the capabilities needed for accessing the devices
+var capabilityNames = map[uint]string{
+	capSysRawIO: "CAP_SYS_RAWIO",
+	capSysAdmin: "CAP_SYS_ADMIN",
+}
+
+// procStatusPath is the path of the status of the process, having the
+// effective capabilities of the process
+var procStatusPath = "/proc/self/status"
+
+// DeviceAccess is the access of NDM to the devices on the node, set using the
+// flags and reduced by the capabilities missing in the process
+type DeviceAccess struct {
+	// SGIO is true if SCSI commands can be sent to the devices using SG_IO
+	SGIO bool
+	// Writes is true if the devices can be written, to create GPT partitions
+	Writes bool
+	// MissingCapabilities are the capabilities needed for full access that
+	// are not in the effective set of the process
+	MissingCapabilities []string
+	// DevicePaths are the patterns of the device nodes which may be opened,
+	// all if empty
+	DevicePaths []string
+	// HostPaths are the patterns of the host paths which may be accessed,
+	// all if empty
+	HostPaths []string
+}
+
+var (
+	deviceAccess     DeviceAccess
+	deviceAccessOnce sync.Once
+)
+
+// GetDeviceAccess returns the access of NDM to the devices. It is computed
+// once, when first called.
+func GetDeviceAccess() DeviceAccess {
+	deviceAccessOnce.Do(func() {
+		caps, err := getEffectiveCapabilities()
+		if err != nil {
+			// the capabilities are not known, let the device access fail if not allowed
+			logger.Warningf("unable to get capabilities of the process: %v", err)
+			caps = ^uint64(0)
+		}
+		deviceAccess = newDeviceAccess(caps)
+		if !deviceAccess.SGIO || !deviceAccess.Writes ||
+			len(deviceAccess.DevicePaths) != 0 || len(deviceAccess.HostPaths) != 0 {
+			logger.Warningf("device access is reduced: %s", deviceAccess)
+		}
+	})
+	return deviceAccess
+}
+
+// newDeviceAccess returns the access to the devices allowed by the flags and
+// the effective capabilities
+func newDeviceAccess(caps uint64) DeviceAccess {
+	access := DeviceAccess{
+		SGIO:        !DisableSGIO && !ReadOnlyDeviceAccess,
+		Writes:      !ReadOnlyDeviceAccess,
+		DevicePaths: AllowedDevicePaths,
+		HostPaths:   AllowedHostPaths,
+	}
+	hasCap := func(c uint) bool {
+		if caps&(1<<c) != 0 {
+			return true
+		}
+		access.MissingCapabilities = append(access.MissingCapabilities, capabilityNames[c])
+		return false
+	}
+	// SG_IO needs CAP_SYS_RAWIO for the commands not allowed for unprivileged users
+	if !hasCap(capSysRawIO) {
+		access.SGIO = false
+	}
+	// the partition table can be reread only with CAP_SYS_ADMIN
+	if !hasCap(capSysAdmin) {
+		access.Writes = false
+	}
+	return access
+}
+
+// String describes the access to the devices
+func (da DeviceAccess) String() string {
+	state := func(allowed bool) string {
+		if allowed {
+			return "enabled"
+		}
+		return "disabled"
+	}
+	s := fmt.Sprintf("sg_io %s, device writes %s", state(da.SGIO), state(da.Writes))
+	if len(da.MissingCapabilities) != 0 {
+		s += ", missing capabilities: " + strings.Join(da.MissingCapabilities, ",")
+	}
+	if len(da.DevicePaths) != 0 {
+		s += ", allowed device paths: " + strings.Join(da.DevicePaths, ",")
+	}
+	if len(da.HostPaths) != 0 {
+		s += ", allowed host paths: " + strings.Join(da.HostPaths, ",")
+	}
+	return s
+}
+
+// IsDevicePathAllowed checks if the device node may be opened. The target of a
+// symlink, like /dev/disk/by-id/..., is also matched.
+func IsDevicePathAllowed(devPath string) bool {
+	if len(AllowedDevicePaths) == 0 {
+		return true
+	}
+	if matchPath(AllowedDevicePaths, devPath) {
+		return true
+	}
+	target, err := filepath.EvalSymlinks(devPath)
+	return err == nil && matchPath(AllowedDevicePaths, target)
+}
+
+// IsHostPathAllowed checks if the host path may be accessed
+func IsHostPathAllowed(path string) bool {
+	if len(AllowedHostPaths) == 0 {
+		return true
+	}
+	return matchPath(AllowedHostPaths, path)
+}
+
+// matchPath checks if the path or one of its parent directories matches
+// one of the glob patterns
+func matchPath(patterns []string, path string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(filepath.Clean(pattern), p); ok {
+				return true
+			}
+		}
+		if p == "/" {
+			return false
+		}
+	}
+}
+
+// getEffectiveCapabilities gets the effective capability set of the process
+func getEffectiveCapabilities() (uint64, error) {
+	f, err := os.Open(procStatusPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		return strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("effective capabilities not found in %s", procStatusPath)
+}
+
+// checkDeviceAccess reports the access to the devices. A reduced access is not
+// a failure, the probes needing the missing access are skipped.
+func (c *Controller) checkDeviceAccess() (string, error) {
+	return GetDeviceAccess().String(), nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeviceAccess(t *testing.T) {
+	allCaps := ^uint64(0)
+	tests := map[string]struct {
+		disableSGIO bool
+		readOnly    bool
+		caps        uint64
+		want        DeviceAccess
+	}{
+		"full access": {
+			caps: allCaps,
+			want: DeviceAccess{SGIO: true, Writes: true},
+		},
+		"sg_io disabled": {
+			disableSGIO: true,
+			caps:        allCaps,
+			want:        DeviceAccess{SGIO: false, Writes: true},
+		},
+		"read only access": {
+			readOnly: true,
+			caps:     allCaps,
+			want:     DeviceAccess{SGIO: false, Writes: false},
+		},
+		"missing CAP_SYS_RAWIO": {
+			caps: 1 << capSysAdmin,
+			want: DeviceAccess{SGIO: false, Writes: true, MissingCapabilities: []string{"CAP_SYS_RAWIO"}},
+		},
+		"no capabilities": {
+			caps: 0,
+			want: DeviceAccess{SGIO: false, Writes: false, MissingCapabilities: []string{"CAP_SYS_RAWIO", "CAP_SYS_ADMIN"}},
+		},
+	}
+	defer func() {
+		DisableSGIO = false
+		ReadOnlyDeviceAccess = false
+	}()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			DisableSGIO = test.disableSGIO
+			ReadOnlyDeviceAccess = test.readOnly
+			assert.Equal(t, test.want, newDeviceAccess(test.caps))
+		})
+	}
+}
+
+func TestGetEffectiveCapabilities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-caps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { procStatusPath = path }(procStatusPath)
+	procStatusPath = filepath.Join(dir, "status")
+
+	status := "Name:\tndm\nCapInh:\t0000000000000000\nCapPrm:\t00000000a80425fb\nCapEff:\t00000000a80425fb\n"
+	if err := ioutil.WriteFile(procStatusPath, []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+	caps, err := getEffectiveCapabilities()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xa80425fb), caps)
+	// the default capabilities of a container do not have CAP_SYS_RAWIO and CAP_SYS_ADMIN
+	assert.Equal(t, []string{"CAP_SYS_RAWIO", "CAP_SYS_ADMIN"}, newDeviceAccess(caps).MissingCapabilities)
+
+	if err := ioutil.WriteFile(procStatusPath, []byte("Name:\tndm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = getEffectiveCapabilities()
+	assert.Error(t, err)
+}
+
+func TestIsDevicePathAllowed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-devices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a symlink to an allowed device, like /dev/disk/by-id/...
+	link := filepath.Join(dir, "by-id")
+	if err := os.Symlink("/dev/null", link); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { AllowedDevicePaths = nil }()
+	tests := map[string]struct {
+		allowed []string
+		devPath string
+		want    bool
+	}{
+		"all devices allowed":    {nil, "/dev/sda", true},
+		"matching pattern":       {[]string{"/dev/sd*", "/dev/nvme*"}, "/dev/nvme0n1", true},
+		"not matching pattern":   {[]string{"/dev/sd*"}, "/dev/nvme0n1", false},
+		"device in allowed dir":  {[]string{"/dev/mapper"}, "/dev/mapper/vg-lv", true},
+		"path escaping allowed":  {[]string{"/dev/sd*"}, "/dev/sda/../../etc/passwd", false},
+		"symlink to allowed":     {[]string{"/dev/null"}, link, true},
+		"symlink to not allowed": {[]string{"/dev/sd*"}, link, false},
+		"relative path":          {[]string{"/dev/sd*"}, "sda", false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			AllowedDevicePaths = test.allowed
+			assert.Equal(t, test.want, IsDevicePathAllowed(test.devPath))
+		})
+	}
+}
+
+func TestIsHostPathAllowed(t *testing.T) {
+	defer func() { AllowedHostPaths = nil }()
+	AllowedHostPaths = []string{"/host/proc/1/mounts", "/var/openebs/*"}
+	assert.True(t, IsHostPathAllowed("/host/proc/1/mounts"))
+	assert.True(t, IsHostPathAllowed("/var/openebs/ndm/journal.json"))
+	assert.False(t, IsHostPathAllowed("/host/proc/1/status"))
+	assert.False(t, IsHostPathAllowed("/var/lib/kubelet"))
+}
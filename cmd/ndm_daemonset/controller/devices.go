@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+)
+
+// DevicesPath is the path at which the devices on the node are served
+const DevicesPath = "/v1/devices"
+
+// DeviceStatus is a device on the node, as last processed by the daemon. The
+// device has all the details filled by the probes, including those that are not
+// set on the blockdevice resource.
+type DeviceStatus struct {
+	// Device has the details of the device filled by the probes
+	Device blockdevice.BlockDevice `json:"device"`
+	// Filtered is true if the device was excluded by a filter, in which case
+	// there is no blockdevice resource for it
+	Filtered bool `json:"filtered"`
+	// ProcessedAt is the time at which the device was last processed
+	ProcessedAt time.Time `json:"processedAt"`
+}
+
+// DeviceList is the list of the devices on the node served at DevicesPath
+type DeviceList struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+	// Devices are sorted by the device path
+	Devices []DeviceStatus `json:"devices"`
+}
+
+// deviceInventory keeps the devices processed by the daemon, keyed by the device path
+type deviceInventory struct {
+	sync.Mutex
+	devices map[string]DeviceStatus
+}
+
+// RecordDevice keeps the details of the device processed by the daemon, to be
+// served at DevicesPath
+func (c *Controller) RecordDevice(device *blockdevice.BlockDevice, filtered bool) {
+	c.devices.Lock()
+	defer c.devices.Unlock()
+	if c.devices.devices == nil {
+		c.devices.devices = make(map[string]DeviceStatus)
+	}
+	c.devices.devices[device.DevPath] = DeviceStatus{
+		Device:      *device,
+		Filtered:    filtered,
+		ProcessedAt: time.Now(),
+	}
+}
+
+// UpdateDeviceFileSystem sets the filesystem details of the device refreshed on
+// a change event. Only the filesystem probes are run on a change event, so the
+// other details of the device are kept as is.
+func (c *Controller) UpdateDeviceFileSystem(device *blockdevice.BlockDevice) {
+	c.devices.Lock()
+	defer c.devices.Unlock()
+	status, ok := c.devices.devices[device.DevPath]
+	if !ok {
+		return
+	}
+	status.Device.FSInfo = device.FSInfo
+	status.ProcessedAt = time.Now()
+	c.devices.devices[device.DevPath] = status
+}
+
+// ForgetDevice removes the device which is no longer attached to the node
+func (c *Controller) ForgetDevice(devPath string) {
+	c.devices.Lock()
+	defer c.devices.Unlock()
+	delete(c.devices.devices, devPath)
+}
+
+// RetainDevices removes the devices other than the given device paths, after
+// a scan of all the devices on the node
+func (c *Controller) RetainDevices(devPaths map[string]bool) {
+	c.devices.Lock()
+	defer c.devices.Unlock()
+	for devPath := range c.devices.devices {
+		if !devPaths[devPath] {
+			delete(c.devices.devices, devPath)
+		}
+	}
+}
+
+// ListDevices returns the devices on the node, sorted by the device path
+func (c *Controller) ListDevices() []DeviceStatus {
+	c.devices.Lock()
+	defer c.devices.Unlock()
+	devices := make([]DeviceStatus, 0, len(c.devices.devices))
+	for _, device := range c.devices.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Device.DevPath < devices[j].Device.DevPath
+	})
+	return devices
+}
+
+// devicesHandler serves the devices on the node as json
+func (c *Controller) devicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	deviceList := DeviceList{
+		Node:    c.NodeAttributes[NodeNameKey],
+		Devices: c.ListDevices(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deviceList); err != nil {
+		logger.Errorf("unable to write devices: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevicesHandler(t *testing.T) {
+	c := &Controller{NodeAttributes: map[string]string{NodeNameKey: "node1"}}
+
+	sdb := &blockdevice.BlockDevice{}
+	sdb.DevPath = "/dev/sdb"
+	sdb.UUID = "blockdevice-1"
+	sdb.SMARTInfo.TemperatureInfo.CurrentTemperature = 40
+	sda := &blockdevice.BlockDevice{}
+	sda.DevPath = "/dev/sda"
+	sdc := &blockdevice.BlockDevice{}
+	sdc.DevPath = "/dev/sdc"
+
+	c.RecordDevice(sdb, false)
+	c.RecordDevice(sda, true)
+	c.RecordDevice(sdc, false)
+
+	// the filesystem is refreshed on a change event
+	changed := &blockdevice.BlockDevice{}
+	changed.DevPath = "/dev/sdb"
+	changed.FSInfo.FileSystem = "ext4"
+	c.UpdateDeviceFileSystem(changed)
+
+	// sdc is removed from the node
+	c.ForgetDevice("/dev/sdc")
+
+	rec := httptest.NewRecorder()
+	c.devicesHandler(rec, httptest.NewRequest(http.MethodGet, DevicesPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	deviceList := DeviceList{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &deviceList))
+	assert.Equal(t, "node1", deviceList.Node)
+	assert.Equal(t, 2, len(deviceList.Devices))
+	assert.Equal(t, "/dev/sda", deviceList.Devices[0].Device.DevPath)
+	assert.True(t, deviceList.Devices[0].Filtered)
+	assert.Equal(t, "/dev/sdb", deviceList.Devices[1].Device.DevPath)
+	assert.False(t, deviceList.Devices[1].Filtered)
+	assert.Equal(t, "blockdevice-1", deviceList.Devices[1].Device.UUID)
+	assert.Equal(t, "ext4", deviceList.Devices[1].Device.FSInfo.FileSystem)
+	assert.Equal(t, int16(40), deviceList.Devices[1].Device.SMARTInfo.TemperatureInfo.CurrentTemperature)
+
+	// only the devices found in a scan of all the devices are kept
+	c.RetainDevices(map[string]bool{"/dev/sdb": true})
+	assert.Equal(t, 1, len(c.ListDevices()))
+
+	rec = httptest.NewRecorder()
+	c.devicesHandler(rec, httptest.NewRequest(http.MethodPost, DevicesPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestServeAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-api")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "run", "ndm.sock")
+	// a stale socket left by an earlier run is replaced
+	assert.NoError(t, os.MkdirAll(filepath.Dir(socket), 0755))
+	assert.NoError(t, ioutil.WriteFile(socket, nil, 0600))
+
+	oldSocket := APISocket
+	APISocket = socket
+	defer func() { APISocket = oldSocket }()
+
+	c := &Controller{NodeAttributes: map[string]string{NodeNameKey: "node1"}}
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.serveAPI(stopCh)
+		close(done)
+	}()
+	defer func() {
+		close(stopCh)
+		<-done
+	}()
+
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	assert.Eventually(t, func() bool {
+		resp, err := httpClient.Get("http://ndm" + DevicesPath)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		deviceList := DeviceList{}
+		return resp.StatusCode == http.StatusOK &&
+			json.NewDecoder(resp.Body).Decode(&deviceList) == nil && deviceList.Node == "node1"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	info, err := os.Stat(socket)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+}
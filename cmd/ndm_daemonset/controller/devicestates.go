@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// blockDeviceStates are the states of the blockdevices as last written by the
+// daemon, used to export the no. of blockdevices in each state. Since all the
+// blockdevices of the node are written on startup, listing them from the API
+// server on each scrape is not required.
+type blockDeviceStates struct {
+	sync.Mutex
+	states map[string]string
+}
+
+func newBlockDeviceStates() *blockDeviceStates {
+	return &blockDeviceStates{states: make(map[string]string)}
+}
+
+// record records the state of the blockdevice. Objects other than
+// blockdevices are ignored.
+func (s *blockDeviceStates) record(obj runtime.Object) {
+	bd, ok := obj.(*apis.BlockDevice)
+	if !ok {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.states[bd.Name] = string(bd.Status.State)
+	s.setMetrics()
+}
+
+// remove removes the state of the deleted blockdevice
+func (s *blockDeviceStates) remove(obj runtime.Object) {
+	bd, ok := obj.(*apis.BlockDevice)
+	if !ok {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	delete(s.states, bd.Name)
+	s.setMetrics()
+}
+
+// setMetrics sets the no. of blockdevices in each state. The known states are
+// always set, so that alerts on the Unknown blockdevices have a value to compare.
+func (s *blockDeviceStates) setMetrics() {
+	counts := map[string]float64{NDMActive: 0, NDMInactive: 0, NDMUnknown: 0}
+	for _, state := range s.states {
+		counts[state]++
+	}
+	BlockDevicesByState.Reset()
+	for state, count := range counts {
+		BlockDevicesByState.WithLabelValues(state).Set(count)
+	}
+}
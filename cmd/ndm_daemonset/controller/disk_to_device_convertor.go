@@ -36,6 +36,7 @@ func (c *Controller) NewDeviceInfoFromBlockDevice(blockDevice *bd.BlockDevice) *
 
 	deviceDetails.UUID = blockDevice.UUID
 	deviceDetails.Labels = blockDevice.Labels
+	deviceDetails.Annotations = blockDevice.Annotations
 	deviceDetails.Capacity = blockDevice.Capacity.Storage
 	deviceDetails.Model = blockDevice.DeviceAttributes.Model
 	deviceDetails.Serial = blockDevice.DeviceAttributes.Serial
@@ -57,10 +58,17 @@ func (c *Controller) NewDeviceInfoFromBlockDevice(blockDevice *bd.BlockDevice) *
 	deviceDetails.DeviceType = blockDevice.DeviceAttributes.DeviceType
 
 	deviceDetails.Compliance = blockDevice.DeviceAttributes.Compliance
+	deviceDetails.SED = blockDevice.DeviceAttributes.SED
 	deviceDetails.FileSystemInfo.FileSystem = blockDevice.FSInfo.FileSystem
 	// currently only the first mount point will be taken.
 	if len(blockDevice.FSInfo.MountPoint) != 0 {
 		deviceDetails.FileSystemInfo.MountPoint = blockDevice.FSInfo.MountPoint[0]
 	}
+	deviceDetails.SkippedProbes = blockDevice.Status.SkippedProbes
+	deviceDetails.Flapping = blockDevice.Status.Flapping
+	deviceDetails.UUIDCollision = blockDevice.Status.UUIDCollision
+	deviceDetails.OriginalUUID = blockDevice.Status.OriginalUUID
+	deviceDetails.Partitions = blockDevice.DependentDevices.Partitions
+	deviceDetails.HealthAlerts = c.CheckHealthThresholds(blockDevice)
 	return deviceDetails
 }
@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sort"
+	"sync"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DriftReactivated is used when an inactive blockdevice was reactivated at startup
+	DriftReactivated = "reactivated"
+	// DriftDeactivated is used when the device of a blockdevice is missing at startup
+	DriftDeactivated = "deactivated"
+	// DriftPathRepaired is used when the path of a blockdevice changed at startup
+	DriftPathRepaired = "path_repaired"
+	// DriftCapacityRepaired is used when the capacity of a blockdevice changed at startup
+	DriftCapacityRepaired = "capacity_repaired"
+	// DriftAdded is used when a blockdevice was created for a new device at startup
+	DriftAdded = "added"
+)
+
+// blockDeviceSnapshot is the state of a blockdevice resource before the startup scan
+type blockDeviceSnapshot struct {
+	state    apis.BlockDeviceState
+	path     string
+	capacity uint64
+}
+
+// startupDrift tracks the blockdevices of the node from the first scan after startup
+// till the devices detected by the scan are processed, to find the drift between
+// the devices on the node and the blockdevice resources.
+type startupDrift struct {
+	mutex sync.Mutex
+	// snapshot holds the blockdevices of the node before the first scan
+	snapshot map[string]blockDeviceSnapshot
+	// written holds the blockdevices written while processing the scan
+	written map[string]*apis.BlockDevice
+	// done is set once the drift is reconciled
+	done bool
+}
+
+// DriftReport is the drift between the devices on the node and the blockdevice
+// resources, found on startup. It holds the names of the blockdevices for each
+// type of drift.
+type DriftReport map[string][]string
+
+// startDrift takes a snapshot of the given blockdevices of the node. It is called
+// with the blockdevices listed before the first scan of the devices is processed,
+// later calls are ignored.
+func (c *Controller) startDrift(blockDevices []apis.BlockDevice) {
+	c.drift.mutex.Lock()
+	defer c.drift.mutex.Unlock()
+	if c.drift.done || c.drift.snapshot != nil {
+		return
+	}
+	c.drift.snapshot = make(map[string]blockDeviceSnapshot)
+	c.drift.written = make(map[string]*apis.BlockDevice)
+	for _, item := range blockDevices {
+		if item.Spec.Details.DeviceType == bd.SparseBlockDeviceType {
+			continue
+		}
+		c.drift.snapshot[item.Name] = blockDeviceSnapshot{
+			state:    item.Status.State,
+			path:     item.Spec.Path,
+			capacity: item.Spec.Capacity.Storage,
+		}
+	}
+}
+
+// recordDrift keeps the last written state of the blockdevice while the
+// first scan is processed
+func (c *Controller) recordDrift(blockDevice *apis.BlockDevice) {
+	c.drift.mutex.Lock()
+	defer c.drift.mutex.Unlock()
+	if c.drift.done || c.drift.written == nil {
+		return
+	}
+	c.drift.written[blockDevice.Name] = blockDevice.DeepCopy()
+}
+
+// ReconcileStartupDrift is called after the devices detected by the first scan are
+// processed without errors. The blockdevices whose device is missing were already
+// deactivated along with the snapshot, the blockdevices of the node that were not
+// written while processing the devices are deactivated, since their device is
+// excluded. The blockdevices that were deactivated, reactivated, or whose path or
+// capacity were repaired, are reported. The drift is reconciled only once.
+func (c *Controller) ReconcileStartupDrift() DriftReport {
+	c.drift.mutex.Lock()
+	if c.drift.done || c.drift.snapshot == nil {
+		c.drift.mutex.Unlock()
+		return nil
+	}
+	c.drift.done = true
+	snapshot, written := c.drift.snapshot, c.drift.written
+	c.drift.snapshot, c.drift.written = nil, nil
+	c.drift.mutex.Unlock()
+
+	report := make(DriftReport)
+	for name, blockDevice := range written {
+		old, ok := snapshot[name]
+		if !ok {
+			if blockDevice.Status.State == NDMActive {
+				report[DriftAdded] = append(report[DriftAdded], name)
+			}
+			continue
+		}
+		if blockDevice.Status.State != NDMActive {
+			if old.state != NDMInactive {
+				report[DriftDeactivated] = append(report[DriftDeactivated], name)
+			}
+			continue
+		}
+		// blockdevices in unknown state are activated after every restart
+		if old.state == NDMInactive {
+			report[DriftReactivated] = append(report[DriftReactivated], name)
+		}
+		if old.path != blockDevice.Spec.Path {
+			report[DriftPathRepaired] = append(report[DriftPathRepaired], name)
+		}
+		if old.capacity != blockDevice.Spec.Capacity.Storage {
+			report[DriftCapacityRepaired] = append(report[DriftCapacityRepaired], name)
+		}
+	}
+
+	for name, old := range snapshot {
+		if _, ok := written[name]; ok || old.state == NDMInactive {
+			continue
+		}
+		blockDevice, err := c.GetBlockDevice(name)
+		if err != nil || blockDevice.Status.State == NDMInactive {
+			continue
+		}
+		c.DeactivateBlockDevice(*blockDevice)
+		report[DriftDeactivated] = append(report[DriftDeactivated], name)
+	}
+
+	c.reportDrift(report)
+	return report
+}
+
+// reportDrift logs the drift, records it as an event on the node and in the metrics
+func (c *Controller) reportDrift(report DriftReport) {
+	if len(report) == 0 {
+		logger.Infof("no drift between the devices and the blockdevices on startup")
+		return
+	}
+	kinds := make([]string, 0, len(report))
+	for kind, names := range report {
+		sort.Strings(names)
+		kinds = append(kinds, kind)
+		StartupDriftTotal.WithLabelValues(kind).Add(float64(len(names)))
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		logger.Infof("startup drift %s: %v", kind, report[kind])
+	}
+	c.NodeEventf(v1.EventTypeNormal, "StartupDriftReconciled",
+		"Reconciled blockdevices on startup: %d added, %d reactivated, %d deactivated, %d path repaired, %d capacity repaired",
+		len(report[DriftAdded]), len(report[DriftReactivated]), len(report[DriftDeactivated]),
+		len(report[DriftPathRepaired]), len(report[DriftCapacityRepaired]))
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newDriftBlockDevice(name, path string, capacity uint64, state string) apis.BlockDevice {
+	return apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{KubernetesHostNameLabel: fakeHostName},
+		},
+		Spec: apis.DeviceSpec{
+			Path:     path,
+			Capacity: apis.DeviceCapacity{Storage: capacity},
+		},
+		Status: apis.DeviceStatus{State: apis.BlockDeviceState(state)},
+	}
+}
+
+func TestReconcileStartupDrift(t *testing.T) {
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      CreateFakeClient(t),
+	}
+	for _, blockDevice := range []apis.BlockDevice{
+		newDriftBlockDevice("blockdevice-unchanged", "/dev/sda", 1024, NDMUnknown),
+		newDriftBlockDevice("blockdevice-inactive", "/dev/sdb", 1024, NDMInactive),
+		newDriftBlockDevice("blockdevice-renamed", "/dev/sdc", 1024, NDMActive),
+		newDriftBlockDevice("blockdevice-resized", "/dev/sdd", 1024, NDMActive),
+		newDriftBlockDevice("blockdevice-missing", "/dev/sde", 1024, NDMActive),
+		newDriftBlockDevice("blockdevice-excluded", "/dev/sdh", 1024, NDMActive),
+	} {
+		assert.NoError(t, fakeController.Clientset.Create(context.TODO(), blockDevice.DeepCopy()))
+	}
+
+	// nothing is reconciled before the snapshot is taken
+	assert.Nil(t, fakeController.ReconcileStartupDrift())
+
+	// blockdevice-excluded is detected by the scan, but not written
+	fakeController.DeactivateStaleBlockDeviceResource([]string{"blockdevice-excluded"}, nil)
+	// the devices detected by the scan are written
+	for _, blockDevice := range []apis.BlockDevice{
+		newDriftBlockDevice("blockdevice-unchanged", "/dev/sda", 1024, NDMActive),
+		newDriftBlockDevice("blockdevice-inactive", "/dev/sdb", 1024, NDMActive),
+		newDriftBlockDevice("blockdevice-renamed", "/dev/sdf", 1024, NDMActive),
+		newDriftBlockDevice("blockdevice-resized", "/dev/sdd", 2048, NDMActive),
+		newDriftBlockDevice("blockdevice-new", "/dev/sdg", 1024, NDMActive),
+	} {
+		assert.NoError(t, fakeController.CreateBlockDevice(blockDevice))
+	}
+
+	report := fakeController.ReconcileStartupDrift()
+	assert.Equal(t, DriftReport{
+		DriftAdded:            {"blockdevice-new"},
+		DriftReactivated:      {"blockdevice-inactive"},
+		DriftPathRepaired:     {"blockdevice-renamed"},
+		DriftCapacityRepaired: {"blockdevice-resized"},
+		DriftDeactivated:      {"blockdevice-excluded", "blockdevice-missing"},
+	}, report)
+
+	for _, name := range []string{"blockdevice-missing", "blockdevice-excluded"} {
+		deactivated, err := fakeController.GetBlockDevice(name)
+		assert.NoError(t, err)
+		assert.Equal(t, apis.BlockDeviceState(NDMInactive), deactivated.Status.State)
+	}
+
+	// the drift is reconciled only once
+	fakeController.DeactivateStaleBlockDeviceResource(nil, nil)
+	assert.Nil(t, fakeController.ReconcileStartupDrift())
+}
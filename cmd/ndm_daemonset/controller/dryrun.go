@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DryRun runs the discovery and the probes without writing anything to the
+// API server, the devices or the host. The blockdevices that would have been
+// written are logged, and served at dryRunPath on MetricsAddress.
+var DryRun = false
+
+// errDryRun is returned when a write to the devices or the host is skipped
+// in the dry run mode
+var errDryRun = errors.New("not allowed in dry run mode")
+
+// dryRunPath is the path at which the blockdevices of the dry run are served
+const dryRunPath = "/blockdevices"
+
+// dryRunClient is a client which does not send the write requests to the API
+// server. Read requests are passed to the client as is.
+type dryRunClient struct {
+	client.Client
+	sync.Mutex
+	// blockDevices are the blockdevices that would have been written
+	blockDevices map[string]*apis.BlockDevice
+}
+
+// newDryRunClient returns a client that drops the write requests made using
+// the given client
+func newDryRunClient(c client.Client) *dryRunClient {
+	return &dryRunClient{
+		Client:       c,
+		blockDevices: make(map[string]*apis.BlockDevice),
+	}
+}
+
+// record logs the dropped write request, and keeps the blockdevice written
+func (dc *dryRunClient) record(verb string, obj runtime.Object) {
+	blockDevice, ok := obj.(*apis.BlockDevice)
+	if !ok {
+		kind := reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+		name := ""
+		if accessor, err := meta.Accessor(obj); err == nil {
+			name = accessor.GetName()
+		}
+		logger.V(4).Infof("dry run: %s of %s %s not sent to the API server", verb, kind, name)
+		return
+	}
+	blockDeviceLogger(blockDevice).Info("dry run: blockdevice not written",
+		"verb", verb, "state", blockDevice.Status.State)
+
+	dc.Lock()
+	defer dc.Unlock()
+	if verb == "delete" {
+		delete(dc.blockDevices, blockDevice.Name)
+		return
+	}
+	dc.blockDevices[blockDevice.Name] = blockDevice.DeepCopy()
+}
+
+// Create implements client.Writer
+func (dc *dryRunClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	dc.record("create", obj)
+	return nil
+}
+
+// Update implements client.Writer
+func (dc *dryRunClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	dc.record("update", obj)
+	return nil
+}
+
+// Patch implements client.Writer
+func (dc *dryRunClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	dc.record("patch", obj)
+	return nil
+}
+
+// Delete implements client.Writer
+func (dc *dryRunClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	dc.record("delete", obj)
+	return nil
+}
+
+// DeleteAllOf implements client.Writer
+func (dc *dryRunClient) DeleteAllOf(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error {
+	dc.record("deletecollection", obj)
+	return nil
+}
+
+// Status implements client.StatusClient
+func (dc *dryRunClient) Status() client.StatusWriter {
+	return &dryRunStatusWriter{client: dc}
+}
+
+// dryRunStatusWriter drops the status updates
+type dryRunStatusWriter struct {
+	client *dryRunClient
+}
+
+// Update implements client.StatusWriter
+func (dsw *dryRunStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	dsw.client.record("update", obj)
+	return nil
+}
+
+// Patch implements client.StatusWriter
+func (dsw *dryRunStatusWriter) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	dsw.client.record("patch", obj)
+	return nil
+}
+
+// ListBlockDevices returns the blockdevices that would have been written, sorted by name
+func (dc *dryRunClient) ListBlockDevices() []apis.BlockDevice {
+	dc.Lock()
+	defer dc.Unlock()
+	blockDevices := make([]apis.BlockDevice, 0, len(dc.blockDevices))
+	for _, blockDevice := range dc.blockDevices {
+		blockDevices = append(blockDevices, *blockDevice)
+	}
+	sort.Slice(blockDevices, func(i, j int) bool {
+		return blockDevices[i].Name < blockDevices[j].Name
+	})
+	return blockDevices
+}
+
+// dryRunHandler serves the blockdevices that would have been written as json
+func (dc *dryRunClient) dryRunHandler(w http.ResponseWriter, r *http.Request) {
+	blockDeviceList := apis.BlockDeviceList{Items: dc.ListBlockDevices()}
+	blockDeviceList.Kind = "BlockDeviceList"
+	blockDeviceList.APIVersion = apis.SchemeGroupVersion.String()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(blockDeviceList); err != nil {
+		logger.Errorf("unable to write blockdevices of the dry run: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDryRunClient(t *testing.T) {
+	fakeClient := CreateFakeClient(t)
+	dryRun := newDryRunClient(fakeClient)
+	c := &Controller{Clientset: dryRun, dryRun: dryRun}
+
+	bd1 := newQueuedBlockDevice("blockdevice-1", "/dev/sdb")
+	bd2 := newQueuedBlockDevice("blockdevice-2", "/dev/sdc")
+	assert.NoError(t, c.CreateBlockDevice(bd2))
+	assert.NoError(t, c.CreateBlockDevice(bd1))
+
+	// nothing is written to the API server
+	err := fakeClient.Get(context.TODO(),
+		client.ObjectKey{Name: "blockdevice-1"}, &apis.BlockDevice{})
+	assert.True(t, errors.IsNotFound(err))
+
+	blockDevices := dryRun.ListBlockDevices()
+	assert.Equal(t, 2, len(blockDevices))
+	assert.Equal(t, "blockdevice-1", blockDevices[0].Name)
+	assert.Equal(t, "blockdevice-2", blockDevices[1].Name)
+
+	deleted := bd2.DeepCopy()
+	assert.NoError(t, dryRun.Delete(context.TODO(), deleted))
+
+	rec := httptest.NewRecorder()
+	dryRun.dryRunHandler(rec, httptest.NewRequest("GET", dryRunPath, nil))
+	blockDeviceList := apis.BlockDeviceList{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &blockDeviceList))
+	assert.Equal(t, 1, len(blockDeviceList.Items))
+	assert.Equal(t, "blockdevice-1", blockDeviceList.Items[0].Name)
+	assert.Equal(t, "/dev/sdb", blockDeviceList.Items[0].Spec.Path)
+}
+
+func TestDryRunHostWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-dry-run")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	losetup := &fakeLosetup{loopDevices: make(map[string]string)}
+	defer func(run func(args ...string) ([]byte, error)) { runLosetup = run }(runLosetup)
+	runLosetup = losetup.run
+	DryRun = true
+	defer func() { DryRun = false }()
+
+	// a sparse file is not created, and an existing one is not grown
+	sparseFile := filepath.Join(dir, "0-ndm-sparse.img")
+	assert.Equal(t, errDryRun, CheckAndCreateSparseFile(sparseFile, SparseFileMinSize))
+	_, err = os.Stat(sparseFile)
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, ioutil.WriteFile(sparseFile, nil, 0644))
+	assert.NoError(t, CheckAndCreateSparseFile(sparseFile, SparseFileMinSize))
+	info, err := os.Stat(sparseFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+
+	// loop devices are neither attached nor detached
+	_, err = attachLoopDevice(sparseFile)
+	assert.Equal(t, errDryRun, err)
+	assert.Empty(t, losetup.loopDevices)
+	losetup.loopDevices["/dev/loop0"] = sparseFile
+	loopDevice, err := attachLoopDevice(sparseFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/loop0", loopDevice)
+	assert.Equal(t, errDryRun, detachLoopDevices(sparseFile))
+	assert.Equal(t, sparseFile, losetup.loopDevices["/dev/loop0"])
+
+	// the journal is not written
+	journalPath := filepath.Join(dir, "journal.json")
+	openJournal(journalPath).record("blockdevice-1", "/dev/sda", NDMActive)
+	_, err = os.Stat(journalPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -17,14 +17,16 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+
 	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/tracing"
 	"github.com/openebs/node-disk-manager/pkg/util"
-
-	"k8s.io/klog"
 )
 
 // Filter contains name, state and filterInterface
 type Filter struct {
+	Key       string          // Key is the key of the filter in the config
 	Name      string          // Name is the name of the filter
 	State     bool            // State is the State of the filter
 	Interface FilterInterface // Interface contains registered filter
@@ -65,7 +67,23 @@ func (c *Controller) AddNewFilter(filter *Filter) {
 	filters := c.Filters
 	filters = append(filters, filter)
 	c.Filters = filters
-	klog.Info("configured ", filter.Name, " : state ", util.StateStatus(filter.State))
+	logger.Infof("configured %v : state %v", filter.Name, util.StateStatus(filter.State))
+}
+
+// ReplaceFilter replaces the filter having the same key with the given filter.
+// If no such filter exists, the filter is added.
+func (c *Controller) ReplaceFilter(filter *Filter) {
+	c.Lock()
+	defer c.Unlock()
+	for i, f := range c.Filters {
+		if f.Key == filter.Key {
+			c.Filters[i] = filter
+			logger.Infof("reconfigured %v : state %v", filter.Name, util.StateStatus(filter.State))
+			return
+		}
+	}
+	c.Filters = append(c.Filters, filter)
+	logger.Infof("configured %v : state %v", filter.Name, util.StateStatus(filter.State))
 }
 
 // ListFilter returns list of active filters associated with controller object
@@ -84,11 +102,32 @@ func (c *Controller) ListFilter() []*Filter {
 // ApplyFilter checks status for every registered filters if any of the filters
 // wants to stop further process of the event it returns true else it returns false
 func (c *Controller) ApplyFilter(blockDevice *blockdevice.BlockDevice) bool {
+	return c.ApplyFilterWithContext(context.Background(), blockDevice)
+}
+
+// ApplyFilterWithContext applies the filters on the blockdevice, tracing each
+// filter decision as a child of the span in the context
+func (c *Controller) ApplyFilterWithContext(ctx context.Context, blockDevice *blockdevice.BlockDevice) bool {
 	for _, filter := range c.ListFilter() {
-		if !filter.ApplyFilter(blockDevice) {
-			klog.Info(blockDevice.DevPath, " ignored by ", filter.Name)
+		_, span := tracing.StartSpan(ctx, "filter")
+		span.SetAttribute(tracing.FilterNameKey, filter.Name)
+		span.SetAttribute(tracing.DevicePathKey, blockDevice.DevPath)
+		ok := filter.ApplyFilter(blockDevice)
+		span.SetAttribute(tracing.FilterResultKey, filterResult(ok))
+		span.End()
+		if !ok {
+			FilteredDevicesTotal.WithLabelValues(filter.Key).Inc()
+			logger.Infof("%v ignored by %v", blockDevice.DevPath, filter.Name)
 			return false
 		}
 	}
 	return true
 }
+
+// filterResult returns the result of a filter used in the traces
+func filterResult(ok bool) string {
+	if ok {
+		return "included"
+	}
+	return "excluded"
+}
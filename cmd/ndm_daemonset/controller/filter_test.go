@@ -22,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -188,3 +189,23 @@ func TestApplyFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyFilterMetrics(t *testing.T) {
+	fakeController := &Controller{
+		Filters: make([]*Filter, 0),
+		Mutex:   &sync.Mutex{},
+	}
+	fakeController.AddNewFilter(&Filter{
+		Key:       "fake-filter",
+		Name:      "fake filter",
+		State:     true,
+		Interface: &fakeFilter{},
+	})
+	disk := &blockdevice.BlockDevice{}
+	disk.UUID = matchDiskUuid
+
+	before := testutil.ToFloat64(FilteredDevicesTotal.WithLabelValues("fake-filter"))
+	fakeController.ApplyFilter(&blockdevice.BlockDevice{})
+	fakeController.ApplyFilter(disk)
+	assert.Equal(t, before+1, testutil.ToFloat64(FilteredDevicesTotal.WithLabelValues("fake-filter")))
+}
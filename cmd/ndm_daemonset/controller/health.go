@@ -0,0 +1,240 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/server"
+)
+
+const (
+	// HealthStatusOK is the status of a healthy subsystem
+	HealthStatusOK = "ok"
+	// HealthStatusFailed is the status of an unhealthy subsystem
+	HealthStatusFailed = "failed"
+
+	// livenessPath is the path of the liveness endpoint
+	livenessPath = "/healthz"
+	// readinessPath is the path of the readiness endpoint
+	readinessPath = "/readyz"
+)
+
+// HealthAddress is the address(ip:port) on which the health endpoints of the
+// daemon are served. The endpoints are not served if it is empty.
+var HealthAddress = ""
+
+// LivenessGracePeriod is the time for which a liveness check can fail before
+// the daemon is reported as not live. Transient failures, like the udev monitor
+// being reconnected, should not cause the daemon to be restarted.
+var LivenessGracePeriod = 2 * time.Minute
+
+// HealthCheck checks a subsystem of the daemon. The details describe the state
+// of the subsystem, and an error is returned if the subsystem is unhealthy.
+type HealthCheck func() (details string, err error)
+
+// SubsystemHealth is the health of a subsystem of the daemon
+type SubsystemHealth struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details string `json:"details,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthReport is the health of the daemon, reported by the health endpoints
+type HealthReport struct {
+	Status     string            `json:"status"`
+	Subsystems []SubsystemHealth `json:"subsystems"`
+}
+
+// healthCheck is a registered health check
+type healthCheck struct {
+	name  string
+	check HealthCheck
+	// liveness is true if the check is used for liveness. All the checks are
+	// used for readiness.
+	liveness bool
+	// failingSince is the time since when the check is failing
+	failingSince time.Time
+}
+
+// healthState holds the health checks and the state of the subsystems
+// tracked by the controller
+type healthState struct {
+	sync.Mutex
+	checks []*healthCheck
+	// lastAPISuccess is the time of the last successful heartbeat
+	lastAPISuccess time.Time
+	// lastAPIError is the error of the last heartbeat, if it failed
+	lastAPIError error
+	// lastRescan is the time at which the last scan of the devices completed
+	lastRescan time.Time
+}
+
+// AddHealthCheck adds a check of a subsystem to the readiness endpoint, and to
+// the liveness endpoint if liveness is true
+func (c *Controller) AddHealthCheck(name string, liveness bool, check HealthCheck) {
+	c.health.Lock()
+	defer c.health.Unlock()
+	c.health.checks = append(c.health.checks, &healthCheck{
+		name:     name,
+		check:    check,
+		liveness: liveness,
+	})
+}
+
+// RecordRescan records the time at which a scan of the devices completed
+func (c *Controller) RecordRescan() {
+	c.health.Lock()
+	defer c.health.Unlock()
+	c.health.lastRescan = time.Now()
+}
+
+// recordAPIStatus records the result of a request to the API server
+func (c *Controller) recordAPIStatus(err error) {
+	c.health.Lock()
+	defer c.health.Unlock()
+	c.health.lastAPIError = err
+	if err == nil {
+		c.health.lastAPISuccess = time.Now()
+	}
+}
+
+// addDefaultHealthChecks adds the checks of the subsystems tracked by the controller
+func (c *Controller) addDefaultHealthChecks() {
+	c.AddHealthCheck("api-server", false, c.checkAPIServer)
+	c.AddHealthCheck("probes", false, c.checkProbes)
+	c.AddHealthCheck("rescan", false, c.checkRescan)
+	c.AddHealthCheck("device-access", false, c.checkDeviceAccess)
+}
+
+// checkAPIServer checks if the last heartbeat to the API server was successful
+func (c *Controller) checkAPIServer() (string, error) {
+	c.health.Lock()
+	defer c.health.Unlock()
+	details := "no successful request"
+	if !c.health.lastAPISuccess.IsZero() {
+		details = "last successful request at " + c.health.lastAPISuccess.Format(time.RFC3339)
+	}
+	if c.health.lastAPIError != nil {
+		return details, fmt.Errorf("api server not reachable: %v", c.health.lastAPIError)
+	}
+	if c.health.lastAPISuccess.IsZero() {
+		return details, fmt.Errorf("api server not contacted yet")
+	}
+	return details, nil
+}
+
+// checkProbes checks if probes have been registered
+func (c *Controller) checkProbes() (string, error) {
+	c.Lock()
+	registered := len(c.Probes)
+	c.Unlock()
+	details := fmt.Sprintf("%d probes registered, %d enabled", registered, len(c.ListProbe()))
+	if registered == 0 {
+		return details, fmt.Errorf("no probes registered")
+	}
+	return details, nil
+}
+
+// checkRescan checks if a scan of the devices has completed
+func (c *Controller) checkRescan() (string, error) {
+	c.health.Lock()
+	defer c.health.Unlock()
+	if c.health.lastRescan.IsZero() {
+		return "", fmt.Errorf("initial scan not completed")
+	}
+	return "last successful rescan at " + c.health.lastRescan.Format(time.RFC3339), nil
+}
+
+// CheckHealth runs the health checks and returns the report. If liveness is true,
+// only the liveness checks are run, and a check is reported as failed only if it
+// has been failing for more than LivenessGracePeriod.
+func (c *Controller) CheckHealth(liveness bool) HealthReport {
+	c.health.Lock()
+	checks := make([]*healthCheck, 0, len(c.health.checks))
+	for _, hc := range c.health.checks {
+		if hc.liveness || !liveness {
+			checks = append(checks, hc)
+		}
+	}
+	c.health.Unlock()
+
+	report := HealthReport{
+		Status:     HealthStatusOK,
+		Subsystems: make([]SubsystemHealth, 0, len(checks)),
+	}
+	for _, hc := range checks {
+		// the checks acquire the health lock, so it is not held while running them
+		details, err := hc.check()
+		subsystem := SubsystemHealth{
+			Name:    hc.name,
+			Status:  HealthStatusOK,
+			Details: details,
+		}
+
+		c.health.Lock()
+		if err == nil {
+			hc.failingSince = time.Time{}
+		} else if hc.failingSince.IsZero() {
+			hc.failingSince = time.Now()
+		}
+		failingFor := time.Since(hc.failingSince)
+		c.health.Unlock()
+
+		if err != nil {
+			subsystem.Error = err.Error()
+			if !liveness || failingFor >= LivenessGracePeriod {
+				subsystem.Status = HealthStatusFailed
+				report.Status = HealthStatusFailed
+			}
+		}
+		report.Subsystems = append(report.Subsystems, subsystem)
+	}
+	return report
+}
+
+// healthHandler serves the health report as json. The status code is 503 if
+// the daemon is unhealthy.
+func (c *Controller) healthHandler(liveness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := c.CheckHealth(liveness)
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != HealthStatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Errorf("unable to write health report: %v", err)
+		}
+	}
+}
+
+// serveHealth serves the health endpoints on HealthAddress till the stop channel is closed
+func (c *Controller) serveHealth(stopCh <-chan struct{}) {
+	if len(HealthAddress) == 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(livenessPath, c.healthHandler(true))
+	mux.Handle(readinessPath, c.healthHandler(false))
+	secure := server.SecureOptions{CertFile: SecureServing.CertFile, KeyFile: SecureServing.KeyFile}
+	serveHTTP("health endpoints", HealthAddress, mux, secure, stopCh)
+}
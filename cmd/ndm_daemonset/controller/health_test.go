@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckHealth(t *testing.T) {
+	fakeController := &Controller{Mutex: &sync.Mutex{}}
+	fakeController.addDefaultHealthChecks()
+
+	var monitorErr error
+	fakeController.AddHealthCheck("udev-monitor", true, func() (string, error) {
+		return "", monitorErr
+	})
+
+	// nothing has been recorded yet
+	report := fakeController.CheckHealth(false)
+	assert.Equal(t, HealthStatusFailed, report.Status)
+	assert.Equal(t, []SubsystemHealth{
+		{Name: "api-server", Status: HealthStatusFailed, Details: "no successful request", Error: "api server not contacted yet"},
+		{Name: "probes", Status: HealthStatusFailed, Details: "0 probes registered, 0 enabled", Error: "no probes registered"},
+		{Name: "rescan", Status: HealthStatusFailed, Error: "initial scan not completed"},
+		{Name: "device-access", Status: HealthStatusOK, Details: GetDeviceAccess().String()},
+		{Name: "udev-monitor", Status: HealthStatusOK},
+	}, report.Subsystems)
+
+	fakeController.Probes = []*Probe{{Name: "udev probe", State: true}}
+	fakeController.recordAPIStatus(nil)
+	fakeController.RecordRescan()
+	report = fakeController.CheckHealth(false)
+	assert.Equal(t, HealthStatusOK, report.Status)
+
+	// api server failure affects only the readiness
+	fakeController.recordAPIStatus(errors.New("connection refused"))
+	assert.Equal(t, HealthStatusFailed, fakeController.CheckHealth(false).Status)
+	assert.Equal(t, HealthStatusOK, fakeController.CheckHealth(true).Status)
+
+	// liveness fails only after the grace period
+	monitorErr = errors.New("udev monitor disconnected")
+	report = fakeController.CheckHealth(true)
+	assert.Equal(t, HealthStatusOK, report.Status)
+	assert.Equal(t, []SubsystemHealth{
+		{Name: "udev-monitor", Status: HealthStatusOK, Error: "udev monitor disconnected"},
+	}, report.Subsystems)
+
+	defer func(gracePeriod time.Duration) {
+		LivenessGracePeriod = gracePeriod
+	}(LivenessGracePeriod)
+	LivenessGracePeriod = 0
+	assert.Equal(t, HealthStatusFailed, fakeController.CheckHealth(true).Status)
+
+	// recovered check is healthy again
+	monitorErr = nil
+	assert.Equal(t, HealthStatusOK, fakeController.CheckHealth(true).Status)
+}
+
+func TestHealthHandler(t *testing.T) {
+	fakeController := &Controller{Mutex: &sync.Mutex{}}
+	var probeErr error
+	fakeController.AddHealthCheck("probes", false, func() (string, error) {
+		return "1 probes registered", probeErr
+	})
+
+	tests := map[string]struct {
+		err            error
+		expectedStatus int
+		expectedReport HealthReport
+	}{
+		"healthy daemon": {
+			expectedStatus: http.StatusOK,
+			expectedReport: HealthReport{
+				Status: HealthStatusOK,
+				Subsystems: []SubsystemHealth{
+					{Name: "probes", Status: HealthStatusOK, Details: "1 probes registered"},
+				},
+			},
+		},
+		"unhealthy daemon": {
+			err:            errors.New("probe failed"),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedReport: HealthReport{
+				Status: HealthStatusFailed,
+				Subsystems: []SubsystemHealth{
+					{Name: "probes", Status: HealthStatusFailed, Details: "1 probes registered", Error: "probe failed"},
+				},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			probeErr = test.err
+			recorder := httptest.NewRecorder()
+			fakeController.healthHandler(false).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+			assert.Equal(t, test.expectedStatus, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+			var report HealthReport
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+			assert.Equal(t, test.expectedReport, report)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// HealthSeverityWarning is the severity of a crossed warning threshold
+	HealthSeverityWarning = "Warning"
+	// HealthSeverityCritical is the severity of a crossed critical threshold
+	HealthSeverityCritical = "Critical"
+
+	// the names of the metrics, which are the same as the keys in the config
+	healthMetricTemperature          = "temperature"
+	healthMetricPercentEnduranceUsed = "percentenduranceused"
+	healthMetricAvailableSpare       = "availablespare"
+	healthMetricFailureRisk          = "failurerisk"
+)
+
+// HealthAlert is a SMART metric of a device that has crossed a threshold
+type HealthAlert struct {
+	Metric    string
+	Severity  string
+	Value     float64
+	Threshold float64
+	// Below is set if the threshold is crossed when the value falls below it
+	Below bool
+}
+
+// String describes the crossed threshold. The current value is not included
+// so that the description changes only when a different threshold is crossed.
+func (a HealthAlert) String() string {
+	direction := "above"
+	if a.Below {
+		direction = "below"
+	}
+	return fmt.Sprintf("%s %s %s threshold %v", a.Metric, direction, strings.ToLower(a.Severity), a.Threshold)
+}
+
+// CheckHealthThresholds returns the thresholds configured in the ndm config that
+// have been crossed by the SMART metrics of the device. Metrics that are not
+// reported by the device are not checked.
+func (c *Controller) CheckHealthThresholds(device *bd.BlockDevice) []HealthAlert {
+	ndmConfig := c.GetNDMConfig()
+	if ndmConfig == nil || ndmConfig.HealthThresholds == nil {
+		return nil
+	}
+	thresholds := ndmConfig.HealthThresholds
+	smartInfo := device.SMARTInfo
+
+	var alerts []HealthAlert
+	add := func(alert *HealthAlert) {
+		if alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+	if smartInfo.TemperatureInfo.CurrentTemperatureDataValid {
+		add(checkThreshold(healthMetricTemperature,
+			float64(smartInfo.TemperatureInfo.CurrentTemperature), thresholds.Temperature, false))
+	}
+	add(checkThreshold(healthMetricPercentEnduranceUsed,
+		smartInfo.PercentEnduranceUsed, thresholds.PercentEnduranceUsed, false))
+	if smartInfo.AvailableSpareValid {
+		add(checkThreshold(healthMetricAvailableSpare,
+			float64(smartInfo.AvailableSpare), thresholds.AvailableSpare, true))
+	}
+	if ndmConfig.FailurePrediction != nil && smartInfo.FailureIndicators != nil {
+		add(checkThreshold(healthMetricFailureRisk,
+			ndmConfig.FailurePrediction.Score(smartInfo.FailureIndicators), thresholds.FailureRisk, false))
+	}
+	return alerts
+}
+
+// checkThreshold returns an alert of the highest severity crossed by the value,
+// or nil if no threshold is crossed
+func checkThreshold(metric string, value float64, threshold *ThresholdConfig, below bool) *HealthAlert {
+	if threshold == nil {
+		return nil
+	}
+	crossed := func(limit *float64) bool {
+		if limit == nil {
+			return false
+		}
+		if below {
+			return value < *limit
+		}
+		return value > *limit
+	}
+	alert := &HealthAlert{Metric: metric, Value: value, Below: below}
+	switch {
+	case crossed(threshold.Critical):
+		alert.Severity = HealthSeverityCritical
+		alert.Threshold = *threshold.Critical
+	case crossed(threshold.Warning):
+		alert.Severity = HealthSeverityWarning
+		alert.Threshold = *threshold.Warning
+	default:
+		return nil
+	}
+	return alert
+}
+
+// healthThresholdCondition returns the HealthThresholdExceeded condition for
+// the alerts. The reason is the highest severity among the alerts.
+func healthThresholdCondition(alerts []HealthAlert) apis.BlockDeviceCondition {
+	severity := HealthSeverityWarning
+	descriptions := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		if alert.Severity == HealthSeverityCritical {
+			severity = HealthSeverityCritical
+		}
+		descriptions = append(descriptions, alert.String())
+	}
+	return apis.BlockDeviceCondition{
+		Type:    apis.BlockDeviceHealthThresholdExceeded,
+		Status:  v1.ConditionTrue,
+		Reason:  severity + "ThresholdExceeded",
+		Message: strings.Join(descriptions, ", "),
+	}
+}
+
+// recordHealthThresholdEvent records an event on the blockdevice when the
+// crossed thresholds have changed between the old and the new resource. The
+// old resource is nil if the blockdevice was created.
+func (c *Controller) recordHealthThresholdEvent(oldBD, newBD *apis.BlockDevice) {
+	var oldCond *apis.BlockDeviceCondition
+	if oldBD != nil {
+		oldCond = oldBD.Status.GetCondition(apis.BlockDeviceHealthThresholdExceeded)
+	}
+	newCond := newBD.Status.GetCondition(apis.BlockDeviceHealthThresholdExceeded)
+	switch {
+	case newCond != nil && (oldCond == nil || oldCond.Message != newCond.Message):
+		c.Eventf(newBD, v1.EventTypeWarning, "HealthThresholdExceeded",
+			"Device %s: %s", newBD.Spec.Path, newCond.Message)
+	case newCond == nil && oldCond != nil:
+		c.Eventf(newBD, v1.EventTypeNormal, "HealthThresholdCleared",
+			"Device %s is within the configured health thresholds", newBD.Spec.Path)
+	}
+}
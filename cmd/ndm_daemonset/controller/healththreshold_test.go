@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/record"
+)
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func TestCheckHealthThresholds(t *testing.T) {
+	ctrl := &Controller{
+		NDMConfig: &NodeDiskManagerConfig{
+			HealthThresholds: &HealthThresholdsConfig{
+				Temperature:          &ThresholdConfig{Warning: float64Ptr(60), Critical: float64Ptr(70)},
+				PercentEnduranceUsed: &ThresholdConfig{Warning: float64Ptr(80)},
+				AvailableSpare:       &ThresholdConfig{Warning: float64Ptr(20), Critical: float64Ptr(10)},
+				FailureRisk:          &ThresholdConfig{Warning: float64Ptr(0.4), Critical: float64Ptr(0.6)},
+			},
+			FailurePrediction: &FailurePredictionConfig{
+				Weights: failurerisk.Weights{
+					failurerisk.PendingSectors:     0.5,
+					failurerisk.ReallocatedSectors: 0.5,
+				},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		smartInfo bd.SMARTStats
+		want      []HealthAlert
+	}{
+		"within thresholds": {
+			smartInfo: bd.SMARTStats{
+				TemperatureInfo:      bd.TemperatureInformation{CurrentTemperatureDataValid: true, CurrentTemperature: 40},
+				PercentEnduranceUsed: 10,
+				AvailableSpareValid:  true,
+				AvailableSpare:       100,
+			},
+		},
+		"metrics not reported": {
+			smartInfo: bd.SMARTStats{
+				TemperatureInfo: bd.TemperatureInformation{CurrentTemperature: 90},
+			},
+		},
+		"warning and critical thresholds crossed": {
+			smartInfo: bd.SMARTStats{
+				TemperatureInfo:      bd.TemperatureInformation{CurrentTemperatureDataValid: true, CurrentTemperature: 75},
+				PercentEnduranceUsed: 85,
+				AvailableSpareValid:  true,
+				AvailableSpare:       15,
+			},
+			want: []HealthAlert{
+				{Metric: "temperature", Severity: HealthSeverityCritical, Value: 75, Threshold: 70},
+				{Metric: "percentenduranceused", Severity: HealthSeverityWarning, Value: 85, Threshold: 80},
+				{Metric: "availablespare", Severity: HealthSeverityWarning, Value: 15, Threshold: 20, Below: true},
+			},
+		},
+		"failure risk": {
+			smartInfo: bd.SMARTStats{
+				FailureIndicators: map[string]uint64{
+					failurerisk.PendingSectors:     8,
+					failurerisk.ReallocatedSectors: 2,
+					failurerisk.CRCErrors:          0,
+				},
+			},
+			want: []HealthAlert{
+				{Metric: "failurerisk", Severity: HealthSeverityCritical, Value: 0.75, Threshold: 0.6},
+			},
+		},
+		"no failure indicators": {
+			smartInfo: bd.SMARTStats{
+				FailureIndicators: map[string]uint64{failurerisk.CRCErrors: 0},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			alerts := ctrl.CheckHealthThresholds(&bd.BlockDevice{SMARTInfo: test.smartInfo})
+			assert.Equal(t, test.want, alerts)
+		})
+	}
+
+	// thresholds are not checked if they are not configured
+	assert.Nil(t, (&Controller{}).CheckHealthThresholds(&bd.BlockDevice{}))
+}
+
+func TestHealthThresholdCondition(t *testing.T) {
+	cond := healthThresholdCondition([]HealthAlert{
+		{Metric: "temperature", Severity: HealthSeverityWarning, Value: 65, Threshold: 60},
+		{Metric: "availablespare", Severity: HealthSeverityCritical, Value: 5, Threshold: 10, Below: true},
+	})
+	assert.Equal(t, apis.BlockDeviceHealthThresholdExceeded, cond.Type)
+	assert.Equal(t, "CriticalThresholdExceeded", cond.Reason)
+	assert.Equal(t, "temperature above warning threshold 60, availablespare below critical threshold 10", cond.Message)
+}
+
+func TestRecordHealthThresholdEvent(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	ctrl := &Controller{Recorder: recorder}
+
+	healthy := &apis.BlockDevice{}
+	healthy.Spec.Path = "/dev/nvme0n1"
+	hot := healthy.DeepCopy()
+	hot.Status.SetCondition(healthThresholdCondition([]HealthAlert{
+		{Metric: "temperature", Severity: HealthSeverityWarning, Value: 65, Threshold: 60},
+	}))
+	hotter := healthy.DeepCopy()
+	hotter.Status.SetCondition(healthThresholdCondition([]HealthAlert{
+		{Metric: "temperature", Severity: HealthSeverityCritical, Value: 75, Threshold: 70},
+	}))
+
+	ctrl.recordHealthThresholdEvent(nil, healthy)
+	ctrl.recordHealthThresholdEvent(healthy, hot)
+	// no event if the same thresholds are still crossed
+	ctrl.recordHealthThresholdEvent(hot, hot)
+	ctrl.recordHealthThresholdEvent(hot, hotter)
+	ctrl.recordHealthThresholdEvent(hotter, healthy)
+	close(recorder.Events)
+
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	assert.Equal(t, []string{
+		"Warning HealthThresholdExceeded Device /dev/nvme0n1: temperature above warning threshold 60",
+		"Warning HealthThresholdExceeded Device /dev/nvme0n1: temperature above critical threshold 70",
+		"Normal HealthThresholdCleared Device /dev/nvme0n1 is within the configured health thresholds",
+	}, events)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// HeartbeatLeasePrefix is the prefix of the name of the lease renewed by
+	// the NDM daemon on each node. The lease name is the prefix followed by
+	// the node name.
+	HeartbeatLeasePrefix = "ndm-heartbeat-"
+	// HeartbeatLeaseLabel is the label added on the heartbeat leases
+	HeartbeatLeaseLabel = "ndm.io/heartbeat"
+	// HeartbeatInterval is the interval at which the heartbeat lease is renewed
+	HeartbeatInterval = 10 * time.Second
+	// HeartbeatLeaseDurationSeconds is the duration after which the daemon is
+	// considered dead if the lease is not renewed
+	HeartbeatLeaseDurationSeconds int32 = 40
+	// HeartbeatExpiredAnnotation is set by the operator on the blockdevices it
+	// marks as Unknown when the heartbeat lease of their node expires, so that
+	// only they are marked as Active again when the heartbeat resumes. The
+	// daemon removes it when it marks a blockdevice Unknown or Inactive itself.
+	HeartbeatExpiredAnnotation = "internal.openebs.io/heartbeat-expired-at"
+)
+
+// GetHeartbeatLeaseName returns the name of the heartbeat lease of the node
+func GetHeartbeatLeaseName(nodeName string) string {
+	return HeartbeatLeasePrefix + nodeName
+}
+
+// StartHeartbeat renews the heartbeat lease of this node periodically, till
+// the stop channel is closed
+func (c *Controller) StartHeartbeat(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		err := c.renewHeartbeat()
+		if err != nil {
+			logger.Errorf("unable to renew heartbeat lease: %v", err)
+		}
+		c.recordAPIStatus(err)
+		// the API server is reachable, send the writes queued during the outage
+		if err == nil {
+			c.FlushWriteQueue()
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewHeartbeat creates the heartbeat lease of the node if it does not exist,
+// else updates the renew time of the lease
+func (c *Controller) renewHeartbeat() error {
+	nodeName := c.NodeAttributes[NodeNameKey]
+	now := metav1.NewMicroTime(time.Now())
+	leaseDuration := HeartbeatLeaseDurationSeconds
+
+	lease := &coordinationv1.Lease{}
+	err := c.Clientset.Get(context.TODO(),
+		client.ObjectKey{Namespace: c.Namespace, Name: GetHeartbeatLeaseName(nodeName)}, lease)
+	if errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetHeartbeatLeaseName(nodeName),
+				Namespace: c.Namespace,
+				Labels: map[string]string{
+					HeartbeatLeaseLabel: TrueString,
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &nodeName,
+				LeaseDurationSeconds: &leaseDuration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		return c.Clientset.Create(context.TODO(), lease)
+	}
+	if err != nil {
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &nodeName
+	lease.Spec.LeaseDurationSeconds = &leaseDuration
+	lease.Spec.RenewTime = &now
+	return c.Clientset.Update(context.TODO(), lease)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// instrumentedClient is a client which records the time taken by the write
+// requests to the API server, and the states of the blockdevices written.
+// Read requests are passed to the client as is.
+type instrumentedClient struct {
+	client.Client
+	states *blockDeviceStates
+}
+
+// newInstrumentedClient returns a client that records the latency of the
+// write requests made using the given client
+func newInstrumentedClient(c client.Client) client.Client {
+	return &instrumentedClient{Client: c, states: newBlockDeviceStates()}
+}
+
+// Create implements client.Writer
+func (ic *instrumentedClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	start := time.Now()
+	err := ic.Client.Create(ctx, obj, opts...)
+	observeAPIRequest("create", obj, start, err)
+	if err == nil {
+		ic.states.record(obj)
+	}
+	return err
+}
+
+// Update implements client.Writer
+func (ic *instrumentedClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	start := time.Now()
+	err := ic.Client.Update(ctx, obj, opts...)
+	observeAPIRequest("update", obj, start, err)
+	if err == nil {
+		ic.states.record(obj)
+	}
+	return err
+}
+
+// Patch implements client.Writer
+func (ic *instrumentedClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	start := time.Now()
+	err := ic.Client.Patch(ctx, obj, patch, opts...)
+	observeAPIRequest("patch", obj, start, err)
+	if err == nil {
+		ic.states.record(obj)
+	}
+	return err
+}
+
+// Delete implements client.Writer
+func (ic *instrumentedClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	start := time.Now()
+	err := ic.Client.Delete(ctx, obj, opts...)
+	observeAPIRequest("delete", obj, start, err)
+	if err == nil || errors.IsNotFound(err) {
+		ic.states.remove(obj)
+	}
+	return err
+}
+
+// DeleteAllOf implements client.Writer
+func (ic *instrumentedClient) DeleteAllOf(ctx context.Context, obj runtime.Object, opts ...client.DeleteAllOfOption) error {
+	start := time.Now()
+	err := ic.Client.DeleteAllOf(ctx, obj, opts...)
+	observeAPIRequest("deletecollection", obj, start, err)
+	return err
+}
+
+// observeAPIRequest records the time elapsed since start for the request, and
+// the reason if the request failed. The resource is the type name of the object,
+// eg: BlockDevice
+func observeAPIRequest(verb string, obj runtime.Object, start time.Time, err error) {
+	resource := reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	APIRequestDuration.WithLabelValues(verb, resource).Observe(time.Since(start).Seconds())
+	if err != nil {
+		APIRequestErrorsTotal.WithLabelValues(verb, resource, errorReason(err)).Inc()
+	}
+}
+
+// errorReason returns the reason of the failure of the request, eg: Conflict,
+// TooManyRequests. Unreachable is returned if the request could not be sent.
+func errorReason(err error) string {
+	if _, ok := err.(errors.APIStatus); !ok {
+		return ErrorReasonUnreachable
+	}
+	if reason := errors.ReasonForError(err); reason != metav1.StatusReasonUnknown {
+		return string(reason)
+	}
+	return "Unknown"
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func getSampleCount(t *testing.T, verb, resource string) uint64 {
+	metric := &dto.Metric{}
+	observer := APIRequestDuration.WithLabelValues(verb, resource)
+	if err := observer.(prometheus.Metric).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestInstrumentedClient(t *testing.T) {
+	fakeClient := newInstrumentedClient(CreateFakeClient(t))
+	bd := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "blockdevice-instrumented",
+		},
+	}
+
+	createCount := getSampleCount(t, "create", "BlockDevice")
+	updateCount := getSampleCount(t, "update", "BlockDevice")
+	deleteCount := getSampleCount(t, "delete", "BlockDevice")
+
+	assert.NoError(t, fakeClient.Create(context.TODO(), bd))
+	assert.NoError(t, fakeClient.Update(context.TODO(), bd))
+	assert.NoError(t, fakeClient.Delete(context.TODO(), bd))
+	// failed requests are also recorded
+	assert.Error(t, fakeClient.Delete(context.TODO(), bd))
+
+	assert.Equal(t, createCount+1, getSampleCount(t, "create", "BlockDevice"))
+	assert.Equal(t, updateCount+1, getSampleCount(t, "update", "BlockDevice"))
+	assert.Equal(t, deleteCount+2, getSampleCount(t, "delete", "BlockDevice"))
+}
+
+func TestInstrumentedClientStates(t *testing.T) {
+	fakeClient := newInstrumentedClient(CreateFakeClient(t))
+	active := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "blockdevice-active"},
+		Status:     apis.DeviceStatus{State: NDMActive},
+	}
+	unknown := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "blockdevice-unknown"},
+		Status:     apis.DeviceStatus{State: NDMActive},
+	}
+	assert.NoError(t, fakeClient.Create(context.TODO(), active))
+	assert.NoError(t, fakeClient.Create(context.TODO(), unknown))
+	unknown.Status.State = NDMUnknown
+	assert.NoError(t, fakeClient.Update(context.TODO(), unknown))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(BlockDevicesByState.WithLabelValues(NDMActive)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(BlockDevicesByState.WithLabelValues(NDMUnknown)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(BlockDevicesByState.WithLabelValues(NDMInactive)))
+
+	assert.NoError(t, fakeClient.Delete(context.TODO(), unknown))
+	assert.Equal(t, float64(0), testutil.ToFloat64(BlockDevicesByState.WithLabelValues(NDMUnknown)))
+}
+
+func TestErrorReason(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want string
+	}{
+		"conflict": {
+			err:  errors.NewConflict(schema.GroupResource{Resource: "blockdevices"}, "bd", fmt.Errorf("conflict")),
+			want: "Conflict",
+		},
+		"throttled": {
+			err:  errors.NewTooManyRequests("throttled", 1),
+			want: "TooManyRequests",
+		},
+		"connection refused": {
+			err:  fmt.Errorf("dial tcp: connection refused"),
+			want: ErrorReasonUnreachable,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.want, errorReason(test.err))
+		})
+	}
+}
+
+func TestInstrumentedClientErrors(t *testing.T) {
+	fakeClient := newInstrumentedClient(CreateFakeClient(t))
+	bd := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "blockdevice-missing",
+		},
+	}
+	before := testutil.ToFloat64(APIRequestErrorsTotal.WithLabelValues("update", "BlockDevice", "NotFound"))
+	assert.Error(t, fakeClient.Update(context.TODO(), bd))
+	assert.Equal(t, before+1, testutil.ToFloat64(APIRequestErrorsTotal.WithLabelValues("update", "BlockDevice", "NotFound")))
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"github.com/openebs/node-disk-manager/blockdevice"
+)
+
+// InventoryPath is the path of the local api at which an inventory of devices
+// is loaded, if the daemon is running in the fake probe mode
+const InventoryPath = "/v1/inventory"
+
+var (
+	// FakeProbe discovers the devices from an inventory of devices instead of
+	// the devices on the node. The details of the devices are filled from the
+	// inventory rather than by the probes, so that the discovery on another
+	// node can be reproduced using the inventory exported from that node.
+	FakeProbe = false
+	// FakeInventoryPath is the inventory loaded at startup in the fake probe mode
+	FakeInventoryPath = ""
+)
+
+// errFakeProbeDisabled is returned if an inventory is loaded while the daemon
+// is not running in the fake probe mode
+var errFakeProbeDisabled = errors.New("inventory can be loaded only in the fake probe mode, enabled using --fake-probe")
+
+// fakeInventory holds the inventory of devices of the fake probe mode
+type fakeInventory struct {
+	sync.Mutex
+	// data is the inventory as json, so that each scan gets a copy of the devices
+	data []byte
+}
+
+// ReadInventory reads the inventory of devices in json or yaml at the given path,
+// which is a DeviceList as served at DevicesPath
+func ReadInventory(path string) (*DeviceList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	deviceList := &DeviceList{}
+	if err := yaml.Unmarshal(data, deviceList); err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %v", path, err)
+	}
+	return deviceList, nil
+}
+
+// SetFakeInventory sets the inventory from which the devices are discovered in
+// the fake probe mode
+func (c *Controller) SetFakeInventory(deviceList *DeviceList) error {
+	data, err := json.Marshal(deviceList)
+	if err != nil {
+		return err
+	}
+	c.fakeInventory.Lock()
+	defer c.fakeInventory.Unlock()
+	c.fakeInventory.data = data
+	logger.Infof("loaded inventory of %d devices from node %s", len(deviceList.Devices), deviceList.Node)
+	return nil
+}
+
+// FakeInventory returns a copy of the devices of the inventory, sorted by the
+// device path
+func (c *Controller) FakeInventory() []blockdevice.BlockDevice {
+	c.fakeInventory.Lock()
+	defer c.fakeInventory.Unlock()
+	devices := make([]blockdevice.BlockDevice, 0)
+	if len(c.fakeInventory.data) == 0 {
+		return devices
+	}
+	deviceList := &DeviceList{}
+	if err := json.Unmarshal(c.fakeInventory.data, deviceList); err != nil {
+		logger.Errorf("unable to read the inventory: %v", err)
+		return devices
+	}
+	for _, status := range deviceList.Devices {
+		devices = append(devices, status.Device)
+	}
+	return devices
+}
+
+// inventoryHandler loads the inventory in the request, and rescans the devices
+// so that the devices of the inventory are processed. The result of the rescan
+// is returned.
+func (c *Controller) inventoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !FakeProbe {
+		http.Error(w, errFakeProbeDisabled.Error(), http.StatusConflict)
+		return
+	}
+	deviceList := &DeviceList{}
+	if err := json.NewDecoder(r.Body).Decode(deviceList); err != nil {
+		http.Error(w, fmt.Sprintf("invalid inventory: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := c.SetFakeInventory(deviceList); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.rescanHandler(w, r)
+}
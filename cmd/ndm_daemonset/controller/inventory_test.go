@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-inventory")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	yamlFile := filepath.Join(dir, "devices.yaml")
+	require.NoError(t, ioutil.WriteFile(yamlFile, []byte(`node: node1
+devices:
+- device:
+    DevPath: /dev/sdb
+    UUID: blockdevice-b
+    Capacity:
+      Storage: 100
+  filtered: false
+`), 0600))
+	deviceList, err := ReadInventory(yamlFile)
+	require.NoError(t, err)
+	assert.Equal(t, "node1", deviceList.Node)
+	require.Len(t, deviceList.Devices, 1)
+	assert.Equal(t, *newTestDevice("/dev/sdb", "blockdevice-b", 100), deviceList.Devices[0].Device)
+
+	invalidFile := filepath.Join(dir, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(invalidFile, []byte(`{"devices": {}}`), 0600))
+	_, err = ReadInventory(invalidFile)
+	assert.Error(t, err)
+}
+
+func TestInventoryHandler(t *testing.T) {
+	defer func(fakeProbe bool) { FakeProbe = fakeProbe }(FakeProbe)
+	c := &Controller{NodeAttributes: map[string]string{NodeNameKey: "node1"}}
+	c.RecordDevice(newTestDevice("/dev/sda", "blockdevice-a", 100), false)
+	// the scan processes the devices of the inventory
+	c.SetRescanTrigger(func() {
+		go func() {
+			for _, device := range c.FakeInventory() {
+				device := device
+				c.RecordDevice(&device, false)
+			}
+			c.ScanProcessed()
+		}()
+	})
+	inventory := `{"node": "node2", "devices": [{"device": {"DevPath": "/dev/sdb", "UUID": "blockdevice-b"}}]}`
+
+	FakeProbe = false
+	rec := httptest.NewRecorder()
+	c.inventoryHandler(rec, httptest.NewRequest(http.MethodPost, InventoryPath, strings.NewReader(inventory)))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Empty(t, c.FakeInventory())
+
+	FakeProbe = true
+	rec = httptest.NewRecorder()
+	c.inventoryHandler(rec, httptest.NewRequest(http.MethodPost, InventoryPath, strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	c.inventoryHandler(rec, httptest.NewRequest(http.MethodPost, InventoryPath, strings.NewReader(inventory)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	result := RescanResult{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, []DeviceChange{{DevPath: "/dev/sdb", BlockDevice: "blockdevice-b"}}, result.Added)
+
+	// each call returns a copy of the devices
+	devices := c.FakeInventory()
+	require.Len(t, devices, 1)
+	devices[0].DevPath = "/dev/sdc"
+	assert.Equal(t, "/dev/sdb", c.FakeInventory()[0].DevPath)
+
+	rec = httptest.NewRecorder()
+	c.inventoryHandler(rec, httptest.NewRequest(http.MethodGet, InventoryPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/util"
+)
+
+// JournalPath is the path of the file in which the journal of the processed
+// devices is persisted, so that the changes that happened while the daemon was
+// not running can be detected on startup. The journal is not used if empty.
+var JournalPath = "/var/openebs/ndm/journal.json"
+
+// JournalEntry is the last processed state of a blockdevice on the node
+type JournalEntry struct {
+	// Path is the device path of the blockdevice
+	Path string `json:"path"`
+	// State is the state to which the blockdevice resource was set
+	State string `json:"state"`
+	// Generation is the generation of the journal in which the
+	// blockdevice was last processed
+	Generation int64 `json:"generation"`
+}
+
+// deviceJournal keeps the last processed state of each blockdevice and
+// persists it on the host after every change
+type deviceJournal struct {
+	path  string
+	mutex sync.Mutex
+	// Generation is incremented each time a blockdevice is processed
+	Generation int64 `json:"generation"`
+	// Devices are the journal entries keyed by the blockdevice name
+	Devices map[string]JournalEntry `json:"devices"`
+	// reconciled is set once the journal is reconciled with the devices
+	// detected after startup
+	reconciled bool
+}
+
+// openJournal loads the journal from the given path. An empty journal is
+// used if the file does not exist or cannot be read.
+func openJournal(path string) *deviceJournal {
+	journal := &deviceJournal{
+		path:    path,
+		Devices: make(map[string]JournalEntry),
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Errorf("unable to read journal %s, starting with an empty journal: %v", path, err)
+		}
+		return journal
+	}
+	if err := json.Unmarshal(data, journal); err != nil {
+		logger.Errorf("unable to parse journal %s, starting with an empty journal: %v", path, err)
+		journal.Generation = 0
+		journal.Devices = make(map[string]JournalEntry)
+		return journal
+	}
+	if journal.Devices == nil {
+		journal.Devices = make(map[string]JournalEntry)
+	}
+	logger.Infof("loaded journal %s with %d devices at generation %d",
+		path, len(journal.Devices), journal.Generation)
+	return journal
+}
+
+// record sets the state of the blockdevice in the journal and persists it
+func (j *deviceJournal) record(name, path, state string) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if entry, ok := j.Devices[name]; ok && entry.Path == path && entry.State == state {
+		return
+	}
+	j.Generation++
+	j.Devices[name] = JournalEntry{
+		Path:       path,
+		State:      state,
+		Generation: j.Generation,
+	}
+	j.save()
+}
+
+// remove removes the blockdevice from the journal and persists it
+func (j *deviceJournal) remove(name string) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if _, ok := j.Devices[name]; !ok {
+		return
+	}
+	j.Generation++
+	delete(j.Devices, name)
+	j.save()
+}
+
+// save writes the journal to a temporary file which is then renamed, so
+// that a crash while writing does not corrupt the journal. The file and the
+// directory are synced, so that the journal survives a crash of the node.
+// Must be called with the lock held. The journal is not written in the dry
+// run mode.
+func (j *deviceJournal) save() {
+	if DryRun {
+		return
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		logger.Errorf("unable to marshal journal: %v", err)
+		return
+	}
+	dir := filepath.Dir(j.path)
+	tmpPath := filepath.Join(dir, "."+filepath.Base(j.path)+".tmp")
+	if err := writeFileSync(tmpPath, data); err != nil {
+		logger.Errorf("unable to write journal %s: %v", tmpPath, err)
+		return
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		logger.Errorf("unable to persist journal %s: %v", j.path, err)
+		return
+	}
+	if err := syncDir(dir); err != nil {
+		logger.Errorf("unable to sync journal directory %s: %v", dir, err)
+	}
+}
+
+// writeFileSync writes the data to the file and syncs it to the disk
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory, so that a rename in it is persisted
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// missingDevices returns the names of the blockdevices which were active when
+// they were last processed, but whose device path is not in the given paths.
+// It returns nil after the first call, since the devices are compared only
+// with the devices detected after startup.
+func (j *deviceJournal) missingDevices(devPaths []string) []string {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.reconciled {
+		return nil
+	}
+	j.reconciled = true
+	missing := make([]string, 0)
+	for name, entry := range j.Devices {
+		if entry.State == NDMActive && !util.Contains(devPaths, entry.Path) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// recordBlockDevice records the state of the blockdevice resource in the journal,
+// and for the reconciliation of the drift on startup. The removal grace period of
+// an active blockdevice is stopped. Sparse blockdevices are not recorded since
+// they are not detected by udev.
+func (c *Controller) recordBlockDevice(blockDevice *apis.BlockDevice) {
+	if blockDevice.Spec.Details.DeviceType == bd.SparseBlockDeviceType {
+		return
+	}
+	if blockDevice.Status.State == NDMActive {
+		c.cancelRemovalGrace(blockDevice.Name)
+	}
+	c.recordDrift(blockDevice)
+	c.journal.record(blockDevice.Name, blockDevice.Spec.Path, string(blockDevice.Status.State))
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.json")
+
+	journal := openJournal(path)
+	assert.Empty(t, journal.Devices)
+	journal.record("blockdevice-1", "/dev/sda", NDMActive)
+	journal.record("blockdevice-2", "/dev/sdb", NDMActive)
+	// recording an unchanged state does not increment the generation
+	journal.record("blockdevice-2", "/dev/sdb", NDMActive)
+	journal.record("blockdevice-1", "/dev/sda", NDMInactive)
+	journal.remove("blockdevice-2")
+
+	loaded := openJournal(path)
+	assert.Equal(t, int64(4), loaded.Generation)
+	assert.Equal(t, map[string]JournalEntry{
+		"blockdevice-1": {Path: "/dev/sda", State: NDMInactive, Generation: 3},
+	}, loaded.Devices)
+
+	// a corrupted journal is replaced with an empty journal
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded = openJournal(path)
+	assert.Equal(t, int64(0), loaded.Generation)
+	assert.Empty(t, loaded.Devices)
+}
+
+func TestDeactivateRemovedWhileDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.json")
+
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      CreateFakeClient(t),
+		journal:        openJournal(path),
+	}
+	for name, devPath := range map[string]string{
+		"blockdevice-removed": "/dev/sda",
+		"blockdevice-present": "/dev/sdb",
+	} {
+		assert.NoError(t, fakeController.CreateBlockDevice(newDriftBlockDevice(name, devPath, 1024, NDMActive)))
+	}
+
+	// the daemon restarts after /dev/sda was removed
+	fakeController.journal = openJournal(path)
+	fakeController.DeactivateStaleBlockDeviceResource([]string{"blockdevice-present"}, []string{"/dev/sdb"})
+
+	removed, err := fakeController.GetBlockDevice("blockdevice-removed")
+	assert.NoError(t, err)
+	assert.Equal(t, apis.BlockDeviceState(NDMInactive), removed.Status.State)
+	present, err := fakeController.GetBlockDevice("blockdevice-present")
+	assert.NoError(t, err)
+	assert.Equal(t, apis.BlockDeviceState(NDMActive), present.Status.State)
+	assert.Equal(t, NDMInactive, openJournal(path).Devices["blockdevice-removed"].State)
+
+	// the journal is reconciled only with the first scan after startup
+	assert.Nil(t, fakeController.journal.missingDevices(nil))
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+	"github.com/openebs/node-disk-manager/pkg/metrics/openmetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// metricsNamespace is the namespace of the metrics of the NDM daemon
+	metricsNamespace = "ndm"
+
+	// metricsPath is the path on which the metrics are served
+	metricsPath = "/metrics"
+
+	// DropReasonDeviceRate is used when the events of a device exceed the rate limit
+	DropReasonDeviceRate = "device_rate"
+	// DropReasonQueueFull is used when too many devices have pending events
+	DropReasonQueueFull = "queue_full"
+
+	// RetryReasonConflict is used when a write is retried after a conflict
+	RetryReasonConflict = "conflict"
+	// RetryReasonQueued is used when a write queued while the API server was
+	// unreachable is sent
+	RetryReasonQueued = "queued"
+	// ErrorReasonUnreachable is used when a request could not be sent to the API server
+	ErrorReasonUnreachable = "Unreachable"
+)
+
+// MetricsAddress is the address(ip:port) on which the metrics of the daemon are
+// served. The metrics are not served if it is empty.
+var MetricsAddress = ""
+
+// MetricsFilter is the config of the metric families and labels of the daemon
+// that are exposed. It is overridden by the metrics config in the ndm config.
+var MetricsFilter filter.Config
+
+// metricsGatherer gathers the served metrics using the filter created from the
+// config, which is replaced when the config is reloaded
+type metricsGatherer struct {
+	sync.RWMutex
+	gatherer prometheus.Gatherer
+}
+
+// Gather gathers the metrics using the current filter
+func (m *metricsGatherer) Gather() ([]*dto.MetricFamily, error) {
+	m.RLock()
+	gatherer := m.gatherer
+	m.RUnlock()
+	return gatherer.Gather()
+}
+
+// set replaces the filter of the gathered metrics
+func (m *metricsGatherer) set(gatherer prometheus.Gatherer) {
+	m.Lock()
+	defer m.Unlock()
+	m.gatherer = gatherer
+}
+
+// ApplyMetricsConfig creates the filter of the served metrics from MetricsFilter
+// and the metrics config in the ndm config. An error is returned if the filter
+// is invalid, in which case the current filter is kept.
+func ApplyMetricsConfig(c *Controller) error {
+	config := MetricsFilter
+	if ndmConfig := c.GetNDMConfig(); ndmConfig != nil {
+		config = ndmConfig.MetricsConfig.apply(config)
+	}
+	gatherer, err := filter.NewGatherer(metrics.Registry, config)
+	if err != nil {
+		return fmt.Errorf("invalid metrics filter: %v", err)
+	}
+	c.metricsGatherer.set(gatherer)
+	return nil
+}
+
+var (
+	// EventsDroppedTotal is the number of udev events dropped to protect the
+	// daemon from event storms
+	EventsDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "udev_events_dropped_total",
+			Help:      `No. of udev events dropped due to overload`,
+		},
+		[]string{"reason"},
+	)
+
+	// EventsReceivedTotal is the number of udev events of the devices received
+	// by the daemon, by the action of the event
+	EventsReceivedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "udev_events_received_total",
+			Help:      `No. of udev events of the devices received`,
+		},
+		[]string{"action"},
+	)
+
+	// EventsCoalescedTotal is the number of udev events that were merged into a
+	// pending event of the same device
+	EventsCoalescedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "udev_events_coalesced_total",
+			Help:      `No. of udev events merged into a pending event of the same device`,
+		},
+	)
+
+	// EventQueueDepth is the number of udev events waiting to be processed, either
+	// for the debounce window of the device or for the events ahead of them
+	EventQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "udev_event_queue_depth",
+			Help:      `No. of udev events waiting to be processed`,
+		},
+	)
+
+	// EventProcessingDuration is the time from the receipt of a udev event till the
+	// blockdevice resources are updated
+	EventProcessingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "udev_event_processing_duration_seconds",
+			Help:      `Time from the receipt of a udev event till the blockdevices are updated`,
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"action"},
+	)
+
+	// RescanDuration is the time from the start of a scan of all the devices till
+	// the blockdevices of all the devices are updated
+	RescanDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "rescan_duration_seconds",
+			Help:      `Time from the start of a scan of all the devices till the blockdevices are updated`,
+			Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		},
+	)
+
+	// DeviceProcessingDuration is the time taken to probe, filter and write the
+	// blockdevice of a device
+	DeviceProcessingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "device_processing_duration_seconds",
+			Help:      `Time taken to probe, filter and write the blockdevice of a device`,
+			Buckets:   []float64{0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"action"},
+	)
+
+	// ProbeDuration is the time taken by a probe to fill the details of a device
+	ProbeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "probe_duration_seconds",
+			Help:      `Time taken by a probe to fill the details of a device`,
+			Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30},
+		},
+		[]string{"probe"},
+	)
+
+	// APIRequestDuration is the time taken by the write requests to the API server
+	APIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_request_duration_seconds",
+			Help:      `Time taken by the write requests to the API server`,
+			Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+		[]string{"verb", "resource"},
+	)
+
+	// APIRequestErrorsTotal is the number of write requests to the API server that
+	// failed, by the reason of the failure. Throttling by the API server is
+	// reported with the reason TooManyRequests.
+	APIRequestErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_request_errors_total",
+			Help:      `No. of write requests to the API server that failed`,
+		},
+		[]string{"verb", "resource", "reason"},
+	)
+
+	// APIRequestRetriesTotal is the number of blockdevice writes that were retried
+	APIRequestRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_request_retries_total",
+			Help:      `No. of blockdevice writes retried after a failure`,
+		},
+		[]string{"reason"},
+	)
+
+	// StartupDriftTotal is the number of blockdevices that drifted from the devices
+	// on the node while the daemon was not running, reconciled on startup
+	StartupDriftTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "startup_drift_total",
+			Help:      `No. of blockdevices reconciled on startup, by the type of drift`,
+		},
+		[]string{"drift"},
+	)
+
+	// FilteredDevicesTotal is the number of times a device was excluded by a filter
+	FilteredDevicesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "filtered_devices_total",
+			Help:      `No. of times a device was excluded by the filter`,
+		},
+		[]string{"filter"},
+	)
+
+	// ProbeFailuresTotal is the number of times a probe failed to fill the
+	// details of a device
+	ProbeFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "probe_failures_total",
+			Help:      `No. of times the probe failed to fill the details of the device`,
+		},
+		[]string{"probe", "path"},
+	)
+
+	// BlockDevicesByState is the number of blockdevices of the node in each state,
+	// as last written by the daemon
+	BlockDevicesByState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "blockdevices",
+			Help:      `No. of blockdevices of the node in the state, as last written by the daemon`,
+		},
+		[]string{"state"},
+	)
+
+	// FeatureEnabled is the state of the feature gates of the daemon
+	FeatureEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "feature_enabled",
+			Help:      `State of the feature gates, 1 if the feature is enabled`,
+		},
+		[]string{"feature"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(EventsDroppedTotal, EventsReceivedTotal, EventsCoalescedTotal,
+		EventQueueDepth, FeatureEnabled,
+		EventProcessingDuration, ProbeDuration, APIRequestDuration, StartupDriftTotal,
+		FilteredDevicesTotal, ProbeFailuresTotal, BlockDevicesByState,
+		RescanDuration, DeviceProcessingDuration, APIRequestErrorsTotal, APIRequestRetriesTotal)
+}
+
+// serveMetrics serves the metrics and the devices on the node on MetricsAddress
+// till the stop channel is closed. In dry run mode, the blockdevices that would
+// have been written are also served.
+func (c *Controller) serveMetrics(stopCh <-chan struct{}) {
+	if len(MetricsAddress) == 0 {
+		return
+	}
+	if err := ApplyMetricsConfig(c); err != nil {
+		logger.Errorf("metrics not served, %v", err)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, openmetrics.HandlerFor(&c.metricsGatherer))
+	mux.HandleFunc(DevicesPath, c.devicesHandler)
+	if c.dryRun != nil {
+		mux.HandleFunc(dryRunPath, c.dryRun.dryRunHandler)
+	}
+	serveHTTP("metrics", MetricsAddress, mux, SecureServing, stopCh)
+}
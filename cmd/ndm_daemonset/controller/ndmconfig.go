@@ -17,11 +17,26 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
-	"k8s.io/klog"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
+	"github.com/openebs/node-disk-manager/pkg/logs"
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+	"github.com/openebs/node-disk-manager/pkg/tracing"
+	"github.com/openebs/node-disk-manager/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -36,6 +51,136 @@ type NodeDiskManagerConfig struct {
 	FilterConfigs []FilterConfig `json:"filterconfigs"` // FilterConfigs contains configs of Filters
 	// TagConfigs contains configs for tags
 	TagConfigs []TagConfig `json:"tagconfigs"`
+	// LogConfig contains the log level overrides of the modules
+	LogConfig *LogConfig `json:"logconfig,omitempty"`
+	// TracingConfig contains the config for exporting the traces of the events
+	TracingConfig *TracingConfig `json:"tracingconfig,omitempty"`
+	// NodeIdentity selects the identity of the node used in the blockdevices
+	NodeIdentity *NodeIdentityConfig `json:"nodeidentity,omitempty"`
+	// HealthThresholds contains the thresholds of the SMART metrics above which
+	// the blockdevices are marked as unhealthy
+	HealthThresholds *HealthThresholdsConfig `json:"healththresholds,omitempty"`
+	// FailurePrediction enables the scoring of the risk of failure of the devices
+	FailurePrediction *FailurePredictionConfig `json:"failureprediction,omitempty"`
+	// SparseConfig contains the sparse files created on the nodes
+	SparseConfig *SparseConfig `json:"sparseconfig,omitempty"`
+	// MetricsConfig contains the metric families and labels of the daemon that
+	// are exposed
+	MetricsConfig *MetricsConfig `json:"metricsconfig,omitempty"`
+}
+
+// SparseConfig contains the sparse files created on the nodes. It is used
+// instead of EnvSparseFiles, and is overridden on a node by the
+// NodeSparseFilesAnnotation of the node.
+type SparseConfig struct {
+	// Files are the groups of sparse files, in the format of EnvSparseFiles.
+	// The sparse files are disabled if empty.
+	Files string `json:"files"`
+}
+
+// MetricsConfig overrides the metrics filter flags of the daemon, eg:
+// --metrics-exclude. The fields that are not set use the values of the flags.
+type MetricsConfig struct {
+	Include        []string       `json:"include,omitempty"`
+	Exclude        []string       `json:"exclude,omitempty"`
+	DropLabels     []string       `json:"droplabels,omitempty"`
+	HashLabels     []string       `json:"hashlabels,omitempty"`
+	MaxDevices     *int           `json:"maxdevices,omitempty"`
+	MaxLabelValues map[string]int `json:"maxlabelvalues,omitempty"`
+}
+
+// apply returns the metrics filter config with the fields set in the metrics
+// config overridden
+func (m *MetricsConfig) apply(config filter.Config) filter.Config {
+	if m == nil {
+		return config
+	}
+	if m.Include != nil {
+		config.Include = m.Include
+	}
+	if m.Exclude != nil {
+		config.Exclude = m.Exclude
+	}
+	if m.DropLabels != nil {
+		config.DropLabels = m.DropLabels
+	}
+	if m.HashLabels != nil {
+		config.HashLabels = m.HashLabels
+	}
+	if m.MaxDevices != nil {
+		config.MaxDevices = *m.MaxDevices
+	}
+	if m.MaxLabelValues != nil {
+		config.MaxLabelValues = m.MaxLabelValues
+	}
+	return config
+}
+
+// HealthThresholdsConfig contains the warning and critical thresholds of the SMART
+// metrics of the devices. When a threshold is crossed, the HealthThresholdExceeded
+// condition is set on the blockdevice and a warning event is recorded.
+type HealthThresholdsConfig struct {
+	// Temperature is the current temperature of the device in celsius
+	Temperature *ThresholdConfig `json:"temperature,omitempty"`
+	// PercentEnduranceUsed is the percentage of the device life used
+	PercentEnduranceUsed *ThresholdConfig `json:"percentenduranceused,omitempty"`
+	// AvailableSpare is the percentage of the remaining spare capacity. Unlike
+	// the other metrics, the threshold is crossed when the value falls below it.
+	AvailableSpare *ThresholdConfig `json:"availablespare,omitempty"`
+	// FailureRisk is the risk of failure of the device between 0 and 1, scored
+	// from the SMART attributes if failure prediction is enabled
+	FailureRisk *ThresholdConfig `json:"failurerisk,omitempty"`
+}
+
+// FailurePredictionConfig enables the scoring of the risk of failure of the ATA
+// devices from the SMART attributes that are known to be reported before a disk
+// fails, eg: the reallocated and pending sectors
+type FailurePredictionConfig struct {
+	// Weights is the risk of failure of a device on which the indicator is not
+	// zero, keyed by the indicator. Defaults to the weights in the failurerisk
+	// package if empty.
+	Weights failurerisk.Weights `json:"weights,omitempty"`
+}
+
+// Score returns the risk of failure of the device from the failure indicators
+func (f *FailurePredictionConfig) Score(indicators map[string]uint64) float64 {
+	if len(f.Weights) == 0 {
+		return failurerisk.DefaultWeights.Score(indicators)
+	}
+	return f.Weights.Score(indicators)
+}
+
+// ThresholdConfig contains the warning and critical thresholds of a metric.
+// A threshold that is not set is not checked.
+type ThresholdConfig struct {
+	Warning  *float64 `json:"warning,omitempty"`
+	Critical *float64 `json:"critical,omitempty"`
+}
+
+// NodeIdentityConfig selects the identity of the node, which is used as the hostname
+// in the node attributes and the kubernetes.io/hostname label of the blockdevices.
+// The identity is applied on startup, and the existing blockdevices of the node are
+// relabelled with it.
+type NodeIdentityConfig struct {
+	// Source is one of hostname, nodename or label. Defaults to hostname.
+	Source string `json:"source"`
+	// Label is the label of the node used as the identity, if the source is label
+	Label string `json:"label,omitempty"`
+}
+
+// TracingConfig contains the config for exporting the traces of the processing
+// of the device events to an OpenTelemetry collector
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP traces endpoint of the collector, eg:
+	// http://otel-collector:4318/v1/traces. Tracing is disabled if empty.
+	Endpoint string `json:"endpoint"`
+}
+
+// LogConfig contains the log levels of the modules of the daemon
+type LogConfig struct {
+	// Modules is the log level of each module, used instead of the -v flag for
+	// the logs of that module. eg: probe: 4
+	Modules map[string]int `json:"modules"`
 }
 
 // ProbeConfig contains configs of Probe
@@ -43,6 +188,11 @@ type ProbeConfig struct {
 	Key   string `json:"key"`   // Key is key for each Probe
 	Name  string `json:"name"`  // Name is name of Probe
 	State string `json:"state"` // State is state of Probe
+	// Timeout is the maximum time the probe may take for a device, ProbeTimeout if empty
+	Timeout string `json:"timeout,omitempty"`
+	// FailureThreshold is the number of consecutive failures of the probe on a device
+	// after which it is skipped for the device, ProbeFailureThreshold if zero
+	FailureThreshold int `json:"failurethreshold,omitempty"`
 }
 
 // FilterConfig contains configs of Filter
@@ -61,27 +211,390 @@ type TagConfig struct {
 	TagName string `json:"tag"`
 }
 
+// tracingServiceName is the name of the service in the exported traces
+const tracingServiceName = "node-disk-manager"
+
+var (
+	// supportedProbeKeys are the keys of the probes that can be configured
+	supportedProbeKeys []string
+	// supportedFilterKeys are the keys of the filters that can be configured
+	supportedFilterKeys []string
+	// supportedTagTypes are the types of tags that can be configured
+	supportedTagTypes []string
+)
+
+// AddSupportedProbeKeys adds the keys of the probes that can be configured
+func AddSupportedProbeKeys(keys ...string) {
+	supportedProbeKeys = append(supportedProbeKeys, keys...)
+}
+
+// AddSupportedFilterKeys adds the keys of the filters that can be configured
+func AddSupportedFilterKeys(keys ...string) {
+	supportedFilterKeys = append(supportedFilterKeys, keys...)
+}
+
+// AddSupportedTagTypes adds the types of tags that can be configured
+func AddSupportedTagTypes(tagTypes ...string) {
+	supportedTagTypes = append(supportedTagTypes, tagTypes...)
+}
+
+// validateNDMConfig validates the values in the config. All the invalid values are
+// logged, and an error describing them is returned. The keys and tag types are
+// validated only if the supported values have been added.
+func validateNDMConfig(ndmConfig *NodeDiskManagerConfig) error {
+	var errs []string
+	invalid := func(field string, format string, args ...interface{}) {
+		msg := field + ": " + fmt.Sprintf(format, args...)
+		logger.Errorf("invalid ndm config, %s", msg)
+		errs = append(errs, msg)
+	}
+
+	probeKeys := make(map[string]bool)
+	for i, probeConfig := range ndmConfig.ProbeConfigs {
+		field := fmt.Sprintf("probeconfigs[%d]", i)
+		validateKey(field, probeConfig.Key, supportedProbeKeys, probeKeys, invalid)
+		validateState(field, probeConfig.State, invalid)
+	}
+
+	filterKeys := make(map[string]bool)
+	for i, filterConfig := range ndmConfig.FilterConfigs {
+		field := fmt.Sprintf("filterconfigs[%d]", i)
+		validateKey(field, filterConfig.Key, supportedFilterKeys, filterKeys, invalid)
+		validateState(field, filterConfig.State, invalid)
+	}
+
+	for i, tagConfig := range ndmConfig.TagConfigs {
+		field := fmt.Sprintf("tagconfigs[%d]", i)
+		if len(supportedTagTypes) != 0 && !util.Contains(supportedTagTypes, tagConfig.Type) {
+			invalid(field+".type", "unsupported type %q, must be one of %v", tagConfig.Type, supportedTagTypes)
+		}
+		if _, err := regexp.Compile(tagConfig.Pattern); err != nil {
+			invalid(field+".pattern", "invalid pattern %q: %v", tagConfig.Pattern, err)
+		}
+		if msgs := validation.IsValidLabelValue(tagConfig.TagName); len(tagConfig.TagName) == 0 || len(msgs) != 0 {
+			invalid(field+".tag", "invalid label value %q %v", tagConfig.TagName, msgs)
+		}
+	}
+
+	if ndmConfig.LogConfig != nil {
+		knownModules := logs.KnownModules()
+		for module, level := range ndmConfig.LogConfig.Modules {
+			field := "logconfig.modules." + module
+			if !util.Contains(knownModules, module) {
+				invalid(field, "unknown module %q, must be one of %v", module, knownModules)
+			}
+			if level < 0 || level > logs.MaxLogLevel {
+				invalid(field, "invalid level %d, must be between 0 and %d", level, logs.MaxLogLevel)
+			}
+		}
+	}
+
+	if ndmConfig.TracingConfig != nil && len(ndmConfig.TracingConfig.Endpoint) != 0 {
+		endpoint, err := url.Parse(ndmConfig.TracingConfig.Endpoint)
+		if err != nil {
+			invalid("tracingconfig.endpoint", "invalid endpoint: %v", err)
+		} else if (endpoint.Scheme != "http" && endpoint.Scheme != "https") || len(endpoint.Host) == 0 {
+			invalid("tracingconfig.endpoint", "invalid endpoint %q, must be a http or https url",
+				ndmConfig.TracingConfig.Endpoint)
+		}
+	}
+
+	if ndmConfig.NodeIdentity != nil {
+		source := ndmConfig.NodeIdentity.Source
+		if len(source) != 0 && !util.Contains(nodeIdentitySources, source) {
+			invalid("nodeidentity.source", "unknown source %q, must be one of %v", source, nodeIdentitySources)
+		}
+		label := ndmConfig.NodeIdentity.Label
+		if source == NodeIdentityLabel {
+			if msgs := validation.IsQualifiedName(label); len(msgs) != 0 {
+				invalid("nodeidentity.label", "invalid label %q %v", label, msgs)
+			}
+		} else if len(label) != 0 {
+			invalid("nodeidentity.label", "label can be set only if the source is %s", NodeIdentityLabel)
+		}
+	}
+
+	if ndmConfig.HealthThresholds != nil {
+		thresholds := ndmConfig.HealthThresholds
+		validateThreshold("healththresholds.temperature", thresholds.Temperature, 0, false, invalid)
+		validateThreshold("healththresholds.percentenduranceused", thresholds.PercentEnduranceUsed,
+			100, false, invalid)
+		validateThreshold("healththresholds.availablespare", thresholds.AvailableSpare, 100, true, invalid)
+		validateThreshold("healththresholds.failurerisk", thresholds.FailureRisk, 1, false, invalid)
+	}
+
+	if ndmConfig.FailurePrediction != nil {
+		if err := ndmConfig.FailurePrediction.Weights.Validate(); err != nil {
+			invalid("failureprediction.weights", "%v", err)
+		}
+	}
+
+	if ndmConfig.SparseConfig != nil && len(ndmConfig.SparseConfig.Files) != 0 {
+		if _, err := ParseSparseFiles(ndmConfig.SparseConfig.Files, os.Getenv(EnvSparseFileDir)); err != nil {
+			invalid("sparseconfig.files", "invalid sparse files %q: %v", ndmConfig.SparseConfig.Files, err)
+		}
+	}
+
+	if ndmConfig.MetricsConfig != nil {
+		if maxDevices := ndmConfig.MetricsConfig.MaxDevices; maxDevices != nil && *maxDevices < 0 {
+			invalid("metricsconfig.maxdevices", "invalid max devices %d, must not be negative", *maxDevices)
+		}
+		if err := ndmConfig.MetricsConfig.apply(MetricsFilter).Validate(); err != nil {
+			invalid("metricsconfig", "%v", err)
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// validateThreshold validates the thresholds of a metric. The thresholds must be
+// between 0 and max, unless max is 0, and the critical threshold must not be
+// crossed before the warning threshold.
+func validateThreshold(field string, threshold *ThresholdConfig, max float64, below bool,
+	invalid func(string, string, ...interface{})) {
+	if threshold == nil {
+		return
+	}
+	validateRange := func(name string, value *float64) {
+		if value != nil && max != 0 && (*value < 0 || *value > max) {
+			invalid(field+"."+name, "invalid threshold %v, must be between 0 and %v", *value, max)
+		}
+	}
+	validateRange("warning", threshold.Warning)
+	validateRange("critical", threshold.Critical)
+	if threshold.Warning == nil || threshold.Critical == nil {
+		return
+	}
+	if below && *threshold.Critical > *threshold.Warning {
+		invalid(field+".critical", "critical threshold %v must not be above the warning threshold %v",
+			*threshold.Critical, *threshold.Warning)
+	} else if !below && *threshold.Critical < *threshold.Warning {
+		invalid(field+".critical", "critical threshold %v must not be below the warning threshold %v",
+			*threshold.Critical, *threshold.Warning)
+	}
+}
+
+func validateKey(field, key string, supportedKeys []string, seen map[string]bool,
+	invalid func(string, string, ...interface{})) {
+	switch {
+	case len(key) == 0:
+		invalid(field+".key", "key is required")
+	case len(supportedKeys) != 0 && !util.Contains(supportedKeys, key):
+		invalid(field+".key", "unknown key %q, must be one of %v", key, supportedKeys)
+	case seen[key]:
+		invalid(field+".key", "duplicate key %q", key)
+	}
+	seen[key] = true
+}
+
+func validateState(field, state string, invalid func(string, string, ...interface{})) {
+	if !util.CheckTruthy(state) && !util.CheckFalsy(state) {
+		invalid(field+".state", "invalid state %q, must be true or false", state)
+	}
+}
+
+// ApplyLogConfig sets the log levels of the modules from the config. Modules
+// not present in the config use the verbosity set using the -v flag.
+func ApplyLogConfig(c *Controller) error {
+	var levels map[string]int
+	if ndmConfig := c.GetNDMConfig(); ndmConfig != nil && ndmConfig.LogConfig != nil {
+		levels = ndmConfig.LogConfig.Modules
+	}
+	if err := logs.SetModuleLevels(levels); err != nil {
+		return err
+	}
+	if len(levels) != 0 {
+		logger.Infof("log levels of modules set to %v", levels)
+	}
+	return nil
+}
+
+// ApplyTracingConfig enables the export of the traces of the events if an
+// endpoint is present in the config, else disables it
+func ApplyTracingConfig(c *Controller) error {
+	endpoint := ""
+	if ndmConfig := c.GetNDMConfig(); ndmConfig != nil && ndmConfig.TracingConfig != nil {
+		endpoint = ndmConfig.TracingConfig.Endpoint
+	}
+	tracing.Configure(tracing.Config{
+		Endpoint:    endpoint,
+		ServiceName: tracingServiceName,
+		Attributes: map[string]string{
+			"k8s.node.name": c.NodeAttributes[NodeNameKey],
+		},
+	})
+	if len(endpoint) != 0 {
+		logger.Infof("exporting traces to %s", endpoint)
+	}
+	return nil
+}
+
+// ConfigReloadInterval is the interval at which the config file is checked for changes
+var ConfigReloadInterval = 10 * time.Second
+
+// ConfigReloadHandler applies the reloaded config of the controller. An error
+// is returned if the config cannot be applied.
+type ConfigReloadHandler func(c *Controller) error
+
+// GetNDMConfig returns the current config of the controller. The returned
+// config is replaced, not modified, when the config is reloaded, so it can be
+// read without holding any lock.
+func (c *Controller) GetNDMConfig() *NodeDiskManagerConfig {
+	c.configLock.RLock()
+	defer c.configLock.RUnlock()
+	return c.NDMConfig
+}
+
+// setNDMConfig replaces the config of the controller
+func (c *Controller) setNDMConfig(ndmConfig *NodeDiskManagerConfig) {
+	c.configLock.Lock()
+	defer c.configLock.Unlock()
+	c.NDMConfig = ndmConfig
+}
+
 // SetNDMConfig sets config for probes and filters which user provides via configmap. If
 // no configmap present then ndm will load default config for each probes and filters.
-func (c *Controller) SetNDMConfig(opts NDMOptions) {
+// An error is returned if the config is invalid.
+func (c *Controller) SetNDMConfig(opts NDMOptions) error {
+	c.configFilePath = opts.ConfigFilePath
 	data, err := ioutil.ReadFile(opts.ConfigFilePath)
 	if err != nil {
-		c.NDMConfig = nil
-		klog.Error("unable to set ndm config : ", err)
-		return
+		c.setNDMConfig(nil)
+		logger.Errorf("unable to set ndm config : %v", err)
+		return nil
+	}
+	c.configData = data
+
+	ndmConfig, err := parseNDMConfig(data)
+	if err != nil {
+		c.setNDMConfig(nil)
+		logger.Errorf("unable to set ndm config : %v", err)
+		return fmt.Errorf("invalid config %s: %v", opts.ConfigFilePath, err)
 	}
 
+	c.setNDMConfig(ndmConfig)
+	return nil
+}
+
+// ValidateNDMConfigFile validates the config file at the given path
+func ValidateNDMConfigFile(path string) error {
+	_, err := ReadNDMConfigFile(path)
+	return err
+}
+
+// ReadNDMConfigFile reads and validates the config file at the given path
+func ReadNDMConfigFile(path string) (*NodeDiskManagerConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ndmConfig, err := parseNDMConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return ndmConfig, nil
+}
+
+// parseNDMConfig parses and validates the config, which can be in json or yaml
+// format. Unknown fields in the config are not allowed.
+func parseNDMConfig(data []byte) (*NodeDiskManagerConfig, error) {
 	var ndmConfig NodeDiskManagerConfig
+	var err error
 	if json.Valid(data) {
-		err = json.Unmarshal(data, &ndmConfig)
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&ndmConfig)
 	} else {
-		err = yaml.Unmarshal(data, &ndmConfig)
+		err = yaml.UnmarshalStrict(data, &ndmConfig, yaml.DisallowUnknownFields)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = validateNDMConfig(&ndmConfig); err != nil {
+		return nil, err
+	}
+	return &ndmConfig, nil
+}
+
+// AddConfigReloadHandler adds a handler that is called when the config is reloaded
+func (c *Controller) AddConfigReloadHandler(handler ConfigReloadHandler) {
+	c.configReloadHandlers = append(c.configReloadHandlers, handler)
+}
+
+// WatchNDMConfig checks the config file for changes till the stop channel is
+// closed, and reloads the config when it changes. The config file is polled,
+// since the file of a mounted configmap is replaced when the configmap changes.
+func (c *Controller) WatchNDMConfig(stopCh <-chan struct{}) {
+	if len(c.configFilePath) == 0 {
+		return
+	}
+	ticker := time.NewTicker(ConfigReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			c.ReloadNDMConfig()
+		}
 	}
+}
+
+// ReloadNDMConfig reloads the config file if it or the probe states of the node
+// have changed, and applies the config using the reload handlers. If the new config cannot be parsed or applied,
+// the last known good config is restored.
+func (c *Controller) ReloadNDMConfig() {
+	data, err := ioutil.ReadFile(c.configFilePath)
+	if err != nil {
+		logger.V(4).Infof("unable to read ndm config: %v", err)
+		return
+	}
+	nodeProbeStates := c.fetchNodeProbeStates()
+	if bytes.Equal(data, c.configData) && reflect.DeepEqual(nodeProbeStates, c.nodeProbeStates) {
+		return
+	}
+	// the config is not read again till it changes, even if it is invalid
+	c.configData = data
+	c.nodeProbeStates = nodeProbeStates
+
+	ndmConfig, err := parseNDMConfig(data)
 	if err != nil {
-		c.NDMConfig = nil
-		klog.Error("unable to set ndm config : ", err)
+		c.recordConfigReloadFailure(err)
 		return
 	}
+	ndmConfig = applyNodeProbeStates(ndmConfig, nodeProbeStates)
+
+	lastKnownGoodConfig := c.GetNDMConfig()
+	c.setNDMConfig(ndmConfig)
+	if err = c.applyNDMConfig(); err != nil {
+		logger.Warningf("restoring the last known good ndm config")
+		c.setNDMConfig(lastKnownGoodConfig)
+		if rollbackErr := c.applyNDMConfig(); rollbackErr != nil {
+			logger.Errorf("unable to restore the last known good ndm config: %v", rollbackErr)
+		}
+		c.recordConfigReloadFailure(err)
+		return
+	}
+
+	logger.Info("Reloaded ndm config", "eventcode", "ndm.config.reload.success")
+	c.NodeEventf(v1.EventTypeNormal, "ConfigReloaded", "Reloaded ndm config")
+}
+
+// applyNDMConfig calls all the reload handlers
+func (c *Controller) applyNDMConfig() error {
+	for _, handler := range c.configReloadHandlers {
+		if err := handler(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	c.NDMConfig = &ndmConfig
+func (c *Controller) recordConfigReloadFailure(err error) {
+	logger.Error(err, "Unable to reload ndm config", "eventcode", "ndm.config.reload.failure")
+	c.NodeEventf(v1.EventTypeWarning, "ConfigReloadFailed",
+		"Unable to reload ndm config, using the last known good config: %v", err)
 }
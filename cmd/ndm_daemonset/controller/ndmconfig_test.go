@@ -17,6 +17,7 @@ limitations under the License.
 package controller
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -138,3 +139,288 @@ filterconfigs:
 	err := ioutil.WriteFile(fpath, []byte(data), 0644)
 	assert.NoError(t, err)
 }
+
+func TestReloadNDMConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFilePath := dir + "/node-disk-manager.config"
+	writeConfig := func(state string) {
+		content := []byte(`probeconfigs:
+  - key: smart-probe
+    name: smart probe
+    state: ` + state + "\n")
+		if err := ioutil.WriteFile(configFilePath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("true")
+	fakeController := &Controller{}
+	fakeController.SetNDMConfig(NDMOptions{ConfigFilePath: configFilePath})
+	assert.Equal(t, "true", fakeController.NDMConfig.ProbeConfigs[0].State)
+
+	// the handler rejects configs which disable the probe using "no"
+	var applied []string
+	fakeController.AddConfigReloadHandler(func(c *Controller) error {
+		state := c.NDMConfig.ProbeConfigs[0].State
+		applied = append(applied, state)
+		if state == "no" {
+			return errors.New("unsupported state")
+		}
+		return nil
+	})
+
+	// unchanged config is not reloaded
+	fakeController.ReloadNDMConfig()
+	assert.Empty(t, applied)
+
+	// valid config is applied
+	writeConfig("false")
+	fakeController.ReloadNDMConfig()
+	assert.Equal(t, []string{"false"}, applied)
+	assert.Equal(t, "false", fakeController.NDMConfig.ProbeConfigs[0].State)
+
+	// config that cannot be parsed is not applied
+	if err := ioutil.WriteFile(configFilePath, []byte("probeconfigs: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fakeController.ReloadNDMConfig()
+	assert.Equal(t, []string{"false"}, applied)
+	assert.Equal(t, "false", fakeController.NDMConfig.ProbeConfigs[0].State)
+
+	// config that fails validation is not applied
+	writeConfig("maybe")
+	fakeController.ReloadNDMConfig()
+	assert.Equal(t, []string{"false"}, applied)
+	assert.Equal(t, "false", fakeController.NDMConfig.ProbeConfigs[0].State)
+
+	// config that cannot be applied is rolled back to the last known good config
+	writeConfig(`"no"`)
+	fakeController.ReloadNDMConfig()
+	assert.Equal(t, []string{"false", "no", "false"}, applied)
+	assert.Equal(t, "false", fakeController.NDMConfig.ProbeConfigs[0].State)
+}
+
+func TestApplyMetricsConfig(t *testing.T) {
+	gathered := func(c *Controller, name string) bool {
+		families, err := c.metricsGatherer.Gather()
+		assert.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == name {
+				return true
+			}
+		}
+		return false
+	}
+	family := "ndm_udev_events_coalesced_total"
+
+	c := &Controller{}
+	assert.NoError(t, ApplyMetricsConfig(c))
+	assert.True(t, gathered(c, family))
+
+	// the metrics config of the reloaded config is applied
+	c.NDMConfig = &NodeDiskManagerConfig{MetricsConfig: &MetricsConfig{Exclude: []string{family}}}
+	assert.NoError(t, ApplyMetricsConfig(c))
+	assert.False(t, gathered(c, family))
+
+	// an invalid metrics config is not applied
+	c.NDMConfig = &NodeDiskManagerConfig{MetricsConfig: &MetricsConfig{Include: []string{"ndm_("}}}
+	assert.Error(t, ApplyMetricsConfig(c))
+	assert.False(t, gathered(c, family))
+
+	// the flags are used when the metrics config is removed
+	c.NDMConfig = &NodeDiskManagerConfig{}
+	assert.NoError(t, ApplyMetricsConfig(c))
+	assert.True(t, gathered(c, family))
+}
+
+func TestParseNDMConfig(t *testing.T) {
+	supportedProbeKeys = []string{"udev-probe"}
+	supportedFilterKeys = []string{"path-filter"}
+	supportedTagTypes = []string{"path"}
+	defer func() {
+		supportedProbeKeys = nil
+		supportedFilterKeys = nil
+		supportedTagTypes = nil
+	}()
+
+	tests := map[string]struct {
+		config  string
+		wantErr []string
+	}{
+		"valid config": {
+			config: `
+probeconfigs:
+  - key: udev-probe
+    name: udev probe
+    state: true
+filterconfigs:
+  - key: path-filter
+    name: path filter
+    state: false
+    exclude: /dev/loop
+tagconfigs:
+  - name: outer disks
+    type: path
+    pattern: ^/dev/sd[a-z]$
+    tag: outer-disk
+logconfig:
+  modules:
+    controller: 4
+tracingconfig:
+  endpoint: http://otel-collector:4318/v1/traces
+nodeidentity:
+  source: label
+  label: topology.kubernetes.io/host
+healththresholds:
+  temperature:
+    warning: 60
+    critical: 70
+  availablespare:
+    warning: 20
+  failurerisk:
+    warning: 0.3
+    critical: 0.5
+failureprediction:
+  weights:
+    pending_sectors: 0.4
+sparseconfig:
+  files: 2x10Gi:/var/openebs/sparse
+metricsconfig:
+  exclude:
+    - ndm_probe_duration_seconds
+  maxdevices: 100
+`,
+		},
+		"invalid sparse and metrics config": {
+			config: `
+sparseconfig:
+  files: 2x:/var/openebs/sparse
+metricsconfig:
+  include:
+    - ndm_(
+  maxdevices: -1
+`,
+			wantErr: []string{
+				`sparseconfig.files: invalid sparse files "2x:/var/openebs/sparse"`,
+				`metricsconfig.maxdevices: invalid max devices -1, must not be negative`,
+				`metricsconfig: invalid metric family regex "ndm_("`,
+			},
+		},
+		"unknown field in yaml": {
+			config: `
+probeconfigs:
+  - key: udev-probe
+    name: udev probe
+    enabled: true
+`,
+			wantErr: []string{`unknown field "enabled"`},
+		},
+		"invalid node identity label": {
+			config: `
+nodeidentity:
+  source: nodename
+  label: kubernetes.io/hostname
+`,
+			wantErr: []string{`nodeidentity.label: label can be set only if the source is label`},
+		},
+		"invalid health thresholds": {
+			config: `
+healththresholds:
+  temperature:
+    warning: 70
+    critical: 60
+  percentenduranceused:
+    critical: 120
+  availablespare:
+    warning: 10
+    critical: 20
+`,
+			wantErr: []string{
+				`healththresholds.temperature.critical: critical threshold 60 must not be below the warning threshold 70`,
+				`healththresholds.percentenduranceused.critical: invalid threshold 120`,
+				`healththresholds.availablespare.critical: critical threshold 20 must not be above the warning threshold 10`,
+			},
+		},
+		"invalid failure prediction weights": {
+			config: `
+healththresholds:
+  failurerisk:
+    critical: 2
+failureprediction:
+  weights:
+    spin_retries: 0.2
+`,
+			wantErr: []string{
+				`healththresholds.failurerisk.critical: invalid threshold 2, must be between 0 and 1`,
+				`failureprediction.weights: unknown indicator "spin_retries"`,
+			},
+		},
+		"unknown field in json": {
+			config:  `{"probeconfig": []}`,
+			wantErr: []string{`unknown field "probeconfig"`},
+		},
+		"invalid yaml": {
+			config:  "probeconfigs: [\n",
+			wantErr: []string{"error converting YAML to JSON"},
+		},
+		"invalid values": {
+			config: `
+probeconfigs:
+  - key: udev-probe
+    state: maybe
+  - key: udev-probe
+    state: true
+  - key: unknown-probe
+    state: true
+filterconfigs:
+  - name: path filter
+    state: true
+tagconfigs:
+  - type: vendor
+    pattern: "["
+    tag: "not a label"
+logconfig:
+  modules:
+    unknown: 4
+    controller: 11
+tracingconfig:
+  endpoint: otel-collector:4318
+nodeidentity:
+  source: hostid
+`,
+			wantErr: []string{
+				`probeconfigs[0].state: invalid state "maybe"`,
+				`probeconfigs[1].key: duplicate key "udev-probe"`,
+				`probeconfigs[2].key: unknown key "unknown-probe"`,
+				`filterconfigs[0].key: key is required`,
+				`tagconfigs[0].type: unsupported type "vendor"`,
+				`tagconfigs[0].pattern: invalid pattern "["`,
+				`tagconfigs[0].tag: invalid label value "not a label"`,
+				`logconfig.modules.unknown: unknown module "unknown"`,
+				`logconfig.modules.controller: invalid level 11`,
+				`tracingconfig.endpoint: invalid endpoint "otel-collector:4318"`,
+				`nodeidentity.source: unknown source "hostid"`,
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ndmConfig, err := parseNDMConfig([]byte(test.config))
+			if len(test.wantErr) == 0 {
+				assert.NoError(t, err)
+				assert.NotNil(t, ndmConfig)
+				return
+			}
+			assert.Nil(t, ndmConfig)
+			if assert.Error(t, err) {
+				for _, msg := range test.wantErr {
+					assert.Contains(t, err.Error(), msg)
+				}
+			}
+		})
+	}
+}
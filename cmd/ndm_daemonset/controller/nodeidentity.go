@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NodeIdentityHostName uses the kubernetes.io/hostname label of the node as
+	// the identity, or the node name if the label is not present. This is the default.
+	NodeIdentityHostName = "hostname"
+	// NodeIdentityNodeName uses the name of the node resource as the identity
+	NodeIdentityNodeName = "nodename"
+	// NodeIdentityLabel uses the value of the configured label of the node as the identity
+	NodeIdentityLabel = "label"
+)
+
+// nodeIdentitySources are the supported sources of the node identity
+var nodeIdentitySources = []string{NodeIdentityHostName, NodeIdentityNodeName, NodeIdentityLabel}
+
+// getNodeIdentity returns the identity of the node, used as the hostname of the node
+// in the node attributes and in the kubernetes.io/hostname label of the blockdevices
+func getNodeIdentity(node *v1.Node, identity *NodeIdentityConfig) (string, error) {
+	source := NodeIdentityHostName
+	if identity != nil && len(identity.Source) != 0 {
+		source = identity.Source
+	}
+	switch source {
+	case NodeIdentityHostName:
+		// if the label is not present, or hostname is an empty string,
+		// use nodename as hostname
+		if hostName, ok := node.Labels[KubernetesHostNameLabel]; ok && hostName != "" {
+			return hostName, nil
+		}
+		return node.Name, nil
+	case NodeIdentityNodeName:
+		return node.Name, nil
+	case NodeIdentityLabel:
+		value, ok := node.Labels[identity.Label]
+		if !ok || value == "" {
+			return "", fmt.Errorf("node %s does not have the identity label %s", node.Name, identity.Label)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown node identity source %q", source)
+}
+
+// getNodeIdentities returns the identities of the node from all the sources. The
+// label source is used only if it is configured.
+func getNodeIdentities(node *v1.Node, identity *NodeIdentityConfig) []string {
+	identities := make([]string, 0)
+	sources := []*NodeIdentityConfig{
+		{Source: NodeIdentityHostName},
+		{Source: NodeIdentityNodeName},
+	}
+	if identity != nil && identity.Source == NodeIdentityLabel {
+		sources = append(sources, identity)
+	}
+	for _, source := range sources {
+		value, err := getNodeIdentity(node, source)
+		if err != nil || util.Contains(identities, value) {
+			continue
+		}
+		identities = append(identities, value)
+	}
+	return identities
+}
+
+// getUUIDHostName returns the hostname used in the UUIDs generated for the node,
+// e.g of the sparse blockdevices. It is the identity of the node from the default
+// source, so that the UUIDs do not change when the node identity source is changed.
+func (c *Controller) getUUIDHostName() string {
+	if len(c.uuidHostName) != 0 {
+		return c.uuidHostName
+	}
+	return c.NodeAttributes[HostNameKey]
+}
+
+// MigrateNodeIdentity updates the kubernetes.io/hostname label of the blockdevices
+// of this node, which were created with a different node identity. Only the
+// blockdevices labelled with the other identities of this node are listed, and
+// they are identified using the node name in their node attributes. The blockdevices
+// that could not be updated are logged, and an error is returned.
+func (c *Controller) MigrateNodeIdentity() error {
+	nodeName := c.NodeAttributes[NodeNameKey]
+	hostName := c.NodeAttributes[HostNameKey]
+	previousHostNames := make([]string, 0)
+	for _, identity := range c.nodeIdentities {
+		if identity != hostName {
+			previousHostNames = append(previousHostNames, identity)
+		}
+	}
+	if len(previousHostNames) == 0 {
+		return nil
+	}
+	requirement, err := labels.NewRequirement(KubernetesHostNameLabel, selection.In, previousHostNames)
+	if err != nil {
+		return fmt.Errorf("unable to list blockdevices for node identity migration: %v", err)
+	}
+	blockDeviceList := &apis.BlockDeviceList{}
+	err = c.Clientset.List(context.TODO(), blockDeviceList,
+		client.MatchingLabelsSelector{Selector: labels.NewSelector().Add(*requirement)})
+	if err != nil {
+		return fmt.Errorf("unable to list blockdevices for node identity migration: %v", err)
+	}
+	migrated, failed := 0, 0
+	for i := range blockDeviceList.Items {
+		blockDevice := &blockDeviceList.Items[i]
+		if blockDevice.Spec.NodeAttributes.NodeName != nodeName ||
+			blockDevice.Labels[KubernetesHostNameLabel] == hostName {
+			continue
+		}
+		blockDeviceCopy := blockDevice.DeepCopy()
+		if blockDeviceCopy.Labels == nil {
+			blockDeviceCopy.Labels = make(map[string]string)
+		}
+		blockDeviceCopy.Labels[KubernetesHostNameLabel] = hostName
+		err := c.Clientset.Patch(context.TODO(), blockDeviceCopy, client.MergeFrom(blockDevice))
+		if err != nil {
+			logger.Errorf("unable to migrate node identity of %s: %v", blockDevice.Name, err)
+			failed++
+			continue
+		}
+		logger.Infof("migrated %s label of %s from %q to %q", KubernetesHostNameLabel,
+			blockDevice.Name, blockDevice.Labels[KubernetesHostNameLabel], hostName)
+		migrated++
+	}
+	if migrated != 0 {
+		c.NodeEventf(v1.EventTypeNormal, "NodeIdentityMigrated",
+			"Updated %s label of %d blockdevices to %s", KubernetesHostNameLabel, migrated, hostName)
+	}
+	if failed != 0 {
+		return fmt.Errorf("unable to migrate node identity of %d blockdevices", failed)
+	}
+	return nil
+}
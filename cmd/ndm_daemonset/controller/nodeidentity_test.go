@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetNodeIdentity(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1.example.com",
+			Labels: map[string]string{
+				KubernetesHostNameLabel: "node1",
+				"example.com/host-id":   "host-1",
+			},
+		},
+	}
+	nodeWithoutHostName := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node2.example.com"},
+	}
+	tests := map[string]struct {
+		node     *v1.Node
+		identity *NodeIdentityConfig
+		want     string
+		wantErr  bool
+	}{
+		"default identity is the hostname label": {
+			node: node,
+			want: "node1",
+		},
+		"hostname falls back to node name": {
+			node:     nodeWithoutHostName,
+			identity: &NodeIdentityConfig{Source: NodeIdentityHostName},
+			want:     "node2.example.com",
+		},
+		"node name": {
+			node:     node,
+			identity: &NodeIdentityConfig{Source: NodeIdentityNodeName},
+			want:     "node1.example.com",
+		},
+		"label": {
+			node:     node,
+			identity: &NodeIdentityConfig{Source: NodeIdentityLabel, Label: "example.com/host-id"},
+			want:     "host-1",
+		},
+		"missing label": {
+			node:     nodeWithoutHostName,
+			identity: &NodeIdentityConfig{Source: NodeIdentityLabel, Label: "example.com/host-id"},
+			wantErr:  true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := getNodeIdentity(test.node, test.identity)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestGetNodeIdentities(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1.example.com",
+			Labels: map[string]string{
+				KubernetesHostNameLabel: "node1",
+				"example.com/host-id":   "host-1",
+			},
+		},
+	}
+	assert.Equal(t, []string{"node1", "node1.example.com"}, getNodeIdentities(node, nil))
+	assert.Equal(t, []string{"node1", "node1.example.com", "host-1"}, getNodeIdentities(node,
+		&NodeIdentityConfig{Source: NodeIdentityLabel, Label: "example.com/host-id"}))
+}
+
+func TestMigrateNodeIdentity(t *testing.T) {
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{
+			NodeNameKey: "node1.example.com",
+			HostNameKey: "node1.example.com",
+		},
+		Clientset:      CreateFakeClient(t),
+		nodeIdentities: []string{"node1", "node1.example.com"},
+	}
+	newBlockDevice := func(name, hostName, nodeName string) *apis.BlockDevice {
+		return &apis.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{KubernetesHostNameLabel: hostName},
+			},
+			Spec: apis.DeviceSpec{
+				NodeAttributes: apis.NodeAttribute{NodeName: nodeName},
+			},
+		}
+	}
+	for _, blockDevice := range []*apis.BlockDevice{
+		newBlockDevice("blockdevice-old-identity", "node1", "node1.example.com"),
+		newBlockDevice("blockdevice-new-identity", "node1.example.com", "node1.example.com"),
+		newBlockDevice("blockdevice-other-node", "node2", "node2.example.com"),
+		// blockdevices of other nodes having the same identity are not migrated
+		newBlockDevice("blockdevice-other-node-same-identity", "node1", "node3.example.com"),
+	} {
+		assert.NoError(t, fakeController.Clientset.Create(context.TODO(), blockDevice))
+	}
+
+	assert.NoError(t, fakeController.MigrateNodeIdentity())
+
+	for name, hostName := range map[string]string{
+		"blockdevice-old-identity":             "node1.example.com",
+		"blockdevice-new-identity":             "node1.example.com",
+		"blockdevice-other-node":               "node2",
+		"blockdevice-other-node-same-identity": "node1",
+	} {
+		blockDevice, err := fakeController.GetBlockDevice(name)
+		assert.NoError(t, err)
+		assert.Equal(t, hostName, blockDevice.Labels[KubernetesHostNameLabel], name)
+	}
+}
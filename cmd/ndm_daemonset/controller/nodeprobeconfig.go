@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// NDMProbeStatePrefix is the prefix of the node labels and annotations used to
+	// enable or disable a probe only on that node. eg: to disable the seachest probe
+	// on a node, the node is labelled with probe.ndm.io/seachest-probe=false
+	NDMProbeStatePrefix = "probe.ndm.io/"
+)
+
+// getNodeProbeStates gets the state of the probes from the labels and annotations
+// of the node. If a probe is set in both, the annotation is used. Invalid states
+// and unknown probes are ignored.
+func getNodeProbeStates(node *v1.Node) map[string]string {
+	probeStates := make(map[string]string)
+	for _, values := range []map[string]string{node.Labels, node.Annotations} {
+		for key, state := range values {
+			if !strings.HasPrefix(key, NDMProbeStatePrefix) {
+				continue
+			}
+			probeKey := strings.TrimPrefix(key, NDMProbeStatePrefix)
+			if len(supportedProbeKeys) != 0 && !util.Contains(supportedProbeKeys, probeKey) {
+				logger.Warningf("ignoring %s on node %s, unknown probe %s", key, node.Name, probeKey)
+				continue
+			}
+			if !util.CheckTruthy(state) && !util.CheckFalsy(state) {
+				logger.Warningf("ignoring %s on node %s, invalid state %q", key, node.Name, state)
+				continue
+			}
+			probeStates[probeKey] = state
+		}
+	}
+	return probeStates
+}
+
+// fetchNodeProbeStates gets the state of the probes set on the node in which
+// the daemon is running. The last fetched states are returned if the node
+// cannot be fetched.
+func (c *Controller) fetchNodeProbeStates() map[string]string {
+	nodeName := c.NodeAttributes[NodeNameKey]
+	if c.Clientset == nil || len(nodeName) == 0 {
+		return c.nodeProbeStates
+	}
+	node := &v1.Node{}
+	err := c.Clientset.Get(context.TODO(), client.ObjectKey{Namespace: "", Name: nodeName}, node)
+	if err != nil {
+		logger.Errorf("unable to get probe states of node %s: %v", nodeName, err)
+		return c.nodeProbeStates
+	}
+	return getNodeProbeStates(node)
+}
+
+// setNodeProbeStates applies the probe states of the node to the config
+func (c *Controller) setNodeProbeStates() {
+	c.nodeProbeStates = c.fetchNodeProbeStates()
+	c.setNDMConfig(applyNodeProbeStates(c.GetNDMConfig(), c.nodeProbeStates))
+}
+
+// applyNodeProbeStates overrides the state of the probes in the config with the
+// probe states of the node. Probes which are not present in the config are added
+// to it, so that the default state of the probe is also overridden. The given
+// config is not modified, a copy of it is returned.
+func applyNodeProbeStates(config *NodeDiskManagerConfig, probeStates map[string]string) *NodeDiskManagerConfig {
+	if len(probeStates) == 0 {
+		return config
+	}
+	ndmConfig := &NodeDiskManagerConfig{}
+	if config != nil {
+		*ndmConfig = *config
+		ndmConfig.ProbeConfigs = append([]ProbeConfig(nil), config.ProbeConfigs...)
+	}
+	applied := make(map[string]bool)
+	for i := range ndmConfig.ProbeConfigs {
+		probeConfig := &ndmConfig.ProbeConfigs[i]
+		if state, ok := probeStates[probeConfig.Key]; ok {
+			probeConfig.State = state
+			applied[probeConfig.Key] = true
+		}
+	}
+	for key, state := range probeStates {
+		if !applied[key] {
+			ndmConfig.ProbeConfigs = append(ndmConfig.ProbeConfigs, ProbeConfig{
+				Key:   key,
+				Name:  key,
+				State: state,
+			})
+		}
+		logger.Infof("probe %s state set to %s by node label/annotation", key, state)
+	}
+	return ndmConfig
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetNodeProbeStates(t *testing.T) {
+	supportedProbeKeys = []string{"seachest-probe", "smart-probe", "mount-probe"}
+	defer func() {
+		supportedProbeKeys = nil
+	}()
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+			Labels: map[string]string{
+				"probe.ndm.io/seachest-probe": "false",
+				"probe.ndm.io/smart-probe":    "false",
+				"probe.ndm.io/unknown-probe":  "false",
+				"kubernetes.io/hostname":      "node1",
+			},
+			Annotations: map[string]string{
+				"probe.ndm.io/smart-probe": "true",
+				"probe.ndm.io/mount-probe": "maybe",
+			},
+		},
+	}
+	expected := map[string]string{
+		"seachest-probe": "false",
+		"smart-probe":    "true",
+	}
+	assert.Equal(t, expected, getNodeProbeStates(node))
+}
+
+func TestApplyNodeProbeStates(t *testing.T) {
+	// no config is present
+	assert.Nil(t, applyNodeProbeStates(nil, map[string]string{}))
+	assert.Equal(t, &NodeDiskManagerConfig{
+		ProbeConfigs: []ProbeConfig{
+			{Key: "seachest-probe", Name: "seachest-probe", State: "false"},
+		},
+	}, applyNodeProbeStates(nil, map[string]string{"seachest-probe": "false"}))
+
+	// state in the config is overridden
+	ndmConfig := &NodeDiskManagerConfig{
+		ProbeConfigs: []ProbeConfig{
+			{Key: "seachest-probe", Name: "seachest probe", State: "true"},
+			{Key: "smart-probe", Name: "smart probe", State: "true"},
+		},
+	}
+	expected := &NodeDiskManagerConfig{
+		ProbeConfigs: []ProbeConfig{
+			{Key: "seachest-probe", Name: "seachest probe", State: "false"},
+			{Key: "smart-probe", Name: "smart probe", State: "true"},
+		},
+	}
+	assert.Equal(t, expected, applyNodeProbeStates(ndmConfig, map[string]string{"seachest-probe": "false"}))
+}
+
+func TestSetNodeProbeStates(t *testing.T) {
+	fakeClient := CreateFakeClient(t)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node1",
+			Labels: map[string]string{
+				"probe.ndm.io/seachest-probe": "false",
+			},
+		},
+	}
+	if err := fakeClient.Create(context.TODO(), node); err != nil {
+		t.Fatal(err)
+	}
+
+	fakeController := &Controller{
+		Clientset:      fakeClient,
+		NodeAttributes: map[string]string{NodeNameKey: "node1"},
+	}
+	fakeController.setNodeProbeStates()
+	assert.Equal(t, map[string]string{"seachest-probe": "false"}, fakeController.nodeProbeStates)
+	assert.Equal(t, "false", fakeController.NDMConfig.ProbeConfigs[0].State)
+
+	// probe states of the last fetch are used if the node cannot be fetched
+	fakeController.NodeAttributes[NodeNameKey] = "node2"
+	assert.Equal(t, map[string]string{"seachest-probe": "false"}, fakeController.fetchNodeProbeStates())
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ManagedByLabel is the recommended kubernetes label to identify the tool
+	// managing a resource. GitOps tools use it to skip resources they do not own.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the value of ManagedByLabel on the resources created by NDM
+	ManagedByValue = "node-disk-manager"
+)
+
+// BlockDeviceNamespace is the namespace in which the blockdevices are created.
+// If empty, the namespace in which NDM is installed is used.
+var BlockDeviceNamespace string
+
+// NodeOwnerReference sets the node on which the device is attached as the owner
+// of the blockdevice. The blockdevices are garbage collected when the node is
+// deleted, and are not pruned by GitOps tools which skip owned resources.
+var NodeOwnerReference = false
+
+// nodeOwner is the node on which the daemon is running
+type nodeOwner struct {
+	name string
+	uid  types.UID
+}
+
+// setOwnerReference sets the node as the owner of the blockdevice, if enabled
+func (c *Controller) setOwnerReference(blockDevice *apis.BlockDevice) {
+	if !NodeOwnerReference || c.nodeOwner.uid == "" {
+		return
+	}
+	for _, ref := range blockDevice.OwnerReferences {
+		if ref.UID == c.nodeOwner.uid {
+			return
+		}
+	}
+	blockDevice.OwnerReferences = append(blockDevice.OwnerReferences, metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       c.nodeOwner.name,
+		UID:        c.nodeOwner.uid,
+	})
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetOwnerReference(t *testing.T) {
+	nodeRef := metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       fakeHostName,
+		UID:        "node-uid",
+	}
+	tests := map[string]struct {
+		enabled bool
+		refs    []metav1.OwnerReference
+		want    []metav1.OwnerReference
+	}{
+		"owner reference disabled": {
+			enabled: false,
+			refs:    nil,
+			want:    nil,
+		},
+		"owner reference is set": {
+			enabled: true,
+			refs:    nil,
+			want:    []metav1.OwnerReference{nodeRef},
+		},
+		"owner reference is already set": {
+			enabled: true,
+			refs:    []metav1.OwnerReference{nodeRef},
+			want:    []metav1.OwnerReference{nodeRef},
+		},
+	}
+	defer func() { NodeOwnerReference = false }()
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			NodeOwnerReference = test.enabled
+			c := &Controller{nodeOwner: nodeOwner{name: fakeHostName, uid: "node-uid"}}
+			bd := &apis.BlockDevice{}
+			bd.OwnerReferences = test.refs
+			c.setOwnerReference(bd)
+			assert.Equal(t, test.want, bd.OwnerReferences)
+		})
+	}
+}
@@ -17,22 +17,29 @@ limitations under the License.
 package controller
 
 import (
+	"context"
 	"sort"
+	"time"
 
 	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/logs"
+	"github.com/openebs/node-disk-manager/pkg/metrics/openmetrics"
+	"github.com/openebs/node-disk-manager/pkg/tracing"
 	"github.com/openebs/node-disk-manager/pkg/util"
-
-	"k8s.io/klog"
 )
 
 // EventMessage struct contains attribute of event message info.
 type EventMessage struct {
-	Action  string                     // Action is event action like attach/detach
-	Devices []*blockdevice.BlockDevice // list of block device details
+	Action          string                     // Action is event action like attach/detach
+	Devices         []*blockdevice.BlockDevice // list of block device details
+	AllBlockDevices bool                       // If true, Devices contains all the block devices on the node
+	ReceivedAt      time.Time                  // Time at which the udev event was received, zero if not from an event
+	ScanStartedAt   time.Time                  // Time at which the scan of the devices started, zero if not from a scan
 }
 
 // Probe contains name, state and probeinterface
 type Probe struct {
+	Key       string
 	Priority  int
 	Name      string
 	State     bool
@@ -82,7 +89,33 @@ func (c *Controller) AddNewProbe(probe *Probe) {
 	probes = append(probes, probe)
 	sort.Sort(sortableProbes(probes))
 	c.Probes = probes
-	klog.Info("configured ", probe.Name, " : state ", util.StateStatus(probe.State))
+	logger.Infof("configured %v : state %v", probe.Name, util.StateStatus(probe.State))
+}
+
+// GetProbe returns the registered probe having the given key, nil if
+// no such probe is registered
+func (c *Controller) GetProbe(key string) *Probe {
+	c.Lock()
+	defer c.Unlock()
+	for _, probe := range c.Probes {
+		if probe.Key == key {
+			return probe
+		}
+	}
+	return nil
+}
+
+// SetProbeState enables or disables the registered probe having the given key
+func (c *Controller) SetProbeState(key string, state bool) {
+	c.Lock()
+	defer c.Unlock()
+	for _, probe := range c.Probes {
+		if probe.Key == key {
+			probe.State = state
+			logger.Infof("reconfigured %v : state %v", probe.Name, util.StateStatus(state))
+			return
+		}
+	}
 }
 
 // ListProbe returns list of active probe associated with controller object
@@ -98,12 +131,70 @@ func (c *Controller) ListProbe() []*Probe {
 	return listProbe
 }
 
+// ListAllProbes returns all the registered probes, including the disabled probes
+func (c *Controller) ListAllProbes() []*Probe {
+	c.Lock()
+	defer c.Unlock()
+	return append(make([]*Probe, 0, len(c.Probes)), c.Probes...)
+}
+
 // FillBlockDeviceDetails lists registered probes and fills details from each probe
 func (c *Controller) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
+	c.FillBlockDeviceDetailsWithContext(context.Background(), blockDevice)
+}
+
+// FillBlockDeviceDetailsWithContext fills details from each probe, tracing each
+// probe as a child of the span in the context
+func (c *Controller) FillBlockDeviceDetailsWithContext(ctx context.Context, blockDevice *blockdevice.BlockDevice) {
+	c.fillBlockDeviceDetails(ctx, blockDevice, c.ListProbe())
+}
+
+// FillBlockDeviceDetailsFromProbes fills details only from the registered probes
+// with the given names. It is used when only some details of the device need to be
+// refreshed. The probes are traced as children of the span in the context.
+func (c *Controller) FillBlockDeviceDetailsFromProbes(ctx context.Context, blockDevice *blockdevice.BlockDevice,
+	names ...string) {
+	probes := make([]*Probe, 0)
+	for _, probe := range c.ListProbe() {
+		for _, name := range names {
+			if probe.Name == name {
+				probes = append(probes, probe)
+				break
+			}
+		}
+	}
+	c.fillBlockDeviceDetails(ctx, blockDevice, probes)
+}
+
+func (c *Controller) fillBlockDeviceDetails(ctx context.Context, blockDevice *blockdevice.BlockDevice, probes []*Probe) {
 	blockDevice.NodeAttributes = c.NodeAttributes
-	probes := c.ListProbe()
+	blockDevice.Status.SkippedProbes = nil
+	breaker := c.getProbeCircuitBreaker()
+	deviceLogger := logger.WithValues(logs.PathKey, blockDevice.DevPath,
+		logs.NodeKey, c.NodeAttributes[NodeNameKey])
 	for _, probe := range probes {
-		probe.FillBlockDeviceDetails(blockDevice)
-		klog.Info("details filled by ", probe.Name)
+		probeLogger := deviceLogger.WithValues(logs.ProbeKey, probe.Name)
+		if !breaker.allow(probe.Name, blockDevice.DevPath) {
+			probeLogger.Warning("skipping probe, too many failures")
+			blockDevice.Status.SkippedProbes = append(blockDevice.Status.SkippedProbes, probe.Name)
+			continue
+		}
+		_, span := tracing.StartSpan(ctx, "probe")
+		span.SetAttribute(tracing.ProbeNameKey, probe.Name)
+		span.SetAttribute(tracing.DevicePathKey, blockDevice.DevPath)
+		start := time.Now()
+		timeout, threshold := c.getProbeLimits(probe)
+		err := breaker.fillBlockDeviceDetailsWithTimeout(probe, blockDevice, timeout)
+		openmetrics.ObserveWithTraceID(ProbeDuration.WithLabelValues(probe.Name),
+			time.Since(start).Seconds(), span.TraceID())
+		span.RecordError(err)
+		span.End()
+		breaker.record(probe.Name, blockDevice.DevPath, threshold, err)
+		if err != nil {
+			ProbeFailuresTotal.WithLabelValues(probe.Name, blockDevice.DevPath).Inc()
+			probeLogger.Error(err, "failed to fill details")
+			continue
+		}
+		probeLogger.Info("details filled")
 	}
 }
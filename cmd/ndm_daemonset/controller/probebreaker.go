@@ -0,0 +1,221 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+)
+
+var (
+	// ProbeTimeout is the maximum time a probe is allowed to take for
+	// filling the details of a single blockdevice, unless the timeout of
+	// the probe is set in its probe config.
+	ProbeTimeout = 30 * time.Second
+
+	// ProbeFailureThreshold is the number of consecutive failures of a probe
+	// on a device after which the probe is skipped for that device, unless the
+	// failure threshold of the probe is set in its probe config.
+	ProbeFailureThreshold = 3
+
+	// ProbeCooldownPeriod is the time for which a probe is skipped for a device
+	// once the failure threshold is reached. After this period, the probe is
+	// tried once again on the device.
+	ProbeCooldownPeriod = 5 * time.Minute
+)
+
+// probeFailure tracks the failures of a probe on a single device
+type probeFailure struct {
+	count     int
+	openUntil time.Time
+}
+
+// probeCircuitBreaker keeps track of probe failures on each device and
+// decides whether a probe should be run on a device.
+type probeCircuitBreaker struct {
+	sync.Mutex
+	cooldown time.Duration
+	failures map[string]*probeFailure
+	// running are the probes which are running on a device, including the
+	// ones which timed out and have not returned yet
+	running map[string]bool
+	// now is used to get the current time, can be replaced in tests
+	now func() time.Time
+}
+
+// newProbeCircuitBreaker creates a circuit breaker with the given cooldown period
+func newProbeCircuitBreaker(cooldown time.Duration) *probeCircuitBreaker {
+	return &probeCircuitBreaker{
+		cooldown: cooldown,
+		failures: make(map[string]*probeFailure),
+		running:  make(map[string]bool),
+		now:      time.Now,
+	}
+}
+
+func breakerKey(probeName, devPath string) string {
+	return probeName + "/" + devPath
+}
+
+// allow returns true if the probe can be run on the device, i.e the circuit is
+// either closed or the cooldown period has expired.
+func (cb *probeCircuitBreaker) allow(probeName, devPath string) bool {
+	cb.Lock()
+	defer cb.Unlock()
+	f, ok := cb.failures[breakerKey(probeName, devPath)]
+	if !ok {
+		return true
+	}
+	return !cb.now().Before(f.openUntil)
+}
+
+// record updates the failure count of the probe on the device based on the
+// result of the probe. A successful run resets the failure count, and the probe
+// is skipped once the failure count reaches the threshold.
+func (cb *probeCircuitBreaker) record(probeName, devPath string, threshold int, err error) {
+	cb.Lock()
+	defer cb.Unlock()
+	key := breakerKey(probeName, devPath)
+	if err == nil {
+		delete(cb.failures, key)
+		return
+	}
+	f, ok := cb.failures[key]
+	if !ok {
+		f = &probeFailure{}
+		cb.failures[key] = f
+	}
+	f.count++
+	if f.count >= threshold {
+		f.openUntil = cb.now().Add(cb.cooldown)
+		logger.Warningf("%s failed %d times on %s, skipping it till %s",
+			probeName, f.count, devPath, f.openUntil.Format(time.RFC3339))
+	}
+}
+
+// getProbeCircuitBreaker returns the circuit breaker of the controller,
+// creating it if required
+func (c *Controller) getProbeCircuitBreaker() *probeCircuitBreaker {
+	c.Lock()
+	defer c.Unlock()
+	if c.probeBreaker == nil {
+		c.probeBreaker = newProbeCircuitBreaker(ProbeCooldownPeriod)
+	}
+	return c.probeBreaker
+}
+
+// getProbeLimits returns the timeout and the failure threshold of the probe, from
+// its probe config if set, or else ProbeTimeout and ProbeFailureThreshold
+func (c *Controller) getProbeLimits(probe *Probe) (time.Duration, int) {
+	timeout, threshold := ProbeTimeout, ProbeFailureThreshold
+	ndmConfig := c.GetNDMConfig()
+	if ndmConfig == nil {
+		return timeout, threshold
+	}
+	for _, probeConfig := range ndmConfig.ProbeConfigs {
+		if probeConfig.Key != probe.Key {
+			continue
+		}
+		if len(probeConfig.Timeout) != 0 {
+			configured, err := time.ParseDuration(probeConfig.Timeout)
+			if err != nil || configured <= 0 {
+				logger.Warningf("invalid timeout %q of %s, using %v", probeConfig.Timeout, probe.Name, timeout)
+			} else {
+				timeout = configured
+			}
+		}
+		if probeConfig.FailureThreshold > 0 {
+			threshold = probeConfig.FailureThreshold
+		}
+	}
+	return timeout, threshold
+}
+
+// start marks the probe as running on the device. It returns false if the probe
+// is still running on the device, eg: from an earlier scan in which it timed out.
+func (cb *probeCircuitBreaker) start(probeName, devPath string) bool {
+	cb.Lock()
+	defer cb.Unlock()
+	key := breakerKey(probeName, devPath)
+	if cb.running[key] {
+		return false
+	}
+	cb.running[key] = true
+	return true
+}
+
+// finish marks the probe as no longer running on the device
+func (cb *probeCircuitBreaker) finish(probeName, devPath string) {
+	cb.Lock()
+	defer cb.Unlock()
+	delete(cb.running, breakerKey(probeName, devPath))
+}
+
+// fillBlockDeviceDetailsWithTimeout runs the probe on a deep copy of the blockdevice
+// and waits for it to complete within the timeout. The details are copied back
+// only if the probe completes successfully. The copy shares no maps or slices with
+// the blockdevice, and is discarded on timeout, so that a hung probe cannot modify
+// the blockdevice after it has been abandoned. The probe cannot be stopped once it
+// has timed out, so it is not run again on the device till it returns, and every
+// scan till then fails, so that the breaker opens instead of piling up probes on
+// a stuck device. The result of the timed out run is discarded.
+func (cb *probeCircuitBreaker) fillBlockDeviceDetailsWithTimeout(probe *Probe, blockDevice *blockdevice.BlockDevice,
+	timeout time.Duration) error {
+	devPath := blockDevice.DevPath
+	if !cb.start(probe.Name, devPath) {
+		return fmt.Errorf("%s is still running since an earlier timeout", probe.Name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	probedDevice := blockDevice.DeepCopy()
+	done := make(chan error, 1)
+	go func() {
+		err := runProbe(probe, probedDevice)
+		// the probe is marked as finished before the result is sent, so that it
+		// can be run again as soon as the result is received
+		cb.finish(probe.Name, devPath)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		*blockDevice = *probedDevice
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s timed out after %v", probe.Name, timeout)
+	}
+}
+
+// runProbe fills the details of the blockdevice using the probe, returning an error if
+// the probe panics
+func runProbe(probe *Probe, blockDevice *blockdevice.BlockDevice) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s panicked: %v", probe.Name, r)
+		}
+	}()
+	probe.FillBlockDeviceDetails(blockDevice)
+	return nil
+}
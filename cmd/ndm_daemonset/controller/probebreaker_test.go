@@ -0,0 +1,134 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hungProbe struct {
+	release chan struct{}
+	calls   int32
+}
+
+func (hp *hungProbe) Start() {}
+
+func (hp *hungProbe) FillBlockDeviceDetails(blockDevice *bd.BlockDevice) {
+	atomic.AddInt32(&hp.calls, 1)
+	<-hp.release
+	blockDevice.DeviceAttributes.Model = "hung-model"
+	blockDevice.Labels["hung"] = "true"
+}
+
+func TestProbeCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := newProbeCircuitBreaker(time.Minute)
+	cb.now = func() time.Time { return now }
+
+	assert.True(t, cb.allow("smart probe", "/dev/sda"))
+
+	cb.record("smart probe", "/dev/sda", 2, fmt.Errorf("timed out"))
+	assert.True(t, cb.allow("smart probe", "/dev/sda"))
+
+	cb.record("smart probe", "/dev/sda", 2, fmt.Errorf("timed out"))
+	assert.False(t, cb.allow("smart probe", "/dev/sda"))
+	// other devices and probes are not affected
+	assert.True(t, cb.allow("smart probe", "/dev/sdb"))
+	assert.True(t, cb.allow("udev probe", "/dev/sda"))
+
+	// after cooldown, the probe is allowed again
+	now = now.Add(2 * time.Minute)
+	assert.True(t, cb.allow("smart probe", "/dev/sda"))
+
+	// a failure after cooldown opens the circuit immediately
+	cb.record("smart probe", "/dev/sda", 2, fmt.Errorf("timed out"))
+	assert.False(t, cb.allow("smart probe", "/dev/sda"))
+
+	// success resets the state
+	now = now.Add(2 * time.Minute)
+	cb.record("smart probe", "/dev/sda", 2, nil)
+	cb.record("smart probe", "/dev/sda", 2, fmt.Errorf("timed out"))
+	assert.True(t, cb.allow("smart probe", "/dev/sda"))
+}
+
+func TestFillBlockDeviceDetailsWithHungProbe(t *testing.T) {
+	hp := &hungProbe{release: make(chan struct{})}
+	defer close(hp.release)
+	ctrl := &Controller{
+		Mutex: &sync.Mutex{},
+		NDMConfig: &NodeDiskManagerConfig{
+			ProbeConfigs: []ProbeConfig{{Key: "hung-probe", Timeout: "10ms", FailureThreshold: 1}},
+		},
+		Probes: []*Probe{
+			{Key: "hung-probe", Priority: 1, Name: "hung probe", State: true, Interface: hp},
+			{Priority: 2, Name: "fake probe", State: true, Interface: &fakeProbe{}},
+		},
+	}
+
+	blockDevice := &bd.BlockDevice{Labels: map[string]string{}}
+	blockDevice.DevPath = "/dev/sda"
+
+	// first run, the hung probe times out, other probes are still run
+	ctrl.FillBlockDeviceDetails(blockDevice)
+	assert.Equal(t, fakeModel, blockDevice.DeviceAttributes.Model)
+	assert.Empty(t, blockDevice.Status.SkippedProbes)
+
+	// second run, the hung probe is skipped
+	ctrl.FillBlockDeviceDetails(blockDevice)
+	assert.Equal(t, []string{"hung probe"}, blockDevice.Status.SkippedProbes)
+	assert.Equal(t, fakeModel, blockDevice.DeviceAttributes.Model)
+
+	di := ctrl.NewDeviceInfoFromBlockDevice(blockDevice)
+	status := di.ToDevice().Status
+	assert.NotNil(t, status.GetCondition("ProbeSkipped"))
+}
+
+func TestFillBlockDeviceDetailsWithStuckProbe(t *testing.T) {
+	hp := &hungProbe{release: make(chan struct{})}
+	probe := &Probe{Name: "hung probe", Interface: hp}
+	cb := newProbeCircuitBreaker(time.Minute)
+	blockDevice := &bd.BlockDevice{Labels: map[string]string{}}
+	blockDevice.DevPath = "/dev/sda"
+
+	assert.EqualError(t, cb.fillBlockDeviceDetailsWithTimeout(probe, blockDevice, 10*time.Millisecond),
+		"hung probe timed out after 10ms")
+	// the probe is not run again while the earlier run is stuck
+	assert.EqualError(t, cb.fillBlockDeviceDetailsWithTimeout(probe, blockDevice, 10*time.Millisecond),
+		"hung probe is still running since an earlier timeout")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hp.calls))
+
+	// the result of the timed out run is discarded once it returns
+	close(hp.release)
+	assert.Eventually(t, func() bool {
+		cb.Lock()
+		defer cb.Unlock()
+		return !cb.running[breakerKey(probe.Name, blockDevice.DevPath)]
+	}, time.Second, time.Millisecond)
+	assert.Empty(t, blockDevice.DeviceAttributes.Model)
+
+	assert.NoError(t, cb.fillBlockDeviceDetailsWithTimeout(probe, blockDevice, time.Second))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hp.calls))
+	assert.Equal(t, "hung-model", blockDevice.DeviceAttributes.Model)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RemovalGracePeriod is the duration for which the blockdevice of a removed device
+// is kept in the Unknown state before it is made Inactive. If the device is attached
+// again within the grace period, the blockdevice is made Active again. The blockdevice
+// is made Inactive immediately on removal if it is 0.
+var RemovalGracePeriod = 30 * time.Second
+
+// removalGrace tracks the blockdevices of the removed devices which are in the
+// grace period
+type removalGrace struct {
+	sync.Mutex
+	// timers are the timers to make the blockdevices inactive, keyed by name
+	timers map[string]*removalTimer
+}
+
+// removalTimer is the timer to make the blockdevice of a removed device inactive
+type removalTimer struct {
+	*time.Timer
+	// unknownFailed is set if the blockdevice could not be marked unknown on
+	// the removal, so it may still be active at the end of the grace period
+	unknownFailed bool
+}
+
+// RemoveBlockDevice handles the removal of the device of the blockdevice. The
+// blockdevice is marked Unknown, and is made Inactive at the end of the removal
+// grace period unless the device is attached again.
+func (c *Controller) RemoveBlockDevice(blockDevice apis.BlockDevice) {
+	if RemovalGracePeriod == 0 {
+		c.DeactivateBlockDevice(blockDevice)
+		return
+	}
+
+	blockDeviceCopy := blockDevice.DeepCopy()
+	blockDeviceCopy.Status.State = NDMUnknown
+	// the blockdevice is Unknown due to the removal, and is not to be made
+	// Active by the operator when the heartbeat lease is renewed
+	delete(blockDeviceCopy.Annotations, HeartbeatExpiredAnnotation)
+	err := c.Clientset.Update(context.TODO(), blockDeviceCopy)
+	if err != nil {
+		blockDeviceLogger(blockDeviceCopy).Error(err, "Unable to mark blockdevice of removed device unknown",
+			"eventcode", "ndm.blockdevice.remove.failure")
+		// the blockdevice is made inactive at the end of the grace period
+		// even if it could not be marked unknown
+		c.queueWrite(queuedRemove, blockDeviceCopy, err)
+	} else {
+		blockDeviceLogger(blockDeviceCopy).Info("Marked blockdevice of removed device unknown",
+			"eventcode", "ndm.blockdevice.remove.success", "grace", RemovalGracePeriod)
+		c.recordBlockDevice(blockDeviceCopy)
+	}
+
+	name := blockDevice.Name
+	c.removals.Lock()
+	defer c.removals.Unlock()
+	if c.removals.timers == nil {
+		c.removals.timers = make(map[string]*removalTimer)
+	}
+	if timer, ok := c.removals.timers[name]; ok {
+		timer.Stop()
+	}
+	c.removals.timers[name] = &removalTimer{
+		Timer: time.AfterFunc(RemovalGracePeriod, func() {
+			c.expireRemovalGrace(name)
+		}),
+		unknownFailed: err != nil,
+	}
+}
+
+// expireRemovalGrace makes the blockdevice inactive at the end of the removal
+// grace period. Only the blockdevice which is still unknown is deactivated, as
+// the device may be attached again after the timer fired. The blockdevice which
+// could not be marked unknown is deactivated even if it is still active.
+func (c *Controller) expireRemovalGrace(name string) {
+	c.removals.Lock()
+	timer, ok := c.removals.timers[name]
+	delete(c.removals.timers, name)
+	c.removals.Unlock()
+	unknownFailed := ok && timer.unknownFailed
+
+	blockDevice := &apis.BlockDevice{}
+	err := c.Clientset.Get(context.TODO(), client.ObjectKey{Namespace: c.Namespace, Name: name}, blockDevice)
+	if err != nil {
+		logger.Errorf("unable to get blockdevice %s at the end of removal grace period: %v", name, err)
+		// the queued deactivation gets the blockdevice when it is sent
+		blockDevice.Name = name
+		blockDevice.Namespace = c.Namespace
+		c.queueWrite(queuedDeactivate, blockDevice, err)
+		return
+	}
+	if blockDevice.Status.State == NDMInactive ||
+		(blockDevice.Status.State != NDMUnknown && !unknownFailed) {
+		logger.V(4).Infof("blockdevice %s is %s at the end of removal grace period",
+			name, blockDevice.Status.State)
+		return
+	}
+	c.DeactivateBlockDevice(*blockDevice)
+}
+
+// cancelRemovalGrace stops the removal grace period of the blockdevice, when
+// the device is attached again
+func (c *Controller) cancelRemovalGrace(name string) {
+	c.removals.Lock()
+	defer c.removals.Unlock()
+	if timer, ok := c.removals.timers[name]; ok {
+		timer.Stop()
+		delete(c.removals.timers, name)
+		logger.Infof("device of blockdevice %s attached again within the removal grace period", name)
+	}
+}
+
+// inRemovalGrace checks if the blockdevice is in the removal grace period
+func (c *Controller) inRemovalGrace(name string) bool {
+	c.removals.Lock()
+	defer c.removals.Unlock()
+	_, ok := c.removals.timers[name]
+	return ok
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hookedClient runs the hook once before the next Get
+type hookedClient struct {
+	client.Client
+	mutex sync.Mutex
+	hook  func()
+}
+
+func (h *hookedClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	h.mutex.Lock()
+	hook := h.hook
+	h.hook = nil
+	h.mutex.Unlock()
+	if hook != nil {
+		hook()
+	}
+	return h.Client.Get(ctx, key, obj)
+}
+
+func getBlockDeviceState(t *testing.T, c *Controller, name string) string {
+	blockDevice := &apis.BlockDevice{}
+	if err := c.Clientset.Get(context.TODO(), client.ObjectKey{Name: name}, blockDevice); err != nil {
+		t.Fatal(err)
+	}
+	return string(blockDevice.Status.State)
+}
+
+func TestRemoveBlockDevice(t *testing.T) {
+	defer func(grace time.Duration) { RemovalGracePeriod = grace }(RemovalGracePeriod)
+	RemovalGracePeriod = 100 * time.Millisecond
+
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      CreateFakeClient(t),
+	}
+	blockDevice := newQueuedBlockDevice("blockdevice-1", "/dev/sda")
+	assert.NoError(t, fakeController.CreateBlockDevice(blockDevice))
+
+	// the blockdevice is unknown during the grace period, and inactive after it
+	fakeController.RemoveBlockDevice(blockDevice)
+	assert.Equal(t, NDMUnknown, getBlockDeviceState(t, fakeController, "blockdevice-1"))
+	assert.Eventually(t, func() bool {
+		return getBlockDeviceState(t, fakeController, "blockdevice-1") == NDMInactive
+	}, time.Second, 10*time.Millisecond)
+
+	// the blockdevice stays active, if the device is attached within the grace period
+	assert.NoError(t, fakeController.UpdateBlockDevice(blockDevice, nil))
+	fakeController.RemoveBlockDevice(blockDevice)
+	assert.Equal(t, NDMUnknown, getBlockDeviceState(t, fakeController, "blockdevice-1"))
+	assert.NoError(t, fakeController.UpdateBlockDevice(blockDevice, nil))
+	time.Sleep(2 * RemovalGracePeriod)
+	assert.Equal(t, NDMActive, getBlockDeviceState(t, fakeController, "blockdevice-1"))
+	assert.Empty(t, fakeController.removals.timers)
+}
+
+func TestRemoveBlockDeviceAttachedAtExpiry(t *testing.T) {
+	defer func(grace time.Duration) { RemovalGracePeriod = grace }(RemovalGracePeriod)
+	RemovalGracePeriod = 100 * time.Millisecond
+
+	fakeClient := &hookedClient{Client: CreateFakeClient(t)}
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      fakeClient,
+	}
+	blockDevice := newQueuedBlockDevice("blockdevice-1", "/dev/sda")
+	assert.NoError(t, fakeController.CreateBlockDevice(blockDevice))
+
+	// the device is attached again after the timer fired, before the
+	// blockdevice is fetched at the end of the grace period
+	fakeController.RemoveBlockDevice(blockDevice)
+	attached := make(chan struct{})
+	fakeClient.mutex.Lock()
+	fakeClient.hook = func() {
+		assert.NoError(t, fakeController.UpdateBlockDevice(blockDevice, nil))
+		close(attached)
+	}
+	fakeClient.mutex.Unlock()
+	select {
+	case <-attached:
+	case <-time.After(time.Second):
+		t.Fatal("removal grace period did not expire")
+	}
+	time.Sleep(RemovalGracePeriod)
+	assert.Equal(t, NDMActive, getBlockDeviceState(t, fakeController, "blockdevice-1"))
+}
+
+func TestRemoveBlockDeviceOfExpiredHeartbeat(t *testing.T) {
+	defer func(grace time.Duration) { RemovalGracePeriod = grace }(RemovalGracePeriod)
+	RemovalGracePeriod = 100 * time.Millisecond
+
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      CreateFakeClient(t),
+	}
+	// the blockdevice was marked unknown by the operator on the expiry of the heartbeat
+	blockDevice := newQueuedBlockDevice("blockdevice-1", "/dev/sda")
+	blockDevice.Annotations = map[string]string{HeartbeatExpiredAnnotation: time.Now().String()}
+	blockDevice.Status.State = NDMUnknown
+	assert.NoError(t, fakeController.CreateBlockDevice(blockDevice))
+
+	// the removal drops the annotation, so that the operator does not make
+	// the blockdevice active when the heartbeat is renewed
+	fakeController.RemoveBlockDevice(blockDevice)
+	removed := &apis.BlockDevice{}
+	assert.NoError(t, fakeController.Clientset.Get(context.TODO(), client.ObjectKey{Name: "blockdevice-1"}, removed))
+	assert.Equal(t, NDMUnknown, string(removed.Status.State))
+	assert.NotContains(t, removed.Annotations, HeartbeatExpiredAnnotation)
+	assert.Eventually(t, func() bool {
+		return getBlockDeviceState(t, fakeController, "blockdevice-1") == NDMInactive
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRemoveBlockDeviceWithoutGracePeriod(t *testing.T) {
+	defer func(grace time.Duration) { RemovalGracePeriod = grace }(RemovalGracePeriod)
+	RemovalGracePeriod = 0
+
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      CreateFakeClient(t),
+	}
+	blockDevice := newQueuedBlockDevice("blockdevice-1", "/dev/sda")
+	assert.NoError(t, fakeController.CreateBlockDevice(blockDevice))
+
+	fakeController.RemoveBlockDevice(blockDevice)
+	assert.Equal(t, NDMInactive, getBlockDeviceState(t, fakeController, "blockdevice-1"))
+}
+
+func TestRemoveBlockDeviceUnreachable(t *testing.T) {
+	defer func(grace time.Duration) { RemovalGracePeriod = grace }(RemovalGracePeriod)
+	RemovalGracePeriod = 100 * time.Millisecond
+
+	fakeClient := &unreachableClient{Client: CreateFakeClient(t)}
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      fakeClient,
+	}
+	blockDevice := newQueuedBlockDevice("blockdevice-1", "/dev/sda")
+	assert.NoError(t, fakeController.CreateBlockDevice(blockDevice))
+
+	// the update is queued while the API server is unreachable
+	fakeClient.down = true
+	fakeController.RemoveBlockDevice(blockDevice)
+	assert.Equal(t, queuedRemove, fakeController.writeQueue.writes["blockdevice-1"].operation)
+	fakeClient.down = false
+	fakeController.FlushWriteQueue()
+	assert.Equal(t, NDMUnknown, getBlockDeviceState(t, fakeController, "blockdevice-1"))
+	assert.Eventually(t, func() bool {
+		return getBlockDeviceState(t, fakeController, "blockdevice-1") == NDMInactive
+	}, time.Second, 10*time.Millisecond)
+
+	// the blockdevice is deactivated even if it could not be marked unknown
+	assert.NoError(t, fakeController.UpdateBlockDevice(blockDevice, nil))
+	fakeClient.down = true
+	fakeController.RemoveBlockDevice(blockDevice)
+	fakeClient.down = false
+	assert.Eventually(t, func() bool {
+		return getBlockDeviceState(t, fakeController, "blockdevice-1") == NDMInactive
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/udev"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// wwnLinkPrefix is the prefix of the by-id devlink created from the WWN of the device
+const wwnLinkPrefix = "/dev/disk/by-id/wwn-"
+
+// FindRenamedBlockDevice finds a blockdevice resource on this node that belongs to the
+// same physical device, but was created when the device had a different path. This
+// happens when the UUID of the device depends on its path and the kernel assigns a
+// new name to the device, e.g. after some hotplug sequences sdb becomes sdc.
+//
+// The devices are matched using the WWN and the serial number. Only inactive resources
+// are considered, since the resource of a device that is still attached to the node
+// at its old path will be active. If more than one resource matches, nil is returned.
+func (c *Controller) FindRenamedBlockDevice(bdAPIList *apis.BlockDeviceList, di *DeviceInfo) *apis.BlockDevice {
+	if len(di.Serial) == 0 {
+		return nil
+	}
+	wwn := getWWNFromDevLinks(di.ByIdDevLinks)
+
+	var renamed *apis.BlockDevice
+	for i := range bdAPIList.Items {
+		item := &bdAPIList.Items[i]
+		if item.Labels[KubernetesHostNameLabel] != c.NodeAttributes[HostNameKey] {
+			continue
+		}
+		if item.Status.State == NDMActive || item.Spec.Path == di.Path {
+			continue
+		}
+		if item.Spec.Details.Serial != di.Serial ||
+			item.Spec.Details.Model != di.Model ||
+			item.Spec.Details.Vendor != di.Vendor {
+			continue
+		}
+		if wwn != getWWNFromDevLinks(getDevLinks(item, udev.BY_ID_LINK)) {
+			continue
+		}
+		if renamed != nil {
+			logger.Warningf("multiple blockdevices match the serial %s of %s, not treating as rename",
+				di.Serial, di.Path)
+			return nil
+		}
+		renamed = item
+	}
+	return renamed
+}
+
+// recordPathChange emits an event if the path of the blockdevice has changed
+func (c *Controller) recordPathChange(oldBD, newBD *apis.BlockDevice) {
+	if len(oldBD.Spec.Path) == 0 || oldBD.Spec.Path == newBD.Spec.Path {
+		return
+	}
+	blockDeviceLogger(newBD).Info("Path of blockdevice changed",
+		"eventcode", "ndm.blockdevice.rename.success", "oldpath", oldBD.Spec.Path)
+	c.Eventf(newBD, v1.EventTypeNormal, "DeviceRenamed",
+		"Device path changed from %s to %s", oldBD.Spec.Path, newBD.Spec.Path)
+}
+
+// getDevLinks gets the devlinks of the given kind from the blockdevice resource
+func getDevLinks(bd *apis.BlockDevice, kind string) []string {
+	for _, devLink := range bd.Spec.DevLinks {
+		if devLink.Kind == kind {
+			return devLink.Links
+		}
+	}
+	return nil
+}
+
+// getWWNFromDevLinks gets the WWN from the wwn by-id link, if present
+func getWWNFromDevLinks(links []string) string {
+	for _, link := range links {
+		if strings.HasPrefix(link, wwnLinkPrefix) {
+			wwn := strings.TrimPrefix(link, wwnLinkPrefix)
+			// strip the partition suffix if any
+			return strings.SplitN(wwn, "-part", 2)[0]
+		}
+	}
+	return ""
+}
+
+// GetActiveBlockDeviceResourceByPath returns the active blockdevice resource on this node
+// having the given path, nil if no such resource exists
+func (c *Controller) GetActiveBlockDeviceResourceByPath(bdAPIList *apis.BlockDeviceList, path string) *apis.BlockDevice {
+	for i := range bdAPIList.Items {
+		item := &bdAPIList.Items[i]
+		if item.Labels[KubernetesHostNameLabel] == c.NodeAttributes[HostNameKey] &&
+			item.Status.State == NDMActive && item.Spec.Path == path {
+			return item
+		}
+	}
+	return nil
+}
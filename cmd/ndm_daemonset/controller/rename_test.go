@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/udev"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFindRenamedBlockDevice(t *testing.T) {
+	ctrl := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: "node1"},
+	}
+	newBD := func(name, host, path, serial, state string, links ...string) apis.BlockDevice {
+		bd := apis.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{KubernetesHostNameLabel: host},
+			},
+			Spec: apis.DeviceSpec{
+				Path:    path,
+				Details: apis.DeviceDetails{Serial: serial, Model: "disk"},
+			},
+			Status: apis.DeviceStatus{State: apis.BlockDeviceState(state)},
+		}
+		if len(links) != 0 {
+			bd.Spec.DevLinks = []apis.DeviceDevLink{{Kind: udev.BY_ID_LINK, Links: links}}
+		}
+		return bd
+	}
+	di := &DeviceInfo{
+		Path:         "/dev/sdc",
+		Serial:       "S1",
+		Model:        "disk",
+		ByIdDevLinks: []string{"/dev/disk/by-id/wwn-0x5000c500a1"},
+	}
+
+	tests := map[string]struct {
+		items []apis.BlockDevice
+		di    *DeviceInfo
+		want  string
+	}{
+		"inactive resource with same serial and wwn": {
+			items: []apis.BlockDevice{
+				newBD("bd-1", "node1", "/dev/sdb", "S1", NDMInactive, "/dev/disk/by-id/wwn-0x5000c500a1"),
+			},
+			di:   di,
+			want: "bd-1",
+		},
+		"active resource is not a rename": {
+			items: []apis.BlockDevice{
+				newBD("bd-1", "node1", "/dev/sdb", "S1", NDMActive, "/dev/disk/by-id/wwn-0x5000c500a1"),
+			},
+			di: di,
+		},
+		"resource on another node": {
+			items: []apis.BlockDevice{
+				newBD("bd-1", "node2", "/dev/sdb", "S1", NDMInactive, "/dev/disk/by-id/wwn-0x5000c500a1"),
+			},
+			di: di,
+		},
+		"different wwn": {
+			items: []apis.BlockDevice{
+				newBD("bd-1", "node1", "/dev/sdb", "S1", NDMInactive, "/dev/disk/by-id/wwn-0x5000c500b2"),
+			},
+			di: di,
+		},
+		"device without serial": {
+			items: []apis.BlockDevice{
+				newBD("bd-1", "node1", "/dev/sdb", "", NDMInactive),
+			},
+			di: &DeviceInfo{Path: "/dev/sdc"},
+		},
+		"multiple matching resources": {
+			items: []apis.BlockDevice{
+				newBD("bd-1", "node1", "/dev/sdb", "S1", NDMInactive, "/dev/disk/by-id/wwn-0x5000c500a1"),
+				newBD("bd-2", "node1", "/dev/sdd", "S1", NDMInactive, "/dev/disk/by-id/wwn-0x5000c500a1"),
+			},
+			di: di,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := ctrl.FindRenamedBlockDevice(&apis.BlockDeviceList{Items: test.items}, test.di)
+			if test.want == "" {
+				assert.Nil(t, got)
+			} else {
+				assert.NotNil(t, got)
+				assert.Equal(t, test.want, got.Name)
+			}
+		})
+	}
+}
+
+func TestGetWWNFromDevLinks(t *testing.T) {
+	assert.Equal(t, "0x5000c500a1", getWWNFromDevLinks([]string{
+		"/dev/disk/by-id/ata-disk_S1",
+		"/dev/disk/by-id/wwn-0x5000c500a1-part1",
+	}))
+	assert.Equal(t, "", getWWNFromDevLinks([]string{"/dev/disk/by-id/ata-disk_S1"}))
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// RescanPath is the path of the local api at which a rescan of the devices is triggered
+	RescanPath = "/v1/rescan"
+	// RescanRequestAnnotation is set on the node to request a rescan of the devices
+	// on the node. The value identifies the request, and is set in the result.
+	RescanRequestAnnotation = "ndm.io/rescan-request"
+	// RescanResultAnnotation is set on the node by the daemon with the RescanResult
+	// of the last rescan requested using RescanRequestAnnotation, as json
+	RescanResultAnnotation = "ndm.io/rescan-result"
+)
+
+var (
+	// RescanTimeout is the max time for which a rescan waits for the devices to be processed
+	RescanTimeout = 2 * time.Minute
+	// RescanRequestInterval is the interval at which the node is checked for a rescan request
+	RescanRequestInterval = 10 * time.Second
+)
+
+// errRescanUnavailable is returned if the devices cannot be scanned, as the udev probe is disabled
+var errRescanUnavailable = errors.New("rescan not available, udev probe is disabled")
+
+// DeviceChange is a device added, removed or updated by a rescan
+type DeviceChange struct {
+	// DevPath is the path of the device
+	DevPath string `json:"devPath"`
+	// BlockDevice is the name of the blockdevice of the device, if it is not filtered
+	BlockDevice string `json:"blockDevice,omitempty"`
+	// Fields are the names of the details of an updated device that changed
+	Fields []string `json:"fields,omitempty"`
+}
+
+// RescanResult is the diff of the devices on the node before and after a rescan
+type RescanResult struct {
+	// ID is the id of the rescan request set on the node, if requested using the node
+	ID string `json:"id,omitempty"`
+	// Node is the name of the node
+	Node string `json:"node"`
+	// Added are the devices found by the rescan, which were not known before it
+	Added []DeviceChange `json:"added"`
+	// Removed are the devices no longer found by the rescan
+	Removed []DeviceChange `json:"removed"`
+	// Updated are the devices whose details changed after the rescan
+	Updated []DeviceChange `json:"updated"`
+	// Error is set if the rescan requested using the node failed
+	Error string `json:"error,omitempty"`
+}
+
+// rescanState holds the trigger of the scan of the devices and the rescans
+// waiting for the devices found by a scan to be processed
+type rescanState struct {
+	sync.Mutex
+	// trigger requests a scan of the devices, set by the udev probe
+	trigger func()
+	// waiters are closed once the devices found by the next scan are processed
+	waiters []chan struct{}
+	// lastRequest is the id of the last rescan request of the node handled
+	lastRequest string
+}
+
+// SetRescanTrigger sets the function which requests a scan of all the devices
+// on the node, used to rescan the devices on demand
+func (c *Controller) SetRescanTrigger(trigger func()) {
+	c.rescan.Lock()
+	defer c.rescan.Unlock()
+	c.rescan.trigger = trigger
+}
+
+// ScanProcessed records that the devices found by a scan of all the devices on
+// the node are processed, which completes the pending rescans
+func (c *Controller) ScanProcessed() {
+	c.rescan.Lock()
+	defer c.rescan.Unlock()
+	for _, waiter := range c.rescan.waiters {
+		close(waiter)
+	}
+	c.rescan.waiters = nil
+}
+
+// Rescan scans all the devices on the node and returns the devices added, removed
+// and updated by the scan, once the devices found are processed
+func (c *Controller) Rescan(ctx context.Context) (*RescanResult, error) {
+	c.rescan.Lock()
+	trigger := c.rescan.trigger
+	if trigger == nil {
+		c.rescan.Unlock()
+		return nil, errRescanUnavailable
+	}
+	done := make(chan struct{})
+	c.rescan.waiters = append(c.rescan.waiters, done)
+	c.rescan.Unlock()
+
+	before := c.ListDevices()
+	trigger()
+	ctx, cancel := context.WithTimeout(ctx, RescanTimeout)
+	defer cancel()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, errors.New("timed out waiting for the devices to be scanned")
+	}
+	result := diffDevices(before, c.ListDevices())
+	result.Node = c.NodeAttributes[NodeNameKey]
+	return result, nil
+}
+
+// diffDevices returns the devices added, removed and updated between the two
+// lists of devices, sorted by the device path
+func diffDevices(before, after []DeviceStatus) *RescanResult {
+	result := &RescanResult{
+		Added:   make([]DeviceChange, 0),
+		Removed: make([]DeviceChange, 0),
+		Updated: make([]DeviceChange, 0),
+	}
+	old := make(map[string]DeviceStatus, len(before))
+	for _, device := range before {
+		old[device.Device.DevPath] = device
+	}
+	for _, device := range after {
+		oldDevice, ok := old[device.Device.DevPath]
+		if !ok {
+			result.Added = append(result.Added, newDeviceChange(device))
+			continue
+		}
+		delete(old, device.Device.DevPath)
+		if fields := changedFields(oldDevice, device); len(fields) != 0 {
+			change := newDeviceChange(device)
+			change.Fields = fields
+			result.Updated = append(result.Updated, change)
+		}
+	}
+	for _, device := range old {
+		result.Removed = append(result.Removed, newDeviceChange(device))
+	}
+	sort.Slice(result.Removed, func(i, j int) bool {
+		return result.Removed[i].DevPath < result.Removed[j].DevPath
+	})
+	return result
+}
+
+// newDeviceChange returns the change of the device, without the changed fields
+func newDeviceChange(device DeviceStatus) DeviceChange {
+	change := DeviceChange{DevPath: device.Device.DevPath}
+	if !device.Filtered {
+		change.BlockDevice = device.Device.UUID
+	}
+	return change
+}
+
+// changedFields returns the names of the details of the device which changed, with
+// Filtered if the device was included or excluded by the filters. The temperature
+// is not compared, as it changes between the scans.
+func changedFields(before, after DeviceStatus) []string {
+	fields := make([]string, 0)
+	if before.Filtered != after.Filtered {
+		fields = append(fields, "Filtered")
+	}
+	before.Device.SMARTInfo.TemperatureInfo = blockdevice.TemperatureInformation{}
+	after.Device.SMARTInfo.TemperatureInfo = blockdevice.TemperatureInformation{}
+	oldValue := reflect.ValueOf(before.Device)
+	newValue := reflect.ValueOf(after.Device)
+	deviceType := oldValue.Type()
+	for i := 0; i < deviceType.NumField(); i++ {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			fields = append(fields, deviceType.Field(i).Name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// rescanHandler rescans the devices and serves the diff of the devices as json
+func (c *Controller) rescanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	result, err := c.Rescan(r.Context())
+	if err == errRescanUnavailable {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Errorf("unable to write rescan result: %v", err)
+	}
+}
+
+// WatchRescanRequests checks the node for a rescan request at RescanRequestInterval
+// till the stop channel is closed, so that the devices can be rescanned without
+// access to the local api. The result of the rescan is set on the node.
+func (c *Controller) WatchRescanRequests(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(RescanRequestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			c.handleRescanRequest()
+		}
+	}
+}
+
+// handleRescanRequest rescans the devices if a rescan is requested on the node,
+// which does not have a result yet
+func (c *Controller) handleRescanRequest() {
+	nodeName := c.NodeAttributes[NodeNameKey]
+	if c.Clientset == nil || len(nodeName) == 0 {
+		return
+	}
+	node := &v1.Node{}
+	err := c.Clientset.Get(context.TODO(), client.ObjectKey{Namespace: "", Name: nodeName}, node)
+	if err != nil {
+		logger.Errorf("unable to get rescan request of node %s: %v", nodeName, err)
+		return
+	}
+	id := node.Annotations[RescanRequestAnnotation]
+	if len(id) == 0 || id == c.rescan.lastRequest || id == rescanResultID(node) {
+		return
+	}
+	c.rescan.lastRequest = id
+
+	logger.Infof("rescan %s requested on node %s", id, nodeName)
+	result, err := c.Rescan(context.TODO())
+	if err != nil {
+		logger.Errorf("rescan %s failed: %v", id, err)
+		result = &RescanResult{Node: nodeName, Error: err.Error()}
+	}
+	result.ID = id
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Errorf("unable to marshal result of rescan %s: %v", id, err)
+		return
+	}
+	nodeCopy := node.DeepCopy()
+	nodeCopy.Annotations[RescanResultAnnotation] = string(data)
+	if err := c.Clientset.Patch(context.TODO(), nodeCopy, client.MergeFrom(node)); err != nil {
+		logger.Errorf("unable to set result of rescan %s on node %s: %v", id, nodeName, err)
+	}
+}
+
+// rescanResultID returns the id of the rescan request whose result is set on the node
+func rescanResultID(node *v1.Node) string {
+	data, ok := node.Annotations[RescanResultAnnotation]
+	if !ok {
+		return ""
+	}
+	result := RescanResult{}
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		return ""
+	}
+	return result.ID
+}
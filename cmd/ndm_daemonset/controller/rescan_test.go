@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestDevice(devPath, uuid string, capacity uint64) *blockdevice.BlockDevice {
+	device := &blockdevice.BlockDevice{}
+	device.DevPath = devPath
+	device.UUID = uuid
+	device.Capacity.Storage = capacity
+	return device
+}
+
+func TestDiffDevices(t *testing.T) {
+	sda := DeviceStatus{Device: *newTestDevice("/dev/sda", "blockdevice-a", 100), Filtered: true}
+	sdb := DeviceStatus{Device: *newTestDevice("/dev/sdb", "blockdevice-b", 100)}
+	sdc := DeviceStatus{Device: *newTestDevice("/dev/sdc", "blockdevice-c", 100)}
+	sdd := DeviceStatus{Device: *newTestDevice("/dev/sdd", "blockdevice-d", 100)}
+
+	// sdb is resized, sdc is no longer filtered and only the temperature of sdd changed
+	newSdb := sdb
+	newSdb.Device.Capacity.Storage = 200
+	newSdb.Device.FSInfo.FileSystem = "ext4"
+	newSdc := sdc
+	newSdc.Filtered = true
+	newSdd := sdd
+	newSdd.Device.SMARTInfo.TemperatureInfo.CurrentTemperature = 40
+	sde := DeviceStatus{Device: *newTestDevice("/dev/sde", "blockdevice-e", 100)}
+
+	result := diffDevices([]DeviceStatus{sda, sdb, sdc, sdd}, []DeviceStatus{newSdb, newSdc, newSdd, sde})
+	assert.Equal(t, []DeviceChange{{DevPath: "/dev/sde", BlockDevice: "blockdevice-e"}}, result.Added)
+	assert.Equal(t, []DeviceChange{{DevPath: "/dev/sda"}}, result.Removed)
+	assert.Equal(t, []DeviceChange{
+		{DevPath: "/dev/sdb", BlockDevice: "blockdevice-b", Fields: []string{"Capacity", "FSInfo"}},
+		{DevPath: "/dev/sdc", Fields: []string{"Filtered"}},
+	}, result.Updated)
+
+	result = diffDevices(nil, nil)
+	assert.Equal(t, &RescanResult{Added: []DeviceChange{}, Removed: []DeviceChange{}, Updated: []DeviceChange{}}, result)
+}
+
+func TestRescanHandler(t *testing.T) {
+	c := &Controller{NodeAttributes: map[string]string{NodeNameKey: "node1"}}
+	c.RecordDevice(newTestDevice("/dev/sda", "blockdevice-a", 100), false)
+
+	rec := httptest.NewRecorder()
+	c.rescanHandler(rec, httptest.NewRequest(http.MethodPost, RescanPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	// the scan finds a new device, which is processed after the trigger returns
+	c.SetRescanTrigger(func() {
+		go func() {
+			c.RecordDevice(newTestDevice("/dev/sdb", "blockdevice-b", 100), false)
+			c.ScanProcessed()
+		}()
+	})
+	rec = httptest.NewRecorder()
+	c.rescanHandler(rec, httptest.NewRequest(http.MethodPost, RescanPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	result := RescanResult{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, "node1", result.Node)
+	assert.Equal(t, []DeviceChange{{DevPath: "/dev/sdb", BlockDevice: "blockdevice-b"}}, result.Added)
+	assert.Empty(t, result.Removed)
+	assert.Empty(t, result.Updated)
+
+	// the rescan is cancelled with the request
+	c.SetRescanTrigger(func() {})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	c.rescanHandler(rec, httptest.NewRequest(http.MethodPost, RescanPath, nil).WithContext(ctx))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+
+	rec = httptest.NewRecorder()
+	c.rescanHandler(rec, httptest.NewRequest(http.MethodGet, RescanPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHandleRescanRequest(t *testing.T) {
+	fakeClient := CreateFakeClient(t)
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "node1",
+			Annotations: map[string]string{RescanRequestAnnotation: "1"},
+		},
+	}
+	assert.NoError(t, fakeClient.Create(context.TODO(), node))
+
+	c := &Controller{
+		Clientset:      fakeClient,
+		NodeAttributes: map[string]string{NodeNameKey: "node1"},
+	}
+	scans := 0
+	c.SetRescanTrigger(func() {
+		scans++
+		go c.ScanProcessed()
+	})
+	getResult := func() RescanResult {
+		node := &v1.Node{}
+		assert.NoError(t, fakeClient.Get(context.TODO(), client.ObjectKey{Name: "node1"}, node))
+		result := RescanResult{}
+		assert.NoError(t, json.Unmarshal([]byte(node.Annotations[RescanResultAnnotation]), &result))
+		return result
+	}
+
+	c.handleRescanRequest()
+	assert.Equal(t, 1, scans)
+	assert.Equal(t, "1", getResult().ID)
+	assert.Equal(t, "node1", getResult().Node)
+
+	// the request is handled only once
+	c.handleRescanRequest()
+	assert.Equal(t, 1, scans)
+
+	// a request with a result is not handled again after a restart
+	c = &Controller{
+		Clientset:      fakeClient,
+		NodeAttributes: map[string]string{NodeNameKey: "node1"},
+	}
+	c.handleRescanRequest()
+	assert.Equal(t, "", c.rescan.lastRequest)
+
+	// the error is set in the result if the devices cannot be scanned
+	assert.NoError(t, fakeClient.Get(context.TODO(), client.ObjectKey{Name: "node1"}, node))
+	node.Annotations[RescanRequestAnnotation] = "2"
+	assert.NoError(t, fakeClient.Update(context.TODO(), node))
+	c.handleRescanRequest()
+	assert.Equal(t, "2", getResult().ID)
+	assert.Equal(t, errRescanUnavailable.Error(), getResult().Error)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	// recreateRetries is the no. of times the recreation of the deleted
+	// blockdevices is retried, if the scan of the devices fails
+	recreateRetries = 5
+)
+
+// recreateDelay is the delay after the deletion of a blockdevice before the devices
+// are scanned, so that the deletion of many blockdevices results in a single scan
+var recreateDelay = 2 * time.Second
+
+// RecreateHandler scans the devices, which creates the deleted blockdevices of
+// the attached devices again
+type RecreateHandler func(c *Controller) error
+
+// selfHeal recreates the blockdevice resources of the attached devices, which
+// were deleted from outside the daemon
+type selfHeal struct {
+	sync.Mutex
+	// recreate scans the devices, which creates the deleted blockdevices again
+	recreate RecreateHandler
+	// pending is set if a scan is scheduled
+	pending bool
+	// retries is the no. of failed scans since the last deletion
+	retries int
+	// deleted are the names of the blockdevices deleted by the daemon
+	deleted map[string]bool
+}
+
+// SetRecreateHandler sets the handler which scans the devices, to create the
+// blockdevices of the attached devices deleted from outside the daemon
+func (c *Controller) SetRecreateHandler(handler RecreateHandler) {
+	c.selfHeal.Lock()
+	defer c.selfHeal.Unlock()
+	c.selfHeal.recreate = handler
+}
+
+// recordDeletion records the deletion of the blockdevice by the daemon, which
+// is not recreated. The record is removed if the deletion failed.
+func (c *Controller) recordDeletion(name string, deleted bool) {
+	c.selfHeal.Lock()
+	defer c.selfHeal.Unlock()
+	if !deleted {
+		delete(c.selfHeal.deleted, name)
+		return
+	}
+	if c.selfHeal.deleted == nil {
+		c.selfHeal.deleted = make(map[string]bool)
+	}
+	c.selfHeal.deleted[name] = true
+}
+
+// WatchBlockDeviceDeletion watches for the deletion of the blockdevices of this
+// node till the stop channel is closed. Only the blockdevices labelled with the
+// hostname of this node are watched, so that the daemon does not cache the
+// blockdevices of the whole cluster.
+func (c *Controller) WatchBlockDeviceDeletion(stopCh <-chan struct{}) {
+	if c.config == nil {
+		return
+	}
+	listWatch, err := c.newBlockDeviceListWatch()
+	if err != nil {
+		logger.Errorf("unable to watch blockdevices, deleted blockdevices will not be recreated: %v", err)
+		return
+	}
+	_, informer := toolscache.NewInformer(listWatch, &apis.BlockDevice{}, 0,
+		toolscache.ResourceEventHandlerFuncs{
+			DeleteFunc: c.onBlockDeviceDeleted,
+		})
+	informer.Run(stopCh)
+}
+
+// newBlockDeviceListWatch returns the list watch of the blockdevices of this node
+func (c *Controller) newBlockDeviceListWatch() (*toolscache.ListWatch, error) {
+	scheme := runtime.NewScheme()
+	if err := apis.SchemeBuilder.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	config := rest.CopyConfig(c.config)
+	config.APIPath = "/apis"
+	config.GroupVersion = &apis.SchemeGroupVersion
+	config.NegotiatedSerializer = serializer.NewCodecFactory(scheme).WithoutConversion()
+	restClient, err := rest.RESTClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+	selector := labels.SelectorFromSet(labels.Set{KubernetesHostNameLabel: c.NodeAttributes[HostNameKey]})
+	return toolscache.NewFilteredListWatchFromClient(restClient, "blockdevices", c.Namespace,
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = selector.String()
+		}), nil
+}
+
+// onBlockDeviceDeleted schedules a scan of the devices, if the deleted blockdevice
+// was an active blockdevice of this node whose device is still attached
+func (c *Controller) onBlockDeviceDeleted(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	blockDevice, ok := obj.(*apis.BlockDevice)
+	if !ok {
+		return
+	}
+
+	c.selfHeal.Lock()
+	deletedByDaemon := c.selfHeal.deleted[blockDevice.Name]
+	delete(c.selfHeal.deleted, blockDevice.Name)
+	c.selfHeal.Unlock()
+
+	if deletedByDaemon ||
+		blockDevice.Labels[KubernetesHostNameLabel] != c.NodeAttributes[HostNameKey] ||
+		blockDevice.Status.State != NDMActive ||
+		blockDevice.Spec.Details.DeviceType == bd.SparseBlockDeviceType {
+		return
+	}
+	if _, err := os.Stat(blockDevice.Spec.Path); err != nil {
+		logger.V(4).Infof("device %s of deleted blockdevice %s is not attached", blockDevice.Spec.Path, blockDevice.Name)
+		return
+	}
+
+	blockDeviceLogger(blockDevice).Info("blockdevice of attached device was deleted, recreating it",
+		"eventcode", "ndm.blockdevice.recreate")
+	c.NodeEventf(v1.EventTypeWarning, "BlockDeviceDeleted",
+		"blockdevice %s of attached device %s was deleted, recreating it", blockDevice.Name, blockDevice.Spec.Path)
+
+	c.selfHeal.Lock()
+	c.selfHeal.retries = 0
+	c.selfHeal.Unlock()
+	c.scheduleRecreate()
+}
+
+// scheduleRecreate schedules a scan of the devices, if one is not already scheduled
+func (c *Controller) scheduleRecreate() {
+	c.selfHeal.Lock()
+	defer c.selfHeal.Unlock()
+	if c.selfHeal.pending || c.selfHeal.recreate == nil {
+		return
+	}
+	c.selfHeal.pending = true
+	time.AfterFunc(recreateDelay, c.recreateBlockDevices)
+}
+
+// recreateBlockDevices scans the devices, to create the deleted blockdevices
+// again. The scan is retried if it fails, eg: if another scan is in progress.
+func (c *Controller) recreateBlockDevices() {
+	c.selfHeal.Lock()
+	c.selfHeal.pending = false
+	recreate := c.selfHeal.recreate
+	c.selfHeal.Unlock()
+
+	err := recreate(c)
+	if err == nil {
+		return
+	}
+
+	c.selfHeal.Lock()
+	c.selfHeal.retries++
+	retries := c.selfHeal.retries
+	c.selfHeal.Unlock()
+	if retries > recreateRetries {
+		logger.Errorf("unable to recreate deleted blockdevices after %d retries: %v", recreateRetries, err)
+		return
+	}
+	logger.Warningf("unable to recreate deleted blockdevices, retrying: %v", err)
+	c.scheduleRecreate()
+}
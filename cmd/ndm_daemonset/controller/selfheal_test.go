@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+func TestOnBlockDeviceDeleted(t *testing.T) {
+	defer func(delay time.Duration) { recreateDelay = delay }(recreateDelay)
+	recreateDelay = 10 * time.Millisecond
+
+	device, err := ioutil.TempFile("", "selfheal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	device.Close()
+	defer os.Remove(device.Name())
+
+	attached := newQueuedBlockDevice("blockdevice-1", device.Name())
+	otherNode := newQueuedBlockDevice("blockdevice-2", device.Name())
+	otherNode.Labels[KubernetesHostNameLabel] = "other-node"
+	inactive := newQueuedBlockDevice("blockdevice-3", device.Name())
+	inactive.Status.State = NDMInactive
+	detached := newQueuedBlockDevice("blockdevice-4", "/dev/not-attached")
+	sparse := newQueuedBlockDevice("blockdevice-5", device.Name())
+	sparse.Spec.Details.DeviceType = bd.SparseBlockDeviceType
+
+	tests := map[string]struct {
+		obj          interface{}
+		deletedByNDM bool
+		wantRecreate bool
+	}{
+		"attached device":                {obj: &attached, wantRecreate: true},
+		"attached device from tombstone": {obj: toolscache.DeletedFinalStateUnknown{Obj: &attached}, wantRecreate: true},
+		"deleted by the daemon":          {obj: &attached, deletedByNDM: true},
+		"blockdevice of other node":      {obj: &otherNode},
+		"inactive blockdevice":           {obj: &inactive},
+		"detached device":                {obj: &detached},
+		"sparse blockdevice":             {obj: &sparse},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var scans int32
+			fakeController := &Controller{
+				NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+			}
+			fakeController.SetRecreateHandler(func(c *Controller) error {
+				atomic.AddInt32(&scans, 1)
+				return nil
+			})
+			if test.deletedByNDM {
+				fakeController.recordDeletion(attached.Name, true)
+			}
+			fakeController.onBlockDeviceDeleted(test.obj)
+			time.Sleep(5 * recreateDelay)
+			if test.wantRecreate {
+				assert.Equal(t, int32(1), atomic.LoadInt32(&scans))
+			} else {
+				assert.Equal(t, int32(0), atomic.LoadInt32(&scans))
+			}
+			assert.Empty(t, fakeController.selfHeal.deleted)
+		})
+	}
+}
+
+func TestRecreateBlockDevicesRetry(t *testing.T) {
+	defer func(delay time.Duration) { recreateDelay = delay }(recreateDelay)
+	recreateDelay = 10 * time.Millisecond
+
+	var scans int32
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+	}
+	// the scan fails while another scan is in progress
+	fakeController.SetRecreateHandler(func(c *Controller) error {
+		if atomic.AddInt32(&scans, 1) < 3 {
+			return errors.New("Scan is in progress")
+		}
+		return nil
+	})
+	device := newQueuedBlockDevice("blockdevice-1", os.TempDir())
+	// multiple deletions result in a single scan
+	fakeController.onBlockDeviceDeleted(&device)
+	fakeController.onBlockDeviceDeleted(&device)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&scans) == 3
+	}, time.Second, recreateDelay)
+	time.Sleep(5 * recreateDelay)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&scans))
+}
+
+func TestBlockDeviceListWatch(t *testing.T) {
+	var path, labelSelector string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, labelSelector = r.URL.Path, r.URL.Query().Get("labelSelector")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"apiVersion":"openebs.io/v1alpha1","kind":"BlockDeviceList","items":[]}`))
+	}))
+	defer server.Close()
+
+	fakeController := &Controller{
+		config:         &rest.Config{Host: server.URL},
+		Namespace:      "openebs",
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+	}
+	listWatch, err := fakeController.newBlockDeviceListWatch()
+	assert.NoError(t, err)
+	_, err = listWatch.List(metav1.ListOptions{})
+	assert.NoError(t, err)
+	// only the blockdevices of this node are listed
+	assert.Equal(t, "/apis/openebs.io/v1alpha1/namespaces/openebs/blockdevices", path)
+	assert.Equal(t, KubernetesHostNameLabel+"="+fakeHostName, labelSelector)
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/openebs/node-disk-manager/pkg/server"
+)
+
+// SecureServing are the options to serve the http endpoints of the daemon over
+// TLS and to authenticate the clients. The health endpoints are served over TLS,
+// but the clients are not authenticated, as they are used by the kubelet probes.
+var SecureServing server.SecureOptions
+
+// serveHTTP serves the handler on the given address till the stop channel is closed
+func serveHTTP(name, address string, handler http.Handler, secure server.SecureOptions, stopCh <-chan struct{}) {
+	httpServer := &http.Server{Addr: address, Handler: secure.Handler(handler)}
+	go func() {
+		<-stopCh
+		if err := httpServer.Shutdown(context.Background()); err != nil {
+			logger.Errorf("error stopping %s server: %v", name, err)
+		}
+	}()
+
+	logger.Infof("serving %s on %s", name, address)
+	if err := secure.ListenAndServe(httpServer); err != nil && err != http.ErrServerClosed {
+		logger.Errorf("error serving %s: %v", name, err)
+	}
+}
+
+// serveUnix serves the handler on the unix socket at the given path till the stop
+// channel is closed. The clients are not authenticated, access to the socket is
+// limited to the user and group of the daemon.
+func serveUnix(name, path string, handler http.Handler, stopCh <-chan struct{}) {
+	l, err := listenUnix(path)
+	if err != nil {
+		logger.Errorf("error serving %s: %v", name, err)
+		return
+	}
+	httpServer := &http.Server{Handler: handler}
+	go func() {
+		<-stopCh
+		if err := httpServer.Shutdown(context.Background()); err != nil {
+			logger.Errorf("error stopping %s server: %v", name, err)
+		}
+	}()
+
+	logger.Infof("serving %s on %s", name, path)
+	if err := httpServer.Serve(l); err != nil && err != http.ErrServerClosed {
+		logger.Errorf("error serving %s: %v", name, err)
+	}
+}
+
+// listenUnix listens on the unix socket at the given path. A stale socket left
+// by an earlier run is removed.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create directory of socket %s: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to remove stale socket %s: %v", path, err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %v", path, err)
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("unable to set permissions of %s: %v", path, err)
+	}
+	return l, nil
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/util"
+)
+
+// SparsePath is the path of the local api at which the sparse files of the
+// node are listed, created, resized and deleted
+const SparsePath = "/v1/sparse"
+
+var (
+	// errSparseDisabled is returned if the sparse files are managed while the
+	// sparse file directory is not set
+	errSparseDisabled = fmt.Errorf("sparse files are not enabled, %s is not set to an existing directory", EnvSparseFileDir)
+	// errSparseNotFound is returned if the sparse file to resize or delete does not exist
+	errSparseNotFound = errors.New("sparse file not found")
+	// errSparseClaimed is returned if a claimed sparse file is shrunk or deleted
+	errSparseClaimed = errors.New("blockdevice of the sparse file is claimed")
+	// errSparseTooSmall is returned if the size of a sparse file is less than
+	// SparseFileMinSize
+	errSparseTooSmall = fmt.Errorf("size is less than the min size of a sparse file %d", SparseFileMinSize)
+)
+
+// SparseFile is a sparse file on the node and its blockdevice
+type SparseFile struct {
+	// Path is the path of the sparse file
+	Path string `json:"path"`
+	// Size is the size of the sparse file in bytes
+	Size int64 `json:"size"`
+	// BlockDevice is the name of the blockdevice of the sparse file
+	BlockDevice string `json:"blockDevice"`
+}
+
+// SparseRequest is a request to create, resize or delete a sparse file
+type SparseRequest struct {
+	// Name is the blockdevice or the path of the sparse file to resize or delete
+	Name string `json:"name,omitempty"`
+	// Size is the size in bytes of the sparse file to create, or to resize to
+	Size int64 `json:"size,omitempty"`
+}
+
+// sparseFiles serializes the changes to the sparse files
+type sparseFiles struct {
+	sync.Mutex
+	// annotation is the NodeSparseFilesAnnotation of the node from which the
+	// sparse files were last applied, and annotated is set if it was present
+	annotation string
+	annotated  bool
+	// config is the sparse config from which the sparse files were last applied
+	config *SparseConfig
+	// configured are the paths of the sparse files configured on the node
+	configured map[string]bool
+	// retiring is set if some retired sparse files are waiting to be unclaimed
+	retiring bool
+
+	dirsLock sync.RWMutex
+	// dirs are the directories of the sparse files configured on the node
+	dirs []string
+}
+
+// setDirs sets the directories of the sparse files configured on the node
+func (s *sparseFiles) setDirs(dirs []string) {
+	s.dirsLock.Lock()
+	defer s.dirsLock.Unlock()
+	s.dirs = dirs
+}
+
+// getDirs returns the directories of the sparse files configured on the node
+func (s *sparseFiles) getDirs() []string {
+	s.dirsLock.RLock()
+	defer s.dirsLock.RUnlock()
+	return s.dirs
+}
+
+// ListSparseFiles returns the sparse files in the sparse file directories, sorted
+// by the path
+func (c *Controller) ListSparseFiles() ([]SparseFile, error) {
+	sparseFileDirs := c.sparseFileDirs()
+	if len(sparseFileDirs) == 0 {
+		return nil, errSparseDisabled
+	}
+	sparseFiles := make([]SparseFile, 0)
+	for _, sparseFileDir := range sparseFileDirs {
+		files, err := ioutil.ReadDir(sparseFileDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !strings.HasSuffix(file.Name(), SparseFileName) {
+				continue
+			}
+			sparseFile := path.Join(sparseFileDir, file.Name())
+			sparseFiles = append(sparseFiles, SparseFile{
+				Path:        sparseFile,
+				Size:        file.Size(),
+				BlockDevice: GetSparseBlockDeviceUUID(c.getUUIDHostName(), sparseFile),
+			})
+		}
+	}
+	sort.Slice(sparseFiles, func(i, j int) bool { return sparseFiles[i].Path < sparseFiles[j].Path })
+	return sparseFiles, nil
+}
+
+// CreateSparseFile creates a sparse file of the given size with the next free
+// index in the first sparse file directory, and its blockdevice
+func (c *Controller) CreateSparseFile(size int64) (*SparseFile, error) {
+	if DryRun {
+		return nil, errDryRun
+	}
+	if size < SparseFileMinSize {
+		return nil, fmt.Errorf("%d: %w", size, errSparseTooSmall)
+	}
+	c.sparseFiles.Lock()
+	defer c.sparseFiles.Unlock()
+	existing, err := c.ListSparseFiles()
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(existing))
+	for _, file := range existing {
+		used[file.Path] = true
+	}
+	sparseFile := ""
+	for i := 0; ; i++ {
+		sparseFile = path.Join(c.sparseFileDirs()[0], strconv.Itoa(i)+"-"+SparseFileName)
+		if !used[sparseFile] {
+			break
+		}
+	}
+	if err := util.SparseFileCreate(sparseFile, size); err != nil {
+		return nil, err
+	}
+	logger.Infof("created sparse file %s of size %d", sparseFile, size)
+	c.MarkSparseBlockDeviceStateActive(sparseFile, size)
+	return c.findSparseFile(sparseFile)
+}
+
+// ResizeSparseFile resizes the sparse file, and updates the capacity of its
+// blockdevice. A claimed sparse file can only be grown.
+func (c *Controller) ResizeSparseFile(name string, size int64) (*SparseFile, error) {
+	if DryRun {
+		return nil, errDryRun
+	}
+	if size < SparseFileMinSize {
+		return nil, fmt.Errorf("%d: %w", size, errSparseTooSmall)
+	}
+	c.sparseFiles.Lock()
+	defer c.sparseFiles.Unlock()
+	sparseFile, err := c.findSparseFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if size < sparseFile.Size {
+		if err := c.checkSparseFileUnclaimed(sparseFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Truncate(sparseFile.Path, size); err != nil {
+		return nil, err
+	}
+	logger.Infof("resized sparse file %s from %d to %d", sparseFile.Path, sparseFile.Size, size)
+	c.MarkSparseBlockDeviceStateActive(sparseFile.Path, size)
+	return c.findSparseFile(sparseFile.Path)
+}
+
+// DeleteSparseFile deletes the unclaimed sparse file and its blockdevice
+func (c *Controller) DeleteSparseFile(name string) (*SparseFile, error) {
+	if DryRun {
+		return nil, errDryRun
+	}
+	c.sparseFiles.Lock()
+	defer c.sparseFiles.Unlock()
+	sparseFile, err := c.findSparseFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkSparseFileUnclaimed(sparseFile); err != nil {
+		return nil, err
+	}
+	blockDevice, err := c.GetBlockDevice(sparseFile.BlockDevice)
+	if err != nil {
+		blockDevice = nil
+	}
+	if err := c.deleteSparseFile(sparseFile.Path, blockDevice); err != nil {
+		return nil, err
+	}
+	return sparseFile, nil
+}
+
+// deleteSparseFile detaches the loop devices of the sparse file, and deletes the
+// sparse file and its blockdevice if it has one
+func (c *Controller) deleteSparseFile(sparseFile string, blockDevice *apis.BlockDevice) error {
+	if DryRun {
+		return errDryRun
+	}
+	if sparseLoopDevicesEnabled() || (blockDevice != nil && blockDevice.Spec.Path != sparseFile) {
+		if err := detachLoopDevices(sparseFile); err != nil {
+			return err
+		}
+	}
+	if err := util.SparseFileDelete(sparseFile); err != nil {
+		return err
+	}
+	logger.Infof("deleted sparse file %s", sparseFile)
+	if blockDevice == nil {
+		return nil
+	}
+	// the deletion is recorded so that the blockdevice is not recreated
+	c.recordDeletion(blockDevice.Name, true)
+	if err := c.Clientset.Delete(context.TODO(), blockDevice); err != nil {
+		c.recordDeletion(blockDevice.Name, false)
+		return fmt.Errorf("sparse file %s deleted, but not its blockdevice %s: %v",
+			sparseFile, blockDevice.Name, err)
+	}
+	c.journal.remove(blockDevice.Name)
+	return nil
+}
+
+// findSparseFile returns the sparse file with the given blockdevice or path
+func (c *Controller) findSparseFile(name string) (*SparseFile, error) {
+	sparseFiles, err := c.ListSparseFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, sparseFile := range sparseFiles {
+		if sparseFile.Path == name || sparseFile.BlockDevice == name {
+			return &sparseFile, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", name, errSparseNotFound)
+}
+
+// checkSparseFileUnclaimed returns an error if the blockdevice of the sparse file
+// is claimed
+func (c *Controller) checkSparseFileUnclaimed(sparseFile *SparseFile) error {
+	blockDevice, err := c.GetBlockDevice(sparseFile.BlockDevice)
+	if err != nil {
+		// the sparse file without a blockdevice cannot be claimed
+		return nil
+	}
+	if blockDevice.Status.ClaimState != apis.BlockDeviceUnclaimed {
+		return fmt.Errorf("%s: %w by %s", sparseFile.Path, errSparseClaimed, claimName(blockDevice))
+	}
+	return nil
+}
+
+// claimName returns the name of the claim of the blockdevice
+func claimName(blockDevice *apis.BlockDevice) string {
+	if blockDevice.Spec.ClaimRef == nil {
+		return string(blockDevice.Status.ClaimState)
+	}
+	return blockDevice.Spec.ClaimRef.Name
+}
+
+// sparseHandler lists the sparse files on GET, creates a sparse file on POST,
+// resizes one on PUT and deletes one on DELETE. The created, resized or deleted
+// sparse file is returned.
+func (c *Controller) sparseHandler(w http.ResponseWriter, r *http.Request) {
+	var result interface{}
+	var err error
+	if r.Method == http.MethodGet {
+		result, err = c.ListSparseFiles()
+	} else {
+		req := &SparseRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			result, err = c.CreateSparseFile(req.Size)
+		case http.MethodPut:
+			result, err = c.ResizeSparseFile(req.Name, req.Size)
+		case http.MethodDelete:
+			result, err = c.DeleteSparseFile(req.Name)
+		default:
+			w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case err == errSparseDisabled, err == errDryRun, errors.Is(err, errSparseClaimed):
+			status = http.StatusConflict
+		case errors.Is(err, errSparseNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, errSparseTooSmall):
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		logger.Errorf("error writing the sparse files: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparseHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sparse")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv(EnvSparseFileDir)
+	os.Unsetenv(EnvSparseFileDir)
+
+	c := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      CreateFakeClient(t),
+		Namespace:      "openebs",
+	}
+	request := func(method, body string) (int, string) {
+		rec := httptest.NewRecorder()
+		c.sparseHandler(rec, httptest.NewRequest(method, SparsePath, strings.NewReader(body)))
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	code, body := request(http.MethodGet, "")
+	assert.Equal(t, http.StatusConflict, code, body)
+
+	os.Setenv(EnvSparseFileDir, dir)
+	code, body = request(http.MethodPost, `{"size": 1024}`)
+	assert.Equal(t, http.StatusBadRequest, code, body)
+	code, body = request(http.MethodPost, `{"size": 1073741824}`)
+	require.Equal(t, http.StatusOK, code, body)
+	created := SparseFile{}
+	require.NoError(t, json.Unmarshal([]byte(body), &created))
+	sparseFile := filepath.Join(dir, "0-"+SparseFileName)
+	bdName := GetSparseBlockDeviceUUID(fakeHostName, sparseFile)
+	assert.Equal(t, SparseFile{Path: sparseFile, Size: 1 << 30, BlockDevice: bdName}, created)
+	bd, err := c.GetBlockDevice(bdName)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<30), bd.Spec.Capacity.Storage)
+
+	// the next free index is used
+	code, body = request(http.MethodPost, `{"size": 1073741824}`)
+	require.Equal(t, http.StatusOK, code, body)
+	assert.Contains(t, body, "1-"+SparseFileName)
+
+	code, body = request(http.MethodPut, `{"name": "`+bdName+`", "size": 2147483648}`)
+	require.Equal(t, http.StatusOK, code, body)
+	bd, err = c.GetBlockDevice(bdName)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2<<30), bd.Spec.Capacity.Storage)
+	info, err := os.Stat(sparseFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2<<30), info.Size())
+
+	// a claimed sparse file can be grown, but not shrunk or deleted
+	bd.Status.ClaimState = apis.BlockDeviceClaimed
+	require.NoError(t, c.Clientset.Update(context.TODO(), bd))
+	code, body = request(http.MethodPut, `{"name": "`+sparseFile+`", "size": 1073741824}`)
+	assert.Equal(t, http.StatusConflict, code, body)
+	code, body = request(http.MethodDelete, `{"name": "`+sparseFile+`"}`)
+	assert.Equal(t, http.StatusConflict, code, body)
+
+	bd.Status.ClaimState = apis.BlockDeviceUnclaimed
+	require.NoError(t, c.Clientset.Update(context.TODO(), bd))
+	code, body = request(http.MethodDelete, `{"name": "`+sparseFile+`"}`)
+	require.Equal(t, http.StatusOK, code, body)
+	_, err = os.Stat(sparseFile)
+	assert.True(t, os.IsNotExist(err))
+	_, err = c.GetBlockDevice(bdName)
+	assert.Error(t, err)
+
+	code, body = request(http.MethodDelete, `{"name": "`+sparseFile+`"}`)
+	assert.Equal(t, http.StatusNotFound, code, body)
+
+	code, body = request(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, code, body)
+	files := []SparseFile{}
+	require.NoError(t, json.Unmarshal([]byte(body), &files))
+	require.Len(t, files, 1)
+	assert.Equal(t, filepath.Join(dir, "1-"+SparseFileName), files[0].Path)
+}
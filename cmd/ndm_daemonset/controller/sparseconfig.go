@@ -0,0 +1,219 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/pkg/util"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EnvSparseFiles declares the sparse files to be created, as a comma separated
+	// list of groups of sparse files, each of which is [count x]size[:directory],
+	// eg: 2x10Gi,20Gi:/mnt/fast. The sparse files without a directory are created in
+	// EnvSparseFileDir. It takes precedence over EnvSparseFileSize and EnvSparseFileCount.
+	EnvSparseFiles = "SPARSE_FILES"
+	// NodeSparseFilesAnnotation is the annotation of the node which overrides the
+	// sparse files declared in EnvSparseFiles on that node. An empty value disables
+	// the sparse files on the node.
+	NodeSparseFilesAnnotation = "ndm.io/sparse-files"
+)
+
+// SparseFileGroup is a group of sparse files of the same size in a directory
+type SparseFileGroup struct {
+	// Count is the number of sparse files
+	Count int
+	// Size is the size of each sparse file in bytes
+	Size int64
+	// Dir is the directory of the sparse files
+	Dir string
+}
+
+// sparseFileSpec is a sparse file to be created
+type sparseFileSpec struct {
+	path string
+	size int64
+}
+
+// ParseSparseFiles parses the groups of sparse files in the format of
+// EnvSparseFiles. The groups without a directory use the default directory.
+func ParseSparseFiles(value, defaultDir string) ([]SparseFileGroup, error) {
+	groups := make([]SparseFileGroup, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		group := SparseFileGroup{Count: 1, Dir: defaultDir}
+		if i := strings.IndexByte(item, ':'); i >= 0 {
+			group.Dir = item[i+1:]
+			item = item[:i]
+			if !filepath.IsAbs(group.Dir) {
+				return nil, fmt.Errorf("directory %q of the sparse files is not an absolute path", group.Dir)
+			}
+		}
+		if len(group.Dir) == 0 {
+			return nil, fmt.Errorf("no directory for the sparse files %q, and %s is not set", item, EnvSparseFileDir)
+		}
+		if i := strings.IndexByte(item, 'x'); i >= 0 {
+			count, err := strconv.Atoi(item[:i])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("invalid count of sparse files %q", item[:i])
+			}
+			group.Count = count
+			item = item[i+1:]
+		}
+		size, err := resource.ParseQuantity(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size of sparse files %q: %v", item, err)
+		}
+		group.Size = size.Value()
+		if group.Size < SparseFileMinSize {
+			logger.Infof("%s is less than minimum required. Setting the size to: %d", item, SparseFileMinSize)
+			group.Size = SparseFileMinSize
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// getSparseFileGroups returns the groups of sparse files to be created on the node,
+// from the annotation of the node, the sparse config, EnvSparseFiles, or else
+// EnvSparseFileSize and EnvSparseFileCount. Nothing is returned if the sparse
+// files are not configured, and an error if the configuration is invalid or a
+// directory is not in the allowed host paths.
+func getSparseFileGroups(node *v1.Node, sparseConfig *SparseConfig) ([]SparseFileGroup, error) {
+	groups, err := getConfiguredSparseFileGroups(node, sparseConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if !IsHostPathAllowed(group.Dir) {
+			return nil, fmt.Errorf("directory %s of the sparse files is not in the allowed host paths", group.Dir)
+		}
+	}
+	return groups, nil
+}
+
+// getConfiguredSparseFileGroups returns the groups of sparse files configured
+// by the first of the sources of getSparseFileGroups which is set
+func getConfiguredSparseFileGroups(node *v1.Node, sparseConfig *SparseConfig) ([]SparseFileGroup, error) {
+	defaultDir := os.Getenv(EnvSparseFileDir)
+	source, value := EnvSparseFiles, os.Getenv(EnvSparseFiles)
+	if annotation, annotated := getNodeSparseFiles(node); annotated {
+		source, value = NodeSparseFilesAnnotation+" of node "+node.Name, annotation
+	} else if sparseConfig != nil {
+		source, value = "sparseconfig.files", sparseConfig.Files
+	} else if len(value) == 0 {
+		return getDefaultSparseFileGroups(), nil
+	}
+	groups, err := ParseSparseFiles(value, defaultDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", source, value, err)
+	}
+	return groups, nil
+}
+
+// getNodeSparseFiles returns the NodeSparseFilesAnnotation of the node, and whether
+// it is present
+func getNodeSparseFiles(node *v1.Node) (string, bool) {
+	if node == nil {
+		return "", false
+	}
+	annotation, ok := node.Annotations[NodeSparseFilesAnnotation]
+	return annotation, ok
+}
+
+// getDefaultSparseFileGroups returns the sparse files of EnvSparseFileSize and
+// EnvSparseFileCount in EnvSparseFileDir
+func getDefaultSparseFileGroups() []SparseFileGroup {
+	sparseFileDir := GetSparseFileDir()
+	sparseFileSize := GetSparseFileSize()
+	sparseFileCount := GetSparseFileCount()
+	if len(sparseFileDir) < 1 || sparseFileSize < 1 || sparseFileCount < 1 {
+		return nil
+	}
+	return []SparseFileGroup{{Count: sparseFileCount, Size: sparseFileSize, Dir: sparseFileDir}}
+}
+
+// getSparseFileSpecs returns the sparse files of the groups. The sparse files of a
+// directory are numbered from 0, in the order of the groups, including the groups
+// whose directory does not exist.
+func getSparseFileSpecs(groups []SparseFileGroup) []sparseFileSpec {
+	specs := make([]sparseFileSpec, 0)
+	next := make(map[string]int)
+	for _, group := range groups {
+		for i := 0; i < group.Count; i++ {
+			sparseFile := path.Join(group.Dir, strconv.Itoa(next[group.Dir])+"-"+SparseFileName)
+			next[group.Dir]++
+			specs = append(specs, sparseFileSpec{path: sparseFile, size: group.Size})
+		}
+	}
+	return specs
+}
+
+// getSparseFileDirs returns the directories of the groups, without duplicates
+func getSparseFileDirs(groups []SparseFileGroup) []string {
+	dirs := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if !util.Contains(dirs, group.Dir) {
+			dirs = append(dirs, group.Dir)
+		}
+	}
+	return dirs
+}
+
+// fetchNode gets the node in which the daemon is running, or nil if it cannot be
+// fetched
+func (c *Controller) fetchNode() *v1.Node {
+	nodeName := c.NodeAttributes[NodeNameKey]
+	if c.Clientset == nil || len(nodeName) == 0 {
+		return nil
+	}
+	node := &v1.Node{}
+	err := c.Clientset.Get(context.TODO(), client.ObjectKey{Namespace: "", Name: nodeName}, node)
+	if err != nil {
+		logger.Errorf("unable to get the sparse files of node %s: %v", nodeName, err)
+		return nil
+	}
+	return node
+}
+
+// sparseFileDirs returns the directories in which the sparse files of the node are
+// kept, which are EnvSparseFileDir and the directories of the configured sparse files
+func (c *Controller) sparseFileDirs() []string {
+	dirs := make([]string, 0)
+	if dir := GetSparseFileDir(); len(dir) != 0 {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range c.sparseFiles.getDirs() {
+		if !util.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
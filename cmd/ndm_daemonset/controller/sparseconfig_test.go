@@ -0,0 +1,303 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseSparseFiles(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    []SparseFileGroup
+		wantErr bool
+	}{
+		"sizes, counts and directories": {
+			value: "2x10Gi, 1073741824:/mnt/fast,",
+			want: []SparseFileGroup{
+				{Count: 2, Size: 10 << 30, Dir: "/var/openebs/sparse"},
+				{Count: 1, Size: 1 << 30, Dir: "/mnt/fast"},
+			},
+		},
+		"size less than the min size": {
+			value: "3x1Mi",
+			want:  []SparseFileGroup{{Count: 3, Size: SparseFileMinSize, Dir: "/var/openebs/sparse"}},
+		},
+		"no sparse files": {
+			value: "",
+			want:  []SparseFileGroup{},
+		},
+		"invalid count": {
+			value:   "ax10Gi",
+			wantErr: true,
+		},
+		"invalid size": {
+			value:   "2x10GB",
+			wantErr: true,
+		},
+		"relative directory": {
+			value:   "10Gi:sparse",
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseSparseFiles(test.value, "/var/openebs/sparse")
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	_, err := ParseSparseFiles("10Gi", "")
+	assert.Error(t, err, "sparse files without a directory")
+}
+
+func TestGetSparseFileGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sparse")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv(EnvSparseFileDir)
+	defer os.Unsetenv(EnvSparseFiles)
+	defer os.Unsetenv(EnvSparseFileCount)
+
+	tests := map[string]struct {
+		sparseFiles  string
+		sparseConfig *SparseConfig
+		annotations  map[string]string
+		want         []SparseFileGroup
+		wantErr      bool
+	}{
+		"count and size of the sparse files": {
+			want: []SparseFileGroup{{Count: 2, Size: SparseFileDefaultSize, Dir: dir}},
+		},
+		"sparse files": {
+			sparseFiles: "1x2Gi,4Gi:/invalid",
+			want:        []SparseFileGroup{{Count: 1, Size: 2 << 30, Dir: dir}, {Count: 1, Size: 4 << 30, Dir: "/invalid"}},
+		},
+		"sparse files of the node": {
+			sparseFiles: "1x2Gi",
+			annotations: map[string]string{NodeSparseFilesAnnotation: "3x1Gi"},
+			want:        []SparseFileGroup{{Count: 3, Size: 1 << 30, Dir: dir}},
+		},
+		"sparse files disabled on the node": {
+			sparseFiles: "1x2Gi",
+			annotations: map[string]string{NodeSparseFilesAnnotation: ""},
+			want:        []SparseFileGroup{},
+		},
+		"sparse files of the config": {
+			sparseFiles:  "1x2Gi",
+			sparseConfig: &SparseConfig{Files: "2x3Gi"},
+			want:         []SparseFileGroup{{Count: 2, Size: 3 << 30, Dir: dir}},
+		},
+		"sparse files disabled in the config": {
+			sparseFiles:  "1x2Gi",
+			sparseConfig: &SparseConfig{},
+			want:         []SparseFileGroup{},
+		},
+		"sparse files of the node override the config": {
+			sparseConfig: &SparseConfig{Files: "2x3Gi"},
+			annotations:  map[string]string{NodeSparseFilesAnnotation: "3x1Gi"},
+			want:         []SparseFileGroup{{Count: 3, Size: 1 << 30, Dir: dir}},
+		},
+		"invalid sparse files": {
+			sparseFiles: "two",
+			wantErr:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv(EnvSparseFileDir, dir)
+			os.Setenv(EnvSparseFileCount, "2")
+			os.Setenv(EnvSparseFiles, test.sparseFiles)
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Annotations: test.annotations}}
+			groups, err := getSparseFileGroups(node, test.sparseConfig)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, groups)
+		})
+	}
+}
+
+func TestGetSparseFileSpecs(t *testing.T) {
+	specs := getSparseFileSpecs([]SparseFileGroup{
+		{Count: 2, Size: 1 << 30, Dir: "/var/openebs/sparse"},
+		{Count: 1, Size: 2 << 30, Dir: "/mnt/fast"},
+		{Count: 1, Size: 4 << 30, Dir: "/var/openebs/sparse"},
+	})
+	assert.Equal(t, []sparseFileSpec{
+		{path: "/var/openebs/sparse/0-ndm-sparse.img", size: 1 << 30},
+		{path: "/var/openebs/sparse/1-ndm-sparse.img", size: 1 << 30},
+		{path: "/mnt/fast/0-ndm-sparse.img", size: 2 << 30},
+		{path: "/var/openebs/sparse/2-ndm-sparse.img", size: 4 << 30},
+	}, specs)
+}
+
+func TestInitializeSparseFilesOfNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sparse")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fastDir := filepath.Join(dir, "fast")
+	require.NoError(t, os.Mkdir(fastDir, 0755))
+	os.Unsetenv(EnvSparseFileDir)
+	os.Setenv(EnvSparseFiles, "1x1Gi:"+dir)
+	defer os.Unsetenv(EnvSparseFiles)
+
+	c := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName, NodeNameKey: "node-1"},
+		Clientset:      CreateFakeClient(t),
+	}
+	require.NoError(t, c.Clientset.Create(context.TODO(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1",
+		Annotations: map[string]string{NodeSparseFilesAnnotation: "1x1Gi:" + dir + ",2Gi:" + fastDir}}}))
+
+	c.InitializeSparseFiles()
+	sparseFiles, err := c.ListSparseFiles()
+	require.NoError(t, err)
+	require.Len(t, sparseFiles, 2)
+	assert.Equal(t, filepath.Join(dir, "0-"+SparseFileName), sparseFiles[0].Path)
+	assert.Equal(t, int64(1<<30), sparseFiles[0].Size)
+	assert.Equal(t, filepath.Join(fastDir, "0-"+SparseFileName), sparseFiles[1].Path)
+	assert.Equal(t, int64(2<<30), sparseFiles[1].Size)
+	bd, err := c.GetBlockDevice(sparseFiles[1].BlockDevice)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2<<30), bd.Spec.Capacity.Storage)
+	assert.Len(t, GetActiveSparseBlockDevicesUUID(fakeHostName, c.sparseFileDirs()), 2)
+}
+
+func TestReloadSparseFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sparse")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Unsetenv(EnvSparseFileDir)
+	os.Unsetenv(EnvSparseFiles)
+
+	c := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName, NodeNameKey: "node-1"},
+		Clientset:      CreateFakeClient(t),
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1",
+		Annotations: map[string]string{NodeSparseFilesAnnotation: "1x1Gi:" + dir}}}
+	require.NoError(t, c.Clientset.Create(context.TODO(), node))
+	c.InitializeSparseFiles()
+	sparseFile := filepath.Join(dir, "0-"+SparseFileName)
+	bdName := GetSparseBlockDeviceUUID(fakeHostName, sparseFile)
+	bd, err := c.GetBlockDevice(bdName)
+	require.NoError(t, err)
+	bd.Status.ClaimState = apis.BlockDeviceClaimed
+	bd.Spec.ClaimRef = &v1.ObjectReference{Name: "bdc-1"}
+	require.NoError(t, c.Clientset.Update(context.TODO(), bd))
+
+	// the claimed sparse file is grown in place
+	node.Annotations[NodeSparseFilesAnnotation] = "1x2Gi:" + dir
+	require.NoError(t, c.Clientset.Update(context.TODO(), node))
+	c.ReloadSparseFiles()
+	info, err := os.Stat(sparseFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2<<30), info.Size())
+	bd, err = c.GetBlockDevice(bdName)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2<<30), bd.Spec.Capacity.Storage)
+	assert.Equal(t, apis.BlockDeviceClaimed, bd.Status.ClaimState)
+	assert.Equal(t, "bdc-1", bd.Spec.ClaimRef.Name)
+
+	// a smaller size does not shrink the sparse file
+	node.Annotations[NodeSparseFilesAnnotation] = "1x1Gi:" + dir
+	require.NoError(t, c.Clientset.Update(context.TODO(), node))
+	c.ReloadSparseFiles()
+	info, err = os.Stat(sparseFile)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2<<30), info.Size())
+}
+
+func TestRetireSparseFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sparse")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Unsetenv(EnvSparseFileDir)
+	os.Unsetenv(EnvSparseFiles)
+
+	c := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName, NodeNameKey: "node-1"},
+		Clientset:      CreateFakeClient(t),
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1",
+		Annotations: map[string]string{NodeSparseFilesAnnotation: "3x1Gi:" + dir}}}
+	require.NoError(t, c.Clientset.Create(context.TODO(), node))
+	c.InitializeSparseFiles()
+	apiFile, err := c.CreateSparseFile(1 << 30)
+	require.NoError(t, err)
+
+	claimedFile := filepath.Join(dir, "1-"+SparseFileName)
+	claimedName := GetSparseBlockDeviceUUID(fakeHostName, claimedFile)
+	bd, err := c.GetBlockDevice(claimedName)
+	require.NoError(t, err)
+	assert.Equal(t, TrueString, bd.Annotations[SparseConfigAnnotation])
+	bd.Status.ClaimState = apis.BlockDeviceClaimed
+	bd.Spec.ClaimRef = &v1.ObjectReference{Name: "bdc-1"}
+	require.NoError(t, c.Clientset.Update(context.TODO(), bd))
+
+	// the unclaimed sparse file is deleted, and the claimed one is deactivated
+	node.Annotations[NodeSparseFilesAnnotation] = "1x1Gi:" + dir
+	require.NoError(t, c.Clientset.Update(context.TODO(), node))
+	c.ReloadSparseFiles()
+	unclaimedFile := filepath.Join(dir, "2-"+SparseFileName)
+	_, err = os.Stat(unclaimedFile)
+	assert.True(t, os.IsNotExist(err))
+	_, err = c.GetBlockDevice(GetSparseBlockDeviceUUID(fakeHostName, unclaimedFile))
+	assert.Error(t, err)
+	_, err = os.Stat(claimedFile)
+	require.NoError(t, err)
+	bd, err = c.GetBlockDevice(claimedName)
+	require.NoError(t, err)
+	assert.Equal(t, apis.BlockDeviceState(NDMInactive), bd.Status.State)
+	assert.Equal(t, apis.BlockDeviceClaimed, bd.Status.ClaimState)
+
+	// the sparse file created using the api is not retired
+	_, err = os.Stat(apiFile.Path)
+	require.NoError(t, err)
+	_, err = c.GetBlockDevice(apiFile.BlockDevice)
+	require.NoError(t, err)
+
+	// the retired sparse file is deleted once it is unclaimed
+	bd.Status.ClaimState = apis.BlockDeviceUnclaimed
+	bd.Spec.ClaimRef = nil
+	require.NoError(t, c.Clientset.Update(context.TODO(), bd))
+	c.ReloadSparseFiles()
+	_, err = os.Stat(claimedFile)
+	assert.True(t, os.IsNotExist(err))
+	_, err = c.GetBlockDevice(claimedName)
+	assert.Error(t, err)
+	assert.False(t, c.sparseFiles.retiring)
+	_, err = os.Stat(filepath.Join(dir, "0-"+SparseFileName))
+	require.NoError(t, err)
+}
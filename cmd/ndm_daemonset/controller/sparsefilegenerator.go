@@ -22,12 +22,15 @@ import (
 
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/pkg/util"
-	"k8s.io/klog"
 
 	"fmt"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
 )
 
 /*
@@ -41,6 +44,14 @@ environment variable, a Sparse file with specified size (EnvSparseFileSize) will
 be created and an associated BlockDevice CR will be added to Kubernetes. By default
 only one sparse file will be created which can be changed by passing the desired
 number of sparse files required via the environment variable EnvSparseFileCount.
+Sparse files of different sizes and directories can be declared using the
+environment variable EnvSparseFiles, which is overridden on a node by its
+NodeSparseFilesAnnotation.
+
+An existing sparse file smaller than its configured size is grown, and the
+capacity of its BlockDevice CR is updated in place, so that its claim is kept.
+The sparse files are also created and grown when the NodeSparseFilesAnnotation
+of the node changes, without restarting NDM.
 
 On Shutdown, the status of the sparse file BlockDevice CR will be marked as Unknown.
 */
@@ -83,7 +94,7 @@ func GetSparseFileDir() string {
 
 	info, err := os.Stat(sparseFileDir)
 	if os.IsNotExist(err) || !info.Mode().IsDir() {
-		klog.Info("Specified directory doesnt exist:  ", sparseFileDir)
+		logger.Infof("Specified directory doesnt exist:  %v", sparseFileDir)
 		return ""
 	}
 
@@ -91,7 +102,8 @@ func GetSparseFileDir() string {
 }
 
 // GetSparseFileCount returns the number of sparse files to be
-//  created by NDM. Returns 0, if invalid count is specified.
+//
+//	created by NDM. Returns 0, if invalid count is specified.
 func GetSparseFileCount() int {
 
 	sparseFileCountStr := os.Getenv(EnvSparseFileCount)
@@ -102,7 +114,7 @@ func GetSparseFileCount() int {
 
 	sparseFileCount, econv := strconv.Atoi(sparseFileCountStr)
 	if econv != nil {
-		klog.Info("Error converting sparse file count:  ", sparseFileCountStr)
+		logger.Infof("Error converting sparse file count:  %v", sparseFileCountStr)
 		return 0
 	}
 
@@ -110,24 +122,25 @@ func GetSparseFileCount() int {
 }
 
 // GetSparseFileSize returns the size of the sparse file to be
-//  created by NDM. Returns 0, if invalid size is specified.
+//
+//	created by NDM. Returns 0, if invalid size is specified.
 func GetSparseFileSize() int64 {
 
 	sparseFileSizeStr := os.Getenv(EnvSparseFileSize)
 	if len(sparseFileSizeStr) < 1 {
-		klog.Info("No size was specified. Using default size: ", fmt.Sprint(SparseFileDefaultSize))
+		logger.Infof("No size was specified. Using default size: %v", fmt.Sprint(SparseFileDefaultSize))
 		return SparseFileDefaultSize
 	}
 
 	fileSize, econv := strconv.ParseFloat(sparseFileSizeStr, 64)
 	if econv != nil {
-		klog.Error("Error converting sparse file size:  ", econv)
+		logger.Errorf("Error converting sparse file size:  %v", econv)
 		return 0
 	}
 	sparseFileSize := int64(fileSize)
 
 	if sparseFileSize < SparseFileMinSize {
-		klog.Info(fmt.Sprint(sparseFileSizeStr), " is less than minimum required. Setting the size to:  ", fmt.Sprint(SparseFileMinSize))
+		logger.Infof("%v is less than minimum required. Setting the size to:  %v", fmt.Sprint(sparseFileSizeStr), fmt.Sprint(SparseFileMinSize))
 		return SparseFileMinSize
 	}
 
@@ -135,41 +148,142 @@ func GetSparseFileSize() int64 {
 }
 
 // InitializeSparseFiles will check if the sparse file exist or have to be
-// created and will update or create the associated BlockDevice CR accordingly
+// created and will update or create the associated BlockDevice CR accordingly.
+// The loop devices of the existing sparse files are attached first if enabled.
 func (c *Controller) InitializeSparseFiles() {
-	sparseFileDir := GetSparseFileDir()
-	sparseFileSize := GetSparseFileSize()
-	sparseFileCount := GetSparseFileCount()
+	node := c.fetchNode()
+	c.sparseFiles.Lock()
+	defer c.sparseFiles.Unlock()
+	c.syncSparseLoopDevices()
+	c.sparseFiles.annotation, c.sparseFiles.annotated = getNodeSparseFiles(node)
+	c.sparseFiles.config = c.getSparseConfig()
+	c.applySparseFiles(node)
+}
+
+// getSparseConfig returns the sparse config in the ndm config, nil if not set
+func (c *Controller) getSparseConfig() *SparseConfig {
+	if ndmConfig := c.GetNDMConfig(); ndmConfig != nil {
+		return ndmConfig.SparseConfig
+	}
+	return nil
+}
+
+// WatchSparseFiles creates, grows and retires the sparse files of the node when
+// its NodeSparseFilesAnnotation or the sparse config changes, and deletes the
+// retired sparse files once their blockdevices are unclaimed
+func (c *Controller) WatchSparseFiles(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(ConfigReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			c.ReloadSparseFiles()
+		}
+	}
+}
+
+// ReloadSparseFiles applies the sparse files of the node if its
+// NodeSparseFilesAnnotation or the sparse config has changed since they were
+// last applied, or if some sparse files are waiting to be retired
+func (c *Controller) ReloadSparseFiles() {
+	node := c.fetchNode()
+	if node == nil {
+		return
+	}
+	annotation, annotated := getNodeSparseFiles(node)
+	config := c.getSparseConfig()
+	c.sparseFiles.Lock()
+	defer c.sparseFiles.Unlock()
+	configChanged := !reflect.DeepEqual(config, c.sparseFiles.config)
+	if annotation == c.sparseFiles.annotation && annotated == c.sparseFiles.annotated && !configChanged {
+		if c.sparseFiles.retiring {
+			c.sparseFiles.retiring = c.retireSparseFiles(c.sparseFiles.configured)
+		}
+		return
+	}
+	if configChanged {
+		logger.Infof("sparse config changed, applying the sparse files")
+	} else {
+		logger.Infof("%s of node %s changed from %q to %q, applying the sparse files",
+			NodeSparseFilesAnnotation, node.Name, c.sparseFiles.annotation, annotation)
+	}
+	c.sparseFiles.annotation, c.sparseFiles.annotated = annotation, annotated
+	c.sparseFiles.config = config
+	c.applySparseFiles(node)
+}
 
-	if len(sparseFileDir) < 1 || sparseFileSize < 1 || sparseFileCount < 1 {
-		klog.Info("No sparse file path/size provided. Skip creating sparse files.")
+// applySparseFiles creates or grows the sparse files configured on the node, and
+// creates or updates their blockdevices. The sparse files which are no longer
+// configured are retired, if the node could be fetched, as the annotation of the
+// node may configure them. The sparse files lock must be held.
+func (c *Controller) applySparseFiles(node *v1.Node) {
+	groups, err := getSparseFileGroups(node, c.sparseFiles.config)
+	if err != nil {
+		// the existing sparse files are kept till the configuration is fixed
+		logger.Errorf("not applying the sparse files: %v", err)
 		return
 	}
+	c.sparseFiles.setDirs(getSparseFileDirs(groups))
 
-	for i := 0; i < sparseFileCount; i++ {
-		sparseFile := path.Join(sparseFileDir, fmt.Sprint(i)+"-"+SparseFileName)
-		err := CheckAndCreateSparseFile(sparseFile, sparseFileSize)
+	specs := getSparseFileSpecs(groups)
+	c.sparseFiles.configured = make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		c.sparseFiles.configured[spec.path] = true
+	}
+	if node != nil {
+		c.sparseFiles.retiring = c.retireSparseFiles(c.sparseFiles.configured)
+	}
+	if len(specs) == 0 {
+		logger.Infof("No sparse file path/size provided. Skip creating sparse files.")
+		return
+	}
+
+	for _, spec := range specs {
+		info, err := os.Stat(path.Dir(spec.path))
+		if err != nil || !info.IsDir() {
+			logger.Infof("Specified directory doesnt exist: %v", path.Dir(spec.path))
+			continue
+		}
+		err = CheckAndCreateSparseFile(spec.path, spec.size)
 		if err != nil {
-			klog.Info("Error creating sparse file: ", sparseFile, "Error: ", err)
+			logger.Infof("Error creating sparse file: %vError: %v", spec.path, err)
 			continue
 		}
-		c.MarkSparseBlockDeviceStateActive(sparseFile, sparseFileSize)
+		c.markSparseBlockDeviceActive(spec.path, true)
 	}
 }
 
 // CheckAndCreateSparseFile will reuse the existing sparse file if it already exists,
 // for handling cases where NDM is upgraded or restarted. If the file doesn't exist
-// a new file will be created.
+// a new file will be created. An existing file smaller than the size is grown,
+// but a larger one is not shrunk, as the data beyond the size would be lost.
 func CheckAndCreateSparseFile(sparseFile string, sparseFileSize int64) error {
 	sparseFileInfo, err := util.SparseFileInfo(sparseFile)
+	if err != nil && DryRun {
+		// the sparse file is not created in the dry run mode
+		return errDryRun
+	}
 	if err != nil {
-		klog.Info("Check for existing file returned error: ", err)
-		klog.Info("Creating a new Sparse file: ", sparseFile)
-		err = util.SparseFileCreate(sparseFile, sparseFileSize)
-	} else {
-		klog.Info("Sparse file already exists: ", sparseFileInfo.Name())
+		logger.Infof("Check for existing file returned error: %v", err)
+		logger.Infof("Creating a new Sparse file: %v", sparseFile)
+		return util.SparseFileCreate(sparseFile, sparseFileSize)
+	}
+	logger.Infof("Sparse file already exists: %v", sparseFileInfo.Name())
+	switch {
+	case sparseFileInfo.Size() < sparseFileSize && DryRun:
+		logger.Infof("dry run, not resizing sparse file %s from %d to %d", sparseFile, sparseFileInfo.Size(), sparseFileSize)
+	case sparseFileInfo.Size() < sparseFileSize:
+		if err := os.Truncate(sparseFile, sparseFileSize); err != nil {
+			return err
+		}
+		logger.Infof("resized sparse file %s from %d to %d", sparseFile, sparseFileInfo.Size(), sparseFileSize)
+	case sparseFileInfo.Size() > sparseFileSize:
+		logger.Infof("sparse file %s of size %d is larger than %d, not shrinking it",
+			sparseFile, sparseFileInfo.Size(), sparseFileSize)
 	}
-	return err
+	return nil
 }
 
 // GetSparseBlockDeviceUUID returns a fixed UUID for the sparse
@@ -179,19 +293,20 @@ func GetSparseBlockDeviceUUID(hostname, sparseFile string) string {
 }
 
 // GetActiveSparseBlockDevicesUUID returns UUIDs for the sparse
-// disks present in a given node.
-func GetActiveSparseBlockDevicesUUID(hostname string) []string {
-	sparseFileLocation := GetSparseFileDir()
+// disks present in the sparse file directories of a given node.
+func GetActiveSparseBlockDevicesUUID(hostname string, sparseFileDirs []string) []string {
 	sparseUuids := make([]string, 0)
-	files, err := ioutil.ReadDir(sparseFileLocation)
-	if err != nil {
-		klog.Error("Failed to read sparse file names : ", err)
-		return sparseUuids
-	}
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), SparseFileName) {
-			fileName := path.Join(sparseFileLocation, file.Name())
-			sparseUuids = append(sparseUuids, GetSparseBlockDeviceUUID(hostname, fileName))
+	for _, sparseFileLocation := range sparseFileDirs {
+		files, err := ioutil.ReadDir(sparseFileLocation)
+		if err != nil {
+			logger.Errorf("Failed to read sparse file names : %v", err)
+			continue
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file.Name(), SparseFileName) {
+				fileName := path.Join(sparseFileLocation, file.Name())
+				sparseUuids = append(sparseUuids, GetSparseBlockDeviceUUID(hostname, fileName))
+			}
 		}
 	}
 	return sparseUuids
@@ -201,9 +316,21 @@ func GetActiveSparseBlockDevicesUUID(hostname string) []string {
 // update the state of the existing CR as Active.  Note that, when the NDM is going being
 // gracefully shutdown, all its BlockDevice CRs are marked with State as Unknown.
 func (c *Controller) MarkSparseBlockDeviceStateActive(sparseFile string, sparseFileSize int64) {
+	c.markSparseBlockDeviceActive(sparseFile, false)
+}
+
+// markSparseBlockDeviceActive creates or activates the BlockDevice CR of the sparse
+// file. The CR of a sparse file created from the configuration is annotated with
+// SparseConfigAnnotation, so that it is retired when it is no longer configured.
+// The path of the CR is the loop device of the sparse file, if they are enabled.
+func (c *Controller) markSparseBlockDeviceActive(sparseFile string, configured bool) {
 	// Fill in the details of the sparse disk
 	BlockDeviceDetails := NewDeviceInfo()
-	BlockDeviceDetails.UUID = GetSparseBlockDeviceUUID(c.NodeAttributes[HostNameKey], sparseFile)
+	BlockDeviceDetails.Annotations = make(map[string]string)
+	if configured {
+		BlockDeviceDetails.Annotations[SparseConfigAnnotation] = TrueString
+	}
+	BlockDeviceDetails.UUID = GetSparseBlockDeviceUUID(c.getUUIDHostName(), sparseFile)
 	BlockDeviceDetails.NodeAttributes = c.NodeAttributes
 
 	BlockDeviceDetails.DeviceType = blockdevice.SparseBlockDeviceType
@@ -211,14 +338,25 @@ func (c *Controller) MarkSparseBlockDeviceStateActive(sparseFile string, sparseF
 
 	sparseFileInfo, err := util.SparseFileInfo(sparseFile)
 	if err != nil {
-		klog.Info("Error fetching the size of sparse file: ", err)
-		klog.Error("Failed to create a block device CR for sparse file: ", sparseFile)
+		logger.Infof("Error fetching the size of sparse file: %v", err)
+		logger.Errorf("Failed to create a block device CR for sparse file: %v", sparseFile)
 		return
 	}
 
 	BlockDeviceDetails.Capacity = uint64(sparseFileInfo.Size())
 
+	if sparseLoopDevicesEnabled() {
+		loopDevice, err := attachLoopDevice(sparseFile)
+		if err != nil {
+			logger.Infof("Error attaching a loop device to sparse file: %v", err)
+			logger.Errorf("Failed to create a block device CR for sparse file: %v", sparseFile)
+			return
+		}
+		BlockDeviceDetails.Path = loopDevice
+		BlockDeviceDetails.Annotations[SparseFileAnnotation] = sparseFile
+	}
+
 	//If a BlockDevice CR already exits, update it. If not create a new one.
-	klog.Info("Updating the BlockDevice CR for Sparse file: ", BlockDeviceDetails.UUID)
+	logger.Infof("Updating the BlockDevice CR for Sparse file: %v", BlockDeviceDetails.UUID)
 	c.CreateBlockDevice(BlockDeviceDetails.ToDevice())
 }
@@ -102,10 +102,11 @@ func TestGetSparseFileSize(t *testing.T) {
 }
 
 // TestCheckAndCreateSparseFile verifies that a sparse file is created
-//  only when it doesn't already exist.
+//  only when it doesn't already exist, and that an existing file is only grown.
 func TestCheckAndCreateSparseFile(t *testing.T) {
 
 	testFile := "/tmp/test.img"
+	util.SparseFileDelete(testFile)
 	testFileSize := int64(1000)
 	testFileSize1 := int64(2000)
 
@@ -119,22 +120,26 @@ func TestCheckAndCreateSparseFile(t *testing.T) {
 			fileSize:     testFileSize,
 			expectedSize: testFileSize,
 		},
-		"Reuse Existing File": {
+		"Grow Existing File": {
 			fileName:     testFile,
 			fileSize:     testFileSize1,
-			expectedSize: testFileSize,
+			expectedSize: testFileSize1,
+		},
+		"Do Not Shrink Existing File": {
+			fileName:     testFile,
+			fileSize:     testFileSize,
+			expectedSize: testFileSize1,
 		},
 	}
-	for name, test := range tests {
+	for _, name := range []string{"Create New File", "Grow Existing File", "Do Not Shrink Existing File"} {
+		test := tests[name]
 		t.Run(name, func(t *testing.T) {
 			err := CheckAndCreateSparseFile(test.fileName, test.fileSize)
 			assert.Equal(t, nil, err)
-			if err != nil {
-				aFileInfo, errF := util.SparseFileInfo(test.fileName)
-				assert.Equal(t, nil, errF)
-				if errF != nil {
-					assert.Equal(t, test.expectedSize, aFileInfo.Size())
-				}
+			aFileInfo, errF := util.SparseFileInfo(test.fileName)
+			assert.Equal(t, nil, errF)
+			if errF == nil {
+				assert.Equal(t, test.expectedSize, aFileInfo.Size())
 			}
 		})
 	}
@@ -163,9 +168,7 @@ func TestGetActiveSparseBlockDevicesUUID(t *testing.T) {
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			os.Setenv(EnvSparseFileDir, test.sparseFileDir)
-			assert.Equal(t, test.expectedSparseBlockDeviceUUID, GetActiveSparseBlockDevicesUUID("instance-1"))
-			os.Unsetenv(EnvSparseFileDir)
+			assert.Equal(t, test.expectedSparseBlockDeviceUUID, GetActiveSparseBlockDevicesUUID("instance-1", []string{test.sparseFileDir}))
 		})
 	}
 }
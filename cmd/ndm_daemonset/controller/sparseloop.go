@@ -0,0 +1,175 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/util"
+)
+
+const (
+	// EnvSparseLoopDevices backs the sparse files with loop devices if it is true,
+	// the loop devices are used as the paths of their blockdevices, so that they can
+	// be partitioned, formatted and opened with O_DIRECT like the other devices
+	EnvSparseLoopDevices = "SPARSE_LOOP_DEVICES"
+
+	// SparseFileAnnotation is set on the blockdevice of a sparse file backed by a
+	// loop device, to the path of the sparse file
+	SparseFileAnnotation = "ndm.io/sparse-file"
+)
+
+// runLosetup runs losetup with the args and returns its output, replaced in the tests
+var runLosetup = func(args ...string) ([]byte, error) {
+	out, err := exec.Command("losetup", args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("losetup %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
+
+// sparseLoopDevicesEnabled returns true if the sparse files are backed by loop devices
+func sparseLoopDevicesEnabled() bool {
+	return util.CheckTruthy(os.Getenv(EnvSparseLoopDevices))
+}
+
+// getSparseFilePath returns the path of the sparse file of the sparse blockdevice
+func getSparseFilePath(blockDevice *apis.BlockDevice) string {
+	if sparseFile, ok := blockDevice.Annotations[SparseFileAnnotation]; ok {
+		return sparseFile
+	}
+	return blockDevice.Spec.Path
+}
+
+// getLoopDevices returns the loop devices backed by the sparse file
+func getLoopDevices(sparseFile string) ([]string, error) {
+	out, err := runLosetup("--list", "--noheadings", "--output", "NAME", "--associated", sparseFile)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// attachLoopDevice returns the loop device backed by the sparse file, attaching a
+// new one with direct io and partition scanning if there is none. The capacity of
+// an existing loop device is updated, since it does not follow the size of the file.
+// Only an existing loop device is returned in the dry run mode.
+func attachLoopDevice(sparseFile string) (string, error) {
+	loopDevices, err := getLoopDevices(sparseFile)
+	if err != nil {
+		return "", err
+	}
+	if DryRun {
+		if len(loopDevices) == 0 {
+			return "", errDryRun
+		}
+		return loopDevices[0], nil
+	}
+	if len(loopDevices) != 0 {
+		if _, err := runLosetup("--set-capacity", loopDevices[0]); err != nil {
+			return "", err
+		}
+		return loopDevices[0], nil
+	}
+	out, err := runLosetup("--find", "--show", "--direct-io=on", "--partscan", sparseFile)
+	if err != nil {
+		return "", err
+	}
+	loopDevice := strings.TrimSpace(string(out))
+	if len(loopDevice) == 0 {
+		return "", fmt.Errorf("no loop device attached to sparse file %s", sparseFile)
+	}
+	logger.Infof("attached loop device %s to sparse file %s", loopDevice, sparseFile)
+	return loopDevice, nil
+}
+
+// detachLoopDevices detaches the loop devices backed by the sparse file
+func detachLoopDevices(sparseFile string) error {
+	if DryRun {
+		return errDryRun
+	}
+	loopDevices, err := getLoopDevices(sparseFile)
+	if err != nil {
+		return err
+	}
+	for _, loopDevice := range loopDevices {
+		if _, err := runLosetup("--detach", loopDevice); err != nil {
+			return err
+		}
+		logger.Infof("detached loop device %s from sparse file %s", loopDevice, sparseFile)
+	}
+	return nil
+}
+
+// syncSparseLoopDevices updates the paths of the sparse blockdevices of the node on
+// startup, whatever their state. The loop devices are attached again if the sparse
+// files are backed by loop devices, as they do not persist across the reboots of the
+// node and may get other names. Otherwise the loop devices of the blockdevices which
+// were backed by them are detached, and the sparse files are used as their paths.
+func (c *Controller) syncSparseLoopDevices() {
+	if DryRun {
+		logger.Infof("dry run, not syncing the loop devices of the sparse files")
+		return
+	}
+	blockDeviceList, err := c.ListBlockDeviceResource(false)
+	if err != nil {
+		logger.Errorf("unable to sync the loop devices of the sparse files: %v", err)
+		return
+	}
+	enabled := sparseLoopDevicesEnabled()
+	for i := range blockDeviceList.Items {
+		blockDevice := &blockDeviceList.Items[i]
+		if blockDevice.Spec.Details.DeviceType != blockdevice.SparseBlockDeviceType {
+			continue
+		}
+		sparseFile := getSparseFilePath(blockDevice)
+		if _, err := os.Stat(sparseFile); err != nil {
+			continue
+		}
+		path := sparseFile
+		if enabled {
+			if path, err = attachLoopDevice(sparseFile); err != nil {
+				logger.Errorf("unable to attach a loop device to sparse file %s: %v", sparseFile, err)
+				continue
+			}
+		} else if blockDevice.Spec.Path != sparseFile {
+			if err := detachLoopDevices(sparseFile); err != nil {
+				logger.Errorf("unable to detach the loop devices of sparse file %s: %v", sparseFile, err)
+				continue
+			}
+		}
+		if blockDevice.Spec.Path == path {
+			continue
+		}
+		if blockDevice.Annotations == nil {
+			blockDevice.Annotations = make(map[string]string)
+		}
+		blockDevice.Annotations[SparseFileAnnotation] = sparseFile
+		blockDevice.Spec.Path = path
+		if err := c.Clientset.Update(context.TODO(), blockDevice); err != nil {
+			logger.Errorf("unable to update the path of blockdevice %s to %s: %v", blockDevice.Name, path, err)
+			continue
+		}
+		logger.Infof("updated the path of blockdevice %s of sparse file %s to %s", blockDevice.Name, sparseFile, path)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeLosetup keeps the loop devices attached by losetup in the tests
+type fakeLosetup struct {
+	// loopDevices are the sparse files of the attached loop devices
+	loopDevices map[string]string
+	next        int
+}
+
+func (f *fakeLosetup) run(args ...string) ([]byte, error) {
+	switch args[0] {
+	case "--list":
+		sparseFile := args[len(args)-1]
+		for loopDevice, file := range f.loopDevices {
+			if file == sparseFile {
+				return []byte(loopDevice + "\n"), nil
+			}
+		}
+		return nil, nil
+	case "--find":
+		loopDevice := fmt.Sprintf("/dev/loop%d", f.next)
+		f.next++
+		f.loopDevices[loopDevice] = args[len(args)-1]
+		return []byte(loopDevice + "\n"), nil
+	case "--set-capacity":
+		return nil, nil
+	case "--detach":
+		delete(f.loopDevices, args[1])
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected losetup %v", args)
+}
+
+func TestSparseLoopDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sparse")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Unsetenv(EnvSparseFileDir)
+	os.Unsetenv(EnvSparseFiles)
+	os.Setenv(EnvSparseLoopDevices, "true")
+	defer os.Unsetenv(EnvSparseLoopDevices)
+	losetup := &fakeLosetup{loopDevices: make(map[string]string)}
+	defer func(run func(args ...string) ([]byte, error)) { runLosetup = run }(runLosetup)
+	runLosetup = losetup.run
+
+	c := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName, NodeNameKey: "node-1"},
+		Clientset:      CreateFakeClient(t),
+	}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1",
+		Annotations: map[string]string{NodeSparseFilesAnnotation: "2x1Gi:" + dir}}}
+	require.NoError(t, c.Clientset.Create(context.TODO(), node))
+	c.InitializeSparseFiles()
+
+	// the blockdevices of the sparse files are their loop devices
+	sparseFile := filepath.Join(dir, "0-"+SparseFileName)
+	bdName := GetSparseBlockDeviceUUID(fakeHostName, sparseFile)
+	bd, err := c.GetBlockDevice(bdName)
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/loop0", bd.Spec.Path)
+	assert.Equal(t, sparseFile, bd.Annotations[SparseFileAnnotation])
+	bd.Status.ClaimState = apis.BlockDeviceClaimed
+	bd.Spec.ClaimRef = &v1.ObjectReference{Name: "bdc-1"}
+	require.NoError(t, c.Clientset.Update(context.TODO(), bd))
+
+	// the loop devices are attached again after a reboot, keeping the claim
+	losetup.loopDevices = map[string]string{"/dev/loop0": "/var/lib/other.img"}
+	c.InitializeSparseFiles()
+	bd, err = c.GetBlockDevice(bdName)
+	require.NoError(t, err)
+	assert.Equal(t, sparseFile, losetup.loopDevices[bd.Spec.Path])
+	assert.NotEqual(t, "/dev/loop0", bd.Spec.Path)
+	assert.Equal(t, apis.BlockDeviceClaimed, bd.Status.ClaimState)
+
+	// the loop device of a retired sparse file is detached before it is deleted
+	retiredFile := filepath.Join(dir, "1-"+SparseFileName)
+	retired, err := c.GetBlockDevice(GetSparseBlockDeviceUUID(fakeHostName, retiredFile))
+	require.NoError(t, err)
+	require.Equal(t, retiredFile, losetup.loopDevices[retired.Spec.Path])
+	node.Annotations[NodeSparseFilesAnnotation] = "1x1Gi:" + dir
+	require.NoError(t, c.Clientset.Update(context.TODO(), node))
+	c.ReloadSparseFiles()
+	_, err = os.Stat(retiredFile)
+	assert.True(t, os.IsNotExist(err))
+	assert.NotContains(t, losetup.loopDevices, retired.Spec.Path)
+
+	// the sparse files are used as the paths once the loop devices are disabled
+	os.Unsetenv(EnvSparseLoopDevices)
+	c.InitializeSparseFiles()
+	bd, err = c.GetBlockDevice(bdName)
+	require.NoError(t, err)
+	assert.Equal(t, sparseFile, bd.Spec.Path)
+	assert.Equal(t, map[string]string{"/dev/loop0": "/var/lib/other.img"}, losetup.loopDevices)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+)
+
+// SparseConfigAnnotation is set on the blockdevices of the sparse files created from
+// the configuration of the node, which are retired once they are no longer configured.
+// The sparse files created using the api are not retired.
+const SparseConfigAnnotation = "ndm.io/sparse-config"
+
+// retireSparseFiles retires the sparse files created from the configuration whose
+// paths are no longer configured. The unclaimed sparse files are deleted along with
+// their blockdevices, and the blockdevices of the claimed ones are deactivated. The
+// released ones are kept active till they are cleaned up and unclaimed. It returns
+// true if some sparse files are waiting to be unclaimed before they are deleted.
+func (c *Controller) retireSparseFiles(configured map[string]bool) bool {
+	blockDeviceList, err := c.ListBlockDeviceResource(false)
+	if err != nil {
+		logger.Errorf("unable to retire the sparse files: %v", err)
+		return true
+	}
+	waiting := false
+	for i := range blockDeviceList.Items {
+		blockDevice := &blockDeviceList.Items[i]
+		sparseFile := getSparseFilePath(blockDevice)
+		if blockDevice.Spec.Details.DeviceType != blockdevice.SparseBlockDeviceType ||
+			blockDevice.Annotations[SparseConfigAnnotation] != TrueString ||
+			configured[sparseFile] {
+			continue
+		}
+		switch blockDevice.Status.ClaimState {
+		case apis.BlockDeviceUnclaimed:
+			if err := c.deleteSparseFile(sparseFile, blockDevice); err != nil {
+				logger.Errorf("unable to retire sparse file %s: %v", sparseFile, err)
+				waiting = true
+				continue
+			}
+			logger.Infof("retired sparse file %s and its blockdevice %s", sparseFile, blockDevice.Name)
+		case apis.BlockDeviceReleased:
+			// the blockdevice is cleaned up only while it is active
+			if blockDevice.Status.State != NDMActive {
+				c.markSparseBlockDeviceActive(sparseFile, true)
+			}
+			waiting = true
+		default:
+			if blockDevice.Status.State != NDMInactive {
+				logger.Infof("retiring sparse file %s, deactivating its blockdevice %s claimed by %s",
+					sparseFile, blockDevice.Name, claimName(blockDevice))
+				c.DeactivateBlockDevice(*blockDevice)
+			}
+			waiting = true
+		}
+	}
+	return waiting
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/util"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// OriginalUUIDAnnotation is added on blockdevices whose UUID was disambiguated
+	// due to a collision. The value is the UUID that was originally generated.
+	OriginalUUIDAnnotation = "internal.openebs.io/original-uuid"
+)
+
+// IsUUIDCollision checks whether the existing blockdevice resource with the same
+// UUID belongs to a different device. This happens when devices on different nodes
+// report the same identifiers, e.g. in cloned virtual machines. An unclaimed blockdevice
+// that is not active on the other node is considered to be the same device moved to this
+// node. A claimed or released blockdevice on the other node is taken over only if it is
+// not active or unknown, and the device is in use, i.e. it carries the data of the claim.
+// Otherwise the claim would be moved to a different device.
+func (c *Controller) IsUUIDCollision(blockDevice *bd.BlockDevice, existing *apis.BlockDevice) bool {
+	if existing == nil {
+		return false
+	}
+	if existing.Labels[KubernetesHostNameLabel] == c.NodeAttributes[HostNameKey] {
+		return false
+	}
+	if existing.Status.State == NDMActive {
+		return true
+	}
+	if existing.Status.ClaimState != apis.BlockDeviceClaimed &&
+		existing.Status.ClaimState != apis.BlockDeviceReleased {
+		return false
+	}
+	return existing.Status.State == NDMUnknown || !blockDevice.DevUse.InUse
+}
+
+// ResolveUUIDCollision generates a new UUID for the blockdevice which collides with
+// the existing resource, and records the conflict on the blockdevice so that it is
+// surfaced as a condition.
+func (c *Controller) ResolveUUIDCollision(blockDevice *bd.BlockDevice, existing *apis.BlockDevice) {
+	originalUUID := blockDevice.UUID
+	blockDevice.UUID = DisambiguateUUID(originalUUID, c.getUUIDHostName())
+	blockDevice.Status.OriginalUUID = originalUUID
+	blockDevice.Status.UUIDCollision = fmt.Sprintf("UUID %s is also used by %s on node %s",
+		originalUUID, existing.Spec.Path, existing.Labels[KubernetesHostNameLabel])
+	logger.Warningf("UUID collision for %s: %s. using UUID %s",
+		blockDevice.DevPath, blockDevice.Status.UUIDCollision, blockDevice.UUID)
+	c.Eventf(existing, v1.EventTypeWarning, "UUIDCollision",
+		"Device %s on node %s has the same UUID, created as %s",
+		blockDevice.DevPath, c.NodeAttributes[HostNameKey], blockDevice.UUID)
+}
+
+// DisambiguateUUID generates a UUID that is unique to the node, from the UUID
+// that collided with a blockdevice on another node
+func DisambiguateUUID(uuid, hostName string) string {
+	return bd.BlockDevicePrefix + util.Hash(uuid+hostName)
+}
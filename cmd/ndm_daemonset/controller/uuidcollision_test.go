@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	bd "github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsUUIDCollision(t *testing.T) {
+	ctrl := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: "node1"},
+	}
+	newBD := func(host, state string) *apis.BlockDevice {
+		return &apis.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{KubernetesHostNameLabel: host},
+			},
+			Status: apis.DeviceStatus{State: apis.BlockDeviceState(state)},
+		}
+	}
+	claimedBD := func(host, state string, claimState apis.DeviceClaimState) *apis.BlockDevice {
+		bd := newBD(host, state)
+		bd.Status.ClaimState = claimState
+		return bd
+	}
+	tests := map[string]struct {
+		existing *apis.BlockDevice
+		inUse    bool
+		want     bool
+	}{
+		"no existing resource":              {existing: nil, want: false},
+		"existing resource on same node":    {existing: newBD("node1", NDMActive), want: false},
+		"active resource on another node":   {existing: newBD("node2", NDMActive), want: true},
+		"inactive resource on another node": {existing: newBD("node2", NDMInactive), want: false},
+		"unknown resource on another node":  {existing: newBD("node2", NDMUnknown), want: false},
+		"claimed inactive resource on another node": {
+			existing: claimedBD("node2", NDMInactive, apis.BlockDeviceClaimed), want: true},
+		"claimed inactive resource moved from another node": {
+			existing: claimedBD("node2", NDMInactive, apis.BlockDeviceClaimed), inUse: true, want: false},
+		"claimed unknown resource in use on another node": {
+			existing: claimedBD("node2", NDMUnknown, apis.BlockDeviceClaimed), inUse: true, want: true},
+		"claimed unknown resource on another node": {
+			existing: claimedBD("node2", NDMUnknown, apis.BlockDeviceClaimed), want: true},
+		"released inactive resource on another node": {
+			existing: claimedBD("node2", NDMInactive, apis.BlockDeviceReleased), want: true},
+		"unclaimed inactive resource on another node": {
+			existing: claimedBD("node2", NDMInactive, apis.BlockDeviceUnclaimed), want: false},
+		"claimed resource on same node": {
+			existing: claimedBD("node1", NDMInactive, apis.BlockDeviceClaimed), want: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			blockDevice := &bd.BlockDevice{}
+			blockDevice.DevUse.InUse = test.inUse
+			assert.Equal(t, test.want, ctrl.IsUUIDCollision(blockDevice, test.existing))
+		})
+	}
+}
+
+func TestResolveUUIDCollision(t *testing.T) {
+	ctrl := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: "node1"},
+	}
+	existing := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "blockdevice-123",
+			Labels: map[string]string{KubernetesHostNameLabel: "node2"},
+		},
+		Spec:   apis.DeviceSpec{Path: "/dev/sdb"},
+		Status: apis.DeviceStatus{State: NDMActive},
+	}
+	blockDevice := &bd.BlockDevice{}
+	blockDevice.UUID = "blockdevice-123"
+	blockDevice.DevPath = "/dev/sdc"
+
+	ctrl.ResolveUUIDCollision(blockDevice, existing)
+	assert.Equal(t, DisambiguateUUID("blockdevice-123", "node1"), blockDevice.UUID)
+	assert.NotEqual(t, "blockdevice-123", blockDevice.UUID)
+
+	bdAPI := ctrl.NewDeviceInfoFromBlockDevice(blockDevice).ToDevice()
+	assert.Equal(t, blockDevice.UUID, bdAPI.Name)
+	assert.Equal(t, "blockdevice-123", bdAPI.Annotations[OriginalUUIDAnnotation])
+	cond := bdAPI.Status.GetCondition(apis.BlockDeviceUUIDCollision)
+	if assert.NotNil(t, cond) {
+		assert.Equal(t, "UUID blockdevice-123 is also used by /dev/sdb on node node2", cond.Message)
+	}
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// WriteQueueSize is the maximum number of blockdevices whose writes are queued
+// while the API server is unreachable. Writes are not queued if it is 0.
+var WriteQueueSize = 512
+
+const (
+	// queuedPush is a create or update of the blockdevice
+	queuedPush = "push"
+	// queuedDeactivate is the deactivation of the blockdevice
+	queuedDeactivate = "deactivate"
+	// queuedRemove marks the active blockdevice of a removed device unknown
+	queuedRemove = "remove"
+)
+
+var (
+	// WriteQueueLength is the number of blockdevice writes waiting for the
+	// API server to be reachable
+	WriteQueueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "write_queue_length",
+			Help:      `No. of blockdevice writes queued while the API server is unreachable`,
+		},
+	)
+
+	// WriteQueueDroppedTotal is the number of queued writes dropped because the
+	// queue was full
+	WriteQueueDroppedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "write_queue_dropped_total",
+			Help:      `No. of queued blockdevice writes dropped because the queue was full`,
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(WriteQueueLength, WriteQueueDroppedTotal)
+}
+
+// queuedWrite is a write of a blockdevice that failed because the API
+// server was unreachable
+type queuedWrite struct {
+	operation   string
+	blockDevice apis.BlockDevice
+	queuedAt    time.Time
+	// seq identifies the write, so that a write queued again while the
+	// queue is flushed is not removed
+	seq uint64
+}
+
+// writeQueue holds the last write of each blockdevice that could not be sent to
+// the API server, and the blockdevices last listed from the API server, so that
+// the devices can be processed during an outage.
+type writeQueue struct {
+	mutex sync.Mutex
+	// flushMutex allows only one flush of the queue at a time. The API requests
+	// of a flush are sent without holding mutex, so that the writes can be
+	// queued during the flush.
+	flushMutex sync.Mutex
+	// seq is the sequence number of the last queued write
+	seq uint64
+	// writes are the queued writes keyed by the blockdevice name
+	writes map[string]queuedWrite
+	// order is the order in which the blockdevices were queued
+	order []string
+	// lastList holds the last listed blockdevices, keyed by listAll
+	lastList map[bool]*apis.BlockDeviceList
+}
+
+// isUnreachable checks if the error is because the API server could not be
+// reached, in which case the request may succeed later. Only timeouts and
+// connection errors, e.g connection refused, are treated as unreachable.
+func isUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(errors.APIStatus); ok {
+		return errors.IsServerTimeout(err) || errors.IsTimeout(err) ||
+			errors.IsServiceUnavailable(err) || errors.IsTooManyRequests(err)
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		if urlErr.Timeout() {
+			return true
+		}
+		err = urlErr.Err
+	}
+	// dial, read and write errors of the connection
+	if _, ok := err.(*net.OpError); ok {
+		return true
+	}
+	return utilnet.IsProbableEOF(err)
+}
+
+// queueWrite queues the write of the blockdevice if the API server is unreachable.
+// Only the last write of a blockdevice is kept. The oldest write is dropped if the
+// queue is full. It returns true if the write was queued.
+func (c *Controller) queueWrite(operation string, blockDevice *apis.BlockDevice, err error) bool {
+	if WriteQueueSize <= 0 || !isUnreachable(err) {
+		return false
+	}
+	q := &c.writeQueue
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.writes == nil {
+		q.writes = make(map[string]queuedWrite)
+	}
+	name := blockDevice.Name
+	if _, ok := q.writes[name]; ok {
+		q.order = removeName(q.order, name)
+	} else if len(q.writes) >= WriteQueueSize {
+		oldest := q.order[0]
+		q.order = q.order[1:]
+		delete(q.writes, oldest)
+		WriteQueueDroppedTotal.Inc()
+		logger.Warningf("write queue is full, dropped the queued write of %s", oldest)
+	}
+	q.seq++
+	q.writes[name] = queuedWrite{
+		operation:   operation,
+		blockDevice: *blockDevice.DeepCopy(),
+		queuedAt:    time.Now(),
+		seq:         q.seq,
+	}
+	q.order = append(q.order, name)
+	WriteQueueLength.Set(float64(len(q.writes)))
+	logger.Warningf("API server unreachable, queued %s of %s: %v", operation, name, err)
+	return true
+}
+
+// removeName removes the name from the list of names
+func removeName(names []string, name string) []string {
+	for i := range names {
+		if names[i] == name {
+			return append(names[:i], names[i+1:]...)
+		}
+	}
+	return names
+}
+
+// dropQueuedWrite removes the queued write of the blockdevice, e.g when the
+// blockdevice is deleted
+func (c *Controller) dropQueuedWrite(name string) {
+	q := &c.writeQueue
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, ok := q.writes[name]; !ok {
+		return
+	}
+	delete(q.writes, name)
+	q.order = removeName(q.order, name)
+	WriteQueueLength.Set(float64(len(q.writes)))
+	logger.Infof("dropped the queued write of deleted blockdevice %s", name)
+}
+
+// pending returns a copy of the queued writes, in the order in which they were queued
+func (q *writeQueue) pending() []queuedWrite {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	writes := make([]queuedWrite, 0, len(q.order))
+	for _, name := range q.order {
+		writes = append(writes, q.writes[name])
+	}
+	return writes
+}
+
+// isQueued checks if the write is still the queued write of the blockdevice
+func (q *writeQueue) isQueued(write queuedWrite) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	queued, ok := q.writes[write.blockDevice.Name]
+	return ok && queued.seq == write.seq
+}
+
+// remove removes the write from the queue, unless the blockdevice was queued
+// again after the write
+func (q *writeQueue) remove(write queuedWrite) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	name := write.blockDevice.Name
+	if queued, ok := q.writes[name]; ok && queued.seq == write.seq {
+		delete(q.writes, name)
+		q.order = removeName(q.order, name)
+	}
+	WriteQueueLength.Set(float64(len(q.writes)))
+}
+
+// FlushWriteQueue sends the queued writes to the API server, in the order in which
+// they were queued. The flush is stopped if the API server becomes unreachable
+// again, the remaining writes are retried on the next flush. The writes are copied
+// out of the queue, so that writes can be queued while the requests are sent.
+func (c *Controller) FlushWriteQueue() {
+	q := &c.writeQueue
+	q.flushMutex.Lock()
+	defer q.flushMutex.Unlock()
+	writes := q.pending()
+	if len(writes) == 0 {
+		return
+	}
+	logger.Infof("flushing %d queued blockdevice writes", len(writes))
+	for _, write := range writes {
+		// the blockdevice was deleted or queued again during the flush
+		if !q.isQueued(write) {
+			continue
+		}
+		name := write.blockDevice.Name
+		APIRequestRetriesTotal.WithLabelValues(RetryReasonQueued).Inc()
+		err := c.sendQueuedWrite(write)
+		if isUnreachable(err) {
+			logger.Errorf("API server unreachable, stopped flushing the write queue: %v", err)
+			return
+		}
+		if err != nil {
+			logger.Errorf("dropping queued %s of %s: %v", write.operation, name, err)
+		} else {
+			logger.Infof("sent %s of %s queued at %s", write.operation, name, write.queuedAt.Format(time.RFC3339))
+		}
+		q.remove(write)
+	}
+}
+
+// sendQueuedWrite sends the write to the API server. The queued blockdevice is
+// merged with the existing resource, as it may have changed during the outage.
+func (c *Controller) sendQueuedWrite(write queuedWrite) error {
+	blockDevice := write.blockDevice.DeepCopy()
+	if blockDevice.Namespace == "" {
+		blockDevice.SetNamespace(c.Namespace)
+	}
+	existing := &apis.BlockDevice{}
+	err := c.Clientset.Get(context.TODO(),
+		client.ObjectKey{Namespace: blockDevice.Namespace, Name: blockDevice.Name}, existing)
+	if errors.IsNotFound(err) {
+		if write.operation == queuedDeactivate || write.operation == queuedRemove {
+			return nil
+		}
+		blockDevice.ResourceVersion = ""
+		c.updateStatsEpoch(blockDevice)
+		c.setOwnerReference(blockDevice)
+		err = c.Clientset.Create(context.TODO(), blockDevice)
+		if err == nil {
+			c.recordBlockDevice(blockDevice)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	switch write.operation {
+	case queuedDeactivate:
+		existing.Status.State = NDMInactive
+		delete(existing.Annotations, HeartbeatExpiredAnnotation)
+		blockDevice = existing
+	case queuedRemove:
+		// the grace period ended, or the device was attached again,
+		// during the outage
+		if !c.inRemovalGrace(existing.Name) {
+			return nil
+		}
+		// the blockdevice marked Unknown by the operator on the expiry of the
+		// heartbeat during the outage is taken over by the removal
+		_, heartbeatExpired := existing.Annotations[HeartbeatExpiredAnnotation]
+		if existing.Status.State != NDMActive &&
+			!(existing.Status.State == NDMUnknown && heartbeatExpired) {
+			return nil
+		}
+		existing.Status.State = NDMUnknown
+		delete(existing.Annotations, HeartbeatExpiredAnnotation)
+		blockDevice = existing
+	default:
+		blockDevice = mergeBlockDeviceData(*blockDevice, *existing)
+		c.updateStatsEpoch(blockDevice)
+		c.setOwnerReference(blockDevice)
+	}
+	err = c.Clientset.Update(context.TODO(), blockDevice)
+	if err == nil {
+		c.recordBlockDevice(blockDevice)
+	}
+	return err
+}
+
+// ListBlockDeviceResourceOffline lists the blockdevice resources like ListBlockDeviceResource.
+// If the API server is unreachable and writes are queued, the blockdevices that were
+// last listed are returned, so that the devices can be processed during the outage.
+func (c *Controller) ListBlockDeviceResourceOffline(listAll bool) (*apis.BlockDeviceList, error) {
+	blockDeviceList, err := c.ListBlockDeviceResource(listAll)
+	q := &c.writeQueue
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if err == nil {
+		if q.lastList == nil {
+			q.lastList = make(map[bool]*apis.BlockDeviceList)
+		}
+		q.lastList[listAll] = blockDeviceList.DeepCopy()
+		return blockDeviceList, nil
+	}
+	lastList, ok := q.lastList[listAll]
+	if WriteQueueSize <= 0 || !isUnreachable(err) || !ok {
+		return blockDeviceList, err
+	}
+	logger.Warningf("API server unreachable, using the last listed blockdevices: %v", err)
+	return lastList.DeepCopy(), nil
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// unreachableClient fails all the requests while the API server is down
+type unreachableClient struct {
+	client.Client
+	down bool
+}
+
+func (u *unreachableClient) err() error {
+	return &url.Error{Op: "Get", URL: "https://10.0.0.1:443", Err: &net.OpError{
+		Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}
+}
+
+func (u *unreachableClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if u.down {
+		return u.err()
+	}
+	return u.Client.Get(ctx, key, obj)
+}
+
+func (u *unreachableClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if u.down {
+		return u.err()
+	}
+	return u.Client.List(ctx, list, opts...)
+}
+
+func (u *unreachableClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	if u.down {
+		return u.err()
+	}
+	return u.Client.Create(ctx, obj, opts...)
+}
+
+func (u *unreachableClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	if u.down {
+		return u.err()
+	}
+	return u.Client.Delete(ctx, obj, opts...)
+}
+
+func (u *unreachableClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	if u.down {
+		return u.err()
+	}
+	return u.Client.Update(ctx, obj, opts...)
+}
+
+func newQueuedBlockDevice(name, path string) apis.BlockDevice {
+	return apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{KubernetesHostNameLabel: fakeHostName},
+		},
+		Spec:   apis.DeviceSpec{Path: path},
+		Status: apis.DeviceStatus{State: NDMActive},
+	}
+}
+
+func TestWriteQueue(t *testing.T) {
+	defer func(size int) { WriteQueueSize = size }(WriteQueueSize)
+	WriteQueueSize = 2
+
+	fakeClient := &unreachableClient{Client: CreateFakeClient(t)}
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      fakeClient,
+	}
+	assert.NoError(t, fakeController.CreateBlockDevice(newQueuedBlockDevice("blockdevice-1", "/dev/sda")))
+	listed, err := fakeController.ListBlockDeviceResourceOffline(false)
+	assert.NoError(t, err)
+
+	fakeClient.down = true
+	// the last listed blockdevices are used during the outage
+	offline, err := fakeController.ListBlockDeviceResourceOffline(false)
+	assert.NoError(t, err)
+	assert.Equal(t, listed, offline)
+	_, err = fakeController.ListBlockDeviceResource(false)
+	assert.Error(t, err)
+
+	// the writes are queued, the newest write of a device wins
+	assert.NoError(t, fakeController.CreateBlockDevice(newQueuedBlockDevice("blockdevice-2", "/dev/sdb")))
+	assert.NoError(t, fakeController.CreateBlockDevice(newQueuedBlockDevice("blockdevice-3", "/dev/sdc")))
+	assert.NoError(t, fakeController.UpdateBlockDevice(newQueuedBlockDevice("blockdevice-2", "/dev/sdd"), nil))
+	// the oldest write is dropped when the queue is full
+	fakeController.DeactivateBlockDevice(newQueuedBlockDevice("blockdevice-1", "/dev/sda"))
+	assert.Equal(t, []string{"blockdevice-2", "blockdevice-1"}, fakeController.writeQueue.order)
+
+	// nothing is sent while the API server is unreachable
+	fakeController.FlushWriteQueue()
+	assert.Len(t, fakeController.writeQueue.writes, 2)
+
+	fakeClient.down = false
+	fakeController.FlushWriteQueue()
+	assert.Empty(t, fakeController.writeQueue.writes)
+
+	bd2, err := fakeController.GetBlockDevice("blockdevice-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/sdd", bd2.Spec.Path)
+	bd1, err := fakeController.GetBlockDevice("blockdevice-1")
+	assert.NoError(t, err)
+	assert.Equal(t, apis.BlockDeviceState(NDMInactive), bd1.Status.State)
+	_, err = fakeController.GetBlockDevice("blockdevice-3")
+	assert.Error(t, err)
+}
+
+func TestWriteQueueDisabled(t *testing.T) {
+	defer func(size int) { WriteQueueSize = size }(WriteQueueSize)
+	WriteQueueSize = 0
+
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      &unreachableClient{Client: CreateFakeClient(t), down: true},
+	}
+	assert.Error(t, fakeController.CreateBlockDevice(newQueuedBlockDevice("blockdevice-1", "/dev/sda")))
+	assert.Empty(t, fakeController.writeQueue.writes)
+}
+
+func TestWriteQueueDelete(t *testing.T) {
+	fakeClient := &unreachableClient{Client: CreateFakeClient(t), down: true}
+	fakeController := &Controller{
+		NodeAttributes: map[string]string{HostNameKey: fakeHostName},
+		Clientset:      fakeClient,
+	}
+	assert.NoError(t, fakeController.CreateBlockDevice(newQueuedBlockDevice("blockdevice-1", "/dev/sda")))
+	assert.Len(t, fakeController.writeQueue.writes, 1)
+
+	// the queued create is dropped when the blockdevice is deleted
+	fakeController.DeleteBlockDevice("blockdevice-1")
+	assert.Empty(t, fakeController.writeQueue.writes)
+
+	fakeClient.down = false
+	fakeController.FlushWriteQueue()
+	_, err := fakeController.GetBlockDevice("blockdevice-1")
+	assert.Error(t, err)
+}
+
+func TestIsUnreachable(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"no error":           {err: nil, expected: false},
+		"connection refused": {err: (&unreachableClient{}).err(), expected: true},
+		"connection closed":  {err: &url.Error{Op: "Get", URL: "https://10.0.0.1:443", Err: io.EOF}, expected: true},
+		"service unavailable": {
+			err:      apierrors.NewServiceUnavailable("unavailable"),
+			expected: true,
+		},
+		"conflict": {
+			err:      apierrors.NewConflict(schema.GroupResource{Resource: "blockdevices"}, "blockdevice-1", errors.New("conflict")),
+			expected: false,
+		},
+		"certificate error": {
+			err:      &url.Error{Op: "Get", URL: "https://10.0.0.1:443", Err: errors.New("x509: certificate signed by unknown authority")},
+			expected: false,
+		},
+		"encoding error": {err: errors.New("no kind is registered for the type"), expected: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, isUnreachable(test.err))
+		})
+	}
+}
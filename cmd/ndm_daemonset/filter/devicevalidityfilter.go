@@ -17,9 +17,13 @@ limitations under the License.
 package filter
 
 import (
+	"strings"
+
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
-	"k8s.io/klog"
+	"github.com/openebs/node-disk-manager/pkg/features"
+	"github.com/openebs/node-disk-manager/pkg/logs"
+	"github.com/openebs/node-disk-manager/pkg/sysfs"
 )
 
 // NOTE: This is an internal filter used by NDM to validate the block devices.
@@ -28,6 +32,11 @@ import (
 //
 // The filter cannot be configured or disabled by user.
 
+const (
+	// deviceValidityFilterKey is the key of the filter, it is not configurable
+	deviceValidityFilterKey = "device-validity-filter"
+)
+
 var (
 	deviceValidityFilterName  = "device validity filter" // filter valid devices
 	deviceValidityFilterState = defaultEnabled           // filter state
@@ -39,15 +48,19 @@ var deviceValidityFilterRegister = func() {
 	if ctrl == nil {
 		return
 	}
+	newDeviceValidityRegisterFilter(ctrl).register()
+}
 
+// newDeviceValidityRegisterFilter creates the registerFilter of the device validity filter
+func newDeviceValidityRegisterFilter(ctrl *controller.Controller) *registerFilter {
 	var fi controller.FilterInterface = newDeviceValidityFilter(ctrl)
-	newRegisterFilter := &registerFilter{
+	return &registerFilter{
+		key:        deviceValidityFilterKey,
 		name:       deviceValidityFilterName,
 		state:      deviceValidityFilterState,
 		fi:         fi,
 		controller: ctrl,
 	}
-	newRegisterFilter.register()
 }
 
 // deviceValidityFilter contains controller and validator functions
@@ -73,7 +86,12 @@ func (dvf *deviceValidityFilter) Start() {
 	dvf.excludeValidationFuncs = append(dvf.excludeValidationFuncs,
 		isValidDevPath,
 		isValidCapacity,
+		isPrimaryPath,
 	)
+	// network block devices are discovered only if enabled
+	if !dvf.controller.IsFeatureEnabled(features.NBDDiscovery) {
+		dvf.excludeValidationFuncs = append(dvf.excludeValidationFuncs, isNotNBD)
+	}
 }
 
 // Include returns true because no specific internal validations are done
@@ -96,7 +114,7 @@ func (dvf *deviceValidityFilter) Exclude(blockDevice *blockdevice.BlockDevice) b
 // isValidDevPath checks if the path is not empty
 func isValidDevPath(bd *blockdevice.BlockDevice) bool {
 	if len(bd.DevPath) == 0 {
-		klog.V(4).Infof("device has an invalid dev path")
+		logger.V(4).Info("device has an invalid dev path", logs.PathKey, bd.DevPath)
 		return false
 	}
 	return true
@@ -105,7 +123,36 @@ func isValidDevPath(bd *blockdevice.BlockDevice) bool {
 // isValidCapacity checks if the device has a valid capacity
 func isValidCapacity(bd *blockdevice.BlockDevice) bool {
 	if bd.Capacity.Storage == 0 {
-		klog.V(4).Infof("device: %s has invalid capacity", bd.DevPath)
+		logger.V(4).Info("device has invalid capacity", logs.PathKey, bd.DevPath)
+		return false
+	}
+	return true
+}
+
+// isPrimaryPath checks if the device is not a secondary path to a PowerVM virtual
+// SCSI disk that is served by more than one virtual I/O server. Only one
+// blockdevice is created for such disks, using the primary path.
+func isPrimaryPath(bd *blockdevice.BlockDevice) bool {
+	sysfsDevice, err := sysfs.NewSysFsDeviceFromDevPath(bd.DevPath)
+	if err != nil {
+		return true
+	}
+	secondary, err := sysfsDevice.IsSecondaryVSCSIPath()
+	if err != nil {
+		logger.V(4).Info("could not check vscsi paths of device", logs.PathKey, bd.DevPath, logs.ErrorKey, err)
+		return true
+	}
+	if secondary {
+		logger.V(4).Info("device is a secondary path of a vscsi disk", logs.PathKey, bd.DevPath)
+		return false
+	}
+	return true
+}
+
+// isNotNBD checks if the device is not a network block device or a partition on it
+func isNotNBD(bd *blockdevice.BlockDevice) bool {
+	if strings.HasPrefix(bd.DevPath, "/dev/nbd") {
+		logger.V(4).Info("device is a network block device", logs.PathKey, bd.DevPath)
 		return false
 	}
 	return true
@@ -138,3 +138,40 @@ func Test_isValidCapacity(t *testing.T) {
 		})
 	}
 }
+
+func Test_isNotNBD(t *testing.T) {
+	tests := map[string]struct {
+		bd   *blockdevice.BlockDevice
+		want bool
+	}{
+		"disk": {
+			bd: &blockdevice.BlockDevice{
+				Identifier: blockdevice.Identifier{
+					DevPath: "/dev/sda",
+				},
+			},
+			want: true,
+		},
+		"nbd": {
+			bd: &blockdevice.BlockDevice{
+				Identifier: blockdevice.Identifier{
+					DevPath: "/dev/nbd0",
+				},
+			},
+			want: false,
+		},
+		"partition on nbd": {
+			bd: &blockdevice.BlockDevice{
+				Identifier: blockdevice.Identifier{
+					DevPath: "/dev/nbd0p1",
+				},
+			},
+			want: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.want, isNotNBD(test.bd))
+		})
+	}
+}
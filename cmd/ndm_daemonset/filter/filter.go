@@ -18,7 +18,7 @@ package filter
 
 import (
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
-	"k8s.io/klog"
+	"github.com/openebs/node-disk-manager/pkg/logs"
 )
 
 const (
@@ -26,6 +26,9 @@ const (
 	defaultDisabled = false // use in each filter to make it disable.
 )
 
+// logger is the structured logger of the filters
+var logger = logs.Module("filter")
+
 // RegisteredFilters contains register function of filters which we want to register
 var RegisteredFilters = []func(){
 	oSDiskExcludeFilterRegister,
@@ -34,7 +37,24 @@ var RegisteredFilters = []func(){
 	deviceValidityFilterRegister,
 }
 
+// filterBuilders contains the functions which create the filters from the config.
+// They are used to recreate the filters when the config is reloaded.
+var filterBuilders = []func(*controller.Controller) *registerFilter{
+	newOSDiskExcludeRegisterFilter,
+	newVendorRegisterFilter,
+	newPathRegisterFilter,
+	newDeviceValidityRegisterFilter,
+}
+
+func init() {
+	// add the keys that can be used in the ndm config, so that the config
+	// can be validated
+	controller.AddSupportedFilterKeys(osDiskExcludeFilterKey, vendorFilterKey,
+		pathFilterKey, deviceValidityFilterKey)
+}
+
 type registerFilter struct {
+	key        string
 	name       string
 	state      bool
 	fi         controller.FilterInterface
@@ -45,6 +65,7 @@ type registerFilter struct {
 // status if it is enabled then it will call Start() of that filter.
 func (rf *registerFilter) register() {
 	newFilter := &controller.Filter{
+		Key:       rf.key,
 		Name:      rf.name,
 		State:     rf.state,
 		Interface: rf.fi,
@@ -57,8 +78,28 @@ func (rf *registerFilter) register() {
 
 // Start starts registration of filters present in RegisteredFilters
 func Start(registeredFilters []func()) {
-	klog.Info("registering filters")
+	logger.Infof("registering filters")
 	for _, filter := range registeredFilters {
 		filter()
 	}
 }
+
+// Reload recreates the filters from the reloaded config of the controller. Each
+// new filter is started before it replaces the filter having the same key, so
+// that devices are always filtered.
+func Reload(ctrl *controller.Controller) error {
+	logger.Infof("reloading filters")
+	for _, builder := range filterBuilders {
+		rf := builder(ctrl)
+		if rf.state {
+			rf.fi.Start()
+		}
+		ctrl.ReplaceFilter(&controller.Filter{
+			Key:       rf.key,
+			Name:      rf.name,
+			State:     rf.state,
+			Interface: rf.fi,
+		})
+	}
+	return nil
+}
@@ -118,3 +118,30 @@ func TestStart(t *testing.T) {
 		})
 	}
 }
+
+func TestReloadRestoresDefaults(t *testing.T) {
+	ndmConfig := &controller.NodeDiskManagerConfig{
+		FilterConfigs: []controller.FilterConfig{
+			{Key: pathFilterKey, Name: "custom path filter", State: "false", Exclude: "/dev/sdc"},
+			{Key: vendorFilterKey, Name: "custom vendor filter", State: "true", Include: "ATA"},
+		},
+	}
+	ctrl := &controller.Controller{NDMConfig: ndmConfig, Mutex: &sync.Mutex{}}
+	assert.NoError(t, Reload(ctrl))
+	assert.Equal(t, "custom path filter", pathFilterName)
+	assert.False(t, pathFilterState)
+	assert.Equal(t, "/dev/sdc", excludePaths)
+	assert.Equal(t, "ATA", includeVendors)
+
+	// the filters removed from the config use the defaults again
+	ctrl.NDMConfig = &controller.NodeDiskManagerConfig{}
+	assert.NoError(t, Reload(ctrl))
+	assert.Equal(t, defaultPathFilterName, pathFilterName)
+	assert.True(t, pathFilterState)
+	assert.Equal(t, defaultExcludePaths, excludePaths)
+	assert.Equal(t, defaultVendorFilterName, vendorFilterName)
+	assert.Equal(t, "", includeVendors)
+	for _, f := range ctrl.ListFilter() {
+		assert.True(t, f.State, f.Name)
+	}
+}
@@ -21,10 +21,9 @@ import (
 
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/logs"
 	"github.com/openebs/node-disk-manager/pkg/mount"
 	"github.com/openebs/node-disk-manager/pkg/util"
-
-	"k8s.io/klog"
 )
 
 const (
@@ -32,11 +31,13 @@ const (
 )
 
 var (
-	defaultMountFilePath     = "/proc/self/mounts"
-	mountPoints              = []string{"/", "/etc/hosts"}
-	hostMountFilePath        = "/host/proc/1/mounts"    // hostMountFilePath is the file path mounted inside container
-	oSDiskExcludeFilterName  = "os disk exclude filter" // filter name
-	oSDiskExcludeFilterState = defaultEnabled           // filter state
+	defaultMountFilePath           = "/proc/self/mounts"
+	defaultMountPoints             = []string{"/", "/etc/hosts"}
+	mountPoints                    = defaultMountPoints
+	hostMountFilePath              = "/host/proc/1/mounts"    // hostMountFilePath is the file path mounted inside container
+	defaultOSDiskExcludeFilterName = "os disk exclude filter" // filter name
+	oSDiskExcludeFilterName        = defaultOSDiskExcludeFilterName
+	oSDiskExcludeFilterState       = defaultEnabled // filter state
 )
 
 // oSDiskExcludeFilterRegister contains registration process of oSDiskExcludeFilter
@@ -45,8 +46,17 @@ var oSDiskExcludeFilterRegister = func() {
 	if ctrl == nil {
 		return
 	}
-	if ctrl.NDMConfig != nil {
-		for _, filterConfig := range ctrl.NDMConfig.FilterConfigs {
+	newOSDiskExcludeRegisterFilter(ctrl).register()
+}
+
+// newOSDiskExcludeRegisterFilter creates the registerFilter of the os disk exclude filter using the config
+func newOSDiskExcludeRegisterFilter(ctrl *controller.Controller) *registerFilter {
+	// the defaults are restored first, so that they are used again when the
+	// filter is removed from a reloaded config
+	oSDiskExcludeFilterName, oSDiskExcludeFilterState = defaultOSDiskExcludeFilterName, defaultEnabled
+	mountPoints = defaultMountPoints
+	if ndmConfig := ctrl.GetNDMConfig(); ndmConfig != nil {
+		for _, filterConfig := range ndmConfig.FilterConfigs {
 			if filterConfig.Key == osDiskExcludeFilterKey {
 				oSDiskExcludeFilterName = filterConfig.Name
 				oSDiskExcludeFilterState = util.CheckTruthy(filterConfig.State)
@@ -56,13 +66,13 @@ var oSDiskExcludeFilterRegister = func() {
 		}
 	}
 	var fi controller.FilterInterface = newNonOsDiskFilter(ctrl)
-	newRegisterFilter := &registerFilter{
+	return &registerFilter{
+		key:        osDiskExcludeFilterKey,
 		name:       oSDiskExcludeFilterName,
 		state:      oSDiskExcludeFilterState,
 		fi:         fi,
 		controller: ctrl,
 	}
-	newRegisterFilter.register()
 }
 
 // oSDiskExcludeFilter controller and path of os disk
@@ -87,10 +97,13 @@ func (odf *oSDiskExcludeFilter) Start() {
 		it adds it in Controller struct and make isOsDiskFilterSet true
 	*/
 	for _, mountPoint := range mountPoints {
+		if !controller.IsHostPathAllowed(hostMountFilePath) {
+			logger.Warningf("%s is not allowed to be read, os disk filter will use only %s", hostMountFilePath, defaultMountFilePath)
+			break
+		}
 		mountPointUtil := mount.NewMountUtil(hostMountFilePath, "", mountPoint)
 		if devPath, err := mountPointUtil.GetDiskPath(); err != nil {
-			klog.Errorf("unable to configure os disk filter for mountpoint: %s, error: %v", mountPoint, err)
-			klog.Error(err)
+			logger.Errorf("unable to configure os disk filter for mountpoint: %s, error: %v", mountPoint, err)
 		} else {
 			odf.excludeDevPaths = append(odf.excludeDevPaths, devPath)
 		}
@@ -102,8 +115,7 @@ func (odf *oSDiskExcludeFilter) Start() {
 	for _, mountPoint := range mountPoints {
 		mountPointUtil := mount.NewMountUtil(defaultMountFilePath, "", mountPoint)
 		if devPath, err := mountPointUtil.GetDiskPath(); err != nil {
-			klog.Errorf("unable to configure os disk filter for mountpoint: %s, error: %v", mountPoint, err)
-			klog.Error(err)
+			logger.Errorf("unable to configure os disk filter for mountpoint: %s, error: %v", mountPoint, err)
 		} else {
 			odf.excludeDevPaths = append(odf.excludeDevPaths, devPath)
 		}
@@ -130,7 +142,7 @@ func (odf *oSDiskExcludeFilter) Exclude(blockDevice *blockdevice.BlockDevice) bo
 			partitionRegex = "[0-9]*$"
 		}
 		regex := "^" + excludeDevPath + partitionRegex
-		klog.Infof("applying os-filter regex %s on %s", regex, blockDevice.DevPath)
+		logger.Info("applying os-filter regex", "regex", regex, logs.PathKey, blockDevice.DevPath)
 		if util.IsMatchRegex(regex, blockDevice.DevPath) {
 			return false
 		}
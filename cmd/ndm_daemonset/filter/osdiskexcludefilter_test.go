@@ -46,6 +46,7 @@ func TestOsDiskFilterRegister(t *testing.T) {
 		excludeDevPaths: []string{diskDetails.DevNode},
 	}
 	filter := &controller.Filter{
+		Key:       osDiskExcludeFilterKey,
 		Name:      oSDiskExcludeFilterName,
 		State:     oSDiskExcludeFilterState,
 		Interface: fi,
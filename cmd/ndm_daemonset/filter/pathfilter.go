@@ -29,10 +29,12 @@ const (
 )
 
 var (
-	pathFilterName  = "path filter"  // filter device paths
-	pathFilterState = defaultEnabled // filter state
-	includePaths    = ""
-	excludePaths    = "loop"
+	defaultPathFilterName = "path filter" // filter device paths
+	defaultExcludePaths   = "loop"
+	pathFilterName        = defaultPathFilterName
+	pathFilterState       = defaultEnabled // filter state
+	includePaths          = ""
+	excludePaths          = defaultExcludePaths
 )
 
 // pathFilterRegister contains registration process of PathFilter
@@ -41,8 +43,17 @@ var pathFilterRegister = func() {
 	if ctrl == nil {
 		return
 	}
-	if ctrl.NDMConfig != nil {
-		for _, filterConfig := range ctrl.NDMConfig.FilterConfigs {
+	newPathRegisterFilter(ctrl).register()
+}
+
+// newPathRegisterFilter creates the registerFilter of the path filter using the config
+func newPathRegisterFilter(ctrl *controller.Controller) *registerFilter {
+	// the defaults are restored first, so that they are used again when the
+	// filter is removed from a reloaded config
+	pathFilterName, pathFilterState = defaultPathFilterName, defaultEnabled
+	includePaths, excludePaths = "", defaultExcludePaths
+	if ndmConfig := ctrl.GetNDMConfig(); ndmConfig != nil {
+		for _, filterConfig := range ndmConfig.FilterConfigs {
 			if filterConfig.Key == pathFilterKey {
 				pathFilterName = filterConfig.Name
 				pathFilterState = util.CheckTruthy(filterConfig.State)
@@ -53,13 +64,13 @@ var pathFilterRegister = func() {
 		}
 	}
 	var fi controller.FilterInterface = newPathFilter(ctrl)
-	newRegisterFilter := &registerFilter{
+	return &registerFilter{
+		key:        pathFilterKey,
 		name:       pathFilterName,
 		state:      pathFilterState,
 		fi:         fi,
 		controller: ctrl,
 	}
-	newRegisterFilter.register()
 }
 
 // pathFilter contains controller and include and exclude keywords
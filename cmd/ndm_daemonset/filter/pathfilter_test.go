@@ -42,6 +42,7 @@ func TestPathFilterRegister(t *testing.T) {
 		excludePaths: []string{"loop"},
 	}
 	filter := &controller.Filter{
+		Key:       pathFilterKey,
 		Name:      pathFilterName,
 		State:     pathFilterState,
 		Interface: fi,
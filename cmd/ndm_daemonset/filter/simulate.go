@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+)
+
+// The results of a filter in a simulation
+const (
+	ResultIncluded = "included"
+	ResultExcluded = "excluded"
+	ResultDisabled = "disabled"
+)
+
+// FilterResult is the result of a filter for a device
+type FilterResult struct {
+	Key    string `json:"key"`
+	Name   string `json:"name"`
+	Result string `json:"result"`
+}
+
+// Decision is the decision of the filters for a device
+type Decision struct {
+	DevPath string `json:"devPath"`
+	// Included is true if the device is included by all the enabled filters,
+	// in which case a blockdevice is created for it
+	Included bool `json:"included"`
+	// ExcludedBy is the name of the first filter which excluded the device,
+	// the device is not passed to the other filters by the daemon
+	ExcludedBy string `json:"excludedBy,omitempty"`
+	// Results are the results of all the filters in the order in which they
+	// are applied by the daemon
+	Results []FilterResult `json:"results"`
+}
+
+// Simulate applies the filters created from the config on the devices, without
+// a running daemon, and returns the decision for each device. The filters are
+// created in the same way as when the config is reloaded by the daemon, and
+// all the enabled filters are applied on each device so that the result of
+// each filter can be reviewed.
+func Simulate(ndmConfig *controller.NodeDiskManagerConfig, devices []blockdevice.BlockDevice) []Decision {
+	ctrl := &controller.Controller{NDMConfig: ndmConfig}
+	filters := make([]*registerFilter, 0, len(filterBuilders))
+	for _, builder := range filterBuilders {
+		rf := builder(ctrl)
+		if rf.state {
+			rf.fi.Start()
+		}
+		filters = append(filters, rf)
+	}
+
+	decisions := make([]Decision, 0, len(devices))
+	for i := range devices {
+		device := &devices[i]
+		decision := Decision{
+			DevPath:  device.DevPath,
+			Included: true,
+			Results:  make([]FilterResult, 0, len(filters)),
+		}
+		for _, rf := range filters {
+			result := FilterResult{Key: rf.key, Name: rf.name, Result: ResultDisabled}
+			if rf.state {
+				result.Result = ResultIncluded
+				filter := &controller.Filter{Key: rf.key, Name: rf.name, State: rf.state, Interface: rf.fi}
+				if !filter.ApplyFilter(device) {
+					result.Result = ResultExcluded
+					if decision.Included {
+						decision.Included = false
+						decision.ExcludedBy = rf.name
+					}
+				}
+			}
+			decision.Results = append(decision.Results, result)
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions
+}
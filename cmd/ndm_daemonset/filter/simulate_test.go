@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulate(t *testing.T) {
+	// the filters keep the config in package variables
+	oldOSDiskState, oldIncludePaths, oldExcludePaths := oSDiskExcludeFilterState, includePaths, excludePaths
+	oldPathFilterName, oldPathFilterState := pathFilterName, pathFilterState
+	defer func() {
+		oSDiskExcludeFilterState, includePaths, excludePaths = oldOSDiskState, oldIncludePaths, oldExcludePaths
+		pathFilterName, pathFilterState = oldPathFilterName, oldPathFilterState
+	}()
+
+	ndmConfig := &controller.NodeDiskManagerConfig{
+		FilterConfigs: []controller.FilterConfig{
+			{Key: osDiskExcludeFilterKey, Name: "os disk exclude filter", State: "false", Exclude: "/"},
+			{Key: pathFilterKey, Name: "path filter", State: "true", Exclude: "loop,/dev/sdc"},
+		},
+	}
+	newDevice := func(devPath, vendor string, capacity uint64) blockdevice.BlockDevice {
+		device := blockdevice.BlockDevice{}
+		device.DevPath = devPath
+		device.DeviceAttributes.Vendor = vendor
+		device.Capacity.Storage = capacity
+		return device
+	}
+	devices := []blockdevice.BlockDevice{
+		newDevice("/dev/sdb", "ATA", 1<<30),
+		newDevice("/dev/sdc", "OpenEBS", 1<<30),
+		newDevice("/dev/sdd", "ATA", 0),
+		newDevice("/dev/loop0", "", 1<<30),
+	}
+
+	decisions := Simulate(ndmConfig, devices)
+	assert.Len(t, decisions, 4)
+	assert.Equal(t, Decision{
+		DevPath:  "/dev/sdb",
+		Included: true,
+		Results: []FilterResult{
+			{Key: osDiskExcludeFilterKey, Name: "os disk exclude filter", Result: ResultDisabled},
+			{Key: vendorFilterKey, Name: vendorFilterName, Result: ResultIncluded},
+			{Key: pathFilterKey, Name: "path filter", Result: ResultIncluded},
+			{Key: deviceValidityFilterKey, Name: deviceValidityFilterName, Result: ResultIncluded},
+		},
+	}, decisions[0])
+
+	// the device is excluded by the first filter, but all the filters are applied
+	assert.False(t, decisions[1].Included)
+	assert.Equal(t, vendorFilterName, decisions[1].ExcludedBy)
+	assert.Equal(t, ResultExcluded, decisions[1].Results[1].Result)
+	assert.Equal(t, ResultExcluded, decisions[1].Results[2].Result)
+
+	assert.False(t, decisions[2].Included)
+	assert.Equal(t, deviceValidityFilterName, decisions[2].ExcludedBy)
+	assert.False(t, decisions[3].Included)
+	assert.Equal(t, "path filter", decisions[3].ExcludedBy)
+}
@@ -31,10 +31,11 @@ const (
 )
 
 var (
-	vendorFilterName  = "vendor filter" // filter name
-	vendorFilterState = defaultEnabled  // filter state
-	includeVendors    = ""
-	excludeVendors    = ""
+	defaultVendorFilterName = "vendor filter" // filter name
+	vendorFilterName        = defaultVendorFilterName
+	vendorFilterState       = defaultEnabled // filter state
+	includeVendors          = ""
+	excludeVendors          = ""
 	// list of vendors that are excluded by default. This is done so that OpenEBS created disks are excluded
 	// by default
 	defaultExcludedVendors = []string{vendorValueOpenEBS}
@@ -46,8 +47,17 @@ var vendorFilterRegister = func() {
 	if ctrl == nil {
 		return
 	}
-	if ctrl.NDMConfig != nil {
-		for _, filterConfig := range ctrl.NDMConfig.FilterConfigs {
+	newVendorRegisterFilter(ctrl).register()
+}
+
+// newVendorRegisterFilter creates the registerFilter of the vendor filter using the config
+func newVendorRegisterFilter(ctrl *controller.Controller) *registerFilter {
+	// the defaults are restored first, so that they are used again when the
+	// filter is removed from a reloaded config
+	vendorFilterName, vendorFilterState = defaultVendorFilterName, defaultEnabled
+	includeVendors, excludeVendors = "", ""
+	if ndmConfig := ctrl.GetNDMConfig(); ndmConfig != nil {
+		for _, filterConfig := range ndmConfig.FilterConfigs {
 			if filterConfig.Key == vendorFilterKey {
 				vendorFilterName = filterConfig.Name
 				vendorFilterState = util.CheckTruthy(filterConfig.State)
@@ -58,13 +68,13 @@ var vendorFilterRegister = func() {
 		}
 	}
 	var fi controller.FilterInterface = newVendorFilter(ctrl)
-	newRegisterFilter := &registerFilter{
+	return &registerFilter{
+		key:        vendorFilterKey,
 		name:       vendorFilterName,
 		state:      vendorFilterState,
 		fi:         fi,
 		controller: ctrl,
 	}
-	newRegisterFilter.register()
 }
 
 // vendorFilter contains controller and include and exclude vendors
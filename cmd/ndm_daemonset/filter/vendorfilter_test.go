@@ -44,6 +44,7 @@ func TestVendorFilterRegister(t *testing.T) {
 		excludeVendors: []string{vendorValueOpenEBS},
 	}
 	filter := &controller.Filter{
+		Key:       vendorFilterKey,
 		Name:      vendorFilterName,
 		State:     vendorFilterState,
 		Interface: fi,
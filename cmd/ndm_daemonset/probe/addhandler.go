@@ -22,10 +22,11 @@ import (
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/db/kubernetes"
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/features"
+	"github.com/openebs/node-disk-manager/pkg/logs"
 	"github.com/openebs/node-disk-manager/pkg/partition"
 
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/klog"
 )
 
 const (
@@ -43,12 +44,12 @@ func (pe *ProbeEvent) addBlockDeviceToHierarchyCache(bd blockdevice.BlockDevice)
 	// check if the device already exists in the cache
 	_, ok := pe.Controller.BDHierarchy[bd.DevPath]
 	if ok {
-		klog.V(4).Infof("device: %s already exists in cache, "+
+		logger.V(4).Infof("device: %s already exists in cache, "+
 			"the event was likely generated by a partition table re-read", bd.DevPath)
 		deviceAlreadyExistsInCache = true
 	}
 	if !ok {
-		klog.V(4).Infof("device: %s does not exist in cache, "+
+		logger.V(4).Infof("device: %s does not exist in cache, "+
 			"the device is now connected to this node", bd.DevPath)
 		deviceAlreadyExistsInCache = false
 	}
@@ -67,32 +68,44 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 	// eg:devices in use by mayastor, zfs PV and jiva
 	// TODO jiva handling is still to be added.
 	if ok, err := pe.handleUnmanagedDevices(bd, bdAPIList); err != nil {
-		klog.Errorf("error handling unmanaged device %s. error: %v", bd.DevPath, err)
+		logger.Errorf("error handling unmanaged device %s. error: %v", bd.DevPath, err)
 		return err
 	} else if !ok {
-		klog.V(4).Infof("processed device: %s being used by mayastor/zfs-localPV", bd.DevPath)
+		logger.V(4).Infof("processed device: %s being used by mayastor/zfs-localPV", bd.DevPath)
 		return nil
 	}
 
 	// if parent device in use, no need to process further
 	if ok, err := pe.isParentDeviceInUse(bd); err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to check if the parent device is in use", logs.PathKey, bd.DevPath)
 		return err
 	} else if ok {
-		klog.Infof("parent device of device: %s in use", bd.DevPath)
+		logger.Infof("parent device of device: %s in use", bd.DevPath)
 		return nil
 	}
 
 	// upgrades the devices that are in use and used the legacy method
 	// for uuid generation.
 	if ok, err := pe.upgradeBD(bd, bdAPIList); err != nil {
-		klog.Errorf("upgrade of device: %s failed. Error: %v", bd.DevPath, err)
+		logger.Errorf("upgrade of device: %s failed. Error: %v", bd.DevPath, err)
 		return err
 	} else if !ok {
-		klog.V(4).Infof("device: %s upgraded", bd.DevPath)
+		logger.V(4).Infof("device: %s upgraded", bd.DevPath)
 		return nil
 	}
 
+	// migrates the devices which were created using the legacy method
+	// for uuid generation, if migration is enabled
+	if pe.Controller.IsFeatureEnabled(features.UUIDMigration) {
+		if ok, err := pe.migrateLegacyBD(bd, bdAPIList); err != nil {
+			logger.Errorf("migration of device: %s failed. Error: %v", bd.DevPath, err)
+			return err
+		} else if !ok {
+			logger.V(4).Infof("device: %s migrated", bd.DevPath)
+			return nil
+		}
+	}
+
 	/*
 		Cases when an add event is generated
 		1. A new disk is added to the cluster to this node -  the disk is first time in this cluster
@@ -103,35 +116,44 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 	*/
 
 	// check if the disk can be uniquely identified. we try to generate the UUID for the device
-	klog.V(4).Infof("checking if device: %s can be uniquely identified", bd.DevPath)
+	logger.V(4).Infof("checking if device: %s can be uniquely identified", bd.DevPath)
 	uuid, ok := generateUUID(bd)
 	// if UUID cannot be generated create a GPT partition on the device
 	if !ok {
-		klog.V(4).Infof("device: %s cannot be uniquely identified", bd.DevPath)
+		logger.V(4).Infof("device: %s cannot be uniquely identified", bd.DevPath)
 		if len(bd.DependentDevices.Partitions) > 0 ||
 			len(bd.DependentDevices.Holders) > 0 {
-			klog.V(4).Infof("device: %s has holders/partitions. %+v", bd.DevPath, bd.DependentDevices)
+			logger.V(4).Infof("device: %s has holders/partitions. %+v", bd.DevPath, bd.DependentDevices)
+		} else if !deviceWritesAllowed(bd.DevPath) {
+			logger.Warningf("device writes are disabled, not creating partition on device: %s", bd.DevPath)
 		} else {
-			klog.Infof("starting to create partition on device: %s", bd.DevPath)
+			logger.Infof("starting to create partition on device: %s", bd.DevPath)
 			d := partition.Disk{
 				DevPath:          bd.DevPath,
 				DiskSize:         bd.Capacity.Storage,
 				LogicalBlockSize: uint64(bd.DeviceAttributes.LogicalBlockSize),
 			}
-			if err := d.CreateSinglePartition(); err != nil {
-				klog.Errorf("error creating partition for %s, %v", bd.DevPath, err)
+			if err := createPartition(d); err != nil {
+				logger.Errorf("error creating partition for %s, %v", bd.DevPath, err)
 				return err
 			}
-			klog.Infof("created new partition in %s", bd.DevPath)
+			logger.Infof("created new partition in %s", bd.DevPath)
 			return nil
 		}
 	} else {
 		bd.UUID = uuid
-		klog.V(4).Infof("uuid: %s has been generated for device: %s", uuid, bd.DevPath)
+		logger.V(4).Infof("uuid: %s has been generated for device: %s", uuid, bd.DevPath)
 		bdAPI, err := pe.Controller.GetBlockDevice(uuid)
 
+		// do not overwrite the resource of another device having the same UUID
+		if err == nil && pe.Controller.IsUUIDCollision(&bd, bdAPI) {
+			pe.Controller.ResolveUUIDCollision(&bd, bdAPI)
+			uuid = bd.UUID
+			bdAPI, err = pe.Controller.GetBlockDevice(uuid)
+		}
+
 		if errors.IsNotFound(err) {
-			klog.V(4).Infof("device: %s, uuid: %s not found in etcd", bd.DevPath, uuid)
+			logger.V(4).Infof("device: %s, uuid: %s not found in etcd", bd.DevPath, uuid)
 			/*
 				Cases when the BlockDevice is not found in etcd
 				1. The device is appearing in this cluster for the first time
@@ -139,37 +161,37 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 			*/
 
 			if bd.DeviceAttributes.DeviceType == blockdevice.BlockDeviceTypePartition {
-				klog.V(4).Infof("device: %s is partition", bd.DevPath)
-				klog.V(4).Info("checking if device has a parent")
+				logger.V(4).Infof("device: %s is partition", bd.DevPath)
+				logger.V(4).Infof("checking if device has a parent")
 				// check if device has a parent that is claimed
 				parentBD, ok := pe.Controller.BDHierarchy[bd.DependentDevices.Parent]
 				if !ok {
-					klog.V(4).Infof("unable to find parent device for device: %s", bd.DevPath)
+					logger.V(4).Infof("unable to find parent device for device: %s", bd.DevPath)
 					return fmt.Errorf("cannot get parent device for device: %s", bd.DevPath)
 				}
 
-				klog.V(4).Infof("parent device: %s found for device: %s", parentBD.DevPath, bd.DevPath)
-				klog.V(4).Infof("checking if parent device can be uniquely identified")
+				logger.V(4).Infof("parent device: %s found for device: %s", parentBD.DevPath, bd.DevPath)
+				logger.V(4).Infof("checking if parent device can be uniquely identified")
 				parentUUID, parentOK := generateUUID(parentBD)
 				if !parentOK {
-					klog.V(4).Infof("unable to generate UUID for parent device, may be a device without WWN")
+					logger.V(4).Infof("unable to generate UUID for parent device, may be a device without WWN")
 					// cannot generate UUID for parent, may be a device without WWN
 					// used the new algorithm to create partitions
 					return pe.createBlockDeviceResourceIfNoHolders(bd, bdAPIList)
 				}
 
-				klog.V(4).Infof("uuid: %s generated for parent device: %s", parentUUID, parentBD.DevPath)
+				logger.V(4).Infof("uuid: %s generated for parent device: %s", parentUUID, parentBD.DevPath)
 
 				parentBDAPI, err := pe.Controller.GetBlockDevice(parentUUID)
 
 				if errors.IsNotFound(err) {
 					// parent not present in etcd, may be device without wwn or had partitions/holders
-					klog.V(4).Infof("parent device: %s, uuid: %s not found in etcd", parentBD.DevPath, parentUUID)
+					logger.V(4).Infof("parent device: %s, uuid: %s not found in etcd", parentBD.DevPath, parentUUID)
 					return pe.createBlockDeviceResourceIfNoHolders(bd, bdAPIList)
 				}
 
 				if err != nil {
-					klog.Error(err)
+					logger.Error(err, "unable to process the device", logs.PathKey, bd.DevPath)
 					return err
 					// get call failed
 				}
@@ -177,7 +199,7 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 				if parentBDAPI.Status.ClaimState != apis.BlockDeviceUnclaimed {
 					// device is in use, and the consumer is doing something
 					// do nothing
-					klog.V(4).Infof("parent device: %s is in use, device: %s can be ignored", parentBD.DevPath, bd.DevPath)
+					logger.V(4).Infof("parent device: %s is in use, device: %s can be ignored", parentBD.DevPath, bd.DevPath)
 					return nil
 				} else {
 					// the consumer created some partitions on the disk.
@@ -193,7 +215,7 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 
 					err = pe.createOrUpdateWithAnnotation(annotations, bd, existingBlockDeviceResource)
 					if err != nil {
-						klog.Error(err)
+						logger.Error(err, "unable to create or update the blockdevice", logs.PathKey, bd.DevPath)
 						return err
 					}
 					return nil
@@ -203,7 +225,7 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 
 			if bd.DeviceAttributes.DeviceType != blockdevice.BlockDeviceTypePartition &&
 				len(bd.DependentDevices.Partitions) > 0 {
-				klog.V(4).Infof("device: %s has partitions: %+v", bd.DevPath, bd.DependentDevices.Partitions)
+				logger.V(4).Infof("device: %s has partitions: %+v", bd.DevPath, bd.DependentDevices.Partitions)
 				return nil
 			}
 
@@ -211,12 +233,12 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 		}
 
 		if err != nil {
-			klog.Errorf("querying etcd failed: %+v", err)
+			logger.Errorf("querying etcd failed: %+v", err)
 			return err
 		}
 
 		if bdAPI.Status.ClaimState != apis.BlockDeviceUnclaimed {
-			klog.V(4).Infof("device: %s is in use. update the details of the blockdevice", bd.DevPath)
+			logger.V(4).Infof("device: %s is in use. update the details of the blockdevice", bd.DevPath)
 
 			annotation := map[string]string{
 				internalUUIDSchemeAnnotation: gptUUIDScheme,
@@ -224,13 +246,13 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 
 			err = pe.createOrUpdateWithAnnotation(annotation, bd, bdAPI)
 			if err != nil {
-				klog.Errorf("updating block device resource failed: %+v", err)
+				logger.Errorf("updating block device resource failed: %+v", err)
 				return err
 			}
 			return nil
 		}
 
-		klog.V(4).Infof("creating resource for device: %s with uuid: %s", bd.DevPath, bd.UUID)
+		logger.V(4).Infof("creating resource for device: %s with uuid: %s", bd.DevPath, bd.UUID)
 		existingBlockDeviceResource := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, bd.UUID)
 		annotations := map[string]string{
 			internalUUIDSchemeAnnotation: gptUUIDScheme,
@@ -238,7 +260,7 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 
 		err = pe.createOrUpdateWithAnnotation(annotations, bd, existingBlockDeviceResource)
 		if err != nil {
-			klog.Errorf("creation of resource failed: %+v", err)
+			logger.Errorf("creation of resource failed: %+v", err)
 			return err
 		}
 		return nil
@@ -250,12 +272,12 @@ func (pe *ProbeEvent) addBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis
 // holder devices
 func (pe *ProbeEvent) createBlockDeviceResourceIfNoHolders(bd blockdevice.BlockDevice, bdAPIList *apis.BlockDeviceList) error {
 	if len(bd.DependentDevices.Holders) > 0 {
-		klog.V(4).Infof("device: %s has holder devices: %+v", bd.DevPath, bd.DependentDevices.Holders)
-		klog.V(4).Infof("skip creating BlockDevice resource")
+		logger.V(4).Infof("device: %s has holder devices: %+v", bd.DevPath, bd.DependentDevices.Holders)
+		logger.V(4).Infof("skip creating BlockDevice resource")
 		return nil
 	}
 
-	klog.V(4).Infof("creating block device resource for device: %s with uuid: %s", bd.DevPath, bd.UUID)
+	logger.V(4).Infof("creating block device resource for device: %s with uuid: %s", bd.DevPath, bd.UUID)
 
 	existingBlockDeviceResource := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, bd.UUID)
 
@@ -265,7 +287,7 @@ func (pe *ProbeEvent) createBlockDeviceResourceIfNoHolders(bd blockdevice.BlockD
 
 	err := pe.createOrUpdateWithAnnotation(annotations, bd, existingBlockDeviceResource)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to create or update the blockdevice", logs.PathKey, bd.DevPath)
 		return err
 	}
 	return nil
@@ -331,7 +353,7 @@ func (pe *ProbeEvent) deviceInUseByMayastor(bd blockdevice.BlockDevice, bdAPILis
 		return true, nil
 	}
 
-	klog.V(4).Infof("Device: %s in use by mayastor. ignoring the event", bd.DevPath)
+	logger.V(4).Infof("Device: %s in use by mayastor. ignoring the event", bd.DevPath)
 	return false, nil
 }
 
@@ -342,11 +364,11 @@ func (pe *ProbeEvent) deviceInUseByZFSLocalPV(bd blockdevice.BlockDevice, bdAPIL
 	if bd.DeviceAttributes.DeviceType == blockdevice.BlockDeviceTypePartition {
 		parentBD, ok := pe.Controller.BDHierarchy[bd.DependentDevices.Parent]
 		if !ok {
-			klog.Errorf("unable to find parent device for %s", bd.DevPath)
+			logger.Errorf("unable to find parent device for %s", bd.DevPath)
 			return false, fmt.Errorf("error in getting parent device for %s from device hierarchy", bd.DevPath)
 		}
 		if parentBD.DevUse.InUse && parentBD.DevUse.UsedBy == blockdevice.ZFSLocalPV {
-			klog.V(4).Infof("ParentDevice: %s of device: %s in use by zfs-localPV", parentBD.DevPath, bd.DevPath)
+			logger.V(4).Infof("ParentDevice: %s of device: %s in use by zfs-localPV", parentBD.DevPath, bd.DevPath)
 			return false, nil
 		}
 
@@ -360,11 +382,11 @@ func (pe *ProbeEvent) deviceInUseByZFSLocalPV(bd blockdevice.BlockDevice, bdAPIL
 		return true, nil
 	}
 
-	klog.Infof("device: %s in use by zfs-localPV", bd.DevPath)
+	logger.Infof("device: %s in use by zfs-localPV", bd.DevPath)
 
 	uuid, ok := generateUUIDFromPartitionTable(bd)
 	if !ok {
-		klog.Errorf("unable to generate uuid for zfs-localPV device: %s", bd.DevPath)
+		logger.Errorf("unable to generate uuid for zfs-localPV device: %s", bd.DevPath)
 		return false, fmt.Errorf("error generating uuid for zfs-localPV disk: %s", bd.DevPath)
 	}
 
@@ -376,10 +398,10 @@ func (pe *ProbeEvent) deviceInUseByZFSLocalPV(bd blockdevice.BlockDevice, bdAPIL
 
 	err := pe.Controller.CreateBlockDevice(bdAPI)
 	if err != nil {
-		klog.Errorf("unable to push %s (%s) to etcd", bd.UUID, bd.DevPath)
+		logger.Errorf("unable to push %s (%s) to etcd", bd.UUID, bd.DevPath)
 		return false, err
 	}
-	klog.Infof("Pushed zfs-localPV device: %s (%s) to etcd", bd.UUID, bd.DevPath)
+	logger.Infof("Pushed zfs-localPV device: %s (%s) to etcd", bd.UUID, bd.DevPath)
 	return false, nil
 }
 
@@ -395,7 +417,7 @@ func (pe *ProbeEvent) upgradeDeviceInUseByCStor(bd blockdevice.BlockDevice, bdAP
 				return true, nil
 			} else {
 				// should never reach this case
-				klog.Error("unreachable state")
+				logger.Errorf("unreachable state")
 				return false, fmt.Errorf("unreachable state")
 			}
 		}
@@ -434,7 +456,7 @@ func (pe *ProbeEvent) upgradeDeviceInUseByCStor(bd blockdevice.BlockDevice, bdAP
 		return false, err
 	} else {
 		// should never reach this case.
-		klog.Error("unreachable state")
+		logger.Errorf("unreachable state")
 		return false, fmt.Errorf("unreachable state")
 	}
 }
@@ -451,7 +473,7 @@ func (pe *ProbeEvent) upgradeDeviceInUseByLocalPV(bd blockdevice.BlockDevice, bd
 				return true, nil
 			} else {
 				// should never reach this case
-				klog.Error("unreachable state")
+				logger.Errorf("unreachable state")
 				return false, fmt.Errorf("unreachable state")
 			}
 		}
@@ -492,7 +514,7 @@ func (pe *ProbeEvent) upgradeDeviceInUseByLocalPV(bd blockdevice.BlockDevice, bd
 		return false, err
 	} else {
 		// should never reach this case.
-		klog.Error("unreachable state")
+		logger.Errorf("unreachable state")
 		return false, fmt.Errorf("unreachable state")
 	}
 }
@@ -555,10 +577,10 @@ func (pe *ProbeEvent) createOrUpdateWithFSUUID(bd blockdevice.BlockDevice, exist
 	}
 	err := pe.createOrUpdateWithAnnotation(annotation, bd, existingBD)
 	if err != nil {
-		klog.Errorf("could not push localPV device: %s (%s) to etcd", bd.UUID, bd.DevPath)
+		logger.Errorf("could not push localPV device: %s (%s) to etcd", bd.UUID, bd.DevPath)
 		return err
 	}
-	klog.Infof("Pushed localPV device: %s (%s) to etcd", bd.UUID, bd.DevPath)
+	logger.Infof("Pushed localPV device: %s (%s) to etcd", bd.UUID, bd.DevPath)
 	return nil
 }
 
@@ -571,10 +593,10 @@ func (pe *ProbeEvent) createOrUpdateWithPartitionUUID(bd blockdevice.BlockDevice
 	}
 	err := pe.createOrUpdateWithAnnotation(annotation, bd, existingBD)
 	if err != nil {
-		klog.Errorf("could not push cstor device: %s (%s) to etcd", bd.UUID, bd.DevPath)
+		logger.Errorf("could not push cstor device: %s (%s) to etcd", bd.UUID, bd.DevPath)
 		return err
 	}
-	klog.Infof("Pushed cstor device: %s (%s) to etcd", bd.UUID, bd.DevPath)
+	logger.Infof("Pushed cstor device: %s (%s) to etcd", bd.UUID, bd.DevPath)
 	return nil
 }
 
@@ -592,7 +614,7 @@ func (pe *ProbeEvent) createOrUpdateWithAnnotation(annotation map[string]string,
 		err = pe.Controller.CreateBlockDevice(bdAPI)
 	}
 	if err != nil {
-		klog.Errorf("unable to push %s (%s) to etcd", bd.UUID, bd.DevPath)
+		logger.Errorf("unable to push %s (%s) to etcd", bd.UUID, bd.DevPath)
 		return err
 	}
 	return nil
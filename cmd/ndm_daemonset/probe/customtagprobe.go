@@ -17,18 +17,23 @@ limitations under the License.
 package probe
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
 	"github.com/openebs/node-disk-manager/db/kubernetes"
 	"github.com/openebs/node-disk-manager/pkg/util"
-
-	"k8s.io/klog"
 )
 
 const (
 	customTagProbePriority = 7
 
 	tagTypePath = "path"
+
+	// customTagProbeKey is the key of the custom tag probe. The probe is configured
+	// using the tag configs.
+	customTagProbeKey = "custom-tag-probe"
 )
 
 var (
@@ -38,6 +43,7 @@ var (
 )
 
 type customTagProbe struct {
+	sync.RWMutex
 	tags []tag
 }
 
@@ -55,29 +61,17 @@ var customTagProbeRegister = func() {
 	// Get a controller object
 	ctrl := <-controller.ControllerBroadcastChannel
 	if ctrl == nil {
-		klog.Error("unable to configure custom tag probe")
+		logger.Errorf("unable to configure custom tag probe")
 		return
 	}
 	tagProbe := &customTagProbe{}
 
 	if ctrl.NDMConfig != nil {
-		for _, tagConfig := range ctrl.NDMConfig.TagConfigs {
-			if !util.Contains(supportedTagTypes, tagConfig.Type) {
-				klog.Errorf("unsupported tag type: %s", tagConfig.Type)
-			}
-
-			if !util.IsMatchRegex(labelValidatorRegex, tagConfig.TagName) {
-				klog.Errorf("not a valid label \"%s\"", tagConfig.TagName)
-			}
-
-			tagProbe.tags = append(tagProbe.tags, tag{
-				tagType: tagConfig.Type,
-				regex:   tagConfig.Pattern,
-				label:   tagConfig.TagName,
-			})
-		}
+		// invalid tags are only logged during startup
+		tagProbe.tags, _ = getTagsFromConfig(ctrl.NDMConfig.TagConfigs)
 	}
 	newRegisterProbe := &registerProbe{
+		key:        customTagProbeKey,
 		priority:   customTagProbePriority,
 		name:       "Custom Tag Probe",
 		state:      customTagProbeState,
@@ -87,9 +81,43 @@ var customTagProbeRegister = func() {
 	newRegisterProbe.register()
 }
 
+// getTagsFromConfig gets the tags from the tag configs. All the tags are returned
+// along with an error, if any of the tags is invalid.
+func getTagsFromConfig(tagConfigs []controller.TagConfig) ([]tag, error) {
+	var tags []tag
+	var err error
+	for _, tagConfig := range tagConfigs {
+		if !util.Contains(supportedTagTypes, tagConfig.Type) {
+			err = fmt.Errorf("unsupported tag type: %s", tagConfig.Type)
+			logger.Error(err, "invalid tag config")
+		}
+
+		if !util.IsMatchRegex(labelValidatorRegex, tagConfig.TagName) {
+			err = fmt.Errorf("not a valid label \"%s\"", tagConfig.TagName)
+			logger.Error(err, "invalid tag config")
+		}
+
+		tags = append(tags, tag{
+			tagType: tagConfig.Type,
+			regex:   tagConfig.Pattern,
+			label:   tagConfig.TagName,
+		})
+	}
+	return tags, err
+}
+
+// setTags replaces the tags of the probe
+func (ctp *customTagProbe) setTags(tags []tag) {
+	ctp.Lock()
+	defer ctp.Unlock()
+	ctp.tags = tags
+}
+
 func (ctp *customTagProbe) Start() {}
 
 func (ctp *customTagProbe) FillBlockDeviceDetails(bd *blockdevice.BlockDevice) {
+	ctp.RLock()
+	defer ctp.RUnlock()
 	for _, tag := range ctp.tags {
 		var fieldToMatch string
 		switch tag.tagType {
@@ -101,7 +129,7 @@ func (ctp *customTagProbe) FillBlockDeviceDetails(bd *blockdevice.BlockDevice) {
 		}
 		if util.IsMatchRegex(tag.regex, fieldToMatch) {
 			bd.Labels[kubernetes.BlockDeviceTagLabel] = tag.label
-			klog.Infof("Device: %s Label %s:%s added by custom tag probe", bd.DevPath, kubernetes.BlockDeviceTagLabel, tag.label)
+			logger.Infof("Device: %s Label %s:%s added by custom tag probe", bd.DevPath, kubernetes.BlockDeviceTagLabel, tag.label)
 		}
 	}
 }
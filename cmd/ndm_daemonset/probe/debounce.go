@@ -0,0 +1,454 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+)
+
+const (
+	// EnvDebounceWindow is the environment variable used to configure the time
+	// for which a device must be stably present or absent before its state is changed.
+	EnvDebounceWindow = "DEVICE_DEBOUNCE_WINDOW"
+
+	// EnvCoalesceWindow is the environment variable used to configure the time
+	// over which change events of a device are coalesced into a single event.
+	EnvCoalesceWindow = "EVENT_COALESCE_WINDOW"
+
+	// EnvEventQueueSize is the environment variable used to configure the maximum
+	// number of devices that can have pending events.
+	EnvEventQueueSize = "EVENT_QUEUE_SIZE"
+)
+
+var (
+	// defaultDebounceWindow is the debounce window used if not configured
+	defaultDebounceWindow = 2 * time.Second
+
+	// defaultCoalesceWindow is the coalesce window used if not configured
+	defaultCoalesceWindow = 500 * time.Millisecond
+
+	// FlapThreshold is the number of state changes within FlapWindow
+	// after which a device is considered to be flapping
+	FlapThreshold = 5
+
+	// FlapWindow is the period over which state changes of a device are counted
+	FlapWindow = 5 * time.Minute
+
+	// defaultEventQueueSize is the event queue size used if not configured
+	defaultEventQueueSize = 1024
+
+	// MaxDeviceEvents is the number of events of a device allowed within
+	// DeviceEventWindow, further events of the device are dropped
+	MaxDeviceEvents = 100
+
+	// DeviceEventWindow is the period over which events of a device are counted
+	DeviceEventWindow = 10 * time.Second
+
+	// ResyncDelay is the time after the first dropped event at which a resync
+	// is requested
+	ResyncDelay = 10 * time.Second
+)
+
+// getDebounceWindow gets the debounce window from env
+func getDebounceWindow() time.Duration {
+	return getWindow(EnvDebounceWindow, defaultDebounceWindow)
+}
+
+// getCoalesceWindow gets the coalesce window from env
+func getCoalesceWindow() time.Duration {
+	return getWindow(EnvCoalesceWindow, defaultCoalesceWindow)
+}
+
+// getEventQueueSize gets the event queue size from env
+func getEventQueueSize() int {
+	val, ok := os.LookupEnv(EnvEventQueueSize)
+	if !ok {
+		return defaultEventQueueSize
+	}
+	size, err := strconv.Atoi(val)
+	if err != nil || size <= 0 {
+		logger.Warningf("invalid %s: %s, using %d", EnvEventQueueSize, val, defaultEventQueueSize)
+		return defaultEventQueueSize
+	}
+	return size
+}
+
+func getWindow(env string, defaultWindow time.Duration) time.Duration {
+	val, ok := os.LookupEnv(env)
+	if !ok {
+		return defaultWindow
+	}
+	window, err := time.ParseDuration(val)
+	if err != nil || window < 0 {
+		logger.Warningf("invalid %s: %s, using %v", env, val, defaultWindow)
+		return defaultWindow
+	}
+	return window
+}
+
+// eventRate counts the events of a device within the device event window
+type eventRate struct {
+	start time.Time
+	count int
+}
+
+// pendingEvent is an event for a device that is waiting for the debounce window to expire
+type pendingEvent struct {
+	action     string
+	device     *blockdevice.BlockDevice
+	generation uint64
+	// receivedAt is the time at which the first of the coalesced events was received
+	receivedAt time.Time
+}
+
+// deviceDebouncer holds the events of each device till the device is stable, i.e no
+// further events are received for the device within the debounce window. The events
+// of the device are coalesced into a single event which is then passed on. Change
+// events are coalesced over the shorter coalesce window, since they do not change
+// the state of the device. It also tracks the state changes of each device to detect
+// devices which are flapping.
+//
+// To protect the daemon from event storms, the number of devices with pending
+// events and the rate of events of each device are bounded. Events exceeding the
+// bounds are dropped and a resync is requested, since the state of the devices
+// is no longer known.
+type deviceDebouncer struct {
+	sync.Mutex
+	window         time.Duration
+	coalesceWindow time.Duration
+	generation     uint64
+	// coalesced is the number of events that were merged into another event
+	coalesced uint64
+	// sending is the number of events waiting for the events ahead of them to
+	// be processed
+	sending int
+	// outbox holds the events of each device to be sent, in the order in which
+	// they were released. The events of a device are sent one at a time, so
+	// that they are processed in order.
+	outbox map[string][]controller.EventMessage
+	// maxPending is the maximum number of devices that can have pending events
+	maxPending int
+	// rates are the event rates of each device
+	rates map[string]*eventRate
+	// ratesPrunedAt is the time at which the expired event rates were last
+	// removed
+	ratesPrunedAt time.Time
+	// transitionsPrunedAt is the time at which the state changes older than
+	// the flap window were last removed
+	transitionsPrunedAt time.Time
+	// dropped is the number of events dropped since the last resync
+	dropped     uint64
+	resyncTimer *time.Timer
+	// resync is the channel on which resync requests are sent
+	resync  chan struct{}
+	pending map[string]*pendingEvent
+	// lastAction is the last action received for each device
+	lastAction map[string]string
+	// transitions are the times at which the action of the device changed
+	transitions map[string][]time.Time
+	// events is the channel on which the debounced events are sent
+	events chan controller.EventMessage
+	// now is used to get the current time, can be replaced in tests
+	now func() time.Time
+}
+
+// newDeviceDebouncer creates a debouncer with the given windows. A zero
+// window disables debouncing, but flapping is still tracked.
+func newDeviceDebouncer(window, coalesceWindow time.Duration, maxPending int) *deviceDebouncer {
+	return &deviceDebouncer{
+		window:         window,
+		coalesceWindow: coalesceWindow,
+		maxPending:     maxPending,
+		outbox:         make(map[string][]controller.EventMessage),
+		rates:          make(map[string]*eventRate),
+		resync:         make(chan struct{}, 1),
+		pending:        make(map[string]*pendingEvent),
+		lastAction:     make(map[string]string),
+		transitions:    make(map[string][]time.Time),
+		events:         make(chan controller.EventMessage),
+		now:            time.Now,
+	}
+}
+
+// submit adds the event of the device to the debouncer, coalescing it with any
+// event of the device which is still pending.
+func (d *deviceDebouncer) submit(action string, device *blockdevice.BlockDevice) {
+	key := device.DevPath
+	controller.EventsReceivedTotal.WithLabelValues(action).Inc()
+
+	d.Lock()
+	if reason, ok := d.shouldDrop(key); ok {
+		d.drop(key, action, reason)
+		d.updateQueueDepth()
+		d.Unlock()
+		return
+	}
+	if action != string(ChangeEA) {
+		d.recordTransition(key, action)
+	}
+	receivedAt := d.now()
+	if p, ok := d.pending[key]; ok {
+		receivedAt = p.receivedAt
+		merged := coalesceAction(p.action, action)
+		d.coalesced++
+		controller.EventsCoalescedTotal.Inc()
+		logger.V(4).Infof("coalescing pending %s event for %s with %s event into %s event, %d events coalesced",
+			p.action, key, action, merged, d.coalesced)
+		action = merged
+	}
+	window := d.window
+	if action == string(ChangeEA) {
+		window = d.coalesceWindow
+	}
+	if window == 0 {
+		delete(d.pending, key)
+		device.Status.Flapping = d.isFlapping(key)
+		d.enqueue(key, action, device, receivedAt)
+		d.updateQueueDepth()
+		d.Unlock()
+		return
+	}
+	d.generation++
+	generation := d.generation
+	d.pending[key] = &pendingEvent{
+		action:     action,
+		device:     device,
+		generation: generation,
+		receivedAt: receivedAt,
+	}
+	d.updateQueueDepth()
+	d.Unlock()
+
+	time.AfterFunc(window, func() {
+		d.fire(key, generation)
+	})
+}
+
+// fire sends the pending event of the device, if it has not been replaced
+// by a newer event.
+func (d *deviceDebouncer) fire(key string, generation uint64) {
+	d.Lock()
+	p, ok := d.pending[key]
+	if !ok || p.generation != generation {
+		d.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	p.device.Status.Flapping = d.isFlapping(key)
+	d.enqueue(key, p.action, p.device, p.receivedAt)
+	d.Unlock()
+}
+
+// shouldDrop checks if the event of the device should be dropped, and returns
+// the reason. Should be called with the lock held.
+func (d *deviceDebouncer) shouldDrop(key string) (string, bool) {
+	now := d.now()
+	d.pruneRates(now)
+	d.pruneTransitions(now)
+	rate, ok := d.rates[key]
+	if !ok || now.Sub(rate.start) >= DeviceEventWindow {
+		rate = &eventRate{start: now}
+		d.rates[key] = rate
+	}
+	rate.count++
+	if rate.count > MaxDeviceEvents {
+		return controller.DropReasonDeviceRate, true
+	}
+	if _, ok := d.pending[key]; !ok && d.maxPending > 0 && len(d.pending) >= d.maxPending {
+		return controller.DropReasonQueueFull, true
+	}
+	return "", false
+}
+
+// pruneRates removes the event rates whose window has elapsed, so that the
+// rates of removed devices are not kept forever. The rates are pruned at most
+// once per window. Should be called with the lock held.
+func (d *deviceDebouncer) pruneRates(now time.Time) {
+	if now.Sub(d.ratesPrunedAt) < DeviceEventWindow {
+		return
+	}
+	for key, rate := range d.rates {
+		if now.Sub(rate.start) >= DeviceEventWindow {
+			delete(d.rates, key)
+		}
+	}
+	d.ratesPrunedAt = now
+}
+
+// pruneTransitions removes the state changes of the devices which did not
+// change state within the flap window, so that the state changes of removed
+// devices are not kept forever. The state changes are pruned at most once per
+// window. Should be called with the lock held.
+func (d *deviceDebouncer) pruneTransitions(now time.Time) {
+	if now.Sub(d.transitionsPrunedAt) < FlapWindow {
+		return
+	}
+	for key, transitions := range d.transitions {
+		if len(transitions) == 0 || now.Sub(transitions[len(transitions)-1]) >= FlapWindow {
+			delete(d.transitions, key)
+			delete(d.lastAction, key)
+		}
+	}
+	d.transitionsPrunedAt = now
+}
+
+// drop drops the event of the device and schedules a resync. If the queue is
+// full, all the pending events are also dropped, since the resync will process
+// the latest state of all the devices. Should be called with the lock held.
+func (d *deviceDebouncer) drop(key, action, reason string) {
+	dropped := 1
+	if reason == controller.DropReasonQueueFull {
+		dropped += len(d.pending)
+		// timers of the dropped events will find no pending event
+		d.pending = make(map[string]*pendingEvent)
+	} else if _, ok := d.pending[key]; ok {
+		dropped++
+		delete(d.pending, key)
+	}
+	if d.dropped == 0 {
+		logger.Warningf("dropping udev events, reason: %s, device: %s, action: %s", reason, key, action)
+	}
+	d.dropped += uint64(dropped)
+	controller.EventsDroppedTotal.WithLabelValues(reason).Add(float64(dropped))
+
+	// the resync is scheduled only once, so that it happens even if
+	// the events keep arriving
+	if d.resyncTimer == nil {
+		d.resyncTimer = time.AfterFunc(ResyncDelay, d.requestResync)
+	}
+}
+
+// requestResync sends a resync request, if one is not already pending
+func (d *deviceDebouncer) requestResync() {
+	d.Lock()
+	d.resyncTimer = nil
+	d.Unlock()
+	select {
+	case d.resync <- struct{}{}:
+	default:
+	}
+}
+
+// takeDropped returns the number of events dropped since the last call
+func (d *deviceDebouncer) takeDropped() uint64 {
+	d.Lock()
+	defer d.Unlock()
+	dropped := d.dropped
+	d.dropped = 0
+	return dropped
+}
+
+// coalesceAction returns the action of the event that replaces a pending event.
+// A change event does not replace a pending add event, since the add event
+// already processes the latest details of the device. It also does not replace
+// a pending remove event, since the device is going away and the remove event
+// must not be lost.
+func coalesceAction(pending, action string) string {
+	if action == string(ChangeEA) &&
+		(pending == string(AttachEA) || pending == string(DetachEA)) {
+		return pending
+	}
+	return action
+}
+
+// enqueue adds the event to the outbox of the device, and starts sending the
+// events of the device if they are not already being sent. Should be called
+// with the lock held.
+func (d *deviceDebouncer) enqueue(key, action string, device *blockdevice.BlockDevice, receivedAt time.Time) {
+	d.sending++
+	d.outbox[key] = append(d.outbox[key], controller.EventMessage{
+		Action:     action,
+		Devices:    []*blockdevice.BlockDevice{device},
+		ReceivedAt: receivedAt,
+	})
+	// the event being sent is kept in the outbox till it is received, so
+	// there is no sender of the device if this is the only event
+	if len(d.outbox[key]) == 1 {
+		go d.send(key)
+	}
+}
+
+// send sends the events in the outbox of the device to the listener one at a
+// time, waiting till the events ahead of them are processed.
+func (d *deviceDebouncer) send(key string) {
+	d.Lock()
+	defer d.Unlock()
+	for len(d.outbox[key]) > 0 {
+		msg := d.outbox[key][0]
+		d.Unlock()
+		d.events <- msg
+		d.Lock()
+		d.outbox[key] = d.outbox[key][1:]
+		d.sending--
+		d.updateQueueDepth()
+	}
+	delete(d.outbox, key)
+}
+
+// queueDepth returns the number of events waiting to be processed. Should be
+// called with the lock held.
+func (d *deviceDebouncer) queueDepth() int {
+	return len(d.pending) + d.sending
+}
+
+// updateQueueDepth sets the queue depth on the metric. Should be called with
+// the lock held.
+func (d *deviceDebouncer) updateQueueDepth() {
+	controller.EventQueueDepth.Set(float64(d.queueDepth()))
+}
+
+// recordTransition records the time of the event if the action differs from
+// the previous action of the device. Should be called with the lock held.
+func (d *deviceDebouncer) recordTransition(key, action string) {
+	if last, ok := d.lastAction[key]; ok && last == action {
+		return
+	}
+	d.lastAction[key] = action
+
+	now := d.now()
+	transitions := make([]time.Time, 0, len(d.transitions[key])+1)
+	for _, t := range d.transitions[key] {
+		if now.Sub(t) < FlapWindow {
+			transitions = append(transitions, t)
+		}
+	}
+	transitions = append(transitions, now)
+	d.transitions[key] = transitions
+
+	if len(transitions) == FlapThreshold {
+		logger.Warningf("device %s is flapping, %d state changes in %v", key, len(transitions), FlapWindow)
+	}
+}
+
+// isFlapping checks if the device has changed state more than the threshold
+// within the flap window. Should be called with the lock held.
+func (d *deviceDebouncer) isFlapping(key string) bool {
+	count := 0
+	now := d.now()
+	for _, t := range d.transitions[key] {
+		if now.Sub(t) < FlapWindow {
+			count++
+		}
+	}
+	return count >= FlapThreshold
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDevice(devPath string) *blockdevice.BlockDevice {
+	bd := &blockdevice.BlockDevice{}
+	bd.DevPath = devPath
+	return bd
+}
+
+func receiveEvent(t *testing.T, d *deviceDebouncer) controller.EventMessage {
+	select {
+	case msg := <-d.events:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for debounced event")
+	}
+	return controller.EventMessage{}
+}
+
+func TestDebouncerCoalescesEvents(t *testing.T) {
+	d := newDeviceDebouncer(50*time.Millisecond, 50*time.Millisecond, 0)
+
+	d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+	d.submit(string(DetachEA), newTestDevice("/dev/sda"))
+	d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+
+	// only the last event of the device is sent
+	msg := receiveEvent(t, d)
+	assert.Equal(t, string(AttachEA), msg.Action)
+	assert.Equal(t, "/dev/sda", msg.Devices[0].DevPath)
+
+	select {
+	case msg := <-d.events:
+		t.Fatalf("unexpected event %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDebouncerCoalescesChangeEvents(t *testing.T) {
+	d := newDeviceDebouncer(50*time.Millisecond, 20*time.Millisecond, 0)
+
+	// change events following an add event are merged into the add event
+	d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+	for i := 0; i < 10; i++ {
+		d.submit(string(ChangeEA), newTestDevice("/dev/sda"))
+	}
+	msg := receiveEvent(t, d)
+	assert.Equal(t, string(AttachEA), msg.Action)
+
+	// a burst of change events results in a single change event
+	for i := 0; i < 10; i++ {
+		d.submit(string(ChangeEA), newTestDevice("/dev/sda"))
+	}
+	msg = receiveEvent(t, d)
+	assert.Equal(t, string(ChangeEA), msg.Action)
+	assert.Equal(t, uint64(19), d.coalesced)
+
+	select {
+	case msg := <-d.events:
+		t.Fatalf("unexpected event %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// change events are not counted as state changes
+	d.Lock()
+	defer d.Unlock()
+	assert.Len(t, d.transitions["/dev/sda"], 1)
+}
+
+func TestDebouncerKeepsDetachEvents(t *testing.T) {
+	d := newDeviceDebouncer(50*time.Millisecond, 20*time.Millisecond, 0)
+
+	// a change event following a remove event does not replace it
+	d.submit(string(DetachEA), newTestDevice("/dev/sda"))
+	d.submit(string(ChangeEA), newTestDevice("/dev/sda"))
+	msg := receiveEvent(t, d)
+	assert.Equal(t, string(DetachEA), msg.Action)
+
+	select {
+	case msg := <-d.events:
+		t.Fatalf("unexpected event %v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDebouncerFlapping(t *testing.T) {
+	d := newDeviceDebouncer(0, 0, 0)
+
+	actions := []EventAction{AttachEA, DetachEA, AttachEA, DetachEA, AttachEA}
+	for i, action := range actions {
+		d.submit(string(action), newTestDevice("/dev/sdb"))
+		msg := receiveEvent(t, d)
+		assert.Equal(t, i+1 >= FlapThreshold, msg.Devices[0].Status.Flapping)
+	}
+
+	// duplicate events are not counted as state changes
+	d.submit(string(AttachEA), newTestDevice("/dev/sdc"))
+	receiveEvent(t, d)
+	for i := 0; i < FlapThreshold; i++ {
+		d.submit(string(AttachEA), newTestDevice("/dev/sdc"))
+		msg := receiveEvent(t, d)
+		assert.False(t, msg.Devices[0].Status.Flapping)
+	}
+
+	// state changes older than the flap window are not counted
+	d.now = func() time.Time { return time.Now().Add(2 * FlapWindow) }
+	d.submit(string(DetachEA), newTestDevice("/dev/sdb"))
+	msg := receiveEvent(t, d)
+	assert.False(t, msg.Devices[0].Status.Flapping)
+}
+
+func TestDebouncerDropsEventsOnOverload(t *testing.T) {
+	origMaxDeviceEvents, origResyncDelay := MaxDeviceEvents, ResyncDelay
+	defer func() { MaxDeviceEvents, ResyncDelay = origMaxDeviceEvents, origResyncDelay }()
+	MaxDeviceEvents = 3
+	ResyncDelay = 20 * time.Millisecond
+
+	d := newDeviceDebouncer(time.Hour, time.Hour, 2)
+
+	// events of a device exceeding the rate are dropped along with its pending event
+	for i := 0; i < 4; i++ {
+		d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+	}
+	d.Lock()
+	assert.Empty(t, d.pending)
+	d.Unlock()
+	assert.Equal(t, uint64(2), d.takeDropped())
+
+	select {
+	case <-d.resync:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for resync request")
+	}
+
+	// all pending events are dropped when the queue is full
+	d.submit(string(AttachEA), newTestDevice("/dev/sdb"))
+	d.submit(string(AttachEA), newTestDevice("/dev/sdc"))
+	d.submit(string(AttachEA), newTestDevice("/dev/sdd"))
+	d.Lock()
+	assert.Empty(t, d.pending)
+	d.Unlock()
+	assert.Equal(t, uint64(3), d.takeDropped())
+}
+
+func TestDebouncerPrunesEventRates(t *testing.T) {
+	d := newDeviceDebouncer(0, 0, 0)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+	receiveEvent(t, d)
+	d.submit(string(AttachEA), newTestDevice("/dev/sdb"))
+	receiveEvent(t, d)
+
+	// the rates of the devices without events in the last window are removed
+	now = now.Add(DeviceEventWindow)
+	d.submit(string(DetachEA), newTestDevice("/dev/sdb"))
+	receiveEvent(t, d)
+	d.Lock()
+	defer d.Unlock()
+	assert.Len(t, d.rates, 1)
+	assert.Contains(t, d.rates, "/dev/sdb")
+}
+
+func TestDebouncerQueueDepth(t *testing.T) {
+	d := newDeviceDebouncer(50*time.Millisecond, 50*time.Millisecond, 0)
+	received := testutil.ToFloat64(controller.EventsReceivedTotal.WithLabelValues(string(AttachEA)))
+	coalesced := testutil.ToFloat64(controller.EventsCoalescedTotal)
+
+	d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+	d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+	d.submit(string(AttachEA), newTestDevice("/dev/sdb"))
+	assert.Equal(t, float64(2), testutil.ToFloat64(controller.EventQueueDepth))
+	assert.Equal(t, received+3, testutil.ToFloat64(controller.EventsReceivedTotal.WithLabelValues(string(AttachEA))))
+	assert.Equal(t, coalesced+1, testutil.ToFloat64(controller.EventsCoalescedTotal))
+
+	// the events are counted till they are received by the listener
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, float64(2), testutil.ToFloat64(controller.EventQueueDepth))
+	receiveEvent(t, d)
+	receiveEvent(t, d)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(controller.EventQueueDepth) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDebouncerKeepsEventOrder(t *testing.T) {
+	d := newDeviceDebouncer(0, 0, 0)
+
+	// the events of a device are sent in the order in which they are received,
+	// even if the listener is slow
+	actions := []EventAction{AttachEA, DetachEA, AttachEA, DetachEA}
+	for _, action := range actions {
+		d.submit(string(action), newTestDevice("/dev/sda"))
+	}
+	for _, action := range actions {
+		time.Sleep(10 * time.Millisecond)
+		msg := receiveEvent(t, d)
+		assert.Equal(t, string(action), msg.Action)
+	}
+
+	assert.Eventually(t, func() bool {
+		d.Lock()
+		defer d.Unlock()
+		return len(d.outbox) == 0 && d.sending == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDebouncerPrunesTransitions(t *testing.T) {
+	d := newDeviceDebouncer(0, 0, 0)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	d.submit(string(AttachEA), newTestDevice("/dev/sda"))
+	receiveEvent(t, d)
+	d.submit(string(AttachEA), newTestDevice("/dev/sdb"))
+	receiveEvent(t, d)
+
+	// the state changes of the devices without state changes in the last
+	// flap window are removed
+	now = now.Add(FlapWindow)
+	d.submit(string(DetachEA), newTestDevice("/dev/sdb"))
+	receiveEvent(t, d)
+	d.Lock()
+	defer d.Unlock()
+	assert.Len(t, d.transitions, 1)
+	assert.Contains(t, d.transitions, "/dev/sdb")
+	assert.Len(t, d.lastAction, 1)
+	assert.Contains(t, d.lastAction, "/dev/sdb")
+}
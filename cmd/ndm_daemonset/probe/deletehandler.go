@@ -19,8 +19,6 @@ package probe
 import (
 	"github.com/openebs/node-disk-manager/blockdevice"
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
-
-	"k8s.io/klog"
 )
 
 // removeBlockDeviceFromHierarchyCache removes a block device from the hierarchy.
@@ -28,7 +26,7 @@ import (
 func (pe *ProbeEvent) removeBlockDeviceFromHierarchyCache(bd blockdevice.BlockDevice) bool {
 	_, ok := pe.Controller.BDHierarchy[bd.DevPath]
 	if !ok {
-		klog.Infof("Disk %s not in hierarchy", bd.DevPath)
+		logger.Infof("Disk %s not in hierarchy", bd.DevPath)
 		// not in hierarchy continue
 		return false
 	}
@@ -37,14 +35,21 @@ func (pe *ProbeEvent) removeBlockDeviceFromHierarchyCache(bd blockdevice.BlockDe
 	return true
 }
 
-// deleteBlockDevice marks the block device resource as inactive
+// deleteBlockDevice marks the block device resource as inactive, after the
+// removal grace period if one is configured
 // The following cases are handled
-//	1. Device using legacy UUID
-//	2. Device using GPT UUID
-//	3. Device using partition table UUID (zfs localPV)
+//  1. Device using legacy UUID
+//  2. Device using GPT UUID
+//  3. Device using partition table UUID (zfs localPV)
 //  4. Device using the partition table / fs uuid annotation
 func (pe *ProbeEvent) deleteBlockDevice(bd blockdevice.BlockDevice, bdAPIList *apis.BlockDeviceList) error {
 
+	// the platform id may have been read from sysfs, which is not available once
+	// the device is removed. The value from the cache is used in that case.
+	if cachedBD, ok := pe.Controller.BDHierarchy[bd.DevPath]; ok && len(bd.DeviceAttributes.PlatformID) == 0 {
+		bd.DeviceAttributes.PlatformID = cachedBD.DeviceAttributes.PlatformID
+	}
+
 	if !pe.removeBlockDeviceFromHierarchyCache(bd) {
 		return nil
 	}
@@ -53,8 +58,8 @@ func (pe *ProbeEvent) deleteBlockDevice(bd blockdevice.BlockDevice, bdAPIList *a
 	if uuid, ok := generateUUID(bd); ok {
 		existingBD := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, uuid)
 		if existingBD != nil {
-			pe.Controller.DeactivateBlockDevice(*existingBD)
-			klog.V(4).Infof("deactivated device: %s, using GPT UUID", bd.DevPath)
+			pe.Controller.RemoveBlockDevice(*existingBD)
+			logger.V(4).Infof("removed device: %s, using GPT UUID", bd.DevPath)
 			return nil
 		}
 		// uuid could be generated, but the disk may be using the legacy scheme
@@ -64,16 +69,16 @@ func (pe *ProbeEvent) deleteBlockDevice(bd blockdevice.BlockDevice, bdAPIList *a
 	if partUUID, ok := generateUUIDFromPartitionTable(bd); ok {
 		existingBD := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, partUUID)
 		if existingBD != nil {
-			pe.Controller.DeactivateBlockDevice(*existingBD)
-			klog.V(4).Infof("deactivated device: %s, using partition table UUID", bd.DevPath)
+			pe.Controller.RemoveBlockDevice(*existingBD)
+			logger.V(4).Infof("removed device: %s, using partition table UUID", bd.DevPath)
 			return nil
 		}
 	}
 
 	// try with FSUUID annotation
 	if existingBD := getExistingBDWithFsUuid(bd, bdAPIList); existingBD != nil {
-		pe.Controller.DeactivateBlockDevice(*existingBD)
-		klog.V(4).Infof("deactivated device: %s, using FS UUID annotation", bd.DevPath)
+		pe.Controller.RemoveBlockDevice(*existingBD)
+		logger.V(4).Infof("removed device: %s, using FS UUID annotation", bd.DevPath)
 		return nil
 	}
 
@@ -82,8 +87,8 @@ func (pe *ProbeEvent) deleteBlockDevice(bd blockdevice.BlockDevice, bdAPIList *a
 	// Therefore the search result is used only if the device is not a partition.
 	if existingBD := getExistingBDWithPartitionUUID(bd, bdAPIList); bd.DeviceAttributes.DeviceType != blockdevice.BlockDeviceTypePartition &&
 		existingBD != nil {
-		pe.Controller.DeactivateBlockDevice(*existingBD)
-		klog.V(4).Infof("deactivated device: %s, using Partition UUID annotation", bd.DevPath)
+		pe.Controller.RemoveBlockDevice(*existingBD)
+		logger.V(4).Infof("removed device: %s, using Partition UUID annotation", bd.DevPath)
 		return nil
 	}
 
@@ -91,8 +96,8 @@ func (pe *ProbeEvent) deleteBlockDevice(bd blockdevice.BlockDevice, bdAPIList *a
 	legacyUUID, _ := generateLegacyUUID(bd)
 	existingBD := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, legacyUUID)
 	if existingBD != nil {
-		pe.Controller.DeactivateBlockDevice(*existingBD)
-		klog.V(4).Infof("deactivated device: %s, using legacy UUID", bd.DevPath)
+		pe.Controller.RemoveBlockDevice(*existingBD)
+		logger.V(4).Infof("removed device: %s, using legacy UUID", bd.DevPath)
 		return nil
 	}
 
@@ -19,6 +19,7 @@ package probe
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
@@ -92,6 +93,9 @@ func TestRemoveBlockDeviceFromHierarchyCache(t *testing.T) {
 }
 
 func TestDeleteBlockDevice(t *testing.T) {
+	// the blockdevices are made inactive without the removal grace period
+	defer func(grace time.Duration) { controller.RemovalGracePeriod = grace }(controller.RemovalGracePeriod)
+	controller.RemovalGracePeriod = 0
 
 	fakeWWN := "fake-wwn"
 	fakeSerial := "fake-serial"
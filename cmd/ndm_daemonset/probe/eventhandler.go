@@ -17,10 +17,16 @@ limitations under the License.
 package probe
 
 import (
+	"context"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
 	"github.com/openebs/node-disk-manager/pkg/features"
+	"github.com/openebs/node-disk-manager/pkg/logs"
+	"github.com/openebs/node-disk-manager/pkg/metrics/openmetrics"
+	"github.com/openebs/node-disk-manager/pkg/tracing"
 	libudevwrapper "github.com/openebs/node-disk-manager/pkg/udev"
-	"k8s.io/klog"
 )
 
 // EventAction action type for disk events like attach or detach events
@@ -31,60 +37,210 @@ const (
 	AttachEA EventAction = libudevwrapper.UDEV_ACTION_ADD
 	// DetachEA is detach disk event name
 	DetachEA EventAction = libudevwrapper.UDEV_ACTION_REMOVE
+	// ChangeEA is the event name when properties of the disk change
+	ChangeEA EventAction = libudevwrapper.UDEV_ACTION_CHANGE
 )
 
 // ProbeEvent struct contain a copy of controller it will update disk resources
 type ProbeEvent struct {
 	Controller *controller.Controller
+	// ctx contains the span of the event being processed
+	ctx context.Context
+}
+
+// context returns the context of the event being processed
+func (pe *ProbeEvent) context() context.Context {
+	if pe.ctx == nil {
+		return context.Background()
+	}
+	return pe.ctx
+}
+
+// traceWrite runs the write of the blockdevice resources of the device in a span
+func (pe *ProbeEvent) traceWrite(operation string, device *blockdevice.BlockDevice, write func() error) error {
+	_, span := tracing.StartSpan(pe.context(), "blockdevice."+operation)
+	defer span.End()
+	span.SetAttribute(tracing.DevicePathKey, device.DevPath)
+	err := write()
+	span.RecordError(err)
+	return err
+}
+
+// handle passes the event message to the handler of the event action. The
+// processing of the event is traced in a span starting at the receipt of the event.
+func (pe *ProbeEvent) handle(msg controller.EventMessage) {
+	start := msg.ReceivedAt
+	if start.IsZero() {
+		start = time.Now()
+	}
+	ctx, span := tracing.StartSpanAt(context.Background(), "ndm.event", start)
+	span.SetAttribute("ndm.event.action", msg.Action)
+	span.SetAttribute("ndm.event.devices", len(msg.Devices))
+	span.SetAttribute("ndm.event.full_scan", msg.AllBlockDevices)
+	if len(msg.Devices) == 1 {
+		span.SetAttribute(tracing.DevicePathKey, msg.Devices[0].DevPath)
+	}
+	tracedEvent := &ProbeEvent{Controller: pe.Controller, ctx: ctx}
+
+	switch msg.Action {
+	case string(AttachEA):
+		tracedEvent.addBlockDeviceEvent(msg)
+	case string(DetachEA):
+		tracedEvent.deleteBlockDeviceEvent(msg)
+	case string(ChangeEA):
+		tracedEvent.changeBlockDeviceEvent(msg)
+	}
+	span.End()
+	if !msg.ReceivedAt.IsZero() {
+		openmetrics.ObserveWithTraceID(controller.EventProcessingDuration.WithLabelValues(msg.Action),
+			time.Since(msg.ReceivedAt).Seconds(), span.TraceID())
+	}
+	if !msg.ScanStartedAt.IsZero() {
+		controller.RescanDuration.Observe(time.Since(msg.ScanStartedAt).Seconds())
+		pe.Controller.ScanProcessed()
+	}
 }
 
 // addBlockDeviceEvent fill block device details from different probes and push it to etcd
 func (pe *ProbeEvent) addBlockDeviceEvent(msg controller.EventMessage) {
 	// bdAPIList is the list of all the BlockDevice resources in the cluster
-	bdAPIList, err := pe.Controller.ListBlockDeviceResource(true)
+	bdAPIList, err := pe.Controller.ListBlockDeviceResourceOffline(true)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to list the blockdevices")
 		go Rescan(pe.Controller)
 		return
 	}
 
-	isGPTBasedUUIDEnabled := features.FeatureGates.IsEnabled(features.GPTBasedUUID)
+	isGPTBasedUUIDEnabled := pe.Controller.IsFeatureEnabled(features.GPTBasedUUID)
 
 	isErrorDuringUpdate := false
+	devPaths := make(map[string]bool)
 	// iterate through each block device and perform the add/update operation
 	for _, device := range msg.Devices {
-		klog.Infof("Processing details for %s", device.DevPath)
-		pe.Controller.FillBlockDeviceDetails(device)
+		devPaths[device.DevPath] = true
+		deviceStart := time.Now()
+		// observeDevice records the time taken to process the device, including
+		// the devices that are filtered or fail to be written
+		observeDevice := func() {
+			openmetrics.ObserveWithTraceID(controller.DeviceProcessingDuration.WithLabelValues(msg.Action),
+				time.Since(deviceStart).Seconds(), tracing.TraceIDFromContext(pe.context()))
+		}
+		deviceLogger := logger.WithValues(logs.PathKey, device.DevPath,
+			logs.NodeKey, pe.Controller.NodeAttributes[controller.NodeNameKey])
+		deviceLogger.Info("Processing details")
+		pe.Controller.FillBlockDeviceDetailsWithContext(pe.context(), device)
 		// if ApplyFilter returns true then we process the event further
-		if !pe.Controller.ApplyFilter(device) {
+		if !pe.Controller.ApplyFilterWithContext(pe.context(), device) {
+			pe.Controller.RecordDevice(device, true)
+			observeDevice()
 			continue
 		}
-		klog.Infof("Processed details for %s", device.DevPath)
+		pe.Controller.RecordDevice(device, false)
+		deviceLogger.Info("Processed details")
 
 		if isGPTBasedUUIDEnabled {
-			err := pe.addBlockDevice(*device, bdAPIList)
+			err := pe.traceWrite("add", device, func() error {
+				return pe.addBlockDevice(*device, bdAPIList)
+			})
 			if err != nil {
 				isErrorDuringUpdate = true
-				klog.Error(err)
+				deviceLogger.Error(err, "unable to add blockdevice")
+				observeDevice()
 				// if error occurs we should start the scan again
 				break
 			}
+			if device.DeviceAttributes.DeviceType == libudevwrapper.UDEV_PARTITION && !msg.AllBlockDevices {
+				_ = pe.updateParentPartitions(pe.getParentPath(*device, bdAPIList), bdAPIList)
+			}
 		} else {
 			// if GPTBasedUUID is disabled and the device type is partition,
-			// the event can be skipped.
+			// only the partitions of the parent are updated.
 			if device.DeviceAttributes.DeviceType == libudevwrapper.UDEV_PARTITION {
-				klog.Info("GPTBasedUUID disabled. skip creating block device resource for partition.")
+				deviceLogger.Info("GPTBasedUUID disabled. skip creating block device resource for partition.")
+				if !msg.AllBlockDevices {
+					_ = pe.updateParentPartitions(pe.getParentPath(*device, bdAPIList), bdAPIList)
+				}
+				observeDevice()
 				continue
 			}
+			existingBlockDeviceResource := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, device.UUID)
+			// do not overwrite the resource of another device having the same UUID
+			if pe.Controller.IsUUIDCollision(device, existingBlockDeviceResource) {
+				pe.Controller.ResolveUUIDCollision(device, existingBlockDeviceResource)
+				existingBlockDeviceResource = pe.Controller.GetExistingBlockDeviceResource(bdAPIList, device.UUID)
+			}
 			deviceInfo := pe.Controller.NewDeviceInfoFromBlockDevice(device)
 
-			existingBlockDeviceResource := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, deviceInfo.UUID)
-			err := pe.Controller.PushBlockDeviceResource(existingBlockDeviceResource, deviceInfo)
+			// the device may have been renamed by the kernel, in which case the
+			// existing resource is updated instead of creating a duplicate
+			if existingBlockDeviceResource == nil {
+				if renamed := pe.Controller.FindRenamedBlockDevice(bdAPIList, deviceInfo); renamed != nil {
+					deviceLogger.Info("device was renamed, updating existing blockdevice",
+						"oldPath", renamed.Spec.Path, logs.UUIDKey, renamed.Name)
+					deviceInfo.UUID = renamed.Name
+					existingBlockDeviceResource = renamed
+				}
+			}
+
+			err := pe.traceWrite("push", device, func() error {
+				return pe.Controller.PushBlockDeviceResource(existingBlockDeviceResource, deviceInfo)
+			})
 			if err != nil {
 				isErrorDuringUpdate = true
-				klog.Error(err)
+				deviceLogger.Error(err, "unable to push blockdevice", logs.UUIDKey, deviceInfo.UUID)
 			}
 		}
+		observeDevice()
+	}
+
+	if isErrorDuringUpdate {
+		go Rescan(pe.Controller)
+		return
+	}
+	// the devices of the first scan are processed, reconcile the blockdevices
+	// that drifted from the devices while the daemon was not running
+	if msg.AllBlockDevices {
+		pe.Controller.RetainDevices(devPaths)
+		pe.Controller.ReconcileStartupDrift()
+	}
+}
+
+// changeBlockDeviceEvent refreshes the filesystem details of the blockdevice resources.
+// Change events are generated when a filesystem is created or removed on the device, e.g
+// using mkfs or wipefs. Only the filesystem related probes are run and only the filesystem
+// details of the resource are patched. If the device does not have a resource, the event
+// is processed as an add event.
+func (pe *ProbeEvent) changeBlockDeviceEvent(msg controller.EventMessage) {
+	bdAPIList, err := pe.Controller.ListBlockDeviceResourceOffline(false)
+	if err != nil {
+		logger.Error(err, "unable to list the blockdevices")
+		go Rescan(pe.Controller)
+		return
+	}
+
+	isErrorDuringUpdate := false
+	for _, device := range msg.Devices {
+		if isDisconnectedNBD(pe.Controller, device.DevPath) {
+			pe.disconnectNBDEvent(device)
+			continue
+		}
+		existingBlockDeviceResource := pe.Controller.GetActiveBlockDeviceResourceByPath(bdAPIList, device.DevPath)
+		if existingBlockDeviceResource == nil {
+			logger.V(4).Infof("no blockdevice for %s, processing change event as add event", device.DevPath)
+			pe.addBlockDeviceEvent(controller.EventMessage{
+				Action:  string(AttachEA),
+				Devices: []*blockdevice.BlockDevice{device},
+			})
+			continue
+		}
+		pe.Controller.FillBlockDeviceDetailsFromProbes(pe.context(), device, udevProbeName, mountProbeName)
+		pe.Controller.UpdateDeviceFileSystem(device)
+		err := pe.traceWrite("update-filesystem", device, func() error {
+			return pe.Controller.UpdateBlockDeviceFileSystem(existingBlockDeviceResource, device)
+		})
+		if err != nil {
+			isErrorDuringUpdate = true
+		}
 	}
 
 	if isErrorDuringUpdate {
@@ -94,25 +250,47 @@ func (pe *ProbeEvent) addBlockDeviceEvent(msg controller.EventMessage) {
 
 // deleteBlockDeviceEvent deactivate blockdevice resource using uuid from etcd
 func (pe *ProbeEvent) deleteBlockDeviceEvent(msg controller.EventMessage) {
-	bdAPIList, err := pe.Controller.ListBlockDeviceResource(false)
+	bdAPIList, err := pe.Controller.ListBlockDeviceResourceOffline(false)
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to list the blockdevices")
 	}
 
 	isDeactivated := true
-	isGPTBasedUUIDEnabled := features.FeatureGates.IsEnabled(features.GPTBasedUUID)
+	isGPTBasedUUIDEnabled := pe.Controller.IsFeatureEnabled(features.GPTBasedUUID)
 
 	for _, device := range msg.Devices {
+		pe.Controller.ForgetDevice(device.DevPath)
 		if isGPTBasedUUIDEnabled {
-			_ = pe.deleteBlockDevice(*device, bdAPIList)
+			if device.DeviceAttributes.DeviceType == libudevwrapper.UDEV_PARTITION {
+				_ = pe.traceWrite("delete-partition", device, func() error {
+					return pe.deletePartition(*device, bdAPIList)
+				})
+				continue
+			}
+			_ = pe.traceWrite("delete", device, func() error {
+				return pe.deleteBlockDevice(*device, bdAPIList)
+			})
 		} else {
+			// the resource is not created for partitions, only the
+			// partitions of the parent are updated
+			if device.DeviceAttributes.DeviceType == libudevwrapper.UDEV_PARTITION {
+				_ = pe.updateParentPartitions(pe.getParentPath(*device, bdAPIList), bdAPIList)
+				continue
+			}
 			existingBlockDeviceResource := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, device.UUID)
+			if existingBlockDeviceResource == nil {
+				// the resource of a renamed device is named after its earlier path
+				existingBlockDeviceResource = pe.Controller.GetActiveBlockDeviceResourceByPath(bdAPIList, device.DevPath)
+			}
 			if existingBlockDeviceResource == nil {
 				// do nothing, may be the disk was filtered, or it was not created
 				isDeactivated = false
 				continue
 			}
-			pe.Controller.DeactivateBlockDevice(*existingBlockDeviceResource)
+			_ = pe.traceWrite("deactivate", device, func() error {
+				pe.Controller.RemoveBlockDevice(*existingBlockDeviceResource)
+				return nil
+			})
 		}
 	}
 
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
@@ -160,6 +161,7 @@ func TestAddBlockDeviceEvent(t *testing.T) {
 	fakeDr.ObjectMeta.Labels[controller.KubernetesHostNameLabel] = fakeController.NodeAttributes[controller.HostNameKey]
 	fakeDr.ObjectMeta.Labels[controller.NDMDeviceTypeKey] = fakeBDType
 	fakeDr.ObjectMeta.Labels[controller.NDMManagedKey] = controller.TrueString
+	fakeDr.ObjectMeta.Labels[controller.ManagedByLabel] = controller.ManagedByValue
 	fakeDr.Spec.Details.Model = fakeModel
 	fakeDr.Spec.Details.Serial = fakeSerial
 	fakeDr.Spec.Details.Vendor = fakeVendor
@@ -182,6 +184,9 @@ func TestAddBlockDeviceEvent(t *testing.T) {
 }
 
 func TestDeleteDiskEvent(t *testing.T) {
+	// the blockdevice is made inactive without the removal grace period
+	defer func(grace time.Duration) { controller.RemovalGracePeriod = grace }(controller.RemovalGracePeriod)
+	controller.RemovalGracePeriod = 0
 	fakeNdmClient := CreateFakeClient(t)
 	probes := make([]*controller.Probe, 0)
 	nodeAttributes := make(map[string]string)
@@ -199,6 +204,7 @@ func TestDeleteDiskEvent(t *testing.T) {
 	fakeBDr.ObjectMeta.Labels[controller.KubernetesHostNameLabel] = fakeController.NodeAttributes[controller.HostNameKey]
 	fakeBDr.ObjectMeta.Labels[controller.NDMDeviceTypeKey] = fakeBDType
 	fakeBDr.ObjectMeta.Labels[controller.NDMManagedKey] = controller.TrueString
+	fakeBDr.ObjectMeta.Labels[controller.ManagedByLabel] = controller.ManagedByValue
 	fakeController.CreateBlockDevice(fakeBDr)
 
 	probeEvent := &ProbeEvent{
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/helper"
+	"github.com/openebs/node-disk-manager/pkg/partition"
+	"github.com/openebs/node-disk-manager/pkg/udevevent"
+)
+
+// HelperAddress is the path of the socket of the privileged helper. If set,
+// the probes which need raw access to the devices, the udev monitor and the
+// partitioning of the devices are run by the helper.
+var HelperAddress = ""
+
+// helperClient is the client of the privileged helper, nil if the probes
+// are run by the daemon
+var helperClient *helper.Client
+
+// ConnectHelper connects to the privileged helper, if the address is set
+func ConnectHelper() error {
+	if HelperAddress == "" {
+		return nil
+	}
+	client, err := helper.NewClient(HelperAddress)
+	if err != nil {
+		return err
+	}
+	helperClient = client
+	logger.Infof("privileged probes will be run by the helper at %s", HelperAddress)
+	return nil
+}
+
+// PrivilegedProbes returns the probes which need raw access to the devices,
+// keyed by the probe config key
+func PrivilegedProbes() map[string]helper.Filler {
+	return map[string]helper.Filler{
+		smartConfigKey:    (&smartProbe{}).FillBlockDeviceDetails,
+		seachestConfigKey: (&seachestProbe{}).FillBlockDeviceDetails,
+	}
+}
+
+// NewHelperServer returns the server of the privileged helper. It serves the
+// privileged probes, the probes which read the sysfs and the mounts of the host,
+// the partitioning of the devices and the udev events.
+func NewHelperServer() *helper.Server {
+	probes := PrivilegedProbes()
+	probes[sysfsConfigKey] = newSysFSProbe().FillBlockDeviceDetails
+	probes[mountConfigKey] = (&mountProbe{}).FillBlockDeviceDetails
+	partitioner := func(devPath string, diskSize, logicalBlockSize uint64) error {
+		d := partition.Disk{
+			DevPath:          devPath,
+			DiskSize:         diskSize,
+			LogicalBlockSize: logicalBlockSize,
+		}
+		return d.CreateSinglePartition()
+	}
+	watcher := func(ctx context.Context, send func(*helper.Event) error) error {
+		return udevevent.ServeEvents(ctx, send)
+	}
+	return helper.NewServer(probes, partitioner, watcher)
+}
+
+// fillUsingHelper fills the blockdevice using the probe in the privileged helper.
+// It returns false if the helper is not used, and the probe should be run locally.
+func fillUsingHelper(probe string, blockDevice *blockdevice.BlockDevice) bool {
+	if helperClient == nil {
+		return false
+	}
+	if err := helperClient.FillBlockDeviceDetails(probe, blockDevice); err != nil {
+		logger.Errorf("unable to fill details of %s using the helper probe %s: %v",
+			blockDevice.DevPath, probe, err)
+	}
+	return true
+}
+
+// deviceWritesAllowed checks if a partition can be created on the device. The
+// devices are not written in the dry run mode. If the helper is used, the devices
+// are written by the helper and the capabilities of the daemon do not matter.
+func deviceWritesAllowed(devPath string) bool {
+	if controller.DryRun || !controller.IsDevicePathAllowed(devPath) {
+		return false
+	}
+	if helperClient != nil {
+		return !controller.ReadOnlyDeviceAccess
+	}
+	return controller.GetDeviceAccess().Writes
+}
+
+// createPartition creates a single partition spanning the disk, using the
+// privileged helper if configured
+func createPartition(d partition.Disk) error {
+	if helperClient == nil {
+		return d.CreateSinglePartition()
+	}
+	return helperClient.CreatePartition(d.DevPath, d.DiskSize, d.LogicalBlockSize)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"errors"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/features"
+	libudevwrapper "github.com/openebs/node-disk-manager/pkg/udev"
+)
+
+const (
+	inventoryProbePriority = 1
+	inventoryConfigKey     = "inventory-probe"
+	inventoryProbeName     = "inventory probe"
+)
+
+// FakeProbes are the probes registered in the fake probe mode, in which the
+// devices are discovered from the inventory loaded in the controller rather
+// than from udev, and the details of the devices are filled from the inventory
+var FakeProbes = []func(){
+	inventoryProbeRegister,
+}
+
+// inventoryProbeRegister contains registration process of the inventory probe
+var inventoryProbeRegister = func() {
+	ctrl := <-controller.ControllerBroadcastChannel
+	if ctrl == nil {
+		logger.Errorf("unable to configure%v", inventoryProbeName)
+		return
+	}
+	newRegisterProbe := &registerProbe{
+		key:        inventoryConfigKey,
+		priority:   inventoryProbePriority,
+		name:       inventoryProbeName,
+		state:      defaultEnabled,
+		pi:         &inventoryProbe{controller: ctrl},
+		controller: ctrl,
+	}
+	newRegisterProbe.register()
+}
+
+// inventoryProbe discovers the devices from the inventory of the controller, and
+// fills the details of the devices from the inventory
+type inventoryProbe struct {
+	controller *controller.Controller
+}
+
+// Start makes a single scan of the devices in the inventory, and sets the
+// scan as the rescan trigger of the controller
+func (ip *inventoryProbe) Start() {
+	ip.controller.SetRescanTrigger(func() {
+		go Rescan(ip.controller)
+	})
+	go func() {
+		if err := ip.scan(); err != nil {
+			logger.Error(err, "unable to scan the inventory")
+		}
+	}()
+}
+
+// FillBlockDeviceDetails fills the details of the device from the device
+// having the same path in the inventory
+func (ip *inventoryProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
+	for _, device := range ip.controller.FakeInventory() {
+		if device.DevPath == blockDevice.DevPath {
+			*blockDevice = device
+			logger.V(4).Infof("device: %s filled by inventory probe", blockDevice.DevPath)
+			return
+		}
+	}
+	logger.V(4).Infof("device: %s not found in the inventory", blockDevice.DevPath)
+}
+
+// scan processes all the devices in the inventory like the devices found by a
+// scan of the udev probe. The devices not in the inventory are removed.
+func (ip *inventoryProbe) scan() error {
+	// the scans of the inventory probe and the udev probe are not run together
+	if !sem.TryAcquire(1) {
+		return errors.New("Scan is in progress")
+	}
+	defer sem.Release(1)
+	start := time.Now()
+
+	devices := ip.controller.FakeInventory()
+	diskInfo := make([]*blockdevice.BlockDevice, 0, len(devices))
+	disksUid := make([]string, 0, len(devices))
+	devPaths := make([]string, 0, len(devices))
+	ip.controller.BDHierarchy = make(blockdevice.Hierarchy)
+	for i := range devices {
+		device := &devices[i]
+		diskInfo = append(diskInfo, device)
+		devPaths = append(devPaths, device.DevPath)
+		if !ip.controller.IsFeatureEnabled(features.GPTBasedUUID) {
+			disksUid = append(disksUid, device.UUID)
+		}
+	}
+
+	ip.controller.DeactivateStaleBlockDeviceResource(disksUid, devPaths)
+	probeEvent := &ProbeEvent{Controller: ip.controller}
+	probeEvent.handle(controller.EventMessage{
+		Action:          libudevwrapper.UDEV_ACTION_ADD,
+		Devices:         diskInfo,
+		AllBlockDevices: true,
+		ScanStartedAt:   start,
+	})
+	ip.controller.RecordRescan()
+	return nil
+}
@@ -19,9 +19,9 @@ package probe
 import (
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/logs"
 	"github.com/openebs/node-disk-manager/pkg/mount"
 	"github.com/openebs/node-disk-manager/pkg/util"
-	"k8s.io/klog"
 )
 
 // mountProbe contains required variables for populating diskInfo
@@ -48,7 +48,7 @@ var mountProbeRegister = func() {
 	// Get a controller object
 	ctrl := <-controller.ControllerBroadcastChannel
 	if ctrl == nil {
-		klog.Error("unable to configure", mountProbeName)
+		logger.Errorf("unable to configure%v", mountProbeName)
 		return
 	}
 	if ctrl.NDMConfig != nil {
@@ -61,6 +61,7 @@ var mountProbeRegister = func() {
 		}
 	}
 	newRegisterProbe := &registerProbe{
+		key:        mountConfigKey,
 		priority:   mountProbePriority,
 		name:       mountProbeName,
 		state:      mountProbeState,
@@ -91,13 +92,21 @@ func (mp *mountProbe) Start() {}
 // FillBlockDeviceDetails fills details in diskInfo struct using information it gets from probe
 func (mp *mountProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
 	if blockDevice.DevPath == "" {
-		klog.Error("mountIdentifier is found empty, mount probe will not fetch mount information.")
+		logger.Errorf("mountIdentifier is found empty, mount probe will not fetch mount information.")
+		return
+	}
+	if !controller.IsHostPathAllowed(mount.HostMountFilePath) {
+		logger.V(4).Infof("%s is not allowed to be read, mount probe will not fill details of %s",
+			mount.HostMountFilePath, blockDevice.DevPath)
+		return
+	}
+	if fillUsingHelper(mountConfigKey, blockDevice) {
 		return
 	}
 	mountProbe := newMountProbe(blockDevice.DevPath)
 	basicMountInfo, err := mountProbe.MountIdentifier.DeviceBasicMountInfo()
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to get the mount details", logs.PathKey, blockDevice.DevPath)
 		return
 	}
 
@@ -0,0 +1,48 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/features"
+	"github.com/openebs/node-disk-manager/pkg/sysfs"
+)
+
+// isDisconnectedNBD checks if the device is a network block device which is not
+// connected to a server. A disconnected nbd is treated as absent from the node.
+// Always returns false if the discovery of network block devices is disabled.
+func isDisconnectedNBD(c *controller.Controller, devPath string) bool {
+	if !c.IsFeatureEnabled(features.NBDDiscovery) {
+		return false
+	}
+	sysfsDevice, err := sysfs.NewSysFsDeviceFromDevPath(devPath)
+	if err != nil {
+		return false
+	}
+	return sysfsDevice.IsNBD() && !sysfsDevice.IsNBDConnected()
+}
+
+// disconnectNBDEvent processes the change event of a network block device
+// which got disconnected, as a remove event of the device.
+func (pe *ProbeEvent) disconnectNBDEvent(device *blockdevice.BlockDevice) {
+	logger.Infof("nbd %s is disconnected, processing change event as remove event", device.DevPath)
+	pe.deleteBlockDeviceEvent(controller.EventMessage{
+		Action:  string(DetachEA),
+		Devices: []*blockdevice.BlockDevice{device},
+	})
+}
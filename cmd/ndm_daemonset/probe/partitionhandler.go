@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/sysfs"
+)
+
+// newSysFsDevice is used to get the sysfs device of a devpath, can be replaced in tests
+var newSysFsDevice = func(devPath string) (dependentsGetter, error) {
+	return sysfs.NewSysFsDeviceFromDevPath(devPath)
+}
+
+// dependentsGetter gets the dependent devices of a device
+type dependentsGetter interface {
+	GetDependents() (blockdevice.DependentBlockDevices, error)
+}
+
+// getParentPath returns the path of the parent of the partition. Since the
+// dependents of a device are not available when it is removed, the hierarchy
+// cache and the partitions of the blockdevice resources are also checked.
+func (pe *ProbeEvent) getParentPath(bd blockdevice.BlockDevice, bdAPIList *apis.BlockDeviceList) string {
+	if len(bd.DependentDevices.Parent) != 0 {
+		return bd.DependentDevices.Parent
+	}
+	if cachedBD, ok := pe.Controller.BDHierarchy[bd.DevPath]; ok && len(cachedBD.DependentDevices.Parent) != 0 {
+		return cachedBD.DependentDevices.Parent
+	}
+	for _, item := range bdAPIList.Items {
+		for _, partition := range item.Spec.Partitions {
+			if partition == bd.DevPath {
+				return item.Spec.Path
+			}
+		}
+	}
+	return ""
+}
+
+// updateParentPartitions updates the partitions of the parent device in the
+// blockdevice resource and the hierarchy cache, from the current partitions of
+// the parent in sysfs. It is used to handle partition add/remove events without
+// processing the parent device again.
+func (pe *ProbeEvent) updateParentPartitions(parentPath string, bdAPIList *apis.BlockDeviceList) error {
+	if len(parentPath) == 0 {
+		return nil
+	}
+	sysfsDevice, err := newSysFsDevice(parentPath)
+	if err != nil {
+		// the parent device is also removed, it will be handled by its own event
+		logger.V(4).Infof("could not get sysfs device for parent %s: %v", parentPath, err)
+		return nil
+	}
+	dependents, err := sysfsDevice.GetDependents()
+	if err != nil {
+		logger.Errorf("could not get partitions of %s: %v", parentPath, err)
+		return err
+	}
+
+	if cachedBD, ok := pe.Controller.BDHierarchy[parentPath]; ok {
+		cachedBD.DependentDevices.Partitions = dependents.Partitions
+		pe.Controller.BDHierarchy[parentPath] = cachedBD
+	}
+
+	parentBD := pe.Controller.GetActiveBlockDeviceResourceByPath(bdAPIList, parentPath)
+	if parentBD == nil {
+		logger.V(4).Infof("no blockdevice for parent %s", parentPath)
+		return nil
+	}
+	return pe.Controller.UpdateBlockDevicePartitions(parentBD, dependents.Partitions)
+}
+
+// deletePartition handles the removal of a partition. If the parent device is still
+// present, the partition was deleted from the partition table, and the resource of the
+// partition is deleted if it is unclaimed. Otherwise it is deactivated, like any other
+// device that is detached from the node.
+func (pe *ProbeEvent) deletePartition(bd blockdevice.BlockDevice, bdAPIList *apis.BlockDeviceList) error {
+	parentPath := pe.getParentPath(bd, bdAPIList)
+	existingBD := pe.Controller.GetActiveBlockDeviceResourceByPath(bdAPIList, bd.DevPath)
+
+	parentPresent := false
+	if len(parentPath) != 0 {
+		_, err := newSysFsDevice(parentPath)
+		parentPresent = err == nil
+	}
+
+	if parentPresent && existingBD != nil && existingBD.Status.ClaimState == apis.BlockDeviceUnclaimed {
+		pe.removeBlockDeviceFromHierarchyCache(bd)
+		pe.Controller.DeleteBlockDevice(existingBD.Name)
+		logger.Infof("deleted blockdevice %s of removed partition %s", existingBD.Name, bd.DevPath)
+	} else if err := pe.deleteBlockDevice(bd, bdAPIList); err != nil {
+		return err
+	}
+
+	return pe.updateParentPartitions(parentPath, bdAPIList)
+}
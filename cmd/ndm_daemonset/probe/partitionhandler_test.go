@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeSysFsDevice struct {
+	partitions []string
+}
+
+func (f fakeSysFsDevice) GetDependents() (blockdevice.DependentBlockDevices, error) {
+	return blockdevice.DependentBlockDevices{Partitions: f.partitions}, nil
+}
+
+func TestPartitionEvents(t *testing.T) {
+	origNewSysFsDevice := newSysFsDevice
+	defer func() { newSysFsDevice = origNewSysFsDevice }()
+
+	// sysfs contains the devices that are present on the node
+	sysfsDevices := map[string][]string{}
+	newSysFsDevice = func(devPath string) (dependentsGetter, error) {
+		partitions, ok := sysfsDevices[devPath]
+		if !ok {
+			return nil, errors.New("device not found")
+		}
+		return fakeSysFsDevice{partitions: partitions}, nil
+	}
+
+	newBD := func(name, path string, claimState apis.DeviceClaimState, partitions ...string) apis.BlockDevice {
+		return apis.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					controller.KubernetesHostNameLabel: "node1",
+					controller.NDMManagedKey:           controller.TrueString,
+				},
+			},
+			Spec: apis.DeviceSpec{
+				Path:        path,
+				Partitioned: controller.NDMNotPartitioned,
+				Partitions:  partitions,
+			},
+			Status: apis.DeviceStatus{
+				ClaimState: claimState,
+				State:      controller.NDMActive,
+			},
+		}
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{})
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDeviceList{})
+	cl := fake.NewFakeClientWithScheme(s)
+	parent := newBD("blockdevice-parent", "/dev/sdb", apis.BlockDeviceUnclaimed)
+	cl.Create(context.TODO(), &parent)
+
+	pe := &ProbeEvent{
+		Controller: &controller.Controller{
+			Clientset:      cl,
+			Mutex:          &sync.Mutex{},
+			NodeAttributes: map[string]string{controller.HostNameKey: "node1"},
+			BDHierarchy:    make(blockdevice.Hierarchy),
+		},
+	}
+	getBD := func(name string) (*apis.BlockDevice, error) {
+		bd := &apis.BlockDevice{}
+		err := cl.Get(context.TODO(), client.ObjectKey{Name: name}, bd)
+		return bd, err
+	}
+
+	// partition added to the parent
+	sysfsDevices["/dev/sdb"] = []string{"/dev/sdb1"}
+	sysfsDevices["/dev/sdb1"] = nil
+	bdAPIList := &apis.BlockDeviceList{Items: []apis.BlockDevice{parent}}
+	partition := blockdevice.BlockDevice{}
+	partition.DevPath = "/dev/sdb1"
+	partition.DependentDevices.Parent = "/dev/sdb"
+	assert.NoError(t, pe.updateParentPartitions(pe.getParentPath(partition, bdAPIList), bdAPIList))
+
+	gotParent, err := getBD(parent.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, controller.NDMPartitioned, gotParent.Spec.Partitioned)
+	assert.Equal(t, []string{"/dev/sdb1"}, gotParent.Spec.Partitions)
+
+	// partition deleted from the partition table, the parent is found using the
+	// partitions of the resource since dependents are not available on removal
+	partitionBD := newBD("blockdevice-part", "/dev/sdb1", apis.BlockDeviceUnclaimed)
+	cl.Create(context.TODO(), &partitionBD)
+	delete(sysfsDevices, "/dev/sdb1")
+	sysfsDevices["/dev/sdb"] = nil
+	bdAPIList = &apis.BlockDeviceList{Items: []apis.BlockDevice{*gotParent, partitionBD}}
+	removed := blockdevice.BlockDevice{}
+	removed.DevPath = "/dev/sdb1"
+	assert.NoError(t, pe.deletePartition(removed, bdAPIList))
+
+	_, err = getBD(partitionBD.Name)
+	assert.Error(t, err)
+	gotParent, err = getBD(parent.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, controller.NDMNotPartitioned, gotParent.Spec.Partitioned)
+	assert.Empty(t, gotParent.Spec.Partitions)
+}
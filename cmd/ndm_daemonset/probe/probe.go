@@ -18,7 +18,8 @@ package probe
 
 import (
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
-	"k8s.io/klog"
+	"github.com/openebs/node-disk-manager/pkg/logs"
+	"github.com/openebs/node-disk-manager/pkg/util"
 )
 
 const (
@@ -26,6 +27,9 @@ const (
 	defaultDisabled = false // use in each probe to make it disable.
 )
 
+// logger is the structured logger of the probes
+var logger = logs.Module("probe")
+
 // RegisteredProbes contains register function of probes which we want to register
 var RegisteredProbes = []func(){
 	seachestProbeRegister,
@@ -37,7 +41,29 @@ var RegisteredProbes = []func(){
 	customTagProbeRegister,
 }
 
+// defaultProbeStates are the states of the probes when they are not present in
+// the config. The states are taken before the probes are registered, since the
+// registration sets the state variables from the config.
+var defaultProbeStates = map[string]bool{
+	seachestConfigKey:    seachestProbeState,
+	smartConfigKey:       smartProbeState,
+	mountConfigKey:       mountProbeState,
+	udevConfigKey:        udevProbeState,
+	sysfsConfigKey:       sysfsProbeState,
+	usedbyProbeConfigKey: usedbyProbeState,
+	customTagProbeKey:    customTagProbeState,
+}
+
+func init() {
+	// add the keys and tag types that can be used in the ndm config, so that
+	// the config can be validated
+	controller.AddSupportedProbeKeys(seachestConfigKey, smartConfigKey, mountConfigKey,
+		udevConfigKey, sysfsConfigKey, usedbyProbeConfigKey, customTagProbeKey)
+	controller.AddSupportedTagTypes(supportedTagTypes...)
+}
+
 type registerProbe struct {
+	key        string
 	priority   int
 	name       string
 	state      bool
@@ -49,6 +75,7 @@ type registerProbe struct {
 // status if it is enabled then it will call Start() of that probe.
 func (rp *registerProbe) register() {
 	newProbe := &controller.Probe{
+		Key:       rp.key,
 		Priority:  rp.priority,
 		Name:      rp.name,
 		State:     rp.state,
@@ -62,8 +89,62 @@ func (rp *registerProbe) register() {
 
 // Start starts registration of probes present in RegisteredProbes
 func Start(registeredProbes []func()) {
-	klog.Info("registering probes")
+	logger.Infof("registering probes")
 	for _, probe := range registeredProbes {
 		probe()
 	}
 }
+
+// restartRequiredProbeKeys are the keys of the probes whose state cannot be
+// changed without restarting the daemon. The udev probe listens for the udev
+// events, and is started only once.
+var restartRequiredProbeKeys = []string{udevConfigKey}
+
+// Reload applies the reloaded config of the controller to the registered probes.
+// The state of the probes and the tags of the custom tag probe are updated. The
+// probes which are not present in the config are set to their default state. If
+// the config is invalid, an error is returned and the probes are not changed.
+func Reload(ctrl *controller.Controller) error {
+	logger.Infof("reloading probes")
+	ndmConfig := ctrl.GetNDMConfig()
+	var tags []tag
+	if ndmConfig != nil {
+		var err error
+		if tags, err = getTagsFromConfig(ndmConfig.TagConfigs); err != nil {
+			return err
+		}
+	}
+
+	states := make(map[string]bool, len(defaultProbeStates))
+	for key, state := range defaultProbeStates {
+		states[key] = state
+	}
+	if ndmConfig != nil {
+		for _, probeConfig := range ndmConfig.ProbeConfigs {
+			if ctrl.GetProbe(probeConfig.Key) == nil {
+				logger.Warningf("unknown probe %s in config", probeConfig.Key)
+				continue
+			}
+			states[probeConfig.Key] = util.CheckTruthy(probeConfig.State)
+		}
+	}
+
+	for _, probe := range ctrl.ListAllProbes() {
+		state, ok := states[probe.Key]
+		if !ok || probe.State == state {
+			continue
+		}
+		if util.Contains(restartRequiredProbeKeys, probe.Key) {
+			logger.Warningf("state of %s can be changed only on restart", probe.Name)
+			continue
+		}
+		ctrl.SetProbeState(probe.Key, state)
+	}
+
+	if probe := ctrl.GetProbe(customTagProbeKey); probe != nil {
+		if tagProbe, ok := probe.Interface.(*customTagProbe); ok {
+			tagProbe.setTags(tags)
+		}
+	}
+	return nil
+}
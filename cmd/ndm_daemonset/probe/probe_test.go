@@ -115,3 +115,49 @@ func TestStart(t *testing.T) {
 		})
 	}
 }
+
+func TestReload(t *testing.T) {
+	tagProbe := &customTagProbe{}
+	fakeController := &controller.Controller{
+		Probes: []*controller.Probe{
+			{Key: udevConfigKey, Name: "udev probe", State: true, Interface: &fakeProbe{}},
+			{Key: smartConfigKey, Name: "smart probe", State: true, Interface: &fakeProbe{}},
+			{Key: customTagProbeKey, Name: "Custom Tag Probe", State: true, Interface: tagProbe},
+		},
+		Mutex: &sync.Mutex{},
+	}
+
+	fakeController.NDMConfig = &controller.NodeDiskManagerConfig{
+		ProbeConfigs: []controller.ProbeConfig{
+			{Key: udevConfigKey, Name: "udev probe", State: "false"},
+			{Key: smartConfigKey, Name: "smart probe", State: "false"},
+		},
+		TagConfigs: []controller.TagConfig{
+			{Name: "sdb", Type: tagTypePath, Pattern: "/dev/sdb", TagName: "fast"},
+		},
+	}
+	assert.NoError(t, Reload(fakeController))
+	// udev probe cannot be disabled without a restart
+	assert.True(t, fakeController.GetProbe(udevConfigKey).State)
+	assert.False(t, fakeController.GetProbe(smartConfigKey).State)
+	assert.Equal(t, []tag{{tagType: tagTypePath, regex: "/dev/sdb", label: "fast"}}, tagProbe.tags)
+
+	// invalid tags are not applied
+	fakeController.NDMConfig = &controller.NodeDiskManagerConfig{
+		ProbeConfigs: []controller.ProbeConfig{
+			{Key: smartConfigKey, Name: "smart probe", State: "true"},
+		},
+		TagConfigs: []controller.TagConfig{
+			{Name: "sdc", Type: "model", Pattern: "ssd", TagName: "fast"},
+		},
+	}
+	assert.Error(t, Reload(fakeController))
+	assert.False(t, fakeController.GetProbe(smartConfigKey).State)
+	assert.Len(t, tagProbe.tags, 1)
+
+	// probes removed from the config are set to their default state
+	fakeController.NDMConfig = &controller.NodeDiskManagerConfig{}
+	assert.NoError(t, Reload(fakeController))
+	assert.True(t, fakeController.GetProbe(smartConfigKey).State)
+	assert.Empty(t, tagProbe.tags)
+}
@@ -19,9 +19,10 @@ package probe
 import (
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
 	"github.com/openebs/node-disk-manager/pkg/seachest"
+	"github.com/openebs/node-disk-manager/pkg/sed"
 	"github.com/openebs/node-disk-manager/pkg/util"
-	"k8s.io/klog"
 )
 
 // seachest contains required variables for populating diskInfo
@@ -48,7 +49,7 @@ var seachestProbeRegister = func() {
 	// Get a controller object
 	ctrl := <-controller.ControllerBroadcastChannel
 	if ctrl == nil {
-		klog.Error("unable to configure", seachestProbeName)
+		logger.Errorf("unable to configure%v", seachestProbeName)
 		return
 	}
 	if ctrl.NDMConfig != nil {
@@ -61,6 +62,7 @@ var seachestProbeRegister = func() {
 		}
 	}
 	newRegisterProbe := &registerProbe{
+		key:        seachestConfigKey,
 		priority:   seachestProbePriority,
 		name:       seachestProbeName,
 		state:      seachestProbeState,
@@ -91,75 +93,99 @@ func (scp *seachestProbe) Start() {}
 // fillDiskDetails fills details in diskInfo struct using information it gets from probe
 func (scp *seachestProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
 	if blockDevice.DevPath == "" {
-		klog.Error("seachestIdentifier is found empty, seachest probe will not fill disk details.")
+		logger.Errorf("seachestIdentifier is found empty, seachest probe will not fill disk details.")
+		return
+	}
+	if !controller.IsDevicePathAllowed(blockDevice.DevPath) {
+		logger.V(4).Infof("device %s is not allowed to be opened, seachest probe will not fill its details", blockDevice.DevPath)
+		return
+	}
+	if fillUsingHelper(seachestConfigKey, blockDevice) {
+		return
+	}
+	if !controller.GetDeviceAccess().SGIO {
+		logger.V(4).Infof("SG_IO is disabled, seachest probe will not fill details of %s", blockDevice.DevPath)
 		return
 	}
 
+	// the self-encrypting drives are detected using the TCG commands, which are not
+	// sent by seachest
+	if blockDevice.DeviceAttributes.DeviceType == blockdevice.BlockDeviceTypeDisk &&
+		blockDevice.DeviceAttributes.SED == "" {
+		discovery, err := sed.Discover(blockDevice.DevPath)
+		if err != nil {
+			logger.V(4).Infof("Disk: %s unable to detect self-encrypting drive: %v", blockDevice.DevPath, err)
+		} else {
+			blockDevice.DeviceAttributes.SED = discovery.SelfEncrypting()
+			logger.V(4).Infof("Disk: %s SED:%s filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.SED)
+		}
+	}
+
 	seachestProbe := newSeachestProbe(blockDevice.DevPath)
 	driveInfo, err := seachestProbe.SeachestIdentifier.SeachestBasicDiskInfo()
 	if err != 0 {
-		klog.Error(err)
+		logger.Errorf("unable to get the seachest details of %s: %v", blockDevice.DevPath, err)
 		return
 	}
 
 	if blockDevice.DeviceAttributes.FirmwareRevision == "" {
 		blockDevice.DeviceAttributes.FirmwareRevision = seachestProbe.SeachestIdentifier.GetFirmwareRevision(driveInfo)
-		klog.V(4).Infof("Disk: %s FirmwareRevision:%s filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.FirmwareRevision)
+		logger.V(4).Infof("Disk: %s FirmwareRevision:%s filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.FirmwareRevision)
 	}
 
 	if blockDevice.DeviceAttributes.LogicalBlockSize == 0 {
 		blockDevice.DeviceAttributes.LogicalBlockSize = seachestProbe.SeachestIdentifier.GetLogicalSectorSize(driveInfo)
-		klog.V(4).Infof("Disk: %s LogicalBlockSize:%d filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.LogicalBlockSize)
+		logger.V(4).Infof("Disk: %s LogicalBlockSize:%d filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.LogicalBlockSize)
 	}
 
 	if blockDevice.DeviceAttributes.PhysicalBlockSize == 0 {
 		blockDevice.DeviceAttributes.PhysicalBlockSize = seachestProbe.SeachestIdentifier.GetPhysicalSectorSize(driveInfo)
-		klog.V(4).Infof("Disk: %s PhysicalBlockSize:%d filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.PhysicalBlockSize)
+		logger.V(4).Infof("Disk: %s PhysicalBlockSize:%d filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.PhysicalBlockSize)
 	}
 
 	if blockDevice.DeviceAttributes.DriveType == "" {
 		blockDevice.DeviceAttributes.DriveType = seachestProbe.SeachestIdentifier.DriveType(driveInfo)
-		klog.V(4).Infof("Disk: %s DriveType:%s filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.DriveType)
+		logger.V(4).Infof("Disk: %s DriveType:%s filled by seachest.", blockDevice.DevPath, blockDevice.DeviceAttributes.DriveType)
 	}
 
 	// All the below mentioned fields will be filled in only after BlockDevice struct
 	// starts supporting them.
 	if blockDevice.SMARTInfo.RotationRate == 0 {
 		blockDevice.SMARTInfo.RotationRate = seachestProbe.SeachestIdentifier.GetRotationRate(driveInfo)
-		klog.V(4).Infof("Disk: %s RotationRate:%d filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.RotationRate)
+		logger.V(4).Infof("Disk: %s RotationRate:%d filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.RotationRate)
 	}
 
 	if blockDevice.SMARTInfo.TotalBytesRead == 0 {
 		blockDevice.SMARTInfo.TotalBytesRead = seachestProbe.SeachestIdentifier.GetTotalBytesRead(driveInfo)
-		klog.V(4).Infof("Disk: %s TotalBytesRead:%d filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.TotalBytesRead)
+		logger.V(4).Infof("Disk: %s TotalBytesRead:%d filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.TotalBytesRead)
 	}
 
 	if blockDevice.SMARTInfo.TotalBytesWritten == 0 {
 		blockDevice.SMARTInfo.TotalBytesWritten = seachestProbe.SeachestIdentifier.GetTotalBytesWritten(driveInfo)
-		klog.V(4).Infof("Disk: %s TotalBytesWritten:%d filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.TotalBytesWritten)
+		logger.V(4).Infof("Disk: %s TotalBytesWritten:%d filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.TotalBytesWritten)
 	}
 
 	if blockDevice.SMARTInfo.UtilizationRate == 0 {
 		blockDevice.SMARTInfo.UtilizationRate = seachestProbe.SeachestIdentifier.GetDeviceUtilizationRate(driveInfo)
-		klog.V(4).Infof("Disk: %s UtilizationRate:%f filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.UtilizationRate)
+		logger.V(4).Infof("Disk: %s UtilizationRate:%f filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.UtilizationRate)
 	}
 
 	if blockDevice.SMARTInfo.PercentEnduranceUsed == 0 {
 		blockDevice.SMARTInfo.PercentEnduranceUsed = seachestProbe.SeachestIdentifier.GetPercentEnduranceUsed(driveInfo)
-		klog.V(4).Infof("Disk: %s PercentEnduranceUsed:%f filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.PercentEnduranceUsed)
+		logger.V(4).Infof("Disk: %s PercentEnduranceUsed:%f filled by seachest.", blockDevice.DevPath, blockDevice.SMARTInfo.PercentEnduranceUsed)
 	}
 
 	blockDevice.SMARTInfo.TemperatureInfo.CurrentTemperatureDataValid = seachestProbe.
 		SeachestIdentifier.GetTemperatureDataValidStatus(driveInfo)
 
-	klog.V(4).Infof("Disk: %s TemperatureDataValid:%t filled by seachest.",
+	logger.V(4).Infof("Disk: %s TemperatureDataValid:%t filled by seachest.",
 		blockDevice.DevPath, blockDevice.SMARTInfo.TemperatureInfo.CurrentTemperatureDataValid)
 
 	if blockDevice.SMARTInfo.TemperatureInfo.CurrentTemperatureDataValid == true {
 		blockDevice.SMARTInfo.TemperatureInfo.CurrentTemperature = seachestProbe.
 			SeachestIdentifier.GetCurrentTemperature(driveInfo)
 
-		klog.V(4).Infof("Disk: %s CurrentTemperature:%d filled by seachest.",
+		logger.V(4).Infof("Disk: %s CurrentTemperature:%d filled by seachest.",
 			blockDevice.DevPath, blockDevice.SMARTInfo.TemperatureInfo.CurrentTemperature)
 
 	}
@@ -167,7 +193,7 @@ func (scp *seachestProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockD
 	blockDevice.SMARTInfo.TemperatureInfo.HighestTemperatureDataValid = seachestProbe.
 		SeachestIdentifier.GetHighestValid(driveInfo)
 
-	klog.V(4).Infof("Disk: %s HighestTemperatureDataValid:%t filled by seachest.",
+	logger.V(4).Infof("Disk: %s HighestTemperatureDataValid:%t filled by seachest.",
 		blockDevice.DevPath, blockDevice.SMARTInfo.TemperatureInfo.HighestTemperatureDataValid)
 
 	if blockDevice.SMARTInfo.TemperatureInfo.HighestTemperatureDataValid == true {
@@ -175,20 +201,34 @@ func (scp *seachestProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockD
 		blockDevice.SMARTInfo.TemperatureInfo.HighestTemperature = seachestProbe.
 			SeachestIdentifier.GetHighestTemperature(driveInfo)
 
-		klog.V(4).Infof("Disk: %s HighestTemperature:%d filled by seachest.",
+		logger.V(4).Infof("Disk: %s HighestTemperature:%d filled by seachest.",
 			blockDevice.DevPath, blockDevice.SMARTInfo.TemperatureInfo.HighestTemperature)
 	}
 	blockDevice.SMARTInfo.TemperatureInfo.LowestTemperatureDataValid = seachestProbe.
 		SeachestIdentifier.GetLowestValid(driveInfo)
 
-	klog.V(4).Infof("Disk: %s LowestValid:%t filled by seachest.",
+	logger.V(4).Infof("Disk: %s LowestValid:%t filled by seachest.",
 		blockDevice.DevPath, blockDevice.SMARTInfo.TemperatureInfo.LowestTemperatureDataValid)
 
 	if blockDevice.SMARTInfo.TemperatureInfo.LowestTemperatureDataValid == true {
 		blockDevice.SMARTInfo.TemperatureInfo.LowestTemperature = seachestProbe.
 			SeachestIdentifier.GetLowestTemperature(driveInfo)
 
-		klog.V(4).Infof("Disk: %s LowestTemperature:%d filled by seachest.",
+		logger.V(4).Infof("Disk: %s LowestTemperature:%d filled by seachest.",
 			blockDevice.DevPath, blockDevice.SMARTInfo.TemperatureInfo.LowestTemperature)
 	}
+
+	// the available spare is not reported by seachest, it is read from the
+	// health log of NVMe devices
+	if nvme.IsNVMe(blockDevice.DevPath) {
+		healthLog, err := nvme.GetHealthLog(blockDevice.DevPath)
+		if err != nil {
+			logger.V(4).Infof("Disk: %s unable to read NVMe health log: %v", blockDevice.DevPath, err)
+			return
+		}
+		blockDevice.SMARTInfo.AvailableSpareValid = true
+		blockDevice.SMARTInfo.AvailableSpare = healthLog.AvailableSpare
+		logger.V(4).Infof("Disk: %s AvailableSpare:%d filled by seachest.",
+			blockDevice.DevPath, blockDevice.SMARTInfo.AvailableSpare)
+	}
 }
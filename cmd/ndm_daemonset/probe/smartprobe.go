@@ -19,9 +19,9 @@ package probe
 import (
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
 	"github.com/openebs/node-disk-manager/pkg/smart"
 	"github.com/openebs/node-disk-manager/pkg/util"
-	"k8s.io/klog"
 )
 
 // smartProbe contains required variables for populating diskInfo
@@ -48,7 +48,7 @@ var smartProbeRegister = func() {
 	// Get a controller object
 	ctrl := <-controller.ControllerBroadcastChannel
 	if ctrl == nil {
-		klog.Error("unable to configure", smartProbeName)
+		logger.Errorf("unable to configure%v", smartProbeName)
 		return
 	}
 	if ctrl.NDMConfig != nil {
@@ -61,6 +61,7 @@ var smartProbeRegister = func() {
 		}
 	}
 	newRegisterProbe := &registerProbe{
+		key:        smartConfigKey,
 		priority:   smartProbePriority,
 		name:       smartProbeName,
 		state:      smartProbeState,
@@ -91,14 +92,25 @@ func (sp *smartProbe) Start() {}
 // fillDiskDetails fills details in diskInfo struct using information it gets from probe
 func (sp *smartProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
 	if blockDevice.DevPath == "" {
-		klog.Error("smartIdentifier is found empty, smart probe will not fill disk details.")
+		logger.Errorf("smartIdentifier is found empty, smart probe will not fill disk details.")
 
 		return
 	}
+	if !controller.IsDevicePathAllowed(blockDevice.DevPath) {
+		logger.V(4).Infof("device %s is not allowed to be opened, smart probe will not fill its details", blockDevice.DevPath)
+		return
+	}
+	if fillUsingHelper(smartConfigKey, blockDevice) {
+		return
+	}
+	if !controller.GetDeviceAccess().SGIO {
+		logger.V(4).Infof("SG_IO is disabled, smart probe will not fill details of %s", blockDevice.DevPath)
+		return
+	}
 	smartProbe := newSmartProbe(blockDevice.DevPath)
 	deviceBasicSCSIInfo, err := smartProbe.SmartIdentifier.SCSIBasicDiskInfo()
 	if len(err) != 0 {
-		klog.Error(err)
+		logger.Errorf("unable to get the SCSI details of %s: %v", blockDevice.DevPath, err)
 	}
 
 	blockDevice.DeviceAttributes.Compliance = deviceBasicSCSIInfo.Compliance
@@ -106,19 +118,43 @@ func (sp *smartProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevic
 
 	if blockDevice.Capacity.Storage == 0 && deviceBasicSCSIInfo.Capacity != 0 {
 		blockDevice.Capacity.Storage = deviceBasicSCSIInfo.Capacity
-		klog.V(4).Infof("device: %s, Capacity: %d filled by smart-probe",
+		logger.V(4).Infof("device: %s, Capacity: %d filled by smart-probe",
 			blockDevice.DevPath, blockDevice.Capacity.Storage)
 	}
 
 	if blockDevice.DeviceAttributes.LogicalBlockSize == 0 && deviceBasicSCSIInfo.LBSize != 0 {
 		blockDevice.DeviceAttributes.LogicalBlockSize = deviceBasicSCSIInfo.LBSize
-		klog.V(4).Infof("device: %s, LogicalBlockSize: %d filled by smart-probe",
+		logger.V(4).Infof("device: %s, LogicalBlockSize: %d filled by smart-probe",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.LogicalBlockSize)
 	}
 
 	if blockDevice.DeviceAttributes.PhysicalBlockSize == 0 && deviceBasicSCSIInfo.PBSize != 0 {
 		blockDevice.DeviceAttributes.PhysicalBlockSize = deviceBasicSCSIInfo.PBSize
-		klog.V(4).Infof("device: %s, PhysicalBlockSize: %d filled by smart-probe",
+		logger.V(4).Infof("device: %s, PhysicalBlockSize: %d filled by smart-probe",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.PhysicalBlockSize)
 	}
+
+	// the helper does not have the ndm config, so it always reads the indicators,
+	// which are ignored by the daemon if failure prediction is disabled
+	var ndmConfig *controller.NodeDiskManagerConfig
+	if sp.Controller != nil {
+		ndmConfig = sp.Controller.GetNDMConfig()
+	}
+	if sp.Controller == nil || (ndmConfig != nil && ndmConfig.FailurePrediction != nil) {
+		fillFailureIndicators(smartProbe.SmartIdentifier, blockDevice)
+	}
+}
+
+// fillFailureIndicators fills the SMART attributes used to predict the failure of
+// the device. Only ATA devices report the attributes.
+func fillFailureIndicators(identifier *smart.Identifier, blockDevice *blockdevice.BlockDevice) {
+	attributes, err := identifier.ATASMARTAttributes()
+	if err != nil {
+		logger.V(4).Infof("device: %s, failure indicators not filled by smart-probe: %v",
+			blockDevice.DevPath, err)
+		return
+	}
+	blockDevice.SMARTInfo.FailureIndicators = failurerisk.Indicators(attributes)
+	logger.V(4).Infof("device: %s, FailureIndicators: %v filled by smart-probe",
+		blockDevice.DevPath, blockDevice.SMARTInfo.FailureIndicators)
 }
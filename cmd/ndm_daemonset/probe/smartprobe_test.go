@@ -181,6 +181,7 @@ func TestSmartProbe(t *testing.T) {
 	fakeDr.ObjectMeta.Labels[controller.KubernetesHostNameLabel] = fakeController.NodeAttributes[controller.HostNameKey]
 	fakeDr.ObjectMeta.Labels[controller.NDMDeviceTypeKey] = "blockdevice"
 	fakeDr.ObjectMeta.Labels[controller.NDMManagedKey] = controller.TrueString
+	fakeDr.ObjectMeta.Labels[controller.ManagedByLabel] = controller.ManagedByValue
 
 	tests := map[string]struct {
 		actualDisk    apis.BlockDevice
@@ -26,14 +26,19 @@ package probe
 import (
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/db/kubernetes"
 	"github.com/openebs/node-disk-manager/pkg/sysfs"
 	"github.com/openebs/node-disk-manager/pkg/util"
-	"k8s.io/klog"
 )
 
 const (
 	sysfsProbePriority = 2
 	sysfsConfigKey     = "sysfs-probe"
+	// dasdVendor is the vendor of the DASDs
+	dasdVendor = "IBM"
+	// rbdVendor and rbdModel are the vendor and model of the mapped ceph rbd images
+	rbdVendor = "Ceph"
+	rbdModel  = "RBD"
 )
 
 var (
@@ -44,7 +49,7 @@ var (
 var sysfsProbeRegister = func() {
 	ctrl := <-controller.ControllerBroadcastChannel
 	if ctrl == nil {
-		klog.Error("unable to configure", sysfsProbeName)
+		logger.Errorf("unable to configure%v", sysfsProbeName)
 		return
 	}
 	if ctrl.NDMConfig != nil {
@@ -58,6 +63,7 @@ var sysfsProbeRegister = func() {
 	}
 
 	newRegistryProbe := &registerProbe{
+		key:        sysfsConfigKey,
 		priority:   sysfsProbePriority,
 		name:       sysfsProbeName,
 		state:      sysfsProbeState,
@@ -83,66 +89,148 @@ func (cp *sysfsProbe) Start() {}
 // physical sector size, drive type(ssd or hdd) of the disk
 // if those are not populated.
 func (cp *sysfsProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
+	if fillUsingHelper(sysfsConfigKey, blockDevice) {
+		return
+	}
 
 	sysFsDevice, err := sysfs.NewSysFsDeviceFromDevPath(blockDevice.DevPath)
 	if err != nil {
-		klog.Errorf("unable to get sysfs device for device: %s, err: %v", blockDevice.DevPath, err)
+		logger.Errorf("unable to get sysfs device for device: %s, err: %v", blockDevice.DevPath, err)
 		return
 	}
 
 	if blockDevice.DeviceAttributes.LogicalBlockSize == 0 {
 		logicalBlockSize, err := sysFsDevice.GetLogicalBlockSize()
 		if err != nil {
-			klog.Warningf("unable to get logical block size for device: %s, err: %v", blockDevice.DevPath, err)
+			logger.Warningf("unable to get logical block size for device: %s, err: %v", blockDevice.DevPath, err)
 		} else if logicalBlockSize == 0 {
-			klog.Warningf("logical block size for device: %s reported as 0", blockDevice.DevPath)
+			logger.Warningf("logical block size for device: %s reported as 0", blockDevice.DevPath)
 		}
 		blockDevice.DeviceAttributes.LogicalBlockSize = uint32(logicalBlockSize)
-		klog.V(4).Infof("blockdevice path: %s logical block size :%d filled by sysfs probe.",
+		logger.V(4).Infof("blockdevice path: %s logical block size :%d filled by sysfs probe.",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.LogicalBlockSize)
 	}
 
 	if blockDevice.DeviceAttributes.PhysicalBlockSize == 0 {
 		physicalBlockSize, err := sysFsDevice.GetPhysicalBlockSize()
 		if err != nil {
-			klog.Warningf("unable to get physical block size for device: %s, err: %v", blockDevice.DevPath, err)
+			logger.Warningf("unable to get physical block size for device: %s, err: %v", blockDevice.DevPath, err)
 		} else if physicalBlockSize == 0 {
-			klog.Warningf("physical block size for device: %s reported as 0", blockDevice.DevPath)
+			logger.Warningf("physical block size for device: %s reported as 0", blockDevice.DevPath)
 		}
 		blockDevice.DeviceAttributes.PhysicalBlockSize = uint32(physicalBlockSize)
-		klog.V(4).Infof("blockdevice path: %s physical block size :%d filled by sysfs probe.",
+		logger.V(4).Infof("blockdevice path: %s physical block size :%d filled by sysfs probe.",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.PhysicalBlockSize)
 	}
 
 	if blockDevice.DeviceAttributes.HardwareSectorSize == 0 {
 		hwSectorSize, err := sysFsDevice.GetPhysicalBlockSize()
 		if err != nil {
-			klog.Warningf("unable to get hardware sector size for device: %s, err: %v", blockDevice.DevPath, err)
+			logger.Warningf("unable to get hardware sector size for device: %s, err: %v", blockDevice.DevPath, err)
 		} else if hwSectorSize == 0 {
-			klog.Warningf("hardware sector size for device: %s reported as 0", blockDevice.DevPath)
+			logger.Warningf("hardware sector size for device: %s reported as 0", blockDevice.DevPath)
 		}
 		blockDevice.DeviceAttributes.HardwareSectorSize = uint32(hwSectorSize)
-		klog.V(4).Infof("blockdevice path: %s hardware sector size :%d filled by sysfs probe.",
+		logger.V(4).Infof("blockdevice path: %s hardware sector size :%d filled by sysfs probe.",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.HardwareSectorSize)
 	}
 
 	if blockDevice.DeviceAttributes.DriveType == "" {
 		driveType, err := sysFsDevice.GetDriveType()
 		if err != nil {
-			klog.Warningf("unable to get drive type for device: %s, err: %v", blockDevice.DevPath, err)
+			logger.Warningf("unable to get drive type for device: %s, err: %v", blockDevice.DevPath, err)
 		}
 		blockDevice.DeviceAttributes.DriveType = driveType
-		klog.V(4).Infof("blockdevice path: %s drive type :%s filled by sysfs probe.",
+		logger.V(4).Infof("blockdevice path: %s drive type :%s filled by sysfs probe.",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.DriveType)
 	}
 
+	if sysFsDevice.IsDASD() {
+		fillDASDDetails(sysFsDevice, blockDevice)
+	}
+
+	if sysFsDevice.IsRBD() {
+		fillRBDDetails(sysFsDevice, blockDevice)
+	}
+
 	if blockDevice.Capacity.Storage == 0 {
 		capacity, err := sysFsDevice.GetCapacityInBytes()
 		if err != nil {
-			klog.Warningf("unable to get capacity for device: %s, err: %v", blockDevice.DevPath, err)
+			logger.Warningf("unable to get capacity for device: %s, err: %v", blockDevice.DevPath, err)
+		}
+		blockDevice.Capacity.Storage = uint64(capacity)
+		logger.V(4).Infof("blockdevice path: %s capacity :%d filled by sysfs probe.",
+			blockDevice.DevPath, blockDevice.Capacity.Storage)
+	}
+}
+
+// fillDASDDetails fills the details of a DASD on s390x, which are not present in
+// udev. The capacity of unformatted ECKD DASDs is calculated from the geometry.
+func fillDASDDetails(sysFsDevice *sysfs.Device, blockDevice *blockdevice.BlockDevice) {
+	busID, err := sysFsDevice.GetDASDBusID()
+	if err != nil {
+		logger.Warningf("unable to get bus-id of dasd: %s, err: %v", blockDevice.DevPath, err)
+	} else {
+		logger.V(4).Infof("blockdevice path: %s is dasd with bus-id: %s", blockDevice.DevPath, busID)
+	}
+
+	if blockDevice.DeviceAttributes.Vendor == "" {
+		blockDevice.DeviceAttributes.Vendor = dasdVendor
+	}
+	if blockDevice.DeviceAttributes.Model == "" {
+		devType, err := sysFsDevice.GetDASDDeviceType()
+		if err != nil {
+			logger.Warningf("unable to get device type of dasd: %s, err: %v", blockDevice.DevPath, err)
+		}
+		blockDevice.DeviceAttributes.Model = devType
+	}
+
+	if blockDevice.Capacity.Storage == 0 {
+		capacity, err := sysFsDevice.GetDASDCapacityInBytes()
+		if err != nil {
+			logger.Warningf("unable to get capacity of dasd: %s, err: %v", blockDevice.DevPath, err)
+			return
 		}
 		blockDevice.Capacity.Storage = uint64(capacity)
-		klog.V(4).Infof("blockdevice path: %s capacity :%d filled by sysfs probe.",
+		logger.V(4).Infof("blockdevice path: %s capacity :%d filled by sysfs probe.",
 			blockDevice.DevPath, blockDevice.Capacity.Storage)
 	}
 }
+
+// fillRBDDetails fills the pool and image of a mapped ceph rbd image. The blockdevice
+// is tagged so that it is not claimed, unless rbd images are configured to be claimable.
+func fillRBDDetails(sysFsDevice *sysfs.Device, blockDevice *blockdevice.BlockDevice) {
+	image, err := sysFsDevice.GetRBDImage()
+	if err != nil {
+		logger.Warningf("unable to get image of rbd: %s, err: %v", blockDevice.DevPath, err)
+	} else {
+		if blockDevice.Annotations == nil {
+			blockDevice.Annotations = make(map[string]string)
+		}
+		blockDevice.Annotations[controller.RBDPoolAnnotation] = image.Pool
+		imageName := image.Name
+		if len(image.Namespace) != 0 {
+			imageName = image.Namespace + "/" + imageName
+		}
+		if len(image.Snapshot) != 0 {
+			imageName += "@" + image.Snapshot
+		}
+		blockDevice.Annotations[controller.RBDImageAnnotation] = imageName
+		logger.V(4).Infof("blockdevice path: %s is rbd of image: %s/%s", blockDevice.DevPath, image.Pool, imageName)
+	}
+
+	if blockDevice.DeviceAttributes.Vendor == "" {
+		blockDevice.DeviceAttributes.Vendor = rbdVendor
+	}
+	if blockDevice.DeviceAttributes.Model == "" {
+		blockDevice.DeviceAttributes.Model = rbdModel
+	}
+
+	if controller.RBDClaimable {
+		return
+	}
+	if blockDevice.Labels == nil {
+		blockDevice.Labels = make(map[string]string)
+	}
+	blockDevice.Labels[kubernetes.BlockDeviceTagLabel] = controller.RBDBlockDeviceTag
+}
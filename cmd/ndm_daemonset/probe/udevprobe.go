@@ -18,6 +18,7 @@ package probe
 
 import (
 	"errors"
+	"time"
 
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
@@ -28,7 +29,7 @@ import (
 	"github.com/openebs/node-disk-manager/pkg/util"
 	"golang.org/x/sync/semaphore"
 
-	"k8s.io/klog"
+	v1 "k8s.io/api/core/v1"
 )
 
 const (
@@ -45,7 +46,7 @@ var (
 var udevProbeRegister = func() {
 	ctrl := <-controller.ControllerBroadcastChannel
 	if ctrl == nil {
-		klog.Error("unable to configure", udevProbeName)
+		logger.Errorf("unable to configure%v", udevProbeName)
 		return
 	}
 	if ctrl.NDMConfig != nil {
@@ -58,6 +59,7 @@ var udevProbeRegister = func() {
 		}
 	}
 	newRegisterProbe := &registerProbe{
+		key:        udevConfigKey,
 		priority:   udevProbePriority,
 		name:       udevProbeName,
 		state:      udevProbeState,
@@ -118,18 +120,34 @@ func newUdevProbeForFillDiskDetails(sysPath string) (*udevProbe, error) {
 // Start setup udev probe listener and make a single scan of system
 func (up *udevProbe) Start() {
 	go up.listen()
-	go udevevent.Monitor()
+	up.controller.AddHealthCheck("udev-monitor", true, udevevent.MonitorHealthCheck)
+	// the udev monitor needs the host network namespace, it is run by the
+	// helper if configured
+	if helperClient != nil {
+		go udevevent.MonitorHelper(helperClient)
+	} else {
+		go udevevent.Monitor()
+	}
+	up.controller.SetRescanTrigger(udevevent.RequestRescan)
 	probeEvent := newUdevProbe(up.controller)
 	probeEvent.scan()
 }
 
-// Rescan syncs etcd and NDM
+// Rescan syncs etcd and NDM. In the fake probe mode, the devices in the
+// inventory are scanned instead of the devices on the node.
 func Rescan(c *controller.Controller) error {
+	if controller.FakeProbe {
+		err := (&inventoryProbe{controller: c}).scan()
+		if err != nil {
+			logger.Error(err, "unable to rescan the devices")
+		}
+		return err
+	}
 	udevProbe := newUdevProbe(c)
 	defer udevProbe.free()
 	err := udevProbe.scan()
 	if err != nil {
-		klog.Error(err)
+		logger.Error(err, "unable to rescan the devices")
 		return err
 	}
 	return nil
@@ -145,12 +163,14 @@ func (up *udevProbe) scan() error {
 		return errors.New("Scan is in progress")
 	}
 	defer sem.Release(1)
+	start := time.Now()
 
 	if (up.udev == nil) || (up.udevEnumerate == nil) {
 		return errors.New("unable to scan udev and udev enumerate is nil")
 	}
 	diskInfo := make([]*blockdevice.BlockDevice, 0)
 	disksUid := make([]string, 0)
+	devPaths := make([]string, 0)
 	err := up.udevEnumerate.AddSubsystemFilter(libudevwrapper.UDEV_SUBSYSTEM)
 	if err != nil {
 		return err
@@ -169,8 +189,15 @@ func (up *udevProbe) scan() error {
 			continue
 		}
 		if newUdevice.IsDisk() || newUdevice.IsParitition() {
+			// a disconnected nbd is skipped, so that its blockdevice is made
+			// inactive like that of a device which is not present
+			if isDisconnectedNBD(up.controller, newUdevice.GetPath()) {
+				logger.V(4).Infof("skipping disconnected nbd %s", newUdevice.GetPath())
+				newUdevice.UdevDeviceUnref()
+				continue
+			}
 			deviceDetails := &blockdevice.BlockDevice{}
-			if features.FeatureGates.IsEnabled(features.GPTBasedUUID) {
+			if up.controller.IsFeatureEnabled(features.GPTBasedUUID) {
 				// WWN, Serial, PartitionTableUUID/GPTLabel, PartitionUUID, FileSystemUUID and DeviceType
 				// are the fields we use to generate the UUID. These fields will be fetched
 				// from the udev event itself. This is to guarantee that we do not need to rely
@@ -180,6 +207,8 @@ func (up *udevProbe) scan() error {
 				deviceDetails.PartitionInfo.PartitionTableUUID = newUdevice.GetPropertyValue(libudevwrapper.UDEV_PARTITION_TABLE_UUID)
 				deviceDetails.PartitionInfo.PartitionEntryUUID = newUdevice.GetPropertyValue(libudevwrapper.UDEV_PARTITION_UUID)
 				deviceDetails.FSInfo.FileSystemUUID = newUdevice.GetPropertyValue(libudevwrapper.UDEV_FS_UUID)
+				deviceDetails.DeviceAttributes.DMUUID = newUdevice.GetPropertyValue(libudevwrapper.UDEV_DM_UUID)
+				deviceDetails.DeviceAttributes.PlatformID = newUdevice.GetPlatformID()
 			} else {
 				uuid := newUdevice.GetUid()
 				disksUid = append(disksUid, uuid)
@@ -191,42 +220,51 @@ func (up *udevProbe) scan() error {
 
 			// log the details only if present, to avoid log flooding
 			if deviceDetails.DeviceAttributes.WWN != "" {
-				klog.V(4).Infof("device: %s, WWN: %s filled during udev scan",
+				logger.V(4).Infof("device: %s, WWN: %s filled during udev scan",
 					deviceDetails.DevPath, deviceDetails.DeviceAttributes.WWN)
 			}
 			if deviceDetails.DeviceAttributes.Serial != "" {
-				klog.V(4).Infof("device: %s, Serial: %s filled during udev scan",
+				logger.V(4).Infof("device: %s, Serial: %s filled during udev scan",
 					deviceDetails.DevPath, deviceDetails.DeviceAttributes.Serial)
 			}
 			if deviceDetails.PartitionInfo.PartitionTableUUID != "" {
-				klog.V(4).Infof("device: %s, PartitionTableUUID: %s filled during udev scan",
+				logger.V(4).Infof("device: %s, PartitionTableUUID: %s filled during udev scan",
 					deviceDetails.DevPath, deviceDetails.PartitionInfo.PartitionTableUUID)
 			}
 			if deviceDetails.PartitionInfo.PartitionEntryUUID != "" {
-				klog.V(4).Infof("device: %s, PartitionEntryUUID: %s filled during udev scan",
+				logger.V(4).Infof("device: %s, PartitionEntryUUID: %s filled during udev scan",
 					deviceDetails.DevPath, deviceDetails.PartitionInfo.PartitionEntryUUID)
 			}
 			if deviceDetails.FSInfo.FileSystemUUID != "" {
-				klog.V(4).Infof("device: %s, FileSystemUUID: %s filled during udev scan",
+				logger.V(4).Infof("device: %s, FileSystemUUID: %s filled during udev scan",
 					deviceDetails.DevPath, deviceDetails.FSInfo.FileSystemUUID)
 			}
 
 			diskInfo = append(diskInfo, deviceDetails)
+			devPaths = append(devPaths, deviceDetails.DevPath)
 
 			// get the dependents of the block device
 			// this is done by scanning sysfs
 			sysfsDevice, err := sysfs.NewSysFsDeviceFromDevPath(deviceDetails.DevPath)
 			// TODO if error occurs a rescan may be required
 			if err != nil {
-				klog.Errorf("could not get sysfs device for %s, err: %v", deviceDetails.DevPath, err)
+				logger.Errorf("could not get sysfs device for %s, err: %v", deviceDetails.DevPath, err)
 			} else {
 				dependents, err := sysfsDevice.GetDependents()
 				// TODO if error occurs need to do a scan from the beginning
 				if err != nil {
-					klog.Errorf("error getting dependent devices for %s, err: %v", deviceDetails.DevPath, err)
+					logger.Errorf("error getting dependent devices for %s, err: %v", deviceDetails.DevPath, err)
 				} else {
 					deviceDetails.DependentDevices = dependents
-					klog.Infof("Dependents of %s : %+v", deviceDetails.DevPath, dependents)
+					logger.Infof("Dependents of %s : %+v", deviceDetails.DevPath, dependents)
+				}
+				// the platform id is read from sysfs if the udev rules of the host do not set it
+				if up.controller.IsFeatureEnabled(features.GPTBasedUUID) &&
+					len(deviceDetails.DeviceAttributes.PlatformID) == 0 {
+					deviceDetails.DeviceAttributes.PlatformID, err = sysfsDevice.GetPlatformID()
+					if err != nil {
+						logger.V(4).Infof("could not get platform id of %s: %v", deviceDetails.DevPath, err)
+					}
 				}
 			}
 		}
@@ -235,12 +273,17 @@ func (up *udevProbe) scan() error {
 
 	// when GPTBasedUUID is enabled, all the blockdevices will be made inactive initially.
 	// after that each device that is detected by the probe will be marked as Active.
-	up.controller.DeactivateStaleBlockDeviceResource(disksUid)
+	// on the first scan, the blockdevices are also snapshotted to find the drift, and
+	// the devices that were removed while the daemon was not running are reported.
+	up.controller.DeactivateStaleBlockDeviceResource(disksUid, devPaths)
 	eventDetails := controller.EventMessage{
-		Action:  libudevwrapper.UDEV_ACTION_ADD,
-		Devices: diskInfo,
+		Action:          libudevwrapper.UDEV_ACTION_ADD,
+		Devices:         diskInfo,
+		AllBlockDevices: true,
+		ScanStartedAt:   start,
 	}
 	udevevent.UdevEventMessageChannel <- eventDetails
+	up.controller.RecordRescan()
 	return nil
 }
 
@@ -248,7 +291,7 @@ func (up *udevProbe) scan() error {
 func (up *udevProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
 	udevDevice, err := newUdevProbeForFillDiskDetails(blockDevice.SysPath)
 	if err != nil {
-		klog.Errorf("%s : %s", blockDevice.SysPath, err)
+		logger.Errorf("%s : %s", blockDevice.SysPath, err)
 		return
 	}
 	udevDiskDetails := udevDevice.udevDevice.DiskInfoFromLibudev()
@@ -262,23 +305,23 @@ func (up *udevProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice
 
 	// log only if details are present to prevent log flooding
 	if blockDevice.DeviceAttributes.Model != "" {
-		klog.V(4).Infof("device: %s, Model: %s filled by udev probe",
+		logger.V(4).Infof("device: %s, Model: %s filled by udev probe",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.Model)
 	}
 	if blockDevice.DeviceAttributes.WWN != "" {
-		klog.V(4).Infof("device: %s, WWN: %s filled by udev probe",
+		logger.V(4).Infof("device: %s, WWN: %s filled by udev probe",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.WWN)
 	}
 	if blockDevice.DeviceAttributes.Serial != "" {
-		klog.V(4).Infof("device: %s, Serial: %s filled by udev probe",
+		logger.V(4).Infof("device: %s, Serial: %s filled by udev probe",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.Serial)
 	}
 	if blockDevice.DeviceAttributes.Vendor != "" {
-		klog.V(4).Infof("device: %s, Vendor: %s filled by udev probe",
+		logger.V(4).Infof("device: %s, Vendor: %s filled by udev probe",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.Vendor)
 	}
 	if blockDevice.DeviceAttributes.IDType != "" {
-		klog.V(4).Infof("device: %s, IDType: %s filled by udev probe",
+		logger.V(4).Infof("device: %s, IDType: %s filled by udev probe",
 			blockDevice.DevPath, blockDevice.DeviceAttributes.IDType)
 	}
 
@@ -314,20 +357,37 @@ func (up *udevProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice
 // this function is blocking function better to use it in a routine.
 func (up *udevProbe) listen() {
 	if up.controller == nil {
-		klog.Error("unable to setup udev probe listener controller object is nil")
+		logger.Errorf("unable to setup udev probe listener controller object is nil")
 		return
 	}
 	probeEvent := ProbeEvent{
 		Controller: up.controller,
 	}
-	klog.Info("starting udev probe listener")
+	debouncer := newDeviceDebouncer(getDebounceWindow(), getCoalesceWindow(), getEventQueueSize())
+	logger.Infof("starting udev probe listener")
 	for {
-		msg := <-udevevent.UdevEventMessageChannel
-		switch msg.Action {
-		case string(AttachEA):
-			probeEvent.addBlockDeviceEvent(msg)
-		case string(DetachEA):
-			probeEvent.deleteBlockDeviceEvent(msg)
+		select {
+		case msg := <-udevevent.UdevEventMessageChannel:
+			// events from a full scan are not debounced, since they
+			// reflect the current state of all the devices
+			if msg.AllBlockDevices {
+				probeEvent.handle(msg)
+				continue
+			}
+			for _, device := range msg.Devices {
+				debouncer.submit(msg.Action, device)
+			}
+		case msg := <-debouncer.events:
+			probeEvent.handle(msg)
+		case <-debouncer.resync:
+			dropped := debouncer.takeDropped()
+			logger.Warningf("dropped %d udev events due to overload, rescanning to resync the devices", dropped)
+			up.controller.NodeEventf(v1.EventTypeWarning, "EventsDropped",
+				"Dropped %d udev events due to an event storm, resyncing devices", dropped)
+			go Rescan(up.controller)
+		case <-udevevent.RescanRequestChannel:
+			logger.Infof("rescanning to resync the devices, as requested")
+			go Rescan(up.controller)
 		}
 	}
 }
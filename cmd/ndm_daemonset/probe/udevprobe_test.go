@@ -187,6 +187,7 @@ func TestUdevProbe(t *testing.T) {
 	fakeDr.ObjectMeta.Labels[controller.KubernetesHostNameLabel] = fakeController.NodeAttributes[controller.HostNameKey]
 	fakeDr.ObjectMeta.Labels[controller.NDMDeviceTypeKey] = "blockdevice"
 	fakeDr.ObjectMeta.Labels[controller.NDMManagedKey] = controller.TrueString
+	fakeDr.ObjectMeta.Labels[controller.ManagedByLabel] = controller.ManagedByValue
 	tests := map[string]struct {
 		actualDisk    apis.BlockDevice
 		expectedDisk  apis.BlockDevice
@@ -28,8 +28,6 @@ import (
 	"github.com/openebs/node-disk-manager/pkg/spdk"
 	libudevwrapper "github.com/openebs/node-disk-manager/pkg/udev"
 	"github.com/openebs/node-disk-manager/pkg/util"
-
-	"k8s.io/klog"
 )
 
 type usedbyProbe struct {
@@ -55,7 +53,7 @@ var usedbyProbeRegister = func() {
 	// Get a controller object
 	ctrl := <-controller.ControllerBroadcastChannel
 	if ctrl == nil {
-		klog.Error("unable to configure", usedbyProbeName)
+		logger.Errorf("unable to configure%v", usedbyProbeName)
 		return
 	}
 	if ctrl.NDMConfig != nil {
@@ -68,6 +66,7 @@ var usedbyProbeRegister = func() {
 		}
 	}
 	newRegisterProbe := &registerProbe{
+		key:        usedbyProbeConfigKey,
 		priority:   usedbyProbePriority,
 		name:       usedbyProbeName,
 		state:      usedbyProbeState,
@@ -91,7 +90,7 @@ func (sp *usedbyProbe) Start() {}
 
 func (sp *usedbyProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevice) {
 	if blockDevice.DevPath == "" {
-		klog.Errorf("device identifier found empty, used-by probe will not fetch information")
+		logger.Errorf("device identifier found empty, used-by probe will not fetch information")
 		return
 	}
 
@@ -101,11 +100,17 @@ func (sp *usedbyProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevi
 			strings.Contains(mountPoint, k8sLocalVolumePath2) {
 			blockDevice.DevUse.InUse = true
 			blockDevice.DevUse.UsedBy = blockdevice.LocalPV
-			klog.V(4).Infof("device: %s Used by: %s filled by used-by probe", blockDevice.DevPath, blockDevice.DevUse.UsedBy)
+			logger.V(4).Infof("device: %s Used by: %s filled by used-by probe", blockDevice.DevPath, blockDevice.DevUse.UsedBy)
 			return
 		}
 	}
 
+	// the on disk signatures are read only if the device may be opened
+	if !controller.IsDevicePathAllowed(blockDevice.DevPath) {
+		logger.V(4).Infof("device %s is not allowed to be opened, used-by probe will not read its signatures", blockDevice.DevPath)
+		return
+	}
+
 	// checking for cstor and zfs localPV
 	// we start with the assumption that device has a zfs file system
 	lookupZFS := true
@@ -118,7 +123,7 @@ func (sp *usedbyProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevi
 			devPath = path
 		} else {
 			lookupZFS = false
-			klog.V(4).Infof("device: %s is not having any zfs partitions", blockDevice.DevPath)
+			logger.V(4).Infof("device: %s is not having any zfs partitions", blockDevice.DevPath)
 		}
 	}
 
@@ -136,14 +141,14 @@ func (sp *usedbyProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevi
 			ok, err := isBlockDeviceInUseByKernel(blockDevice.DevPath)
 
 			if err != nil {
-				klog.Errorf("error checking block device: %s: %v", blockDevice.DevPath, err)
+				logger.Errorf("error checking block device: %s: %v", blockDevice.DevPath, err)
 			}
 			if ok {
 				blockDevice.DevUse.UsedBy = blockdevice.ZFSLocalPV
 			} else {
 				blockDevice.DevUse.UsedBy = blockdevice.CStor
 			}
-			klog.V(4).Infof("device: %s Used by: %s filled by used-by probe", blockDevice.DevPath, blockDevice.DevUse.UsedBy)
+			logger.V(4).Infof("device: %s Used by: %s filled by used-by probe", blockDevice.DevPath, blockDevice.DevUse.UsedBy)
 			return
 		}
 	}
@@ -155,12 +160,12 @@ func (sp *usedbyProbe) FillBlockDeviceDetails(blockDevice *blockdevice.BlockDevi
 
 	signature, err := spdkIdentifier.GetSPDKSuperBlockSignature()
 	if err != nil {
-		klog.Errorf("error reading spdk signature from device: %s, %v", blockDevice.DevPath, err)
+		logger.Errorf("error reading spdk signature from device: %s, %v", blockDevice.DevPath, err)
 	}
 	if spdk.IsSPDKSignatureExist(signature) {
 		blockDevice.DevUse.InUse = true
 		blockDevice.DevUse.UsedBy = blockdevice.Mayastor
-		klog.V(4).Infof("device: %s Used by: %s filled by used-by probe", blockDevice.DevPath, blockDevice.DevUse.UsedBy)
+		logger.V(4).Infof("device: %s Used by: %s filled by used-by probe", blockDevice.DevPath, blockDevice.DevUse.UsedBy)
 		return
 	}
 
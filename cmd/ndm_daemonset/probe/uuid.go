@@ -21,8 +21,6 @@ import (
 
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/pkg/util"
-
-	"k8s.io/klog"
 )
 
 // generateUUID creates a new UUID based on the algorithm proposed in
@@ -57,26 +55,45 @@ func generateUUID(bd blockdevice.BlockDevice) (string, bool) {
 		// The partition entry UUID is used when a partition (/dev/sda1) is processed. The partition UUID should be used
 		// if available, other than the partition table UUID, because multiple partitions can have the same partition table
 		// UUID, but each partition will have a different UUID.
-		klog.Infof("device(%s) is a partition, using partition UUID: %s", bd.DevPath, bd.PartitionInfo.PartitionEntryUUID)
-		uuidField = bd.PartitionInfo.PartitionEntryUUID
+		//
+		// Partitions of DASDs do not have a partition UUID, the platform id of the partition is used instead.
+		if len(bd.PartitionInfo.PartitionEntryUUID) == 0 && len(bd.DeviceAttributes.PlatformID) > 0 {
+			logger.Infof("device(%s) is a partition, using platform ID: %s", bd.DevPath, bd.DeviceAttributes.PlatformID)
+			uuidField = bd.DeviceAttributes.PlatformID
+		} else {
+			logger.Infof("device(%s) is a partition, using partition UUID: %s", bd.DevPath, bd.PartitionInfo.PartitionEntryUUID)
+			uuidField = bd.PartitionInfo.PartitionEntryUUID
+		}
 		ok = true
 	case len(bd.DeviceAttributes.WWN) > 0:
 		// if device has WWN, both WWN and Serial will be used for UUID generation.
-		klog.Infof("device(%s) has a WWN, using WWN: %s and Serial: %s",
+		logger.Infof("device(%s) has a WWN, using WWN: %s and Serial: %s",
 			bd.DevPath,
 			bd.DeviceAttributes.WWN, bd.DeviceAttributes.Serial)
 		uuidField = bd.DeviceAttributes.WWN +
 			bd.DeviceAttributes.Serial
 		ok = true
 	case len(bd.FSInfo.FileSystemUUID) > 0:
-		klog.Infof("device(%s) has a filesystem, using filesystem UUID: %s", bd.DevPath, bd.FSInfo.FileSystemUUID)
+		logger.Infof("device(%s) has a filesystem, using filesystem UUID: %s", bd.DevPath, bd.FSInfo.FileSystemUUID)
 		uuidField = bd.FSInfo.FileSystemUUID
 		ok = true
+	case len(bd.DeviceAttributes.DMUUID) > 0:
+		// device mapper devices (multipath, LVM, crypt) have a stable UUID assigned by
+		// device mapper, which is the same across all the paths of a multipath device.
+		logger.Infof("device(%s) is a dm device, using DM UUID: %s", bd.DevPath, bd.DeviceAttributes.DMUUID)
+		uuidField = bd.DeviceAttributes.DMUUID
+		ok = true
+	case len(bd.DeviceAttributes.PlatformID) > 0:
+		// devices without a WWN may have an identifier assigned by the platform, e.g DASDs
+		// on s390x. Such devices cannot be partitioned using GPT.
+		logger.Infof("device(%s) has a platform ID, using platform ID: %s", bd.DevPath, bd.DeviceAttributes.PlatformID)
+		uuidField = bd.DeviceAttributes.PlatformID
+		ok = true
 	}
 
 	if ok {
 		uuid = blockdevice.BlockDevicePrefix + util.Hash(uuidField)
-		klog.Infof("generated uuid: %s for device: %s", uuid, bd.DevPath)
+		logger.Infof("generated uuid: %s for device: %s", uuid, bd.DevPath)
 	}
 
 	return uuid, ok
@@ -107,7 +124,7 @@ func generateLegacyUUID(bd blockdevice.BlockDevice) (string, bool) {
 // generateUUIDFromPartitionTable generates a blockdevice uuid from the partition table uuid.
 // currently this is only used by zfs localPV
 //
-//TODO, this currently supports cases where a complete disk is used for ZFS localPV. If multiple
+// TODO, this currently supports cases where a complete disk is used for ZFS localPV. If multiple
 // partitions on the same disk are used for pools, each one should be shown as a separate BD.
 // For achieving that partition uuid can be used, same as used in the generic UUID generation algorithm
 func generateUUIDFromPartitionTable(bd blockdevice.BlockDevice) (string, bool) {
@@ -30,6 +30,8 @@ func TestGenerateUUID(t *testing.T) {
 	fakeSerial := "CT500MX500SSD1"
 	fakeFileSystemUUID := "149108ca-f404-4556-a263-04943e6cb0b3"
 	fakePartitionUUID := "065e2357-05"
+	fakeDMUUID := "mpath-3600508b400105e210000900000490000"
+	fakeDASDUID := "IBM.75000000092461.e900.10"
 	tests := map[string]struct {
 		bd       blockdevice.BlockDevice
 		wantUUID string
@@ -94,6 +96,49 @@ func TestGenerateUUID(t *testing.T) {
 			wantUUID: blockdevice.BlockDevicePrefix + util.Hash(fakePartitionUUID),
 			wantOk:   true,
 		},
+		"deviceType-dm with DM UUID": {
+			bd: blockdevice.BlockDevice{
+				DeviceAttributes: blockdevice.DeviceAttribute{
+					DeviceType: "mpath",
+					DMUUID:     fakeDMUUID,
+				},
+			},
+			wantUUID: blockdevice.BlockDevicePrefix + util.Hash(fakeDMUUID),
+			wantOk:   true,
+		},
+		"deviceType-dm with DM UUID and a filesystem": {
+			bd: blockdevice.BlockDevice{
+				FSInfo: blockdevice.FileSystemInformation{
+					FileSystemUUID: fakeFileSystemUUID,
+				},
+				DeviceAttributes: blockdevice.DeviceAttribute{
+					DeviceType: "mpath",
+					DMUUID:     fakeDMUUID,
+				},
+			},
+			wantUUID: blockdevice.BlockDevicePrefix + util.Hash(fakeFileSystemUUID),
+			wantOk:   true,
+		},
+		"deviceType-disk dasd with platform ID": {
+			bd: blockdevice.BlockDevice{
+				DeviceAttributes: blockdevice.DeviceAttribute{
+					DeviceType: blockdevice.BlockDeviceTypeDisk,
+					PlatformID: fakeDASDUID,
+				},
+			},
+			wantUUID: blockdevice.BlockDevicePrefix + util.Hash(fakeDASDUID),
+			wantOk:   true,
+		},
+		"deviceType-partition dasd partition without partition UUID": {
+			bd: blockdevice.BlockDevice{
+				DeviceAttributes: blockdevice.DeviceAttribute{
+					DeviceType: blockdevice.BlockDeviceTypePartition,
+					PlatformID: fakeDASDUID + "-part1",
+				},
+			},
+			wantUUID: blockdevice.BlockDevicePrefix + util.Hash(fakeDASDUID+"-part1"),
+			wantOk:   true,
+		},
 		"deviceType-disk with no wwn or filesystem": {
 			bd: blockdevice.BlockDevice{
 				DeviceAttributes: blockdevice.DeviceAttribute{
@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+)
+
+const (
+	// internalLegacyUUIDAnnotation is added on a blockdevice migrated to the gpt
+	// uuid scheme. The value is the uuid of the blockdevice with the legacy scheme.
+	internalLegacyUUIDAnnotation = "internal.openebs.io/legacy-uuid"
+	// internalGPTUUIDAnnotation is added on a legacy blockdevice, with the uuid that
+	// the device has in the gpt uuid scheme.
+	internalGPTUUIDAnnotation = "internal.openebs.io/gpt-uuid"
+)
+
+// migrateLegacyBD migrates the blockdevice created using the legacy UUID algorithm
+// to the GPT based UUID algorithm. Returns true if further processing is required.
+//
+// If the legacy blockdevice is claimed, it is retained so that the claim keeps working,
+// and the new UUID is recorded on it. Else, a blockdevice with the new UUID is created
+// and the legacy blockdevice is deactivated. In both cases the mapping between the UUIDs
+// is stored as annotations.
+func (pe *ProbeEvent) migrateLegacyBD(bd blockdevice.BlockDevice, bdAPIList *apis.BlockDeviceList) (bool, error) {
+	if bd.DeviceAttributes.DeviceType == blockdevice.BlockDeviceTypePartition {
+		// partitions were never created as blockdevices by the legacy algorithm
+		return true, nil
+	}
+
+	uuid, ok := generateUUID(bd)
+	if !ok {
+		return true, nil
+	}
+	if pe.Controller.GetExistingBlockDeviceResource(bdAPIList, uuid) != nil {
+		// device already has a blockdevice with the gpt uuid
+		return true, nil
+	}
+
+	legacyUUID, _ := generateLegacyUUID(bd)
+	legacyBD := pe.Controller.GetExistingBlockDeviceResource(bdAPIList, legacyUUID)
+	if legacyBD == nil {
+		return true, nil
+	}
+	if legacyBD.Annotations[internalUUIDSchemeAnnotation] == gptUUIDScheme {
+		return true, nil
+	}
+
+	if legacyBD.Status.ClaimState != apis.BlockDeviceUnclaimed {
+		logger.Infof("device: %s is claimed with legacy uuid: %s, retaining the uuid", bd.DevPath, legacyUUID)
+		bd.UUID = legacyUUID
+		annotations := map[string]string{
+			internalUUIDSchemeAnnotation: legacyUUIDScheme,
+			internalGPTUUIDAnnotation:    uuid,
+		}
+		return false, pe.createOrUpdateWithAnnotation(annotations, bd, legacyBD)
+	}
+
+	logger.Infof("migrating device: %s from legacy uuid: %s to uuid: %s", bd.DevPath, legacyUUID, uuid)
+	bd.UUID = uuid
+	annotations := map[string]string{
+		internalUUIDSchemeAnnotation: gptUUIDScheme,
+		internalLegacyUUIDAnnotation: legacyUUID,
+	}
+	if err := pe.createOrUpdateWithAnnotation(annotations, bd, nil); err != nil {
+		return false, err
+	}
+
+	legacyBD = legacyBD.DeepCopy()
+	if legacyBD.Annotations == nil {
+		legacyBD.Annotations = make(map[string]string)
+	}
+	legacyBD.Annotations[internalGPTUUIDAnnotation] = uuid
+	pe.Controller.DeactivateBlockDevice(*legacyBD)
+	return false, nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package probe
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMigrateLegacyBD(t *testing.T) {
+	bd := blockdevice.BlockDevice{
+		Identifier: blockdevice.Identifier{
+			DevPath: "/dev/sda",
+		},
+		DeviceAttributes: blockdevice.DeviceAttribute{
+			DeviceType: blockdevice.BlockDeviceTypeDisk,
+			WWN:        "50E5495131BBB060892FBC8E",
+			Serial:     "CT500MX500SSD1",
+			Model:      "CT500MX500SSD1",
+			Vendor:     "ATA",
+			IDType:     "disk",
+		},
+	}
+	gptUUID, _ := generateUUID(bd)
+	legacyUUID, _ := generateLegacyUUID(bd)
+
+	legacyBD := func(claimState apis.DeviceClaimState) apis.BlockDevice {
+		return apis.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   legacyUUID,
+				Labels: map[string]string{controller.NDMManagedKey: controller.TrueString},
+			},
+			Status: apis.DeviceStatus{
+				ClaimState: claimState,
+				State:      controller.NDMActive,
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		bdAPIList       *apis.BlockDeviceList
+		want            bool
+		wantBDName      string
+		wantAnnotations map[string]string
+		wantLegacyState string
+	}{
+		"no legacy blockdevice exists": {
+			bdAPIList: &apis.BlockDeviceList{},
+			want:      true,
+		},
+		"unclaimed legacy blockdevice is migrated": {
+			bdAPIList: &apis.BlockDeviceList{
+				Items: []apis.BlockDevice{legacyBD(apis.BlockDeviceUnclaimed)},
+			},
+			want:       false,
+			wantBDName: gptUUID,
+			wantAnnotations: map[string]string{
+				internalUUIDSchemeAnnotation: gptUUIDScheme,
+				internalLegacyUUIDAnnotation: legacyUUID,
+			},
+			wantLegacyState: controller.NDMInactive,
+		},
+		"claimed legacy blockdevice is retained": {
+			bdAPIList: &apis.BlockDeviceList{
+				Items: []apis.BlockDevice{legacyBD(apis.BlockDeviceClaimed)},
+			},
+			want:       false,
+			wantBDName: legacyUUID,
+			wantAnnotations: map[string]string{
+				internalUUIDSchemeAnnotation: legacyUUIDScheme,
+				internalGPTUUIDAnnotation:    gptUUID,
+			},
+			wantLegacyState: controller.NDMActive,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := scheme.Scheme
+			s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{})
+			s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDeviceList{})
+			cl := fake.NewFakeClientWithScheme(s)
+			for _, bdAPI := range tt.bdAPIList.Items {
+				cl.Create(context.TODO(), &bdAPI)
+			}
+
+			pe := &ProbeEvent{
+				Controller: &controller.Controller{
+					Clientset: cl,
+					Mutex:     &sync.Mutex{},
+				},
+			}
+			got, err := pe.migrateLegacyBD(bd, tt.bdAPIList)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			if len(tt.wantBDName) == 0 {
+				return
+			}
+
+			gotBD := &apis.BlockDevice{}
+			err = cl.Get(context.TODO(), client.ObjectKey{Name: tt.wantBDName}, gotBD)
+			assert.NoError(t, err)
+			for k, v := range tt.wantAnnotations {
+				assert.Equal(t, v, gotBD.Annotations[k])
+			}
+
+			gotLegacyBD := &apis.BlockDevice{}
+			err = cl.Get(context.TODO(), client.ObjectKey{Name: legacyUUID}, gotLegacyBD)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantLegacyState, string(gotLegacyBD.Status.State))
+			assert.Equal(t, gptUUID, gotLegacyBD.Annotations[internalGPTUUIDAnnotation])
+		})
+	}
+}
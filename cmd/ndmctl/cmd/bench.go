@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/bench"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// benchOptions are the options of the benchmark of a device
+type benchOptions struct {
+	// namespace is the namespace of the blockdevices
+	namespace string
+	// duration is the duration of each test
+	duration time.Duration
+	// force runs the write tests on an unclaimed device, overwriting its data
+	force bool
+	// output is the format of the results
+	output string
+}
+
+var benchOpts = benchOptions{duration: bench.DefaultDuration}
+
+// benchReport is the result of the benchmark of a device, printed as json or yaml
+type benchReport struct {
+	Device      string         `json:"device"`
+	BlockDevice string         `json:"blockDevice"`
+	Mode        string         `json:"mode"`
+	Results     []bench.Result `json:"results"`
+}
+
+// runBenchmark runs the benchmark on the device, replaced in the tests
+var runBenchmark = bench.Run
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench <blockdevice|path>",
+	Short: "Benchmark a device and record the results on the blockdevice",
+	Long: `Run a short IO benchmark on a device on the node, and record the sequential and random
+throughput and latency as annotations on the blockdevice, so that the devices can be selected
+by their measured performance. The benchmark only reads from the device by default. The write
+tests overwrite the data on the device, and are run using --force only if the device is not
+claimed, mounted or held by another device`,
+	Example: `  ndmctl bench blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607
+  ndmctl bench /dev/sdb --force --duration 10s`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(benchOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return benchmark(newClient(socket), kubeClient, args[0], benchOpts, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	benchCmd.Flags().StringVarP(&benchOpts.namespace, "namespace", "n", namespace,
+		"Namespace of the blockdevices, the namespace of the ndm daemon by default")
+	benchCmd.Flags().DurationVar(&benchOpts.duration, "duration", benchOpts.duration,
+		"Duration of each test")
+	benchCmd.Flags().BoolVar(&benchOpts.force, "force", false,
+		"Run the write tests, overwriting the data on the device. Refused if the device is in use")
+	cli.AddOutputFlag(benchCmd, &benchOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+}
+
+// benchmark runs the benchmark on the device and records the results on its
+// blockdevice. The results are printed as a report in the json and yaml formats,
+// without the progress.
+func benchmark(c *client, kubeClient kubeclient.Client, name string, opts benchOptions, out io.Writer) error {
+	msgOut := out
+	if opts.output == cli.OutputJSON || opts.output == cli.OutputYAML {
+		msgOut = ioutil.Discard
+	}
+	deviceList, err := c.listDevices()
+	if err != nil {
+		return err
+	}
+	device, err := findDevice(deviceList, name)
+	if err != nil {
+		return err
+	}
+	devPath := device.Device.DevPath
+	if device.Filtered {
+		return fmt.Errorf("refusing to benchmark %s, the device is excluded by the filters", devPath)
+	}
+
+	bd := &apis.BlockDevice{}
+	err = kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: opts.namespace, Name: device.Device.UUID}, bd)
+	if err != nil {
+		return fmt.Errorf("unable to get blockdevice %s of %s: %v", device.Device.UUID, devPath, err)
+	}
+	mode := bench.ModeReadOnly
+	if opts.force {
+		if err := checkNotInUse(deviceList, device, bd, "run the write benchmark on"); err != nil {
+			return err
+		}
+		mode = bench.ModeReadWrite
+	}
+
+	fmt.Fprintf(msgOut, "Benchmarking %s (%s), %s for %s per test\n", devPath, bd.Name, mode, opts.duration)
+	results, err := runBenchmark(devPath, device.Device.Capacity.Storage,
+		bench.Options{Duration: opts.duration, Write: opts.force})
+	if err != nil {
+		return err
+	}
+	if msgOut == out {
+		if err := printBenchResults(out, results); err != nil {
+			return err
+		}
+	}
+
+	bd.Annotations = bench.SetAnnotations(bd.Annotations, bench.Annotations(results, mode, time.Now()))
+	if err := kubeClient.Update(context.TODO(), bd); err != nil {
+		return fmt.Errorf("unable to record the results on blockdevice %s: %v", bd.Name, err)
+	}
+	if msgOut != out {
+		return cli.PrintObject(out, opts.output, benchReport{
+			Device:      devPath,
+			BlockDevice: bd.Name,
+			Mode:        mode,
+			Results:     results,
+		})
+	}
+	_, err = fmt.Fprintf(out, "Results recorded on blockdevice %s\n", bd.Name)
+	return err
+}
+
+// printBenchResults prints the results of the tests as a table
+func printBenchResults(out io.Writer, results []bench.Result) error {
+	w := cli.NewTabWriter(out)
+	fmt.Fprintln(w, "TEST\tTHROUGHPUT\tIOPS\tAVG LATENCY\tP99 LATENCY")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s/s\t%.0f\t%s\t%s\n", r.Test, bytesRate(r.BytesPerSecond), r.IOPS,
+			r.AvgLatency.Round(time.Microsecond), r.P99Latency.Round(time.Microsecond))
+	}
+	return w.Flush()
+}
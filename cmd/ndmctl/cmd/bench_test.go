@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/bench"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestBenchmark(t *testing.T) {
+	deviceList := controller.DeviceList{
+		Node: "node1",
+		Devices: []controller.DeviceStatus{
+			{Device: newTestDevice("/dev/sdc", "blockdevice-c", "S3")},
+			{Device: newTestDevice("/dev/sdd", "blockdevice-d", "S4")},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.DevicesPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(deviceList))
+	})
+	socket, stop := serveTestAPI(t, mux)
+	defer stop()
+
+	oldRunBenchmark := runBenchmark
+	defer func() { runBenchmark = oldRunBenchmark }()
+	runs := make([]string, 0)
+	runBenchmark = func(devPath string, size uint64, opts bench.Options) ([]bench.Result, error) {
+		assert.Equal(t, uint64(3<<20+5), size)
+		results := []bench.Result{{Test: bench.SequentialRead, BytesPerSecond: 200 << 20, IOPS: 200,
+			AvgLatency: 4900 * time.Microsecond, P99Latency: 9 * time.Millisecond}}
+		if opts.Write {
+			runs = append(runs, devPath+" write")
+			results = append(results, bench.Result{Test: bench.SequentialWrite, BytesPerSecond: 100 << 20, IOPS: 100})
+		} else {
+			runs = append(runs, devPath)
+		}
+		return results, nil
+	}
+
+	kubeClient := newTestKubeClient(
+		newTestBlockDevice("blockdevice-c", "node1", "/dev/sdc", testDeviceCapacity, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-d", "node1", "/dev/sdd", testDeviceCapacity, apis.BlockDeviceClaimed))
+	c := newClient(socket)
+	opts := benchOptions{namespace: "openebs", duration: time.Second}
+
+	var out strings.Builder
+	force := opts
+	force.force = true
+	err := benchmark(c, kubeClient, "sdd", force, &out)
+	assert.EqualError(t, err, "refusing to run the write benchmark on /dev/sdd, blockdevice blockdevice-d is Claimed by bdc-1")
+	assert.Empty(t, runs)
+
+	// the read-only benchmark is run on the claimed devices
+	require.NoError(t, benchmark(c, kubeClient, "sdd", opts, &out))
+	assert.Contains(t, out.String(), `TEST      THROUGHPUT  IOPS  AVG LATENCY  P99 LATENCY
+seq-read  200.0Mi/s   200   4.9ms        9ms
+Results recorded on blockdevice blockdevice-d
+`)
+	require.NoError(t, benchmark(c, kubeClient, "blockdevice-c", force, &out))
+	assert.Equal(t, []string{"/dev/sdd", "/dev/sdc write"}, runs)
+
+	// only the report is printed as json
+	out.Reset()
+	jsonOpts := opts
+	jsonOpts.output = cli.OutputJSON
+	require.NoError(t, benchmark(c, kubeClient, "sdd", jsonOpts, &out))
+	report := benchReport{}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &report))
+	assert.Equal(t, "/dev/sdd", report.Device)
+	assert.Equal(t, "blockdevice-d", report.BlockDevice)
+	assert.Equal(t, bench.ModeReadOnly, report.Mode)
+	assert.Equal(t, float64(200<<20), report.Results[0].BytesPerSecond)
+
+	bd := &apis.BlockDevice{}
+	require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "blockdevice-c"}, bd))
+	assert.Equal(t, "read-write", bd.Annotations[bench.ModeAnnotation])
+	assert.Equal(t, "209715200", bd.Annotations["ndm.io/bench-seq-read-bytes-per-second"])
+	assert.Equal(t, "100", bd.Annotations["ndm.io/bench-seq-write-iops"])
+	require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "blockdevice-d"}, bd))
+	assert.Equal(t, "read-only", bd.Annotations[bench.ModeAnnotation])
+	assert.Equal(t, "4900", bd.Annotations["ndm.io/bench-seq-read-avg-latency-us"])
+}
@@ -0,0 +1,468 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// bundleOptions are the options of the support bundle
+type bundleOptions struct {
+	// namespace is the namespace of NDM and the blockdevices
+	namespace string
+	// node is the node of the daemon, whose pods and blockdevices are collected
+	node string
+	// file is the path of the bundle, a name having the node and the time is
+	// used if not set
+	file string
+	// redactSerials replaces the serials of the devices in all the files
+	redactSerials bool
+	// logLines is the no. of lines of the logs collected from each container
+	logLines int64
+}
+
+var bundleOpts = bundleOptions{logLines: 10000}
+
+var (
+	// sysBlockDir is the directory of the block devices in sysfs
+	sysBlockDir = "/sys/block"
+	// udevDataDir is the udev database, having the properties of the devices
+	// printed by udevadm info
+	udevDataDir = "/run/udev/data"
+	// bundleConfigFile is the ndm config collected in the bundle
+	bundleConfigFile = controller.DefaultConfigFilePath
+)
+
+// sysfsBlockSubdirs are the directories of a block device in sysfs whose
+// attributes are collected, relative to the directory of the device
+var sysfsBlockSubdirs = []string{"", "queue", "device"}
+
+// udevSerialProperties are the properties in the udev database having the serial
+var udevSerialProperties = []string{"E:ID_SERIAL=", "E:ID_SERIAL_SHORT=", "E:ID_SCSI_SERIAL="}
+
+// minRedactedSerialLength is the min length of a redacted serial, the shorter
+// serials are not redacted as they would replace unrelated values
+const minRedactedSerialLength = 4
+
+// ndmComponentSelector selects the pods of the ndm daemon and the operator
+const ndmComponentSelector = "openebs.io/component-name in (ndm, ndm-operator)"
+
+// podLogsFunc returns the last lines of the logs of the container of the pod
+type podLogsFunc func(namespace, pod, container string, tailLines int64) ([]byte, error)
+
+// bundleCmd represents the bundle command
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Collect the logs, config and details of the devices on the node into a support bundle",
+	Long: `Collect the details needed to debug the discovery of the devices on the node into a tarball,
+to be attached to a bug report. The bundle has the devices processed by the daemon, the ndm
+config, the udev database and the sysfs attributes of the devices, the blockdevices and
+blockdeviceclaims without the managed fields, and the logs of the ndm pods. The details
+which cannot be collected are listed in errors.txt of the bundle. The serials of the
+devices can be redacted using --redact-serials`,
+	Example: `  kubectl exec -n openebs <ndm pod on the node> -- ndmctl bundle --redact-serials -f /tmp/bundle.tar.gz
+  kubectl cp openebs/<ndm pod on the node>:/tmp/bundle.tar.gz bundle.tar.gz`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b := newBundle()
+		collector := &bundleCollector{client: newClient(socket), opts: bundleOpts}
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			b.addError("unable to connect to the API server, the resources are not collected: %v", err)
+		} else {
+			collector.kubeClient = kubeClient
+		}
+		clientset, err := cli.NewClientset()
+		if err != nil {
+			b.addError("unable to connect to the API server, the logs are not collected: %v", err)
+		} else {
+			collector.podLogs = func(namespace, pod, container string, tailLines int64) ([]byte, error) {
+				return clientset.CoreV1().Pods(namespace).GetLogs(pod,
+					&v1.PodLogOptions{Container: container, TailLines: &tailLines}).DoRaw()
+			}
+		}
+		collector.collect(b)
+
+		now := time.Now()
+		file := collector.opts.file
+		if len(file) == 0 {
+			file = fmt.Sprintf("ndm-bundle-%s-%s.tar.gz", cli.OrNone(collector.opts.node), now.Format("20060102-150405"))
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		root := strings.TrimSuffix(filepath.Base(file), ".tar.gz")
+		if err := b.write(f, root, now); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote support bundle %s with %d files, %d details could not be collected\n",
+			file, len(b.names), len(b.errors))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	bundleCmd.Flags().StringVarP(&bundleOpts.namespace, "namespace", "n", namespace,
+		"Namespace of NDM and the blockdevices, the namespace of the ndm daemon by default")
+	bundleCmd.Flags().StringVar(&bundleOpts.node, "node", os.Getenv("NODE_NAME"),
+		"Node whose pods and blockdevices are collected, the node of the ndm daemon by default")
+	bundleCmd.Flags().StringVarP(&bundleOpts.file, "file", "f", "",
+		"Path of the bundle, ndm-bundle-<node>-<time>.tar.gz in the current directory by default")
+	bundleCmd.Flags().BoolVar(&bundleOpts.redactSerials, "redact-serials", false,
+		"Replace the serials of the devices in all the files of the bundle")
+	bundleCmd.Flags().Int64Var(&bundleOpts.logLines, "log-lines", bundleOpts.logLines,
+		"No. of lines of the logs collected from each container")
+}
+
+// bundle is the content of the support bundle
+type bundle struct {
+	// names are the names of the files in the order in which they are added
+	names []string
+	files map[string][]byte
+	// errors are the details which could not be collected
+	errors []string
+	// serials are the serials of the devices found in the files
+	serials map[string]bool
+}
+
+// newBundle returns an empty bundle
+func newBundle() *bundle {
+	return &bundle{
+		names:   make([]string, 0),
+		files:   make(map[string][]byte),
+		errors:  make([]string, 0),
+		serials: make(map[string]bool),
+	}
+}
+
+// add adds the file to the bundle
+func (b *bundle) add(name string, data []byte) {
+	if _, ok := b.files[name]; !ok {
+		b.names = append(b.names, name)
+	}
+	b.files[name] = data
+}
+
+// addError records a detail which could not be collected
+func (b *bundle) addError(format string, args ...interface{}) {
+	b.errors = append(b.errors, fmt.Sprintf(format, args...))
+}
+
+// addSerial records the serial of a device, to be redacted
+func (b *bundle) addSerial(serial string) {
+	serial = strings.TrimSpace(serial)
+	if len(serial) >= minRedactedSerialLength {
+		b.serials[serial] = true
+	}
+}
+
+// redact replaces the serials in all the files. Each serial is replaced by
+// the same value in all the files, so that the devices can still be matched
+// across the files. The longer serials are replaced first, as the serial
+// reported by udev has the short serial in it.
+func (b *bundle) redact() {
+	serials := make([]string, 0, len(b.serials))
+	for serial := range b.serials {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+	replacements := make(map[string]string, len(serials))
+	for i, serial := range serials {
+		replacements[serial] = fmt.Sprintf("REDACTED-SERIAL-%d", i+1)
+	}
+	sort.SliceStable(serials, func(i, j int) bool {
+		return len(serials[i]) > len(serials[j])
+	})
+	for name, data := range b.files {
+		for _, serial := range serials {
+			data = bytes.ReplaceAll(data, []byte(serial), []byte(replacements[serial]))
+		}
+		b.files[name] = data
+	}
+}
+
+// write writes the bundle as a gzipped tarball having the files under the root
+// directory, with the errors in errors.txt
+func (b *bundle) write(out io.Writer, root string, now time.Time) error {
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+	writeFile := func(name string, data []byte) error {
+		header := &tar.Header{
+			Name:    path.Join(root, name),
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for _, name := range b.names {
+		if err := writeFile(name, b.files[name]); err != nil {
+			return err
+		}
+	}
+	if len(b.errors) != 0 {
+		if err := writeFile("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// bundleCollector collects the details of the node into the bundle
+type bundleCollector struct {
+	client *client
+	// kubeClient is the client of the API server, nil if not available
+	kubeClient kubeclient.Client
+	// podLogs gets the logs of the pods, nil if not available
+	podLogs podLogsFunc
+	opts    bundleOptions
+}
+
+// collect collects all the details into the bundle
+func (bc *bundleCollector) collect(b *bundle) {
+	bc.collectDevices(b)
+	bc.collectConfig(b)
+	collectUdevData(b)
+	collectSysfs(b)
+	bc.collectResources(b)
+	bc.collectLogs(b)
+	if bc.opts.redactSerials {
+		b.redact()
+	}
+}
+
+// collectDevices collects the devices processed by the daemon. The node of the
+// daemon is used if the node is not given.
+func (bc *bundleCollector) collectDevices(b *bundle) {
+	deviceList, err := bc.client.listDevices()
+	if err != nil {
+		b.addError("unable to get the devices from the ndm daemon: %v", err)
+		return
+	}
+	if len(bc.opts.node) == 0 {
+		bc.opts.node = deviceList.Node
+	}
+	for _, status := range deviceList.Devices {
+		b.addSerial(status.Device.DeviceAttributes.Serial)
+	}
+	data, err := json.MarshalIndent(deviceList, "", "  ")
+	if err != nil {
+		b.addError("unable to encode the devices: %v", err)
+		return
+	}
+	b.add("devices.json", data)
+}
+
+// collectConfig collects the ndm config
+func (bc *bundleCollector) collectConfig(b *bundle) {
+	data, err := ioutil.ReadFile(bundleConfigFile)
+	if err != nil {
+		b.addError("unable to read the ndm config: %v", err)
+		return
+	}
+	b.add("config/"+filepath.Base(bundleConfigFile), data)
+}
+
+// collectUdevData collects the entries of the block devices in the udev database
+func collectUdevData(b *bundle) {
+	files, err := filepath.Glob(filepath.Join(udevDataDir, "b*"))
+	if err != nil || len(files) == 0 {
+		b.addError("unable to find the udev database of the block devices in %s", udevDataDir)
+		return
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.addError("unable to read udev data %s: %v", file, err)
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			for _, property := range udevSerialProperties {
+				if strings.HasPrefix(scanner.Text(), property) {
+					b.addSerial(strings.TrimPrefix(scanner.Text(), property))
+				}
+			}
+		}
+		b.add("udev/"+filepath.Base(file), data)
+	}
+}
+
+// collectSysfs collects the sysfs attributes of the block devices. The
+// attributes which cannot be read, eg: the write only attributes, are skipped.
+func collectSysfs(b *bundle) {
+	devices, err := ioutil.ReadDir(sysBlockDir)
+	if err != nil {
+		b.addError("unable to list the block devices in sysfs: %v", err)
+		return
+	}
+	for _, device := range devices {
+		for _, subdir := range sysfsBlockSubdirs {
+			dir := filepath.Join(sysBlockDir, device.Name(), subdir)
+			attributes, err := ioutil.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, attribute := range attributes {
+				if !attribute.Mode().IsRegular() {
+					continue
+				}
+				data, err := ioutil.ReadFile(filepath.Join(dir, attribute.Name()))
+				if err != nil {
+					continue
+				}
+				if attribute.Name() == "serial" {
+					b.addSerial(string(data))
+				}
+				b.add(path.Join("sysfs", device.Name(), subdir, attribute.Name()), data)
+			}
+		}
+	}
+}
+
+// collectResources collects the blockdevices of the node and the
+// blockdeviceclaims, without the managed fields and the last applied config
+func (bc *bundleCollector) collectResources(b *bundle) {
+	if bc.kubeClient == nil {
+		return
+	}
+	bdList := &apis.BlockDeviceList{}
+	if err := bc.kubeClient.List(context.TODO(), bdList, kubeclient.InNamespace(bc.opts.namespace)); err != nil {
+		b.addError("unable to list the blockdevices: %v", err)
+	} else {
+		items := make([]apis.BlockDevice, 0, len(bdList.Items))
+		for _, bd := range bdList.Items {
+			if len(bc.opts.node) != 0 && bd.Spec.NodeAttributes.NodeName != bc.opts.node {
+				continue
+			}
+			b.addSerial(bd.Spec.Details.Serial)
+			sanitize(&bd)
+			items = append(items, bd)
+		}
+		bdList.Items = items
+		bdList.Kind = "BlockDeviceList"
+		bdList.APIVersion = apis.SchemeGroupVersion.String()
+		bc.addResource(b, "resources/blockdevices.yaml", bdList)
+	}
+
+	bdcList := &apis.BlockDeviceClaimList{}
+	if err := bc.kubeClient.List(context.TODO(), bdcList, kubeclient.InNamespace(bc.opts.namespace)); err != nil {
+		b.addError("unable to list the blockdeviceclaims: %v", err)
+	} else {
+		for i := range bdcList.Items {
+			sanitize(&bdcList.Items[i])
+		}
+		bdcList.Kind = "BlockDeviceClaimList"
+		bdcList.APIVersion = apis.SchemeGroupVersion.String()
+		bc.addResource(b, "resources/blockdeviceclaims.yaml", bdcList)
+	}
+}
+
+// sanitize removes the managed fields and the last applied config of the resource
+func sanitize(obj metav1.Object) {
+	obj.SetManagedFields(nil)
+	annotations := obj.GetAnnotations()
+	delete(annotations, v1.LastAppliedConfigAnnotation)
+	obj.SetAnnotations(annotations)
+}
+
+// addResource adds the resources as yaml
+func (bc *bundleCollector) addResource(b *bundle, name string, obj runtime.Object) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		b.addError("unable to encode %s: %v", name, err)
+		return
+	}
+	b.add(name, data)
+}
+
+// collectLogs collects the logs of the containers of the ndm pods on the node
+// and the operator pods
+func (bc *bundleCollector) collectLogs(b *bundle) {
+	if bc.kubeClient == nil || bc.podLogs == nil {
+		return
+	}
+	selector, err := labels.Parse(ndmComponentSelector)
+	if err != nil {
+		b.addError("invalid selector of the ndm pods: %v", err)
+		return
+	}
+	podList := &v1.PodList{}
+	err = bc.kubeClient.List(context.TODO(), podList, kubeclient.InNamespace(bc.opts.namespace),
+		kubeclient.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		b.addError("unable to list the ndm pods: %v", err)
+		return
+	}
+	for _, pod := range podList.Items {
+		// the daemons on the other nodes are not collected
+		if pod.Labels["openebs.io/component-name"] == "ndm" && len(bc.opts.node) != 0 &&
+			pod.Spec.NodeName != bc.opts.node {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			data, err := bc.podLogs(pod.Namespace, pod.Name, container.Name, bc.opts.logLines)
+			if err != nil {
+				b.addError("unable to get the logs of container %s of pod %s: %v", container.Name, pod.Name, err)
+				continue
+			}
+			b.add(path.Join("logs", pod.Name, container.Name+".log"), data)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndmctl-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	oldSysBlockDir, oldUdevDataDir, oldConfigFile := sysBlockDir, udevDataDir, bundleConfigFile
+	defer func() { sysBlockDir, udevDataDir, bundleConfigFile = oldSysBlockDir, oldUdevDataDir, oldConfigFile }()
+	sysBlockDir = filepath.Join(dir, "sys", "block")
+	udevDataDir = filepath.Join(dir, "udev")
+	bundleConfigFile = filepath.Join(dir, "missing.config")
+	require.NoError(t, os.MkdirAll(filepath.Join(sysBlockDir, "sdb", "device"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(sysBlockDir, "sdb", "size"), []byte("2097152\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(sysBlockDir, "sdb", "device", "model"), []byte("ST4000NM\n"), 0644))
+	require.NoError(t, os.MkdirAll(udevDataDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(udevDataDir, "b8:16"),
+		[]byte("E:ID_SERIAL=ST4000NM_ZC1A2B3C\nE:ID_SERIAL_SHORT=ZC1A2B3C\nE:ID_TYPE=disk\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(udevDataDir, "c4:1"), []byte("E:ID_SERIAL=tty\n"), 0644))
+
+	sdb := newTestDevice("/dev/sdb", "blockdevice-b", "ZC1A2B3C")
+	deviceList := controller.DeviceList{Node: "node1", Devices: []controller.DeviceStatus{{Device: sdb}}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.DevicesPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(deviceList))
+	})
+	socket, stop := serveTestAPI(t, mux)
+	defer stop()
+
+	bd := newTestBlockDevice("blockdevice-b", "node1", "/dev/sdb", 1<<30, apis.BlockDeviceUnclaimed)
+	bd.Annotations = map[string]string{v1.LastAppliedConfigAnnotation: "{}", "internal.openebs.io/fsuuid": "f1"}
+	bd.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "ndm"}}
+	bd.Spec.Details.Serial = "ZC1A2B3C"
+	otherBD := newTestBlockDevice("blockdevice-x", "node2", "/dev/sdb", 1<<30, apis.BlockDeviceUnclaimed)
+	newPod := func(name, component, node string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openebs",
+				Labels: map[string]string{"openebs.io/component-name": component}},
+			Spec: v1.PodSpec{NodeName: node, Containers: []v1.Container{{Name: "node-disk-manager"}}},
+		}
+	}
+	kubeClient := newTestKubeClient(bd, otherBD,
+		newPod("ndm-a", "ndm", "node1"), newPod("ndm-b", "ndm", "node2"),
+		newPod("ndm-operator-a", "ndm-operator", "node2"), newPod("exporter-a", "ndm-node-exporter", "node1"))
+
+	collector := &bundleCollector{
+		client:     newClient(socket),
+		kubeClient: kubeClient,
+		podLogs: func(namespace, pod, container string, tailLines int64) ([]byte, error) {
+			assert.Equal(t, int64(100), tailLines)
+			if pod == "ndm-operator-a" {
+				return nil, fmt.Errorf("container is not running")
+			}
+			return []byte("device: /dev/sdb, Serial: ZC1A2B3C filled by udev probe\n"), nil
+		},
+		opts: bundleOptions{namespace: "openebs", redactSerials: true, logLines: 100},
+	}
+	b := newBundle()
+	collector.collect(b)
+	assert.Equal(t, "node1", collector.opts.node)
+
+	var out strings.Builder
+	require.NoError(t, b.write(&out, "ndm-bundle", time.Now()))
+	files := readTestBundle(t, out.String())
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{
+		"ndm-bundle/devices.json",
+		"ndm-bundle/udev/b8:16",
+		"ndm-bundle/sysfs/sdb/size",
+		"ndm-bundle/sysfs/sdb/device/model",
+		"ndm-bundle/resources/blockdevices.yaml",
+		"ndm-bundle/resources/blockdeviceclaims.yaml",
+		"ndm-bundle/logs/ndm-a/node-disk-manager.log",
+		"ndm-bundle/errors.txt",
+	}, names)
+
+	// the serials are redacted in all the files, the serial reported by udev
+	// having the short serial in it
+	for name, data := range files {
+		assert.NotContains(t, data, "ZC1A2B3C", name)
+	}
+	assert.Equal(t, "E:ID_SERIAL=REDACTED-SERIAL-1\nE:ID_SERIAL_SHORT=REDACTED-SERIAL-2\nE:ID_TYPE=disk\n",
+		files["ndm-bundle/udev/b8:16"])
+	assert.Contains(t, files["ndm-bundle/logs/ndm-a/node-disk-manager.log"], "Serial: REDACTED-SERIAL-2")
+
+	// only the blockdevices of the node are collected, without the managed fields
+	bds := files["ndm-bundle/resources/blockdevices.yaml"]
+	assert.Contains(t, bds, "name: blockdevice-b")
+	assert.NotContains(t, bds, "blockdevice-x")
+	assert.NotContains(t, bds, "managedFields")
+	assert.NotContains(t, bds, v1.LastAppliedConfigAnnotation)
+	assert.Contains(t, bds, "internal.openebs.io/fsuuid: f1")
+
+	assert.Equal(t, "unable to read the ndm config: open "+bundleConfigFile+": no such file or directory\n"+
+		"unable to get the logs of container node-disk-manager of pod ndm-operator-a: container is not running\n",
+		files["ndm-bundle/errors.txt"])
+}
+
+// readTestBundle returns the contents of the files in the bundle
+func readTestBundle(t *testing.T, data string) map[string]string {
+	gr, err := gzip.NewReader(strings.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	files := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(content)
+	}
+	return files
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// claimOptions are the options of the claim to be created
+type claimOptions struct {
+	cli.ClaimOptions
+	// wait waits till the claim is bound
+	wait bool
+	// timeout is the time to wait for the claim to be bound
+	timeout time.Duration
+	// output is the format of the created claim
+	output string
+}
+
+var claimOpts = claimOptions{timeout: 5 * time.Minute}
+
+// claimCmd represents the claim command
+var claimCmd = &cobra.Command{
+	Use:   "claim",
+	Short: "Manage the blockdevice claims",
+}
+
+// claimCreateCmd represents the claim create command
+var claimCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a blockdevice claim, and wait for it to be bound",
+	Long: `Create a blockdevice claim for a blockdevice with the capacity, on the node if given.
+The claims cannot select the blockdevices by the drive type, so the smallest unclaimed
+blockdevice of the drive type with the capacity is selected and claimed by name, if the
+drive type is given. The nvme type selects the NVMe devices.
+
+With --wait, the claim is watched till it is bound, and the path of the bound device is
+printed on the standard output, the other messages are printed on the standard error`,
+	Example: `  ndmctl claim create --capacity 500Gi --node worker-2 --type nvme --wait
+  DEVICE=$(ndmctl claim create --capacity 1Ti --type ssd --wait --timeout 2m)`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(claimOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return createClaim(kubeClient, claimOpts, os.Stdout, os.Stderr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(claimCmd)
+	claimCmd.AddCommand(claimCreateCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	claimCreateCmd.Flags().StringVarP(&claimOpts.Namespace, "namespace", "n", namespace,
+		"Namespace of the blockdevices and the blockdeviceclaim")
+	claimCreateCmd.Flags().StringVar(&claimOpts.Name, "name", "",
+		"Name of the claim. A name is generated if empty")
+	claimCreateCmd.Flags().StringVar(&claimOpts.Capacity, "capacity", "",
+		"Capacity of the blockdevice, eg: 500Gi")
+	claimCreateCmd.Flags().StringVar(&claimOpts.Node, "node", "",
+		"Node on which the blockdevice is claimed, any node if empty")
+	claimCreateCmd.Flags().StringVar(&claimOpts.DriveType, "type", "",
+		"Drive type of the blockdevice, ssd, hdd or nvme")
+	claimCreateCmd.Flags().StringVar(&claimOpts.DeviceType, "device-type", "",
+		"Device type of the blockdevice, eg: disk, partition")
+	claimCreateCmd.Flags().BoolVar(&claimOpts.wait, "wait", false,
+		"Wait till the claim is bound, and print the path of the bound device")
+	claimCreateCmd.Flags().DurationVar(&claimOpts.timeout, "timeout", claimOpts.timeout,
+		"Time to wait for the claim to be bound")
+	cli.AddOutputFlag(claimCreateCmd, &claimOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+	_ = claimCreateCmd.MarkFlagRequired("capacity")
+}
+
+// createClaim creates the claim, and waits for it to be bound if asked. The
+// path of the bound device is printed to out, the other messages to errOut
+// when waiting. In the json and yaml formats, the claim is printed to out
+// once it is created or bound, and the messages to errOut.
+func createClaim(kubeClient kubeclient.Client, opts claimOptions, out, errOut io.Writer) error {
+	printClaim := opts.output == cli.OutputJSON || opts.output == cli.OutputYAML
+	bdc, err := cli.NewClaim(kubeClient, opts.ClaimOptions)
+	if err != nil {
+		return err
+	}
+	if err := kubeClient.Create(context.TODO(), bdc); err != nil {
+		return fmt.Errorf("unable to create blockdevice claim %s: %v", bdc.Name, err)
+	}
+
+	msgOut := out
+	if opts.wait || printClaim {
+		msgOut = errOut
+	}
+	if len(bdc.Spec.BlockDeviceName) != 0 {
+		fmt.Fprintf(msgOut, "blockdeviceclaim/%s created for blockdevice %s\n", bdc.Name, bdc.Spec.BlockDeviceName)
+	} else {
+		fmt.Fprintf(msgOut, "blockdeviceclaim/%s created\n", bdc.Name)
+	}
+	if !opts.wait {
+		if printClaim {
+			return cli.PrintObject(out, opts.output, bdc)
+		}
+		return nil
+	}
+
+	bd, err := cli.WaitForClaim(kubeClient, bdc.Namespace, bdc.Name, opts.timeout)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(errOut, "blockdeviceclaim/%s bound to blockdevice %s on node %s\n",
+		bdc.Name, bd.Name, cli.OrNone(bd.Spec.NodeAttributes.NodeName))
+	if printClaim {
+		key := kubeclient.ObjectKey{Namespace: bdc.Namespace, Name: bdc.Name}
+		if err := kubeClient.Get(context.TODO(), key, bdc); err != nil {
+			return fmt.Errorf("unable to get blockdeviceclaim %s: %v", bdc.Name, err)
+		}
+		return cli.PrintObject(out, opts.output, bdc)
+	}
+	_, err = fmt.Fprintln(out, bd.Spec.Path)
+	return err
+}
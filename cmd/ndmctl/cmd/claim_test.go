@@ -0,0 +1,100 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCreateClaim(t *testing.T) {
+	kubeClient := newTestKubeClient(
+		newTestBlockDevice("blockdevice-a", "worker-1", "/dev/nvme0n1", 1<<40, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-b", "worker-2", "/dev/sdb", 600<<30, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-c", "worker-2", "/dev/nvme1n1", 1<<40, apis.BlockDeviceUnclaimed))
+	cli.ClaimPollInterval = 10 * time.Millisecond
+
+	// bind the claim like the operator does
+	go func() {
+		for {
+			bdc := &apis.BlockDeviceClaim{}
+			err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "bdc-1"}, bdc)
+			if err == nil {
+				bdc.Status.Phase = apis.BlockDeviceClaimStatusDone
+				_ = kubeClient.Update(context.TODO(), bdc)
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	opts := claimOptions{timeout: 5 * time.Second}
+	opts.Namespace = "openebs"
+	opts.Name = "bdc-1"
+	opts.Capacity = "500Gi"
+	opts.Node = "worker-2"
+	opts.DriveType = "nvme"
+	opts.wait = true
+	var out, errOut bytes.Buffer
+	require.NoError(t, createClaim(kubeClient, opts, &out, &errOut))
+	assert.Equal(t, "/dev/nvme1n1\n", out.String())
+	assert.Equal(t, "blockdeviceclaim/bdc-1 created for blockdevice blockdevice-c\n"+
+		"blockdeviceclaim/bdc-1 bound to blockdevice blockdevice-c on node worker-2\n", errOut.String())
+
+	// the claim is not bound
+	out.Reset()
+	errOut.Reset()
+	opts.Name = "bdc-2"
+	opts.DriveType = "ssd"
+	opts.timeout = 50 * time.Millisecond
+	assert.EqualError(t, createClaim(kubeClient, opts, &out, &errOut),
+		"blockdeviceclaim bdc-2 is not bound after 50ms, phase <none>")
+	assert.Equal(t, "blockdeviceclaim/bdc-2 created for blockdevice blockdevice-b\n", errOut.String())
+	assert.Empty(t, out.String())
+
+	// without waiting, the messages are printed to the output
+	out.Reset()
+	opts.Name = "bdc-3"
+	opts.DriveType = ""
+	opts.wait = false
+	require.NoError(t, createClaim(kubeClient, opts, &out, &errOut))
+	assert.Equal(t, "blockdeviceclaim/bdc-3 created\n", out.String())
+
+	out.Reset()
+	opts.Name = "bdc-5"
+	opts.output = cli.OutputJSON
+	require.NoError(t, createClaim(kubeClient, opts, &out, &errOut))
+	bdc := &apis.BlockDeviceClaim{}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), bdc))
+	assert.Equal(t, "bdc-5", bdc.Name)
+	assert.Equal(t, "worker-2", bdc.Spec.BlockDeviceNodeAttributes.NodeName)
+	opts.output = cli.OutputText
+
+	opts.Name = "bdc-4"
+	opts.DriveType = "nvme"
+	opts.Capacity = "2Ti"
+	assert.EqualError(t, createClaim(kubeClient, opts, &out, &errOut),
+		"no unclaimed nvme blockdevice with capacity 2Ti found")
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+)
+
+// requestTimeout is the max time taken by a request to the daemon
+var requestTimeout = 30 * time.Second
+
+// apiHost is the host in the urls of the requests to the daemon. The requests
+// are sent on the socket, so the host is not used.
+const apiHost = "http://ndm"
+
+// client calls the local api of the daemon on its unix socket
+type client struct {
+	httpClient *http.Client
+}
+
+// newClient returns a client of the daemon listening on the socket at the given path
+func newClient(socket string) *client {
+	dialer := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	return &client{
+		httpClient: &http.Client{
+			Transport: &http.Transport{DialContext: dialer},
+			Timeout:   requestTimeout,
+		},
+	}
+}
+
+// do sends the request to the daemon, with in as the json body if it is not
+// nil, and decodes the json response into v
+func (c *client) do(method, path string, in, v interface{}) error {
+	var reqBody io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, apiHost+path, reqBody)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to connect to the ndm daemon, is it running with --api-socket? %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read the response of the ndm daemon: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ndm daemon returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// listDevices returns the devices on the node, as last processed by the daemon
+func (c *client) listDevices() (*controller.DeviceList, error) {
+	deviceList := &controller.DeviceList{}
+	if err := c.do(http.MethodGet, controller.DevicesPath, nil, deviceList); err != nil {
+		return nil, err
+	}
+	return deviceList, nil
+}
+
+// rescan rescans the devices on the node and returns the diff of the devices
+func (c *client) rescan() (*controller.RescanResult, error) {
+	result := &controller.RescanResult{}
+	if err := c.do(http.MethodPost, controller.RescanPath, nil, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadInventory loads the inventory of devices in the daemon running in the fake
+// probe mode, and returns the diff of the devices once they are processed
+func (c *client) loadInventory(deviceList *controller.DeviceList) (*controller.RescanResult, error) {
+	result := &controller.RescanResult{}
+	if err := c.do(http.MethodPost, controller.InventoryPath, deviceList, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// listSparseFiles returns the sparse files on the node
+func (c *client) listSparseFiles() ([]controller.SparseFile, error) {
+	sparseFiles := make([]controller.SparseFile, 0)
+	if err := c.do(http.MethodGet, controller.SparsePath, nil, &sparseFiles); err != nil {
+		return nil, err
+	}
+	return sparseFiles, nil
+}
+
+// sparse sends the request to create, resize or delete a sparse file using the
+// method, and returns the sparse file
+func (c *client) sparse(method string, req controller.SparseRequest) (*controller.SparseFile, error) {
+	sparseFile := &controller.SparseFile{}
+	if err := c.do(method, controller.SparsePath, req, sparseFile); err != nil {
+		return nil, err
+	}
+	return sparseFile, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	controllerutil "github.com/openebs/node-disk-manager/pkg/controller/util"
+	"github.com/openebs/node-disk-manager/pkg/upgrade"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testDeviceCapacity is the capacity of the devices listed by the daemon
+const testDeviceCapacity = 3<<20 + 5
+
+// newTestDevice returns a device of the node with the serial, as listed by the daemon
+func newTestDevice(devPath, uuid, serial string) blockdevice.BlockDevice {
+	device := blockdevice.BlockDevice{}
+	device.DevPath = devPath
+	device.UUID = uuid
+	device.DeviceAttributes.Serial = serial
+	device.Capacity.Storage = testDeviceCapacity
+	return device
+}
+
+// newTestBlockDevice returns an active blockdevice of the disk at the path on
+// the node. A claimed blockdevice is claimed by bdc-1.
+func newTestBlockDevice(name, node, path string, capacity uint64, claimState apis.DeviceClaimState) *apis.BlockDevice {
+	bd := &apis.BlockDevice{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openebs"}}
+	bd.Spec.NodeAttributes.NodeName = node
+	bd.Spec.Path = path
+	bd.Spec.Capacity.Storage = capacity
+	bd.Spec.Details.DriveType = "SSD"
+	bd.Spec.Details.DeviceType = "disk"
+	bd.Status.State = apis.BlockDeviceActive
+	bd.Status.ClaimState = claimState
+	if claimState == apis.BlockDeviceClaimed {
+		bd.Spec.ClaimRef = &v1.ObjectReference{Name: "bdc-1"}
+	}
+	return bd
+}
+
+// newTestClaim returns a claim bound to the blockdevice, with the finalizer
+// set by the operator
+func newTestClaim(name, bdName string) *apis.BlockDeviceClaim {
+	bdc := &apis.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openebs",
+		Finalizers: []string{controllerutil.BlockDeviceClaimFinalizer}}}
+	bdc.Spec.BlockDeviceName = bdName
+	bdc.Status.Phase = apis.BlockDeviceClaimStatusDone
+	return bdc
+}
+
+// newTestDisk returns a Disk resource of the old releases
+func newTestDisk(name, node, path string) *unstructured.Unstructured {
+	disk := &unstructured.Unstructured{}
+	disk.SetGroupVersionKind(upgrade.DiskListGVK.GroupVersion().WithKind("Disk"))
+	disk.SetName(name)
+	disk.SetLabels(map[string]string{"kubernetes.io/hostname": node})
+	_ = unstructured.SetNestedField(disk.Object, path, "spec", "path")
+	return disk
+}
+
+// newTestKubeClient returns a fake client of the resources used by the commands
+func newTestKubeClient(objects ...runtime.Object) kubeclient.Client {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{}, &apis.BlockDeviceList{},
+		&apis.BlockDeviceClaim{}, &apis.BlockDeviceClaimList{})
+	s.AddKnownTypes(v1.SchemeGroupVersion, &v1.Event{}, &v1.EventList{}, &v1.Pod{}, &v1.PodList{})
+	s.AddKnownTypes(batchv1.SchemeGroupVersion, &batchv1.Job{}, &batchv1.JobList{})
+	// the Disk resources are known to the API server only as CRs of the old releases
+	s.AddKnownTypeWithName(upgrade.DiskListGVK.GroupVersion().WithKind("Disk"), &unstructured.Unstructured{})
+	s.AddKnownTypeWithName(upgrade.DiskListGVK, &unstructured.UnstructuredList{})
+	return fake.NewFakeClientWithScheme(s, objects...)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// devicesListOutput is the format of the list of the devices
+	devicesListOutput string
+	// devicesInspectOutput is the format of the details of the device
+	devicesInspectOutput string
+)
+
+// devicesCmd represents the devices command
+var devicesCmd = &cobra.Command{
+	Use:     "devices",
+	Aliases: []string{"device", "dev"},
+	Short:   "List and inspect the devices discovered on the node",
+}
+
+// devicesListCmd represents the devices list command
+var devicesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the devices discovered on the node, including the filtered devices",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(devicesListOutput, devicesListFormats...); err != nil {
+			return err
+		}
+		deviceList, err := newClient(socket).listDevices()
+		if err != nil {
+			return err
+		}
+		return printDevices(os.Stdout, deviceList, devicesListOutput, time.Now())
+	},
+}
+
+// devicesInspectCmd represents the devices inspect command
+var devicesInspectCmd = &cobra.Command{
+	Use:   "inspect <path|blockdevice>",
+	Short: "Print all the details of a device filled by the probes, including those not set on the blockdevice",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(devicesInspectOutput, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		deviceList, err := newClient(socket).listDevices()
+		if err != nil {
+			return err
+		}
+		device, err := findDevice(deviceList, args[0])
+		if err != nil {
+			return err
+		}
+		return cli.PrintObject(os.Stdout, devicesInspectOutput, device)
+	},
+}
+
+// devicesListFormats are the formats of the list of the devices
+var devicesListFormats = []string{cli.OutputText, cli.OutputWide, cli.OutputJSON, cli.OutputYAML}
+
+func init() {
+	rootCmd.AddCommand(devicesCmd)
+	devicesCmd.AddCommand(devicesListCmd, devicesInspectCmd)
+	cli.AddOutputFlag(devicesListCmd, &devicesListOutput, devicesListFormats...)
+	cli.AddOutputFlag(devicesInspectCmd, &devicesInspectOutput, cli.OutputJSON, cli.OutputYAML)
+}
+
+// findDevice returns the device with the given device path, with or without
+// /dev/, or the given blockdevice name
+func findDevice(deviceList *controller.DeviceList, name string) (*controller.DeviceStatus, error) {
+	for i, device := range deviceList.Devices {
+		if device.Device.DevPath == name || device.Device.DevPath == "/dev/"+name ||
+			(len(device.Device.UUID) != 0 && device.Device.UUID == name) {
+			return &deviceList.Devices[i], nil
+		}
+	}
+	return nil, fmt.Errorf("device %s not found on node %s", name, deviceList.Node)
+}
+
+// printDevices prints the devices as a table, with the model, serial and wwn
+// of the devices in the wide format, or as json or yaml
+func printDevices(out io.Writer, deviceList *controller.DeviceList, output string, now time.Time) error {
+	if output == cli.OutputJSON || output == cli.OutputYAML {
+		return cli.PrintObject(out, output, deviceList)
+	}
+	if len(deviceList.Devices) == 0 {
+		_, err := fmt.Fprintf(out, "No devices found on node %s.\n", deviceList.Node)
+		return err
+	}
+	w := cli.NewTabWriter(out)
+	wide := output == cli.OutputWide
+	fmt.Fprint(w, "PATH\tBLOCKDEVICE\tTYPE\tDRIVE TYPE\tCAPACITY\tFILESYSTEM\tMOUNTPOINT\tFILTERED\tPROCESSED")
+	if wide {
+		fmt.Fprint(w, "\tMODEL\tSERIAL\tWWN")
+	}
+	fmt.Fprintln(w)
+	for _, status := range deviceList.Devices {
+		device := status.Device
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s",
+			device.DevPath,
+			cli.OrNone(device.UUID),
+			cli.OrNone(device.DeviceAttributes.DeviceType),
+			cli.OrNone(device.DeviceAttributes.DriveType),
+			cli.Capacity(device.Capacity.Storage),
+			cli.OrNone(device.FSInfo.FileSystem),
+			cli.OrNone(strings.Join(device.FSInfo.MountPoint, ",")),
+			status.Filtered,
+			cli.Age(status.ProcessedAt, now)+" ago")
+		if wide {
+			fmt.Fprintf(w, "\t%s\t%s\t%s",
+				cli.OrNone(device.DeviceAttributes.Model),
+				cli.OrNone(device.DeviceAttributes.Serial),
+				cli.OrNone(device.DeviceAttributes.WWN))
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
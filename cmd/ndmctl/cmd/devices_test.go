@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveTestAPI serves the handler on a socket in a temporary directory, and
+// returns the path of the socket
+func serveTestAPI(t *testing.T, handler http.Handler) (string, func()) {
+	dir, err := ioutil.TempDir("", "ndmctl")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "ndm.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	server := &http.Server{Handler: handler}
+	go server.Serve(l)
+	return path, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestDeviceList(processedAt time.Time) controller.DeviceList {
+	sda := blockdevice.BlockDevice{}
+	sda.DevPath = "/dev/sda"
+	sda.DeviceAttributes.DeviceType = blockdevice.BlockDeviceTypeDisk
+	sda.Capacity.Storage = 8 << 30
+	sdb := blockdevice.BlockDevice{}
+	sdb.DevPath = "/dev/sdb"
+	sdb.UUID = "blockdevice-1"
+	sdb.DeviceAttributes.DeviceType = blockdevice.BlockDeviceTypeDisk
+	sdb.DeviceAttributes.DriveType = blockdevice.DriveTypeSSD
+	sdb.Capacity.Storage = 100 << 30
+	sdb.FSInfo.FileSystem = "ext4"
+	sdb.FSInfo.MountPoint = []string{"/data"}
+	return controller.DeviceList{
+		Node: "node1",
+		Devices: []controller.DeviceStatus{
+			{Device: sda, Filtered: true, ProcessedAt: processedAt},
+			{Device: sdb, ProcessedAt: processedAt},
+		},
+	}
+}
+
+func TestListDevices(t *testing.T) {
+	processedAt := time.Now().Add(-time.Minute).UTC()
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.DevicesPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(newTestDeviceList(processedAt))
+	})
+	path, stop := serveTestAPI(t, mux)
+	defer stop()
+
+	deviceList, err := newClient(path).listDevices()
+	require.NoError(t, err)
+	assert.Equal(t, "node1", deviceList.Node)
+	assert.Len(t, deviceList.Devices, 2)
+
+	device, err := findDevice(deviceList, "sdb")
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/sdb", device.Device.DevPath)
+	device, err = findDevice(deviceList, "blockdevice-1")
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/sdb", device.Device.DevPath)
+	_, err = findDevice(deviceList, "/dev/sdc")
+	assert.EqualError(t, err, "device /dev/sdc not found on node node1")
+
+	var out strings.Builder
+	require.NoError(t, printDevices(&out, deviceList, cli.OutputText, processedAt.Add(time.Minute)))
+	assert.Equal(t, `PATH      BLOCKDEVICE    TYPE  DRIVE TYPE  CAPACITY  FILESYSTEM  MOUNTPOINT  FILTERED  PROCESSED
+/dev/sda  <none>         disk  <none>      8Gi       <none>      <none>      true      60s ago
+/dev/sdb  blockdevice-1  disk  SSD         100Gi     ext4        /data       false     60s ago
+`, out.String())
+
+	deviceList.Devices[1].Device.DeviceAttributes.Model = "Samsung SSD 860"
+	deviceList.Devices[1].Device.DeviceAttributes.Serial = "S3Z9NB0K"
+	out.Reset()
+	require.NoError(t, printDevices(&out, deviceList, cli.OutputWide, processedAt.Add(time.Minute)))
+	assert.Equal(t, `PATH      BLOCKDEVICE    TYPE  DRIVE TYPE  CAPACITY  FILESYSTEM  MOUNTPOINT  FILTERED  PROCESSED  MODEL            SERIAL    WWN
+/dev/sda  <none>         disk  <none>      8Gi       <none>      <none>      true      60s ago    <none>           <none>    <none>
+/dev/sdb  blockdevice-1  disk  SSD         100Gi     ext4        /data       false     60s ago    Samsung SSD 860  S3Z9NB0K  <none>
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, printDevices(&out, deviceList, cli.OutputYAML, processedAt.Add(time.Minute)))
+	printed := &controller.DeviceList{}
+	require.NoError(t, yaml.Unmarshal([]byte(out.String()), printed))
+	assert.Equal(t, deviceList.Devices[1].Device.DeviceAttributes, printed.Devices[1].Device.DeviceAttributes)
+}
+
+func TestClientErrors(t *testing.T) {
+	path, stop := serveTestAPI(t, http.NotFoundHandler())
+	defer stop()
+	_, err := newClient(path).listDevices()
+	assert.EqualError(t, err, "ndm daemon returned 404 Not Found: 404 page not found")
+
+	_, err = newClient(path + ".missing").listDevices()
+	assert.Error(t, err)
+}
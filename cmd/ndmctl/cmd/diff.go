@@ -0,0 +1,288 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// driftMissing is a device without an active blockdevice
+	driftMissing = "missing"
+	// driftStalePath is a blockdevice whose path is not the path of its device
+	driftStalePath = "stale-path"
+	// driftCapacity is a blockdevice whose capacity is not the capacity of its device
+	driftCapacity = "capacity"
+	// driftOrphaned is an active blockdevice whose device is missing or filtered
+	driftOrphaned = "orphaned"
+)
+
+// deviceDrift is a mismatch between a device on the node and its blockdevice
+type deviceDrift struct {
+	// Kind is the type of the mismatch
+	Kind string `json:"kind"`
+	// BlockDevice is the name of the blockdevice
+	BlockDevice string `json:"blockDevice"`
+	// DevPath is the path of the device
+	DevPath string `json:"devPath"`
+	// Recorded is the value in the blockdevice
+	Recorded string `json:"recorded"`
+	// Live is the value of the device on the node
+	Live string `json:"live"`
+}
+
+// diffReport is the diff of the devices and the blockdevices of a node,
+// printed as json or yaml
+type diffReport struct {
+	Node       string        `json:"node"`
+	Mismatches []deviceDrift `json:"mismatches"`
+	// Applied is set if the mismatches were fixed
+	Applied bool `json:"applied"`
+	// Remaining are the mismatches found after fixing them
+	Remaining []deviceDrift `json:"remaining,omitempty"`
+}
+
+// diffOptions are the options of the diff of the devices and the blockdevices
+type diffOptions struct {
+	// namespace is the namespace of the blockdevices
+	namespace string
+	// apply fixes the mismatches
+	apply bool
+	// output is the format of the mismatches
+	output string
+}
+
+var diffOpts diffOptions
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the devices on the node with their blockdevices",
+	Long: `Compare the devices on the node, as last processed by the daemon, with the blockdevices
+of the node, and print the mismatches: the devices without an active blockdevice, the
+blockdevices with a stale path or a wrong capacity, and the active blockdevices whose device
+is missing or filtered. The daemon repairs these on startup, --apply repairs them without
+restarting it, by rescanning the devices and deactivating the orphaned blockdevices`,
+	Example: `  ndmctl diff
+  ndmctl diff --apply`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(diffOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		c := newClient(socket)
+		c.httpClient.Timeout = rescanTimeout
+		return diff(c, kubeClient, diffOpts, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	diffCmd.Flags().StringVarP(&diffOpts.namespace, "namespace", "n", namespace,
+		"Namespace of the blockdevices")
+	diffCmd.Flags().BoolVar(&diffOpts.apply, "apply", false,
+		"Rescan the devices and deactivate the orphaned blockdevices to fix the mismatches")
+	cli.AddOutputFlag(diffCmd, &diffOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+}
+
+// diff prints the mismatches between the devices on the node and the
+// blockdevices, and fixes them if apply is set. In the json and yaml formats,
+// only the report is printed once the mismatches are fixed.
+func diff(c *client, kubeClient kubeclient.Client, opts diffOptions, out io.Writer) error {
+	msgOut := out
+	if opts.output == cli.OutputJSON || opts.output == cli.OutputYAML {
+		msgOut = ioutil.Discard
+	}
+	deviceList, blockDevices, err := listNodeDevices(c, kubeClient, opts.namespace)
+	if err != nil {
+		return err
+	}
+	drifts := diffBlockDevices(deviceList, blockDevices)
+	report := diffReport{Node: deviceList.Node, Mismatches: drifts}
+	if err := printDrift(msgOut, deviceList.Node, drifts); err != nil {
+		return err
+	}
+	if !opts.apply || len(drifts) == 0 {
+		return printDiffReport(out, opts.output, report)
+	}
+
+	rescan := false
+	for _, drift := range drifts {
+		if drift.Kind != driftOrphaned {
+			rescan = true
+			continue
+		}
+		bd := findBlockDevice(blockDevices, drift.BlockDevice)
+		bd.Status.State = apis.BlockDeviceInactive
+		if err := kubeClient.Update(context.TODO(), bd); err != nil {
+			return fmt.Errorf("unable to deactivate blockdevice %s: %v", bd.Name, err)
+		}
+		recordDeviceEvent(kubeClient, bd, deviceList.Node, v1.EventTypeNormal, "Deactivated",
+			fmt.Sprintf("Deactivated by ndmctl diff, device %s is %s", drift.DevPath, drift.Live))
+		fmt.Fprintf(msgOut, "blockdevice/%s deactivated\n", bd.Name)
+	}
+	if rescan {
+		result, err := c.rescan()
+		if err != nil {
+			return err
+		}
+		if err := printRescanResult(msgOut, result); err != nil {
+			return err
+		}
+	}
+
+	deviceList, blockDevices, err = listNodeDevices(c, kubeClient, opts.namespace)
+	if err != nil {
+		return err
+	}
+	report.Applied = true
+	report.Remaining = diffBlockDevices(deviceList, blockDevices)
+	fmt.Fprintln(msgOut)
+	if err := printDrift(msgOut, deviceList.Node, report.Remaining); err != nil {
+		return err
+	}
+	return printDiffReport(out, opts.output, report)
+}
+
+// printDiffReport prints the report in the json and yaml formats
+func printDiffReport(out io.Writer, output string, report diffReport) error {
+	if output != cli.OutputJSON && output != cli.OutputYAML {
+		return nil
+	}
+	return cli.PrintObject(out, output, report)
+}
+
+// listNodeDevices returns the devices processed by the daemon and the
+// blockdevices of the node, except the sparse blockdevices
+func listNodeDevices(c *client, kubeClient kubeclient.Client, namespace string) (*controller.DeviceList, []apis.BlockDevice, error) {
+	deviceList, err := c.listDevices()
+	if err != nil {
+		return nil, nil, err
+	}
+	bdList := &apis.BlockDeviceList{}
+	if err := kubeClient.List(context.TODO(), bdList, kubeclient.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("unable to list blockdevices: %v", err)
+	}
+	blockDevices := make([]apis.BlockDevice, 0, len(bdList.Items))
+	for _, bd := range bdList.Items {
+		if bd.Spec.NodeAttributes.NodeName != deviceList.Node ||
+			bd.Spec.Details.DeviceType == blockdevice.SparseBlockDeviceType {
+			continue
+		}
+		blockDevices = append(blockDevices, bd)
+	}
+	return deviceList, blockDevices, nil
+}
+
+// findBlockDevice returns the blockdevice with the name, nil if not found
+func findBlockDevice(blockDevices []apis.BlockDevice, name string) *apis.BlockDevice {
+	for i := range blockDevices {
+		if blockDevices[i].Name == name {
+			return &blockDevices[i]
+		}
+	}
+	return nil
+}
+
+// diffBlockDevices returns the mismatches between the devices and the
+// blockdevices of the node, sorted by the device path
+func diffBlockDevices(deviceList *controller.DeviceList, blockDevices []apis.BlockDevice) []deviceDrift {
+	drifts := make([]deviceDrift, 0)
+	filtered := make(map[string]string)
+	matched := make(map[string]bool)
+	for _, status := range deviceList.Devices {
+		device := status.Device
+		if len(device.UUID) == 0 {
+			continue
+		}
+		if status.Filtered {
+			filtered[device.UUID] = device.DevPath
+			continue
+		}
+		matched[device.UUID] = true
+		bd := findBlockDevice(blockDevices, device.UUID)
+		if bd == nil || bd.Status.State != apis.BlockDeviceActive {
+			recorded := cli.None
+			if bd != nil {
+				recorded = string(bd.Status.State)
+			}
+			drifts = append(drifts, deviceDrift{driftMissing, device.UUID, device.DevPath,
+				recorded, string(apis.BlockDeviceActive)})
+			continue
+		}
+		if bd.Spec.Path != device.DevPath {
+			drifts = append(drifts, deviceDrift{driftStalePath, bd.Name, device.DevPath,
+				bd.Spec.Path, device.DevPath})
+		}
+		if bd.Spec.Capacity.Storage != device.Capacity.Storage {
+			drifts = append(drifts, deviceDrift{driftCapacity, bd.Name, device.DevPath,
+				cli.Capacity(bd.Spec.Capacity.Storage), cli.Capacity(device.Capacity.Storage)})
+		}
+	}
+	for _, bd := range blockDevices {
+		if matched[bd.Name] || bd.Status.State != apis.BlockDeviceActive {
+			continue
+		}
+		live := "missing"
+		if _, ok := filtered[bd.Name]; ok {
+			live = "filtered"
+		}
+		drifts = append(drifts, deviceDrift{driftOrphaned, bd.Name, bd.Spec.Path,
+			string(apis.BlockDeviceActive), live})
+	}
+	sort.SliceStable(drifts, func(i, j int) bool {
+		return drifts[i].DevPath < drifts[j].DevPath
+	})
+	return drifts
+}
+
+// printDrift prints the mismatches as a table
+func printDrift(out io.Writer, node string, drifts []deviceDrift) error {
+	if len(drifts) == 0 {
+		_, err := fmt.Fprintf(out, "No mismatches between the devices and the blockdevices on node %s.\n", node)
+		return err
+	}
+	fmt.Fprintf(out, "%d mismatches between the devices and the blockdevices on node %s:\n", len(drifts), node)
+	w := cli.NewTabWriter(out)
+	fmt.Fprintln(w, "MISMATCH\tPATH\tBLOCKDEVICE\tRECORDED\tLIVE")
+	for _, drift := range drifts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", drift.Kind, cli.OrNone(drift.DevPath), drift.BlockDevice,
+			drift.Recorded, drift.Live)
+	}
+	return w.Flush()
+}
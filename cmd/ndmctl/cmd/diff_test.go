@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDiff(t *testing.T) {
+	devices := make([]controller.DeviceStatus, 0)
+	for _, d := range []struct {
+		path, uuid string
+		filtered   bool
+	}{
+		{"/dev/sda", "blockdevice-a", false},
+		{"/dev/sdb", "blockdevice-b", false},
+		{"/dev/sdc", "blockdevice-c", false},
+		{"/dev/sdd", "blockdevice-d", false},
+		{"/dev/sde", "blockdevice-e", true},
+		{"/dev/sdf", "blockdevice-f", false},
+	} {
+		device := blockdevice.BlockDevice{}
+		device.DevPath = d.path
+		device.UUID = d.uuid
+		device.Capacity.Storage = 1 << 30
+		devices = append(devices, controller.DeviceStatus{Device: device, Filtered: d.filtered})
+	}
+	deviceList := controller.DeviceList{Node: "node1", Devices: devices}
+
+	sparse := newTestBlockDevice("sparse-1", "node1", "/var/openebs/sparse/0-ndm-sparse.img", 1<<30,
+		apis.BlockDeviceUnclaimed)
+	sparse.Spec.Details.DeviceType = blockdevice.SparseBlockDeviceType
+	inactive := newTestBlockDevice("blockdevice-d", "node1", "/dev/sdd", 1<<30, apis.BlockDeviceUnclaimed)
+	inactive.Status.State = apis.BlockDeviceInactive
+	kubeClient := newTestKubeClient(
+		newTestBlockDevice("blockdevice-a", "node1", "/dev/sda", 1<<30, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-b", "node1", "/dev/sdx", 1<<30, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-c", "node1", "/dev/sdc", 2<<30, apis.BlockDeviceUnclaimed),
+		inactive,
+		newTestBlockDevice("blockdevice-e", "node1", "/dev/sde", 1<<30, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-g", "node1", "/dev/sdg", 1<<30, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-h", "node2", "/dev/sdh", 1<<30, apis.BlockDeviceUnclaimed),
+		sparse)
+
+	// the rescan processes the devices, like the daemon
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.DevicesPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(deviceList))
+	})
+	rescans := 0
+	mux.HandleFunc(controller.RescanPath, func(w http.ResponseWriter, r *http.Request) {
+		rescans++
+		for _, status := range deviceList.Devices {
+			if status.Filtered {
+				continue
+			}
+			bd := newTestBlockDevice(status.Device.UUID, "node1", status.Device.DevPath,
+				status.Device.Capacity.Storage, apis.BlockDeviceUnclaimed)
+			old := &apis.BlockDevice{}
+			err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: bd.Name}, old)
+			if err != nil {
+				assert.NoError(t, kubeClient.Create(context.TODO(), bd))
+				continue
+			}
+			old.Spec = bd.Spec
+			old.Status = bd.Status
+			assert.NoError(t, kubeClient.Update(context.TODO(), old))
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(controller.RescanResult{Node: "node1"}))
+	})
+	socket, stop := serveTestAPI(t, mux)
+	defer stop()
+	c := newClient(socket)
+
+	var out bytes.Buffer
+	require.NoError(t, diff(c, kubeClient, diffOptions{namespace: "openebs"}, &out))
+	assert.Equal(t, `6 mismatches between the devices and the blockdevices on node node1:
+MISMATCH    PATH      BLOCKDEVICE    RECORDED  LIVE
+stale-path  /dev/sdb  blockdevice-b  /dev/sdx  /dev/sdb
+capacity    /dev/sdc  blockdevice-c  2Gi       1Gi
+missing     /dev/sdd  blockdevice-d  Inactive  Active
+orphaned    /dev/sde  blockdevice-e  Active    filtered
+missing     /dev/sdf  blockdevice-f  <none>    Active
+orphaned    /dev/sdg  blockdevice-g  Active    missing
+`, out.String())
+	assert.Equal(t, 0, rescans)
+
+	out.Reset()
+	require.NoError(t, diff(c, kubeClient, diffOptions{namespace: "openebs", apply: true}, &out))
+	assert.Equal(t, 1, rescans)
+	assert.Contains(t, out.String(), "blockdevice/blockdevice-e deactivated\nblockdevice/blockdevice-g deactivated\n")
+	assert.Contains(t, out.String(), "\nNo mismatches between the devices and the blockdevices on node node1.\n")
+	bd := &apis.BlockDevice{}
+	require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "blockdevice-g"}, bd))
+	assert.Equal(t, apis.BlockDeviceInactive, bd.Status.State)
+
+	out.Reset()
+	require.NoError(t, diff(c, kubeClient, diffOptions{namespace: "openebs", output: cli.OutputYAML}, &out))
+	assert.Equal(t, "applied: false\nmismatches: []\nnode: node1\n", out.String())
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/filter"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+)
+
+// simulateOptions are the options of the filter simulation
+type simulateOptions struct {
+	// configFile is the ndm config having the filters to simulate
+	configFile string
+	// inventoryFile is the saved list of the devices, the devices of the node
+	// are used if not set
+	inventoryFile string
+	// output is the format of the decisions, text, json or yaml
+	output string
+}
+
+var simulateOpts simulateOptions
+
+// simulatedDecision is the decision of the filters in the config for a
+// device, along with the current decision of the daemon
+type simulatedDecision struct {
+	filter.Decision
+	BlockDevice string `json:"blockDevice,omitempty"`
+	// Changed is true if the decision is different from the current decision
+	Changed bool `json:"changed"`
+}
+
+// filtersCmd represents the filters command
+var filtersCmd = &cobra.Command{
+	Use:   "filters",
+	Short: "Review the filters of the devices",
+}
+
+// filtersSimulateCmd represents the filters simulate command
+var filtersSimulateCmd = &cobra.Command{
+	Use:   "simulate -f <config>",
+	Short: "Apply the filters of a config file on the devices, and print the decision for each device",
+	Long: `Apply the filters of a config file on the devices of the node, or on a saved list of devices,
+and print the decision for each device along with the current decision of the daemon. The
+config is not applied on the node, so that a change of the filters can be reviewed before
+it is rolled out. The os disk exclude filter uses the mounts of the node on which ndmctl is run`,
+	Example: `  ndmctl filters simulate -f node-disk-manager.config
+  ndmctl filters simulate -f node-disk-manager.config --inventory node1-devices.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return simulateFilters(newClient(socket), simulateOpts, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(filtersCmd)
+	filtersCmd.AddCommand(filtersSimulateCmd)
+	filtersSimulateCmd.Flags().StringVarP(&simulateOpts.configFile, "config", "f", "",
+		"The ndm config file having the filters to simulate")
+	filtersSimulateCmd.Flags().StringVar(&simulateOpts.inventoryFile, "inventory", "",
+		"An inventory of devices exported using ndmctl inventory export, in json or yaml")
+	cli.AddOutputFlag(filtersSimulateCmd, &simulateOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+	_ = filtersSimulateCmd.MarkFlagRequired("config")
+}
+
+// simulateFilters applies the filters of the config on the devices and prints
+// the decisions
+func simulateFilters(c *client, opts simulateOptions, out io.Writer) error {
+	if err := cli.ValidateOutput(opts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+		return err
+	}
+	ndmConfig, err := controller.ReadNDMConfigFile(opts.configFile)
+	if err != nil {
+		return err
+	}
+	var deviceList *controller.DeviceList
+	if len(opts.inventoryFile) != 0 {
+		deviceList, err = controller.ReadInventory(opts.inventoryFile)
+	} else {
+		deviceList, err = c.listDevices()
+	}
+	if err != nil {
+		return err
+	}
+
+	devices := make([]blockdevice.BlockDevice, 0, len(deviceList.Devices))
+	for _, status := range deviceList.Devices {
+		devices = append(devices, status.Device)
+	}
+	decisions := make([]simulatedDecision, 0, len(devices))
+	for i, decision := range filter.Simulate(ndmConfig, devices) {
+		status := deviceList.Devices[i]
+		decisions = append(decisions, simulatedDecision{
+			Decision:    decision,
+			BlockDevice: status.Device.UUID,
+			Changed:     decision.Included == status.Filtered,
+		})
+	}
+
+	if opts.output != cli.OutputText {
+		return cli.PrintObject(out, opts.output, decisions)
+	}
+	return printDecisions(out, deviceList.Node, decisions)
+}
+
+// printDecisions prints the decisions as a table, followed by a summary
+func printDecisions(out io.Writer, node string, decisions []simulatedDecision) error {
+	if len(decisions) == 0 {
+		_, err := fmt.Fprintf(out, "No devices found on node %s.\n", node)
+		return err
+	}
+	included, changed := 0, 0
+	w := cli.NewTabWriter(out)
+	fmt.Fprintln(w, "PATH\tDECISION\tEXCLUDED BY\tCURRENT")
+	for _, decision := range decisions {
+		current := decisionString(decision.Included != decision.Changed)
+		if decision.Changed {
+			current += " (changed)"
+			changed++
+		}
+		if decision.Included {
+			included++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			decision.DevPath,
+			decisionString(decision.Included),
+			cli.OrNone(decision.ExcludedBy),
+			current)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "\n%d included, %d excluded, %d changed on node %s\n",
+		included, len(decisions)-included, changed, node)
+	return err
+}
+
+// decisionString returns the decision of the filters as printed
+func decisionString(included bool) string {
+	if included {
+		return filter.ResultIncluded
+	}
+	return filter.ResultExcluded
+}
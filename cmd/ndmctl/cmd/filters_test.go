@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndmctl-filters")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "node-disk-manager.config")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`filterconfigs:
+  - key: os-disk-exclude-filter
+    name: os disk exclude filter
+    state: false
+    exclude: "/"
+  - key: path-filter
+    name: path filter
+    state: true
+    include: ""
+    exclude: "loop,/dev/sdc"
+`), 0600))
+	inventoryFile := filepath.Join(dir, "devices.json")
+	require.NoError(t, ioutil.WriteFile(inventoryFile, []byte(`{"node": "node1", "devices": [
+  {"device": {"DevPath": "/dev/sdb", "UUID": "blockdevice-b", "Capacity": {"Storage": 1073741824}}, "filtered": false},
+  {"device": {"DevPath": "/dev/sdc", "UUID": "blockdevice-c", "Capacity": {"Storage": 1073741824}}, "filtered": false},
+  {"device": {"DevPath": "/dev/loop0", "Capacity": {"Storage": 1073741824}}, "filtered": true}
+]}`), 0600))
+
+	var out strings.Builder
+	opts := simulateOptions{configFile: configFile, inventoryFile: inventoryFile, output: "text"}
+	require.NoError(t, simulateFilters(nil, opts, &out))
+	assert.Equal(t, `PATH        DECISION  EXCLUDED BY  CURRENT
+/dev/sdb    included  <none>       included
+/dev/sdc    excluded  path filter  included (changed)
+/dev/loop0  excluded  path filter  excluded
+
+1 included, 2 excluded, 1 changed on node node1
+`, out.String())
+
+	opts.configFile = filepath.Join(dir, "missing.config")
+	assert.Error(t, simulateFilters(nil, opts, &out))
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/openebs/node-disk-manager/pkg/seachest"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// firmwareOptions are the options of the firmware update of a device
+type firmwareOptions struct {
+	// namespace is the namespace of the blockdevices
+	namespace string
+	// image is the path of the firmware image
+	image string
+	// serial confirms the update without a prompt, if it matches the serial of the device
+	serial string
+}
+
+var firmwareOpts firmwareOptions
+
+var (
+	// downloadFirmware downloads and activates the firmware image on the device
+	// using seachest, replaced in the tests
+	downloadFirmware = func(devPath string, image []byte) error {
+		identifier := &seachest.Identifier{DevPath: devPath}
+		return identifier.DownloadFirmware(image)
+	}
+	// readFirmwareRevision reads the firmware revision from the device using
+	// seachest, replaced in the tests
+	readFirmwareRevision = func(devPath string) (string, error) {
+		identifier := &seachest.Identifier{DevPath: devPath}
+		return identifier.FirmwareRevision()
+	}
+)
+
+// firmwareCmd represents the firmware command
+var firmwareCmd = &cobra.Command{
+	Use:   "firmware",
+	Short: "Manage the firmware of the devices on the node",
+}
+
+// firmwareUpdateCmd represents the firmware update command
+var firmwareUpdateCmd = &cobra.Command{
+	Use:   "update <blockdevice|path>",
+	Short: "Update the firmware of an unclaimed and unmounted device on the node",
+	Long: `Download a firmware image to a device on the node using seachest, and activate it.
+The device must not be claimed, mounted or held by another device, and its serial has
+to be typed to confirm the update. The devices are rescanned after the update, so that
+the daemon sets the new firmware revision in the blockdevice, and the update is recorded
+as an event on the blockdevice`,
+	Example: `  ndmctl firmware update blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607 --image /tmp/fw.bin`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return updateFirmware(newClient(socket), kubeClient, args[0], firmwareOpts, os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(firmwareCmd)
+	firmwareCmd.AddCommand(firmwareUpdateCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	firmwareUpdateCmd.Flags().StringVarP(&firmwareOpts.namespace, "namespace", "n", namespace,
+		"Namespace of the blockdevices, the namespace of the ndm daemon by default")
+	firmwareUpdateCmd.Flags().StringVar(&firmwareOpts.image, "image", "",
+		"Path of the firmware image")
+	firmwareUpdateCmd.Flags().StringVar(&firmwareOpts.serial, "confirm-serial", "",
+		"Serial of the device, to confirm the update without a prompt")
+	_ = firmwareUpdateCmd.MarkFlagRequired("image")
+}
+
+// updateFirmware flashes the firmware image on the device after checking that it
+// is not in use, and that the serial typed by the user matches the device. The
+// devices are rescanned afterwards, so that the daemon updates the blockdevice.
+func updateFirmware(c *client, kubeClient kubeclient.Client, name string, opts firmwareOptions, in io.Reader, out io.Writer) error {
+	image, err := ioutil.ReadFile(opts.image)
+	if err != nil {
+		return fmt.Errorf("unable to read the firmware image: %v", err)
+	}
+	deviceList, err := c.listDevices()
+	if err != nil {
+		return err
+	}
+	device, err := findDevice(deviceList, name)
+	if err != nil {
+		return err
+	}
+	devPath := device.Device.DevPath
+	if device.Filtered {
+		return fmt.Errorf("refusing to update the firmware of %s, the device is excluded by the filters", devPath)
+	}
+
+	bd := &apis.BlockDevice{}
+	err = kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: opts.namespace, Name: device.Device.UUID}, bd)
+	if err != nil {
+		return fmt.Errorf("unable to get blockdevice %s of %s: %v", device.Device.UUID, devPath, err)
+	}
+	if err := checkNotInUse(deviceList, device, bd, "update the firmware of"); err != nil {
+		return err
+	}
+
+	oldRevision := bd.Spec.Details.FirmwareRevision
+	imageName := filepath.Base(opts.image)
+	serial := device.Device.DeviceAttributes.Serial
+	if len(serial) == 0 {
+		return fmt.Errorf("refusing to update the firmware of %s, the device has no serial to confirm the update", devPath)
+	}
+	if len(opts.serial) == 0 {
+		fmt.Fprintf(out, "The firmware of %s (%s, %s) will be updated from %s using image %s.\nType the serial of the device to confirm: ",
+			devPath, bd.Name, cli.Capacity(device.Device.Capacity.Storage), cli.OrNone(oldRevision), imageName)
+		opts.serial, _ = bufio.NewReader(in).ReadString('\n')
+		opts.serial = strings.TrimSpace(opts.serial)
+	}
+	if opts.serial != serial {
+		return fmt.Errorf("serial does not match, the firmware of %s is not updated", devPath)
+	}
+
+	fmt.Fprintf(out, "%s: downloading firmware image %s (%d bytes)\n", devPath, imageName, len(image))
+	if err := downloadFirmware(devPath, image); err != nil {
+		recordDeviceEvent(kubeClient, bd, deviceList.Node, v1.EventTypeWarning, "FirmwareUpdateFailed",
+			fmt.Sprintf("firmware update of %s using image %s failed: %v", devPath, imageName, err))
+		return err
+	}
+
+	newRevision, err := readFirmwareRevision(devPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: unable to read the new firmware revision: %v\n", devPath, err)
+	}
+	// the blockdevice is updated by the daemon when the devices are rescanned, an
+	// update by ndmctl would be overwritten by the next probe of the device
+	c.httpClient.Timeout = rescanTimeout
+	if _, err := c.rescan(); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to rescan the devices, the firmware revision of blockdevice %s is updated on the next scan: %v\n",
+			bd.Name, err)
+	}
+	recordDeviceEvent(kubeClient, bd, deviceList.Node, v1.EventTypeNormal, "FirmwareUpdated",
+		fmt.Sprintf("firmware of %s updated from %s to %s using image %s", devPath,
+			cli.OrNone(oldRevision), cli.OrNone(newRevision), imageName))
+	_, err = fmt.Fprintf(out, "%s: firmware updated from %s to %s\n", devPath, cli.OrNone(oldRevision), cli.OrNone(newRevision))
+	return err
+}
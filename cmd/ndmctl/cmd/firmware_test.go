@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestUpdateFirmware(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndmctl-firmware")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	imagePath := filepath.Join(dir, "fw.bin")
+	require.NoError(t, ioutil.WriteFile(imagePath, []byte(strings.Repeat("f", 1024)), 0600))
+
+	deviceList := controller.DeviceList{
+		Node: "node1",
+		Devices: []controller.DeviceStatus{
+			{Device: newTestDevice("/dev/sdc", "blockdevice-c", "S3")},
+			{Device: newTestDevice("/dev/sdd", "blockdevice-d", "S4")},
+			{Device: newTestDevice("/dev/sde", "blockdevice-e", "S5")},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.DevicesPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(deviceList))
+	})
+	rescans := 0
+	mux.HandleFunc(controller.RescanPath, func(w http.ResponseWriter, r *http.Request) {
+		rescans++
+		assert.NoError(t, json.NewEncoder(w).Encode(controller.RescanResult{}))
+	})
+	socket, stop := serveTestAPI(t, mux)
+	defer stop()
+
+	oldDownload, oldRead := downloadFirmware, readFirmwareRevision
+	defer func() { downloadFirmware, readFirmwareRevision = oldDownload, oldRead }()
+	downloaded := make([]string, 0)
+	downloadFirmware = func(devPath string, image []byte) error {
+		downloaded = append(downloaded, devPath)
+		if devPath == "/dev/sde" {
+			return errors.New("Cmd Failure")
+		}
+		assert.Equal(t, 1024, len(image))
+		return nil
+	}
+	readFirmwareRevision = func(devPath string) (string, error) {
+		return "FW2", nil
+	}
+
+	sdc := newTestBlockDevice("blockdevice-c", "node1", "/dev/sdc", testDeviceCapacity, apis.BlockDeviceUnclaimed)
+	sdc.Spec.Details.FirmwareRevision = "FW1"
+	kubeClient := newTestKubeClient(sdc,
+		newTestBlockDevice("blockdevice-d", "node1", "/dev/sdd", testDeviceCapacity, apis.BlockDeviceClaimed),
+		newTestBlockDevice("blockdevice-e", "node1", "/dev/sde", testDeviceCapacity, apis.BlockDeviceUnclaimed))
+	c := newClient(socket)
+	opts := firmwareOptions{namespace: "openebs", image: imagePath}
+
+	var out strings.Builder
+	err = updateFirmware(c, kubeClient, "sdd", opts, strings.NewReader("S4\n"), &out)
+	assert.EqualError(t, err, "refusing to update the firmware of /dev/sdd, blockdevice blockdevice-d is Claimed by bdc-1")
+	err = updateFirmware(c, kubeClient, "sdc", firmwareOptions{namespace: "openebs", image: filepath.Join(dir, "missing")},
+		strings.NewReader("S3\n"), &out)
+	assert.Error(t, err)
+	err = updateFirmware(c, kubeClient, "sdc", opts, strings.NewReader("S9\n"), &out)
+	assert.EqualError(t, err, "serial does not match, the firmware of /dev/sdc is not updated")
+	assert.Empty(t, downloaded)
+
+	sdeOpts := opts
+	sdeOpts.serial = "S5"
+	assert.EqualError(t, updateFirmware(c, kubeClient, "sde", sdeOpts, strings.NewReader(""), &out), "Cmd Failure")
+	assert.Equal(t, 0, rescans)
+	out.Reset()
+	require.NoError(t, updateFirmware(c, kubeClient, "blockdevice-c", opts, strings.NewReader("S3\n"), &out))
+	assert.Equal(t, []string{"/dev/sde", "/dev/sdc"}, downloaded)
+	assert.Contains(t, out.String(), "Type the serial of the device to confirm: ")
+	assert.True(t, strings.HasSuffix(out.String(), "/dev/sdc: firmware updated from FW1 to FW2\n"))
+	assert.Equal(t, 1, rescans)
+
+	// the firmware revision of the blockdevice is left to the daemon
+	bd := &apis.BlockDevice{}
+	require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "blockdevice-c"}, bd))
+	assert.Equal(t, "FW1", bd.Spec.Details.FirmwareRevision)
+
+	eventList := &v1.EventList{}
+	require.NoError(t, kubeClient.List(context.TODO(), eventList, kubeclient.InNamespace("openebs")))
+	reasons := make(map[string]string)
+	for _, event := range eventList.Items {
+		reasons[event.InvolvedObject.Name] = event.Reason + ": " + event.Message
+	}
+	assert.Equal(t, map[string]string{
+		"blockdevice-c": "FirmwareUpdated: firmware of /dev/sdc updated from FW1 to FW2 using image fw.bin",
+		"blockdevice-e": "FirmwareUpdateFailed: firmware update of /dev/sde using image fw.bin failed: Cmd Failure",
+	}, reasons)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// inventoryFile is the file to which the inventory is exported, or from
+	// which it is imported
+	inventoryFile string
+	// inventoryOutput is the format of the exported inventory, json or yaml
+	inventoryOutput string
+)
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Export and import the inventory of the devices on the node",
+}
+
+// inventoryExportCmd represents the inventory export command
+var inventoryExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the devices on the node with all the details filled by the probes",
+	Long: `Export the devices on the node as last processed by the daemon, with all the details filled
+by the probes, including the devices excluded by the filters. The inventory can be imported
+in a daemon running with --fake-probe to reproduce the discovery of the devices on another
+node, or used to review a change of the filters using ndmctl filters simulate`,
+	Example: `  ndmctl inventory export -f node1-devices.yaml -o yaml`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceList, err := newClient(socket).listDevices()
+		if err != nil {
+			return err
+		}
+		if len(inventoryFile) == 0 {
+			return exportInventory(os.Stdout, deviceList, inventoryOutput)
+		}
+		f, err := os.Create(inventoryFile)
+		if err != nil {
+			return err
+		}
+		if err := exportInventory(f, deviceList, inventoryOutput); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	},
+}
+
+// inventoryImportCmd represents the inventory import command
+var inventoryImportCmd = &cobra.Command{
+	Use:   "import -f <inventory>",
+	Short: "Load an exported inventory in a daemon running in the fake probe mode",
+	Long: `Load an inventory exported using ndmctl inventory export in a daemon running with --fake-probe.
+The devices of the inventory replace the devices discovered by the daemon, and are processed
+like the devices found by a rescan, so that the discovery of the devices on another node can
+be reproduced. The devices added, removed and updated are shown once they are processed`,
+	Example: `  ndmctl inventory import -f node1-devices.yaml`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deviceList, err := controller.ReadInventory(inventoryFile)
+		if err != nil {
+			return err
+		}
+		c := newClient(socket)
+		c.httpClient.Timeout = rescanTimeout
+		result, err := c.loadInventory(deviceList)
+		if err != nil {
+			return err
+		}
+		return printRescanResult(os.Stdout, result)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.AddCommand(inventoryExportCmd, inventoryImportCmd)
+	inventoryExportCmd.Flags().StringVarP(&inventoryFile, "file", "f", "",
+		"File to which the inventory is written, written to stdout if not set")
+	cli.AddOutputFlag(inventoryExportCmd, &inventoryOutput, cli.OutputJSON, cli.OutputYAML)
+	inventoryImportCmd.Flags().StringVarP(&inventoryFile, "file", "f", "",
+		"The inventory to import, in json or yaml")
+	_ = inventoryImportCmd.MarkFlagRequired("file")
+}
+
+// exportInventory writes the devices in the given format
+func exportInventory(out io.Writer, deviceList *controller.DeviceList, format string) error {
+	if err := cli.ValidateOutput(format, cli.OutputJSON, cli.OutputYAML); err != nil {
+		return err
+	}
+	return cli.PrintObject(out, format, deviceList)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndmctl-inventory")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sdb := newTestDevice("/dev/sdb", "blockdevice-b", "S2")
+	sdb.SMARTInfo.FailureIndicators = map[string]uint64{"reallocated_sectors": 8}
+	deviceList := &controller.DeviceList{
+		Node:    "node1",
+		Devices: []controller.DeviceStatus{{Device: sdb}, {Device: newTestDevice("/dev/sda", "", "S1"), Filtered: true}},
+	}
+
+	// the exported inventory is imported as is, in both the formats
+	for _, format := range []string{"json", "yaml"} {
+		var out strings.Builder
+		require.NoError(t, exportInventory(&out, deviceList, format))
+		path := filepath.Join(dir, "devices."+format)
+		require.NoError(t, ioutil.WriteFile(path, []byte(out.String()), 0600))
+		imported, err := controller.ReadInventory(path)
+		require.NoError(t, err)
+		assert.Equal(t, deviceList.Node, imported.Node)
+		require.Len(t, imported.Devices, 2)
+		assert.Equal(t, deviceList.Devices[0].Device, imported.Devices[0].Device)
+		assert.True(t, imported.Devices[1].Filtered)
+	}
+
+	assert.EqualError(t, exportInventory(ioutil.Discard, deviceList, "wide"),
+		"unknown output format wide, must be json or yaml")
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/openebs/node-disk-manager/pkg/upgrade"
+	"github.com/spf13/cobra"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// migrateOptions are the options of the migration
+type migrateOptions struct {
+	// namespace is the namespace of the blockdevices and the claims
+	namespace string
+	// dryRun only prints the changes
+	dryRun bool
+	// apply makes the changes
+	apply bool
+	// output is the format of the mappings and the changes
+	output string
+}
+
+// migrateReport is the mapping of the disks and the changes of the upgrade,
+// printed as json or yaml
+type migrateReport struct {
+	Disks   []upgrade.DiskMapping `json:"disks"`
+	Changes []string              `json:"changes"`
+	// Applied is set if the changes were made
+	Applied bool `json:"applied"`
+}
+
+var migrateOpts = migrateOptions{dryRun: true}
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Preview and apply the migration of the resources of old NDM releases",
+	Long: `Print the blockdevices which replace the Disk resources created by the NDM releases before 0.4,
+with the claims of the blockdevices, and the changes the upgrade makes to the blockdeviceclaims
+created by the older releases. The ndm-operator makes the same changes on startup, --apply makes
+them without restarting the operator. The Disk resources are not modified, they can be deleted
+once the blockdevices replacing them are found`,
+	Example: `  ndmctl migrate --dry-run
+  ndmctl migrate --apply`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if migrateOpts.apply && cmd.Flags().Changed("dry-run") && migrateOpts.dryRun {
+			return fmt.Errorf("--dry-run and --apply cannot be used together")
+		}
+		if err := cli.ValidateOutput(migrateOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return migrate(kubeClient, migrateOpts, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	migrateCmd.Flags().StringVarP(&migrateOpts.namespace, "namespace", "n", namespace,
+		"Namespace of the blockdevices and the blockdeviceclaims")
+	migrateCmd.Flags().BoolVar(&migrateOpts.dryRun, "dry-run", migrateOpts.dryRun,
+		"Only print the changes, the default")
+	migrateCmd.Flags().BoolVar(&migrateOpts.apply, "apply", false,
+		"Make the changes to the blockdeviceclaims")
+	cli.AddOutputFlag(migrateCmd, &migrateOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+}
+
+// migrate prints the mapping of the disks to the blockdevices and the changes
+// of the upgrade, and makes the changes if apply is set. In the json and yaml
+// formats, a report is printed once the changes are made.
+func migrate(kubeClient kubeclient.Client, opts migrateOptions, out io.Writer) error {
+	msgOut := out
+	if opts.output == cli.OutputJSON || opts.output == cli.OutputYAML {
+		msgOut = ioutil.Discard
+	}
+	mappings, err := upgrade.MapDisks(kubeClient, opts.namespace)
+	if err != nil {
+		return fmt.Errorf("unable to map the disks to the blockdevices: %v", err)
+	}
+	if len(mappings) == 0 {
+		fmt.Fprintln(msgOut, "No Disk resources found")
+	} else {
+		w := cli.NewTabWriter(msgOut)
+		fmt.Fprintln(w, "DISK\tNODE\tPATH\tBLOCKDEVICE\tCLAIM")
+		for _, m := range mappings {
+			bd := m.BlockDevice
+			if !m.Found {
+				bd += " (not found)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Disk, cli.OrNone(m.NodeName), cli.OrNone(m.Path),
+				bd, cli.OrNone(m.Claim))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	tasks := upgrade.Tasks(kubeClient)
+	changes, err := upgrade.PlanUpgrade(tasks...)
+	if err != nil {
+		return err
+	}
+	report := migrateReport{
+		Disks:   append([]upgrade.DiskMapping{}, mappings...),
+		Changes: append([]string{}, changes...),
+	}
+	fmt.Fprintln(msgOut)
+	if len(changes) == 0 {
+		fmt.Fprintln(msgOut, "No blockdeviceclaims to upgrade")
+		return printMigrateReport(out, opts.output, report)
+	}
+	fmt.Fprintln(msgOut, "Changes:")
+	for _, change := range changes {
+		fmt.Fprintf(msgOut, "  %s\n", change)
+	}
+
+	if !opts.apply {
+		fmt.Fprintf(msgOut, "\nDry run, %d changes not made. Run with --apply to make them\n", len(changes))
+		return printMigrateReport(out, opts.output, report)
+	}
+	if err := upgrade.RunUpgrade(tasks...); err != nil {
+		return err
+	}
+	report.Applied = true
+	fmt.Fprintf(msgOut, "\nMade %d changes\n", len(changes))
+	return printMigrateReport(out, opts.output, report)
+}
+
+// printMigrateReport prints the report in the json and yaml formats
+func printMigrateReport(out io.Writer, output string, report migrateReport) error {
+	if output != cli.OutputJSON && output != cli.OutputYAML {
+		return nil
+	}
+	return cli.PrintObject(out, output, report)
+}
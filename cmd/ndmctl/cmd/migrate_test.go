@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestMigrate(t *testing.T) {
+	bd := newTestBlockDevice("blockdevice-a", "node1", "/dev/sdb", 1<<30, apis.BlockDeviceClaimed)
+	bd.Spec.ClaimRef.Name = "bdc-a"
+	bdc := &apis.BlockDeviceClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "bdc-a", Namespace: "openebs",
+			Finalizers: []string{"blockdeviceclaim.finalizer"},
+		},
+		Spec: apis.DeviceClaimSpec{BlockDeviceName: "blockdevice-a", HostName: "node1"},
+	}
+	kubeClient := newTestKubeClient(bd, bdc,
+		newTestDisk("disk-b", "node2", "/dev/sdc"),
+		newTestDisk("disk-a", "node1", "/dev/sdb"))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, migrate(kubeClient, migrateOptions{namespace: "openebs", dryRun: true}, out))
+	assert.Equal(t, `DISK    NODE   PATH      BLOCKDEVICE                CLAIM
+disk-a  node1  /dev/sdb  blockdevice-a              openebs/bdc-a
+disk-b  node2  /dev/sdc  blockdevice-b (not found)  <none>
+
+Changes:
+  BlockDeviceClaim openebs/bdc-a: rename finalizer blockdeviceclaim.finalizer to openebs.io/bdc-protection
+  BlockDeviceClaim openebs/bdc-a: copy .spec.hostName node1 to .spec.blockDeviceNodeAttributes.hostName
+
+Dry run, 2 changes not made. Run with --apply to make them
+`, out.String())
+	got := &apis.BlockDeviceClaim{}
+	require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "bdc-a"}, got))
+	assert.Equal(t, []string{"blockdeviceclaim.finalizer"}, got.Finalizers)
+
+	out.Reset()
+	require.NoError(t, migrate(kubeClient, migrateOptions{namespace: "openebs", apply: true}, out))
+	assert.Contains(t, out.String(), "Made 2 changes\n")
+	require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "bdc-a"}, got))
+	assert.Equal(t, []string{"openebs.io/bdc-protection"}, got.Finalizers)
+	assert.Equal(t, "node1", got.Spec.BlockDeviceNodeAttributes.HostName)
+
+	out.Reset()
+	require.NoError(t, migrate(kubeClient, migrateOptions{namespace: "openebs", dryRun: true}, out))
+	assert.Contains(t, out.String(), "No blockdeviceclaims to upgrade\n")
+
+	out.Reset()
+	require.NoError(t, migrate(kubeClient, migrateOptions{namespace: "openebs", dryRun: true, output: cli.OutputYAML}, out))
+	assert.Equal(t, `applied: false
+changes: []
+disks:
+- blockDevice: blockdevice-a
+  claim: openebs/bdc-a
+  disk: disk-a
+  found: true
+  nodeName: node1
+  path: /dev/sdb
+- blockDevice: blockdevice-b
+  disk: disk-b
+  found: false
+  nodeName: node2
+  path: /dev/sdc
+`, out.String())
+}
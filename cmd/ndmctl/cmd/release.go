@@ -0,0 +1,310 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cleaner"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	controllerutil "github.com/openebs/node-disk-manager/pkg/controller/util"
+	"github.com/openebs/node-disk-manager/pkg/util"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReleaseReasonAnnotation is the reason of the last release of the blockdevice
+// using ndmctl claim release
+const ReleaseReasonAnnotation = "ndm.io/release-reason"
+
+// releaseOptions are the options of the release of a claim
+type releaseOptions struct {
+	// namespace is the namespace of the claims and blockdevices
+	namespace string
+	// skipCleanup marks the released blockdevice as unclaimed without the cleanup
+	skipCleanup bool
+	// force deletes the claim if it is not being deleted, and removes the
+	// finalizers of its owners
+	force bool
+	// reason is the reason of the release, recorded on the blockdevice
+	reason string
+}
+
+var releaseOpts releaseOptions
+
+// claimReleaseCmd represents the claim release command
+var claimReleaseCmd = &cobra.Command{
+	Use:   "release <blockdeviceclaim|blockdevice>",
+	Short: "Release a claim which is stuck in deletion or cleanup",
+	Long: `Release a blockdeviceclaim which is stuck, in the order used by the operator. The
+blockdevice of the claim is released first, and then the finalizers of the claim are removed.
+A blockdevice whose claim is already removed can be given, if it is stuck in the cleanup.
+
+By default, a cleanup job which does not complete is deleted, so that the operator runs the
+cleanup again. --skip-cleanup marks the blockdevice as unclaimed without the cleanup, leaving
+the data on the device. --force deletes a claim which is not being deleted, removes the
+finalizers added by the owners of the claim, and releases a blockdevice whose claim does not
+exist. The reason is recorded on the blockdevice and in the events`,
+	Example: `  ndmctl claim release bdc-q4t8z2mw --reason "cleanup job stuck on a failed node"
+  ndmctl claim release blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607 --skip-cleanup --reason "disk replaced"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return releaseClaim(kubeClient, args[0], releaseOpts, os.Stdout)
+	},
+}
+
+func init() {
+	claimCmd.AddCommand(claimReleaseCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	claimReleaseCmd.Flags().StringVarP(&releaseOpts.namespace, "namespace", "n", namespace,
+		"Namespace of the claims, the namespace of the ndm daemon by default")
+	claimReleaseCmd.Flags().BoolVar(&releaseOpts.skipCleanup, "skip-cleanup", false,
+		"Mark the blockdevice as unclaimed without the cleanup, leaving the data on the device")
+	claimReleaseCmd.Flags().BoolVar(&releaseOpts.force, "force", false,
+		"Delete the claim if it is not being deleted and remove the finalizers of its owners")
+	claimReleaseCmd.Flags().StringVar(&releaseOpts.reason, "reason", "",
+		"Reason of the release, recorded on the blockdevice")
+	_ = claimReleaseCmd.MarkFlagRequired("reason")
+}
+
+// releaseClaim releases the claim with the name and its blockdevice, or the
+// blockdevice with the name if the claim is not found, and unwinds the cleanup
+// of the released blockdevice
+func releaseClaim(kubeClient kubeclient.Client, name string, opts releaseOptions, out io.Writer) error {
+	bdc := &apis.BlockDeviceClaim{}
+	err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: opts.namespace, Name: name}, bdc)
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to get blockdeviceclaim %s: %v", name, err)
+	}
+
+	var bd *apis.BlockDevice
+	if err == nil {
+		bd, err = releaseClaimedDevice(kubeClient, bdc, opts, out)
+	} else {
+		bd, err = releaseOrphanedDevice(kubeClient, name, opts, out)
+	}
+	if err != nil || bd == nil {
+		return err
+	}
+	return unwindCleanup(kubeClient, bd, opts, out)
+}
+
+// releaseClaimedDevice releases the blockdevice of the claim, and then removes
+// the finalizers of the claim. The blockdevice is returned, if it exists.
+func releaseClaimedDevice(kubeClient kubeclient.Client, bdc *apis.BlockDeviceClaim, opts releaseOptions, out io.Writer) (*apis.BlockDevice, error) {
+	var ownerFinalizers []string
+	for _, finalizer := range bdc.Finalizers {
+		if finalizer != controllerutil.BlockDeviceClaimFinalizer {
+			ownerFinalizers = append(ownerFinalizers, finalizer)
+		}
+	}
+	if !opts.force {
+		if bdc.DeletionTimestamp.IsZero() {
+			return nil, fmt.Errorf("blockdeviceclaim %s is not being deleted, delete it or use --force", bdc.Name)
+		}
+		if len(ownerFinalizers) != 0 {
+			return nil, fmt.Errorf("blockdeviceclaim %s is waiting for the finalizers of its owners: %s, use --force to remove them",
+				bdc.Name, strings.Join(ownerFinalizers, ", "))
+		}
+	}
+	if bdc.DeletionTimestamp.IsZero() {
+		if err := kubeClient.Delete(context.TODO(), bdc); err != nil {
+			return nil, fmt.Errorf("unable to delete blockdeviceclaim %s: %v", bdc.Name, err)
+		}
+		fmt.Fprintf(out, "blockdeviceclaim/%s deleted\n", bdc.Name)
+	}
+
+	var bd *apis.BlockDevice
+	if len(bdc.Spec.BlockDeviceName) != 0 {
+		bd = &apis.BlockDevice{}
+		err := kubeClient.Get(context.TODO(),
+			kubeclient.ObjectKey{Namespace: bdc.Namespace, Name: bdc.Spec.BlockDeviceName}, bd)
+		if errors.IsNotFound(err) {
+			fmt.Fprintf(out, "blockdevice %s of blockdeviceclaim %s not found\n", bdc.Spec.BlockDeviceName, bdc.Name)
+			bd = nil
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to get blockdevice %s: %v", bdc.Spec.BlockDeviceName, err)
+		}
+	}
+	if bd != nil && bd.Status.ClaimState == apis.BlockDeviceClaimed &&
+		bd.Spec.ClaimRef != nil && bd.Spec.ClaimRef.Name == bdc.Name {
+		if err := releaseDevice(kubeClient, bd, opts); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "blockdevice/%s released from blockdeviceclaim %s\n", bd.Name, bdc.Name)
+	}
+
+	// the finalizers are removed only after the blockdevice is released, so that
+	// the blockdevice is not left claimed by a claim which does not exist
+	err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: bdc.Namespace, Name: bdc.Name}, bdc)
+	if errors.IsNotFound(err) {
+		return bd, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get blockdeviceclaim %s: %v", bdc.Name, err)
+	}
+	if len(bdc.Finalizers) != 0 {
+		finalizers := strings.Join(bdc.Finalizers, ", ")
+		bdc.Finalizers = nil
+		if err := kubeClient.Update(context.TODO(), bdc); err != nil {
+			return nil, fmt.Errorf("unable to remove the finalizers of blockdeviceclaim %s: %v", bdc.Name, err)
+		}
+		recordEvent(kubeClient, "BlockDeviceClaim", bdc, "", v1.EventTypeWarning, "FinalizersRemoved",
+			fmt.Sprintf("Finalizers %s removed using ndmctl claim release: %s", finalizers, opts.reason))
+		fmt.Fprintf(out, "blockdeviceclaim/%s finalizers removed: %s\n", bdc.Name, finalizers)
+	}
+	return bd, nil
+}
+
+// releaseOrphanedDevice gets the blockdevice with the name, whose claim is already
+// removed. A blockdevice which is still claimed by a claim which does not exist is
+// released only if forced.
+func releaseOrphanedDevice(kubeClient kubeclient.Client, name string, opts releaseOptions, out io.Writer) (*apis.BlockDevice, error) {
+	bd := &apis.BlockDevice{}
+	err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: opts.namespace, Name: name}, bd)
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("blockdeviceclaim or blockdevice %s not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get blockdevice %s: %v", name, err)
+	}
+
+	switch bd.Status.ClaimState {
+	case apis.BlockDeviceReleased:
+		return bd, nil
+	case apis.BlockDeviceClaimed:
+		claimName := "<none>"
+		if bd.Spec.ClaimRef != nil {
+			claimName = bd.Spec.ClaimRef.Name
+			namespace := bd.Spec.ClaimRef.Namespace
+			if len(namespace) == 0 {
+				namespace = bd.Namespace
+			}
+			err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: namespace, Name: claimName},
+				&apis.BlockDeviceClaim{})
+			if err == nil {
+				return nil, fmt.Errorf("blockdevice %s is claimed by blockdeviceclaim %s, release the claim instead",
+					bd.Name, claimName)
+			}
+			if !errors.IsNotFound(err) {
+				return nil, fmt.Errorf("unable to get blockdeviceclaim %s: %v", claimName, err)
+			}
+		}
+		if !opts.force {
+			return nil, fmt.Errorf("blockdevice %s is claimed by blockdeviceclaim %s which does not exist, use --force to release it",
+				bd.Name, claimName)
+		}
+		if err := releaseDevice(kubeClient, bd, opts); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "blockdevice/%s released from blockdeviceclaim %s\n", bd.Name, claimName)
+		return bd, nil
+	default:
+		return nil, fmt.Errorf("blockdevice %s is not claimed", bd.Name)
+	}
+}
+
+// releaseDevice clears the claim of the blockdevice and marks it as released,
+// like the operator does when the claim is deleted
+func releaseDevice(kubeClient kubeclient.Client, bd *apis.BlockDevice, opts releaseOptions) error {
+	claimName := ""
+	if bd.Spec.ClaimRef != nil {
+		claimName = bd.Spec.ClaimRef.Name
+	}
+	bd.Spec.ClaimRef = nil
+	bd.Status.ClaimState = apis.BlockDeviceReleased
+	setReleaseReason(bd, opts.reason)
+	if err := kubeClient.Update(context.TODO(), bd); err != nil {
+		return fmt.Errorf("unable to release blockdevice %s: %v", bd.Name, err)
+	}
+	recordDeviceEvent(kubeClient, bd, bd.Spec.NodeAttributes.NodeName, v1.EventTypeWarning, "BlockDeviceReleased",
+		fmt.Sprintf("Released from blockdeviceclaim %s using ndmctl claim release: %s", claimName, opts.reason))
+	return nil
+}
+
+// unwindCleanup unwinds the cleanup of a released blockdevice. The blockdevice is
+// marked as unclaimed without the cleanup if skipped, else a cleanup job which did
+// not complete is deleted so that the operator runs the cleanup again. The failed
+// attempts of the cleanup are cleared, so that it is retried even if it had failed.
+func unwindCleanup(kubeClient kubeclient.Client, bd *apis.BlockDevice, opts releaseOptions, out io.Writer) error {
+	if bd.Status.ClaimState != apis.BlockDeviceReleased {
+		return nil
+	}
+	jobController := cleaner.NewJobController(kubeClient, opts.namespace)
+	jobName := cleaner.JobNamePrefix + bd.Name
+	failure, err := jobController.GetFailure(bd.Name, nil)
+	if err != nil {
+		return fmt.Errorf("unable to get cleanup job %s: %v", jobName, err)
+	}
+	jobRunning := jobController.IsCleaningJobRunning(bd.Name) || len(failure) != 0
+	if jobRunning {
+		if err := jobController.CancelJob(bd.Name); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete cleanup job %s: %v", jobName, err)
+		}
+		fmt.Fprintf(out, "job/%s deleted\n", jobName)
+	}
+
+	if opts.skipCleanup {
+		bd.Finalizers = util.RemoveString(bd.Finalizers, controllerutil.BlockDeviceFinalizer)
+		bd.Status.ClaimState = apis.BlockDeviceUnclaimed
+		cleaner.ClearClaimPolicy(bd)
+		bd.Status.RemoveCondition(apis.BlockDeviceCleanupFailed)
+	}
+	cleaner.ClearRetry(bd)
+	// the blockdevice is updated even if the cleanup is not skipped, so that the
+	// operator reconciles it and starts a new cleanup job
+	setReleaseReason(bd, opts.reason)
+	if err := kubeClient.Update(context.TODO(), bd); err != nil {
+		return fmt.Errorf("unable to update blockdevice %s: %v", bd.Name, err)
+	}
+
+	switch {
+	case opts.skipCleanup:
+		recordDeviceEvent(kubeClient, bd, bd.Spec.NodeAttributes.NodeName, v1.EventTypeWarning, "BlockDeviceCleanupSkipped",
+			fmt.Sprintf("Marked as Unclaimed without cleanup using ndmctl claim release: %s", opts.reason))
+		_, err = fmt.Fprintf(out, "blockdevice/%s marked as Unclaimed without cleanup, the data on the device is not wiped\n", bd.Name)
+	case jobRunning:
+		recordDeviceEvent(kubeClient, bd, bd.Spec.NodeAttributes.NodeName, v1.EventTypeWarning, "BlockDeviceCleanupRestarted",
+			fmt.Sprintf("Cleanup job %s deleted using ndmctl claim release: %s", jobName, opts.reason))
+		_, err = fmt.Fprintf(out, "blockdevice/%s is released, the cleanup is run again by the operator\n", bd.Name)
+	default:
+		_, err = fmt.Fprintf(out, "blockdevice/%s is released, the cleanup is run by the operator\n", bd.Name)
+	}
+	return err
+}
+
+// setReleaseReason records the reason of the release on the blockdevice
+func setReleaseReason(bd *apis.BlockDevice, reason string) {
+	if bd.Annotations == nil {
+		bd.Annotations = make(map[string]string)
+	}
+	bd.Annotations[ReleaseReasonAnnotation] = reason
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cleaner"
+	controllerutil "github.com/openebs/node-disk-manager/pkg/controller/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newReleaseTestJob(bdName string) *batchv1.Job {
+	return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-" + bdName, Namespace: "openebs"}}
+}
+
+func TestReleaseClaim(t *testing.T) {
+	now := metav1.Now()
+	// bdc-1 is deleted by its owner, but the cleanup job of its blockdevice is stuck
+	bdc1 := newTestClaim("bdc-1", "blockdevice-a")
+	bdc1.DeletionTimestamp = &now
+	bdA := newTestBlockDevice("blockdevice-a", "", "", 0, apis.BlockDeviceClaimed)
+	// bdc-2 is bound and in use
+	bdB := newTestBlockDevice("blockdevice-b", "", "", 0, apis.BlockDeviceClaimed)
+	bdB.Spec.ClaimRef.Name = "bdc-2"
+	// bdc-3 is waiting for the finalizer of its owner
+	bdc3 := newTestClaim("bdc-3", "blockdevice-c")
+	bdc3.DeletionTimestamp = &now
+	bdc3.Finalizers = append([]string{"cstor.openebs.io/finalizer"}, bdc3.Finalizers...)
+	bdC := newTestBlockDevice("blockdevice-c", "", "", 0, apis.BlockDeviceClaimed)
+	bdC.Spec.ClaimRef.Name = "bdc-3"
+	// blockdevice-d is claimed by a claim which does not exist
+	bdD := newTestBlockDevice("blockdevice-d", "", "", 0, apis.BlockDeviceClaimed)
+	bdD.Spec.ClaimRef.Name = "bdc-4"
+	// bdc-5 is of a blockdevice which does not exist
+	bdc5 := newTestClaim("bdc-5", "blockdevice-x")
+	bdc5.DeletionTimestamp = &now
+	bdE := newTestBlockDevice("blockdevice-e", "", "", 0, apis.BlockDeviceUnclaimed)
+	for _, bd := range []*apis.BlockDevice{bdA, bdB, bdC, bdD, bdE} {
+		bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	}
+	kubeClient := newTestKubeClient(bdc1, bdA, newReleaseTestJob("blockdevice-a"),
+		newTestClaim("bdc-2", "blockdevice-b"), bdB, bdc3, bdC, bdD, bdc5, bdE)
+	getBlockDevice := func(name string) *apis.BlockDevice {
+		bd := &apis.BlockDevice{}
+		require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: name}, bd))
+		return bd
+	}
+	getClaim := func(name string) (*apis.BlockDeviceClaim, error) {
+		bdc := &apis.BlockDeviceClaim{}
+		err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: name}, bdc)
+		return bdc, err
+	}
+	opts := releaseOptions{namespace: "openebs", reason: "cleanup stuck"}
+
+	// the blockdevice is released before the finalizer of the claim is removed,
+	// and the stuck cleanup job is deleted so that it is run again
+	var out bytes.Buffer
+	require.NoError(t, releaseClaim(kubeClient, "bdc-1", opts, &out))
+	assert.Equal(t, `blockdevice/blockdevice-a released from blockdeviceclaim bdc-1
+blockdeviceclaim/bdc-1 finalizers removed: openebs.io/bdc-protection
+job/cleanup-blockdevice-a deleted
+blockdevice/blockdevice-a is released, the cleanup is run again by the operator
+`, out.String())
+	bdc, err := getClaim("bdc-1")
+	require.NoError(t, err)
+	assert.Empty(t, bdc.Finalizers)
+	bd := getBlockDevice("blockdevice-a")
+	assert.Nil(t, bd.Spec.ClaimRef)
+	assert.Equal(t, apis.BlockDeviceReleased, bd.Status.ClaimState)
+	assert.Equal(t, []string{controllerutil.BlockDeviceFinalizer}, bd.Finalizers)
+	assert.Equal(t, "cleanup stuck", bd.Annotations[ReleaseReasonAnnotation])
+	err = kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "cleanup-blockdevice-a"},
+		&batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// the released blockdevice is marked as unclaimed when the cleanup is skipped
+	out.Reset()
+	opts.skipCleanup = true
+	require.NoError(t, releaseClaim(kubeClient, "blockdevice-a", opts, &out))
+	assert.Equal(t, "blockdevice/blockdevice-a marked as Unclaimed without cleanup, the data on the device is not wiped\n",
+		out.String())
+	bd = getBlockDevice("blockdevice-a")
+	assert.Equal(t, apis.BlockDeviceUnclaimed, bd.Status.ClaimState)
+	assert.Empty(t, bd.Finalizers)
+	assert.EqualError(t, releaseClaim(kubeClient, "blockdevice-a", opts, &out), "blockdevice blockdevice-a is not claimed")
+	opts.skipCleanup = false
+
+	// the claims in use and the finalizers of the owners are released only if forced
+	assert.EqualError(t, releaseClaim(kubeClient, "bdc-2", opts, &out),
+		"blockdeviceclaim bdc-2 is not being deleted, delete it or use --force")
+	assert.EqualError(t, releaseClaim(kubeClient, "bdc-3", opts, &out),
+		"blockdeviceclaim bdc-3 is waiting for the finalizers of its owners: cstor.openebs.io/finalizer, use --force to remove them")
+	assert.EqualError(t, releaseClaim(kubeClient, "blockdevice-b", opts, &out),
+		"blockdevice blockdevice-b is claimed by blockdeviceclaim bdc-2, release the claim instead")
+	assert.EqualError(t, releaseClaim(kubeClient, "blockdevice-d", opts, &out),
+		"blockdevice blockdevice-d is claimed by blockdeviceclaim bdc-4 which does not exist, use --force to release it")
+	assert.EqualError(t, releaseClaim(kubeClient, "bdc-x", opts, &out), "blockdeviceclaim or blockdevice bdc-x not found")
+	assert.Equal(t, apis.BlockDeviceClaimed, getBlockDevice("blockdevice-b").Status.ClaimState)
+	assert.Equal(t, apis.BlockDeviceClaimed, getBlockDevice("blockdevice-c").Status.ClaimState)
+
+	opts.force = true
+	out.Reset()
+	require.NoError(t, releaseClaim(kubeClient, "bdc-3", opts, &out))
+	assert.Equal(t, `blockdevice/blockdevice-c released from blockdeviceclaim bdc-3
+blockdeviceclaim/bdc-3 finalizers removed: cstor.openebs.io/finalizer, openebs.io/bdc-protection
+blockdevice/blockdevice-c is released, the cleanup is run by the operator
+`, out.String())
+	out.Reset()
+	require.NoError(t, releaseClaim(kubeClient, "bdc-2", opts, &out))
+	assert.Equal(t, `blockdeviceclaim/bdc-2 deleted
+blockdevice/blockdevice-b released from blockdeviceclaim bdc-2
+blockdevice/blockdevice-b is released, the cleanup is run by the operator
+`, out.String())
+	_, err = getClaim("bdc-2")
+	assert.True(t, errors.IsNotFound(err))
+	out.Reset()
+	require.NoError(t, releaseClaim(kubeClient, "blockdevice-d", opts, &out))
+	assert.Equal(t, apis.BlockDeviceReleased, getBlockDevice("blockdevice-d").Status.ClaimState)
+
+	// the finalizer of a claim whose blockdevice does not exist is removed
+	out.Reset()
+	require.NoError(t, releaseClaim(kubeClient, "bdc-5", opts, &out))
+	assert.Equal(t, `blockdevice blockdevice-x of blockdeviceclaim bdc-5 not found
+blockdeviceclaim/bdc-5 finalizers removed: openebs.io/bdc-protection
+`, out.String())
+
+	// the reason is recorded in the events
+	events := &v1.EventList{}
+	require.NoError(t, kubeClient.List(context.TODO(), events))
+	reasons := make(map[string]int)
+	for _, event := range events.Items {
+		reasons[event.Reason]++
+		assert.Contains(t, event.Message, "cleanup stuck")
+	}
+	assert.Equal(t, map[string]int{
+		"BlockDeviceReleased":         4,
+		"BlockDeviceCleanupRestarted": 1,
+		"BlockDeviceCleanupSkipped":   1,
+		"FinalizersRemoved":           3,
+	}, reasons)
+}
+
+func TestReleaseFailedCleanup(t *testing.T) {
+	// all the attempts of the cleanup of blockdevice-a have failed
+	bd := newTestBlockDevice("blockdevice-a", "", "", 0, apis.BlockDeviceReleased)
+	bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	bd.Annotations = map[string]string{cleaner.RetryAnnotation: `{"failures":4,"retryAfter":"2021-01-01T00:00:00Z"}`}
+	bd.Status.SetCondition(apis.BlockDeviceCondition{Type: apis.BlockDeviceCleanupFailed, Status: v1.ConditionTrue})
+	job := newReleaseTestJob("blockdevice-a")
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue}}
+	kubeClient := newTestKubeClient(bd, job)
+	opts := releaseOptions{namespace: "openebs", reason: "replaced the cable"}
+
+	// the failed job is deleted, and the cleanup is retried
+	var out bytes.Buffer
+	require.NoError(t, releaseClaim(kubeClient, "blockdevice-a", opts, &out))
+	assert.Equal(t, `job/cleanup-blockdevice-a deleted
+blockdevice/blockdevice-a is released, the cleanup is run again by the operator
+`, out.String())
+	bd = &apis.BlockDevice{}
+	require.NoError(t, kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "blockdevice-a"}, bd))
+	assert.NotContains(t, bd.Annotations, cleaner.RetryAnnotation)
+	err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: "openebs", Name: "cleanup-blockdevice-a"},
+		&batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err))
+}
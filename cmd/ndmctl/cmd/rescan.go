@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	// rescanNode is the node on which the rescan is requested using the API server
+	rescanNode string
+	// rescanTimeout is the max time to wait for the result of the rescan
+	rescanTimeout = 3 * time.Minute
+	// rescanPollInterval is the interval at which the node is checked for the result
+	rescanPollInterval = 2 * time.Second
+	// rescanOutput is the format of the result of the rescan
+	rescanOutput string
+)
+
+// rescanCmd represents the rescan command
+var rescanCmd = &cobra.Command{
+	Use:   "rescan",
+	Short: "Rescan the devices on the node and show the devices added, removed and updated",
+	Long: `Triggers a scan of all the devices on the node by the ndm daemon, instead of
+restarting the daemon, and shows the diff of the devices once they are processed.
+With --node, the rescan is requested on the node using the API server, and the daemon
+on the node picks up the request within 10s`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(rescanOutput, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		var result *controller.RescanResult
+		var err error
+		if len(rescanNode) == 0 {
+			c := newClient(socket)
+			c.httpClient.Timeout = rescanTimeout
+			result, err = c.rescan()
+		} else {
+			var kubeClient kubeclient.Client
+			kubeClient, err = cli.NewKubeClient()
+			if err != nil {
+				return err
+			}
+			result, err = requestRescan(kubeClient, rescanNode)
+		}
+		if err != nil {
+			return err
+		}
+		if rescanOutput != cli.OutputText {
+			return cli.PrintObject(os.Stdout, rescanOutput, result)
+		}
+		return printRescanResult(os.Stdout, result)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rescanCmd)
+	rescanCmd.Flags().StringVar(&rescanNode, "node", "",
+		"Node on which the devices are rescanned, using the API server instead of the local socket")
+	rescanCmd.Flags().DurationVar(&rescanTimeout, "timeout", rescanTimeout,
+		"Max time to wait for the devices to be rescanned")
+	cli.AddOutputFlag(rescanCmd, &rescanOutput, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+}
+
+// requestRescan requests a rescan of the devices on the node by setting the
+// rescan request annotation, and waits for the daemon to set the result
+func requestRescan(c kubeclient.Client, nodeName string) (*controller.RescanResult, error) {
+	node := &v1.Node{}
+	if err := c.Get(context.TODO(), kubeclient.ObjectKey{Name: nodeName}, node); err != nil {
+		return nil, fmt.Errorf("unable to get node %s: %v", nodeName, err)
+	}
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	nodeCopy := node.DeepCopy()
+	if nodeCopy.Annotations == nil {
+		nodeCopy.Annotations = make(map[string]string)
+	}
+	nodeCopy.Annotations[controller.RescanRequestAnnotation] = id
+	if err := c.Patch(context.TODO(), nodeCopy, kubeclient.MergeFrom(node)); err != nil {
+		return nil, fmt.Errorf("unable to request rescan on node %s: %v", nodeName, err)
+	}
+
+	result := &controller.RescanResult{}
+	err := wait.PollImmediate(rescanPollInterval, rescanTimeout, func() (bool, error) {
+		if err := c.Get(context.TODO(), kubeclient.ObjectKey{Name: nodeName}, node); err != nil {
+			return false, nil
+		}
+		data, ok := node.Annotations[controller.RescanResultAnnotation]
+		if !ok {
+			return false, nil
+		}
+		if err := json.Unmarshal([]byte(data), result); err != nil {
+			return false, nil
+		}
+		return result.ID == id, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("timed out waiting for the rescan of node %s, is the ndm daemon running on it? %v",
+			nodeName, err)
+	}
+	if len(result.Error) != 0 {
+		return nil, fmt.Errorf("rescan of node %s failed: %s", nodeName, result.Error)
+	}
+	return result, nil
+}
+
+// printRescanResult prints the devices added, removed and updated by the rescan
+func printRescanResult(out io.Writer, result *controller.RescanResult) error {
+	fmt.Fprintf(out, "Rescanned node %s: %d added, %d removed, %d updated\n", result.Node,
+		len(result.Added), len(result.Removed), len(result.Updated))
+	if len(result.Added)+len(result.Removed)+len(result.Updated) == 0 {
+		return nil
+	}
+	w := cli.NewTabWriter(out)
+	fmt.Fprintln(w, "CHANGE\tPATH\tBLOCKDEVICE\tFIELDS")
+	for _, changes := range []struct {
+		name    string
+		devices []controller.DeviceChange
+	}{
+		{"added", result.Added},
+		{"removed", result.Removed},
+		{"updated", result.Updated},
+	} {
+		for _, device := range changes.devices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", changes.name, device.DevPath,
+				cli.OrNone(device.BlockDevice), cli.OrNone(strings.Join(device.Fields, ",")))
+		}
+	}
+	return w.Flush()
+}
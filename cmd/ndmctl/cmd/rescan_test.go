@@ -0,0 +1,109 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var testRescanResult = &controller.RescanResult{
+	Node:    "node1",
+	Added:   []controller.DeviceChange{{DevPath: "/dev/sdc", BlockDevice: "blockdevice-c"}},
+	Removed: []controller.DeviceChange{{DevPath: "/dev/sda"}},
+	Updated: []controller.DeviceChange{{DevPath: "/dev/sdb", BlockDevice: "blockdevice-b", Fields: []string{"Capacity", "FSInfo"}}},
+}
+
+func TestRescan(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.RescanPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewEncoder(w).Encode(testRescanResult))
+	})
+	socket, stop := serveTestAPI(t, mux)
+	defer stop()
+
+	result, err := newClient(socket).rescan()
+	require.NoError(t, err)
+	assert.Equal(t, testRescanResult, result)
+
+	var out strings.Builder
+	require.NoError(t, printRescanResult(&out, result))
+	assert.Equal(t, `Rescanned node node1: 1 added, 1 removed, 1 updated
+CHANGE   PATH      BLOCKDEVICE    FIELDS
+added    /dev/sdc  blockdevice-c  <none>
+removed  /dev/sda  <none>         <none>
+updated  /dev/sdb  blockdevice-b  Capacity,FSInfo
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, printRescanResult(&out, &controller.RescanResult{Node: "node1"}))
+	assert.Equal(t, "Rescanned node node1: 0 added, 0 removed, 0 updated\n", out.String())
+}
+
+func TestRequestRescan(t *testing.T) {
+	oldInterval, oldTimeout := rescanPollInterval, rescanTimeout
+	rescanPollInterval, rescanTimeout = 10*time.Millisecond, 5*time.Second
+	defer func() { rescanPollInterval, rescanTimeout = oldInterval, oldTimeout }()
+
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+
+	// the daemon sets the result of the request on the node
+	respond := func(errMessage string) {
+		assert.Eventually(t, func() bool {
+			node := &v1.Node{}
+			if err := c.Get(context.TODO(), kubeclient.ObjectKey{Name: "node1"}, node); err != nil {
+				return false
+			}
+			id, ok := node.Annotations[controller.RescanRequestAnnotation]
+			if !ok || strings.Contains(node.Annotations[controller.RescanResultAnnotation], `"id":"`+id+`"`) {
+				return false
+			}
+			result := *testRescanResult
+			result.ID = id
+			result.Error = errMessage
+			data, _ := json.Marshal(result)
+			node.Annotations[controller.RescanResultAnnotation] = string(data)
+			return c.Update(context.TODO(), node) == nil
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	go respond("")
+	result, err := requestRescan(c, "node1")
+	require.NoError(t, err)
+	assert.Equal(t, testRescanResult.Added, result.Added)
+
+	go respond("rescan not available, udev probe is disabled")
+	_, err = requestRescan(c, "node1")
+	assert.EqualError(t, err, "rescan of node node1 failed: rescan not available, udev probe is disabled")
+
+	_, err = requestRescan(c, "node2")
+	assert.Error(t, err)
+}
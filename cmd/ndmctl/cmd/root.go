@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	goflag "flag"
+	"fmt"
+	"os"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// socket is the path of the socket of the local api of the daemon
+var socket string
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "ndmctl",
+	Short: "ndmctl inspects and rescans the devices discovered by the ndm daemon on the node",
+	Long: `ndmctl talks to the ndm daemon running on the node using its local socket,
+and can be used to debug the discovery of the devices on the node`,
+	SilenceUsage: true,
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	initFlags()
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// initFlags initializes the flags. This adds the flagset to the global
+// cobra flagset
+func initFlags() {
+	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
+
+	// HACK: without the following line, the logs will be prefixed with an error
+	// https://github.com/kubernetes/kubernetes/issues/17162#issuecomment-225596212
+	_ = goflag.CommandLine.Parse([]string{})
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&socket, "socket", controller.DefaultAPISocket,
+		"Path of the socket of the local api of the ndm daemon, set by --api-socket of the daemon")
+	rootCmd.AddCommand(cli.NewCompletionCmd(rootCmd))
+}
@@ -0,0 +1,322 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/probe"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
+	"github.com/openebs/node-disk-manager/pkg/smart"
+	"github.com/spf13/cobra"
+)
+
+// smartOutput is the format of the report, text, json or yaml
+var smartOutput string
+
+// The sources of the report, which are the same as used by the daemon and the
+// exporter. They are replaced in the tests.
+var (
+	// smartProbes are the probes which fill the SMART details of the device
+	smartProbes = probe.PrivilegedProbes
+	// ataAttributes reads the SMART attribute table of an ATA device
+	ataAttributes = func(devPath string) (map[uint8]smart.SMARTAttribute, error) {
+		return (&smart.Identifier{DevPath: devPath}).ATASMARTAttributes()
+	}
+	isNVMe        = nvme.IsNVMe
+	nvmeHealthLog = nvme.GetHealthLog
+	nvmeSelfTests = nvme.GetSelfTestLog
+	nvmeErrorLog  = nvme.GetErrorLog
+)
+
+// smartReport is the SMART/NVMe health report of a device
+type smartReport struct {
+	Device           string `json:"device"`
+	BlockDevice      string `json:"blockDevice,omitempty"`
+	Vendor           string `json:"vendor,omitempty"`
+	Model            string `json:"model,omitempty"`
+	Serial           string `json:"serial,omitempty"`
+	FirmwareRevision string `json:"firmwareRevision,omitempty"`
+	DriveType        string `json:"driveType,omitempty"`
+	Capacity         uint64 `json:"capacity"`
+	// SMART are the details filled by the SMART and seachest probes
+	SMART blockdevice.SMARTStats `json:"smart"`
+	// FailureRisk is the risk of failure computed from the failure
+	// indicators using the default weights
+	FailureRisk float64 `json:"failureRisk"`
+	// ATAAttributes is the SMART attribute table of an ATA device
+	ATAAttributes []smart.SMARTAttribute `json:"ataAttributes,omitempty"`
+	// NVMe are the logs of a NVMe device
+	NVMe *nvmeReport `json:"nvme,omitempty"`
+	// Errors are the errors in reading the details, which are not fatal as
+	// the devices do not support all the logs
+	Errors []string `json:"errors,omitempty"`
+}
+
+// nvmeReport are the health logs of a NVMe device
+type nvmeReport struct {
+	Health    *nvme.HealthLog      `json:"health,omitempty"`
+	SelfTests *nvme.SelfTestLog    `json:"selfTests,omitempty"`
+	ErrorLog  []nvme.ErrorLogEntry `json:"errorLog,omitempty"`
+}
+
+// smartCmd represents the smart command
+var smartCmd = &cobra.Command{
+	Use:   "smart <blockdevice|path>",
+	Short: "Print the SMART/NVMe health report of a device on the node",
+	Long: `Print the SMART/NVMe health report of a device on the node, as read by the probes of
+the daemon. The report has the details filled by the SMART and seachest probes, the SMART
+attributes of ATA devices, and the health, self-test and error logs of NVMe devices`,
+	Example: `  ndmctl smart /dev/nvme0n1 -o json`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(smartOutput, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		deviceList, err := newClient(socket).listDevices()
+		if err != nil {
+			return err
+		}
+		device, err := findDevice(deviceList, args[0])
+		if err != nil {
+			return err
+		}
+		report := newSmartReport(device)
+		if smartOutput != cli.OutputText {
+			return cli.PrintObject(os.Stdout, smartOutput, report)
+		}
+		return printSmartReport(os.Stdout, report)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(smartCmd)
+	cli.AddOutputFlag(smartCmd, &smartOutput, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+}
+
+// newSmartReport reads the SMART/NVMe health report of the device. The probes
+// are run again on the device, so that the report has the current values
+// rather than those of the last scan of the daemon.
+func newSmartReport(device *controller.DeviceStatus) *smartReport {
+	bd := device.Device
+	bd.SMARTInfo = blockdevice.SMARTStats{}
+	probes := smartProbes()
+	names := make([]string, 0, len(probes))
+	for name := range probes {
+		names = append(names, name)
+	}
+	// the smart probe is run before the seachest probe, in the order of
+	// the priorities of the probes in the daemon
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	for _, name := range names {
+		probes[name](&bd)
+	}
+
+	report := &smartReport{
+		Device:           bd.DevPath,
+		BlockDevice:      bd.UUID,
+		Vendor:           bd.DeviceAttributes.Vendor,
+		Model:            bd.DeviceAttributes.Model,
+		Serial:           bd.DeviceAttributes.Serial,
+		FirmwareRevision: bd.DeviceAttributes.FirmwareRevision,
+		DriveType:        bd.DeviceAttributes.DriveType,
+		Capacity:         bd.Capacity.Storage,
+		SMART:            bd.SMARTInfo,
+		FailureRisk:      failurerisk.DefaultWeights.Score(bd.SMARTInfo.FailureIndicators),
+	}
+	if isNVMe(bd.DevPath) {
+		report.NVMe = readNVMeReport(bd.DevPath, report)
+		return report
+	}
+	attributes, err := ataAttributes(bd.DevPath)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	for _, attribute := range attributes {
+		report.ATAAttributes = append(report.ATAAttributes, attribute)
+	}
+	sort.Slice(report.ATAAttributes, func(i, j int) bool {
+		return report.ATAAttributes[i].ID < report.ATAAttributes[j].ID
+	})
+	return report
+}
+
+// readNVMeReport reads the logs of the NVMe device. The errors are added to
+// the report, as the self-test log is not supported by the older controllers.
+func readNVMeReport(devPath string, report *smartReport) *nvmeReport {
+	nvmeReport := &nvmeReport{}
+	if health, err := nvmeHealthLog(devPath); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		nvmeReport.Health = &health
+	}
+	if selfTests, err := nvmeSelfTests(devPath); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		nvmeReport.SelfTests = &selfTests
+	}
+	if errorLog, err := nvmeErrorLog(devPath); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		nvmeReport.ErrorLog = errorLog
+	}
+	return nvmeReport
+}
+
+// printSmartReport prints the report in a human readable form
+func printSmartReport(out io.Writer, report *smartReport) error {
+	w := cli.NewTabWriter(out)
+	fmt.Fprintf(w, "Device:\t%s\n", report.Device)
+	fmt.Fprintf(w, "BlockDevice:\t%s\n", cli.OrNone(report.BlockDevice))
+	fmt.Fprintf(w, "Vendor:\t%s\n", cli.OrNone(report.Vendor))
+	fmt.Fprintf(w, "Model:\t%s\n", cli.OrNone(report.Model))
+	fmt.Fprintf(w, "Serial:\t%s\n", cli.OrNone(report.Serial))
+	fmt.Fprintf(w, "Firmware:\t%s\n", cli.OrNone(report.FirmwareRevision))
+	fmt.Fprintf(w, "Drive Type:\t%s\n", cli.OrNone(report.DriveType))
+	fmt.Fprintf(w, "Capacity:\t%s\n", cli.Capacity(report.Capacity))
+
+	stats := report.SMART
+	temperature := stats.TemperatureInfo
+	fmt.Fprintf(w, "\nSMART:\n")
+	fmt.Fprintf(w, "  Temperature:\t%s\n", temperatureOrNone(temperature.CurrentTemperatureDataValid, temperature.CurrentTemperature))
+	fmt.Fprintf(w, "  Lowest Temperature:\t%s\n", temperatureOrNone(temperature.LowestTemperatureDataValid, temperature.LowestTemperature))
+	fmt.Fprintf(w, "  Highest Temperature:\t%s\n", temperatureOrNone(temperature.HighestTemperatureDataValid, temperature.HighestTemperature))
+	if stats.RotationRate != 0 {
+		fmt.Fprintf(w, "  Rotation Rate:\t%d rpm\n", stats.RotationRate)
+	}
+	fmt.Fprintf(w, "  Bytes Read:\t%s\n", cli.Capacity(stats.TotalBytesRead))
+	fmt.Fprintf(w, "  Bytes Written:\t%s\n", cli.Capacity(stats.TotalBytesWritten))
+	fmt.Fprintf(w, "  Endurance Used:\t%.0f%%\n", stats.PercentEnduranceUsed)
+	if stats.AvailableSpareValid {
+		fmt.Fprintf(w, "  Available Spare:\t%d%%\n", stats.AvailableSpare)
+	}
+	fmt.Fprintf(w, "  Failure Risk:\t%.2f\n", report.FailureRisk)
+	for _, indicator := range failurerisk.KnownIndicators() {
+		if value, ok := stats.FailureIndicators[indicator]; ok {
+			fmt.Fprintf(w, "  %s:\t%d\n", indicator, value)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.ATAAttributes) != 0 {
+		fmt.Fprintf(out, "\nATA SMART Attributes:\n")
+		w = cli.NewTabWriter(out)
+		fmt.Fprintln(w, "  ID\tCURRENT\tWORST\tRAW")
+		for _, attribute := range report.ATAAttributes {
+			fmt.Fprintf(w, "  %d\t%d\t%d\t%d\n", attribute.ID, attribute.Current, attribute.Worst, attribute.Raw)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if report.NVMe != nil {
+		if err := printNVMeReport(out, report.NVMe); err != nil {
+			return err
+		}
+	}
+	if len(report.Errors) != 0 {
+		fmt.Fprintf(out, "\nErrors:\n")
+		for _, err := range report.Errors {
+			fmt.Fprintf(out, "  %s\n", err)
+		}
+	}
+	return nil
+}
+
+// printNVMeReport prints the logs of a NVMe device
+func printNVMeReport(out io.Writer, report *nvmeReport) error {
+	w := cli.NewTabWriter(out)
+	if health := report.Health; health != nil {
+		fmt.Fprintf(w, "\nNVMe Health Log:\n")
+		fmt.Fprintf(w, "  Critical Warning:\t%#02x\n", health.CriticalWarning)
+		fmt.Fprintf(w, "  Temperature:\t%d C\n", health.TemperatureCelsius())
+		fmt.Fprintf(w, "  Available Spare:\t%d%%\n", health.AvailableSpare)
+		fmt.Fprintf(w, "  Available Spare Threshold:\t%d%%\n", health.AvailableSpareThreshold)
+		fmt.Fprintf(w, "  Percentage Used:\t%d%%\n", health.PercentageUsed)
+		fmt.Fprintf(w, "  Bytes Read:\t%s\n", bytesOrZero(health.BytesRead()))
+		fmt.Fprintf(w, "  Bytes Written:\t%s\n", bytesOrZero(health.BytesWritten()))
+		fmt.Fprintf(w, "  Power Cycles:\t%d\n", health.PowerCycles)
+		fmt.Fprintf(w, "  Power On Hours:\t%d\n", health.PowerOnHours)
+		fmt.Fprintf(w, "  Unsafe Shutdowns:\t%d\n", health.UnsafeShutdowns)
+		fmt.Fprintf(w, "  Media Errors:\t%d\n", health.MediaErrors)
+		fmt.Fprintf(w, "  Error Log Entries:\t%d\n", health.ErrorLogEntries)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if selfTests := report.SelfTests; selfTests != nil {
+		fmt.Fprintf(out, "\nNVMe Self-Tests:\n")
+		if selfTests.InProgress() {
+			fmt.Fprintf(out, "  %s test in progress, %d%% complete\n",
+				selfTests.CurrentTest(), selfTests.CurrentCompletion)
+		}
+		if len(selfTests.Results) == 0 {
+			fmt.Fprintf(out, "  No self-tests run.\n")
+		} else {
+			w = cli.NewTabWriter(out)
+			fmt.Fprintln(w, "  TEST\tRESULT\tPOWER ON HOURS")
+			for _, result := range selfTests.Results {
+				fmt.Fprintf(w, "  %s\t%s\t%d\n", result.Test(), result.Result(), result.PowerOnHours)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(report.ErrorLog) != 0 {
+		fmt.Fprintf(out, "\nNVMe Error Log:\n")
+		w = cli.NewTabWriter(out)
+		fmt.Fprintln(w, "  ERROR COUNT\tQUEUE\tCOMMAND\tSTATUS TYPE\tSTATUS\tLBA\tNAMESPACE")
+		for _, entry := range report.ErrorLog {
+			fmt.Fprintf(w, "  %d\t%d\t%d\t%s\t%#02x\t%d\t%d\n", entry.ErrorCount, entry.SubmissionQueueID,
+				entry.CommandID, entry.StatusCodeType(), entry.StatusCode(), entry.LBA, entry.NamespaceID)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// temperatureOrNone returns the temperature in celsius, or <none> if it is not
+// reported by the device
+func temperatureOrNone(valid bool, temperature int16) string {
+	if !valid {
+		return cli.None
+	}
+	return fmt.Sprintf("%d C", temperature)
+}
+
+// bytesOrZero returns the bytes in binary units, or 0 rather than <none> as the
+// values of the logs are always reported by the device
+func bytesOrZero(bytes uint64) string {
+	if bytes == 0 {
+		return "0"
+	}
+	return cli.Capacity(bytes)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
+	"github.com/openebs/node-disk-manager/pkg/helper"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
+	"github.com/openebs/node-disk-manager/pkg/smart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmartReport(t *testing.T) {
+	oldProbes, oldATAAttributes, oldIsNVMe := smartProbes, ataAttributes, isNVMe
+	oldHealthLog, oldSelfTests, oldErrorLog := nvmeHealthLog, nvmeSelfTests, nvmeErrorLog
+	defer func() {
+		smartProbes, ataAttributes, isNVMe = oldProbes, oldATAAttributes, oldIsNVMe
+		nvmeHealthLog, nvmeSelfTests, nvmeErrorLog = oldHealthLog, oldSelfTests, oldErrorLog
+	}()
+
+	probes := make([]string, 0)
+	smartProbes = func() map[string]helper.Filler {
+		return map[string]helper.Filler{
+			"smart-probe": func(bd *blockdevice.BlockDevice) {
+				probes = append(probes, "smart-probe")
+				bd.SMARTInfo.TemperatureInfo.CurrentTemperatureDataValid = true
+				bd.SMARTInfo.TemperatureInfo.CurrentTemperature = 38
+				if !strings.HasPrefix(bd.DevPath, "/dev/nvme") {
+					bd.SMARTInfo.FailureIndicators = map[string]uint64{failurerisk.ReallocatedSectors: 8}
+				}
+			},
+			"seachest-probe": func(bd *blockdevice.BlockDevice) {
+				probes = append(probes, "seachest-probe")
+				bd.SMARTInfo.TotalBytesWritten = 1 << 40
+			},
+		}
+	}
+	ataAttributes = func(devPath string) (map[uint8]smart.SMARTAttribute, error) {
+		return map[uint8]smart.SMARTAttribute{
+			194: {ID: 194, Current: 62, Worst: 45, Raw: 38},
+			5:   {ID: 5, Current: 100, Worst: 100, Raw: 8},
+		}, nil
+	}
+	isNVMe = func(devPath string) bool { return strings.HasPrefix(devPath, "/dev/nvme") }
+	nvmeHealthLog = func(devPath string) (nvme.HealthLog, error) {
+		return nvme.HealthLog{Temperature: 311, AvailableSpare: 100, AvailableSpareThreshold: 10,
+			PercentageUsed: 3, PowerOnHours: 1200, MediaErrors: 1, ErrorLogEntries: 2}, nil
+	}
+	nvmeSelfTests = func(devPath string) (nvme.SelfTestLog, error) {
+		return nvme.SelfTestLog{Results: []nvme.SelfTestResult{{Code: 1, Status: 0, PowerOnHours: 1100}}}, nil
+	}
+	nvmeErrorLog = func(devPath string) ([]nvme.ErrorLogEntry, error) {
+		return nil, fmt.Errorf("error log is not supported by %s", devPath)
+	}
+
+	// the values filled in the last scan are not used
+	sda := controller.DeviceStatus{}
+	sda.Device.DevPath = "/dev/sda"
+	sda.Device.UUID = "blockdevice-a"
+	sda.Device.DeviceAttributes.Model = "ST4000NM"
+	sda.Device.DeviceAttributes.Serial = "S1"
+	sda.Device.Capacity.Storage = 4 << 40
+	sda.Device.SMARTInfo.TotalBytesRead = 1 << 30
+	report := newSmartReport(&sda)
+	assert.Equal(t, []string{"smart-probe", "seachest-probe"}, probes)
+	assert.Zero(t, report.SMART.TotalBytesRead)
+	assert.Equal(t, uint64(1<<40), report.SMART.TotalBytesWritten)
+	assert.InDelta(t, 0.3, report.FailureRisk, 1e-9)
+	assert.Nil(t, report.NVMe)
+	require.Len(t, report.ATAAttributes, 2)
+	assert.Equal(t, uint8(5), report.ATAAttributes[0].ID)
+
+	var out strings.Builder
+	require.NoError(t, printSmartReport(&out, report))
+	assert.Equal(t, `Device:       /dev/sda
+BlockDevice:  blockdevice-a
+Vendor:       <none>
+Model:        ST4000NM
+Serial:       S1
+Firmware:     <none>
+Drive Type:   <none>
+Capacity:     4Ti
+
+SMART:
+  Temperature:          38 C
+  Lowest Temperature:   <none>
+  Highest Temperature:  <none>
+  Bytes Read:           <none>
+  Bytes Written:        1Ti
+  Endurance Used:       0%
+  Failure Risk:         0.30
+  reallocated_sectors:  8
+
+ATA SMART Attributes:
+  ID   CURRENT  WORST  RAW
+  5    100      100    8
+  194  62       45     38
+`, out.String())
+
+	// the logs of a NVMe device are read, and the errors are reported
+	nvme0n1 := controller.DeviceStatus{}
+	nvme0n1.Device.DevPath = "/dev/nvme0n1"
+	report = newSmartReport(&nvme0n1)
+	assert.Empty(t, report.ATAAttributes)
+	require.NotNil(t, report.NVMe)
+	assert.Nil(t, report.NVMe.ErrorLog)
+	assert.Equal(t, []string{"error log is not supported by /dev/nvme0n1"}, report.Errors)
+
+	out.Reset()
+	require.NoError(t, printSmartReport(&out, report))
+	assert.Contains(t, out.String(), `NVMe Health Log:
+  Critical Warning:           0x00
+  Temperature:                38 C
+  Available Spare:            100%
+  Available Spare Threshold:  10%
+  Percentage Used:            3%
+  Bytes Read:                 0
+`)
+	assert.Contains(t, out.String(), `NVMe Self-Tests:
+  TEST   RESULT  POWER ON HOURS
+  short  passed  1100
+`)
+	assert.Contains(t, out.String(), `
+Errors:
+  error log is not supported by /dev/nvme0n1
+`)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	// sparseSize is the size of the sparse file to create or resize to, eg: 10Gi
+	sparseSize string
+	// sparseOutput is the format of the sparse files
+	sparseOutput string
+)
+
+// sparseCmd represents the sparse command
+var sparseCmd = &cobra.Command{
+	Use:   "sparse",
+	Short: "Manage the sparse files on the node used as blockdevices",
+	Long: `Create, resize and delete the sparse files on the node through the daemon, which updates
+their blockdevices immediately. The sparse files are created in the directory set using
+SPARSE_FILE_DIR in the daemon`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return cli.ValidateOutput(sparseOutput, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+	},
+}
+
+// sparseListCmd represents the sparse list command
+var sparseListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the sparse files on the node",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparseFiles, err := newClient(socket).listSparseFiles()
+		if err != nil {
+			return err
+		}
+		if sparseOutput != cli.OutputText {
+			return cli.PrintObject(os.Stdout, sparseOutput, sparseFiles)
+		}
+		return printSparseFiles(os.Stdout, sparseFiles)
+	},
+}
+
+// sparseCreateCmd represents the sparse create command
+var sparseCreateCmd = &cobra.Command{
+	Use:     "create",
+	Short:   "Create a sparse file and its blockdevice",
+	Example: `  ndmctl sparse create --size 10Gi`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSparseFile(newClient(socket), http.MethodPost, "", sparseSize, sparseOutput, os.Stdout)
+	},
+}
+
+// sparseResizeCmd represents the sparse resize command
+var sparseResizeCmd = &cobra.Command{
+	Use:   "resize <blockdevice|path>",
+	Short: "Resize a sparse file and update the capacity of its blockdevice",
+	Long: `Resize a sparse file and update the capacity of its blockdevice. A sparse file whose
+blockdevice is claimed can only be grown`,
+	Example: `  ndmctl sparse resize /var/openebs/sparse/0-ndm-sparse.img --size 20Gi`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSparseFile(newClient(socket), http.MethodPut, args[0], sparseSize, sparseOutput, os.Stdout)
+	},
+}
+
+// sparseDeleteCmd represents the sparse delete command
+var sparseDeleteCmd = &cobra.Command{
+	Use:     "delete <blockdevice|path>",
+	Short:   "Delete an unclaimed sparse file and its blockdevice",
+	Example: `  ndmctl sparse delete sparse-5a1f3c7e9b2d4f6081a3c5e7f9b1d3f5`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateSparseFile(newClient(socket), http.MethodDelete, args[0], "", sparseOutput, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sparseCmd)
+	sparseCmd.AddCommand(sparseListCmd, sparseCreateCmd, sparseResizeCmd, sparseDeleteCmd)
+	for _, cmd := range []*cobra.Command{sparseListCmd, sparseCreateCmd, sparseResizeCmd, sparseDeleteCmd} {
+		cli.AddOutputFlag(cmd, &sparseOutput, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+	}
+	for _, cmd := range []*cobra.Command{sparseCreateCmd, sparseResizeCmd} {
+		cmd.Flags().StringVar(&sparseSize, "size", "", "Size of the sparse file, eg: 10Gi")
+		_ = cmd.MarkFlagRequired("size")
+	}
+}
+
+// updateSparseFile creates, resizes or deletes the sparse file depending on the
+// method, and prints the sparse file
+func updateSparseFile(c *client, method, name, size, output string, out io.Writer) error {
+	req := controller.SparseRequest{Name: name}
+	if len(size) != 0 {
+		quantity, err := resource.ParseQuantity(size)
+		if err != nil {
+			return fmt.Errorf("invalid size %q: %v", size, err)
+		}
+		req.Size = quantity.Value()
+	}
+	sparseFile, err := c.sparse(method, req)
+	if err != nil {
+		return err
+	}
+	if output == cli.OutputJSON || output == cli.OutputYAML {
+		return cli.PrintObject(out, output, sparseFile)
+	}
+	action := map[string]string{
+		http.MethodPost:   "created",
+		http.MethodPut:    "resized",
+		http.MethodDelete: "deleted",
+	}[method]
+	_, err = fmt.Fprintf(out, "Sparse file %s of size %s %s, blockdevice %s\n", sparseFile.Path,
+		cli.Capacity(uint64(sparseFile.Size)), action, sparseFile.BlockDevice)
+	return err
+}
+
+// printSparseFiles prints the sparse files as a table
+func printSparseFiles(out io.Writer, sparseFiles []controller.SparseFile) error {
+	w := cli.NewTabWriter(out)
+	fmt.Fprintln(w, "PATH\tSIZE\tBLOCKDEVICE")
+	for _, sparseFile := range sparseFiles {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", sparseFile.Path, cli.Capacity(uint64(sparseFile.Size)), sparseFile.BlockDevice)
+	}
+	return w.Flush()
+}
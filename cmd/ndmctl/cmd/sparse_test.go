@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateSparseFile(t *testing.T) {
+	requests := make([]string, 0)
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.SparsePath, func(w http.ResponseWriter, r *http.Request) {
+		req := controller.SparseRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, r.Method+" "+req.Name)
+		if req.Name == "sparse-claimed" {
+			http.Error(w, "blockdevice of the sparse file is claimed", http.StatusConflict)
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(controller.SparseFile{
+			Path: "/var/openebs/sparse/0-ndm-sparse.img", Size: req.Size, BlockDevice: "sparse-0",
+		}))
+	})
+	socket, stop := serveTestAPI(t, mux)
+	defer stop()
+	c := newClient(socket)
+
+	var out strings.Builder
+	require.NoError(t, updateSparseFile(c, http.MethodPost, "", "10Gi", cli.OutputText, &out))
+	require.NoError(t, updateSparseFile(c, http.MethodPut, "sparse-0", "20Gi", cli.OutputText, &out))
+	assert.Equal(t, `Sparse file /var/openebs/sparse/0-ndm-sparse.img of size 10Gi created, blockdevice sparse-0
+Sparse file /var/openebs/sparse/0-ndm-sparse.img of size 20Gi resized, blockdevice sparse-0
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, updateSparseFile(c, http.MethodPut, "sparse-0", "30Gi", cli.OutputYAML, &out))
+	assert.Equal(t, `blockDevice: sparse-0
+path: /var/openebs/sparse/0-ndm-sparse.img
+size: 32212254720
+`, out.String())
+
+	err := updateSparseFile(c, http.MethodDelete, "sparse-claimed", "", cli.OutputText, &out)
+	assert.EqualError(t, err, "ndm daemon returned 409 Conflict: blockdevice of the sparse file is claimed")
+	err = updateSparseFile(c, http.MethodPost, "", "10GB!", cli.OutputText, &out)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"POST ", "PUT sparse-0", "PUT sparse-0", "DELETE sparse-claimed"}, requests)
+}
+
+func TestPrintSparseFiles(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, printSparseFiles(&out, []controller.SparseFile{
+		{Path: "/var/openebs/sparse/0-ndm-sparse.img", Size: 1 << 30, BlockDevice: "sparse-0"},
+	}))
+	assert.Equal(t, `PATH                                  SIZE  BLOCKDEVICE
+/var/openebs/sparse/0-ndm-sparse.img  1Gi   sparse-0
+`, out.String())
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/db/kubernetes"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reservedLabelDomains are the domains of the label keys which are set by ndm or
+// kubernetes, and cannot be changed using tag and untag. The block-device-tag is
+// the only label in these domains which can be changed.
+var reservedLabelDomains = []string{"kubernetes.io", "k8s.io", "ndm.io", "openebs.io"}
+
+// tagOptions are the options of the tag and untag commands
+type tagOptions struct {
+	// namespace is the namespace of the blockdevices
+	namespace string
+	// tag is the block-device-tag to be set
+	tag string
+	// untag removes the block-device-tag
+	untag bool
+	// overwrite allows changing the value of an existing label
+	overwrite bool
+	// output is the format of the updated blockdevice
+	output string
+}
+
+var tagOpts tagOptions
+
+// tagFormats are the output formats of the tag and untag commands
+var tagFormats = []string{cli.OutputText, cli.OutputJSON, cli.OutputYAML}
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag <blockdevice> [key=value...]",
+	Short: "Set the block-device-tag and labels of a blockdevice",
+	Long: `Set the block-device-tag and custom labels of a blockdevice. The blockdevices having a
+block-device-tag are claimed only by the claims which select the tag. The labels are validated
+before the blockdevice is updated, and the labels set by ndm or kubernetes cannot be changed.
+The value of an existing label is changed only using --overwrite`,
+	Example: `  ndmctl tag blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607 tier=nvme rack=r7
+  ndmctl tag blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607 --tag mongo`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(tagOpts.output, tagFormats...); err != nil {
+			return err
+		}
+		if len(args) == 1 && len(tagOpts.tag) == 0 {
+			return fmt.Errorf("no labels given, give the labels as key=value or the tag using --tag")
+		}
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return tag(kubeClient, args[0], args[1:], tagOpts, os.Stdout)
+	},
+}
+
+// untagCmd represents the untag command
+var untagCmd = &cobra.Command{
+	Use:   "untag <blockdevice> [key...]",
+	Short: "Remove the block-device-tag and labels of a blockdevice",
+	Long: `Remove the custom labels of a blockdevice, and the block-device-tag using --tag.
+The labels set by ndm or kubernetes cannot be removed`,
+	Example: `  ndmctl untag blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607 tier rack
+  ndmctl untag blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607 --tag`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.ValidateOutput(tagOpts.output, tagFormats...); err != nil {
+			return err
+		}
+		if len(args) == 1 && !tagOpts.untag {
+			return fmt.Errorf("no labels given, give the keys of the labels or --tag")
+		}
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return untag(kubeClient, args[0], args[1:], tagOpts, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+	rootCmd.AddCommand(untagCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	for _, cmd := range []*cobra.Command{tagCmd, untagCmd} {
+		cmd.Flags().StringVarP(&tagOpts.namespace, "namespace", "n", namespace,
+			"Namespace of the blockdevices, the namespace of the ndm daemon by default")
+		cli.AddOutputFlag(cmd, &tagOpts.output, tagFormats...)
+	}
+	tagCmd.Flags().StringVar(&tagOpts.tag, "tag", "",
+		"Block-device-tag of the blockdevice")
+	tagCmd.Flags().BoolVar(&tagOpts.overwrite, "overwrite", false,
+		"Change the value of the labels which are already set")
+	untagCmd.Flags().BoolVar(&tagOpts.untag, "tag", false,
+		"Remove the block-device-tag of the blockdevice")
+}
+
+// tag sets the block-device-tag and the labels given as key=value on the blockdevice
+func tag(kubeClient kubeclient.Client, name string, args []string, opts tagOptions, out io.Writer) error {
+	labels, err := parseLabels(args)
+	if err != nil {
+		return err
+	}
+	if len(opts.tag) != 0 {
+		if errs := validation.IsValidLabelValue(opts.tag); len(errs) != 0 {
+			return fmt.Errorf("invalid tag %q: %s", opts.tag, strings.Join(errs, ", "))
+		}
+		labels[kubernetes.BlockDeviceTagLabel] = opts.tag
+	}
+
+	bd, err := getBlockDevice(kubeClient, opts.namespace, name)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, key := range sortedKeys(labels) {
+		value, ok := bd.Labels[key]
+		if ok && value == labels[key] {
+			continue
+		}
+		if ok && !opts.overwrite {
+			return fmt.Errorf("blockdevice %s already has label %s=%s, use --overwrite to change it",
+				bd.Name, key, value)
+		}
+		if bd.Labels == nil {
+			bd.Labels = make(map[string]string)
+		}
+		bd.Labels[key] = labels[key]
+		changed = true
+	}
+	return updateLabels(kubeClient, bd, changed, "tagged", opts.output, out)
+}
+
+// untag removes the labels with the given keys, and the block-device-tag if
+// requested, from the blockdevice
+func untag(kubeClient kubeclient.Client, name string, keys []string, opts tagOptions, out io.Writer) error {
+	for _, key := range keys {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+	}
+	if opts.untag {
+		keys = append(keys, kubernetes.BlockDeviceTagLabel)
+	}
+
+	bd, err := getBlockDevice(kubeClient, opts.namespace, name)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, key := range keys {
+		if _, ok := bd.Labels[key]; ok {
+			delete(bd.Labels, key)
+			changed = true
+		}
+	}
+	return updateLabels(kubeClient, bd, changed, "untagged", opts.output, out)
+}
+
+// getBlockDevice gets the blockdevice with the name from the namespace
+func getBlockDevice(kubeClient kubeclient.Client, namespace, name string) (*apis.BlockDevice, error) {
+	bd := &apis.BlockDevice{}
+	err := kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: namespace, Name: name}, bd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get blockdevice %s: %v", name, err)
+	}
+	return bd, nil
+}
+
+// updateLabels updates the blockdevice if its labels are changed, and prints
+// the result, or the blockdevice for the json and yaml output
+func updateLabels(kubeClient kubeclient.Client, bd *apis.BlockDevice, changed bool, action, output string, out io.Writer) error {
+	if changed {
+		if err := kubeClient.Update(context.TODO(), bd); err != nil {
+			return fmt.Errorf("unable to update the labels of blockdevice %s: %v", bd.Name, err)
+		}
+	}
+	if output == cli.OutputJSON || output == cli.OutputYAML {
+		return cli.PrintObject(out, output, bd)
+	}
+	if !changed {
+		action = "not changed"
+	}
+	_, err := fmt.Fprintf(out, "blockdevice/%s %s\n", bd.Name, action)
+	return err
+}
+
+// parseLabels parses and validates the labels given as key=value
+func parseLabels(args []string) (map[string]string, error) {
+	labels := make(map[string]string, len(args))
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid label %q, must be key=value", arg)
+		}
+		key, value := parts[0], parts[1]
+		if err := validateLabelKey(key); err != nil {
+			return nil, err
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid value %q of label %s: %s", value, key, strings.Join(errs, ", "))
+		}
+		if _, ok := labels[key]; ok {
+			return nil, fmt.Errorf("label %s is given more than once", key)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// validateLabelKey checks that the key is a valid label key, which is not
+// reserved for the labels set by ndm or kubernetes
+func validateLabelKey(key string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+		return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+	}
+	if key == kubernetes.BlockDeviceTagLabel {
+		return nil
+	}
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return nil
+	}
+	domain := key[:i]
+	for _, reserved := range reservedLabelDomains {
+		if domain == reserved || strings.HasSuffix(domain, "."+reserved) {
+			return fmt.Errorf("label %s is reserved, the labels of %s are managed by ndm or kubernetes",
+				key, reserved)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the labels in sorted order
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestTag(t *testing.T) {
+	bd := newTestBlockDevice("blockdevice-a", "node1", "/dev/sdb", 1<<30, apis.BlockDeviceUnclaimed)
+	bd.Labels = map[string]string{"kubernetes.io/hostname": "node1", "ndm.io/managed": "true"}
+	kubeClient := newTestKubeClient(bd)
+	labels := func() map[string]string {
+		bd := &apis.BlockDevice{}
+		require.NoError(t, kubeClient.Get(context.TODO(),
+			kubeclient.ObjectKey{Namespace: "openebs", Name: "blockdevice-a"}, bd))
+		return bd.Labels
+	}
+	opts := tagOptions{namespace: "openebs", tag: "mongo", output: cli.OutputText}
+
+	var out bytes.Buffer
+	require.NoError(t, tag(kubeClient, "blockdevice-a", []string{"tier=nvme", "rack=r7"}, opts, &out))
+	assert.Equal(t, "blockdevice/blockdevice-a tagged\n", out.String())
+	assert.Equal(t, map[string]string{
+		"kubernetes.io/hostname":      "node1",
+		"ndm.io/managed":              "true",
+		"openebs.io/block-device-tag": "mongo",
+		"tier":                        "nvme",
+		"rack":                        "r7",
+	}, labels())
+
+	// the same labels do not change the blockdevice
+	out.Reset()
+	require.NoError(t, tag(kubeClient, "blockdevice-a", []string{"tier=nvme"}, opts, &out))
+	assert.Equal(t, "blockdevice/blockdevice-a not changed\n", out.String())
+
+	// existing labels are changed only with overwrite
+	opts.tag = ""
+	assert.EqualError(t, tag(kubeClient, "blockdevice-a", []string{"tier=ssd"}, opts, &out),
+		"blockdevice blockdevice-a already has label tier=nvme, use --overwrite to change it")
+	opts.overwrite = true
+	out.Reset()
+	require.NoError(t, tag(kubeClient, "blockdevice-a", []string{"tier=ssd"}, opts, &out))
+	assert.Equal(t, "ssd", labels()["tier"])
+
+	// the labels set by ndm or kubernetes cannot be changed
+	assert.EqualError(t, tag(kubeClient, "blockdevice-a", []string{"ndm.io/managed=false"}, opts, &out),
+		"label ndm.io/managed is reserved, the labels of ndm.io are managed by ndm or kubernetes")
+	assert.EqualError(t, tag(kubeClient, "blockdevice-a", []string{"topology.kubernetes.io/zone=a"}, opts, &out),
+		"label topology.kubernetes.io/zone is reserved, the labels of kubernetes.io are managed by ndm or kubernetes")
+	assert.EqualError(t, tag(kubeClient, "blockdevice-a", []string{"tier"}, opts, &out),
+		`invalid label "tier", must be key=value`)
+	assert.Error(t, tag(kubeClient, "blockdevice-a", []string{"tier=a b"}, opts, &out))
+	assert.Error(t, tag(kubeClient, "blockdevice-a", []string{"-tier=a"}, opts, &out))
+	opts.tag = "a b"
+	assert.Error(t, tag(kubeClient, "blockdevice-a", nil, opts, &out))
+	opts.tag = ""
+	assert.EqualError(t, tag(kubeClient, "blockdevice-x", []string{"tier=a"}, opts, &out),
+		`unable to get blockdevice blockdevice-x: blockdevices.openebs.io "blockdevice-x" not found`)
+
+	// untag removes the labels and the tag
+	out.Reset()
+	opts.untag = true
+	require.NoError(t, untag(kubeClient, "blockdevice-a", []string{"tier", "zone"}, opts, &out))
+	assert.Equal(t, "blockdevice/blockdevice-a untagged\n", out.String())
+	assert.Equal(t, map[string]string{
+		"kubernetes.io/hostname": "node1",
+		"ndm.io/managed":         "true",
+		"rack":                   "r7",
+	}, labels())
+	assert.EqualError(t, untag(kubeClient, "blockdevice-a", []string{"kubernetes.io/hostname"}, opts, &out),
+		"label kubernetes.io/hostname is reserved, the labels of kubernetes.io are managed by ndm or kubernetes")
+
+	out.Reset()
+	opts.untag = false
+	opts.output = cli.OutputYAML
+	require.NoError(t, untag(kubeClient, "blockdevice-a", []string{"rack"}, opts, &out))
+	assert.Contains(t, out.String(), "  name: blockdevice-a\n")
+	assert.NotContains(t, out.String(), "rack")
+}
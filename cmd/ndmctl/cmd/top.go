@@ -0,0 +1,601 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
+	"github.com/prometheus/common/expfmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// topOptions are the options of the device browser
+type topOptions struct {
+	// namespace is the namespace of the node exporter pods
+	namespace string
+	// node shows only the devices of the node
+	node string
+	// port is the metrics port of the node exporter pods
+	port string
+	// urls are the metrics endpoints of the exporters scraped instead of the
+	// node exporter pods
+	urls []string
+	// interval is the refresh interval
+	interval time.Duration
+	// sortBy is the column by which the devices are sorted
+	sortBy string
+	// once prints the devices once and exits
+	once bool
+	// output is the format of the devices, the devices are printed once in
+	// the json and yaml formats
+	output string
+}
+
+var topOpts = topOptions{port: "9101", interval: 5 * time.Second, sortBy: topSortNode}
+
+// the columns by which the devices can be sorted
+const (
+	topSortNode = "node"
+	topSortTemp = "temp"
+	topSortIO   = "io"
+	topSortUtil = "util"
+	topSortRisk = "risk"
+)
+
+// topSortColumns are the columns by which the devices can be sorted, in the
+// order in which they are cycled using the s key
+var topSortColumns = []string{topSortNode, topSortTemp, topSortIO, topSortUtil, topSortRisk}
+
+// ndmNodeExporterSelector selects the pods of the ndm node exporter
+const ndmNodeExporterSelector = "openebs.io/component-name=ndm-node-exporter"
+
+// failureRiskThreshold is the risk of failure above which the device is
+// considered at risk, as in the alert of the failure prediction
+const failureRiskThreshold = 0.5
+
+// the device states of the node_block_device_state metric
+var topDeviceStates = map[float64]string{0: "Active", 1: "Inactive", 2: "Unknown"}
+
+// topDevice is a device shown in the browser, with the latest values of its
+// metrics. The values not exposed by the exporter are nil.
+type topDevice struct {
+	Node            string   `json:"node"`
+	Path            string   `json:"path"`
+	BlockDevice     string   `json:"blockDevice"`
+	DriveType       string   `json:"driveType"`
+	State           string   `json:"state"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	ReadBytes       *float64 `json:"readBytesPerSecond,omitempty"`
+	WrittenBytes    *float64 `json:"writtenBytesPerSecond,omitempty"`
+	ReadIOPS        *float64 `json:"readIOPS,omitempty"`
+	WriteIOPS       *float64 `json:"writeIOPS,omitempty"`
+	Utilization     *float64 `json:"utilization,omitempty"`
+	FailureRisk     *float64 `json:"failureRisk,omitempty"`
+	CriticalWarning *float64 `json:"criticalWarning,omitempty"`
+	// Health is set from the metrics when the devices are printed as json or yaml
+	Health string `json:"health"`
+}
+
+// topReport is the devices with the errors of the scrapes, printed as json or yaml
+type topReport struct {
+	Devices []*topDevice `json:"devices"`
+	Errors  []string     `json:"errors,omitempty"`
+}
+
+// scrapeFunc returns the metrics of each exporter in the text format, keyed by
+// the exporter. The exporters which cannot be scraped are returned as errors.
+type scrapeFunc func() (map[string][]byte, []error)
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Browse the devices of the nodes with their live temperature, IO rates and health",
+	Long: `Show the devices of each node with their temperature, IO rates, utilization and health,
+refreshed at an interval, for a quick triage without access to the dashboards. The metrics
+are scraped from the ndm node exporter pods through the API server, or from the exporters
+given using --url. On a terminal, the keys q quits, s changes the sort column, n shows the
+devices of the next node and r refreshes. The health is the state of the blockdevice, or
+CriticalWarning if the NVMe controller reports a critical warning, or AtRisk if the risk
+of failure is above 0.5`,
+	Example: `  ndmctl top
+  ndmctl top --node worker-2 --sort temp
+  ndmctl top --url http://10.0.0.12:9101/metrics --once`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !isTopSortColumn(topOpts.sortBy) {
+			return fmt.Errorf("invalid sort column %q, one of %s", topOpts.sortBy, strings.Join(topSortColumns, ", "))
+		}
+		if err := cli.ValidateOutput(topOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML); err != nil {
+			return err
+		}
+		var scrape scrapeFunc
+		if len(topOpts.urls) != 0 {
+			scrape = scrapeURLs(http.DefaultClient, topOpts.urls)
+		} else {
+			clientset, err := cli.NewClientset()
+			if err != nil {
+				return err
+			}
+			scrape = scrapeNodeExporters(clientset, topOpts)
+		}
+		if topOpts.once || topOpts.output != cli.OutputText || !terminal.IsTerminal(int(os.Stdin.Fd())) || !terminal.IsTerminal(int(os.Stdout.Fd())) {
+			return runTop(scrape, topOpts, nil, os.Stdout)
+		}
+		state, err := terminal.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(int(os.Stdin.Fd()), state)
+		return runTop(scrape, topOpts, readKeys(os.Stdin), &rawWriter{os.Stdout})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	topCmd.Flags().StringVarP(&topOpts.namespace, "namespace", "n", namespace,
+		"Namespace of the ndm node exporter pods")
+	topCmd.Flags().StringVar(&topOpts.node, "node", "",
+		"Show only the devices of the node")
+	topCmd.Flags().StringVar(&topOpts.port, "port", topOpts.port,
+		"Metrics port of the ndm node exporter pods")
+	topCmd.Flags().StringSliceVar(&topOpts.urls, "url", nil,
+		"Metrics endpoints of the exporters to scrape instead of the node exporter pods")
+	topCmd.Flags().DurationVar(&topOpts.interval, "interval", topOpts.interval,
+		"Refresh interval")
+	topCmd.Flags().StringVar(&topOpts.sortBy, "sort", topOpts.sortBy,
+		"Column by which the devices are sorted, one of "+strings.Join(topSortColumns, ", "))
+	topCmd.Flags().BoolVar(&topOpts.once, "once", false,
+		"Print the devices once and exit")
+	cli.AddOutputFlag(topCmd, &topOpts.output, cli.OutputText, cli.OutputJSON, cli.OutputYAML)
+}
+
+// isTopSortColumn returns whether the devices can be sorted by the column
+func isTopSortColumn(column string) bool {
+	for _, c := range topSortColumns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// scrapeNodeExporters scrapes the node exporter pods through the proxy of the
+// API server
+func scrapeNodeExporters(clientset kubernetes.Interface, opts topOptions) scrapeFunc {
+	return func() (map[string][]byte, []error) {
+		listOpts := metav1.ListOptions{LabelSelector: ndmNodeExporterSelector}
+		if len(opts.node) != 0 {
+			listOpts.FieldSelector = "spec.nodeName=" + opts.node
+		}
+		pods, err := clientset.CoreV1().Pods(opts.namespace).List(listOpts)
+		if err != nil {
+			return nil, []error{fmt.Errorf("unable to list the node exporter pods: %v", err)}
+		}
+		metrics := make(map[string][]byte)
+		var errs []error
+		for _, pod := range pods.Items {
+			data, err := clientset.CoreV1().RESTClient().Get().
+				Namespace(pod.Namespace).Resource("pods").Name(pod.Name + ":" + opts.port).
+				SubResource("proxy").Suffix("metrics").DoRaw()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to scrape %s on %s: %v", pod.Name, pod.Spec.NodeName, err))
+				continue
+			}
+			metrics[pod.Name] = data
+		}
+		return metrics, errs
+	}
+}
+
+// scrapeURLs scrapes the metrics endpoints
+func scrapeURLs(httpClient *http.Client, urls []string) scrapeFunc {
+	return func() (map[string][]byte, []error) {
+		metrics := make(map[string][]byte)
+		var errs []error
+		for _, url := range urls {
+			data, err := scrapeURL(httpClient, url)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to scrape %s: %v", url, err))
+				continue
+			}
+			metrics[url] = data
+		}
+		return metrics, errs
+	}
+}
+
+// scrapeURL returns the body of the metrics endpoint
+func scrapeURL(httpClient *http.Client, url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parseTopDevices returns the devices in the metrics of an exporter
+func parseTopDevices(data []byte) ([]*topDevice, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string]*topDevice)
+	for name, family := range families {
+		for _, metric := range family.Metric {
+			values := make(map[string]string)
+			for _, label := range metric.Label {
+				values[label.GetName()] = label.GetValue()
+			}
+			path, ok := values[labels.Path]
+			if !ok {
+				continue
+			}
+			key := values[labels.Node] + "/" + path
+			device, ok := devices[key]
+			if !ok {
+				device = &topDevice{Node: values[labels.Node], Path: path}
+				devices[key] = device
+			}
+			if len(values[labels.BlockDevice]) != 0 {
+				device.BlockDevice = values[labels.BlockDevice]
+			}
+			if len(values[labels.DriveType]) != 0 {
+				device.DriveType = values[labels.DriveType]
+			}
+			value := metric.GetGauge().GetValue()
+			switch {
+			case name == "node_block_device_state":
+				device.State = topDeviceStates[value]
+			case strings.HasSuffix(name, "_block_device_current_temperature_celsius"), name == "nvme_temperature_celsius":
+				device.Temperature = &value
+			case name == "diskstats_read_bytes_per_second":
+				device.ReadBytes = &value
+			case name == "diskstats_write_bytes_per_second":
+				device.WrittenBytes = &value
+			case name == "diskstats_read_iops":
+				device.ReadIOPS = &value
+			case name == "diskstats_write_iops":
+				device.WriteIOPS = &value
+			case name == "diskstats_utilization_ratio":
+				device.Utilization = &value
+			case name == "smart_failure_risk_score":
+				device.FailureRisk = &value
+			case name == "nvme_critical_warning":
+				device.CriticalWarning = &value
+			}
+		}
+	}
+	list := make([]*topDevice, 0, len(devices))
+	for _, device := range devices {
+		// the aggregated series of the devices above the device limit are not shown
+		if device.Path != "other" {
+			list = append(list, device)
+		}
+	}
+	return list, nil
+}
+
+// health returns the health of the device, the critical warnings and the risk
+// of failure are reported before the state
+func (d *topDevice) health() string {
+	if d.CriticalWarning != nil && *d.CriticalWarning != 0 {
+		return "CriticalWarning"
+	}
+	if d.FailureRisk != nil && *d.FailureRisk > failureRiskThreshold {
+		return "AtRisk"
+	}
+	if len(d.State) != 0 && d.State != "Active" {
+		return d.State
+	}
+	return "OK"
+}
+
+// sortKey returns the value of the device used to sort by the column, the
+// devices are sorted in descending order of the value. The devices without
+// the value are sorted last.
+func (d *topDevice) sortKey(column string) float64 {
+	sum := func(values ...*float64) float64 {
+		total, found := 0.0, false
+		for _, v := range values {
+			if v != nil {
+				total, found = total+*v, true
+			}
+		}
+		if !found {
+			return -1
+		}
+		return total
+	}
+	switch column {
+	case topSortTemp:
+		return sum(d.Temperature)
+	case topSortIO:
+		return sum(d.ReadBytes, d.WrittenBytes)
+	case topSortUtil:
+		return sum(d.Utilization)
+	case topSortRisk:
+		return sum(d.FailureRisk)
+	}
+	return 0
+}
+
+// sortTopDevices sorts the devices by the column, and by node and path
+func sortTopDevices(devices []*topDevice, column string) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		if ki, kj := devices[i].sortKey(column), devices[j].sortKey(column); ki != kj {
+			return ki > kj
+		}
+		if devices[i].Node != devices[j].Node {
+			return devices[i].Node < devices[j].Node
+		}
+		return devices[i].Path < devices[j].Path
+	})
+}
+
+// topView is the state of the browser
+type topView struct {
+	opts    topOptions
+	devices []*topDevice
+	errs    []error
+	nodes   []string
+	updated time.Time
+}
+
+// refresh scrapes the exporters and updates the devices
+func (v *topView) refresh(scrape scrapeFunc) {
+	metrics, errs := scrape()
+	sources := make([]string, 0, len(metrics))
+	for source := range metrics {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	v.devices = nil
+	nodes := make(map[string]bool)
+	for _, source := range sources {
+		devices, err := parseTopDevices(metrics[source])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to parse the metrics of %s: %v", source, err))
+			continue
+		}
+		for _, device := range devices {
+			nodes[device.Node] = true
+		}
+		v.devices = append(v.devices, devices...)
+	}
+	v.nodes = make([]string, 0, len(nodes))
+	for node := range nodes {
+		v.nodes = append(v.nodes, node)
+	}
+	sort.Strings(v.nodes)
+	v.errs = errs
+	v.updated = time.Now()
+}
+
+// nextNode shows the devices of the next node, or of all the nodes after the last
+func (v *topView) nextNode() {
+	if len(v.opts.node) == 0 {
+		if len(v.nodes) != 0 {
+			v.opts.node = v.nodes[0]
+		}
+		return
+	}
+	for i, node := range v.nodes {
+		if node == v.opts.node && i+1 < len(v.nodes) {
+			v.opts.node = v.nodes[i+1]
+			return
+		}
+	}
+	v.opts.node = ""
+}
+
+// nextSort sorts the devices by the next column
+func (v *topView) nextSort() {
+	for i, column := range topSortColumns {
+		if column == v.opts.sortBy {
+			v.opts.sortBy = topSortColumns[(i+1)%len(topSortColumns)]
+			return
+		}
+	}
+	v.opts.sortBy = topSortNode
+}
+
+// selected returns the devices of the selected node, sorted by the column
+func (v *topView) selected() []*topDevice {
+	devices := make([]*topDevice, 0, len(v.devices))
+	for _, device := range v.devices {
+		if len(v.opts.node) == 0 || device.Node == v.opts.node {
+			devices = append(devices, device)
+		}
+	}
+	sortTopDevices(devices, v.opts.sortBy)
+	return devices
+}
+
+// report returns the devices of the selected node with their health, and the
+// errors of the scrapes
+func (v *topView) report() topReport {
+	report := topReport{Devices: v.selected()}
+	for _, device := range report.Devices {
+		device.Health = device.health()
+	}
+	for _, err := range v.errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	return report
+}
+
+// print prints the devices of the selected node as a table, with the errors of
+// the scrapes below the table
+func (v *topView) print(out io.Writer) error {
+	devices := v.selected()
+
+	node := v.opts.node
+	if len(node) == 0 {
+		node = "all nodes"
+	}
+	fmt.Fprintf(out, "ndmctl top - %s, %d devices on %s, sorted by %s\n\n",
+		v.updated.Format("15:04:05"), len(devices), node, v.opts.sortBy)
+	w := cli.NewTabWriter(out)
+	fmt.Fprintln(w, "NODE\tPATH\tBLOCKDEVICE\tTYPE\tTEMP\tREAD/s\tWRITE/s\tIOPS\tUTIL\tHEALTH")
+	for _, d := range devices {
+		iops := cli.None
+		if d.ReadIOPS != nil || d.WriteIOPS != nil {
+			iops = strconv.FormatFloat(valueOrZero(d.ReadIOPS)+valueOrZero(d.WriteIOPS), 'f', 0, 64)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			cli.OrNone(d.Node), d.Path, cli.OrNone(d.BlockDevice), cli.OrNone(d.DriveType),
+			formatTopValue(d.Temperature, func(v float64) string { return fmt.Sprintf("%.0fC", v) }),
+			formatTopValue(d.ReadBytes, bytesRate), formatTopValue(d.WrittenBytes, bytesRate), iops,
+			formatTopValue(d.Utilization, func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) }),
+			d.health())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, err := range v.errs {
+		fmt.Fprintf(out, "\n%v", err)
+	}
+	if len(v.errs) != 0 {
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+// runTop prints the devices at the interval till q is pressed, or once if
+// there are no keys to read
+func runTop(scrape scrapeFunc, opts topOptions, keys <-chan byte, out io.Writer) error {
+	view := &topView{opts: opts}
+	view.refresh(scrape)
+	if opts.output == cli.OutputJSON || opts.output == cli.OutputYAML {
+		return cli.PrintObject(out, opts.output, view.report())
+	}
+	if keys == nil {
+		return view.print(out)
+	}
+
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		// clear the screen and move the cursor to the top
+		fmt.Fprint(out, "\033[H\033[2J")
+		if err := view.print(out); err != nil {
+			return err
+		}
+		fmt.Fprint(out, "\nq: quit  s: sort  n: next node  r: refresh")
+		select {
+		case <-ticker.C:
+			view.refresh(scrape)
+		case key, ok := <-keys:
+			switch {
+			case !ok, key == 'q', key == 3:
+				fmt.Fprintln(out)
+				return nil
+			case key == 's':
+				view.nextSort()
+			case key == 'n':
+				view.nextNode()
+			case key == 'r':
+				view.refresh(scrape)
+			}
+		}
+	}
+}
+
+// readKeys sends the keys read from the terminal in raw mode
+func readKeys(in io.Reader) <-chan byte {
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		r := bufio.NewReader(in)
+		for {
+			key, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			keys <- key
+		}
+	}()
+	return keys
+}
+
+// rawWriter writes the new lines as carriage return and new line, as needed
+// on a terminal in raw mode
+type rawWriter struct {
+	out io.Writer
+}
+
+func (w *rawWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// valueOrZero returns the value, or 0 if not set
+func valueOrZero(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// formatTopValue formats the value, or returns None if not set
+func formatTopValue(v *float64, format func(float64) string) string {
+	if v == nil {
+		return cli.None
+	}
+	return format(*v)
+}
+
+// bytesRate formats the bytes per second in binary units with one decimal, eg: 1.5Mi
+func bytesRate(v float64) string {
+	units := []string{"", "Ki", "Mi", "Gi", "Ti"}
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const topTestMetrics = `# TYPE node_block_device_state gauge
+node_block_device_state{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 0
+node_block_device_state{blockdevice="blockdevice-b",drive_type="SSD",model="M2",node="node1",path="nvme0n1",serial_hash="h2"} 0
+node_block_device_state{blockdevice="blockdevice-c",drive_type="HDD",model="M1",node="node1",path="sdc",serial_hash="h3"} 1
+# TYPE seachest_block_device_current_temperature_celsius gauge
+seachest_block_device_current_temperature_celsius{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 41
+# TYPE nvme_temperature_celsius gauge
+nvme_temperature_celsius{blockdevice="blockdevice-b",drive_type="SSD",model="M2",node="node1",path="nvme0n1",serial_hash="h2"} 52
+# TYPE nvme_critical_warning gauge
+nvme_critical_warning{blockdevice="blockdevice-b",drive_type="SSD",model="M2",node="node1",path="nvme0n1",serial_hash="h2"} 0
+# TYPE diskstats_read_bytes_per_second gauge
+diskstats_read_bytes_per_second{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 1.572864e+06
+diskstats_read_bytes_per_second{blockdevice="blockdevice-b",drive_type="SSD",model="M2",node="node1",path="nvme0n1",serial_hash="h2"} 512
+# TYPE diskstats_write_bytes_per_second gauge
+diskstats_write_bytes_per_second{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 0
+diskstats_write_bytes_per_second{blockdevice="blockdevice-b",drive_type="SSD",model="M2",node="node1",path="nvme0n1",serial_hash="h2"} 3.3554432e+07
+# TYPE diskstats_read_iops gauge
+diskstats_read_iops{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 12
+# TYPE diskstats_write_iops gauge
+diskstats_write_iops{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 3
+# TYPE diskstats_utilization_ratio gauge
+diskstats_utilization_ratio{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 0.25
+# TYPE smart_failure_risk_score gauge
+smart_failure_risk_score{blockdevice="blockdevice-a",drive_type="HDD",model="M1",node="node1",path="sda",serial_hash="h1"} 0.7
+# TYPE node_disk_exporter_up gauge
+node_disk_exporter_up 1
+`
+
+func TestTop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, topTestMetrics)
+	}))
+	defer server.Close()
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	scrape := scrapeURLs(server.Client(), []string{server.URL, notFound.URL})
+
+	var out strings.Builder
+	opts := topOptions{sortBy: topSortIO}
+	require.NoError(t, runTop(scrape, opts, nil, &out))
+	lines := strings.Split(out.String(), "\n")
+	require.True(t, len(lines) > 8, out.String())
+	assert.Contains(t, lines[0], "3 devices on all nodes, sorted by io")
+	assert.Equal(t, []string{
+		"NODE   PATH     BLOCKDEVICE    TYPE  TEMP    READ/s  WRITE/s  IOPS    UTIL    HEALTH",
+		"node1  nvme0n1  blockdevice-b  SSD   52C     512     32.0Mi   <none>  <none>  OK",
+		"node1  sda      blockdevice-a  HDD   41C     1.5Mi   0        15      25%     AtRisk",
+		"node1  sdc      blockdevice-c  HDD   <none>  <none>  <none>   <none>  <none>  Inactive",
+		"",
+		"unable to scrape " + notFound.URL + ": 404 Not Found",
+	}, lines[2:8])
+
+	// the devices are printed once as json
+	out.Reset()
+	opts.output = cli.OutputJSON
+	require.NoError(t, runTop(scrape, opts, nil, &out))
+	report := topReport{}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &report))
+	require.Len(t, report.Devices, 3)
+	assert.Equal(t, "sda", report.Devices[1].Path)
+	assert.Equal(t, "AtRisk", report.Devices[1].Health)
+	assert.Equal(t, 0.25, *report.Devices[1].Utilization)
+	assert.Nil(t, report.Devices[2].Temperature)
+	assert.Equal(t, []string{"unable to scrape " + notFound.URL + ": 404 Not Found"}, report.Errors)
+
+	// the keys change the sort column and the node, and q quits
+	view := &topView{opts: topOptions{sortBy: topSortRisk}}
+	view.refresh(scrape)
+	view.nextSort()
+	assert.Equal(t, topSortNode, view.opts.sortBy)
+	view.nextNode()
+	assert.Equal(t, "node1", view.opts.node)
+	view.nextNode()
+	assert.Equal(t, "", view.opts.node)
+
+	keys := make(chan byte, 2)
+	keys <- 'n'
+	keys <- 'q'
+	out.Reset()
+	require.NoError(t, runTop(scrape, topOptions{sortBy: topSortNode, interval: time.Hour}, keys, &out))
+	assert.Contains(t, out.String(), "3 devices on node1, sorted by node")
+}
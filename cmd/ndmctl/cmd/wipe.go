@@ -0,0 +1,327 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cli"
+	"github.com/openebs/node-disk-manager/pkg/mount"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// wipeOptions are the options of the wipe of a device
+type wipeOptions struct {
+	// namespace is the namespace of the blockdevices
+	namespace string
+	// serial confirms the wipe without a prompt, if it matches the serial of the device
+	serial string
+	// wipefs erases the filesystem and partition table signatures
+	wipefs bool
+	// discard discards all the blocks of the device
+	discard bool
+	// zero writes zeros over the whole device
+	zero bool
+}
+
+var wipeOpts = wipeOptions{wipefs: true}
+
+var (
+	// mountsFiles are the mounts files checked for the mounts of the device, the
+	// mounts of the host are used if available
+	mountsFiles = []string{"/host/proc/1/mounts", "/proc/self/mounts"}
+	// runCommand runs the command and returns its combined output, replaced in the tests
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		return exec.Command(name, args...).CombinedOutput()
+	}
+	// discardDevice discards the given size of the open device, replaced in the tests
+	discardDevice = discard
+)
+
+const (
+	// zeroChunkSize is the size of the writes used to zero a device
+	zeroChunkSize = 1 << 20
+	// blkDiscard is the BLKDISCARD ioctl, _IO(0x12, 119), which is missing in
+	// the vendored x/sys/unix
+	blkDiscard = 0x1277
+)
+
+// wipeCmd represents the wipe command
+var wipeCmd = &cobra.Command{
+	Use:   "wipe <blockdevice|path>",
+	Short: "Wipe an unclaimed and unmounted device on the node",
+	Long: `Wipe a device on the node, which is not claimed, mounted or held by another device.
+The serial of the device has to be typed to confirm the wipe. By default the filesystem
+and partition table signatures are erased using wipefs, the blocks can also be discarded
+or zeroed. The device is held open exclusively during the wipe. The wipe is recorded as an event on the blockdevice`,
+	Example: `  ndmctl wipe blockdevice-2f7e4b1c9d3a5e6f80a1b2c3d4e5f607 --discard`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kubeClient, err := cli.NewKubeClient()
+		if err != nil {
+			return err
+		}
+		return wipe(newClient(socket), kubeClient, args[0], wipeOpts, os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(wipeCmd)
+	namespace := os.Getenv("NAMESPACE")
+	if len(namespace) == 0 {
+		namespace = "openebs"
+	}
+	wipeCmd.Flags().StringVarP(&wipeOpts.namespace, "namespace", "n", namespace,
+		"Namespace of the blockdevices, the namespace of the ndm daemon by default")
+	wipeCmd.Flags().StringVar(&wipeOpts.serial, "confirm-serial", "",
+		"Serial of the device, to confirm the wipe without a prompt")
+	wipeCmd.Flags().BoolVar(&wipeOpts.wipefs, "wipefs", wipeOpts.wipefs,
+		"Erase the filesystem and partition table signatures using wipefs")
+	wipeCmd.Flags().BoolVar(&wipeOpts.discard, "discard", wipeOpts.discard,
+		"Discard all the blocks of the device")
+	wipeCmd.Flags().BoolVar(&wipeOpts.zero, "zero", wipeOpts.zero,
+		"Write zeros over the whole device, which can take long on large devices")
+}
+
+// wipe wipes the device after checking that it is not in use, and that the
+// serial typed by the user matches the device
+func wipe(c *client, kubeClient kubeclient.Client, name string, opts wipeOptions, in io.Reader, out io.Writer) error {
+	if !opts.wipefs && !opts.discard && !opts.zero {
+		return fmt.Errorf("nothing to do, one of --wipefs, --discard or --zero is required")
+	}
+	deviceList, err := c.listDevices()
+	if err != nil {
+		return err
+	}
+	device, err := findDevice(deviceList, name)
+	if err != nil {
+		return err
+	}
+	devPath := device.Device.DevPath
+	if device.Filtered {
+		return fmt.Errorf("refusing to wipe %s, the device is excluded by the filters", devPath)
+	}
+
+	bd := &apis.BlockDevice{}
+	err = kubeClient.Get(context.TODO(), kubeclient.ObjectKey{Namespace: opts.namespace, Name: device.Device.UUID}, bd)
+	if err != nil {
+		return fmt.Errorf("unable to get blockdevice %s of %s: %v", device.Device.UUID, devPath, err)
+	}
+	if err := checkNotInUse(deviceList, device, bd, "wipe"); err != nil {
+		return err
+	}
+
+	serial := device.Device.DeviceAttributes.Serial
+	if len(serial) == 0 {
+		return fmt.Errorf("refusing to wipe %s, the device has no serial to confirm the wipe", devPath)
+	}
+	if len(opts.serial) == 0 {
+		fmt.Fprintf(out, "All the data on %s (%s, %s) will be lost.\nType the serial of the device to confirm: ",
+			devPath, bd.Name, cli.Capacity(device.Device.Capacity.Storage))
+		opts.serial, _ = bufio.NewReader(in).ReadString('\n')
+		opts.serial = strings.TrimSpace(opts.serial)
+	}
+	if opts.serial != serial {
+		return fmt.Errorf("serial does not match, %s is not wiped", devPath)
+	}
+
+	// the device is held open exclusively until the wipe is done, so that it
+	// cannot be mounted or claimed by another device after the checks
+	f, err := os.OpenFile(devPath, os.O_WRONLY|unix.O_EXCL, 0)
+	if errors.Is(err, syscall.EBUSY) {
+		return fmt.Errorf("refusing to wipe %s, the device is in use", devPath)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %v", devPath, err)
+	}
+	defer f.Close()
+
+	steps := make([]string, 0)
+	err = wipeDevice(device, f, opts, func(step string) {
+		steps = append(steps, step)
+		fmt.Fprintf(out, "%s: %s done\n", devPath, step)
+	})
+	if err != nil {
+		message := fmt.Sprintf("wipe of %s failed: %v", devPath, err)
+		if len(steps) != 0 {
+			message = fmt.Sprintf("wipe of %s failed after %s: %v", devPath, strings.Join(steps, ", "), err)
+		}
+		recordDeviceEvent(kubeClient, bd, deviceList.Node, v1.EventTypeWarning, "WipeFailed", message)
+		return err
+	}
+	recordDeviceEvent(kubeClient, bd, deviceList.Node, v1.EventTypeNormal, "Wiped",
+		fmt.Sprintf("%s wiped using %s", devPath, strings.Join(steps, ", ")))
+	_, err = fmt.Fprintf(out, "%s wiped\n", devPath)
+	return err
+}
+
+// checkNotInUse returns an error if the blockdevice is claimed, or if the device
+// or one of its partitions is mounted or held by another device. The action is
+// used in the errors.
+func checkNotInUse(deviceList *controller.DeviceList, device *controller.DeviceStatus, bd *apis.BlockDevice, action string) error {
+	devPath := device.Device.DevPath
+	if bd.Status.ClaimState != apis.BlockDeviceUnclaimed {
+		claim := ""
+		if bd.Spec.ClaimRef != nil {
+			claim = " by " + bd.Spec.ClaimRef.Name
+		}
+		return fmt.Errorf("refusing to %s %s, blockdevice %s is %s%s", action, devPath, bd.Name, bd.Status.ClaimState, claim)
+	}
+	if len(device.Device.DependentDevices.Holders) != 0 {
+		return fmt.Errorf("refusing to %s %s, the device is held by %s", action, devPath,
+			strings.Join(device.Device.DependentDevices.Holders, ", "))
+	}
+
+	paths := append([]string{devPath}, device.Device.DependentDevices.Partitions...)
+	for _, path := range paths {
+		if partition, err := findDevice(deviceList, path); err == nil {
+			if len(partition.Device.FSInfo.MountPoint) != 0 {
+				return fmt.Errorf("refusing to %s %s, %s is mounted at %s", action, devPath, path,
+					strings.Join(partition.Device.FSInfo.MountPoint, ", "))
+			}
+			if path != devPath && len(partition.Device.DependentDevices.Holders) != 0 {
+				return fmt.Errorf("refusing to %s %s, %s is held by %s", action, devPath, path,
+					strings.Join(partition.Device.DependentDevices.Holders, ", "))
+			}
+		}
+		for _, mountsFile := range mountsFiles {
+			if _, err := os.Stat(mountsFile); err != nil {
+				continue
+			}
+			if attr, err := mount.GetDeviceMountAttr(mountsFile, path); err == nil {
+				return fmt.Errorf("refusing to %s %s, %s is mounted at %s", action, devPath, path, attr.MountPoint)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// wipeDevice runs the steps of the wipe selected in the options on the device
+// held open in f, calling done after each step
+func wipeDevice(device *controller.DeviceStatus, f *os.File, opts wipeOptions, done func(step string)) error {
+	devPath := device.Device.DevPath
+	if opts.wipefs {
+		// the signatures of the partitions are erased before the partition table.
+		// wipefs does not open the device exclusively when forced, so it is not
+		// refused because of f.
+		for _, partition := range device.Device.DependentDevices.Partitions {
+			if output, err := runCommand("wipefs", "-a", "-f", partition); err != nil {
+				return fmt.Errorf("wipefs of %s failed: %v: %s", partition, err, strings.TrimSpace(string(output)))
+			}
+		}
+		if output, err := runCommand("wipefs", "-a", "-f", devPath); err != nil {
+			return fmt.Errorf("wipefs of %s failed: %v: %s", devPath, err, strings.TrimSpace(string(output)))
+		}
+		done("wipefs")
+	}
+	if opts.discard {
+		if err := discardDevice(f, device.Device.Capacity.Storage); err != nil {
+			return fmt.Errorf("discard of %s failed: %v", devPath, err)
+		}
+		done("discard")
+	}
+	if opts.zero {
+		if err := zeroDevice(f, device.Device.Capacity.Storage); err != nil {
+			return fmt.Errorf("zeroing of %s failed: %v", devPath, err)
+		}
+		done("zero")
+	}
+	return nil
+}
+
+// discard discards the given size of the device using the BLKDISCARD ioctl
+func discard(f *os.File, size uint64) error {
+	blkRange := [2]uint64{0, size}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), blkDiscard, uintptr(unsafe.Pointer(&blkRange[0])))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// zeroDevice writes zeros over the given size of the open device from its
+// start, and syncs the writes
+func zeroDevice(f *os.File, size uint64) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	zeros := make([]byte, zeroChunkSize)
+	for written := uint64(0); written < size; {
+		chunk := zeros
+		if size-written < zeroChunkSize {
+			chunk = zeros[:size-written]
+		}
+		n, err := f.Write(chunk)
+		if err != nil {
+			return err
+		}
+		written += uint64(n)
+	}
+	return f.Sync()
+}
+
+// recordDeviceEvent records an event of an operation on the device of the blockdevice
+func recordDeviceEvent(c kubeclient.Client, bd *apis.BlockDevice, nodeName, eventType, reason, message string) {
+	recordEvent(c, "BlockDevice", bd, nodeName, eventType, reason, message)
+}
+
+// recordEvent records an event of an operation on the ndm resource of the kind
+func recordEvent(c kubeclient.Client, kind string, obj metav1.Object, nodeName, eventType, reason, message string) {
+	now := metav1.NewTime(time.Now())
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", obj.GetName(), now.UnixNano()),
+			Namespace: obj.GetNamespace(),
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:            kind,
+			APIVersion:      apis.SchemeGroupVersion.String(),
+			Namespace:       obj.GetNamespace(),
+			Name:            obj.GetName(),
+			UID:             obj.GetUID(),
+			ResourceVersion: obj.GetResourceVersion(),
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: "ndmctl", Host: nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if err := c.Create(context.TODO(), event); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to record event %s on %s %s: %v\n",
+			reason, strings.ToLower(kind), obj.GetName(), err)
+	}
+}
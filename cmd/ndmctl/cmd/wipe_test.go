@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	kubeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestWipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndmctl-wipe")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// sdc is a file, so that it can be zeroed
+	sdcPath := filepath.Join(dir, "sdc")
+	require.NoError(t, ioutil.WriteFile(sdcPath, []byte(strings.Repeat("x", 4<<20)), 0600))
+	sdc := newTestDevice(sdcPath, "blockdevice-c", "S3")
+	sdc.DependentDevices.Partitions = []string{sdcPath + "1"}
+	sdc1 := newTestDevice(sdcPath+"1", "blockdevice-c1", "S3")
+	sdd := newTestDevice("/dev/sdd", "blockdevice-d", "S4")
+	sde := newTestDevice("/dev/sde", "blockdevice-e", "S5")
+	sde.DependentDevices.Holders = []string{"dm-0"}
+	sdf := newTestDevice("/dev/sdf", "blockdevice-f", "")
+	sdg := newTestDevice("/dev/sdg", "blockdevice-g", "S7")
+	sda := newTestDevice("/dev/sda", "", "S1")
+	deviceList := controller.DeviceList{
+		Node: "node1",
+		Devices: []controller.DeviceStatus{
+			{Device: sda, Filtered: true}, {Device: sdc}, {Device: sdc1}, {Device: sdd},
+			{Device: sde}, {Device: sdf}, {Device: sdg},
+		},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(controller.DevicesPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(deviceList))
+	})
+	socket, stop := serveTestAPI(t, mux)
+	defer stop()
+
+	// sdg is mounted on the host
+	mountsFile := filepath.Join(dir, "mounts")
+	require.NoError(t, ioutil.WriteFile(mountsFile, []byte("/dev/sdg /mnt/data ext4 rw,relatime 0 0\n"), 0600))
+	oldMountsFiles, oldRunCommand := mountsFiles, runCommand
+	defer func() { mountsFiles, runCommand = oldMountsFiles, oldRunCommand }()
+	mountsFiles = []string{filepath.Join(dir, "missing"), mountsFile}
+	commands := make([]string, 0)
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		commands = append(commands, name+" "+strings.Join(args, " "))
+		return nil, nil
+	}
+	oldDiscardDevice := discardDevice
+	defer func() { discardDevice = oldDiscardDevice }()
+	discardDevice = func(f *os.File, size uint64) error {
+		commands = append(commands, fmt.Sprintf("discard %s %d", f.Name(), size))
+		return nil
+	}
+
+	kubeClient := newTestKubeClient(
+		newTestBlockDevice("blockdevice-c", "node1", sdcPath, testDeviceCapacity, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-d", "node1", "/dev/sdd", testDeviceCapacity, apis.BlockDeviceClaimed),
+		newTestBlockDevice("blockdevice-e", "node1", "/dev/sde", testDeviceCapacity, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-f", "node1", "/dev/sdf", testDeviceCapacity, apis.BlockDeviceUnclaimed),
+		newTestBlockDevice("blockdevice-g", "node1", "/dev/sdg", testDeviceCapacity, apis.BlockDeviceUnclaimed))
+	c := newClient(socket)
+	opts := wipeOptions{namespace: "openebs", wipefs: true}
+
+	tests := map[string]struct {
+		name string
+		opts wipeOptions
+		err  string
+	}{
+		"filtered device":  {"/dev/sda", opts, "refusing to wipe /dev/sda, the device is excluded by the filters"},
+		"claimed device":   {"blockdevice-d", opts, "refusing to wipe /dev/sdd, blockdevice blockdevice-d is Claimed by bdc-1"},
+		"held device":      {"sde", opts, "refusing to wipe /dev/sde, the device is held by dm-0"},
+		"mounted device":   {"sdg", opts, "refusing to wipe /dev/sdg, /dev/sdg is mounted at /mnt/data"},
+		"no serial":        {"sdf", opts, "refusing to wipe /dev/sdf, the device has no serial to confirm the wipe"},
+		"no steps":         {"sdf", wipeOptions{}, "nothing to do, one of --wipefs, --discard or --zero is required"},
+		"unknown device":   {"sdx", opts, "device sdx not found on node node1"},
+		"serial not typed": {"blockdevice-c", opts, "serial does not match, " + sdcPath + " is not wiped"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			err := wipe(c, kubeClient, test.name, test.opts, strings.NewReader("S9\n"), &out)
+			assert.EqualError(t, err, test.err)
+			assert.Empty(t, commands)
+		})
+	}
+
+	// the partitions are wiped before the device, and the device is zeroed
+	var out strings.Builder
+	opts.discard, opts.zero = true, true
+	require.NoError(t, wipe(c, kubeClient, "blockdevice-c", opts, strings.NewReader("S3\n"), &out))
+	assert.Equal(t, []string{"wipefs -a -f " + sdcPath + "1", "wipefs -a -f " + sdcPath,
+		fmt.Sprintf("discard %s %d", sdcPath, 3<<20+5)}, commands)
+	assert.Contains(t, out.String(), "Type the serial of the device to confirm: ")
+	assert.True(t, strings.HasSuffix(out.String(), sdcPath+" wiped\n"))
+	data, err := ioutil.ReadFile(sdcPath)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("\x00", 3<<20+5)+strings.Repeat("x", 4<<20-3<<20-5), string(data))
+
+	eventList := &v1.EventList{}
+	require.NoError(t, kubeClient.List(context.TODO(), eventList, kubeclient.InNamespace("openebs")))
+	require.Equal(t, 1, len(eventList.Items))
+	assert.Equal(t, "Wiped", eventList.Items[0].Reason)
+	assert.Equal(t, "blockdevice-c", eventList.Items[0].InvolvedObject.Name)
+	assert.Equal(t, sdcPath+" wiped using wipefs, discard, zero", eventList.Items[0].Message)
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/openebs/node-disk-manager/cmd/ndmctl/cmd"
+	"github.com/openebs/node-disk-manager/pkg/logs"
+	"k8s.io/klog"
+)
+
+func main() {
+	// initialize the global klog flags. This need to be done explicitly as init() method
+	// is no longer used to register the flags
+	klog.InitFlags(nil)
+
+	// init logger
+	logs.InitLogs()
+	defer logs.FlushLogs()
+
+	cmd.Execute()
+}
@@ -18,12 +18,14 @@ package kubernetes
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/openebs/node-disk-manager/blockdevice"
 	"github.com/openebs/node-disk-manager/pkg/apis"
 	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
 	"os"
@@ -180,3 +182,39 @@ func (cl *Client) ListBlockDevice(filters ...interface{}) ([]blockdevice.BlockDe
 
 	return blockDeviceList, nil
 }
+
+// ListBlockDeviceResources lists the blockdevice resources in the namespace,
+// without converting them, so that their status is available
+func (cl *Client) ListBlockDeviceResources() (*v1alpha1.BlockDeviceList, error) {
+	bdList := &v1alpha1.BlockDeviceList{}
+	if err := cl.client.List(context.TODO(), bdList, client.InNamespace(cl.namespace)); err != nil {
+		return nil, err
+	}
+	return bdList, nil
+}
+
+// ListBlockDeviceClaims lists the blockdevice claims in the namespace
+func (cl *Client) ListBlockDeviceClaims() (*v1alpha1.BlockDeviceClaimList, error) {
+	bdcList := &v1alpha1.BlockDeviceClaimList{}
+	if err := cl.client.List(context.TODO(), bdcList, client.InNamespace(cl.namespace)); err != nil {
+		return nil, err
+	}
+	return bdcList, nil
+}
+
+// AnnotateBlockDevice sets the annotation on the blockdevice. Only the
+// annotation is patched, the other fields of the blockdevice are not changed.
+func (cl *Client) AnnotateBlockDevice(name, key, value string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{key: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	bd := &v1alpha1.BlockDevice{}
+	bd.Name = name
+	bd.Namespace = cl.namespace
+	return cl.client.Patch(context.TODO(), bd, client.RawPatch(types.MergePatchType, patch))
+}
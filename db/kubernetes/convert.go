@@ -37,6 +37,7 @@ func convertBlockDeviceAPIListToBlockDeviceList(in *api.BlockDeviceList, out *[]
 
 func convertBlockDeviceAPIToBlockDevice(in *api.BlockDevice, out *blockdevice.BlockDevice) error {
 	out.UUID = in.Name
+	out.Annotations = in.Annotations
 
 	//labels
 	out.NodeAttributes = make(blockdevice.NodeAttribute)
@@ -51,10 +52,19 @@ func convertBlockDeviceAPIToBlockDevice(in *api.BlockDevice, out *blockdevice.Bl
 	// will be added.
 	out.FSInfo.MountPoint = append(out.FSInfo.MountPoint, in.Spec.FileSystem.Mountpoint)
 	out.DeviceAttributes.DeviceType = in.Spec.Details.DeviceType
+	out.DeviceAttributes.DriveType = in.Spec.Details.DriveType
+	out.DeviceAttributes.Model = in.Spec.Details.Model
+	out.DeviceAttributes.Serial = in.Spec.Details.Serial
+	out.DependentDevices.Partitions = in.Spec.Partitions
 
 	//status
 	out.Status.State = string(in.Status.State)
 	out.Status.ClaimPhase = string(in.Status.ClaimState)
+	out.Status.ClaimNamespace, out.Status.ClaimName = "", ""
+	if in.Spec.ClaimRef != nil {
+		out.Status.ClaimNamespace = in.Spec.ClaimRef.Namespace
+		out.Status.ClaimName = in.Spec.ClaimRef.Name
+	}
 
 	return nil
 }
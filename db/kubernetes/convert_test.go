@@ -22,6 +22,7 @@ import (
 	"github.com/openebs/node-disk-manager/blockdevice"
 	api "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
 )
 
 func Test_convert_BlockDeviceAPI_To_BlockDevice(t *testing.T) {
@@ -41,24 +42,37 @@ func Test_convert_BlockDeviceAPI_To_BlockDevice(t *testing.T) {
 	// building the blockdevice API object
 	in1 := createFakeBlockDeviceAPI(fakeBDName)
 	in1.Labels[KubernetesHostNameLabel] = fakeHostName
+	in1.Annotations = map[string]string{"internal.openebs.io/wear-history": "1600000000:12"}
 	in1.Spec.NodeAttributes.NodeName = fakeNodeName
 	in1.Spec.Path = fakeDevicePath
 	in1.Spec.FileSystem.Type = fileSystem
 	in1.Spec.FileSystem.Mountpoint = mountPoint
 	in1.Spec.Details.DeviceType = deviceType
+	in1.Spec.Details.DriveType = blockdevice.DriveTypeSSD
+	in1.Spec.Details.Model = "fake-model"
+	in1.Spec.Details.Serial = "fake-serial"
+	in1.Spec.Partitions = []string{"/dev/sdf1p1"}
+	in1.Spec.ClaimRef = &v1.ObjectReference{Namespace: "openebs", Name: "fake-claim"}
 	in1.Status.State = api.BlockDeviceState(blockdevice.Active)
 	in1.Status.ClaimState = api.DeviceClaimState(blockdevice.Claimed)
 
 	// building the core blockdevice object
 	out1 := createFakeBlockDevice(fakeBDName)
+	out1.Annotations = map[string]string{"internal.openebs.io/wear-history": "1600000000:12"}
 	out1.NodeAttributes[blockdevice.HostName] = fakeHostName
 	out1.NodeAttributes[blockdevice.NodeName] = fakeNodeName
 	out1.DevPath = fakeDevicePath
 	out1.FSInfo.FileSystem = fileSystem
 	out1.FSInfo.MountPoint = append(out1.FSInfo.MountPoint, mountPoint)
 	out1.DeviceAttributes.DeviceType = blockdevice.SparseBlockDeviceType
+	out1.DeviceAttributes.DriveType = blockdevice.DriveTypeSSD
+	out1.DeviceAttributes.Model = "fake-model"
+	out1.DeviceAttributes.Serial = "fake-serial"
+	out1.DependentDevices.Partitions = []string{"/dev/sdf1p1"}
 	out1.Status.State = blockdevice.Active
 	out1.Status.ClaimPhase = blockdevice.Claimed
+	out1.Status.ClaimNamespace = "openebs"
+	out1.Status.ClaimName = "fake-claim"
 
 	tests := map[string]struct {
 		args    args
@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/diskstats"
+	diskstatsmetrics "github.com/openebs/node-disk-manager/pkg/metrics/diskstats"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+)
+
+// DiskStatsCollector contains the metrics, concurrency handler and client to get
+// the IO statistics of the devices on the node
+type DiskStatsCollector struct {
+	// Client lists the blockdevices, from etcd or from the node when running
+	// without kubernetes
+	Client DeviceLister
+	// NodeName is the node whose devices are reported. Devices of all the
+	// nodes are reported if empty.
+	NodeName string
+	// Interval is the interval at which /proc/diskstats is sampled. The rates
+	// are computed over this interval.
+	Interval time.Duration
+
+	requestProgress
+
+	// rates are the IO statistics over the last interval, keyed by the device name
+	rates      map[string]diskstats.Rates
+	ratesMutex sync.Mutex
+
+	// all metrics collected from /proc/diskstats
+	metrics *diskstatsmetrics.Metrics
+}
+
+// NewDiskStatsMetricCollector creates a new instance of DiskStatsCollector which
+// implements Collector interface. The statistics are sampled at the interval once
+// Start is called.
+func NewDiskStatsMetricCollector(c DeviceLister, nodeName string, interval time.Duration) *DiskStatsCollector {
+	klog.V(2).Infof("DiskStats Metric Collector initialized")
+	return &DiskStatsCollector{
+		Client:   c,
+		NodeName: nodeName,
+		Interval: interval,
+		rates:    make(map[string]diskstats.Rates),
+		metrics:  diskstatsmetrics.NewMetrics(),
+	}
+}
+
+// Start samples /proc/diskstats at the interval, till the stop channel is closed
+func (dc *DiskStatsCollector) Start(stopCh <-chan struct{}) {
+	prev, err := diskstats.Read()
+	if err != nil {
+		klog.Errorf("reading diskstats failed. %v", err)
+	}
+	prevTime := time.Now()
+
+	ticker := time.NewTicker(dc.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		cur, err := diskstats.Read()
+		if err != nil {
+			klog.Errorf("reading diskstats failed. %v", err)
+			continue
+		}
+		now := time.Now()
+		dc.setRates(prev, cur, now.Sub(prevTime))
+		prev, prevTime = cur, now
+	}
+}
+
+// setRates computes the rates of the devices present in both the samples
+func (dc *DiskStatsCollector) setRates(prev, cur map[string]diskstats.Stats, interval time.Duration) {
+	rates := make(map[string]diskstats.Rates)
+	for name, stats := range cur {
+		if prevStats, ok := prev[name]; ok {
+			rates[name] = diskstats.ComputeRates(prevStats, stats, interval)
+		}
+	}
+	dc.ratesMutex.Lock()
+	dc.rates = rates
+	dc.ratesMutex.Unlock()
+}
+
+// Describe is the implementation of Describe in prometheus.Collector
+func (dc *DiskStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range dc.metrics.Collectors() {
+		col.Describe(ch)
+	}
+}
+
+// Collect is the implementation of Collect in prometheus.Collector
+func (dc *DiskStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	klog.V(4).Info("Starting to collect diskstats metrics for a request")
+
+	if !dc.start() {
+		dc.metrics.IncRejectRequestCounter()
+		return
+	}
+	defer dc.done()
+
+	// set the client each time
+	if err := dc.Client.InitClient(); err != nil {
+		klog.Errorf("error setting client. %v", err)
+		dc.metrics.IncErrorRequestCounter()
+		dc.collectErrors(ch)
+		return
+	}
+
+	// get list of blockdevices from etcd
+	blockDevices, err := dc.Client.ListBlockDevice()
+	if err != nil {
+		klog.Errorf("Listing block devices failed %v", err)
+		dc.metrics.IncErrorRequestCounter()
+		dc.collectErrors(ch)
+		return
+	}
+
+	dc.setMetricData(blockDevices)
+
+	// collect each metric
+	for _, col := range dc.metrics.Collectors() {
+		col.Collect(ch)
+	}
+}
+
+// collectErrors collects only the error metrics and set it on the channel
+func (dc *DiskStatsCollector) collectErrors(ch chan<- prometheus.Metric) {
+	for _, col := range dc.metrics.ErrorCollectors() {
+		col.Collect(ch)
+	}
+}
+
+// setMetricData sets the IO statistics of the active blockdevices of the node on
+// the prometheus metrics. The device is found in /proc/diskstats using the name
+// of the device node.
+func (dc *DiskStatsCollector) setMetricData(blockDevices []blockdevice.BlockDevice) {
+	dc.ratesMutex.Lock()
+	defer dc.ratesMutex.Unlock()
+
+	dc.metrics.Reset()
+	for _, bd := range blockDevices {
+		// do not report metrics for sparse devices
+		if bd.DeviceAttributes.DeviceType == blockdevice.SparseBlockDeviceType ||
+			bd.Status.State != blockdevice.Active {
+			continue
+		}
+		if dc.NodeName != "" && bd.NodeAttributes[blockdevice.NodeName] != dc.NodeName {
+			continue
+		}
+		rates, ok := dc.rates[filepath.Base(bd.DevPath)]
+		if !ok {
+			continue
+		}
+		dc.metrics.SetMetrics(bd, rates)
+	}
+}
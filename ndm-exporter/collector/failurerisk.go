@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
+	riskmetrics "github.com/openebs/node-disk-manager/pkg/metrics/failurerisk"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
+	"github.com/openebs/node-disk-manager/pkg/smart"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+)
+
+// FailureRiskCollector contains the metrics, concurrency handler and client to get
+// the failure indicators from the SMART attributes of the ATA devices on the node,
+// and to score their risk of failure
+type FailureRiskCollector struct {
+	// Client lists the blockdevices, from etcd or from the node when running
+	// without kubernetes
+	Client DeviceLister
+	// NodeName is the node whose devices are reported. Devices of all the
+	// nodes are reported if empty.
+	NodeName string
+	// Weights are the weights of the failure indicators in the score
+	Weights failurerisk.Weights
+
+	requestProgress
+
+	// all metrics of the risk of failure
+	metrics *riskmetrics.Metrics
+
+	// getAttributes gets the SMART attributes of the device, used for mocking in tests
+	getAttributes func(devPath string) (map[uint8]smart.SMARTAttribute, error)
+
+	// schedule decides when the SMART attributes are collected
+	schedule *Schedule
+	// cache is the failure indicators last collected from each device, keyed by
+	// the device path
+	cache map[string]failureRiskCache
+}
+
+// failureRiskCache is the failure indicators last collected from a device
+type failureRiskCache struct {
+	indicators map[string]uint64
+	time       time.Time
+}
+
+// NewFailureRiskMetricCollector creates a new instance of FailureRiskCollector which
+// implements Collector interface. The SMART attributes are collected from the
+// devices as per the schedule.
+func NewFailureRiskMetricCollector(c DeviceLister, nodeName string, schedule *Schedule,
+	weights failurerisk.Weights) *FailureRiskCollector {
+	klog.V(2).Infof("Failure Risk Metric Collector initialized")
+	return &FailureRiskCollector{
+		Client:   c,
+		NodeName: nodeName,
+		Weights:  weights,
+		metrics:  riskmetrics.NewMetrics(),
+		getAttributes: func(devPath string) (map[uint8]smart.SMARTAttribute, error) {
+			return (&smart.Identifier{DevPath: devPath}).ATASMARTAttributes()
+		},
+		schedule: schedule,
+		cache:    make(map[string]failureRiskCache),
+	}
+}
+
+// Describe is the implementation of Describe in prometheus.Collector
+func (fc *FailureRiskCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range fc.metrics.Collectors() {
+		col.Describe(ch)
+	}
+}
+
+// Collect is the implementation of Collect in prometheus.Collector
+func (fc *FailureRiskCollector) Collect(ch chan<- prometheus.Metric) {
+	klog.V(4).Info("Starting to collect failure risk metrics for a request")
+
+	if !fc.start() {
+		fc.metrics.IncRejectRequestCounter()
+		return
+	}
+	defer fc.done()
+
+	// set the client each time
+	if err := fc.Client.InitClient(); err != nil {
+		klog.Errorf("error setting client. %v", err)
+		fc.metrics.IncErrorRequestCounter()
+		fc.collectErrors(ch)
+		return
+	}
+
+	// get list of blockdevices from etcd
+	blockDevices, err := fc.Client.ListBlockDevice()
+	if err != nil {
+		klog.Errorf("Listing block devices failed %v", err)
+		fc.metrics.IncErrorRequestCounter()
+		fc.collectErrors(ch)
+		return
+	}
+
+	if err = fc.setMetricData(blockDevices); err != nil {
+		klog.Error(err)
+		fc.metrics.IncErrorRequestCounter()
+		fc.collectErrors(ch)
+		return
+	}
+
+	// collect each metric
+	for _, col := range fc.metrics.Collectors() {
+		col.Collect(ch)
+	}
+}
+
+// collectErrors collects only the error metrics and set it on the channel
+func (fc *FailureRiskCollector) collectErrors(ch chan<- prometheus.Metric) {
+	for _, col := range fc.metrics.ErrorCollectors() {
+		col.Collect(ch)
+	}
+}
+
+// setMetricData gets the failure indicators of the active ATA blockdevices of the
+// node, and sets them along with the risk of failure on the prometheus metrics. The
+// SMART attributes are read from the device only if they are due as per the
+// schedule. An error is returned only if the attributes could not be read from
+// any of the devices.
+func (fc *FailureRiskCollector) setMetricData(blockDevices []blockdevice.BlockDevice) error {
+	fc.metrics.Reset()
+	nodeDevices := make([]blockdevice.BlockDevice, 0)
+	for _, bd := range blockDevices {
+		if fc.NodeName != "" && bd.NodeAttributes[blockdevice.NodeName] != fc.NodeName {
+			continue
+		}
+		if bd.DeviceAttributes.DeviceType == blockdevice.SparseBlockDeviceType {
+			continue
+		}
+		nodeDevices = append(nodeDevices, bd)
+	}
+	if !fc.schedule.Enabled(FamilyFailureRisk, len(nodeDevices)) {
+		fc.cache = make(map[string]failureRiskCache)
+		return nil
+	}
+
+	devices, failed := 0, 0
+	paths := make(map[string]bool)
+	for _, bd := range nodeDevices {
+		// only the ATA devices report the SMART attributes
+		if nvme.IsNVMe(bd.DevPath) || bd.Status.State != blockdevice.Active ||
+			bd.DeviceAttributes.DeviceType == blockdevice.BlockDeviceTypePartition {
+			continue
+		}
+		devices++
+		paths[bd.DevPath] = true
+		cache, ok := fc.cache[bd.DevPath]
+		if !ok || fc.schedule.Due(FamilyFailureRisk, cache.time) {
+			attributes, err := fc.getAttributes(bd.DevPath)
+			if err != nil {
+				klog.V(4).Infof("fetching smart attributes for %s failed. %v", bd.DevPath, err)
+				failed++
+				continue
+			}
+			cache.indicators, cache.time = failurerisk.Indicators(attributes), time.Now()
+		}
+		fc.cache[bd.DevPath] = cache
+		fc.metrics.SetMetrics(bd, cache.indicators, fc.Weights.Score(cache.indicators))
+	}
+	// remove the indicators of the devices that are no longer present
+	for path := range fc.cache {
+		if !paths[path] {
+			delete(fc.cache, path)
+		}
+	}
+	if devices != 0 && failed == devices {
+		return fmt.Errorf("getting smart attributes for the blockdevices failed")
+	}
+	return nil
+}
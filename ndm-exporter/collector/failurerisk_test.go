@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
+	"github.com/openebs/node-disk-manager/pkg/smart"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newActiveBlockDevice(uuid, devPath, nodeName string) blockdevice.BlockDevice {
+	bd := blockdevice.BlockDevice{
+		Identifier:     blockdevice.Identifier{UUID: uuid, DevPath: devPath},
+		NodeAttributes: blockdevice.NodeAttribute{blockdevice.NodeName: nodeName},
+	}
+	bd.Status.State = blockdevice.Active
+	return bd
+}
+
+func TestFailureRiskCollector(t *testing.T) {
+	lister := &fakeLister{
+		blockDevices: []blockdevice.BlockDevice{
+			newActiveBlockDevice("blockdevice-1", "/dev/sdb", "node1"),
+			// not an ATA device
+			newActiveBlockDevice("blockdevice-2", "/dev/nvme0n1", "node1"),
+			// on another node
+			newActiveBlockDevice("blockdevice-3", "/dev/sdb", "node2"),
+			// reading the attributes fails
+			newActiveBlockDevice("blockdevice-4", "/dev/sdc", "node1"),
+		},
+	}
+	schedule := &Schedule{Intervals: map[Family]time.Duration{FamilyFailureRisk: time.Hour}}
+	weights := failurerisk.Weights{failurerisk.PendingSectors: 0.5, failurerisk.CRCErrors: 0.5}
+	fc := NewFailureRiskMetricCollector(lister, "node1", schedule, weights)
+	var read []string
+	fc.getAttributes = func(devPath string) (map[uint8]smart.SMARTAttribute, error) {
+		read = append(read, devPath)
+		if devPath == "/dev/sdc" {
+			return nil, fmt.Errorf("/dev/sdc is not an ATA device")
+		}
+		return map[uint8]smart.SMARTAttribute{
+			5:   {ID: 5, Raw: 0},
+			197: {ID: 197, Raw: 8},
+		}, nil
+	}
+
+	labels := `blockdevice="blockdevice-1",drive_type="",model="",node="node1",path="sdb",serial_hash=""`
+	expected := `
+# HELP smart_failure_indicator Raw value of the SMART attribute used to predict the failure of the device, by indicator
+# TYPE smart_failure_indicator gauge
+smart_failure_indicator{blockdevice="blockdevice-1",drive_type="",indicator="pending_sectors",model="",node="node1",path="sdb",serial_hash=""} 8
+smart_failure_indicator{blockdevice="blockdevice-1",drive_type="",indicator="reallocated_sectors",model="",node="node1",path="sdb",serial_hash=""} 0
+# HELP smart_failure_risk_score Risk of failure of the device between 0 and 1, scored from the failure indicators
+# TYPE smart_failure_risk_score gauge
+smart_failure_risk_score{` + labels + `} 0.5
+`
+	err := testutil.CollectAndCompare(fc, strings.NewReader(expected),
+		"smart_failure_indicator", "smart_failure_risk_score")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dev/sdb", "/dev/sdc"}, read)
+
+	// the attributes are read again only when they are due, while the failed
+	// devices are retried
+	read = nil
+	assert.Equal(t, 5, testutil.CollectAndCount(fc))
+	assert.Equal(t, []string{"/dev/sdc"}, read)
+
+	// the metrics of the removed devices are removed, leaving the request counters
+	lister.blockDevices = lister.blockDevices[1:3]
+	assert.Equal(t, 2, testutil.CollectAndCount(fc))
+	assert.Empty(t, fc.cache)
+}
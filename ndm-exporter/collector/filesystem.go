@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"path/filepath"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	fsmetrics "github.com/openebs/node-disk-manager/pkg/metrics/filesystem"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+)
+
+// FilesystemCollector contains the metrics, concurrency handler and client to get
+// the usage of the filesystems mounted from the devices on the node
+type FilesystemCollector struct {
+	// Client lists the blockdevices, from etcd or from the node when running
+	// without kubernetes
+	Client DeviceLister
+	// NodeName is the node whose devices are reported. Devices of all the
+	// nodes are reported if empty.
+	NodeName string
+	// HostRoot is the path at which the root filesystem of the host is mounted,
+	// under which the mountpoints of the devices are found
+	HostRoot string
+
+	requestProgress
+
+	// statfs returns the usage of the filesystem mounted at the path
+	statfs func(path string) (fsmetrics.Usage, error)
+
+	// all metrics of the mounted filesystems
+	metrics *fsmetrics.Metrics
+}
+
+// NewFilesystemMetricCollector creates a new instance of FilesystemCollector which
+// implements Collector interface
+func NewFilesystemMetricCollector(c DeviceLister, nodeName, hostRoot string) *FilesystemCollector {
+	klog.V(2).Infof("Filesystem Metric Collector initialized")
+	return &FilesystemCollector{
+		Client:   c,
+		NodeName: nodeName,
+		HostRoot: hostRoot,
+		statfs:   fsmetrics.Statfs,
+		metrics:  fsmetrics.NewMetrics(),
+	}
+}
+
+// Describe is the implementation of Describe in prometheus.Collector
+func (fc *FilesystemCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range fc.metrics.Collectors() {
+		col.Describe(ch)
+	}
+}
+
+// Collect is the implementation of Collect in prometheus.Collector
+func (fc *FilesystemCollector) Collect(ch chan<- prometheus.Metric) {
+	klog.V(4).Info("Starting to collect filesystem metrics for a request")
+
+	if !fc.start() {
+		fc.metrics.IncRejectRequestCounter()
+		return
+	}
+	defer fc.done()
+
+	// set the client each time
+	if err := fc.Client.InitClient(); err != nil {
+		klog.Errorf("error setting client. %v", err)
+		fc.metrics.IncErrorRequestCounter()
+		fc.collectErrors(ch)
+		return
+	}
+
+	// get list of blockdevices from etcd
+	blockDevices, err := fc.Client.ListBlockDevice()
+	if err != nil {
+		klog.Errorf("Listing block devices failed %v", err)
+		fc.metrics.IncErrorRequestCounter()
+		fc.collectErrors(ch)
+		return
+	}
+
+	fc.setMetricData(blockDevices)
+
+	// collect each metric
+	for _, col := range fc.metrics.Collectors() {
+		col.Collect(ch)
+	}
+}
+
+// collectErrors collects only the error metrics and set it on the channel
+func (fc *FilesystemCollector) collectErrors(ch chan<- prometheus.Metric) {
+	for _, col := range fc.metrics.ErrorCollectors() {
+		col.Collect(ch)
+	}
+}
+
+// setMetricData sets the usage of the filesystems mounted from the active
+// blockdevices of the node on the prometheus metrics. Only the first mountpoint
+// of a device is reported, as is the case in the blockdevice resource.
+func (fc *FilesystemCollector) setMetricData(blockDevices []blockdevice.BlockDevice) {
+	fc.metrics.Reset()
+	for _, bd := range blockDevices {
+		// do not report metrics for sparse devices
+		if bd.DeviceAttributes.DeviceType == blockdevice.SparseBlockDeviceType ||
+			bd.Status.State != blockdevice.Active {
+			continue
+		}
+		if fc.NodeName != "" && bd.NodeAttributes[blockdevice.NodeName] != fc.NodeName {
+			continue
+		}
+		if len(bd.FSInfo.MountPoint) == 0 || bd.FSInfo.MountPoint[0] == "" {
+			continue
+		}
+		mountPoint := bd.FSInfo.MountPoint[0]
+		usage, err := fc.statfs(filepath.Join(fc.HostRoot, mountPoint))
+		if err != nil {
+			klog.V(4).Infof("unable to get the usage of %s mounted at %s. %v", bd.DevPath, mountPoint, err)
+			continue
+		}
+		fc.metrics.SetMetrics(bd, mountPoint, bd.FSInfo.FileSystem, usage)
+	}
+}
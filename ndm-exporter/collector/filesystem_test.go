@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	fsmetrics "github.com/openebs/node-disk-manager/pkg/metrics/filesystem"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLister lists the given blockdevices
+type fakeLister struct {
+	blockDevices []blockdevice.BlockDevice
+}
+
+func (f *fakeLister) InitClient() error {
+	return nil
+}
+
+func (f *fakeLister) ListBlockDevice(filters ...interface{}) ([]blockdevice.BlockDevice, error) {
+	return f.blockDevices, nil
+}
+
+func newMountedBlockDevice(uuid, devPath, nodeName, mountPoint string) blockdevice.BlockDevice {
+	bd := blockdevice.BlockDevice{
+		Identifier:     blockdevice.Identifier{UUID: uuid, DevPath: devPath},
+		NodeAttributes: blockdevice.NodeAttribute{blockdevice.NodeName: nodeName},
+	}
+	bd.FSInfo.FileSystem = "ext4"
+	bd.FSInfo.MountPoint = []string{mountPoint}
+	bd.Status.State = blockdevice.Active
+	return bd
+}
+
+func TestFilesystemCollector(t *testing.T) {
+	lister := &fakeLister{
+		blockDevices: []blockdevice.BlockDevice{
+			newMountedBlockDevice("blockdevice-1", "/dev/sdb", "node1", "/mnt/disk1"),
+			// not mounted
+			newMountedBlockDevice("blockdevice-2", "/dev/sdc", "node1", ""),
+			// on another node
+			newMountedBlockDevice("blockdevice-3", "/dev/sdb", "node2", "/mnt/disk1"),
+			// statfs fails
+			newMountedBlockDevice("blockdevice-4", "/dev/sdd", "node1", "/mnt/missing"),
+		},
+	}
+	fc := NewFilesystemMetricCollector(lister, "node1", "/host/root")
+	var statted []string
+	fc.statfs = func(path string) (fsmetrics.Usage, error) {
+		statted = append(statted, path)
+		if path == "/host/root/mnt/missing" {
+			return fsmetrics.Usage{}, fmt.Errorf("no such file or directory")
+		}
+		return fsmetrics.Usage{SizeBytes: 1000, FreeBytes: 400, AvailBytes: 300, Inodes: 100, InodesFree: 90}, nil
+	}
+
+	labels := `blockdevice="blockdevice-1",drive_type="",fstype="ext4",model="",mountpoint="/mnt/disk1",node="node1",path="sdb",serial_hash=""`
+	expected := `
+# HELP filesystem_avail_bytes Bytes free in the filesystem that are available to non-root users
+# TYPE filesystem_avail_bytes gauge
+filesystem_avail_bytes{` + labels + `} 300
+# HELP filesystem_used_bytes Bytes used in the filesystem
+# TYPE filesystem_used_bytes gauge
+filesystem_used_bytes{` + labels + `} 600
+# HELP filesystem_inodes_free No. of free inodes in the filesystem
+# TYPE filesystem_inodes_free gauge
+filesystem_inodes_free{` + labels + `} 90
+`
+	err := testutil.CollectAndCompare(fc, strings.NewReader(expected),
+		"filesystem_avail_bytes", "filesystem_used_bytes", "filesystem_inodes_free")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/host/root/mnt/disk1", "/host/root/mnt/missing"}, statted)
+
+	// the metrics of the unmounted filesystems are removed
+	lister.blockDevices = lister.blockDevices[1:]
+	assert.Equal(t, 2, testutil.CollectAndCount(fc))
+}
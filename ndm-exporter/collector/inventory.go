@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"github.com/openebs/node-disk-manager/db/kubernetes"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+)
+
+// metricsNamespace is the namespace of the inventory metrics
+const metricsNamespace = "ndm"
+
+var (
+	blockDeviceCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "blockdevices"),
+		"No. of blockdevices by node, state, claim state and drive type",
+		[]string{"nodename", "state", "claim_state", "drive_type"}, nil,
+	)
+	capacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "blockdevice_capacity_bytes"),
+		"Total capacity of the active blockdevices on the node",
+		[]string{"nodename"}, nil,
+	)
+	claimedCapacityDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "blockdevice_claimed_capacity_bytes"),
+		"Capacity of the active blockdevices on the node that are claimed",
+		[]string{"nodename"}, nil,
+	)
+	blockDeviceClaimCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "blockdeviceclaims"),
+		"No. of blockdevice claims by phase",
+		[]string{"phase"}, nil,
+	)
+	listFailuresDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "inventory_list_failed"),
+		"1 if the blockdevices or claims could not be listed for the last scrape",
+		nil, nil,
+	)
+)
+
+// InventoryMetricCollector lists the blockdevices and claims on every scrape, and
+// reports the inventory of the cluster computed from them. The info series of each
+// blockdevice and claim are also reported if the state metrics are enabled.
+type InventoryMetricCollector struct {
+	// Client is the k8s client used to list the blockdevices and claims
+	Client kubernetes.Client
+	// IsLeader checks if this replica of the exporter is the leader, like in
+	// StaticMetricCollector. Nil if there is only one replica.
+	IsLeader func() bool
+	// StateMetrics enables the info series of each blockdevice and claim
+	StateMetrics bool
+}
+
+// NewInventoryMetricCollector creates a new instance of InventoryMetricCollector.
+// isLeader is nil if leader election is disabled.
+func NewInventoryMetricCollector(c kubernetes.Client, isLeader func() bool, stateMetrics bool) prometheus.Collector {
+	klog.V(2).Infof("Inventory Metric Collector initialized")
+	return &InventoryMetricCollector{
+		Client:       c,
+		IsLeader:     isLeader,
+		StateMetrics: stateMetrics,
+	}
+}
+
+// Describe is the implementation of Describe in prometheus.Collector
+func (ic *InventoryMetricCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- blockDeviceCountDesc
+	ch <- capacityDesc
+	ch <- claimedCapacityDesc
+	ch <- blockDeviceClaimCountDesc
+	ch <- listFailuresDesc
+	if ic.StateMetrics {
+		ch <- blockDeviceInfoDesc
+		ch <- blockDeviceClaimInfoDesc
+	}
+}
+
+// blockDeviceKey are the labels by which the blockdevices are counted
+type blockDeviceKey struct {
+	nodeName, state, claimState, driveType string
+}
+
+// Collect is the implementation of Collect in prometheus.Collector. The
+// inventory is exported only by the leader.
+func (ic *InventoryMetricCollector) Collect(ch chan<- prometheus.Metric) {
+	if ic.IsLeader != nil && !ic.IsLeader() {
+		klog.V(4).Info("Not the leader, skipping the inventory metrics.")
+		return
+	}
+	listFailed := 0.0
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(listFailuresDesc, prometheus.GaugeValue, listFailed)
+	}()
+
+	bdList, err := ic.Client.ListBlockDeviceResources()
+	if err != nil {
+		klog.Errorf("unable to list blockdevices for inventory metrics: %v", err)
+		listFailed = 1
+		return
+	}
+	bdcList, err := ic.Client.ListBlockDeviceClaims()
+	if err != nil {
+		klog.Errorf("unable to list blockdevice claims for inventory metrics: %v", err)
+		listFailed = 1
+		return
+	}
+	if ic.StateMetrics {
+		collectState(ch, bdList, bdcList)
+	}
+
+	counts := make(map[blockDeviceKey]int)
+	capacity := make(map[string]uint64)
+	claimedCapacity := make(map[string]uint64)
+	for _, bd := range bdList.Items {
+		nodeName := bd.Spec.NodeAttributes.NodeName
+		counts[blockDeviceKey{
+			nodeName:   nodeName,
+			state:      string(bd.Status.State),
+			claimState: string(bd.Status.ClaimState),
+			driveType:  bd.Spec.Details.DriveType,
+		}]++
+		// only the active blockdevices are counted in the capacity of the node
+		if bd.Status.State != apis.BlockDeviceActive {
+			continue
+		}
+		capacity[nodeName] += bd.Spec.Capacity.Storage
+		if _, ok := claimedCapacity[nodeName]; !ok {
+			claimedCapacity[nodeName] = 0
+		}
+		if bd.Status.ClaimState == apis.BlockDeviceClaimed {
+			claimedCapacity[nodeName] += bd.Spec.Capacity.Storage
+		}
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(blockDeviceCountDesc, prometheus.GaugeValue, float64(count),
+			key.nodeName, key.state, key.claimState, key.driveType)
+	}
+	for nodeName, bytes := range capacity {
+		ch <- prometheus.MustNewConstMetric(capacityDesc, prometheus.GaugeValue, float64(bytes), nodeName)
+	}
+	for nodeName, bytes := range claimedCapacity {
+		ch <- prometheus.MustNewConstMetric(claimedCapacityDesc, prometheus.GaugeValue, float64(bytes), nodeName)
+	}
+
+	phases := make(map[apis.DeviceClaimPhase]int)
+	for _, bdc := range bdcList.Items {
+		phases[bdc.Status.Phase]++
+	}
+	for phase, count := range phases {
+		ch <- prometheus.MustNewConstMetric(blockDeviceClaimCountDesc, prometheus.GaugeValue, float64(count),
+			string(phase))
+	}
+}
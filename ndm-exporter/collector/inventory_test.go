@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/db/kubernetes"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newBlockDevice(name, nodeName string, state apis.BlockDeviceState,
+	claimState apis.DeviceClaimState, capacity uint64) *apis.BlockDevice {
+	bd := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openebs"},
+	}
+	bd.Spec.NodeAttributes.NodeName = nodeName
+	bd.Spec.Details.DriveType = "SSD"
+	bd.Spec.Capacity.Storage = capacity
+	bd.Status.State = state
+	bd.Status.ClaimState = claimState
+	return bd
+}
+
+func newBlockDeviceClaim(name string, phase apis.DeviceClaimPhase) *apis.BlockDeviceClaim {
+	bdc := &apis.BlockDeviceClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openebs"},
+	}
+	bdc.Status.Phase = phase
+	return bdc
+}
+
+func newInventoryClient(objs ...runtime.Object) kubernetes.Client {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{}, &apis.BlockDeviceList{},
+		&apis.BlockDeviceClaim{}, &apis.BlockDeviceClaimList{})
+	c := kubernetes.Client{}
+	c.SetClient(fake.NewFakeClientWithScheme(s, objs...))
+	return c
+}
+
+func TestInventoryMetricCollector(t *testing.T) {
+	c := newInventoryClient(
+		newBlockDevice("bd-1", "node1", apis.BlockDeviceActive, apis.BlockDeviceClaimed, 100),
+		newBlockDevice("bd-2", "node1", apis.BlockDeviceActive, apis.BlockDeviceUnclaimed, 200),
+		newBlockDevice("bd-3", "node1", apis.BlockDeviceInactive, apis.BlockDeviceUnclaimed, 400),
+		newBlockDevice("bd-4", "node2", apis.BlockDeviceActive, apis.BlockDeviceUnclaimed, 800),
+		newBlockDeviceClaim("bdc-1", apis.BlockDeviceClaimStatusDone),
+		newBlockDeviceClaim("bdc-2", apis.BlockDeviceClaimStatusPending),
+		newBlockDeviceClaim("bdc-3", apis.BlockDeviceClaimStatusPending),
+	)
+
+	expected := `
+# HELP ndm_blockdevice_capacity_bytes Total capacity of the active blockdevices on the node
+# TYPE ndm_blockdevice_capacity_bytes gauge
+ndm_blockdevice_capacity_bytes{nodename="node1"} 300
+ndm_blockdevice_capacity_bytes{nodename="node2"} 800
+# HELP ndm_blockdevice_claimed_capacity_bytes Capacity of the active blockdevices on the node that are claimed
+# TYPE ndm_blockdevice_claimed_capacity_bytes gauge
+ndm_blockdevice_claimed_capacity_bytes{nodename="node1"} 100
+ndm_blockdevice_claimed_capacity_bytes{nodename="node2"} 0
+# HELP ndm_blockdeviceclaims No. of blockdevice claims by phase
+# TYPE ndm_blockdeviceclaims gauge
+ndm_blockdeviceclaims{phase="Bound"} 1
+ndm_blockdeviceclaims{phase="Pending"} 2
+# HELP ndm_blockdevices No. of blockdevices by node, state, claim state and drive type
+# TYPE ndm_blockdevices gauge
+ndm_blockdevices{claim_state="Claimed",drive_type="SSD",nodename="node1",state="Active"} 1
+ndm_blockdevices{claim_state="Unclaimed",drive_type="SSD",nodename="node1",state="Active"} 1
+ndm_blockdevices{claim_state="Unclaimed",drive_type="SSD",nodename="node1",state="Inactive"} 1
+ndm_blockdevices{claim_state="Unclaimed",drive_type="SSD",nodename="node2",state="Active"} 1
+# HELP ndm_inventory_list_failed 1 if the blockdevices or claims could not be listed for the last scrape
+# TYPE ndm_inventory_list_failed gauge
+ndm_inventory_list_failed 0
+`
+	err := testutil.CollectAndCompare(NewInventoryMetricCollector(c, nil, false), strings.NewReader(expected))
+	assert.NoError(t, err)
+
+	// only the leader exports the inventory
+	notLeader := func() bool { return false }
+	assert.Equal(t, 0, testutil.CollectAndCount(NewInventoryMetricCollector(c, notLeader, false)))
+}
+
+func TestInventoryStateMetrics(t *testing.T) {
+	claimed := newBlockDevice("bd-1", "node1", apis.BlockDeviceActive, apis.BlockDeviceClaimed, 100*gi)
+	claimed.Spec.Path = "/dev/sdb"
+	claimed.Spec.Details.DeviceType = "disk"
+	claimed.Spec.ClaimRef = &v1.ObjectReference{Name: "bdc-1"}
+	bound := newBlockDeviceClaim("bdc-1", apis.BlockDeviceClaimStatusDone)
+	bound.Spec.BlockDeviceName = "bd-1"
+	bound.Spec.BlockDeviceNodeAttributes.NodeName = "node1"
+	bound.Spec.Resources.Requests = v1.ResourceList{apis.ResourceStorage: resource.MustParse("64Gi")}
+	pending := newBlockDeviceClaim("bdc-2", apis.BlockDeviceClaimStatusPending)
+	pending.Spec.BlockDeviceNodeAttributes.HostName = "host2"
+	pending.Spec.DeviceType = "disk"
+	c := newInventoryClient(claimed,
+		newBlockDevice("bd-2", "node2", apis.BlockDeviceInactive, apis.BlockDeviceUnclaimed, 20*ti),
+		bound, pending,
+	)
+
+	expected := `
+# HELP ndm_blockdevice_info Information about the blockdevice, always 1
+# TYPE ndm_blockdevice_info gauge
+ndm_blockdevice_info{blockdevice="bd-1",blockdeviceclaim="bdc-1",capacity_bucket="256Gi",claim_state="Claimed",device_type="disk",drive_type="SSD",namespace="openebs",node="node1",path="/dev/sdb",state="Active"} 1
+ndm_blockdevice_info{blockdevice="bd-2",blockdeviceclaim="",capacity_bucket="+Inf",claim_state="Unclaimed",device_type="",drive_type="SSD",namespace="openebs",node="node2",path="",state="Inactive"} 1
+# HELP ndm_blockdeviceclaim_info Information about the blockdevice claim, always 1
+# TYPE ndm_blockdeviceclaim_info gauge
+ndm_blockdeviceclaim_info{blockdevice="bd-1",blockdeviceclaim="bdc-1",capacity_bucket="64Gi",device_type="",namespace="openebs",node="node1",phase="Bound"} 1
+ndm_blockdeviceclaim_info{blockdevice="",blockdeviceclaim="bdc-2",capacity_bucket="",device_type="disk",namespace="openebs",node="host2",phase="Pending"} 1
+`
+	err := testutil.CollectAndCompare(NewInventoryMetricCollector(c, nil, true), strings.NewReader(expected),
+		"ndm_blockdevice_info", "ndm_blockdeviceclaim_info")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	gi = uint64(1) << 30
+	ti = uint64(1) << 40
+
+	// capacityBucketInf is the bucket of the capacities larger than all the buckets
+	capacityBucketInf = "+Inf"
+)
+
+// capacityBuckets are the upper bounds of the buckets in which the capacity of
+// the blockdevices and claims are reported, so that the capacities can be
+// grouped without a label value for each distinct capacity
+var capacityBuckets = []struct {
+	bound uint64
+	label string
+}{
+	{64 * gi, "64Gi"},
+	{256 * gi, "256Gi"},
+	{1 * ti, "1Ti"},
+	{4 * ti, "4Ti"},
+	{16 * ti, "16Ti"},
+}
+
+var (
+	blockDeviceInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "blockdevice_info"),
+		"Information about the blockdevice, always 1",
+		[]string{"blockdevice", "namespace", "node", "path", "state", "claim_state",
+			"drive_type", "device_type", "capacity_bucket", "blockdeviceclaim"}, nil,
+	)
+	blockDeviceClaimInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "blockdeviceclaim_info"),
+		"Information about the blockdevice claim, always 1",
+		[]string{"blockdeviceclaim", "namespace", "phase", "node", "blockdevice",
+			"device_type", "capacity_bucket"}, nil,
+	)
+)
+
+// collectState reports an info series for each blockdevice and claim, similar
+// to the metrics of the resources exported by kube-state-metrics
+func collectState(ch chan<- prometheus.Metric, bdList *apis.BlockDeviceList, bdcList *apis.BlockDeviceClaimList) {
+	for _, bd := range bdList.Items {
+		claim := ""
+		if bd.Spec.ClaimRef != nil {
+			claim = bd.Spec.ClaimRef.Name
+		}
+		ch <- prometheus.MustNewConstMetric(blockDeviceInfoDesc, prometheus.GaugeValue, 1,
+			bd.Name, bd.Namespace, bd.Spec.NodeAttributes.NodeName, bd.Spec.Path,
+			string(bd.Status.State), string(bd.Status.ClaimState), bd.Spec.Details.DriveType,
+			bd.Spec.Details.DeviceType, capacityBucket(bd.Spec.Capacity.Storage), claim)
+	}
+
+	for _, bdc := range bdcList.Items {
+		nodeName := bdc.Spec.BlockDeviceNodeAttributes.NodeName
+		if len(nodeName) == 0 {
+			nodeName = bdc.Spec.BlockDeviceNodeAttributes.HostName
+		}
+		var capacity uint64
+		if storage, ok := bdc.Spec.Resources.Requests[apis.ResourceStorage]; ok && storage.Value() > 0 {
+			capacity = uint64(storage.Value())
+		}
+		ch <- prometheus.MustNewConstMetric(blockDeviceClaimInfoDesc, prometheus.GaugeValue, 1,
+			bdc.Name, bdc.Namespace, string(bdc.Status.Phase), nodeName, bdc.Spec.BlockDeviceName,
+			bdc.Spec.DeviceType, capacityBucket(capacity))
+	}
+}
+
+// capacityBucket returns the smallest bucket which can hold the capacity, or
+// empty if the capacity is not known
+func capacityBucket(capacity uint64) string {
+	if capacity == 0 {
+		return ""
+	}
+	for _, bucket := range capacityBuckets {
+		if capacity <= bucket.bound {
+			return bucket.label
+		}
+	}
+	return capacityBucketInf
+}
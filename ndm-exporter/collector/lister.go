@@ -0,0 +1,189 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/mount"
+	"github.com/openebs/node-disk-manager/pkg/sysfs"
+	"k8s.io/klog"
+)
+
+// DeviceLister lists the blockdevices for which the metrics are collected.
+// The kubernetes client lists the blockdevice resources, while the local
+// lister discovers the devices on the node when running without kubernetes.
+type DeviceLister interface {
+	// InitClient is called before listing the devices on each collection
+	InitClient() error
+	// ListBlockDevice lists the blockdevices
+	ListBlockDevice(filters ...interface{}) ([]blockdevice.BlockDevice, error)
+}
+
+// ignoredDevicePrefixes are the prefixes of the names of the virtual devices that
+// are not listed by the local lister
+var ignoredDevicePrefixes = []string{"loop", "ram", "zram", "fd", "sr"}
+
+// mountsFile is the file from which the mountpoints of the devices are read
+var mountsFile = "/proc/self/mounts"
+
+// LocalDeviceLister discovers the blockdevices of the node from sysfs, so that
+// the exporter can run on nodes that are not part of a kubernetes cluster.
+// Only the disks are listed, and their partitions if enabled. The virtual devices
+// are skipped.
+type LocalDeviceLister struct {
+	// NodeName is set as the node name of the devices. The hostname is used if empty.
+	NodeName string
+	// Partitions lists the partitions of the disks along with the disks
+	Partitions bool
+}
+
+// InitClient implements DeviceLister. There is no client to be set.
+func (l *LocalDeviceLister) InitClient() error {
+	return nil
+}
+
+// ListBlockDevice implements DeviceLister. The filters are ignored. A device
+// whose details cannot be read is skipped, so that the metrics of the other
+// devices are still collected.
+func (l *LocalDeviceLister) ListBlockDevice(filters ...interface{}) ([]blockdevice.BlockDevice, error) {
+	devPaths, err := sysfs.ListBlockDevices()
+	if err != nil {
+		return nil, err
+	}
+	hostName, _ := os.Hostname()
+	nodeName := l.NodeName
+	if nodeName == "" {
+		nodeName = hostName
+	}
+
+	blockDevices := make([]blockdevice.BlockDevice, 0, len(devPaths))
+	for _, devPath := range devPaths {
+		if isIgnoredDevice(devPath) {
+			continue
+		}
+		bd, err := newLocalBlockDevice(devPath)
+		if err != nil {
+			klog.V(4).Infof("skipping device %s. %v", devPath, err)
+			continue
+		}
+		bd.NodeAttributes[blockdevice.HostName] = hostName
+		bd.NodeAttributes[blockdevice.NodeName] = nodeName
+		blockDevices = append(blockDevices, bd)
+		if !l.Partitions {
+			continue
+		}
+		for _, partitionPath := range bd.DependentDevices.Partitions {
+			partition, err := newLocalPartition(partitionPath, bd)
+			if err != nil {
+				klog.V(4).Infof("skipping partition %s. %v", partitionPath, err)
+				continue
+			}
+			blockDevices = append(blockDevices, partition)
+		}
+	}
+	return blockDevices, nil
+}
+
+func isIgnoredDevice(devPath string) bool {
+	name := strings.TrimPrefix(devPath, "/dev/")
+	for _, prefix := range ignoredDevicePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// newLocalBlockDevice fills the details of the disk from sysfs
+func newLocalBlockDevice(devPath string) (blockdevice.BlockDevice, error) {
+	bd := blockdevice.BlockDevice{}
+	device, err := sysfs.NewSysFsDeviceFromDevPath(devPath)
+	if err != nil {
+		return bd, err
+	}
+	deviceType, err := device.GetDeviceType(blockdevice.BlockDeviceTypeDisk)
+	if err != nil {
+		return bd, err
+	}
+	if deviceType != blockdevice.BlockDeviceTypeDisk {
+		return bd, fmt.Errorf("device type %s is not a disk", deviceType)
+	}
+	capacity, err := device.GetCapacityInBytes()
+	if err != nil {
+		return bd, err
+	}
+	// the drive type is not reported by all the devices
+	driveType, _ := device.GetDriveType()
+
+	bd.DevPath = devPath
+	bd.NodeAttributes = make(blockdevice.NodeAttribute)
+	bd.Capacity.Storage = uint64(capacity)
+	bd.DeviceAttributes = blockdevice.DeviceAttribute{
+		DeviceType: deviceType,
+		DriveType:  driveType,
+		Vendor:     device.GetVendor(),
+		Model:      device.GetModel(),
+		Serial:     device.GetSerial(),
+	}
+	bd.Status.State = blockdevice.Active
+	// the partitions of the disk are listed only if enabled, so an error is ignored
+	if dependents, err := device.GetDependents(); err == nil {
+		bd.DependentDevices.Partitions = dependents.Partitions
+	}
+	// the device is mounted only if it has a filesystem without partitions
+	setMountAttr(&bd)
+	return bd, nil
+}
+
+// newLocalPartition fills the details of the partition of the disk from sysfs. The
+// model, serial and drive type are those of the disk.
+func newLocalPartition(devPath string, disk blockdevice.BlockDevice) (blockdevice.BlockDevice, error) {
+	bd := blockdevice.BlockDevice{}
+	device, err := sysfs.NewSysFsDeviceFromDevPath(devPath)
+	if err != nil {
+		return bd, err
+	}
+	capacity, err := device.GetCapacityInBytes()
+	if err != nil {
+		return bd, err
+	}
+
+	bd.DevPath = devPath
+	bd.NodeAttributes = make(blockdevice.NodeAttribute)
+	for key, value := range disk.NodeAttributes {
+		bd.NodeAttributes[key] = value
+	}
+	bd.Capacity.Storage = uint64(capacity)
+	bd.DeviceAttributes = disk.DeviceAttributes
+	bd.DeviceAttributes.DeviceType = blockdevice.BlockDeviceTypePartition
+	bd.DependentDevices.Parent = disk.DevPath
+	bd.Status.State = blockdevice.Active
+	setMountAttr(&bd)
+	return bd, nil
+}
+
+// setMountAttr sets the filesystem and the mountpoint of the device, if mounted
+func setMountAttr(bd *blockdevice.BlockDevice) {
+	if mountAttr, err := mount.GetDeviceMountAttr(mountsFile, bd.DevPath); err == nil {
+		bd.FSInfo.FileSystem = mountAttr.FileSystem
+		bd.FSInfo.MountPoint = []string{mountAttr.MountPoint}
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	nvmemetrics "github.com/openebs/node-disk-manager/pkg/metrics/nvme"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+)
+
+// NVMeCollector contains the metrics, concurrency handler and client to get the
+// health log, the error log and the asynchronous events of the NVMe devices on the node
+type NVMeCollector struct {
+	// Client lists the blockdevices, from etcd or from the node when running
+	// without kubernetes
+	Client DeviceLister
+	// NodeName is the node whose devices are reported. Devices of all the
+	// nodes are reported if empty.
+	NodeName string
+
+	requestProgress
+
+	// all metrics collected from the NVMe health log
+	metrics *nvmemetrics.Metrics
+
+	// getHealthLog gets the health log of the device, used for mocking in tests
+	getHealthLog func(devPath string) (nvme.HealthLog, error)
+	// getErrorLog gets the error log of the device, used for mocking in tests
+	getErrorLog func(devPath string) ([]nvme.ErrorLogEntry, error)
+	// getAsyncEvents gets the counts of the asynchronous events of the controller of
+	// the device, used for mocking in tests
+	getAsyncEvents func(devPath string) (map[string]uint64, error)
+	// getSelfTestLog gets the device self-test log of the device, used for mocking in tests
+	getSelfTestLog func(devPath string) (nvme.SelfTestLog, error)
+
+	// schedule decides when the health log is collected
+	schedule *Schedule
+	// cache is the health log last collected from each device, keyed by the device path
+	cache map[string]nvmeCache
+}
+
+// nvmeCache is the health log last collected from a device, along with the
+// counters of the errors of the device
+type nvmeCache struct {
+	blockDevice blockdevice.BlockDevice
+	healthLog   nvme.HealthLog
+	time        time.Time
+	// lastErrorCount is the error count of the latest error log entry read
+	lastErrorCount uint64
+	// errors are the no. of error log entries read, keyed by the status code type
+	errors map[string]uint64
+	// asyncEvents are the counts of the asynchronous events of the controller,
+	// keyed by the type of the event
+	asyncEvents map[string]uint64
+	// selfTestLog is the device self-test log, nil if not supported by the device
+	selfTestLog  *nvme.SelfTestLog
+	selfTestTime time.Time
+}
+
+// NewNVMeMetricCollector creates a new instance of NVMeCollector which
+// implements Collector interface. The health log is collected from the devices
+// as per the schedule, and the asynchronous events are counted by events.
+func NewNVMeMetricCollector(c DeviceLister, nodeName string, schedule *Schedule,
+	events *nvme.AsyncEventCounter) prometheus.Collector {
+	klog.V(2).Infof("NVMe Metric Collector initialized")
+	return &NVMeCollector{
+		Client:         c,
+		NodeName:       nodeName,
+		metrics:        nvmemetrics.NewMetrics(),
+		getHealthLog:   nvme.GetHealthLog,
+		getErrorLog:    nvme.GetErrorLog,
+		getAsyncEvents: events.Counts,
+		getSelfTestLog: nvme.GetSelfTestLog,
+		schedule:       schedule,
+		cache:          make(map[string]nvmeCache),
+	}
+}
+
+// Describe is the implementation of Describe in prometheus.Collector
+func (nc *NVMeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range nc.metrics.Collectors() {
+		col.Describe(ch)
+	}
+	for _, desc := range nc.metrics.Descs() {
+		ch <- desc
+	}
+}
+
+// Collect is the implementation of Collect in prometheus.Collector
+func (nc *NVMeCollector) Collect(ch chan<- prometheus.Metric) {
+	klog.V(4).Info("Starting to collect nvme metrics for a request")
+
+	if !nc.start() {
+		nc.metrics.IncRejectRequestCounter()
+		return
+	}
+	defer nc.done()
+
+	// set the client each time
+	if err := nc.Client.InitClient(); err != nil {
+		klog.Errorf("error setting client. %v", err)
+		nc.metrics.IncErrorRequestCounter()
+		nc.collectErrors(ch)
+		return
+	}
+
+	// get list of blockdevices from etcd
+	blockDevices, err := nc.Client.ListBlockDevice()
+	if err != nil {
+		klog.Errorf("Listing block devices failed %v", err)
+		nc.metrics.IncErrorRequestCounter()
+		nc.collectErrors(ch)
+		return
+	}
+
+	if err = nc.setMetricData(blockDevices); err != nil {
+		klog.Error(err)
+		nc.metrics.IncErrorRequestCounter()
+		nc.collectErrors(ch)
+		return
+	}
+
+	// collect each metric
+	for _, col := range nc.metrics.Collectors() {
+		col.Collect(ch)
+	}
+	for _, cache := range nc.cache {
+		for _, metric := range nc.metrics.ErrorLogMetrics(cache.blockDevice, cache.errors) {
+			ch <- metric
+		}
+		for _, metric := range nc.metrics.AsyncEventMetrics(cache.blockDevice, cache.asyncEvents) {
+			ch <- metric
+		}
+	}
+}
+
+// collectErrors collects only the error metrics and set it on the channel
+func (nc *NVMeCollector) collectErrors(ch chan<- prometheus.Metric) {
+	for _, col := range nc.metrics.ErrorCollectors() {
+		col.Collect(ch)
+	}
+}
+
+// setMetricData gets the health log of the active NVMe blockdevices of the node and
+// sets it on the prometheus metrics. The health log, the error log, the asynchronous
+// events and the self-test log are read from the device only if they are due as
+// per the schedule. An error is returned only if the health log could not be read
+// from any of the devices.
+func (nc *NVMeCollector) setMetricData(blockDevices []blockdevice.BlockDevice) error {
+	nc.metrics.Reset()
+	nodeDevices := make([]blockdevice.BlockDevice, 0)
+	for _, bd := range blockDevices {
+		if nc.NodeName != "" && bd.NodeAttributes[blockdevice.NodeName] != nc.NodeName {
+			continue
+		}
+		if bd.DeviceAttributes.DeviceType == blockdevice.SparseBlockDeviceType {
+			continue
+		}
+		nodeDevices = append(nodeDevices, bd)
+	}
+	if !nc.schedule.Enabled(FamilyNVMe, len(nodeDevices)) {
+		nc.cache = make(map[string]nvmeCache)
+		return nil
+	}
+	selfTestEnabled := nc.schedule.Enabled(FamilySelfTest, len(nodeDevices))
+
+	devices, failed := 0, 0
+	paths := make(map[string]bool)
+	for _, bd := range nodeDevices {
+		if !nvme.IsNVMe(bd.DevPath) || bd.Status.State != blockdevice.Active ||
+			bd.DeviceAttributes.DeviceType == blockdevice.BlockDeviceTypePartition {
+			continue
+		}
+		devices++
+		paths[bd.DevPath] = true
+		cache, ok := nc.cache[bd.DevPath]
+		if !ok || nc.schedule.Due(FamilyNVMe, cache.time) {
+			healthLog, err := nc.getHealthLog(bd.DevPath)
+			if err != nil {
+				klog.Errorf("fetching nvme health log for %s failed. %v", bd.DevPath, err)
+				failed++
+				continue
+			}
+			cache.healthLog, cache.time = healthLog, time.Now()
+			nc.readErrors(bd.DevPath, &cache)
+		}
+		if !selfTestEnabled {
+			cache.selfTestLog = nil
+		} else if nc.schedule.Due(FamilySelfTest, cache.selfTestTime) {
+			nc.readSelfTestLog(bd.DevPath, &cache)
+		}
+		cache.blockDevice = bd
+		nc.cache[bd.DevPath] = cache
+		nc.metrics.SetMetrics(bd, cache.healthLog)
+		if cache.selfTestLog != nil {
+			nc.metrics.SetSelfTestMetrics(bd, *cache.selfTestLog, cache.healthLog.PowerOnHours)
+		}
+	}
+	// remove the health log of the devices that are no longer present
+	for path := range nc.cache {
+		if !paths[path] {
+			delete(nc.cache, path)
+		}
+	}
+	if devices != 0 && failed == devices {
+		return fmt.Errorf("getting nvme health log for the blockdevices failed")
+	}
+	return nil
+}
+
+// readErrors reads the new entries of the error log and the counts of the
+// asynchronous events of the device, and updates the counters of the errors in
+// the cache. The errors are not read if the device does not support them.
+func (nc *NVMeCollector) readErrors(devPath string, cache *nvmeCache) {
+	if cache.errors == nil {
+		cache.errors = make(map[string]uint64)
+	}
+	entries, err := nc.getErrorLog(devPath)
+	if err != nil {
+		klog.V(4).Infof("fetching nvme error log for %s failed. %v", devPath, err)
+	}
+	latest := cache.lastErrorCount
+	for _, entry := range entries {
+		// the entries that were already counted have a lower error count
+		if entry.ErrorCount <= cache.lastErrorCount {
+			continue
+		}
+		cache.errors[entry.StatusCodeType()]++
+		if entry.ErrorCount > latest {
+			latest = entry.ErrorCount
+		}
+	}
+	cache.lastErrorCount = latest
+
+	events, err := nc.getAsyncEvents(devPath)
+	if err != nil {
+		klog.V(4).Infof("fetching nvme async events for %s failed. %v", devPath, err)
+		cache.asyncEvents = nil
+		return
+	}
+	cache.asyncEvents = events
+}
+
+// readSelfTestLog reads the device self-test log of the device into the cache. The
+// log is not set if the device does not support it.
+func (nc *NVMeCollector) readSelfTestLog(devPath string, cache *nvmeCache) {
+	cache.selfTestTime = time.Now()
+	log, err := nc.getSelfTestLog(devPath)
+	if err != nil {
+		klog.V(4).Infof("fetching nvme self-test log for %s failed. %v", devPath, err)
+		cache.selfTestLog = nil
+		return
+	}
+	cache.selfTestLog = &log
+}
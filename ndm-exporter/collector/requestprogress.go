@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"sync"
+
+	"k8s.io/klog"
+)
+
+// requestProgress tracks the request being collected by a collector. When a
+// second request comes while the first one is in progress, the second request
+// is rejected, so that the requests do not pile up on the devices.
+type requestProgress struct {
+	mutex      sync.Mutex
+	inProgress bool
+}
+
+// start marks a request as in progress. It returns false if another request
+// is already in progress, in which case the request is to be rejected.
+func (rp *requestProgress) start() bool {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	if rp.inProgress {
+		klog.V(4).Info("Another request already in progress.")
+		return false
+	}
+	rp.inProgress = true
+	return true
+}
+
+// done marks the request as processed or errored
+func (rp *requestProgress) done() {
+	rp.mutex.Lock()
+	defer rp.mutex.Unlock()
+	rp.inProgress = false
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Family is a family of metrics that are collected together
+type Family string
+
+const (
+	// FamilyTemperature are the temperature metrics collected using seachest
+	FamilyTemperature Family = "temperature"
+	// FamilyEndurance are the utilization, endurance and bytes read/written
+	// metrics collected using seachest
+	FamilyEndurance Family = "endurance"
+	// FamilyNVMe are the metrics from the NVMe health log
+	FamilyNVMe Family = "nvme"
+	// FamilyDiskStats are the IO statistics from /proc/diskstats
+	FamilyDiskStats Family = "diskstats"
+	// FamilySelfTest are the results of the self-tests from the NVMe device
+	// self-test log
+	FamilySelfTest Family = "selftest"
+	// FamilyFilesystem are the capacity and inodes of the mounted filesystems
+	FamilyFilesystem Family = "filesystem"
+	// FamilyFailureRisk are the failure indicators from the ATA SMART attributes,
+	// and the risk of failure scored from them
+	FamilyFailureRisk Family = "failurerisk"
+)
+
+// families are all the metric families that can be scheduled
+var families = []Family{FamilyTemperature, FamilyEndurance, FamilyNVMe, FamilyDiskStats, FamilySelfTest,
+	FamilyFilesystem, FamilyFailureRisk}
+
+// expensiveFamilies are the families which send commands to each device, and
+// are disabled on nodes having more devices than the device limit
+var expensiveFamilies = map[Family]bool{
+	FamilyTemperature: true,
+	FamilyEndurance:   true,
+	FamilyNVMe:        true,
+	FamilySelfTest:    true,
+	FamilyFailureRisk: true,
+}
+
+// Schedule decides when each family of metrics is collected from the devices
+type Schedule struct {
+	// Intervals are the min. time between the collections of a family from a
+	// device. A family without an interval is collected on every scrape.
+	Intervals map[Family]time.Duration
+	// Disabled are the families which are not collected
+	Disabled map[Family]bool
+	// DeviceLimit is the max. no. of devices on the node for which the
+	// expensive families are collected. No limit if 0.
+	DeviceLimit int
+}
+
+// NewSchedule returns the schedule from the intervals and the disabled families
+// given as flags
+func NewSchedule(intervals map[string]string, disabled []string, deviceLimit int) (*Schedule, error) {
+	schedule := &Schedule{
+		Intervals:   make(map[Family]time.Duration),
+		Disabled:    make(map[Family]bool),
+		DeviceLimit: deviceLimit,
+	}
+	for name, value := range intervals {
+		family, err := getFamily(name)
+		if err != nil {
+			return nil, err
+		}
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid collection interval %q of %s: %v", value, name, err)
+		}
+		schedule.Intervals[family] = interval
+	}
+	for _, name := range disabled {
+		family, err := getFamily(name)
+		if err != nil {
+			return nil, err
+		}
+		schedule.Disabled[family] = true
+	}
+	return schedule, nil
+}
+
+// getFamily returns the family with the name
+func getFamily(name string) (Family, error) {
+	for _, family := range families {
+		if string(family) == name {
+			return family, nil
+		}
+	}
+	return "", fmt.Errorf("unknown metric family %q, should be one of %v", name, families)
+}
+
+// Enabled returns true if the family is collected on a node with the given
+// no. of devices
+func (s *Schedule) Enabled(family Family, devices int) bool {
+	if s == nil {
+		return true
+	}
+	if s.Disabled[family] {
+		return false
+	}
+	if expensiveFamilies[family] && s.DeviceLimit > 0 && devices > s.DeviceLimit {
+		klog.V(4).Infof("%s metrics not collected, %d devices are more than the limit %d",
+			family, devices, s.DeviceLimit)
+		return false
+	}
+	return true
+}
+
+// Due returns true if the family has to be collected from a device, on which
+// it was last collected at the given time
+func (s *Schedule) Due(family Family, last time.Time) bool {
+	if s == nil || last.IsZero() {
+		return true
+	}
+	return time.Since(last) >= s.Intervals[family]
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSchedule(t *testing.T) {
+	tests := map[string]struct {
+		intervals map[string]string
+		disabled  []string
+		want      *Schedule
+		wantErr   bool
+	}{
+		"no intervals or disabled families": {
+			want: &Schedule{
+				Intervals: map[Family]time.Duration{},
+				Disabled:  map[Family]bool{},
+			},
+		},
+		"intervals and disabled families": {
+			intervals: map[string]string{"temperature": "1m", "nvme": "5m"},
+			disabled:  []string{"endurance"},
+			want: &Schedule{
+				Intervals: map[Family]time.Duration{
+					FamilyTemperature: time.Minute,
+					FamilyNVMe:        5 * time.Minute,
+				},
+				Disabled: map[Family]bool{FamilyEndurance: true},
+			},
+		},
+		"unknown family in intervals": {
+			intervals: map[string]string{"power": "1m"},
+			wantErr:   true,
+		},
+		"invalid interval": {
+			intervals: map[string]string{"temperature": "1x"},
+			wantErr:   true,
+		},
+		"unknown disabled family": {
+			disabled: []string{"power"},
+			wantErr:  true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewSchedule(test.intervals, test.disabled, 0)
+			assert.Equal(t, test.wantErr, err != nil)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestScheduleEnabled(t *testing.T) {
+	schedule := &Schedule{
+		Disabled:    map[Family]bool{FamilyEndurance: true},
+		DeviceLimit: 2,
+	}
+	assert.True(t, schedule.Enabled(FamilyTemperature, 2))
+	assert.False(t, schedule.Enabled(FamilyTemperature, 3))
+	assert.False(t, schedule.Enabled(FamilyEndurance, 1))
+	// diskstats is read from procfs and is not limited by the no. of devices
+	assert.True(t, schedule.Enabled(FamilyDiskStats, 3))
+
+	var nilSchedule *Schedule
+	assert.True(t, nilSchedule.Enabled(FamilyNVMe, 100))
+}
+
+func TestScheduleDue(t *testing.T) {
+	schedule := &Schedule{
+		Intervals: map[Family]time.Duration{FamilyEndurance: time.Hour},
+	}
+	assert.True(t, schedule.Due(FamilyEndurance, time.Time{}))
+	assert.False(t, schedule.Due(FamilyEndurance, time.Now().Add(-time.Minute)))
+	assert.True(t, schedule.Due(FamilyEndurance, time.Now().Add(-2*time.Hour)))
+	// families without an interval are collected every time
+	assert.True(t, schedule.Due(FamilyTemperature, time.Now()))
+}
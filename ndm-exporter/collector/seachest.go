@@ -18,12 +18,12 @@ package collector
 
 import (
 	"fmt"
-	"sync"
+	"time"
 
 	"github.com/openebs/node-disk-manager/blockdevice"
-	"github.com/openebs/node-disk-manager/db/kubernetes"
 	smartmetrics "github.com/openebs/node-disk-manager/pkg/metrics/smart"
 	"github.com/openebs/node-disk-manager/pkg/seachest"
+	"github.com/openebs/node-disk-manager/pkg/wear"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/klog"
@@ -38,15 +38,32 @@ const (
 // SeachestCollector contains the metrics, concurrency handler and client to get the
 // metrics from seachest
 type SeachestCollector struct {
-	// Client is the k8s client which will be used to interface with etcd
-	Client kubernetes.Client
+	// Client lists the blockdevices, from etcd or from the node when running
+	// without kubernetes
+	Client DeviceLister
 
-	// concurrency handling
-	sync.Mutex
-	requestInProgress bool
+	requestProgress
 
 	// all metrics collected via seachest
 	metrics *smartmetrics.Metrics
+
+	// schedule decides when the temperature and endurance are collected
+	schedule *Schedule
+	// cache is the last collected data of each device, keyed by the device path
+	cache map[string]*seachestCache
+	// wear tracks the endurance used by the SSDs. Disabled if nil.
+	wear *wear.Tracker
+}
+
+// seachestCache is the data last collected from a device using seachest
+type seachestCache struct {
+	SeachestMetricData
+	// temperatureTime and enduranceTime are the times at which the
+	// temperature and the endurance were last collected
+	temperatureTime time.Time
+	enduranceTime   time.Time
+	// wearHistory is the history of the endurance used, if the device is tracked
+	wearHistory *wear.History
 }
 
 // SeachestMetricData is the struct which holds the data from seachest library
@@ -62,12 +79,17 @@ type SeachestMetricData struct {
 }
 
 // NewSeachestMetricCollector creates a new instance of SeachestCollector which
-// implements Collector interface
-func NewSeachestMetricCollector(c kubernetes.Client) prometheus.Collector {
+// implements Collector interface. The metrics are collected from the devices
+// as per the schedule. The endurance used by the SSDs is tracked by the wear tracker,
+// if it is not nil, to estimate the days to their wear out.
+func NewSeachestMetricCollector(c DeviceLister, schedule *Schedule, wearTracker *wear.Tracker) prometheus.Collector {
 	klog.V(2).Infof("Seachest Metric Collector initialized")
 	sc := &SeachestCollector{
-		Client:  c,
-		metrics: smartmetrics.NewMetrics(SeachestCollectorNamespace),
+		Client:   c,
+		metrics:  smartmetrics.NewMetrics(SeachestCollectorNamespace),
+		schedule: schedule,
+		cache:    make(map[string]*seachestCache),
+		wear:     wearTracker,
 	}
 	sc.metrics.WithBlockDeviceCurrentTemperature().
 		WithBlockDeviceCurrentTemperatureValid().
@@ -80,6 +102,7 @@ func NewSeachestMetricCollector(c kubernetes.Client) prometheus.Collector {
 		WithBlockDeviceTotalBytesWritten().
 		WithBlockDeviceUtilizationRate().
 		WithBlockDevicePercentEnduranceUsed().
+		WithBlockDeviceDaysToWearOut().
 		WithRejectRequest().
 		WithErrorRequest()
 	return sc
@@ -96,19 +119,11 @@ func (sc *SeachestCollector) Describe(ch chan<- *prometheus.Desc) {
 func (sc *SeachestCollector) Collect(ch chan<- prometheus.Metric) {
 	klog.V(4).Info("Starting to collect smartmetrics metrics for a request")
 
-	sc.Lock()
-	if sc.requestInProgress {
-		klog.V(4).Info("Another request already in progress.")
+	if !sc.start() {
 		sc.metrics.IncRejectRequestCounter()
-		sc.Unlock()
 		return
 	}
-
-	sc.requestInProgress = true
-	sc.Unlock()
-
-	// once a request is processed, set the progress flag to false
-	defer sc.setRequestProgressToFalse()
+	defer sc.done()
 
 	klog.V(4).Info("Setting client for this request.")
 
@@ -131,7 +146,7 @@ func (sc *SeachestCollector) Collect(ch chan<- prometheus.Metric) {
 
 	klog.V(4).Info("Blockdevices fetched from etcd")
 
-	err = getMetricData(blockDevices)
+	err = sc.getMetricData(blockDevices)
 	if err != nil {
 		sc.metrics.IncErrorRequestCounter()
 		sc.collectErrors(ch)
@@ -150,14 +165,6 @@ func (sc *SeachestCollector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-// setRequestProgressToFalse is used to set the progress flag, when a request is
-// processed or errored
-func (sc *SeachestCollector) setRequestProgressToFalse() {
-	sc.Lock()
-	sc.requestInProgress = false
-	sc.Unlock()
-}
-
 // collectErrors collects only the error metrics and set it on the channel
 func (sc *SeachestCollector) collectErrors(ch chan<- prometheus.Metric) {
 	for _, col := range sc.metrics.ErrorCollectors() {
@@ -165,35 +172,89 @@ func (sc *SeachestCollector) collectErrors(ch chan<- prometheus.Metric) {
 	}
 }
 
-// getMetricData gets the seachest metrics for each blockdevice and fills it in the blockdevice struct
-func getMetricData(bds []blockdevice.BlockDevice) error {
+// getMetricData gets the seachest metrics for each blockdevice and fills it in the blockdevice struct.
+// The data is collected from the device only if the temperature or the endurance is due as per the
+// schedule, else the data last collected from the device is used.
+func (sc *SeachestCollector) getMetricData(bds []blockdevice.BlockDevice) error {
+	devices := 0
+	for _, bd := range bds {
+		if bd.DeviceAttributes.DeviceType != blockdevice.SparseBlockDeviceType {
+			devices++
+		}
+	}
+	temperatureEnabled := sc.schedule.Enabled(FamilyTemperature, devices)
+	enduranceEnabled := sc.schedule.Enabled(FamilyEndurance, devices)
+	if !temperatureEnabled && !enduranceEnabled {
+		return nil
+	}
+
 	var err error
 	ok := false
+	paths := make(map[string]bool)
+	uuids := make(map[string]bool)
 	for i, bd := range bds {
 		// do not report metrics for sparse devices
 		if bd.DeviceAttributes.DeviceType == blockdevice.SparseBlockDeviceType {
 			continue
 		}
-		sc := SeachestMetricData{
-			SeachestIdentifier: &seachest.Identifier{
-				DevPath: bd.DevPath,
-			},
+		paths[bd.DevPath] = true
+		uuids[bd.UUID] = true
+		cache, found := sc.cache[bd.DevPath]
+		if !found {
+			cache = &seachestCache{}
 		}
-		err = sc.getSeachestData()
-		if err != nil {
-			klog.Errorf("fetching seachest data for %s failed. %v", bd.DevPath, err)
-			continue
+		temperatureDue := temperatureEnabled && sc.schedule.Due(FamilyTemperature, cache.temperatureTime)
+		enduranceDue := enduranceEnabled && sc.schedule.Due(FamilyEndurance, cache.enduranceTime)
+		if temperatureDue || enduranceDue {
+			data := SeachestMetricData{
+				SeachestIdentifier: &seachest.Identifier{
+					DevPath: bd.DevPath,
+				},
+			}
+			err = data.getSeachestData()
+			if err != nil {
+				klog.Errorf("fetching seachest data for %s failed. %v", bd.DevPath, err)
+				continue
+			}
+			now := time.Now()
+			cache.Capacity = data.Capacity
+			if temperatureDue {
+				cache.TempInfo = data.TempInfo
+				cache.temperatureTime = now
+			}
+			if enduranceDue {
+				cache.TotalBytesRead = data.TotalBytesRead
+				cache.TotalBytesWritten = data.TotalBytesWritten
+				cache.DeviceUtilization = data.DeviceUtilization
+				cache.PercentEnduranceUsed = data.PercentEnduranceUsed
+				cache.enduranceTime = now
+				// devices that do not report the endurance used are not tracked
+				if sc.wear != nil && bd.DeviceAttributes.DriveType == blockdevice.DriveTypeSSD &&
+					data.PercentEnduranceUsed > 0 {
+					cache.wearHistory = sc.wear.Record(bd, data.PercentEnduranceUsed)
+				}
+			}
+			sc.cache[bd.DevPath] = cache
 		}
 		ok = true
 
-		bds[i].SMARTInfo.TemperatureInfo = sc.TempInfo
-		bds[i].Capacity.Storage = sc.Capacity
-		bds[i].SMARTInfo.TotalBytesRead = sc.TotalBytesRead
-		bds[i].SMARTInfo.TotalBytesWritten = sc.TotalBytesWritten
-		bds[i].SMARTInfo.UtilizationRate = sc.DeviceUtilization
-		bds[i].SMARTInfo.PercentEnduranceUsed = sc.PercentEnduranceUsed
+		bds[i].SMARTInfo.TemperatureInfo = cache.TempInfo
+		bds[i].Capacity.Storage = cache.Capacity
+		bds[i].SMARTInfo.TotalBytesRead = cache.TotalBytesRead
+		bds[i].SMARTInfo.TotalBytesWritten = cache.TotalBytesWritten
+		bds[i].SMARTInfo.UtilizationRate = cache.DeviceUtilization
+		bds[i].SMARTInfo.PercentEnduranceUsed = cache.PercentEnduranceUsed
 
 	}
+	// remove the data of the devices that are no longer present
+	for path := range sc.cache {
+		if !paths[path] {
+			delete(sc.cache, path)
+		}
+	}
+	if sc.wear != nil {
+		sc.wear.Retain(uuids)
+	}
 	if !ok {
 		return fmt.Errorf("getting seachest metrics for the blockdevices failed")
 	}
@@ -237,23 +298,41 @@ func (sc *SeachestMetricData) getSeachestData() error {
 // the prometheus metrics
 func (sc *SeachestCollector) setMetricData(blockdevices []blockdevice.BlockDevice) {
 	for _, bd := range blockdevices {
+		// only the families collected from the device are set
+		cache, ok := sc.cache[bd.DevPath]
+		if !ok {
+			continue
+		}
 		// sets the label values
 		sc.metrics.WithBlockDeviceUUID(bd.UUID).
 			WithBlockDevicePath(bd.DevPath).
 			WithBlockDeviceHostName(bd.NodeAttributes[blockdevice.HostName]).
-			WithBlockDeviceNodeName(bd.NodeAttributes[blockdevice.NodeName])
+			WithBlockDeviceNodeName(bd.NodeAttributes[blockdevice.NodeName]).
+			WithBlockDeviceModel(bd.DeviceAttributes.Model).
+			WithBlockDeviceSerial(bd.DeviceAttributes.Serial).
+			WithBlockDeviceDriveType(bd.DeviceAttributes.DriveType)
 		// sets the metrics
-		sc.metrics.SetBlockDeviceCurrentTemperature(bd.SMARTInfo.TemperatureInfo.CurrentTemperature).
-			SetBlockDeviceHighestTemperature(bd.SMARTInfo.TemperatureInfo.HighestTemperature).
-			SetBlockDeviceLowestTemperature(bd.SMARTInfo.TemperatureInfo.LowestTemperature).
-			SetBlockDeviceCurrentTemperatureValid(bd.SMARTInfo.TemperatureInfo.CurrentTemperatureDataValid).
-			SetBlockDeviceHighestTemperatureValid(bd.SMARTInfo.TemperatureInfo.HighestTemperatureDataValid).
-			SetBlockDeviceLowestTemperatureValid(bd.SMARTInfo.TemperatureInfo.LowestTemperatureDataValid).
-			SetBlockDeviceCapacity(bd.Capacity.Storage).
-			SetBlockDeviceUtilizationRate(bd.SMARTInfo.UtilizationRate).
-			SetBlockDeviceTotalBytesRead(bd.SMARTInfo.TotalBytesRead).
-			SetBlockDeviceTotalBytesWritten(bd.SMARTInfo.TotalBytesWritten).
-			SetBlockDevicePercentEnduranceUsed(bd.SMARTInfo.PercentEnduranceUsed)
-
+		sc.metrics.SetBlockDeviceCapacity(bd.Capacity.Storage)
+		if !cache.temperatureTime.IsZero() {
+			sc.metrics.SetBlockDeviceCurrentTemperature(bd.SMARTInfo.TemperatureInfo.CurrentTemperature).
+				SetBlockDeviceHighestTemperature(bd.SMARTInfo.TemperatureInfo.HighestTemperature).
+				SetBlockDeviceLowestTemperature(bd.SMARTInfo.TemperatureInfo.LowestTemperature).
+				SetBlockDeviceCurrentTemperatureValid(bd.SMARTInfo.TemperatureInfo.CurrentTemperatureDataValid).
+				SetBlockDeviceHighestTemperatureValid(bd.SMARTInfo.TemperatureInfo.HighestTemperatureDataValid).
+				SetBlockDeviceLowestTemperatureValid(bd.SMARTInfo.TemperatureInfo.LowestTemperatureDataValid)
+		}
+		if !cache.enduranceTime.IsZero() {
+			sc.metrics.SetBlockDeviceUtilizationRate(bd.SMARTInfo.UtilizationRate).
+				SetBlockDeviceTotalBytesRead(bd.SMARTInfo.TotalBytesRead).
+				SetBlockDeviceTotalBytesWritten(bd.SMARTInfo.TotalBytesWritten).
+				SetBlockDevicePercentEnduranceUsed(bd.SMARTInfo.PercentEnduranceUsed)
+		}
+		if cache.wearHistory != nil {
+			if days, ok := cache.wearHistory.DaysToWearOut(); ok {
+				sc.metrics.SetBlockDeviceDaysToWearOut(days)
+			} else {
+				sc.metrics.DeleteBlockDeviceDaysToWearOut()
+			}
+		}
 	}
 }
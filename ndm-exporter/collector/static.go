@@ -17,8 +17,6 @@ limitations under the License.
 package collector
 
 import (
-	"sync"
-
 	"github.com/openebs/node-disk-manager/db/kubernetes"
 	"github.com/openebs/node-disk-manager/pkg/metrics/static"
 
@@ -31,33 +29,29 @@ import (
 type StaticMetricCollector struct {
 	// Client is the k8s client which will be used to interface with etcd
 	Client kubernetes.Client
+	// IsLeader checks if this replica of the exporter is the leader. Only the
+	// leader exports the metrics of the blockdevices, so that they are not
+	// duplicated when the exporter has more than one replica. Nil if there is
+	// only one replica.
+	IsLeader func() bool
 
-	// concurrency handling
-	sync.Mutex
-	requestInProgress bool
+	requestProgress
 
 	// all the exposed metrics
 	metrics *static.Metrics
 }
 
 // NewStaticMetricCollector creates a new instance of StaticMetricCollector which
-// implements Collector interface
-func NewStaticMetricCollector(c kubernetes.Client) prometheus.Collector {
+// implements Collector interface. isLeader is nil if leader election is disabled.
+func NewStaticMetricCollector(c kubernetes.Client, isLeader func() bool) prometheus.Collector {
 	klog.V(2).Infof("Static Metric Collector initialized")
 	return &StaticMetricCollector{
-		Client:  c,
-		metrics: static.NewMetrics(),
+		Client:   c,
+		IsLeader: isLeader,
+		metrics:  static.NewMetrics(),
 	}
 }
 
-// setRequestProgressToFalse is used to set the progress flag, when a request is
-// processed or errored
-func (mc *StaticMetricCollector) setRequestProgressToFalse() {
-	mc.Lock()
-	mc.requestInProgress = false
-	mc.Unlock()
-}
-
 // Describe is the implementation of Describe in prometheus.Collector
 func (mc *StaticMetricCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, col := range mc.metrics.Collectors() {
@@ -70,21 +64,18 @@ func (mc *StaticMetricCollector) Collect(ch chan<- prometheus.Metric) {
 
 	klog.V(4).Info("Starting to collect metrics for a request")
 
-	// when a second request comes, and the first one is already in progress,
-	// ignore/reject the second request
-	mc.Lock()
-	if mc.requestInProgress {
-		klog.V(4).Info("Another request already in progress.")
+	if !mc.start() {
 		mc.metrics.IncRejectRequestCounter()
-		mc.Unlock()
 		return
 	}
+	defer mc.done()
 
-	mc.requestInProgress = true
-	mc.Unlock()
-
-	// once a request is processed, set the progress flag to false
-	defer mc.setRequestProgressToFalse()
+	// the blockdevices are exported by the leader
+	if mc.IsLeader != nil && !mc.IsLeader() {
+		klog.V(4).Info("Not the leader, skipping the blockdevice metrics.")
+		mc.collectErrors(ch)
+		return
+	}
 
 	klog.V(4).Info("Setting client for this request.")
 
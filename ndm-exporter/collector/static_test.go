@@ -0,0 +1,33 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/openebs/node-disk-manager/db/kubernetes"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticCollectorNotLeader(t *testing.T) {
+	// the client is not used if this replica is not the leader
+	sc := NewStaticMetricCollector(kubernetes.Client{}, func() bool { return false })
+
+	// only the request counters are exported
+	assert.Equal(t, 2, testutil.CollectAndCount(sc))
+}
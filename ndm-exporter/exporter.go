@@ -17,12 +17,22 @@ limitations under the License.
 package ndm_exporter
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/openebs/node-disk-manager/db/kubernetes"
 	"github.com/openebs/node-disk-manager/ndm-exporter/collector"
+	"github.com/openebs/node-disk-manager/pkg/failurerisk"
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+	"github.com/openebs/node-disk-manager/pkg/metrics/openmetrics"
+	"github.com/openebs/node-disk-manager/pkg/metrics/push"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
 	"github.com/openebs/node-disk-manager/pkg/server"
 	"github.com/openebs/node-disk-manager/pkg/version"
+	"github.com/openebs/node-disk-manager/pkg/wear"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/klog"
@@ -34,6 +44,48 @@ type Exporter struct {
 	Client kubernetes.Client
 	Mode   string
 	Server server.Server
+	// DiskStatsInterval is the interval at which the IO statistics of the
+	// devices are sampled by the node level exporter. Disabled if 0.
+	DiskStatsInterval time.Duration
+	// CollectionIntervals are the min. intervals between the collections of each
+	// family of metrics from a device, keyed by the family name
+	CollectionIntervals map[string]string
+	// DisabledCollections are the families of metrics that are not collected
+	DisabledCollections []string
+	// DeviceLimit is the max. no. of devices on a node for which the metrics are
+	// collected by sending commands to each device. No limit if 0.
+	DeviceLimit int
+	// MetricsFilter is the config of the metric families and labels that are exposed
+	MetricsFilter filter.Config
+	// Push is the config of the endpoint to which the metrics are pushed, for the
+	// clusters in which the exporter cannot be scraped
+	Push push.Config
+	// PushOnly disables the metrics endpoint, and the metrics are only pushed
+	PushOnly bool
+	// WearSampleInterval is the min. interval between the samples of the endurance
+	// used by the SSDs, from which the days to wear out are estimated. Disabled if 0.
+	WearSampleInterval time.Duration
+	// HostRoot is the path at which the root filesystem of the host is mounted in
+	// the exporter. The filesystem metrics are collected in node mode only if set.
+	HostRoot string
+	// FailurePrediction enables scoring the risk of failure of the ATA devices
+	// from the SMART attributes in node mode
+	FailurePrediction bool
+	// FailureRiskWeights are the weights of the failure indicators in the score,
+	// keyed by the indicator. The default weights are used if empty.
+	FailureRiskWeights map[string]string
+	// PartitionMetrics lists the partitions of the disks in standalone mode, so that
+	// the IO statistics and the filesystem usage of each partition are collected.
+	// In node mode, the partitions are reported if they have blockdevices.
+	PartitionMetrics bool
+	// LeaderElect elects a leader among the replicas of the cluster exporter, so
+	// that only the leader exports the metrics of the blockdevices
+	LeaderElect bool
+	// LeaderElectionID is the name of the lease used for the leader election
+	LeaderElectionID string
+	// StateMetrics enables the info series of each blockdevice and claim along
+	// with the inventory of the cluster in cluster mode
+	StateMetrics bool
 }
 
 const (
@@ -41,10 +93,18 @@ const (
 	ClusterLevel = "cluster"
 	// NodeLevel is the node level mode operation of the exporter
 	NodeLevel = "node"
+	// Standalone is the node level mode operation of the exporter without
+	// kubernetes, in which the devices are discovered from the node
+	Standalone = "standalone"
 	// Port is the default port on which to start http server
 	Port = ":9100"
 	// MetricsPath is the endpoint at which metrics will be available
 	MetricsPath = "/metrics"
+	// DiskStatsInterval is the default interval at which the IO statistics are sampled
+	DiskStatsInterval = 10 * time.Second
+	// NodeNameEnv is the env having the name of the node on which the node level
+	// exporter is running
+	NodeNameEnv = "NODE_NAME"
 )
 
 // RunNodeDiskExporter logs the starting of NDM exporter
@@ -59,31 +119,51 @@ func (e *Exporter) Run() error {
 	var err error
 
 	// checking if the run mode is valid
-	if e.Mode != ClusterLevel && e.Mode != NodeLevel {
+	if e.Mode != ClusterLevel && e.Mode != NodeLevel && e.Mode != Standalone {
 		return fmt.Errorf("unknown mode '%s' selected for starting exporter", e.Mode)
 	}
 
-	// generate a new client object
-	e.Client, err = kubernetes.New()
+	gatherer, err := filter.NewGatherer(prometheus.DefaultGatherer, e.MetricsFilter)
 	if err != nil {
-		klog.Errorf("error creating client from config. %v", err)
 		return err
 	}
-
-	klog.V(2).Info("K8s Client generated using the config.")
-
-	// register the scheme for the APIs
-	if err = e.Client.RegisterAPI(); err != nil {
-		klog.Errorf("error registering scheme. %v", err)
+	if err = e.MetricsFilter.LoadHashKey(); err != nil {
 		return err
 	}
 
-	klog.V(2).Info("APIs registered.")
+	if e.PushOnly && !e.Push.Enabled() {
+		return fmt.Errorf("push url is required when the metrics are only pushed")
+	}
+	var pusher *push.Pusher
+	if e.Push.Enabled() {
+		if pusher, err = push.NewPusher(gatherer, e.Push); err != nil {
+			return err
+		}
+	}
+
+	if e.Mode != Standalone {
+		// generate a new client object
+		e.Client, err = kubernetes.New()
+		if err != nil {
+			klog.Errorf("error creating client from config. %v", err)
+			return err
+		}
+
+		klog.V(2).Info("K8s Client generated using the config.")
+
+		// register the scheme for the APIs
+		if err = e.Client.RegisterAPI(); err != nil {
+			klog.Errorf("error registering scheme. %v", err)
+			return err
+		}
+
+		klog.V(2).Info("APIs registered.")
+	}
 
 	switch e.Mode {
 	case ClusterLevel:
 		err = e.runClusterExporter()
-	case NodeLevel:
+	case NodeLevel, Standalone:
 		err = e.runNodeExporter()
 	}
 
@@ -92,8 +172,19 @@ func (e *Exporter) Run() error {
 		return err
 	}
 
-	// set handler for server to prometheus handler
-	e.Server.Handler = promhttp.Handler()
+	if pusher != nil {
+		klog.Infof("Pushing metrics to %s using %s every %v", e.Push.URL, e.Push.Mode, e.Push.Interval)
+		if e.PushOnly {
+			pusher.Run(nil)
+			return nil
+		}
+		go pusher.Run(nil)
+	}
+
+	// set handler for server to prometheus handler, which exposes the filtered metrics
+	// in the OpenMetrics format if the scraper accepts it
+	e.Server.Handler = promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		openmetrics.HandlerFor(gatherer))
 
 	// start the server
 	if err = e.Server.Start(); err != nil {
@@ -107,20 +198,108 @@ func (e *Exporter) Run() error {
 func (e *Exporter) runClusterExporter() error {
 	klog.Info("Starting cluster level exporter . . .")
 
+	// with more than one replica, the metrics are exported only by the leader, so
+	// that the blockdevices are not counted once for each replica
+	var isLeader func() bool
+	if e.LeaderElect {
+		elector, err := newLeaderElector(e.LeaderElectionID)
+		if err != nil {
+			klog.Errorf("error creating leader elector. %v", err)
+			return err
+		}
+		prometheus.MustRegister(exporterLeader)
+		go elector.Run(context.Background())
+		isLeader = elector.IsLeader
+	}
+
 	// create instance of a new static collector and register it.
-	staticCollector := collector.NewStaticMetricCollector(e.Client)
+	staticCollector := collector.NewStaticMetricCollector(e.Client, isLeader)
 	prometheus.MustRegister(staticCollector)
 
+	// the inventory of the blockdevices and claims in the cluster
+	inventoryCollector := collector.NewInventoryMetricCollector(e.Client, isLeader, e.StateMetrics)
+	prometheus.MustRegister(inventoryCollector)
+
 	return nil
 }
 
-// runNodeExporter starts the node level ndm exporter
+// runNodeExporter starts the node level ndm exporter. In standalone mode, the
+// devices are discovered from the node and their inventory is also served.
 func (e *Exporter) runNodeExporter() error {
 	klog.Info("Starting node level exporter . . .")
 
+	if e.Mode == Standalone {
+		e.Server.Handlers = map[string]http.Handler{
+			InventoryPath: inventoryHandler(e.newLister()),
+		}
+	}
+
+	schedule, err := collector.NewSchedule(e.CollectionIntervals, e.DisabledCollections, e.DeviceLimit)
+	if err != nil {
+		return err
+	}
+
 	// create instances of collectors required for node level exporter and register them
-	seachestCollector := collector.NewSeachestMetricCollector(e.Client)
+	seachestLister := e.newLister()
+	var wearTracker *wear.Tracker
+	if e.WearSampleInterval > 0 {
+		// the history is persisted on the blockdevices, except in standalone mode
+		annotator, _ := seachestLister.(wear.Annotator)
+		wearTracker = wear.NewTracker(annotator, os.Getenv(NodeNameEnv), e.WearSampleInterval)
+	}
+	seachestCollector := collector.NewSeachestMetricCollector(seachestLister, schedule, wearTracker)
 	prometheus.MustRegister(seachestCollector)
 
+	// the asynchronous events of the NVMe controllers are counted from the uevents
+	// sent by the kernel, as they are not queued by the controllers
+	asyncEvents := nvme.NewAsyncEventCounter()
+	go func() {
+		if err := asyncEvents.Watch(nil); err != nil {
+			klog.Errorf("unable to count nvme async events: %v", err)
+		}
+	}()
+
+	// the health log of the NVMe devices is reported only for the devices on this node
+	nvmeCollector := collector.NewNVMeMetricCollector(e.newLister(), os.Getenv(NodeNameEnv), schedule, asyncEvents)
+	prometheus.MustRegister(nvmeCollector)
+
+	// the mountpoints are on the host, and are found in the exporter under the host
+	// root, except in standalone mode where the exporter runs on the host
+	if (e.Mode == Standalone || e.HostRoot != "") && schedule.Enabled(collector.FamilyFilesystem, 0) {
+		filesystemCollector := collector.NewFilesystemMetricCollector(e.newLister(),
+			os.Getenv(NodeNameEnv), e.HostRoot)
+		prometheus.MustRegister(filesystemCollector)
+	}
+
+	if e.FailurePrediction && schedule.Enabled(collector.FamilyFailureRisk, 0) {
+		weights, err := failurerisk.ParseWeights(e.FailureRiskWeights)
+		if err != nil {
+			return err
+		}
+		failureRiskCollector := collector.NewFailureRiskMetricCollector(e.newLister(),
+			os.Getenv(NodeNameEnv), schedule, weights)
+		prometheus.MustRegister(failureRiskCollector)
+	}
+
+	if e.DiskStatsInterval > 0 && schedule.Enabled(collector.FamilyDiskStats, 0) {
+		diskStatsCollector := collector.NewDiskStatsMetricCollector(e.newLister(),
+			os.Getenv(NodeNameEnv), e.DiskStatsInterval)
+		go diskStatsCollector.Start(nil)
+		prometheus.MustRegister(diskStatsCollector)
+	}
+
 	return nil
 }
+
+// newLister returns the lister of the devices for a collector. Each collector gets
+// its own copy of the kubernetes client, since the client is set on every collection.
+func (e *Exporter) newLister() collector.DeviceLister {
+	if e.Mode == Standalone {
+		return &collector.LocalDeviceLister{
+			NodeName:   os.Getenv(NodeNameEnv),
+			Partitions: e.PartitionMetrics,
+		}
+	}
+	client := e.Client
+	return &client
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ndm_exporter
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/ndm-exporter/collector"
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
+	"k8s.io/klog"
+)
+
+// InventoryPath is the endpoint at which the inventory of the devices is
+// available in standalone mode
+const InventoryPath = "/inventory"
+
+// inventoryDevice is a device in the inventory. The serial number is hashed, as
+// is done in the labels of the metrics, and serialHash is omitted if no hash
+// key is configured.
+type inventoryDevice struct {
+	Node          string `json:"node"`
+	Path          string `json:"path"`
+	DeviceType    string `json:"deviceType"`
+	DriveType     string `json:"driveType,omitempty"`
+	Vendor        string `json:"vendor,omitempty"`
+	Model         string `json:"model,omitempty"`
+	SerialHash    string `json:"serialHash,omitempty"`
+	CapacityBytes uint64 `json:"capacityBytes"`
+}
+
+// inventoryHandler serves the devices listed by the lister as JSON
+func inventoryHandler(lister collector.DeviceLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blockDevices, err := lister.ListBlockDevice()
+		if err != nil {
+			klog.Errorf("Listing block devices failed %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		devices := make([]inventoryDevice, 0, len(blockDevices))
+		for _, bd := range blockDevices {
+			devices = append(devices, inventoryDevice{
+				Node:          labels.NodeName(bd.NodeAttributes[blockdevice.NodeName], bd.NodeAttributes[blockdevice.HostName]),
+				Path:          labels.DevicePath(bd.DevPath),
+				DeviceType:    bd.DeviceAttributes.DeviceType,
+				DriveType:     bd.DeviceAttributes.DriveType,
+				Vendor:        bd.DeviceAttributes.Vendor,
+				Model:         bd.DeviceAttributes.Model,
+				SerialHash:    filter.Hash(bd.DeviceAttributes.Serial),
+				CapacityBytes: bd.Capacity.Storage,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(devices); err != nil {
+			klog.Errorf("error writing inventory. %v", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ndm_exporter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeLister struct {
+	blockDevices []blockdevice.BlockDevice
+	err          error
+}
+
+func (f *fakeLister) InitClient() error {
+	return nil
+}
+
+func (f *fakeLister) ListBlockDevice(filters ...interface{}) ([]blockdevice.BlockDevice, error) {
+	return f.blockDevices, f.err
+}
+
+func TestInventoryHandler(t *testing.T) {
+	filter.SetHashKey([]byte("test"))
+	defer filter.SetHashKey(nil)
+	bd := blockdevice.BlockDevice{}
+	bd.DevPath = "/dev/sda"
+	bd.NodeAttributes = blockdevice.NodeAttribute{blockdevice.HostName: "host1"}
+	bd.Capacity.Storage = 1024
+	bd.DeviceAttributes = blockdevice.DeviceAttribute{
+		DeviceType: blockdevice.BlockDeviceTypeDisk,
+		DriveType:  blockdevice.DriveTypeSSD,
+		Model:      "Samsung SSD 860",
+		Serial:     "S3Z9NB0K123456",
+	}
+	nvme := blockdevice.BlockDevice{}
+	nvme.DevPath = "/dev/nvme0n1"
+	nvme.NodeAttributes = blockdevice.NodeAttribute{blockdevice.HostName: "host1", blockdevice.NodeName: "node1"}
+	nvme.DeviceAttributes.DeviceType = blockdevice.BlockDeviceTypeDisk
+
+	serialHash := filter.Hash("S3Z9NB0K123456")
+	assert.NotEmpty(t, serialHash)
+	rec := httptest.NewRecorder()
+	inventoryHandler(&fakeLister{blockDevices: []blockdevice.BlockDevice{bd, nvme}}).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, InventoryPath, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `[
+		{"node": "host1", "path": "sda", "deviceType": "disk", "driveType": "SSD",
+			"model": "Samsung SSD 860", "serialHash": "`+serialHash+`", "capacityBytes": 1024},
+		{"node": "node1", "path": "nvme0n1", "deviceType": "disk", "capacityBytes": 0}
+	]`, rec.Body.String())
+
+	// the serial hash is omitted without a key
+	filter.SetHashKey(nil)
+	rec = httptest.NewRecorder()
+	inventoryHandler(&fakeLister{blockDevices: []blockdevice.BlockDevice{bd}}).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, InventoryPath, nil))
+	assert.JSONEq(t, `[
+		{"node": "host1", "path": "sda", "deviceType": "disk", "driveType": "SSD",
+			"model": "Samsung SSD 860", "capacityBytes": 1024}
+	]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	inventoryHandler(&fakeLister{err: fmt.Errorf("no sysfs")}).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, InventoryPath, nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ndm_exporter
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/openebs/node-disk-manager/db/kubernetes"
+	"github.com/prometheus/client_golang/prometheus"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+const (
+	// LeaderElectionID is the default name of the lease used to elect the leader
+	// among the replicas of the cluster exporter
+	LeaderElectionID = "ndm-cluster-exporter"
+
+	// the durations of the lease, as used by the kubernetes controllers
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// exporterLeader is 1 on the replica of the cluster exporter that is the leader
+var exporterLeader = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ndm",
+		Name:      "exporter_leader",
+		Help:      `1 if this replica of the cluster exporter is the leader, which exports the blockdevice metrics`,
+	},
+)
+
+// leaderElector elects the leader among the replicas of the cluster exporter,
+// using a lease in the namespace of the exporter. A replica which loses the lease
+// keeps trying to acquire it again.
+type leaderElector struct {
+	leading int32
+	config  leaderelection.LeaderElectionConfig
+}
+
+// newLeaderElector creates the elector for the lease with the given name. The
+// name of the pod is used as the identity of the replica.
+func newLeaderElector(name string) (*leaderElector, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock,
+		os.Getenv(kubernetes.NamespaceENV), name,
+		client.CoreV1(), client.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return nil, err
+	}
+
+	le := &leaderElector{}
+	le.config = leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				klog.Infof("%s became the leader of %s", identity, name)
+				le.setLeading(true)
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("%s is no longer the leader of %s", identity, name)
+				le.setLeading(false)
+			},
+		},
+		ReleaseOnCancel: true,
+		Name:            name,
+	}
+	return le, nil
+}
+
+// Run takes part in the election till the context is cancelled
+func (le *leaderElector) Run(ctx context.Context) {
+	for {
+		leaderelection.RunOrDie(ctx, le.config)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// IsLeader checks if this replica is the leader
+func (le *leaderElector) IsLeader() bool {
+	return atomic.LoadInt32(&le.leading) == 1
+}
+
+func (le *leaderElector) setLeading(leading bool) {
+	if leading {
+		atomic.StoreInt32(&le.leading, 1)
+		exporterLeader.Set(1)
+		return
+	}
+	atomic.StoreInt32(&le.leading, 0)
+	exporterLeader.Set(0)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetCondition returns the condition of the given type, or nil if the
+// condition is not present in the status
+func (ds *DeviceStatus) GetCondition(condType BlockDeviceConditionType) *BlockDeviceCondition {
+	for i := range ds.Conditions {
+		if ds.Conditions[i].Type == condType {
+			return &ds.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds the condition to the status, or updates the existing
+// condition of the same type. LastTransitionTime is changed only if the
+// status of the condition has changed.
+func (ds *DeviceStatus) SetCondition(cond BlockDeviceCondition) {
+	existing := ds.GetCondition(cond.Type)
+	if existing == nil {
+		if cond.LastTransitionTime.IsZero() {
+			cond.LastTransitionTime = metav1.Now()
+		}
+		ds.Conditions = append(ds.Conditions, cond)
+		return
+	}
+	if existing.Status != cond.Status {
+		existing.Status = cond.Status
+		existing.LastTransitionTime = cond.LastTransitionTime
+		if existing.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = metav1.Now()
+		}
+	}
+	existing.Reason = cond.Reason
+	existing.Message = cond.Message
+}
+
+// RemoveCondition removes the condition of the given type from the status
+func (ds *DeviceStatus) RemoveCondition(condType BlockDeviceConditionType) {
+	conditions := make([]BlockDeviceCondition, 0, len(ds.Conditions))
+	for _, c := range ds.Conditions {
+		if c.Type != condType {
+			conditions = append(conditions, c)
+		}
+	}
+	if len(conditions) == 0 {
+		conditions = nil
+	}
+	ds.Conditions = conditions
+}
@@ -54,6 +54,10 @@ type DeviceSpec struct {
 	// ClaimRef is the reference to the BDC which has claimed this BD
 	ClaimRef *v1.ObjectReference `json:"claimRef,omitempty"`
 
+	// Unschedulable marks the BD as not available for new claims, eg: before
+	// the disk is replaced. The existing claim of the BD is not affected.
+	Unschedulable bool `json:"unschedulable,omitempty"`
+
 	// DevLinks contains soft links of a block device like
 	// /dev/by-id/...
 	// /dev/by-uuid/...
@@ -63,10 +67,11 @@ type DeviceSpec struct {
 	FileSystem FileSystemInfo `json:"filesystem,omitempty"`
 
 	// Partitioned represents if BlockDevice has partitions or not (Yes/No)
-	// Currently always default to No.
-	// TODO @kmova to be implemented/deprecated
 	Partitioned string `json:"partitioned"`
 
+	// Partitions is the list of paths of the partitions of the BlockDevice
+	Partitions []string `json:"partitions,omitempty"`
+
 	// ParentDevice was intended to store the UUID of the parent
 	// Block Device as is the case for partitioned block devices.
 	//
@@ -156,6 +161,11 @@ type DeviceDetails struct {
 
 	// FirmwareRevision is the disk firmware revision
 	FirmwareRevision string `json:"firmwareRevision"`
+
+	// SED is the TCG Security Subsystem Class of a self-encrypting drive, like
+	// Opal2 or Enterprise, whose data can be erased by changing its key. It is
+	// empty if the drive does not encrypt its media.
+	SED string `json:"sed,omitempty"`
 }
 
 // FileSystemInfo defines the filesystem type and mountpoint of the device if it exists
@@ -183,6 +193,66 @@ type DeviceStatus struct {
 
 	// State is the current state of the blockdevice (Active/Inactive)
 	State BlockDeviceState `json:"state"`
+
+	// Conditions are the latest observations of the blockdevice's state
+	Conditions []BlockDeviceCondition `json:"conditions,omitempty"`
+}
+
+// BlockDeviceConditionType is a valid value for BlockDeviceCondition.Type
+type BlockDeviceConditionType string
+
+const (
+	// BlockDeviceProbeSkipped is set when one or more probes were not run on
+	// the blockdevice because their circuit breaker was open
+	BlockDeviceProbeSkipped BlockDeviceConditionType = "ProbeSkipped"
+
+	// BlockDeviceFlapping is set when the blockdevice has been attached and
+	// detached repeatedly within a short period of time
+	BlockDeviceFlapping BlockDeviceConditionType = "Flapping"
+
+	// BlockDeviceUUIDCollision is set when the UUID generated for the device was
+	// already used by a device on another node, and a new UUID had to be generated
+	BlockDeviceUUIDCollision BlockDeviceConditionType = "UUIDCollision"
+
+	// BlockDeviceHealthThresholdExceeded is set when a SMART metric of the device,
+	// like the temperature, has crossed the threshold configured for it
+	BlockDeviceHealthThresholdExceeded BlockDeviceConditionType = "HealthThresholdExceeded"
+
+	// BlockDeviceCleanupInProgress is set while the released blockdevice is being
+	// cleaned, with the progress reported by the cleanup job
+	BlockDeviceCleanupInProgress BlockDeviceConditionType = "CleanupInProgress"
+
+	// BlockDeviceCleanupVerified is set with the result of the verification of the
+	// cleanup of the released blockdevice, if the cleanup is verified
+	BlockDeviceCleanupVerified BlockDeviceConditionType = "CleanupVerified"
+
+	// BlockDeviceCleanupFailed is set when all the attempts of the cleanup of the
+	// released blockdevice have failed, and the cleanup is no longer retried
+	BlockDeviceCleanupFailed BlockDeviceConditionType = "CleanupFailed"
+
+	// BlockDeviceCleanupQueued is set while the cleanup of the released blockdevice
+	// is waiting for the limit of cleanup jobs running on its node, or for its
+	// maintenance window to open
+	BlockDeviceCleanupQueued BlockDeviceConditionType = "CleanupQueued"
+)
+
+// BlockDeviceCondition contains details of the current condition of a blockdevice
+type BlockDeviceCondition struct {
+	// Type is the type of the condition
+	Type BlockDeviceConditionType `json:"type"`
+
+	// Status of the condition, one of True, False, Unknown
+	Status v1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the condition transitioned from
+	// one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a unique, one-word, CamelCase reason for the condition's last transition
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable message indicating details about the transition
+	Message string `json:"message,omitempty"`
 }
 
 // DeviceClaimState defines the observed state of BlockDevice
@@ -16,7 +16,7 @@ func (in *BlockDevice) DeepCopyInto(out *BlockDevice) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -38,6 +38,23 @@ func (in *BlockDevice) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlockDeviceCondition) DeepCopyInto(out *BlockDeviceCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlockDeviceCondition.
+func (in *BlockDeviceCondition) DeepCopy() *BlockDeviceCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(BlockDeviceCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *BlockDeviceClaim) DeepCopyInto(out *BlockDeviceClaim) {
 	*out = *in
@@ -299,6 +316,11 @@ func (in *DeviceSpec) DeepCopyInto(out *DeviceSpec) {
 		}
 	}
 	out.FileSystem = in.FileSystem
+	if in.Partitions != nil {
+		in, out := &in.Partitions, &out.Partitions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -315,6 +337,13 @@ func (in *DeviceSpec) DeepCopy() *DeviceSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DeviceStatus) DeepCopyInto(out *DeviceStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]BlockDeviceCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -0,0 +1,241 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bench runs a short IO benchmark on a device, and records the measured
+// throughput and latency on the blockdevice as annotations, so that they can be
+// used to select the devices by their performance.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// AnnotationPrefix is the prefix of the annotations having the results of
+	// the benchmark
+	AnnotationPrefix = "ndm.io/bench-"
+	// TimeAnnotation is the time at which the benchmark was run, in RFC3339
+	TimeAnnotation = AnnotationPrefix + "time"
+	// ModeAnnotation is whether the benchmark wrote to the device, read-only
+	// or read-write
+	ModeAnnotation = AnnotationPrefix + "mode"
+
+	// ModeReadOnly runs only the read tests
+	ModeReadOnly = "read-only"
+	// ModeReadWrite runs the write tests along with the read tests, overwriting
+	// the data on the device
+	ModeReadWrite = "read-write"
+
+	// DefaultDuration is the default duration of each test
+	DefaultDuration = 5 * time.Second
+	// SequentialBlockSize is the size of the IOs of the sequential tests
+	SequentialBlockSize = 1 << 20
+	// RandomBlockSize is the size of the IOs of the random tests
+	RandomBlockSize = 4 << 10
+
+	// alignment is the alignment of the buffers and offsets needed by direct IO
+	alignment = 4 << 10
+)
+
+// the tests run by the benchmark
+const (
+	SequentialRead  = "seq-read"
+	RandomRead      = "rand-read"
+	SequentialWrite = "seq-write"
+	RandomWrite     = "rand-write"
+)
+
+// Options are the options of the benchmark
+type Options struct {
+	// Duration is the duration of each test
+	Duration time.Duration
+	// Write runs the write tests, overwriting the data on the device
+	Write bool
+}
+
+// Result is the result of a test of the benchmark
+type Result struct {
+	// Test is the name of the test, eg: seq-read
+	Test string `json:"test"`
+	// BytesPerSecond is the throughput of the test
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+	// IOPS is the no. of IOs completed per second
+	IOPS float64 `json:"iops"`
+	// AvgLatency is the average time taken by an IO
+	AvgLatency time.Duration `json:"avgLatency"`
+	// P99Latency is the 99th percentile of the time taken by an IO
+	P99Latency time.Duration `json:"p99Latency"`
+}
+
+// test is a test of the benchmark
+type test struct {
+	name      string
+	blockSize int64
+	random    bool
+	write     bool
+}
+
+// Run runs the tests on the first size bytes of the device, one IO at a time.
+// The read tests are always run, the write tests only if enabled in the options.
+func Run(devPath string, size uint64, opts Options) ([]Result, error) {
+	if opts.Duration <= 0 {
+		opts.Duration = DefaultDuration
+	}
+	tests := []test{
+		{name: SequentialRead, blockSize: SequentialBlockSize},
+		{name: RandomRead, blockSize: RandomBlockSize, random: true},
+	}
+	if opts.Write {
+		tests = append(tests,
+			test{name: SequentialWrite, blockSize: SequentialBlockSize, write: true},
+			test{name: RandomWrite, blockSize: RandomBlockSize, random: true, write: true})
+	}
+
+	results := make([]Result, 0, len(tests))
+	for _, t := range tests {
+		if size < uint64(t.blockSize) {
+			return nil, fmt.Errorf("size of %s %d is less than the block size %d", devPath, size, t.blockSize)
+		}
+		result, err := runTest(devPath, int64(size), t, opts.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("%s test on %s failed: %v", t.name, devPath, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// runTest runs the test for the duration, using direct IO if supported so that
+// the page cache is bypassed
+func runTest(devPath string, size int64, t test, duration time.Duration) (Result, error) {
+	flag := os.O_RDONLY
+	if t.write {
+		flag = os.O_WRONLY
+	}
+	f, err := os.OpenFile(devPath, flag|syscall.O_DIRECT, 0)
+	if err != nil {
+		// direct IO is not supported by all the filesystems, eg: tmpfs
+		if f, err = os.OpenFile(devPath, flag, 0); err != nil {
+			return Result{}, err
+		}
+	}
+	defer f.Close()
+
+	buf := alignedBuffer(int(t.blockSize))
+	blocks := size / t.blockSize
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	latencies := make([]time.Duration, 0)
+	var offset, total int64
+	start := time.Now()
+	for time.Since(start) < duration {
+		if t.random {
+			offset = rnd.Int63n(blocks) * t.blockSize
+		} else if offset+t.blockSize > blocks*t.blockSize {
+			offset = 0
+		}
+		ioStart := time.Now()
+		var n int
+		if t.write {
+			n, err = f.WriteAt(buf, offset)
+		} else {
+			n, err = f.ReadAt(buf, offset)
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		latencies = append(latencies, time.Since(ioStart))
+		total += int64(n)
+		offset += t.blockSize
+	}
+	if t.write {
+		if err := f.Sync(); err != nil {
+			return Result{}, err
+		}
+	}
+	elapsed := time.Since(start)
+	return newResult(t.name, total, latencies, elapsed), nil
+}
+
+// newResult computes the result of a test from the latencies of the IOs
+func newResult(name string, total int64, latencies []time.Duration, elapsed time.Duration) Result {
+	result := Result{Test: name}
+	if len(latencies) == 0 || elapsed <= 0 {
+		return result
+	}
+	var sum time.Duration
+	for _, latency := range latencies {
+		sum += latency
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.BytesPerSecond = float64(total) / elapsed.Seconds()
+	result.IOPS = float64(len(latencies)) / elapsed.Seconds()
+	result.AvgLatency = sum / time.Duration(len(latencies))
+	result.P99Latency = latencies[(len(latencies)*99-1)/100]
+	return result
+}
+
+// alignedBuffer returns a buffer of the size aligned for direct IO
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+alignment)
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (alignment - 1)); rem != 0 {
+		offset = alignment - rem
+	}
+	return buf[offset : offset+size]
+}
+
+// Annotations returns the annotations having the results of the benchmark run
+// at the given time. The throughput is in bytes per second, and the latencies
+// in microseconds.
+func Annotations(results []Result, mode string, t time.Time) map[string]string {
+	annotations := map[string]string{
+		TimeAnnotation: t.UTC().Format(time.RFC3339),
+		ModeAnnotation: mode,
+	}
+	for _, r := range results {
+		prefix := AnnotationPrefix + r.Test + "-"
+		annotations[prefix+"bytes-per-second"] = strconv.FormatFloat(r.BytesPerSecond, 'f', 0, 64)
+		annotations[prefix+"iops"] = strconv.FormatFloat(r.IOPS, 'f', 0, 64)
+		annotations[prefix+"avg-latency-us"] = strconv.FormatInt(r.AvgLatency.Microseconds(), 10)
+		annotations[prefix+"p99-latency-us"] = strconv.FormatInt(r.P99Latency.Microseconds(), 10)
+	}
+	return annotations
+}
+
+// SetAnnotations replaces the results of the previous benchmark in the
+// annotations with the given results
+func SetAnnotations(annotations map[string]string, results map[string]string) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	for key := range annotations {
+		if strings.HasPrefix(key, AnnotationPrefix) {
+			delete(annotations, key)
+		}
+	}
+	for key, value := range results {
+		annotations[key] = value
+	}
+	return annotations
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "disk")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Repeat("x", 8<<20)), 0600))
+
+	results, err := Run(path, 8<<20, Options{Duration: 20 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(results))
+	assert.Equal(t, SequentialRead, results[0].Test)
+	assert.Equal(t, RandomRead, results[1].Test)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 8<<20), string(data))
+
+	results, err = Run(path, 8<<20, Options{Duration: 20 * time.Millisecond, Write: true})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(results))
+	for _, r := range results {
+		assert.True(t, r.BytesPerSecond > 0, r.Test)
+		assert.True(t, r.IOPS > 0, r.Test)
+		assert.True(t, r.P99Latency > 0, r.Test)
+	}
+	assert.Equal(t, SequentialWrite, results[2].Test)
+	assert.Equal(t, RandomWrite, results[3].Test)
+
+	_, err = Run(path, 1024, Options{Duration: time.Millisecond})
+	assert.Error(t, err)
+}
+
+func TestNewResult(t *testing.T) {
+	latencies := make([]time.Duration, 0, 100)
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	r := newResult(RandomRead, 100*RandomBlockSize, latencies, 2*time.Second)
+	assert.Equal(t, Result{
+		Test:           RandomRead,
+		BytesPerSecond: 50 * RandomBlockSize,
+		IOPS:           50,
+		AvgLatency:     50500 * time.Microsecond,
+		P99Latency:     99 * time.Millisecond,
+	}, r)
+	assert.Equal(t, Result{Test: RandomRead}, newResult(RandomRead, 0, nil, time.Second))
+}
+
+func TestAnnotations(t *testing.T) {
+	results := []Result{{
+		Test:           SequentialRead,
+		BytesPerSecond: 524288000.4,
+		IOPS:           500,
+		AvgLatency:     1999 * time.Microsecond,
+		P99Latency:     4 * time.Millisecond,
+	}}
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	annotations := SetAnnotations(map[string]string{
+		"ndm.io/boot-id":                         "b1",
+		"ndm.io/bench-rand-write-iops":           "100",
+		"ndm.io/bench-seq-read-bytes-per-second": "1",
+	}, Annotations(results, ModeReadOnly, now))
+	assert.Equal(t, map[string]string{
+		"ndm.io/boot-id":                         "b1",
+		"ndm.io/bench-time":                      "2021-03-04T05:06:07Z",
+		"ndm.io/bench-mode":                      "read-only",
+		"ndm.io/bench-seq-read-bytes-per-second": "524288000",
+		"ndm.io/bench-seq-read-iops":             "500",
+		"ndm.io/bench-seq-read-avg-latency-us":   "1999",
+		"ndm.io/bench-seq-read-p99-latency-us":   "4000",
+	}, annotations)
+}
@@ -24,6 +24,7 @@ import (
 	"context"
 	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 )
@@ -40,6 +41,9 @@ const (
 	CleanupStateRunning
 	// CleanupStateSucceeded represents that the cleanup job has been completed successfully
 	CleanupStateSucceeded
+	// CleanupStateFailed represents that the cleanup job has failed, and has to be
+	// removed before the cleanup is retried
+	CleanupStateFailed
 )
 
 // VolumeMode defines the volume mode of the BlockDevice. It can be either block mode or
@@ -106,6 +110,8 @@ func (c *Cleaner) Clean(blockDevice *v1alpha1.BlockDevice) (bool, error) {
 	switch state {
 	case CleanupStateSucceeded:
 		return true, nil
+	case CleanupStateFailed:
+		return false, nil
 	case CleanupStateNotFound:
 		// if the BD is not active, do not start the job
 		if blockDevice.Status.State != v1alpha1.BlockDeviceActive {
@@ -115,6 +121,15 @@ func (c *Cleaner) Clean(blockDevice *v1alpha1.BlockDevice) (bool, error) {
 		// BD is in active state
 	}
 
+	// the job is started only in a maintenance window, and if the limit of jobs on
+	// the node is not reached
+	if err := checkWindow(blockDevice, time.Now()); err != nil {
+		return false, err
+	}
+	if err := c.admit(blockDevice); err != nil {
+		return false, err
+	}
+
 	volMode := getVolumeMode(blockDevice.Spec)
 
 	// create a new job for the blockdevice
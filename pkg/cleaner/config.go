@@ -16,7 +16,16 @@ limitations under the License.
 
 package cleaner
 
-import "os"
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
 
 const (
 	// EnvCleanUpJobImage is the environment variable for getting the
@@ -25,11 +34,83 @@ const (
 	// ServiceAccountName is the service account in which the operator pod
 	// is running. The cleanup job, pod will be started with this service account
 	ServiceAccountName = "SERVICE_ACCOUNT"
+	// EnvCleanupMethod is the environment variable for the default cleanup method,
+	// used for the blockdevices which do not have a cleanup method in their policy
+	EnvCleanupMethod = "CLEANUP_METHOD"
+	// EnvCleanupVerify is the environment variable for the default verification of the
+	// cleanup, used for the blockdevices which do not have a verification in their policy
+	EnvCleanupVerify = "CLEANUP_VERIFY"
+	// EnvCleanupFilesystem is the environment variable for the default cleanup strategy
+	// of the filesystems of the blockdevices which are not mounted, used if it is not
+	// set in their policy
+	EnvCleanupFilesystem = "CLEANUP_FILESYSTEM"
+	// EnvCleanUpJobServiceAccount is the environment variable for the service account
+	// of the cleanup job pods, the service account of the operator by default
+	EnvCleanUpJobServiceAccount = "CLEANUP_JOB_SERVICE_ACCOUNT"
+	// EnvCleanUpJobPriorityClass is the environment variable for the priority class
+	// of the cleanup job pods
+	EnvCleanUpJobPriorityClass = "CLEANUP_JOB_PRIORITY_CLASS"
+	// EnvCleanUpJobResources is the environment variable for the resource requests and
+	// limits of the cleanup job container, as json. eg: {"limits":{"memory":"128Mi"}}
+	EnvCleanUpJobResources = "CLEANUP_JOB_RESOURCES"
+	// EnvCleanUpJobTolerations is the environment variable for the tolerations of the
+	// cleanup job pods as a json list, added to the tolerations of the taints of the node
+	EnvCleanUpJobTolerations = "CLEANUP_JOB_TOLERATIONS"
+	// EnvCleanUpJobNodeSelector is the environment variable for the node selector of the
+	// cleanup job pods, as comma separated key=value pairs
+	EnvCleanUpJobNodeSelector = "CLEANUP_JOB_NODE_SELECTOR"
+	// EnvCleanUpJobTimeout is the environment variable for the default timeout of each
+	// attempt of the cleanup, as a duration. 0 disables the timeout
+	EnvCleanUpJobTimeout = "CLEANUP_JOB_TIMEOUT"
+	// EnvCleanUpJobRetries is the environment variable for the number of times a failed
+	// cleanup is retried, before it is marked as failed
+	EnvCleanUpJobRetries = "CLEANUP_JOB_RETRIES"
+	// EnvCleanUpJobBackoff is the environment variable for the time to wait before the
+	// first retry of a failed cleanup, which is doubled after each retry
+	EnvCleanUpJobBackoff = "CLEANUP_JOB_BACKOFF"
+	// EnvCleanUpJobNodeLimit is the environment variable for the maximum number of
+	// cleanup jobs running on a node. 0 does not limit the jobs
+	EnvCleanUpJobNodeLimit = "CLEANUP_JOB_NODE_LIMIT"
+	// EnvCleanupPreHook is the environment variable for the shell command run by the
+	// cleanup jobs before the cleanup
+	EnvCleanupPreHook = "CLEANUP_PRE_HOOK"
+	// EnvCleanupPreHookFailure is the environment variable for the action taken when
+	// the pre-cleanup hook fails, blocking or advisory
+	EnvCleanupPreHookFailure = "CLEANUP_PRE_HOOK_FAILURE"
+	// EnvCleanupPostHook is the environment variable for the shell command run by the
+	// cleanup jobs after the cleanup
+	EnvCleanupPostHook = "CLEANUP_POST_HOOK"
+	// EnvCleanupPostHookFailure is the environment variable for the action taken when
+	// the post-cleanup hook fails, blocking or advisory
+	EnvCleanupPostHookFailure = "CLEANUP_POST_HOOK_FAILURE"
+	// EnvCleanupDryRun is the environment variable for running the cleanup of all the
+	// blockdevices as a dry run, unless their policy disables it
+	EnvCleanupDryRun = "CLEANUP_DRY_RUN"
+	// EnvCleanupWindows is the environment variable for the maintenance windows during
+	// which the cleanup jobs may be started, as cron schedules with durations
+	EnvCleanupWindows = "CLEANUP_WINDOWS"
+	// EnvCleanupAllowClaim is the environment variable for the cleanup policy
+	// annotations which leave the data to the next claimant, and which the claims are
+	// allowed to set on the blockdevices which do not set their own AllowClaimAnnotation
+	EnvCleanupAllowClaim = "CLEANUP_ALLOW_CLAIM"
 )
 
 var (
 	// defaultCleanUpJobImage is the default job container image
 	defaultCleanUpJobImage = "quay.io/openebs/linux-utils:latest"
+	// defaultMethod is the default cleanup method
+	defaultMethod = MethodWipefs
+	// defaultVerifyMode is the default verification of the cleanup
+	defaultVerifyMode = VerifyNone
+	// defaultFilesystemStrategy is the default cleanup strategy of the filesystems
+	// which are not mounted
+	defaultFilesystemStrategy = FilesystemWipe
+	// defaultTimeout is the default timeout of each attempt of the cleanup
+	defaultTimeout = 24 * time.Hour
+	// defaultRetries is the default number of retries of a failed cleanup
+	defaultRetries = 3
+	// defaultBackoff is the default time to wait before the first retry
+	defaultBackoff = time.Minute
 )
 
 // getCleanUpImage gets the image to be used for the cleanup job
@@ -41,8 +122,175 @@ func getCleanUpImage() string {
 	return image
 }
 
-// getServiceAccount gets the service account in which the pod is running
+// getServiceAccount gets the service account of the cleanup job pods, which is the
+// service account in which the operator pod is running if not configured
 // TODO move env variable operations to a separate pkg
 func getServiceAccount() string {
+	if serviceAccount := os.Getenv(EnvCleanUpJobServiceAccount); len(serviceAccount) != 0 {
+		return serviceAccount
+	}
 	return os.Getenv(ServiceAccountName)
 }
+
+// getPriorityClass gets the priority class of the cleanup job pods
+func getPriorityClass() string {
+	return os.Getenv(EnvCleanUpJobPriorityClass)
+}
+
+// getResources gets the resource requests and limits of the cleanup job container
+func getResources() v1.ResourceRequirements {
+	resources := v1.ResourceRequirements{}
+	val := os.Getenv(EnvCleanUpJobResources)
+	if len(val) == 0 {
+		return resources
+	}
+	if err := json.Unmarshal([]byte(val), &resources); err != nil {
+		klog.Warningf("invalid %s: %s, not setting the resources: %v", EnvCleanUpJobResources, val, err)
+		return v1.ResourceRequirements{}
+	}
+	return resources
+}
+
+// getTolerations gets the tolerations of the cleanup job pods, other than the
+// tolerations of the taints of the node
+func getTolerations() []v1.Toleration {
+	val := os.Getenv(EnvCleanUpJobTolerations)
+	if len(val) == 0 {
+		return nil
+	}
+	var tolerations []v1.Toleration
+	if err := json.Unmarshal([]byte(val), &tolerations); err != nil {
+		klog.Warningf("invalid %s: %s, not setting the tolerations: %v", EnvCleanUpJobTolerations, val, err)
+		return nil
+	}
+	return tolerations
+}
+
+// getNodeSelector gets the node selector of the cleanup job pods
+func getNodeSelector() map[string]string {
+	val := os.Getenv(EnvCleanUpJobNodeSelector)
+	if len(val) == 0 {
+		return nil
+	}
+	selector, err := labels.ConvertSelectorToLabelsMap(val)
+	if err != nil {
+		klog.Warningf("invalid %s: %s, not setting the node selector: %v", EnvCleanUpJobNodeSelector, val, err)
+		return nil
+	}
+	return selector
+}
+
+// getDefaultMethod gets the cleanup method used if it is not set in the policy
+func getDefaultMethod() Method {
+	method := Method(os.Getenv(EnvCleanupMethod))
+	if len(method) == 0 {
+		return defaultMethod
+	}
+	if !isValidMethod(method) {
+		klog.Warningf("invalid %s: %s, using %s", EnvCleanupMethod, method, defaultMethod)
+		return defaultMethod
+	}
+	return method
+}
+
+// getDefaultVerifyMode gets the verification of the cleanup used if it is not set
+// in the policy
+func getDefaultVerifyMode() VerifyMode {
+	mode := VerifyMode(os.Getenv(EnvCleanupVerify))
+	if len(mode) == 0 {
+		return defaultVerifyMode
+	}
+	if !isValidVerifyMode(mode) {
+		klog.Warningf("invalid %s: %s, using %s", EnvCleanupVerify, mode, defaultVerifyMode)
+		return defaultVerifyMode
+	}
+	return mode
+}
+
+// getDefaultFilesystemStrategy gets the cleanup strategy of the filesystems which are
+// not mounted used if it is not set in the policy
+func getDefaultFilesystemStrategy() FilesystemStrategy {
+	strategy := FilesystemStrategy(os.Getenv(EnvCleanupFilesystem))
+	if len(strategy) == 0 {
+		return defaultFilesystemStrategy
+	}
+	if !isValidFilesystemStrategy(strategy) {
+		klog.Warningf("invalid %s: %s, using %s", EnvCleanupFilesystem, strategy, defaultFilesystemStrategy)
+		return defaultFilesystemStrategy
+	}
+	return strategy
+}
+
+// getDefaultTimeout gets the timeout of each attempt of the cleanup used if it is
+// not set in the policy
+func getDefaultTimeout() time.Duration {
+	return getDuration(EnvCleanUpJobTimeout, defaultTimeout)
+}
+
+// getDefaultDryRun gets whether the cleanup is a dry run if it is not set in the policy
+func getDefaultDryRun() bool {
+	val := os.Getenv(EnvCleanupDryRun)
+	if len(val) == 0 {
+		return false
+	}
+	dryRun, err := strconv.ParseBool(val)
+	if err != nil {
+		klog.Warningf("invalid %s: %s, using false", EnvCleanupDryRun, val)
+		return false
+	}
+	return dryRun
+}
+
+// getBackoff gets the time to wait before the first retry of a failed cleanup
+func getBackoff() time.Duration {
+	backoff := getDuration(EnvCleanUpJobBackoff, defaultBackoff)
+	if backoff == 0 {
+		klog.Warningf("invalid %s: 0, using %s", EnvCleanUpJobBackoff, defaultBackoff)
+		return defaultBackoff
+	}
+	return backoff
+}
+
+// getRetries gets the number of times a failed cleanup is retried
+func getRetries() int {
+	val := os.Getenv(EnvCleanUpJobRetries)
+	if len(val) == 0 {
+		return defaultRetries
+	}
+	retries, err := strconv.Atoi(val)
+	if err != nil || retries < 0 {
+		klog.Warningf("invalid %s: %s, using %d", EnvCleanUpJobRetries, val, defaultRetries)
+		return defaultRetries
+	}
+	return retries
+}
+
+// getDuration gets the duration set in the environment variable, or the default
+// duration if it is not set or is invalid
+func getDuration(env string, defaultDuration time.Duration) time.Duration {
+	val := os.Getenv(env)
+	if len(val) == 0 {
+		return defaultDuration
+	}
+	duration, err := time.ParseDuration(val)
+	if err != nil || duration < 0 {
+		klog.Warningf("invalid %s: %s, using %s", env, val, defaultDuration)
+		return defaultDuration
+	}
+	return duration
+}
+
+// getNodeLimit gets the maximum number of cleanup jobs running on a node, 0 if the
+// jobs are not limited
+func getNodeLimit() int {
+	val := os.Getenv(EnvCleanUpJobNodeLimit)
+	if len(val) == 0 {
+		return 0
+	}
+	limit, err := strconv.Atoi(val)
+	if err != nil || limit < 0 {
+		klog.Warningf("invalid %s: %s, not limiting the cleanup jobs", EnvCleanUpJobNodeLimit, val)
+		return 0
+	}
+	return limit
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+)
+
+// DryRunAnnotation runs the cleanup of the blockdevice as a dry run, which records
+// the cleanup that would be done and unclaims the blockdevice without touching its data
+const DryRunAnnotation = PolicyAnnotationPrefix + "dry-run"
+
+const (
+	// resultStatusDryRun is the status of the result of a dry run
+	resultStatusDryRun = "DryRun"
+	// defaultDryRunSource is the source of the dry run set by the operator
+	defaultDryRunSource = "the operator"
+)
+
+const (
+	// hddWriteRate is the rate, in bytes per second, at which a hard disk is assumed
+	// to be overwritten, to estimate the duration of the cleanup
+	hddWriteRate = 150 << 20
+	// minEstimate is the estimate of the cleanup which does not depend on the
+	// capacity of the device, like erasing the signatures or changing the key
+	minEstimate = time.Minute
+)
+
+// Plan is the cleanup which the cleanup job of the blockdevice would do
+type Plan struct {
+	// Device is the path of the device
+	Device string
+	// Node is the name of the node of the device
+	Node string
+	// Method is the cleanup method of the device
+	Method Method
+	// Filesystem is the cleanup strategy of the filesystem, if the blockdevice has one
+	Filesystem FilesystemStrategy
+	// Verify is the verification of the cleanup
+	Verify VerifyMode
+	// Estimate is the estimated duration of the cleanup, zero if it cannot be estimated
+	Estimate time.Duration
+	// Command is the shell command which the cleanup job would run
+	Command string
+}
+
+// String returns the summary of the plan, eg: clean /dev/sdb on node-1 using discard,
+// verify signatures, about 3h0m0s
+func (p *Plan) String() string {
+	using := fmt.Sprintf("using %s", p.Method)
+	if p.Filesystem == FilesystemDelete || p.Filesystem == FilesystemMkfs {
+		using = fmt.Sprintf("using %s of the filesystem", p.Filesystem)
+	}
+	s := "clean " + p.Device
+	if len(p.Node) != 0 {
+		s += " on " + p.Node
+	}
+	s += fmt.Sprintf(" %s, verify %s", using, p.Verify)
+	if p.Estimate != 0 {
+		return s + ", about " + p.Estimate.String()
+	}
+	return s + ", duration unknown"
+}
+
+// GetDryRun gets whether the cleanup of the blockdevice is a dry run, from the policy
+// of the blockdevice, or of the claim if the dry run is allowed for the claims, or the
+// default of the operator, and the source which set it, eg: BlockDeviceClaim bdc-1. A
+// claim can always disable the dry run.
+func GetDryRun(bd *v1alpha1.BlockDevice) (bool, string, error) {
+	value, source := lookupAdminPolicy(bd, DryRunAnnotation)
+	if len(value) == 0 {
+		return getDefaultDryRun(), defaultDryRunSource, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid %s %q of %s in the policy of %s, must be true or false",
+			DryRunAnnotation, value, bd.Name, source)
+	}
+	return dryRun, source, nil
+}
+
+// NewPlan returns the cleanup which the cleanup job of the blockdevice would do in the
+// namespace, without creating the job. An error is returned if the policy of the
+// blockdevice is invalid, as the job would not be created.
+func NewPlan(bd *v1alpha1.BlockDevice, namespace string) (*Plan, error) {
+	job, err := NewCleanupJob(bd, getVolumeMode(bd.Spec), nil, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// the policy is valid, as the job was created from it
+	plan := &Plan{
+		Device: bd.Spec.Path,
+		Node:   GetNodeName(bd),
+	}
+	plan.Method, _ = GetMethod(bd)
+	plan.Verify, _ = GetVerifyMode(bd)
+	if hasFilesystem(bd) {
+		plan.Filesystem, _ = GetFilesystemStrategy(bd)
+	}
+	plan.Estimate = estimateDuration(bd, plan.Method, plan.Filesystem, plan.Verify)
+	plan.Command = strings.Join(job.Spec.Template.Spec.Containers[0].Args, " ")
+	return plan, nil
+}
+
+// Result returns the result of the dry run of the plan, whose logs are the command
+// which the cleanup job would run
+func (p *Plan) Result(bd *v1alpha1.BlockDevice) *Result {
+	result := &Result{
+		Status:     resultStatusDryRun,
+		Method:     p.Method,
+		Filesystem: p.Filesystem,
+		Bytes:      cleanedBytes(bd, p.Method, p.Filesystem),
+		Logs:       p.Command,
+	}
+	if p.Estimate != 0 {
+		result.Duration = p.Estimate.String()
+	}
+	return result
+}
+
+// estimateDuration estimates the duration of the cleanup of the blockdevice from its
+// capacity and drive type. Zero is returned if it cannot be estimated, as the duration
+// of deleting the contents of a filesystem depends on the number of files.
+func estimateDuration(bd *v1alpha1.BlockDevice, method Method, strategy FilesystemStrategy, verify VerifyMode) time.Duration {
+	capacity := bd.Spec.Capacity.Storage
+	ssd := bd.Spec.Details.DriveType == blockdevice.DriveTypeSSD
+	var estimate time.Duration
+	switch {
+	case strategy == FilesystemDelete:
+		return 0
+	case strategy == FilesystemMkfs:
+		estimate = minEstimate
+	case method == MethodDiscard && (!ssd || verify == VerifySample):
+		// the devices which do not support discard are zeroed, and the devices
+		// whose zeros are verified
+		estimate = transferDuration(capacity, hddWriteRate)
+	case (method == MethodSecureErase || method == MethodSanitize) && !ssd:
+		// the drive overwrites all its sectors
+		estimate = transferDuration(capacity, hddWriteRate)
+	default:
+		// the signatures are erased, the blocks discarded or the key changed
+		estimate = minEstimate
+	}
+	if verify == VerifySample {
+		estimate += minEstimate
+	}
+	return estimate
+}
+
+// transferDuration returns the time taken to transfer the bytes at the rate, rounded
+// to the minute, and at least the minimum estimate
+func transferDuration(bytes uint64, rate uint64) time.Duration {
+	d := time.Duration(bytes / rate * uint64(time.Second))
+	if d < minEstimate {
+		return minEstimate
+	}
+	return d.Round(time.Minute)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetDryRun(t *testing.T) {
+	bdc := &v1alpha1.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{Name: "bdc-1",
+		Annotations: map[string]string{DryRunAnnotation: "false"}}}
+	dryRunClaim := &v1alpha1.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{Name: "bdc-2",
+		Annotations: map[string]string{DryRunAnnotation: "true"}}}
+	tests := map[string]struct {
+		annotations   map[string]string
+		claim         *v1alpha1.BlockDeviceClaim
+		defaultDryRun string
+		allowClaim    string
+		want          bool
+		wantSource    string
+		wantErr       bool
+	}{
+		"not a dry run by default": {
+			wantSource: "the operator",
+		},
+		"dry run of the operator": {
+			defaultDryRun: "true",
+			want:          true,
+			wantSource:    "the operator",
+		},
+		"invalid dry run of the operator": {
+			defaultDryRun: "maybe",
+			wantSource:    "the operator",
+		},
+		"dry run of the blockdevice": {
+			annotations: map[string]string{DryRunAnnotation: "true"},
+			want:        true,
+			wantSource:  "BlockDevice blockdevice-a",
+		},
+		"claim disables the dry run of the operator": {
+			claim:         bdc,
+			defaultDryRun: "true",
+			wantSource:    "BlockDeviceClaim bdc-1",
+		},
+		"dry run of the claim is not allowed by default": {
+			claim:      dryRunClaim,
+			wantSource: "the operator",
+		},
+		"dry run of the claim allowed by the blockdevice": {
+			annotations: map[string]string{AllowClaimAnnotation: "dry-run"},
+			claim:       dryRunClaim,
+			want:        true,
+			wantSource:  "BlockDeviceClaim bdc-2",
+		},
+		"dry run of the claim allowed by the operator": {
+			claim:      dryRunClaim,
+			allowClaim: "skip,dry-run",
+			want:       true,
+			wantSource: "BlockDeviceClaim bdc-2",
+		},
+		"blockdevice overrides the operator": {
+			annotations: map[string]string{AllowClaimAnnotation: ""},
+			claim:       dryRunClaim,
+			allowClaim:  "dry-run",
+			wantSource:  "the operator",
+		},
+		"invalid dry run of the blockdevice": {
+			annotations: map[string]string{DryRunAnnotation: "yes"},
+			wantErr:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if len(test.defaultDryRun) != 0 {
+				os.Setenv(EnvCleanupDryRun, test.defaultDryRun)
+				defer os.Unsetenv(EnvCleanupDryRun)
+			}
+			if len(test.allowClaim) != 0 {
+				os.Setenv(EnvCleanupAllowClaim, test.allowClaim)
+				defer os.Unsetenv(EnvCleanupAllowClaim)
+			}
+			bd := newTestBlockDevice("/dev/sdb", "", test.annotations)
+			if test.claim != nil {
+				SetClaimPolicy(bd, test.claim)
+			}
+			got, source, err := GetDryRun(bd)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.wantSource, source)
+		})
+	}
+}
+
+func TestEstimateDuration(t *testing.T) {
+	tests := map[string]struct {
+		method    Method
+		driveType string
+		strategy  FilesystemStrategy
+		verify    VerifyMode
+		want      time.Duration
+	}{
+		"wipefs": {
+			method: MethodWipefs,
+			want:   time.Minute,
+		},
+		"discard of ssd": {
+			method:    MethodDiscard,
+			driveType: blockdevice.DriveTypeSSD,
+			want:      time.Minute,
+		},
+		"discard of hdd zeroes the device": {
+			method:    MethodDiscard,
+			driveType: blockdevice.DriveTypeHDD,
+			want:      1864 * time.Minute,
+		},
+		"secure erase of hdd": {
+			method:    MethodSecureErase,
+			driveType: blockdevice.DriveTypeHDD,
+			want:      1864 * time.Minute,
+		},
+		"discard of ssd with sample verification zeroes the device": {
+			method:    MethodDiscard,
+			driveType: blockdevice.DriveTypeSSD,
+			verify:    VerifySample,
+			want:      1865 * time.Minute,
+		},
+		"crypto erase": {
+			method:    MethodCryptoErase,
+			driveType: blockdevice.DriveTypeHDD,
+			want:      time.Minute,
+		},
+		"mkfs": {
+			method:   MethodDiscard,
+			strategy: FilesystemMkfs,
+			want:     time.Minute,
+		},
+		"delete of the filesystem cannot be estimated": {
+			method:   MethodWipefs,
+			strategy: FilesystemDelete,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bd := newTestBlockDevice("/dev/sdb", "", nil)
+			bd.Spec.Capacity.Storage = 16 << 40
+			bd.Spec.Details.DriveType = test.driveType
+			assert.Equal(t, test.want, estimateDuration(bd, test.method, test.strategy, test.verify))
+		})
+	}
+}
+
+func TestNewPlan(t *testing.T) {
+	bd := newTestBlockDevice("/dev/sdb", "", map[string]string{
+		MethodAnnotation: "discard", FilesystemAnnotation: "mkfs", VerifyAnnotation: "signatures"})
+	bd.Spec.NodeAttributes.NodeName = "node-1"
+	bd.Spec.FileSystem.Type = "ext4"
+	bd.Spec.Capacity.Storage = 1 << 40
+
+	plan, err := NewPlan(bd, "openebs")
+	require.NoError(t, err)
+	assert.Equal(t, "clean /dev/sdb on node-1 using mkfs of the filesystem, verify signatures, about 1m0s", plan.String())
+	assert.Contains(t, plan.Command, "mkfs -t ext4 -F /dev/sdb")
+
+	result := plan.Result(bd)
+	assert.Equal(t, "DryRun using mkfs of the filesystem in 1m0s", result.String())
+	assert.Equal(t, plan.Command, result.Logs)
+
+	bd.Annotations[MethodAnnotation] = "shred"
+	_, err = NewPlan(bd, "openebs")
+	assert.Error(t, err)
+}
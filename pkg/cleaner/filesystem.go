@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+)
+
+// FilesystemStrategy is the way a released blockdevice which has a filesystem is
+// cleaned
+type FilesystemStrategy string
+
+const (
+	// FilesystemDelete deletes the contents of the filesystem, which is mounted by
+	// the cleanup job if the blockdevice is not mounted
+	FilesystemDelete FilesystemStrategy = "delete"
+	// FilesystemMkfs creates a new filesystem of the same type on the device
+	FilesystemMkfs FilesystemStrategy = "mkfs"
+	// FilesystemWipe cleans the device using the cleanup method
+	FilesystemWipe FilesystemStrategy = "wipe"
+)
+
+// FilesystemAnnotation sets the cleanup strategy of the filesystem of the blockdevice
+const FilesystemAnnotation = PolicyAnnotationPrefix + "filesystem"
+
+// filesystemStrategies are the supported cleanup strategies of the filesystems
+var filesystemStrategies = []FilesystemStrategy{FilesystemDelete, FilesystemMkfs, FilesystemWipe}
+
+// filesystemMountPath is the path in the cleanup job container at which the
+// filesystem of a blockdevice which is not mounted is mounted
+const filesystemMountPath = "/mnt/cleanup"
+
+// mkfsForce is the option of mkfs which overwrites the device for each filesystem
+// type that can be created by the cleanup
+var mkfsForce = map[string]string{
+	"ext2": "-F",
+	"ext3": "-F",
+	"ext4": "-F",
+	"xfs":  "-f",
+}
+
+// GetFilesystemStrategy gets the cleanup strategy of the filesystem of the blockdevice,
+// from the policy of the claim or the blockdevice, or the default strategy. A
+// blockdevice without a filesystem is wiped, and the contents of a mounted
+// blockdevice are deleted by default.
+func GetFilesystemStrategy(bd *v1alpha1.BlockDevice) (FilesystemStrategy, error) {
+	if !hasFilesystem(bd) {
+		return FilesystemWipe, nil
+	}
+	value := getPolicy(bd, FilesystemAnnotation)
+	if len(value) == 0 {
+		if getVolumeMode(bd.Spec) == VolumeModeFileSystem {
+			return FilesystemDelete, nil
+		}
+		return getDefaultFilesystemStrategy(), nil
+	}
+	strategy := FilesystemStrategy(value)
+	if !isValidFilesystemStrategy(strategy) {
+		values := make([]string, 0, len(filesystemStrategies))
+		for _, s := range filesystemStrategies {
+			values = append(values, string(s))
+		}
+		return "", fmt.Errorf("invalid filesystem cleanup %q of %s, must be one of %s",
+			value, bd.Name, strings.Join(values, ", "))
+	}
+	return strategy, nil
+}
+
+// isValidFilesystemStrategy checks if the strategy is a supported cleanup strategy
+// of the filesystems
+func isValidFilesystemStrategy(strategy FilesystemStrategy) bool {
+	for _, s := range filesystemStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFilesystem checks if the blockdevice has a filesystem
+func hasFilesystem(bd *v1alpha1.BlockDevice) bool {
+	return len(bd.Spec.FileSystem.Type) != 0 || len(bd.Spec.FileSystem.Mountpoint) != 0
+}
+
+// filesystemCommand returns the command which cleans the filesystem of the blockdevice
+// which is not mounted using the strategy, and verifies it. The contents are deleted
+// in a temporary mount, which is unmounted even if the deletion fails.
+func filesystemCommand(bd *v1alpha1.BlockDevice, strategy FilesystemStrategy, mode VerifyMode) (string, error) {
+	if strategy == FilesystemDelete {
+		return fmt.Sprintf("mkdir -p %[2]s && mount %[1]s %[2]s "+
+			"&& { find %[2]s -mindepth 1 -maxdepth 1 -print0 | xargs -0 rm -rf %[3]s; "+
+			"status=$?; umount %[2]s; [ $status -eq 0 ]; } ",
+			bd.Spec.Path, filesystemMountPath, verifyMountCommand(filesystemMountPath, mode)), nil
+	}
+	fsType := bd.Spec.FileSystem.Type
+	force, ok := mkfsForce[fsType]
+	if !ok {
+		return "", fmt.Errorf("filesystem cleanup %s is not supported on %s with the filesystem %q",
+			strategy, bd.Name, fsType)
+	}
+	args := fmt.Sprintf("wipefs -fa %[1]s && mkfs -t %[2]s %[3]s %[1]s ", bd.Spec.Path, fsType, force)
+	if mode != VerifyNone {
+		// the device is probed directly, instead of reading the cache of blkid
+		args += fmt.Sprintf("&& ([ \"$(blkid -p -o value -s TYPE %[1]s)\" = \"%[2]s\" ] || %[3]s) ",
+			bd.Spec.Path, fsType, failCommand(fmt.Sprintf("the %s filesystem was not created", fsType)))
+	}
+	return args, nil
+}
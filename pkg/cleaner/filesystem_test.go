@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFilesystemStrategy(t *testing.T) {
+	tests := map[string]struct {
+		fsType          string
+		mountpoint      string
+		annotations     map[string]string
+		defaultStrategy string
+		want            FilesystemStrategy
+		wantErr         bool
+	}{
+		"no filesystem is wiped": {
+			annotations: map[string]string{FilesystemAnnotation: "delete"},
+			want:        FilesystemWipe,
+		},
+		"mounted filesystem is deleted": {
+			fsType:          "ext4",
+			mountpoint:      "/mnt/disk",
+			defaultStrategy: "mkfs",
+			want:            FilesystemDelete,
+		},
+		"filesystem is wiped by default": {
+			fsType: "ext4",
+			want:   FilesystemWipe,
+		},
+		"default strategy": {
+			fsType:          "xfs",
+			defaultStrategy: "mkfs",
+			want:            FilesystemMkfs,
+		},
+		"invalid default strategy": {
+			fsType:          "xfs",
+			defaultStrategy: "format",
+			want:            FilesystemWipe,
+		},
+		"strategy of the policy": {
+			fsType:          "xfs",
+			annotations:     map[string]string{FilesystemAnnotation: "delete"},
+			defaultStrategy: "mkfs",
+			want:            FilesystemDelete,
+		},
+		"invalid strategy of the policy": {
+			fsType:      "xfs",
+			annotations: map[string]string{FilesystemAnnotation: "format"},
+			wantErr:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if len(test.defaultStrategy) != 0 {
+				os.Setenv(EnvCleanupFilesystem, test.defaultStrategy)
+				defer os.Unsetenv(EnvCleanupFilesystem)
+			}
+			bd := newTestBlockDevice("/dev/sdb", "", test.annotations)
+			bd.Spec.FileSystem.Type = test.fsType
+			bd.Spec.FileSystem.Mountpoint = test.mountpoint
+			got, err := GetFilesystemStrategy(bd)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestFilesystemCleanupJob(t *testing.T) {
+	bd := newTestBlockDevice("/dev/sdb1", "", map[string]string{
+		FilesystemAnnotation: "delete", VerifyAnnotation: "signatures"})
+	bd.Spec.Details.DeviceType = "partition"
+	bd.Spec.FileSystem.Type = "ext4"
+
+	// the contents are deleted in a temporary mount
+	job, err := NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	args := job.Spec.Template.Spec.Containers[0].Args[0]
+	assert.Equal(t, "mkdir -p /mnt/cleanup && mount /dev/sdb1 /mnt/cleanup "+
+		"&& { find /mnt/cleanup -mindepth 1 -maxdepth 1 -print0 | xargs -0 rm -rf "+
+		`&& ([ -z "$(ls -A /mnt/cleanup)" ] || { echo "verification failed: the filesystem is not empty" | tee /dev/termination-log; exit 1; }) ; `+
+		"status=$?; umount /mnt/cleanup; [ $status -eq 0 ]; } ", args)
+	assert.Equal(t, "The filesystem is empty", VerifiedMessage(bd, VerifySignatures))
+
+	// a new filesystem of the same type is created
+	bd.Annotations[FilesystemAnnotation] = "mkfs"
+	job, err = NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	args = job.Spec.Template.Spec.Containers[0].Args[0]
+	assert.Equal(t, "wipefs -fa /dev/sdb1 && mkfs -t ext4 -F /dev/sdb1 "+
+		`&& ([ "$(blkid -p -o value -s TYPE /dev/sdb1)" = "ext4" ] || { echo "verification failed: the ext4 filesystem was not created" | tee /dev/termination-log; exit 1; }) `, args)
+	assert.Equal(t, "The ext4 filesystem is created", VerifiedMessage(bd, VerifySignatures))
+
+	bd.Spec.FileSystem.Type = "vfat"
+	_, err = NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	assert.Error(t, err)
+
+	// the device is wiped using the cleanup method
+	bd.Annotations[FilesystemAnnotation] = "wipe"
+	job, err = NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Args[0], "wipefs -fa /dev/sdb1 && (types=")
+
+	// only the contents of a mounted filesystem can be deleted
+	bd.Spec.FileSystem.Mountpoint = "/mnt/disk"
+	_, err = NewCleanupJob(bd, VolumeModeFileSystem, nil, "openebs")
+	assert.Error(t, err)
+	delete(bd.Annotations, FilesystemAnnotation)
+	job, err = NewCleanupJob(bd, VolumeModeFileSystem, nil, "openebs")
+	require.NoError(t, err)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Args[0], "find /tmp -mindepth 1")
+}
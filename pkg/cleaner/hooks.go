@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+)
+
+// HookFailurePolicy is the action taken when a cleanup hook fails
+type HookFailurePolicy string
+
+const (
+	// HookBlocking fails the cleanup job when the hook fails. A failed pre-cleanup
+	// hook does not clean the blockdevice.
+	HookBlocking HookFailurePolicy = "blocking"
+	// HookAdvisory logs the failure of the hook, and continues the cleanup
+	HookAdvisory HookFailurePolicy = "advisory"
+)
+
+// the environment variables of the cleanup job container, which are available to
+// the hooks
+const (
+	// HookEnvBlockDevice is the name of the blockdevice being cleaned
+	HookEnvBlockDevice = "NDM_BLOCKDEVICE"
+	// HookEnvDevicePath is the path of the device, or the mountpoint of the filesystem
+	// in the container
+	HookEnvDevicePath = "NDM_DEVICE_PATH"
+	// HookEnvNodeName is the node of the blockdevice
+	HookEnvNodeName = "NDM_NODE_NAME"
+	// HookEnvMethod is the cleanup method
+	HookEnvMethod = "NDM_CLEANUP_METHOD"
+	// HookEnvClaim is the claim from which the blockdevice was released, if it had a
+	// cleanup policy
+	HookEnvClaim = "NDM_BLOCKDEVICE_CLAIM"
+	// hookEnvPre and hookEnvPost hold the hook commands, so that they are not quoted
+	// in the command of the job
+	hookEnvPre  = "NDM_PRE_CLEANUP_HOOK"
+	hookEnvPost = "NDM_POST_CLEANUP_HOOK"
+)
+
+// hook is a shell command run by the cleanup job before or after the cleanup
+type hook struct {
+	// name is the name of the hook used in the messages
+	name string
+	// env is the environment variable of the container with the command
+	env     string
+	command string
+	policy  HookFailurePolicy
+}
+
+// getHooks gets the pre-cleanup and the post-cleanup hooks configured in the operator,
+// nil if the hook is not configured
+func getHooks() (*hook, *hook) {
+	return getHook("pre-cleanup", hookEnvPre, EnvCleanupPreHook, EnvCleanupPreHookFailure),
+		getHook("post-cleanup", hookEnvPost, EnvCleanupPostHook, EnvCleanupPostHookFailure)
+}
+
+// getHook gets the hook whose command and failure policy are set in the environment
+// variables. The failure of a hook is blocking by default.
+func getHook(name, env, commandEnv, policyEnv string) *hook {
+	command := os.Getenv(commandEnv)
+	if len(command) == 0 {
+		return nil
+	}
+	h := &hook{name: name, env: env, command: command, policy: HookBlocking}
+	switch policy := HookFailurePolicy(os.Getenv(policyEnv)); policy {
+	case "", HookBlocking:
+	case HookAdvisory:
+		h.policy = HookAdvisory
+	default:
+		klog.Warningf("invalid %s: %s, using %s", policyEnv, policy, HookBlocking)
+	}
+	return h
+}
+
+// shellCommand returns the command which runs the hook. A blocking hook which fails
+// writes the reason to the termination message and exits.
+func (h *hook) shellCommand() string {
+	onFailure := fmt.Sprintf("echo \"%s hook failed with exit status $?, ignored\"", h.name)
+	if h.policy == HookBlocking {
+		onFailure = fmt.Sprintf("{ echo \"%s hook failed with exit status $?\" | tee %s; exit 1; }",
+			h.name, v1.TerminationMessagePathDefault)
+	}
+	return fmt.Sprintf("{ sh -c \"$%s\" || %s; } ", h.env, onFailure)
+}
+
+// withHooks returns the command of the cleanup job which runs the hooks before and
+// after the cleanup command, and the environment variables used by the hooks
+func withHooks(args string, bd *v1alpha1.BlockDevice, method Method, devicePath string) (string, []v1.EnvVar) {
+	pre, post := getHooks()
+	if pre == nil && post == nil {
+		return args, nil
+	}
+	env := []v1.EnvVar{
+		{Name: HookEnvBlockDevice, Value: bd.Name},
+		{Name: HookEnvDevicePath, Value: devicePath},
+		{Name: HookEnvNodeName, Value: bd.Spec.NodeAttributes.NodeName},
+		{Name: HookEnvMethod, Value: string(method)},
+		{Name: HookEnvClaim, Value: getClaimName(bd)},
+	}
+	if pre != nil {
+		args = pre.shellCommand() + "&& " + args
+		env = append(env, v1.EnvVar{Name: pre.env, Value: pre.command})
+	}
+	if post != nil {
+		args += "&& " + post.shellCommand()
+		env = append(env, v1.EnvVar{Name: post.env, Value: post.command})
+	}
+	return args, env
+}
+
+// getClaimName gets the name of the claim from which the blockdevice was released,
+// from its policy kept on the blockdevice
+func getClaimName(bd *v1alpha1.BlockDevice) string {
+	data, ok := bd.Annotations[ClaimPolicyAnnotation]
+	if !ok {
+		return ""
+	}
+	policy := claimPolicy{}
+	if err := json.Unmarshal([]byte(data), &policy); err != nil {
+		return ""
+	}
+	return policy.Claim
+}
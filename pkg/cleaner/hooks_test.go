@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestWithHooks(t *testing.T) {
+	bd := newTestBlockDevice("/dev/sdb", "", map[string]string{
+		ClaimPolicyAnnotation: `{"claim":"bdc-1","annotations":{}}`})
+	bd.Spec.NodeAttributes.NodeName = "node1"
+
+	// the command is not changed without hooks
+	args, env := withHooks("wipefs -af /dev/sdb ", bd, MethodWipefs, "/dev/sdb")
+	assert.Equal(t, "wipefs -af /dev/sdb ", args)
+	assert.Nil(t, env)
+
+	os.Setenv(EnvCleanupPreHook, "smartctl -a $NDM_DEVICE_PATH")
+	defer os.Unsetenv(EnvCleanupPreHook)
+	os.Setenv(EnvCleanupPostHook, "curl -s http://notify/$NDM_BLOCKDEVICE")
+	defer os.Unsetenv(EnvCleanupPostHook)
+	os.Setenv(EnvCleanupPostHookFailure, "advisory")
+	defer os.Unsetenv(EnvCleanupPostHookFailure)
+	args, env = withHooks("wipefs -af /dev/sdb ", bd, MethodWipefs, "/dev/sdb")
+	assert.Equal(t, `{ sh -c "$NDM_PRE_CLEANUP_HOOK" || `+
+		`{ echo "pre-cleanup hook failed with exit status $?" | tee /dev/termination-log; exit 1; }; } `+
+		`&& wipefs -af /dev/sdb `+
+		`&& { sh -c "$NDM_POST_CLEANUP_HOOK" || echo "post-cleanup hook failed with exit status $?, ignored"; } `, args)
+	assert.Equal(t, []v1.EnvVar{
+		{Name: HookEnvBlockDevice, Value: "blockdevice-a"},
+		{Name: HookEnvDevicePath, Value: "/dev/sdb"},
+		{Name: HookEnvNodeName, Value: "node1"},
+		{Name: HookEnvMethod, Value: "wipefs"},
+		{Name: HookEnvClaim, Value: "bdc-1"},
+		{Name: hookEnvPre, Value: "smartctl -a $NDM_DEVICE_PATH"},
+		{Name: hookEnvPost, Value: "curl -s http://notify/$NDM_BLOCKDEVICE"},
+	}, env)
+
+	// an invalid failure policy is blocking
+	os.Setenv(EnvCleanupPostHookFailure, "ignore")
+	_, post := getHooks()
+	require.NotNil(t, post)
+	assert.Equal(t, HookBlocking, post.policy)
+
+	// the hooks are run in the job of a filesystem
+	os.Unsetenv(EnvCleanupPostHook)
+	bd.Spec.FileSystem.Mountpoint = "/mnt/disk"
+	job, err := NewCleanupJob(bd, VolumeModeFileSystem, nil, "openebs")
+	require.NoError(t, err)
+	container := job.Spec.Template.Spec.Containers[0]
+	assert.Contains(t, container.Args[len(container.Args)-1], `sh -c "$NDM_PRE_CLEANUP_HOOK"`)
+	assert.Contains(t, container.Env, v1.EnvVar{Name: HookEnvDevicePath, Value: "/tmp"})
+}
@@ -30,7 +30,10 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
 )
 
 const (
@@ -47,6 +50,10 @@ type JobController interface {
 	IsCleaningJobRunning(bdName string) bool
 	CancelJob(bdName string) error
 	RemoveJob(bdName string) (CleanupState, error)
+	GetProgress(bdName string, logs LogReader) (*Progress, error)
+	GetVerifyFailure(bdName string, logs LogReader) (string, error)
+	GetFailure(bdName string, logs LogReader) (string, error)
+	GetJobResult(bd *v1alpha1.BlockDevice, logs LogReader) (*Result, error)
 }
 
 var _ JobController = &jobController{}
@@ -68,51 +75,53 @@ func NewCleanupJob(bd *v1alpha1.BlockDevice, volMode VolumeMode, tolerations []v
 		SecurityContext: &v1.SecurityContext{
 			Privileged: &priv,
 		},
+		Resources: getResources(),
+		// the last lines of the logs are the reason for the failure of the job,
+		// unless it is written to the termination message
+		TerminationMessagePolicy: v1.TerminationMessageFallbackToLogsOnError,
 	}
 
 	podSpec := v1.PodSpec{}
 	mountName := "vol-mount"
 
+	method, err := GetMethod(bd)
+	if err != nil {
+		return nil, err
+	}
+	verifyMode, err := GetVerifyMode(bd)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := GetTimeout(bd)
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := GetFilesystemStrategy(bd)
+	if err != nil {
+		return nil, err
+	}
+
 	if volMode == VolumeModeBlock {
 		jobContainer.Command = []string{"/bin/sh", "-c"}
-
-		// fdisk is used to get all the partitions of the device.
-		// Example
-		// $ fdisk -o Device -l /dev/sda
-		// 	Disk /dev/sda: 465.8 GiB, 500107862016 bytes, 976773168 sectors
-		// 	Units: sectors of 1 * 512 = 512 bytes
-		// 	Sector size (logical/physical): 512 bytes / 4096 bytes
-		// 	I/O size (minimum/optimal): 4096 bytes / 4096 bytes
-		// 	Disklabel type: dos
-		// 	Disk identifier: 0x065e2357
-		//
-		// 	Device
-		// 	/dev/sda1
-		// 	/dev/sda2
-		// 	/dev/sda5
-		// 	/dev/sda6
-		// 	/dev/sda7
-		//
-		// From the above output the partitions are filtered using grep,
-		//
-		// first all the partitions are cleared off any filesystem signatures, then the actual partition table
-		// header is removed. partprobe is called so as to re-read partition table, and update system with
-		// the changes.  Partprobe will be called only if the device is a block file; else if its sparse file, wipefs
-		// will be done.
-		// wipefs erases the filesystem signature from the block
-		// -a    wipe all magic strings
-		// -f    force erasure
-		args := fmt.Sprintf("(fdisk -o Device -l %[1]s "+
-			"| grep \"^%[1]s\" "+
-			"| xargs -I '{}' wipefs -fa '{}') "+
-			"&& wipefs -fa %[1]s ",
-			bd.Spec.Path)
-
-		// partprobe need to be executed only if the device is of type disk.
-		if bd.Spec.Details.DeviceType == blockdevice.BlockDeviceTypeDisk {
-			args += fmt.Sprintf("&& partprobe %s ", bd.Spec.Path)
+		var args string
+		if strategy == FilesystemWipe {
+			args, err = cleanupCommand(bd, method, verifyMode)
+			if err != nil {
+				return nil, err
+			}
+			verifyArgs, err := verifyCommand(bd, method, verifyMode)
+			if err != nil {
+				return nil, err
+			}
+			args += verifyArgs
+		} else {
+			// the filesystem is cleaned instead of the device
+			args, err = filesystemCommand(bd, strategy, verifyMode)
+			if err != nil {
+				return nil, err
+			}
 		}
-
+		args, jobContainer.Env = withHooks(args, bd, method, bd.Spec.Path)
 		jobContainer.Args = []string{args}
 
 		// in case of sparse disk, need to mount the sparse file directory
@@ -124,18 +133,59 @@ func NewCleanupJob(bd *v1alpha1.BlockDevice, volMode VolumeMode, tolerations []v
 		}
 
 	} else if volMode == VolumeModeFileSystem {
+		// the device of a mounted blockdevice cannot be erased
+		if strategy != FilesystemDelete {
+			return nil, fmt.Errorf("filesystem cleanup %s is not supported on %s mounted at %s",
+				strategy, bd.Name, bd.Spec.FileSystem.Mountpoint)
+		}
+		if method != MethodWipefs {
+			return nil, fmt.Errorf("cleanup method %s is not supported on %s mounted at %s",
+				method, bd.Name, bd.Spec.FileSystem.Mountpoint)
+		}
 		jobContainer.Command = []string{"/bin/sh", "-c"}
-		jobContainer.Args = []string{"find /tmp -mindepth 1 -maxdepth 1 -print0 | xargs -0 rm -rf"}
+		args, env := withHooks("find /tmp -mindepth 1 -maxdepth 1 -print0 | xargs -0 rm -rf "+
+			verifyMountCommand("/tmp", verifyMode), bd, method, "/tmp")
+		jobContainer.Args = []string{args}
+		jobContainer.Env = env
 		volume, volumeMount := getVolumeMounts(bd.Spec.FileSystem.Mountpoint, "/tmp", mountName)
 
 		jobContainer.VolumeMounts = []v1.VolumeMount{volumeMount}
 		podSpec.Volumes = []v1.Volume{volume}
 	}
 
-	podSpec.Tolerations = tolerations
+	// the tolerations of the caller are copied, so that they are not modified
+	podSpec.Tolerations = append(append([]v1.Toleration{}, tolerations...), getTolerations()...)
 	podSpec.ServiceAccountName = getServiceAccount()
+	podSpec.PriorityClassName = getPriorityClass()
 	podSpec.Containers = []v1.Container{jobContainer}
-	podSpec.NodeSelector = map[string]string{controller.KubernetesHostNameLabel: nodeName}
+	// the hostname label of the blockdevice may not match the label of the node if
+	// the node identity of the daemon is not the hostname, so the node name is used
+	if len(bd.Spec.NodeAttributes.NodeName) != 0 {
+		podSpec.Affinity = &v1.Affinity{
+			NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+					NodeSelectorTerms: []v1.NodeSelectorTerm{{
+						MatchFields: []v1.NodeSelectorRequirement{{
+							Key:      "metadata.name",
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{bd.Spec.NodeAttributes.NodeName},
+						}},
+					}},
+				},
+			},
+		}
+	} else {
+		podSpec.NodeSelector = map[string]string{controller.KubernetesHostNameLabel: nodeName}
+	}
+	// the configured node selector does not replace the node of the blockdevice
+	for key, value := range getNodeSelector() {
+		if podSpec.NodeSelector == nil {
+			podSpec.NodeSelector = make(map[string]string)
+		}
+		if _, ok := podSpec.NodeSelector[key]; !ok {
+			podSpec.NodeSelector[key] = value
+		}
+	}
 	podTemplate := v1.Pod{}
 	podTemplate.Spec = podSpec
 
@@ -153,7 +203,14 @@ func NewCleanupJob(bd *v1alpha1.BlockDevice, volMode VolumeMode, tolerations []v
 	job := &batchv1.Job{}
 	job.ObjectMeta = podTemplate.ObjectMeta
 	job.Spec.Template.Spec = podTemplate.Spec
-	job.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyOnFailure
+	// a failed cleanup is retried by the operator with a new job, after a backoff
+	job.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+	backoffLimit := int32(0)
+	job.Spec.BackoffLimit = &backoffLimit
+	if timeout > 0 {
+		deadline := int64(timeout.Seconds())
+		job.Spec.ActiveDeadlineSeconds = &deadline
+	}
 
 	return job, nil
 }
@@ -185,7 +242,7 @@ func (c *jobController) IsCleaningJobRunning(bdName string) bool {
 		return true
 	}
 
-	return job.Status.Succeeded <= 0
+	return job.Status.Succeeded <= 0 && getFailedCondition(job) == nil
 }
 
 func (c *jobController) RemoveJob(bdName string) (CleanupState, error) {
@@ -203,6 +260,9 @@ func (c *jobController) RemoveJob(bdName string) (CleanupState, error) {
 		}
 		return CleanupStateUnknown, err
 	}
+	if getFailedCondition(job) != nil {
+		return CleanupStateFailed, nil
+	}
 	if job.Status.Succeeded == 0 {
 		return CleanupStateRunning, nil
 	}
@@ -230,6 +290,129 @@ func (c *jobController) CancelJob(bdName string) error {
 	return err
 }
 
+// GetProgress returns the last progress reported in the logs of the cleanup job of
+// the BD, or nil if the job has not reported its progress
+func (c *jobController) GetProgress(bdName string, logs LogReader) (*Progress, error) {
+	jobName := generateCleaningJobName(bdName)
+	job := &batchv1.Job{}
+	err := c.client.Get(context.TODO(), client.ObjectKey{Namespace: c.namespace, Name: jobName}, job)
+	if err != nil {
+		return nil, err
+	}
+	data, err := logs.TailLogs(c.namespace, jobName, progressLogLines)
+	if err != nil {
+		return nil, err
+	}
+	done, total, ok := parseProgress(data)
+	if !ok {
+		return nil, nil
+	}
+	progress := &Progress{Done: done, Total: total}
+	if job.Status.StartTime != nil {
+		progress.Elapsed = time.Since(job.Status.StartTime.Time)
+	}
+	return progress, nil
+}
+
+// GetVerifyFailure returns the reason for which the verification of the cleanup of the
+// BD failed, or an empty string if the verification has not failed
+func (c *jobController) GetVerifyFailure(bdName string, logs LogReader) (string, error) {
+	message, err := logs.TerminationMessage(c.namespace, generateCleaningJobName(bdName))
+	if err != nil {
+		return "", err
+	}
+	reason, _ := parseVerifyFailure(message)
+	return reason, nil
+}
+
+// GetFailure returns the reason for which the cleanup job of the BD failed, or an
+// empty string if the job has not failed or is being deleted. The reason is the last
+// line of the termination message of the job container, if the logs can be read.
+func (c *jobController) GetFailure(bdName string, logs LogReader) (string, error) {
+	jobName := generateCleaningJobName(bdName)
+	job := &batchv1.Job{}
+	err := c.client.Get(context.TODO(), client.ObjectKey{Namespace: c.namespace, Name: jobName}, job)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	cond := getFailedCondition(job)
+	if cond == nil || job.DeletionTimestamp != nil {
+		return "", nil
+	}
+	if cond.Reason == "DeadlineExceeded" && job.Spec.ActiveDeadlineSeconds != nil {
+		return fmt.Sprintf("timed out after %s", time.Duration(*job.Spec.ActiveDeadlineSeconds)*time.Second), nil
+	}
+	if logs != nil {
+		message, err := logs.TerminationMessage(c.namespace, jobName)
+		if err != nil {
+			klog.V(4).Infof("unable to get the termination message of %s: %v", jobName, err)
+		}
+		lines := strings.Split(strings.TrimSpace(message), "\n")
+		if reason := strings.TrimSpace(lines[len(lines)-1]); len(reason) != 0 {
+			return reason, nil
+		}
+	}
+	if len(cond.Message) != 0 {
+		return cond.Message, nil
+	}
+	return "the cleanup job failed", nil
+}
+
+// GetJobResult returns the result of the cleanup job of the BD which has completed or
+// failed, with the last lines of its logs if they can be read, or nil if the job has
+// not finished. The bytes cleaned by a failed job are estimated from its progress.
+func (c *jobController) GetJobResult(bd *v1alpha1.BlockDevice, logs LogReader) (*Result, error) {
+	jobName := generateCleaningJobName(bd.Name)
+	job := &batchv1.Job{}
+	err := c.client.Get(context.TODO(), client.ObjectKey{Namespace: c.namespace, Name: jobName}, job)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var result *Result
+	if cond := getFailedCondition(job); cond != nil {
+		result = newResult(bd, resultStatusFailed, job.Status.StartTime, &cond.LastTransitionTime)
+		if result.Reason, err = c.GetFailure(bd.Name, logs); err != nil {
+			return nil, err
+		}
+	} else if job.Status.Succeeded > 0 {
+		result = newResult(bd, resultStatusSucceeded, job.Status.StartTime, job.Status.CompletionTime)
+	} else {
+		return nil, nil
+	}
+	if logs == nil {
+		return result, nil
+	}
+	// the progress lines are read along with the logs, and dropped from them
+	data, err := logs.TailLogs(c.namespace, jobName, progressLogLines+resultLogLines)
+	if err != nil {
+		klog.V(4).Infof("unable to get the logs of %s: %v", jobName, err)
+		return result, nil
+	}
+	result.Logs = tailResultLogs(data)
+	if done, total, ok := parseProgress(data); ok && result.Status == resultStatusFailed {
+		result.Bytes = uint64(float64(bd.Spec.Capacity.Storage) * float64(done) / float64(total))
+	}
+	return result, nil
+}
+
+// getFailedCondition returns the failed condition of the job, or nil if the job has
+// not failed
+func getFailedCondition(job *batchv1.Job) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		cond := &job.Status.Conditions[i]
+		if cond.Type == batchv1.JobFailed && cond.Status == v1.ConditionTrue {
+			return cond
+		}
+	}
+	return nil
+}
+
 func generateCleaningJobName(bdName string) string {
 	return JobNamePrefix + bdName
 }
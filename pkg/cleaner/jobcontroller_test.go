@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestNewCleanupJob(t *testing.T) {
+	env := map[string]string{
+		EnvCleanUpJobImage:          "registry.local/linux-utils:3.1",
+		ServiceAccountName:          "openebs-maya-operator",
+		EnvCleanUpJobServiceAccount: "ndm-cleanup",
+		EnvCleanUpJobPriorityClass:  "system-node-critical",
+		EnvCleanUpJobResources:      `{"requests":{"cpu":"100m"},"limits":{"memory":"128Mi"}}`,
+		EnvCleanUpJobTolerations:    `[{"key":"dedicated","operator":"Equal","value":"storage","effect":"NoSchedule"}]`,
+		EnvCleanUpJobNodeSelector:   "disktype=ssd,kubernetes.io/hostname=node2",
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+	bd := newTestBlockDevice("/dev/sdb", "", nil)
+	bd.Labels = map[string]string{"kubernetes.io/hostname": "node1"}
+	// the tolerations of the node have spare capacity, which is not to be
+	// written by the job
+	nodeToleration := v1.Toleration{Key: "node.kubernetes.io/unschedulable", Operator: v1.TolerationOpExists}
+	nodeTolerations := append(make([]v1.Toleration, 0, 2), nodeToleration)
+
+	job, err := NewCleanupJob(bd, VolumeModeBlock, nodeTolerations, "openebs")
+	require.NoError(t, err)
+	assert.Equal(t, "cleanup-blockdevice-a", job.Name)
+	podSpec := job.Spec.Template.Spec
+	require.Len(t, podSpec.Containers, 1)
+	assert.Equal(t, "registry.local/linux-utils:3.1", podSpec.Containers[0].Image)
+	assert.Equal(t, "ndm-cleanup", podSpec.ServiceAccountName)
+	assert.Equal(t, "system-node-critical", podSpec.PriorityClassName)
+	assert.Equal(t, v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+		Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")},
+	}, podSpec.Containers[0].Resources)
+	assert.Equal(t, []v1.Toleration{nodeToleration, {Key: "dedicated", Operator: v1.TolerationOpEqual,
+		Value: "storage", Effect: v1.TaintEffectNoSchedule}}, podSpec.Tolerations)
+	assert.Equal(t, v1.Toleration{}, nodeTolerations[:2][1])
+	// the configured node selector does not replace the node of the blockdevice
+	assert.Equal(t, map[string]string{"kubernetes.io/hostname": "node1", "disktype": "ssd"}, podSpec.NodeSelector)
+	// the failed jobs are retried by the operator
+	assert.Equal(t, v1.RestartPolicyNever, podSpec.RestartPolicy)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+	assert.Equal(t, int64(24*3600), *job.Spec.ActiveDeadlineSeconds)
+	assert.Equal(t, v1.TerminationMessageFallbackToLogsOnError, podSpec.Containers[0].TerminationMessagePolicy)
+
+	// invalid configuration is ignored
+	os.Setenv(EnvCleanUpJobResources, "{")
+	os.Setenv(EnvCleanUpJobTolerations, "dedicated")
+	os.Unsetenv(EnvCleanUpJobServiceAccount)
+	job, err = NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	podSpec = job.Spec.Template.Spec
+	assert.Equal(t, "openebs-maya-operator", podSpec.ServiceAccountName)
+	assert.Equal(t, v1.ResourceRequirements{}, podSpec.Containers[0].Resources)
+	assert.Empty(t, podSpec.Tolerations)
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+)
+
+// Method is the method used by the cleanup job to clean a released blockdevice
+type Method string
+
+const (
+	// MethodWipefs erases the filesystem signatures and the partition table of the
+	// device, or deletes the contents of the filesystem of a mounted blockdevice
+	MethodWipefs Method = "wipefs"
+	// MethodSecureErase runs the secure erase of the drive, ATA SECURITY ERASE UNIT,
+	// NVMe Format with user data erase or SCSI SANITIZE block erase
+	MethodSecureErase Method = "secure-erase"
+	// MethodSanitize runs the sanitize block erase of the drive, ATA SANITIZE,
+	// NVMe Sanitize or SCSI SANITIZE
+	MethodSanitize Method = "sanitize"
+	// MethodDiscard discards all the blocks of the device, or zeroes the device if
+	// it does not support discard
+	MethodDiscard Method = "discard"
+	// MethodQuick erases the signatures and the partition table of the device like
+	// wipefs, and zeroes the regions at the start and the end of the device which
+	// hold the GPT headers and the RAID superblocks
+	MethodQuick Method = "quick"
+	// MethodCryptoErase changes the media encryption key of a self-encrypting drive,
+	// so that the data on it cannot be decrypted, using the ATA SANITIZE CRYPTO
+	// SCRAMBLE, NVMe Format with cryptographic erase or SCSI SANITIZE CRYPTOGRAPHIC ERASE
+	MethodCryptoErase Method = "crypto-erase"
+)
+
+// MethodAnnotation sets the cleanup method of the blockdevice
+const MethodAnnotation = PolicyAnnotationPrefix + "method"
+
+// methods are the supported cleanup methods
+var methods = []Method{MethodWipefs, MethodSecureErase, MethodSanitize, MethodDiscard, MethodQuick, MethodCryptoErase}
+
+// ataVendor is the vendor of the ATA drives attached through libata
+const ataVendor = "ATA"
+
+// GetMethod gets the cleanup method of the blockdevice, from the policy of the
+// claim or the blockdevice, or the default method
+func GetMethod(bd *v1alpha1.BlockDevice) (Method, error) {
+	value := getPolicy(bd, MethodAnnotation)
+	if len(value) == 0 {
+		return getDefaultMethod(), nil
+	}
+	method := Method(value)
+	if !isValidMethod(method) {
+		return "", fmt.Errorf("invalid cleanup method %q of %s, must be one of %s",
+			value, bd.Name, joinMethods(methods))
+	}
+	return method, nil
+}
+
+// isValidMethod checks if the method is a supported cleanup method
+func isValidMethod(method Method) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// joinMethods joins the methods as a comma separated list
+func joinMethods(methods []Method) string {
+	values := make([]string, 0, len(methods))
+	for _, method := range methods {
+		values = append(values, string(method))
+	}
+	return strings.Join(values, ", ")
+}
+
+// cleanupCommand returns the shell command run by the cleanup job to clean the
+// blockdevice in the block volume mode using the method, and verified using the mode
+func cleanupCommand(bd *v1alpha1.BlockDevice, method Method, mode VerifyMode) (string, error) {
+	switch method {
+	case MethodWipefs:
+		return wipefsCommand(bd), nil
+	case MethodDiscard:
+		return discardCommand(bd, mode == VerifySample)
+	case MethodQuick:
+		return quickCommand(bd), nil
+	}
+	// the erase commands work on the whole drive
+	if bd.Spec.Details.DeviceType != blockdevice.BlockDeviceTypeDisk {
+		return "", fmt.Errorf("cleanup method %s is not supported on %s of type %s",
+			method, bd.Name, bd.Spec.Details.DeviceType)
+	}
+	// the key can be changed only on the drives which encrypt their media
+	if method == MethodCryptoErase && len(bd.Spec.Details.SED) == 0 {
+		return "", fmt.Errorf("cleanup method %s is not supported on %s, which is not a self-encrypting drive",
+			method, bd.Name)
+	}
+	var args string
+	switch {
+	case strings.HasPrefix(bd.Spec.Path, "/dev/nvme"):
+		args = nvmeEraseCommand(bd.Spec.Path, method)
+	case bd.Spec.Details.Vendor == ataVendor:
+		args = ataEraseCommand(bd.Spec.Path, method)
+	case method == MethodCryptoErase:
+		args = fmt.Sprintf("sg_sanitize --crypto --quick %s ", bd.Spec.Path)
+	default:
+		// SCSI has no secure erase other than the sanitize
+		args = fmt.Sprintf("sg_sanitize --block --quick %s ", bd.Spec.Path)
+	}
+	// the partition table is erased along with the data, and is re-read
+	return args + fmt.Sprintf("&& partprobe %s ", bd.Spec.Path), nil
+}
+
+// isSparseFile returns true if the blockdevice is a sparse file which is not backed
+// by a loop device. A sparse file backed by a loop device is cleaned up like the disks.
+func isSparseFile(bd *v1alpha1.BlockDevice) bool {
+	return bd.Spec.Details.DeviceType == blockdevice.SparseBlockDeviceType &&
+		!strings.HasPrefix(bd.Spec.Path, "/dev/")
+}
+
+// hasPartitionTable returns true if the partition table of the blockdevice is read
+// by the kernel, which are the disks and the sparse files backed by loop devices
+func hasPartitionTable(bd *v1alpha1.BlockDevice) bool {
+	return bd.Spec.Details.DeviceType == blockdevice.BlockDeviceTypeDisk ||
+		(bd.Spec.Details.DeviceType == blockdevice.SparseBlockDeviceType && !isSparseFile(bd))
+}
+
+// wipefsCommand returns the command which erases the filesystem signatures and
+// the partition table of the blockdevice
+func wipefsCommand(bd *v1alpha1.BlockDevice) string {
+	args := signaturesCommand(bd.Spec.Path)
+
+	// partprobe need to be executed only if the device has a partition table.
+	if hasPartitionTable(bd) {
+		args += fmt.Sprintf("&& partprobe %s ", bd.Spec.Path)
+	}
+	return args
+}
+
+// signaturesCommand returns the command which erases the filesystem signatures of
+// the partitions of the device at the path, and then the signatures and the
+// partition table of the device
+func signaturesCommand(path string) string {
+	// fdisk is used to get all the partitions of the device.
+	// Example
+	// $ fdisk -o Device -l /dev/sda
+	// 	Disk /dev/sda: 465.8 GiB, 500107862016 bytes, 976773168 sectors
+	// 	Units: sectors of 1 * 512 = 512 bytes
+	// 	Sector size (logical/physical): 512 bytes / 4096 bytes
+	// 	I/O size (minimum/optimal): 4096 bytes / 4096 bytes
+	// 	Disklabel type: dos
+	// 	Disk identifier: 0x065e2357
+	//
+	// 	Device
+	// 	/dev/sda1
+	// 	/dev/sda2
+	// 	/dev/sda5
+	// 	/dev/sda6
+	// 	/dev/sda7
+	//
+	// From the above output the partitions are filtered using grep,
+	//
+	// first all the partitions are cleared off any filesystem signatures, then the actual partition table
+	// header is removed. partprobe is called so as to re-read partition table, and update system with
+	// the changes.  Partprobe will be called only if the device is a block file; else if its sparse file, wipefs
+	// will be done.
+	// wipefs erases the filesystem signature from the block
+	// -a    wipe all magic strings
+	// -f    force erasure
+	return fmt.Sprintf("(fdisk -o Device -l %[1]s "+
+		"| grep \"^%[1]s\" "+
+		"| xargs -I '{}' wipefs -fa '{}') "+
+		"&& wipefs -fa %[1]s ",
+		path)
+}
+
+// headerSectors is the number of 512 byte sectors zeroed at the start and the end
+// of the device by the quick cleanup, 1MiB
+const headerSectors = 2048
+
+// quickCommand returns the command which erases the signatures and the partition
+// table of the blockdevice, and zeroes the first and the last MiB of the device.
+// They hold the primary and the backup GPT headers and partition entries, the MBR,
+// the LVM label and the md superblocks, which remain if wipefs does not recognize
+// them, eg: a GPT whose primary header is corrupt. The size of a sparse file is its
+// size on the filesystem. A device of 1MiB or less is zeroed entirely by the first
+// dd, so that it is not written past its end.
+func quickCommand(bd *v1alpha1.BlockDevice) string {
+	size := fmt.Sprintf("$(blockdev --getsize64 %s)", bd.Spec.Path)
+	if isSparseFile(bd) {
+		size = fmt.Sprintf("$(stat -c %%s %s)", bd.Spec.Path)
+	}
+	args := signaturesCommand(bd.Spec.Path) +
+		fmt.Sprintf("&& sectors=$((%[2]s / 512)) "+
+			"&& dd if=/dev/zero of=%[1]s bs=512 count=$((sectors < %[3]d ? sectors : %[3]d)) conv=notrunc,fsync "+
+			"&& if [ $sectors -gt %[3]d ]; then "+
+			"dd if=/dev/zero of=%[1]s bs=512 count=%[3]d seek=$((sectors - %[3]d)) conv=notrunc,fsync; fi ",
+			bd.Spec.Path, size, headerSectors)
+	if hasPartitionTable(bd) {
+		args += fmt.Sprintf("&& partprobe %s ", bd.Spec.Path)
+	}
+	return args
+}
+
+// discardCommand returns the command which discards all the blocks of the device.
+// If the device does not support discard, the kernel writes zeros over the device
+// for --zeroout, which takes much longer, so the device is zeroed in steps and the
+// progress is reported after each step. The signatures are wiped after the discard,
+// since the discarded blocks may not read as zeros. If zero is set, the device is
+// always zeroed using --zeroout, which discards the blocks only on the devices which
+// guarantee that they read as zeros, so that the zeros can be verified.
+func discardCommand(bd *v1alpha1.BlockDevice, zero bool) (string, error) {
+	if isSparseFile(bd) {
+		return "", fmt.Errorf("cleanup method %s is not supported on the sparse file %s", MethodDiscard, bd.Name)
+	}
+	discard := fmt.Sprintf("(blkdiscard %s || %s) ", bd.Spec.Path, zeroCommand(bd.Spec.Path))
+	if zero {
+		discard = zeroCommand(bd.Spec.Path) + " "
+	}
+	args := discard + fmt.Sprintf("&& wipefs -fa %s ", bd.Spec.Path)
+	if hasPartitionTable(bd) {
+		args += fmt.Sprintf("&& partprobe %s ", bd.Spec.Path)
+	}
+	return args, nil
+}
+
+// zeroStep is the size of the device zeroed in each step, after which the
+// progress is reported
+const zeroStep = 1 << 30
+
+// zeroCommand returns the command which zeroes the device in steps, and reports
+// the bytes zeroed after each step
+func zeroCommand(path string) string {
+	return fmt.Sprintf("(size=$(blockdev --getsize64 %[1]s) && offset=0 "+
+		"&& while [ $offset -lt $size ]; do "+
+		"length=$((size - offset)); [ $length -gt %[2]d ] && length=%[2]d; "+
+		"blkdiscard --zeroout --offset $offset --length $length %[1]s || exit 1; "+
+		"offset=$((offset + length)); echo \"%[3]s $offset $size\"; done)",
+		path, zeroStep, ProgressPrefix)
+}
+
+// nvmeEraseCommand returns the nvme-cli command which erases the NVMe namespace.
+// The sanitize runs in the background, so its log is polled till it completes, and
+// the sanitize progress in the log, in units of 1/65536, is reported. The sanitize
+// erases the whole NVM subsystem, and the format erases all the namespaces of the
+// controller if its FNA reports so, so they are refused if the namespace is not the
+// only one on the controller.
+func nvmeEraseCommand(path string, method Method) string {
+	switch method {
+	case MethodSecureErase:
+		return nvmeNamespacesCheck(path, "format", true) + fmt.Sprintf("&& nvme format --ses=1 %s ", path)
+	case MethodCryptoErase:
+		return nvmeNamespacesCheck(path, "format", true) + fmt.Sprintf("&& nvme format --ses=2 %s ", path)
+	}
+	return nvmeNamespacesCheck(path, "sanitize", false) + fmt.Sprintf("&& nvme sanitize --sanact=2 %[1]s "+
+		"&& while nvme sanitize-log %[1]s | grep -qiE \"in (progress|process)\"; do "+
+		"echo \"%[2]s $(nvme sanitize-log -o json %[1]s | sed -n 's/.*\"sprog\" *: *\\([0-9]*\\).*/\\1/p') 65536\"; "+
+		"sleep 10; done ",
+		path, ProgressPrefix)
+}
+
+// nvmeNamespacesCheck returns the command which fails if the controller of the NVMe
+// namespace at the path has other namespaces, which the action would erase too.
+// If checkFNA is set, the other namespaces are erased only if the FNA of the
+// controller reports that the format, bit 0, or the secure erase, bit 1, applies
+// to all the namespaces, and are assumed to be if the FNA cannot be read.
+func nvmeNamespacesCheck(path, action string, checkFNA bool) string {
+	readFNA, fnaScope := "", ""
+	if checkFNA {
+		readFNA = fmt.Sprintf("fna=$(nvme id-ctrl -o json %s | sed -n 's/.*\"fna\" *: *\\([0-9]*\\).*/\\1/p'); ", path)
+		fnaScope = "[ $((${fna:-3} & 3)) -eq 0 ] || "
+	}
+	return fmt.Sprintf("(namespaces=$(nvme list-ns %[1]s) || exit 1; "+
+		"count=$(echo \"$namespaces\" | grep -c \"^\\[\"); %[3]s"+
+		"[ $count -le 1 ] || %[4]s"+
+		"{ echo \"refusing to %[2]s %[1]s, it would erase the $count namespaces of the controller\" >&2; exit 1; }) ",
+		path, action, readFNA, fnaScope)
+}
+
+// ataEraseCommand returns the hdparm command which erases the ATA drive. The
+// secure erase needs a temporary user password, which is cleared by the erase.
+// The erase is refused if the security of the drive is frozen. A password left by
+// an erase which did not complete, eg: if the job was killed, is cleared before the
+// erase, and the password is cleared if the erase fails, so that the drive is not
+// left locked.
+func ataEraseCommand(path string, method Method) string {
+	if method == MethodSecureErase {
+		return fmt.Sprintf("(security=$(hdparm -I %[1]s) || exit 1; "+
+			"echo \"$security\" | grep -qE \"^[[:space:]]+frozen\" "+
+			"&& { echo \"refusing to erase %[1]s, its security is frozen\" >&2; exit 1; }; "+
+			"echo \"$security\" | grep -qE \"^[[:space:]]+locked\" "+
+			"&& { hdparm --user-master u --security-unlock ndm %[1]s "+
+			"|| { echo \"refusing to erase %[1]s, it is locked with an unknown password\" >&2; exit 1; }; }; "+
+			"echo \"$security\" | grep -qE \"^[[:space:]]+enabled\" "+
+			"&& { hdparm --user-master u --security-disable ndm %[1]s || exit 1; }; exit 0) "+
+			"&& hdparm --user-master u --security-set-pass ndm %[1]s "+
+			"&& (hdparm --user-master u --security-erase ndm %[1]s "+
+			"|| { hdparm --user-master u --security-disable ndm %[1]s; exit 1; }) ",
+			path)
+	}
+	action := "--sanitize-block-erase"
+	if method == MethodCryptoErase {
+		action = "--sanitize-crypto-scramble"
+	}
+	return fmt.Sprintf("hdparm --yes-i-know-what-i-am-doing %[2]s %[1]s "+
+		"&& while hdparm --sanitize-status %[1]s | grep -qiE \"in (progress|process)\"; do sleep 10; done ",
+		path, action)
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestBlockDevice(path, vendor string, annotations map[string]string) *v1alpha1.BlockDevice {
+	bd := &v1alpha1.BlockDevice{ObjectMeta: metav1.ObjectMeta{Name: "blockdevice-a", Annotations: annotations}}
+	bd.Spec.Path = path
+	bd.Spec.Details.DeviceType = blockdevice.BlockDeviceTypeDisk
+	bd.Spec.Details.Vendor = vendor
+	return bd
+}
+
+func TestGetMethod(t *testing.T) {
+	bdc := &v1alpha1.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{Name: "bdc-1",
+		Annotations: map[string]string{MethodAnnotation: "sanitize", "ndm.io/other": "x"}}}
+	tests := map[string]struct {
+		annotations   map[string]string
+		claim         *v1alpha1.BlockDeviceClaim
+		defaultMethod string
+		want          Method
+		wantErr       bool
+	}{
+		"default method": {
+			want: MethodWipefs,
+		},
+		"default method from env": {
+			defaultMethod: "secure-erase",
+			want:          MethodSecureErase,
+		},
+		"invalid default method from env": {
+			defaultMethod: "shred",
+			want:          MethodWipefs,
+		},
+		"method of the blockdevice": {
+			annotations: map[string]string{MethodAnnotation: "secure-erase"},
+			want:        MethodSecureErase,
+		},
+		"method of the claim takes precedence": {
+			annotations: map[string]string{MethodAnnotation: "secure-erase"},
+			claim:       bdc,
+			want:        MethodSanitize,
+		},
+		"invalid method": {
+			annotations: map[string]string{MethodAnnotation: "shred"},
+			wantErr:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv(EnvCleanupMethod, test.defaultMethod)
+			defer os.Unsetenv(EnvCleanupMethod)
+			bd := newTestBlockDevice("/dev/sdb", "", test.annotations)
+			if test.claim != nil {
+				SetClaimPolicy(bd, test.claim)
+			}
+			got, err := GetMethod(bd)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+
+			ClearClaimPolicy(bd)
+			assert.NotContains(t, bd.Annotations, ClaimPolicyAnnotation)
+		})
+	}
+}
+
+func TestCleanupCommand(t *testing.T) {
+	tests := map[string]struct {
+		bd      *v1alpha1.BlockDevice
+		method  Method
+		want    string
+		wantErr bool
+	}{
+		"wipefs": {
+			bd:     newTestBlockDevice("/dev/sdb", "ATA", nil),
+			method: MethodWipefs,
+			want: "(fdisk -o Device -l /dev/sdb | grep \"^/dev/sdb\" | xargs -I '{}' wipefs -fa '{}') " +
+				"&& wipefs -fa /dev/sdb && partprobe /dev/sdb ",
+		},
+		"ata secure erase": {
+			bd:     newTestBlockDevice("/dev/sdb", "ATA", nil),
+			method: MethodSecureErase,
+			want: "(security=$(hdparm -I /dev/sdb) || exit 1; " +
+				"echo \"$security\" | grep -qE \"^[[:space:]]+frozen\" " +
+				"&& { echo \"refusing to erase /dev/sdb, its security is frozen\" >&2; exit 1; }; " +
+				"echo \"$security\" | grep -qE \"^[[:space:]]+locked\" " +
+				"&& { hdparm --user-master u --security-unlock ndm /dev/sdb " +
+				"|| { echo \"refusing to erase /dev/sdb, it is locked with an unknown password\" >&2; exit 1; }; }; " +
+				"echo \"$security\" | grep -qE \"^[[:space:]]+enabled\" " +
+				"&& { hdparm --user-master u --security-disable ndm /dev/sdb || exit 1; }; exit 0) " +
+				"&& hdparm --user-master u --security-set-pass ndm /dev/sdb " +
+				"&& (hdparm --user-master u --security-erase ndm /dev/sdb " +
+				"|| { hdparm --user-master u --security-disable ndm /dev/sdb; exit 1; }) && partprobe /dev/sdb ",
+		},
+		"nvme secure erase": {
+			bd:     newTestBlockDevice("/dev/nvme0n1", "", nil),
+			method: MethodSecureErase,
+			want: "(namespaces=$(nvme list-ns /dev/nvme0n1) || exit 1; " +
+				"count=$(echo \"$namespaces\" | grep -c \"^\\[\"); " +
+				"fna=$(nvme id-ctrl -o json /dev/nvme0n1 | sed -n 's/.*\"fna\" *: *\\([0-9]*\\).*/\\1/p'); " +
+				"[ $count -le 1 ] || [ $((${fna:-3} & 3)) -eq 0 ] || " +
+				"{ echo \"refusing to format /dev/nvme0n1, it would erase the $count namespaces of the controller\" >&2; exit 1; }) " +
+				"&& nvme format --ses=1 /dev/nvme0n1 && partprobe /dev/nvme0n1 ",
+		},
+		"nvme sanitize": {
+			bd:     newTestBlockDevice("/dev/nvme0n1", "", nil),
+			method: MethodSanitize,
+			want: "(namespaces=$(nvme list-ns /dev/nvme0n1) || exit 1; " +
+				"count=$(echo \"$namespaces\" | grep -c \"^\\[\"); [ $count -le 1 ] || " +
+				"{ echo \"refusing to sanitize /dev/nvme0n1, it would erase the $count namespaces of the controller\" >&2; exit 1; }) " +
+				"&& nvme sanitize --sanact=2 /dev/nvme0n1 " +
+				"&& while nvme sanitize-log /dev/nvme0n1 | grep -qiE \"in (progress|process)\"; do " +
+				"echo \"ndm-cleanup-progress $(nvme sanitize-log -o json /dev/nvme0n1 " +
+				"| sed -n 's/.*\"sprog\" *: *\\([0-9]*\\).*/\\1/p') 65536\"; sleep 10; done " +
+				"&& partprobe /dev/nvme0n1 ",
+		},
+		"scsi sanitize": {
+			bd:     newTestBlockDevice("/dev/sdc", "SEAGATE", nil),
+			method: MethodSecureErase,
+			want:   "sg_sanitize --block --quick /dev/sdc && partprobe /dev/sdc ",
+		},
+		"discard": {
+			bd:     newTestBlockDevice("/dev/nvme0n1", "", nil),
+			method: MethodDiscard,
+			want: "(blkdiscard /dev/nvme0n1 || (size=$(blockdev --getsize64 /dev/nvme0n1) && offset=0 " +
+				"&& while [ $offset -lt $size ]; do length=$((size - offset)); " +
+				"[ $length -gt 1073741824 ] && length=1073741824; " +
+				"blkdiscard --zeroout --offset $offset --length $length /dev/nvme0n1 || exit 1; " +
+				"offset=$((offset + length)); echo \"ndm-cleanup-progress $offset $size\"; done)) " +
+				"&& wipefs -fa /dev/nvme0n1 && partprobe /dev/nvme0n1 ",
+		},
+		"discard of a partition": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/dev/sdb1", "ATA", nil)
+				bd.Spec.Details.DeviceType = blockdevice.BlockDeviceTypePartition
+				return bd
+			}(),
+			method: MethodDiscard,
+			want: "(blkdiscard /dev/sdb1 || (size=$(blockdev --getsize64 /dev/sdb1) && offset=0 " +
+				"&& while [ $offset -lt $size ]; do length=$((size - offset)); " +
+				"[ $length -gt 1073741824 ] && length=1073741824; " +
+				"blkdiscard --zeroout --offset $offset --length $length /dev/sdb1 || exit 1; " +
+				"offset=$((offset + length)); echo \"ndm-cleanup-progress $offset $size\"; done)) " +
+				"&& wipefs -fa /dev/sdb1 ",
+		},
+		"discard of a sparse file": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/var/openebs/sparse/0-ndm-sparse.img", "", nil)
+				bd.Spec.Details.DeviceType = blockdevice.SparseBlockDeviceType
+				return bd
+			}(),
+			method:  MethodDiscard,
+			wantErr: true,
+		},
+		"discard of a sparse file backed by a loop device": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/dev/loop3", "", nil)
+				bd.Spec.Details.DeviceType = blockdevice.SparseBlockDeviceType
+				return bd
+			}(),
+			method: MethodDiscard,
+			want: "(blkdiscard /dev/loop3 || (size=$(blockdev --getsize64 /dev/loop3) && offset=0 " +
+				"&& while [ $offset -lt $size ]; do length=$((size - offset)); " +
+				"[ $length -gt 1073741824 ] && length=1073741824; " +
+				"blkdiscard --zeroout --offset $offset --length $length /dev/loop3 || exit 1; " +
+				"offset=$((offset + length)); echo \"ndm-cleanup-progress $offset $size\"; done)) " +
+				"&& wipefs -fa /dev/loop3 && partprobe /dev/loop3 ",
+		},
+		"quick": {
+			bd:     newTestBlockDevice("/dev/sdb", "ATA", nil),
+			method: MethodQuick,
+			want: "(fdisk -o Device -l /dev/sdb | grep \"^/dev/sdb\" | xargs -I '{}' wipefs -fa '{}') " +
+				"&& wipefs -fa /dev/sdb && sectors=$(($(blockdev --getsize64 /dev/sdb) / 512)) " +
+				"&& dd if=/dev/zero of=/dev/sdb bs=512 count=$((sectors < 2048 ? sectors : 2048)) conv=notrunc,fsync " +
+				"&& if [ $sectors -gt 2048 ]; then " +
+				"dd if=/dev/zero of=/dev/sdb bs=512 count=2048 seek=$((sectors - 2048)) conv=notrunc,fsync; fi " +
+				"&& partprobe /dev/sdb ",
+		},
+		"quick of a sparse file": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/var/openebs/sparse/0-ndm-sparse.img", "", nil)
+				bd.Spec.Details.DeviceType = blockdevice.SparseBlockDeviceType
+				return bd
+			}(),
+			method: MethodQuick,
+			want: "(fdisk -o Device -l /var/openebs/sparse/0-ndm-sparse.img " +
+				"| grep \"^/var/openebs/sparse/0-ndm-sparse.img\" | xargs -I '{}' wipefs -fa '{}') " +
+				"&& wipefs -fa /var/openebs/sparse/0-ndm-sparse.img " +
+				"&& sectors=$(($(stat -c %s /var/openebs/sparse/0-ndm-sparse.img) / 512)) " +
+				"&& dd if=/dev/zero of=/var/openebs/sparse/0-ndm-sparse.img bs=512 " +
+				"count=$((sectors < 2048 ? sectors : 2048)) conv=notrunc,fsync " +
+				"&& if [ $sectors -gt 2048 ]; then dd if=/dev/zero of=/var/openebs/sparse/0-ndm-sparse.img bs=512 count=2048 " +
+				"seek=$((sectors - 2048)) conv=notrunc,fsync; fi ",
+		},
+		"quick of a sparse file backed by a loop device": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/dev/loop3", "", nil)
+				bd.Spec.Details.DeviceType = blockdevice.SparseBlockDeviceType
+				return bd
+			}(),
+			method: MethodQuick,
+			want: "(fdisk -o Device -l /dev/loop3 | grep \"^/dev/loop3\" | xargs -I '{}' wipefs -fa '{}') " +
+				"&& wipefs -fa /dev/loop3 && sectors=$(($(blockdev --getsize64 /dev/loop3) / 512)) " +
+				"&& dd if=/dev/zero of=/dev/loop3 bs=512 count=$((sectors < 2048 ? sectors : 2048)) conv=notrunc,fsync " +
+				"&& if [ $sectors -gt 2048 ]; then " +
+				"dd if=/dev/zero of=/dev/loop3 bs=512 count=2048 seek=$((sectors - 2048)) conv=notrunc,fsync; fi " +
+				"&& partprobe /dev/loop3 ",
+		},
+		"ata crypto erase": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/dev/sdb", "ATA", nil)
+				bd.Spec.Details.SED = "Opal2"
+				return bd
+			}(),
+			method: MethodCryptoErase,
+			want: "hdparm --yes-i-know-what-i-am-doing --sanitize-crypto-scramble /dev/sdb " +
+				"&& while hdparm --sanitize-status /dev/sdb | grep -qiE \"in (progress|process)\"; do sleep 10; done " +
+				"&& partprobe /dev/sdb ",
+		},
+		"nvme crypto erase": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/dev/nvme0n1", "", nil)
+				bd.Spec.Details.SED = "Opal2"
+				return bd
+			}(),
+			method: MethodCryptoErase,
+			want:   nvmeNamespacesCheck("/dev/nvme0n1", "format", true) + "&& nvme format --ses=2 /dev/nvme0n1 && partprobe /dev/nvme0n1 ",
+		},
+		"scsi crypto erase": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/dev/sdc", "SEAGATE", nil)
+				bd.Spec.Details.SED = "Enterprise"
+				return bd
+			}(),
+			method: MethodCryptoErase,
+			want:   "sg_sanitize --crypto --quick /dev/sdc && partprobe /dev/sdc ",
+		},
+		"crypto erase of a drive which is not self-encrypting": {
+			bd:      newTestBlockDevice("/dev/nvme0n1", "", nil),
+			method:  MethodCryptoErase,
+			wantErr: true,
+		},
+		"erase of a partition": {
+			bd: func() *v1alpha1.BlockDevice {
+				bd := newTestBlockDevice("/dev/sdb1", "ATA", nil)
+				bd.Spec.Details.DeviceType = blockdevice.BlockDeviceTypePartition
+				return bd
+			}(),
+			method:  MethodSanitize,
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := cleanupCommand(test.bd, test.method, VerifyNone)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestQuickCommandOfSparseFile(t *testing.T) {
+	for _, tool := range []string{"sh", "dd", "stat", "wipefs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+	dir, err := ioutil.TempDir("", "ndm-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		size int
+		// zeroed is the no. of bytes zeroed at the start and at the end of the file
+		zeroed int
+	}{
+		"smaller than the header": {size: 512 << 10, zeroed: 512 << 10},
+		"size of the header":      {size: 1 << 20, zeroed: 1 << 20},
+		"larger than the headers": {size: 3 << 20, zeroed: 1 << 20},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "sparse.img")
+			require.NoError(t, ioutil.WriteFile(path, bytes.Repeat([]byte{0xff}, test.size), 0600))
+			bd := newTestBlockDevice(path, "", nil)
+			bd.Spec.Details.DeviceType = blockdevice.SparseBlockDeviceType
+
+			out, err := exec.Command("sh", "-c", quickCommand(bd)).CombinedOutput()
+			require.NoError(t, err, string(out))
+			data, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			// the file is not extended, and only the headers are zeroed
+			assert.Len(t, data, test.size)
+			zeros := make([]byte, test.zeroed)
+			assert.Equal(t, zeros, data[:test.zeroed])
+			assert.Equal(t, zeros, data[test.size-test.zeroed:])
+			if test.size > 2*test.zeroed {
+				middle := data[test.zeroed : test.size-test.zeroed]
+				assert.Equal(t, bytes.Repeat([]byte{0xff}, len(middle)), middle)
+			}
+		})
+	}
+}
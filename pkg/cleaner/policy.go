@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"k8s.io/klog"
+)
+
+const (
+	// PolicyAnnotationPrefix is the prefix of the annotations which set the cleanup
+	// policy of a blockdevice. They can be set on a claim, for the release of the
+	// blockdevice from the claim, or on the blockdevice.
+	PolicyAnnotationPrefix = "ndm.io/cleanup-"
+	// ClaimPolicyAnnotation holds the name and the cleanup policy annotations of the claim
+	// from which the blockdevice was released, as json. It is removed once the cleanup is
+	// completed.
+	ClaimPolicyAnnotation = "ndm.io/claim-cleanup-policy"
+	// SkipAnnotation skips the cleanup of the blockdevice, which is unclaimed as soon
+	// as it is released
+	SkipAnnotation = PolicyAnnotationPrefix + "skip"
+	// AllowClaimAnnotation lists the cleanup policy annotations which leave the data
+	// of the blockdevice to the next claimant, and which the claims are allowed to set
+	// on the blockdevice, without the prefix, eg: skip. It is set only on the blockdevice.
+	AllowClaimAnnotation = "ndm.io/claim-cleanup-allow"
+)
+
+// claimPolicy is the cleanup policy of the claim kept on the released blockdevice
+type claimPolicy struct {
+	// Claim is the name of the claim
+	Claim string `json:"claim"`
+	// Annotations are the cleanup policy annotations of the claim
+	Annotations map[string]string `json:"annotations"`
+}
+
+// SetClaimPolicy copies the cleanup policy annotations of the claim to the blockdevice
+// being released from it, since the claim is removed before the cleanup
+func SetClaimPolicy(bd *v1alpha1.BlockDevice, bdc *v1alpha1.BlockDeviceClaim) {
+	delete(bd.Annotations, ClaimPolicyAnnotation)
+	policy := make(map[string]string)
+	for key, value := range bdc.Annotations {
+		if strings.HasPrefix(key, PolicyAnnotationPrefix) {
+			policy[key] = value
+		}
+	}
+	if len(policy) == 0 {
+		return
+	}
+	data, err := json.Marshal(claimPolicy{Claim: bdc.Name, Annotations: policy})
+	if err != nil {
+		klog.Errorf("unable to copy the cleanup policy of %s to %s: %v", bdc.Name, bd.Name, err)
+		return
+	}
+	if bd.Annotations == nil {
+		bd.Annotations = make(map[string]string)
+	}
+	bd.Annotations[ClaimPolicyAnnotation] = string(data)
+}
+
+// ClearClaimPolicy removes the cleanup policy of the claim from the blockdevice
+func ClearClaimPolicy(bd *v1alpha1.BlockDevice) {
+	delete(bd.Annotations, ClaimPolicyAnnotation)
+}
+
+// getPolicy gets the value of the cleanup policy annotation of the blockdevice. The
+// policy of the claim from which the blockdevice was released takes precedence over
+// the annotation on the blockdevice. An empty value is returned if neither is set.
+func getPolicy(bd *v1alpha1.BlockDevice, key string) string {
+	value, _ := lookupPolicy(bd, key)
+	return value
+}
+
+// lookupPolicy gets the value of the cleanup policy annotation of the blockdevice, and
+// the kind and name of the object whose policy set it, eg: BlockDeviceClaim bdc-1.
+// Empty values are returned if the annotation is not set.
+func lookupPolicy(bd *v1alpha1.BlockDevice, key string) (string, string) {
+	if data, ok := bd.Annotations[ClaimPolicyAnnotation]; ok {
+		policy := claimPolicy{}
+		if err := json.Unmarshal([]byte(data), &policy); err != nil {
+			klog.Warningf("invalid %s on %s: %v", ClaimPolicyAnnotation, bd.Name, err)
+		} else if value, ok := policy.Annotations[key]; ok {
+			return value, "BlockDeviceClaim " + policy.Claim
+		}
+	}
+	if value, ok := bd.Annotations[key]; ok {
+		return value, "BlockDevice " + bd.Name
+	}
+	return "", ""
+}
+
+// isClaimAllowed checks if the claims are allowed to set the cleanup policy annotation
+// on the blockdevice by its AllowClaimAnnotation, or by the default of the operator
+func isClaimAllowed(bd *v1alpha1.BlockDevice, key string) bool {
+	allowed, ok := bd.Annotations[AllowClaimAnnotation]
+	if !ok {
+		allowed = os.Getenv(EnvCleanupAllowClaim)
+	}
+	for _, name := range strings.Split(allowed, ",") {
+		if PolicyAnnotationPrefix+strings.TrimSpace(name) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupAdminPolicy is lookupPolicy for the boolean cleanup policy annotations which
+// leave the data of the blockdevice to the next claimant when they are true. The
+// annotation on the blockdevice takes precedence, and the policy of the claim can set
+// it to true only if the claims are allowed to set it. An invalid value is returned,
+// so that it is reported by the caller.
+func lookupAdminPolicy(bd *v1alpha1.BlockDevice, key string) (string, string) {
+	if value, ok := bd.Annotations[key]; ok {
+		return value, "BlockDevice " + bd.Name
+	}
+	value, source := lookupPolicy(bd, key)
+	if enabled, err := strconv.ParseBool(value); err != nil || !enabled || isClaimAllowed(bd, key) {
+		return value, source
+	}
+	klog.V(2).Infof("%s %q in the policy of %s is ignored, it is not allowed by %s of %s",
+		key, value, source, AllowClaimAnnotation, bd.Name)
+	return "", ""
+}
+
+// GetSkipCleanup gets whether the cleanup of the blockdevice is skipped by the policy
+// of the blockdevice, or of the claim if the blockdevice allows it, and the kind and
+// name of the object whose policy skips it, eg: BlockDeviceClaim bdc-1
+func GetSkipCleanup(bd *v1alpha1.BlockDevice) (bool, string, error) {
+	value, source := lookupAdminPolicy(bd, SkipAnnotation)
+	if len(value) == 0 {
+		return false, "", nil
+	}
+	skip, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid %s %q of %s in the policy of %s, must be true or false",
+			SkipAnnotation, value, bd.Name, source)
+	}
+	return skip, source, nil
+}
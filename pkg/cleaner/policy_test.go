@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"testing"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetSkipCleanup(t *testing.T) {
+	bdc := &v1alpha1.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{Name: "bdc-1",
+		Annotations: map[string]string{SkipAnnotation: "true"}}}
+	tests := map[string]struct {
+		annotations map[string]string
+		want        bool
+		wantSource  string
+		wantErr     bool
+	}{
+		"skip of the claim is not allowed by default": {
+			want: false,
+		},
+		"skip of the claim allowed by the blockdevice": {
+			annotations: map[string]string{AllowClaimAnnotation: "skip"},
+			want:        true,
+			wantSource:  "BlockDeviceClaim bdc-1",
+		},
+		"other policies allowed by the blockdevice": {
+			annotations: map[string]string{AllowClaimAnnotation: "dry-run,method"},
+			want:        false,
+		},
+		"blockdevice refuses the skip": {
+			annotations: map[string]string{SkipAnnotation: "false", AllowClaimAnnotation: "skip"},
+			want:        false,
+			wantSource:  "BlockDevice blockdevice-a",
+		},
+		"invalid skip of the blockdevice": {
+			annotations: map[string]string{SkipAnnotation: "yes"},
+			wantErr:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bd := newTestBlockDevice("/dev/sdb", "", test.annotations)
+			SetClaimPolicy(bd, bdc)
+			skip, source, err := GetSkipCleanup(bd)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, skip)
+			assert.Equal(t, test.wantSource, source)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ProgressPrefix is the prefix of the lines printed by the cleanup jobs to report
+// their progress, followed by the units processed and the total units
+const ProgressPrefix = "ndm-cleanup-progress"
+
+// progressLogLines is the number of lines at the end of the logs of a cleanup
+// job which are searched for the progress
+const progressLogLines = 20
+
+// Progress is the progress reported by a cleanup job
+type Progress struct {
+	// Done is the units processed, eg: bytes
+	Done uint64
+	// Total is the total units to be processed
+	Total uint64
+	// Elapsed is the time since the job started
+	Elapsed time.Duration
+}
+
+// Percent returns the percentage of the cleanup which is complete
+func (p Progress) Percent() int {
+	if p.Total == 0 {
+		return 0
+	}
+	if p.Done >= p.Total {
+		return 100
+	}
+	return int(p.Done * 100 / p.Total)
+}
+
+// Remaining returns the estimated time remaining, based on the rate of progress
+// since the job started. Zero is returned if it cannot be estimated.
+func (p Progress) Remaining() time.Duration {
+	if p.Done == 0 || p.Done >= p.Total || p.Elapsed <= 0 {
+		return 0
+	}
+	remaining := float64(p.Elapsed) * float64(p.Total-p.Done) / float64(p.Done)
+	return time.Duration(remaining).Round(time.Minute)
+}
+
+// String returns the percentage complete and the estimated time remaining
+func (p Progress) String() string {
+	s := fmt.Sprintf("%d%% complete", p.Percent())
+	if p.Done == 0 || p.Done >= p.Total || p.Elapsed <= 0 {
+		return s
+	}
+	remaining := p.Remaining()
+	if remaining < time.Minute {
+		return s + ", less than a minute remaining"
+	}
+	return s + fmt.Sprintf(", about %s remaining", strings.TrimSuffix(remaining.String(), "0s"))
+}
+
+// parseProgress returns the last progress reported in the logs of a cleanup job
+func parseProgress(logs string) (done, total uint64, ok bool) {
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		var d, t uint64
+		if _, err := fmt.Sscanf(scanner.Text(), ProgressPrefix+" %d %d", &d, &t); err == nil && t != 0 {
+			done, total, ok = d, t, true
+		}
+	}
+	return done, total, ok
+}
+
+// LogReader reads the output of the cleanup jobs
+type LogReader interface {
+	// TailLogs returns the last lines of the logs of the latest pod of the job
+	TailLogs(namespace, jobName string, lines int64) (string, error)
+	// TerminationMessage returns the termination message of the last run of the
+	// job container in the latest pod of the job
+	TerminationMessage(namespace, jobName string) (string, error)
+}
+
+// podLogReader reads the logs of the pods of the jobs using the clientset
+type podLogReader struct {
+	clientset kubernetes.Interface
+}
+
+// NewLogReader returns a LogReader which reads the logs of the job pods using the clientset
+func NewLogReader(clientset kubernetes.Interface) LogReader {
+	return &podLogReader{clientset: clientset}
+}
+
+// TailLogs returns the last lines of the logs of the latest pod of the job
+func (r *podLogReader) TailLogs(namespace, jobName string, lines int64) (string, error) {
+	pod, err := r.latestPod(namespace, jobName)
+	if err != nil {
+		return "", err
+	}
+	data, err := r.clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container: JobContainerName,
+		TailLines: &lines,
+	}).Do().Raw()
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// TerminationMessage returns the termination message of the last run of the job
+// container in the latest pod of the job. The container is restarted on failure,
+// so the message of its previous run is returned while it is running.
+func (r *podLogReader) TerminationMessage(namespace, jobName string) (string, error) {
+	pod, err := r.latestPod(namespace, jobName)
+	if err != nil {
+		return "", err
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != JobContainerName {
+			continue
+		}
+		if status.State.Terminated != nil {
+			return status.State.Terminated.Message, nil
+		}
+		if status.LastTerminationState.Terminated != nil {
+			return status.LastTerminationState.Terminated.Message, nil
+		}
+	}
+	return "", nil
+}
+
+// latestPod returns the latest pod created for the job
+func (r *podLogReader) latestPod(namespace, jobName string) (*v1.Pod, error) {
+	pods, err := r.clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: "job-name=" + jobName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("no pods found for job %s", jobName)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].CreationTimestamp.After(pods.Items[j].CreationTimestamp.Time)
+	})
+	return &pods.Items[0], nil
+}
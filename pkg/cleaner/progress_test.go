@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fakeLogReader returns the logs and the termination messages of the jobs from maps
+type fakeLogReader struct {
+	logs     map[string]string
+	messages map[string]string
+}
+
+func (r fakeLogReader) TailLogs(namespace, jobName string, lines int64) (string, error) {
+	return r.logs[jobName], nil
+}
+
+func (r fakeLogReader) TerminationMessage(namespace, jobName string) (string, error) {
+	return r.messages[jobName], nil
+}
+
+func TestProgress(t *testing.T) {
+	tests := map[string]struct {
+		progress      Progress
+		wantPercent   int
+		wantRemaining time.Duration
+		want          string
+	}{
+		"started": {
+			progress: Progress{Done: 0, Total: 100, Elapsed: time.Minute},
+			want:     "0% complete",
+		},
+		"in progress": {
+			progress:      Progress{Done: 1 << 40, Total: 4 << 40, Elapsed: time.Hour},
+			wantPercent:   25,
+			wantRemaining: 3 * time.Hour,
+			want:          "25% complete, about 3h0m remaining",
+		},
+		"almost complete": {
+			progress:      Progress{Done: 99, Total: 100, Elapsed: 10 * time.Minute},
+			wantPercent:   99,
+			wantRemaining: 0,
+			want:          "99% complete, less than a minute remaining",
+		},
+		"complete": {
+			progress:    Progress{Done: 100, Total: 100, Elapsed: time.Hour},
+			wantPercent: 100,
+			want:        "100% complete",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.wantPercent, test.progress.Percent())
+			assert.Equal(t, test.wantRemaining, test.progress.Remaining())
+			assert.Equal(t, test.want, test.progress.String())
+		})
+	}
+}
+
+func TestGetProgress(t *testing.T) {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(batchv1.SchemeGroupVersion, &batchv1.Job{})
+	startTime := metav1.NewTime(time.Now().Add(-time.Hour))
+	c := fake.NewFakeClientWithScheme(s,
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-a", Namespace: "openebs"},
+			Status: batchv1.JobStatus{StartTime: &startTime}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-b", Namespace: "openebs"}})
+	logs := fakeLogReader{logs: map[string]string{
+		"cleanup-blockdevice-a": "BLKDISCARD ioctl failed: Operation not supported\n" +
+			"ndm-cleanup-progress 1073741824 4294967296\n" +
+			"ndm-cleanup-progress 2147483648 4294967296\n",
+		"cleanup-blockdevice-b": "wiping\n",
+	}}
+	jobController := NewJobController(c, "openebs")
+
+	progress, err := jobController.GetProgress("blockdevice-a", logs)
+	require.NoError(t, err)
+	require.NotNil(t, progress)
+	assert.Equal(t, uint64(2147483648), progress.Done)
+	assert.Equal(t, uint64(4294967296), progress.Total)
+	assert.Equal(t, 50, progress.Percent())
+	assert.Equal(t, time.Hour, progress.Remaining())
+
+	// no progress is reported by the job
+	progress, err = jobController.GetProgress("blockdevice-b", logs)
+	require.NoError(t, err)
+	assert.Nil(t, progress)
+
+	_, err = jobController.GetProgress("blockdevice-c", logs)
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PriorityAnnotation sets the priority of the cleanup of the blockdevice in the queue
+// of the cleanups waiting for the limit of cleanup jobs on its node. The cleanups with
+// a higher priority are started first.
+const PriorityAnnotation = PolicyAnnotationPrefix + "priority"
+
+// QueuedError is returned when the cleanup job of a blockdevice is not started, as the
+// limit of cleanup jobs running on its node has been reached
+type QueuedError struct {
+	// NodeName is the node of the blockdevice
+	NodeName string
+	// Running is the number of cleanup jobs running on the node
+	Running int
+	// Position is the position of the blockdevice in the queue of the node, from 1
+	Position int
+}
+
+func (e *QueuedError) Error() string {
+	return fmt.Sprintf("waiting for %d running cleanup jobs on node %s, position %d in the queue",
+		e.Running, e.NodeName, e.Position)
+}
+
+// queueEntry is a blockdevice waiting for its cleanup job to be started
+type queueEntry struct {
+	name     string
+	priority int
+	since    time.Time
+}
+
+// admit checks whether the cleanup job of the blockdevice can be started, if the number
+// of cleanup jobs on a node is limited. The released blockdevices of the node which are
+// waiting for their cleanup are ordered by their priority, and then by the time since
+// which they are queued, and the jobs of the first blockdevices are started as long as
+// the limit is not reached. A QueuedError is returned if the job cannot be started.
+func (c *Cleaner) admit(bd *v1alpha1.BlockDevice) error {
+	limit := getNodeLimit()
+	if limit <= 0 {
+		return nil
+	}
+	nodeName := bd.Labels[controller.KubernetesHostNameLabel]
+	selector := client.MatchingLabels{controller.KubernetesHostNameLabel: nodeName}
+
+	jobList := &batchv1.JobList{}
+	if err := c.Client.List(context.TODO(), jobList, client.InNamespace(c.Namespace), selector); err != nil {
+		return fmt.Errorf("unable to list the cleanup jobs on node %s: %v", nodeName, err)
+	}
+	jobs := make(map[string]bool)
+	running := 0
+	for i := range jobList.Items {
+		job := &jobList.Items[i]
+		bdName, ok := job.Labels[BDLabel]
+		if !ok {
+			continue
+		}
+		jobs[bdName] = true
+		if job.Status.Succeeded <= 0 && getFailedCondition(job) == nil {
+			running++
+		}
+	}
+
+	bdList := &v1alpha1.BlockDeviceList{}
+	if err := c.Client.List(context.TODO(), bdList, client.InNamespace(c.Namespace), selector); err != nil {
+		return fmt.Errorf("unable to list the blockdevices on node %s: %v", nodeName, err)
+	}
+	now := time.Now()
+	queue := []queueEntry{newQueueEntry(bd, now)}
+	for i := range bdList.Items {
+		item := &bdList.Items[i]
+		if item.Name != bd.Name && isWaiting(item, jobs, now) {
+			queue = append(queue, newQueueEntry(item, now))
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].priority != queue[j].priority {
+			return queue[i].priority > queue[j].priority
+		}
+		if !queue[i].since.Equal(queue[j].since) {
+			return queue[i].since.Before(queue[j].since)
+		}
+		return queue[i].name < queue[j].name
+	})
+	position := 0
+	for position < len(queue) && queue[position].name != bd.Name {
+		position++
+	}
+	if running+position < limit {
+		return nil
+	}
+	return &QueuedError{NodeName: nodeName, Running: running, Position: position + 1}
+}
+
+// isWaiting checks if the blockdevice is released and waiting for its cleanup job
+// to be started
+func isWaiting(bd *v1alpha1.BlockDevice, jobs map[string]bool, now time.Time) bool {
+	if bd.Status.ClaimState != v1alpha1.BlockDeviceReleased ||
+		bd.Status.State != v1alpha1.BlockDeviceActive || jobs[bd.Name] {
+		return false
+	}
+	if skip, _, err := GetSkipCleanup(bd); err != nil || skip {
+		return false
+	}
+	if retry := GetRetry(bd); retry != nil && (retry.Exhausted() || retry.RetryAfter.After(now)) {
+		return false
+	}
+	// the blockdevices outside their maintenance windows are not started
+	if checkWindow(bd, now) != nil {
+		return false
+	}
+	return true
+}
+
+// newQueueEntry returns the entry of the blockdevice in the queue of its node. The
+// blockdevices which are not yet queued are queued since now.
+func newQueueEntry(bd *v1alpha1.BlockDevice, now time.Time) queueEntry {
+	entry := queueEntry{name: bd.Name, priority: getPriority(bd), since: now}
+	if cond := bd.Status.GetCondition(v1alpha1.BlockDeviceCleanupQueued); cond != nil {
+		entry.since = cond.LastTransitionTime.Time
+	}
+	return entry
+}
+
+// getPriority gets the priority of the cleanup of the blockdevice from the policy of
+// the claim or the blockdevice, 0 by default
+func getPriority(bd *v1alpha1.BlockDevice) int {
+	value := getPolicy(bd, PriorityAnnotation)
+	if len(value) == 0 {
+		return 0
+	}
+	priority, err := strconv.Atoi(value)
+	if err != nil {
+		klog.Warningf("invalid cleanup priority %q of %s, using 0", value, bd.Name)
+		return 0
+	}
+	return priority
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newQueueTestBlockDevice returns a released blockdevice on the node
+func newQueueTestBlockDevice(name, nodeName string, annotations map[string]string) *v1alpha1.BlockDevice {
+	bd := newTestBlockDevice("/dev/sdb", "", annotations)
+	bd.Name = name
+	bd.Namespace = "openebs"
+	bd.Labels = map[string]string{"kubernetes.io/hostname": nodeName}
+	bd.Status.State = v1alpha1.BlockDeviceActive
+	bd.Status.ClaimState = v1alpha1.BlockDeviceReleased
+	return bd
+}
+
+func TestAdmit(t *testing.T) {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(batchv1.SchemeGroupVersion, &batchv1.Job{}, &batchv1.JobList{})
+	s.AddKnownTypes(v1alpha1.SchemeGroupVersion, &v1alpha1.BlockDevice{}, &v1alpha1.BlockDeviceList{})
+
+	running, err := NewCleanupJob(newQueueTestBlockDevice("blockdevice-a", "node1", nil), VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	failed, err := NewCleanupJob(newQueueTestBlockDevice("blockdevice-f", "node1", nil), VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	failed.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue}}
+	// blockdevice-b is queued, and blockdevice-c is released with a higher priority
+	queued := newQueueTestBlockDevice("blockdevice-b", "node1", nil)
+	queued.Status.SetCondition(v1alpha1.BlockDeviceCondition{Type: v1alpha1.BlockDeviceCleanupQueued,
+		Status: v1.ConditionTrue, LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour))})
+	priority := newQueueTestBlockDevice("blockdevice-c", "node1", map[string]string{PriorityAnnotation: "10"})
+	newer := newQueueTestBlockDevice("blockdevice-d", "node1", nil)
+	skipped := newQueueTestBlockDevice("blockdevice-e", "node1", map[string]string{SkipAnnotation: "true"})
+	other := newQueueTestBlockDevice("blockdevice-g", "node2", nil)
+	c := fake.NewFakeClientWithScheme(s, running, failed, queued, priority, newer, skipped, other)
+	bdCleaner := NewCleaner(c, "openebs", nil)
+
+	// the jobs are not limited by default
+	assert.NoError(t, bdCleaner.admit(newer))
+
+	os.Setenv(EnvCleanUpJobNodeLimit, "2")
+	defer os.Unsetenv(EnvCleanUpJobNodeLimit)
+	tests := map[string]struct {
+		bd           *v1alpha1.BlockDevice
+		wantPosition int
+	}{
+		"higher priority is started first": {bd: priority},
+		"queued before the others":         {bd: queued, wantPosition: 2},
+		"queued after the others":          {bd: newer, wantPosition: 3},
+		"on another node":                  {bd: other},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := bdCleaner.admit(test.bd)
+			if test.wantPosition == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.IsType(t, &QueuedError{}, err)
+			queuedErr := err.(*QueuedError)
+			assert.Equal(t, "node1", queuedErr.NodeName)
+			assert.Equal(t, 1, queuedErr.Running)
+			assert.Equal(t, test.wantPosition, queuedErr.Position)
+		})
+	}
+	assert.EqualError(t, bdCleaner.admit(newer), "waiting for 1 running cleanup jobs on node node1, position 3 in the queue")
+}
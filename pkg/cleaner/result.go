@@ -0,0 +1,216 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// ResultAnnotation is the annotation of the blockdevice which has the result of
+	// its last cleanup, as json
+	ResultAnnotation = "ndm.io/cleanup-result"
+	// LogsAnnotation is the annotation of the blockdevice which has the last lines of
+	// the logs of its last cleanup job
+	LogsAnnotation = "ndm.io/cleanup-logs"
+)
+
+const (
+	// resultLogLines is the number of lines of the logs of the cleanup job which are
+	// kept on the blockdevice, excluding the progress
+	resultLogLines = 20
+	// resultLogBytes is the maximum size of the logs kept on the blockdevice
+	resultLogBytes = 2048
+	// resultStatusSucceeded and resultStatusFailed are the status of the result
+	resultStatusSucceeded = "Succeeded"
+	resultStatusFailed    = "Failed"
+)
+
+// Result is the result of a cleanup job, which is kept on the blockdevice after the
+// job is deleted
+type Result struct {
+	// Status is Succeeded, Failed or DryRun
+	Status string `json:"status"`
+	// Method is the cleanup method of the device
+	Method Method `json:"method"`
+	// Filesystem is the cleanup strategy of the filesystem, if the blockdevice has one
+	Filesystem FilesystemStrategy `json:"filesystem,omitempty"`
+	// Bytes is the number of bytes of the device erased or zeroed, if known
+	Bytes uint64 `json:"bytes,omitempty"`
+	// StartTime and CompletionTime are the times at which the job started and
+	// completed or failed
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Duration is the time taken by the job, or the estimated time of a dry run
+	Duration string `json:"duration,omitempty"`
+	// Reason is the reason for which the job failed
+	Reason string `json:"reason,omitempty"`
+
+	// Logs are the last lines of the logs of the job
+	Logs string `json:"-"`
+}
+
+// String returns the status and the summary of the result, eg: Succeeded using
+// discard, 1.8TiB in 2h4m
+func (r *Result) String() string {
+	return r.Status + " " + r.Summary()
+}
+
+// Summary returns the method, the bytes cleaned, the duration and the reason for the
+// failure of the result, eg: using discard, 1.8TiB in 2h4m
+func (r *Result) Summary() string {
+	s := fmt.Sprintf("using %s", r.Method)
+	if r.Filesystem == FilesystemDelete || r.Filesystem == FilesystemMkfs {
+		s = fmt.Sprintf("using %s of the filesystem", r.Filesystem)
+	}
+	switch {
+	case r.Bytes != 0 && len(r.Duration) != 0:
+		s += fmt.Sprintf(", %s in %s", formatBytes(r.Bytes), r.Duration)
+	case r.Bytes != 0:
+		s += ", " + formatBytes(r.Bytes)
+	case len(r.Duration) != 0:
+		s += " in " + r.Duration
+	}
+	if len(r.Reason) != 0 {
+		s += ": " + r.Reason
+	}
+	return s
+}
+
+// GetResult gets the result of the last cleanup of the blockdevice, or nil if it has
+// not been recorded
+func GetResult(bd *v1alpha1.BlockDevice) *Result {
+	data, ok := bd.Annotations[ResultAnnotation]
+	if !ok {
+		return nil
+	}
+	result := &Result{}
+	if err := json.Unmarshal([]byte(data), result); err != nil {
+		klog.Warningf("invalid %s of %s: %v", ResultAnnotation, bd.Name, err)
+		return nil
+	}
+	result.Logs = bd.Annotations[LogsAnnotation]
+	return result
+}
+
+// SetResult records the result of the cleanup job and its logs on the blockdevice,
+// replacing the result of the previous cleanup
+func SetResult(bd *v1alpha1.BlockDevice, result *Result) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		klog.Errorf("unable to record the cleanup result of %s: %v", bd.Name, err)
+		return
+	}
+	if bd.Annotations == nil {
+		bd.Annotations = make(map[string]string)
+	}
+	bd.Annotations[ResultAnnotation] = string(data)
+	if len(result.Logs) != 0 {
+		bd.Annotations[LogsAnnotation] = result.Logs
+	} else {
+		delete(bd.Annotations, LogsAnnotation)
+	}
+}
+
+// newResult returns the result of the cleanup of the blockdevice, which ran from the
+// start to the end
+func newResult(bd *v1alpha1.BlockDevice, status string, start, end *metav1.Time) *Result {
+	if end != nil && end.IsZero() {
+		end = nil
+	}
+	result := &Result{Status: status, StartTime: start, CompletionTime: end}
+	// the policy cannot be invalid, as the job was created from it
+	result.Method, _ = GetMethod(bd)
+	if hasFilesystem(bd) {
+		result.Filesystem, _ = GetFilesystemStrategy(bd)
+	}
+	if start != nil && end != nil {
+		result.Duration = end.Sub(start.Time).Round(time.Second).String()
+	}
+	if status == resultStatusSucceeded {
+		result.Bytes = cleanedBytes(bd, result.Method, result.Filesystem)
+	}
+	return result
+}
+
+// cleanedBytes returns the number of bytes of the device erased or zeroed by the
+// cleanup method. The size of the data removed from a filesystem, or the signatures
+// erased by wipefs, are not known.
+func cleanedBytes(bd *v1alpha1.BlockDevice, method Method, strategy FilesystemStrategy) uint64 {
+	if strategy == FilesystemDelete || strategy == FilesystemMkfs {
+		return 0
+	}
+	capacity := bd.Spec.Capacity.Storage
+	switch method {
+	case MethodSecureErase, MethodSanitize, MethodDiscard, MethodCryptoErase:
+		return capacity
+	case MethodQuick:
+		if size := uint64(2 * headerSectors * 512); size < capacity {
+			return size
+		}
+		return capacity
+	}
+	return 0
+}
+
+// tailResultLogs returns the last lines of the logs, without the progress, limited to
+// the size which is kept on the blockdevice
+func tailResultLogs(logs string) string {
+	lines := make([]string, 0, resultLogLines)
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ProgressPrefix) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > resultLogLines {
+		lines = lines[len(lines)-resultLogLines:]
+	}
+	tail := strings.TrimSpace(strings.Join(lines, "\n"))
+	if len(tail) > resultLogBytes {
+		tail = tail[len(tail)-resultLogBytes:]
+		// the partial first line is dropped
+		if i := strings.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+	}
+	return tail
+}
+
+// formatBytes returns the size in binary units, eg: 1.8TiB
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
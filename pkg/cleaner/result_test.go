@@ -0,0 +1,139 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetJobResult(t *testing.T) {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(batchv1.SchemeGroupVersion, &batchv1.Job{})
+	start := metav1.NewTime(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(start.Add(2*time.Hour + 4*time.Minute))
+	c := fake.NewFakeClientWithScheme(s,
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-a", Namespace: "openebs"},
+			Status: batchv1.JobStatus{Succeeded: 1, StartTime: &start, CompletionTime: &end}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-b", Namespace: "openebs"},
+			Status: batchv1.JobStatus{StartTime: &start, Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed,
+				Status: v1.ConditionTrue, Reason: "BackoffLimitExceeded", LastTransitionTime: end}}}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-c", Namespace: "openebs"},
+			Status: batchv1.JobStatus{StartTime: &start}})
+	var lines []string
+	for i := 1; i <= 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i), fmt.Sprintf("%s %d 100", ProgressPrefix, i))
+	}
+	logs := fakeLogReader{
+		logs: map[string]string{
+			"cleanup-blockdevice-a": strings.Join(lines, "\n") + "\n",
+			"cleanup-blockdevice-b": "ndm-cleanup-progress 25 100\nblkdiscard: Input/output error\n",
+		},
+		messages: map[string]string{"cleanup-blockdevice-b": "blkdiscard: Input/output error\n"},
+	}
+	jobController := NewJobController(c, "openebs")
+	newBD := func(name string) *v1alpha1.BlockDevice {
+		bd := newTestBlockDevice("/dev/sdb", "", map[string]string{MethodAnnotation: "discard"})
+		bd.Name = name
+		bd.Spec.Capacity.Storage = 1 << 40
+		return bd
+	}
+
+	result, err := jobController.GetJobResult(newBD("blockdevice-a"), logs)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, "Succeeded using discard, 1.0TiB in 2h4m0s", result.String())
+	assert.Equal(t, start.Unix(), result.StartTime.Unix())
+	assert.Equal(t, end.Unix(), result.CompletionTime.Unix())
+	// the last lines of the logs are kept, without the progress
+	logLines := strings.Split(result.Logs, "\n")
+	require.Len(t, logLines, resultLogLines)
+	assert.Equal(t, "line 11", logLines[0])
+	assert.Equal(t, "line 30", logLines[resultLogLines-1])
+
+	// the bytes cleaned by the failed job are estimated from its progress
+	result, err = jobController.GetJobResult(newBD("blockdevice-b"), logs)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, "Failed using discard, 256.0GiB in 2h4m0s: blkdiscard: Input/output error", result.String())
+	assert.Equal(t, "blkdiscard: Input/output error", result.Logs)
+
+	// the result of the failed job does not need its logs
+	result, err = jobController.GetJobResult(newBD("blockdevice-b"), nil)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Empty(t, result.Logs)
+	assert.Zero(t, result.Bytes)
+
+	for _, name := range []string{"blockdevice-c", "blockdevice-d"} {
+		result, err = jobController.GetJobResult(newBD(name), logs)
+		require.NoError(t, err)
+		assert.Nil(t, result, name)
+	}
+}
+
+func TestSetResult(t *testing.T) {
+	bd := newTestBlockDevice("/dev/sdb1", "", nil)
+	bd.Spec.FileSystem.Type = "ext4"
+	bd.Annotations = map[string]string{FilesystemAnnotation: "delete"}
+	assert.Nil(t, GetResult(bd))
+
+	result := newResult(bd, resultStatusSucceeded, nil, nil)
+	result.Logs = "removed 2 files"
+	SetResult(bd, result)
+	assert.Equal(t, `{"status":"Succeeded","method":"wipefs","filesystem":"delete"}`, bd.Annotations[ResultAnnotation])
+	assert.Equal(t, "removed 2 files", bd.Annotations[LogsAnnotation])
+	assert.Equal(t, result, GetResult(bd))
+	assert.Equal(t, "Succeeded using delete of the filesystem", result.String())
+
+	// the logs of the previous cleanup are removed
+	SetResult(bd, &Result{Status: resultStatusFailed, Method: MethodQuick, Reason: "timed out after 1h0m0s"})
+	assert.NotContains(t, bd.Annotations, LogsAnnotation)
+	assert.Equal(t, "Failed using quick: timed out after 1h0m0s", GetResult(bd).String())
+
+	bd.Annotations[ResultAnnotation] = "{"
+	assert.Nil(t, GetResult(bd))
+}
+
+func TestTailResultLogs(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	logs := fmt.Sprintf("first\n%[1]s\n%[1]s\n%[1]s\nlast\n", long)
+	tail := tailResultLogs(logs)
+	assert.True(t, len(tail) <= resultLogBytes)
+	assert.Equal(t, long+"\n"+long+"\nlast", tail)
+
+	assert.Equal(t, "wiping", tailResultLogs("ndm-cleanup-progress 1 2\nwiping\n\n"))
+	assert.Empty(t, tailResultLogs(""))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", formatBytes(512))
+	assert.Equal(t, "2.0MiB", formatBytes(2<<20))
+	assert.Equal(t, "465.8GiB", formatBytes(500107862016))
+	assert.Equal(t, "1.8TiB", formatBytes(2000398934016))
+}
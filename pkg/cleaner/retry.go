@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	// RetryAnnotation holds the number of failed attempts of the cleanup of the released
+	// blockdevice, and the time after which it is retried, as json. It is removed when
+	// the blockdevice is unclaimed, and can be removed to retry a cleanup which failed.
+	RetryAnnotation = "ndm.io/claim-cleanup-retry"
+	// TimeoutAnnotation sets the timeout of each attempt of the cleanup of the
+	// blockdevice, as a duration. eg: 48h
+	TimeoutAnnotation = PolicyAnnotationPrefix + "timeout"
+)
+
+// maxBackoff is the maximum time between the attempts of a cleanup
+const maxBackoff = time.Hour
+
+// Retry is the state of the retries of the cleanup of a released blockdevice
+type Retry struct {
+	// Failures is the number of attempts of the cleanup which failed
+	Failures int `json:"failures"`
+	// RetryAfter is the time after which the cleanup is attempted again
+	RetryAfter metav1.Time `json:"retryAfter"`
+}
+
+// Exhausted returns whether all the retries of the cleanup have failed
+func (r Retry) Exhausted() bool {
+	return r.Failures > getRetries()
+}
+
+// GetRetry gets the state of the retries of the cleanup of the blockdevice, or nil
+// if no attempt of the cleanup has failed
+func GetRetry(bd *v1alpha1.BlockDevice) *Retry {
+	data, ok := bd.Annotations[RetryAnnotation]
+	if !ok {
+		return nil
+	}
+	retry := &Retry{}
+	if err := json.Unmarshal([]byte(data), retry); err != nil {
+		klog.Warningf("invalid %s on %s: %v", RetryAnnotation, bd.Name, err)
+		return nil
+	}
+	return retry
+}
+
+// RecordFailure records a failed attempt of the cleanup of the blockdevice, and the
+// time after which it is retried, which is doubled after each failure
+func RecordFailure(bd *v1alpha1.BlockDevice, now time.Time) *Retry {
+	retry := GetRetry(bd)
+	if retry == nil {
+		retry = &Retry{}
+	}
+	retry.Failures++
+	retry.RetryAfter = metav1.NewTime(now.Add(backoff(retry.Failures)))
+	data, err := json.Marshal(retry)
+	if err != nil {
+		klog.Errorf("unable to record the failed cleanup of %s: %v", bd.Name, err)
+		return retry
+	}
+	if bd.Annotations == nil {
+		bd.Annotations = make(map[string]string)
+	}
+	bd.Annotations[RetryAnnotation] = string(data)
+	return retry
+}
+
+// ClearRetry removes the state of the retries of the cleanup from the blockdevice
+func ClearRetry(bd *v1alpha1.BlockDevice) {
+	delete(bd.Annotations, RetryAnnotation)
+}
+
+// backoff returns the time to wait before the next attempt, after the given number
+// of failures
+func backoff(failures int) time.Duration {
+	wait := getBackoff()
+	for i := 1; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+// GetTimeout gets the timeout of each attempt of the cleanup of the blockdevice, from
+// the policy of the claim or the blockdevice, or the default timeout. Zero is returned
+// if the cleanup does not time out.
+func GetTimeout(bd *v1alpha1.BlockDevice) (time.Duration, error) {
+	value := getPolicy(bd, TimeoutAnnotation)
+	if len(value) == 0 {
+		return getDefaultTimeout(), nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid cleanup timeout %q of %s, must be a duration like 48h", value, bd.Name)
+	}
+	return timeout, nil
+}
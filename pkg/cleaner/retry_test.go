@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRecordFailure(t *testing.T) {
+	os.Setenv(EnvCleanUpJobBackoff, "10m")
+	defer os.Unsetenv(EnvCleanUpJobBackoff)
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	bd := newTestBlockDevice("/dev/sdb", "", nil)
+	assert.Nil(t, GetRetry(bd))
+
+	// the backoff is doubled after each failure, up to an hour
+	for i, wait := range []time.Duration{10 * time.Minute, 20 * time.Minute, 40 * time.Minute, time.Hour} {
+		retry := RecordFailure(bd, now)
+		assert.Equal(t, i+1, retry.Failures)
+		assert.Equal(t, now.Add(wait), retry.RetryAfter.Time)
+		assert.Equal(t, i+1 > defaultRetries, retry.Exhausted())
+	}
+	retry := GetRetry(bd)
+	require.NotNil(t, retry)
+	assert.Equal(t, 4, retry.Failures)
+	assert.True(t, retry.Exhausted())
+
+	// the number of retries is configured
+	os.Setenv(EnvCleanUpJobRetries, "5")
+	defer os.Unsetenv(EnvCleanUpJobRetries)
+	assert.False(t, retry.Exhausted())
+
+	ClearRetry(bd)
+	assert.Nil(t, GetRetry(bd))
+}
+
+func TestGetTimeout(t *testing.T) {
+	bd := newTestBlockDevice("/dev/sdb", "", nil)
+	timeout, err := GetTimeout(bd)
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, timeout)
+
+	os.Setenv(EnvCleanUpJobTimeout, "0")
+	defer os.Unsetenv(EnvCleanUpJobTimeout)
+	timeout, err = GetTimeout(bd)
+	require.NoError(t, err)
+	assert.Zero(t, timeout)
+
+	bd.Annotations = map[string]string{TimeoutAnnotation: "72h"}
+	job, err := NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	require.NotNil(t, job.Spec.ActiveDeadlineSeconds)
+	assert.Equal(t, int64(72*3600), *job.Spec.ActiveDeadlineSeconds)
+
+	bd.Annotations[TimeoutAnnotation] = "3 days"
+	_, err = GetTimeout(bd)
+	assert.Error(t, err)
+}
+
+func TestGetFailure(t *testing.T) {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(batchv1.SchemeGroupVersion, &batchv1.Job{})
+	deadline := int64(7200)
+	deleted := metav1.Now()
+	failed := []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: v1.ConditionTrue,
+		Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"}}
+	c := fake.NewFakeClientWithScheme(s,
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-a", Namespace: "openebs"},
+			Status: batchv1.JobStatus{Conditions: failed}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-b", Namespace: "openebs"},
+			Spec: batchv1.JobSpec{ActiveDeadlineSeconds: &deadline},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed,
+				Status: v1.ConditionTrue, Reason: "DeadlineExceeded"}}}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-c", Namespace: "openebs"}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-d", Namespace: "openebs",
+			DeletionTimestamp: &deleted}, Status: batchv1.JobStatus{Conditions: failed}})
+	logs := fakeLogReader{messages: map[string]string{
+		"cleanup-blockdevice-a": "Security erase unit\nSG_IO: bad/missing sense data\n",
+	}}
+	jobController := NewJobController(c, "openebs")
+
+	tests := map[string]struct {
+		bdName string
+		logs   LogReader
+		want   string
+	}{
+		"failed with the logs":      {bdName: "blockdevice-a", logs: logs, want: "SG_IO: bad/missing sense data"},
+		"failed without the logs":   {bdName: "blockdevice-a", want: "Job has reached the specified backoff limit"},
+		"timed out":                 {bdName: "blockdevice-b", logs: logs, want: "timed out after 2h0m0s"},
+		"running":                   {bdName: "blockdevice-c", logs: logs},
+		"deleted after the failure": {bdName: "blockdevice-d", logs: logs},
+		"not found":                 {bdName: "blockdevice-e", logs: logs},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := jobController.GetFailure(test.bdName, test.logs)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+	assert.False(t, jobController.IsCleaningJobRunning("blockdevice-a"))
+	assert.True(t, jobController.IsCleaningJobRunning("blockdevice-c"))
+	state, err := jobController.RemoveJob("blockdevice-a")
+	require.NoError(t, err)
+	assert.Equal(t, CleanupStateFailed, state)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// VerifyMode is the verification run by the cleanup job after the blockdevice
+// is cleaned. The blockdevice is unclaimed only if the verification passes.
+type VerifyMode string
+
+const (
+	// VerifyNone does not verify the cleanup
+	VerifyNone VerifyMode = "none"
+	// VerifySignatures checks that no filesystem, partition table, LVM or RAID
+	// signatures are left on the device
+	VerifySignatures VerifyMode = "signatures"
+	// VerifySample checks the signatures, and that random regions of the device
+	// read as zeros
+	VerifySample VerifyMode = "sample"
+)
+
+// VerifyAnnotation sets the verification of the cleanup of the blockdevice
+const VerifyAnnotation = PolicyAnnotationPrefix + "verify"
+
+// verifyModes are the supported verification modes
+var verifyModes = []VerifyMode{VerifyNone, VerifySignatures, VerifySample}
+
+const (
+	// verifySamples is the number of random regions of 1MiB of the device which are read
+	verifySamples = 16
+	// verifyFailed is the prefix of the termination message of a cleanup job whose
+	// verification failed
+	verifyFailed = "verification failed: "
+)
+
+// GetVerifyMode gets the verification of the cleanup of the blockdevice, from the
+// policy of the claim or the blockdevice, or the default verification
+func GetVerifyMode(bd *v1alpha1.BlockDevice) (VerifyMode, error) {
+	value := getPolicy(bd, VerifyAnnotation)
+	if len(value) == 0 {
+		return getDefaultVerifyMode(), nil
+	}
+	mode := VerifyMode(value)
+	if !isValidVerifyMode(mode) {
+		values := make([]string, 0, len(verifyModes))
+		for _, m := range verifyModes {
+			values = append(values, string(m))
+		}
+		return "", fmt.Errorf("invalid cleanup verification %q of %s, must be one of %s",
+			value, bd.Name, strings.Join(values, ", "))
+	}
+	return mode, nil
+}
+
+// isValidVerifyMode checks if the mode is a supported verification mode
+func isValidVerifyMode(mode VerifyMode) bool {
+	for _, m := range verifyModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifiedMessage returns the message describing the checks of a verification of
+// the cleanup of the blockdevice which passed
+func VerifiedMessage(bd *v1alpha1.BlockDevice, mode VerifyMode) string {
+	strategy, _ := GetFilesystemStrategy(bd)
+	switch {
+	case getVolumeMode(bd.Spec) == VolumeModeFileSystem || strategy == FilesystemDelete:
+		return "The filesystem is empty"
+	case strategy == FilesystemMkfs:
+		return fmt.Sprintf("The %s filesystem is created", bd.Spec.FileSystem.Type)
+	case mode == VerifySample:
+		return fmt.Sprintf("No signatures found, %d sampled regions are zeroed", verifySamples)
+	}
+	return "No signatures found"
+}
+
+// verifyCommand returns the command which verifies the cleanup of the blockdevice
+// in the block volume mode. The signatures are listed using wipefs, and the sampled
+// regions are read with direct IO, so that the data on the device is read instead of
+// the page cache, and compared with zeros. A region which cannot be read fails the
+// comparison. On failure, the reason is written to the termination message of
+// the job container and the command fails, so that the cleanup is run again.
+func verifyCommand(bd *v1alpha1.BlockDevice, method Method, mode VerifyMode) (string, error) {
+	if mode == VerifyNone {
+		return "", nil
+	}
+	args := fmt.Sprintf("&& (types=$(wipefs --no-act --noheadings --output TYPE %[1]s) || %[2]s; "+
+		"[ -z \"$types\" ] || %[3]s) ",
+		bd.Spec.Path,
+		failCommand("unable to read the signatures"),
+		failCommand("found signatures $(echo $types)"))
+	if mode != VerifySample {
+		return args, nil
+	}
+	// wipefs erases only the signatures, and leaves the data on the device. The
+	// data which is crypto erased is not zeroed, it cannot be decrypted. The drives
+	// may return a vendor pattern after a secure erase or a sanitize, eg: per the
+	// DLFEAT of NVMe. The discard zeroes the device when the sample is verified.
+	if method != MethodDiscard {
+		return "", fmt.Errorf("cleanup verification %s is not supported with the cleanup method %s on %s",
+			mode, method, bd.Name)
+	}
+	args += fmt.Sprintf("&& (blocks=$(($(blockdev --getsize64 %[1]s) / 1048576)) && i=0 "+
+		"&& while [ $i -lt %[2]d ]; do "+
+		"block=$(($(od -An -N4 -tu4 /dev/urandom) %% blocks)); "+
+		"dd if=%[1]s bs=1M skip=$block count=1 iflag=direct 2>/dev/null | cmp -s -n 1048576 - /dev/zero "+
+		"|| %[3]s; i=$((i + 1)); done) ",
+		bd.Spec.Path, verifySamples, failCommand("the region at ${block}MiB is not zeroed"))
+	return args, nil
+}
+
+// verifyMountCommand returns the command which verifies that the contents of the
+// filesystem mounted at the path are removed
+func verifyMountCommand(path string, mode VerifyMode) string {
+	if mode == VerifyNone {
+		return ""
+	}
+	return fmt.Sprintf("&& ([ -z \"$(ls -A %s)\" ] || %s) ",
+		path, failCommand("the filesystem is not empty"))
+}
+
+// failCommand returns the command which fails the verification with the reason
+func failCommand(reason string) string {
+	return fmt.Sprintf("{ echo \"%s%s\" | tee %s; exit 1; }",
+		verifyFailed, reason, v1.TerminationMessagePathDefault)
+}
+
+// parseVerifyFailure returns the reason of the failure of the verification from
+// the termination message of the cleanup job container
+func parseVerifyFailure(message string) (string, bool) {
+	message = strings.TrimSpace(message)
+	if !strings.HasPrefix(message, verifyFailed) {
+		return "", false
+	}
+	return strings.TrimPrefix(message, verifyFailed), true
+}
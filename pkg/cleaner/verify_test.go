@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetVerifyMode(t *testing.T) {
+	bdc := &v1alpha1.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{Name: "bdc-1",
+		Annotations: map[string]string{VerifyAnnotation: "sample"}}}
+	tests := map[string]struct {
+		annotations map[string]string
+		claim       *v1alpha1.BlockDeviceClaim
+		defaultMode string
+		want        VerifyMode
+		wantErr     bool
+	}{
+		"default verification": {
+			want: VerifyNone,
+		},
+		"default verification from env": {
+			defaultMode: "signatures",
+			want:        VerifySignatures,
+		},
+		"invalid default verification from env": {
+			defaultMode: "full",
+			want:        VerifyNone,
+		},
+		"verification of the claim takes precedence": {
+			annotations: map[string]string{VerifyAnnotation: "signatures"},
+			claim:       bdc,
+			want:        VerifySample,
+		},
+		"invalid verification": {
+			annotations: map[string]string{VerifyAnnotation: "full"},
+			wantErr:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			os.Setenv(EnvCleanupVerify, test.defaultMode)
+			defer os.Unsetenv(EnvCleanupVerify)
+			bd := newTestBlockDevice("/dev/sdb", "", test.annotations)
+			if test.claim != nil {
+				SetClaimPolicy(bd, test.claim)
+			}
+			got, err := GetVerifyMode(bd)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestNewCleanupJobVerify(t *testing.T) {
+	bd := newTestBlockDevice("/dev/sdb", "", map[string]string{VerifyAnnotation: "signatures"})
+
+	job, err := NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	args := job.Spec.Template.Spec.Containers[0].Args[0]
+	assert.Contains(t, args, "wipefs -fa /dev/sdb && partprobe /dev/sdb && (types=$(wipefs --no-act --noheadings --output TYPE /dev/sdb)")
+	assert.Contains(t, args, `echo "verification failed: found signatures $(echo $types)" | tee /dev/termination-log; exit 1;`)
+	assert.NotContains(t, args, "/dev/urandom")
+
+	// wipefs leaves the data on the device
+	bd.Annotations[VerifyAnnotation] = "sample"
+	_, err = NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	assert.Error(t, err)
+
+	// the drive may return a vendor pattern after the erase
+	bd.Annotations[MethodAnnotation] = "secure-erase"
+	_, err = NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	assert.Error(t, err)
+
+	// the discarded blocks may not read as zeros, so the device is zeroed
+	bd.Annotations[MethodAnnotation] = "discard"
+	job, err = NewCleanupJob(bd, VolumeModeBlock, nil, "openebs")
+	require.NoError(t, err)
+	args = job.Spec.Template.Spec.Containers[0].Args[0]
+	assert.Contains(t, args, "blkdiscard --zeroout --offset $offset --length $length /dev/sdb")
+	assert.NotContains(t, args, "(blkdiscard /dev/sdb ||")
+	assert.Contains(t, args, "dd if=/dev/sdb bs=1M skip=$block count=1 iflag=direct 2>/dev/null | cmp -s -n 1048576 - /dev/zero")
+	assert.Equal(t, "No signatures found, 16 sampled regions are zeroed", VerifiedMessage(bd, VerifySample))
+
+	bd.Annotations = map[string]string{VerifyAnnotation: "signatures"}
+	bd.Spec.FileSystem.Mountpoint = "/mnt/disk"
+	job, err = NewCleanupJob(bd, VolumeModeFileSystem, nil, "openebs")
+	require.NoError(t, err)
+	assert.Contains(t, job.Spec.Template.Spec.Containers[0].Args[0], `&& ([ -z "$(ls -A /tmp)" ] ||`)
+	assert.Equal(t, "The filesystem is empty", VerifiedMessage(bd, VerifySignatures))
+}
+
+func TestGetVerifyFailure(t *testing.T) {
+	logs := fakeLogReader{messages: map[string]string{
+		"cleanup-blockdevice-a": "verification failed: found signatures ext4\n",
+		"cleanup-blockdevice-b": "",
+	}}
+	jobController := NewJobController(nil, "openebs")
+
+	reason, err := jobController.GetVerifyFailure("blockdevice-a", logs)
+	require.NoError(t, err)
+	assert.Equal(t, "found signatures ext4", reason)
+
+	reason, err = jobController.GetVerifyFailure("blockdevice-b", logs)
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"k8s.io/klog"
+)
+
+// WindowAnnotation sets the maintenance windows during which the cleanup job of the
+// blockdevice may be started
+const WindowAnnotation = PolicyAnnotationPrefix + "windows"
+
+// defaultWindowSource is the source of the windows set by the operator
+const defaultWindowSource = "the operator"
+
+// OutsideWindowError is returned when the cleanup job of a blockdevice is not started,
+// as none of its maintenance windows is open
+type OutsideWindowError struct {
+	// Source is the source of the windows, eg: BlockDeviceClaim bdc-1
+	Source string
+	// Opens is the time at which the next window opens, zero if no window opens
+	Opens time.Time
+}
+
+func (e *OutsideWindowError) Error() string {
+	if e.Opens.IsZero() {
+		return fmt.Sprintf("outside the cleanup windows of %s, none of which opens", e.Source)
+	}
+	return fmt.Sprintf("outside the cleanup windows of %s, the next window opens at %s",
+		e.Source, e.Opens.Format(time.RFC3339))
+}
+
+// window is a maintenance window, which opens at the times matched by its schedule
+// and stays open for its duration
+type window struct {
+	schedule *schedule
+	duration time.Duration
+}
+
+// schedule is a cron schedule, whose fields are sets of minutes, hours, days of the
+// month, months and days of the week, as bits
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are set if the day of the month or of the week is *, in
+	// which case the day matches only the other field
+	domStar, dowStar bool
+}
+
+// cronFields are the ranges of the fields of a cron schedule
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of the month", 1, 31},
+	{"month", 1, 12},
+	{"day of the week", 0, 7},
+}
+
+// checkWindow checks whether the cleanup job of the blockdevice may be started at the
+// time, as it has no maintenance windows or one of them is open. An OutsideWindowError
+// is returned if the job cannot be started.
+func checkWindow(bd *v1alpha1.BlockDevice, now time.Time) error {
+	windows, source, err := getWindows(bd)
+	if err != nil {
+		return err
+	}
+	if len(windows) == 0 {
+		return nil
+	}
+	var opens time.Time
+	for _, w := range windows {
+		// the window is open if it opened within its duration
+		if start := w.schedule.next(now.Add(-w.duration)); !start.IsZero() && !start.After(now) {
+			return nil
+		}
+		if next := w.schedule.next(now); !next.IsZero() && (opens.IsZero() || next.Before(opens)) {
+			opens = next
+		}
+	}
+	return &OutsideWindowError{Source: source, Opens: opens}
+}
+
+// getWindows gets the maintenance windows of the blockdevice from the policy of the
+// claim or the blockdevice, or the windows of the operator, and the source which set
+// them. The cleanup is not limited to windows if none are set.
+func getWindows(bd *v1alpha1.BlockDevice) ([]window, string, error) {
+	value, source := lookupPolicy(bd, WindowAnnotation)
+	if len(value) == 0 {
+		return getDefaultWindows(), defaultWindowSource, nil
+	}
+	windows, err := parseWindows(value)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid %s %q of %s in the policy of %s: %v",
+			WindowAnnotation, value, bd.Name, source, err)
+	}
+	return windows, source, nil
+}
+
+// getDefaultWindows gets the maintenance windows used if they are not set in the policy
+func getDefaultWindows() []window {
+	val := os.Getenv(EnvCleanupWindows)
+	if len(val) == 0 {
+		return nil
+	}
+	windows, err := parseWindows(val)
+	if err != nil {
+		klog.Warningf("invalid %s: %s, not limiting the cleanup to windows: %v", EnvCleanupWindows, val, err)
+		return nil
+	}
+	return windows
+}
+
+// parseWindows parses the maintenance windows separated by semicolons. Each window is
+// a cron schedule followed by the duration of the window, eg: 0 22 * * 1-5 8h for the
+// nights of the working days. The schedule is in the time zone of the operator.
+func parseWindows(value string) ([]window, error) {
+	var windows []window
+	for _, spec := range strings.Split(value, ";") {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+		fields := strings.Fields(spec)
+		if len(fields) != len(cronFields)+1 {
+			return nil, fmt.Errorf("window %q must be a cron schedule of %d fields and a duration",
+				spec, len(cronFields))
+		}
+		s, err := parseSchedule(fields[:len(cronFields)])
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %v", spec, err)
+		}
+		duration, err := time.ParseDuration(fields[len(cronFields)])
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("window %q: invalid duration %q", spec, fields[len(cronFields)])
+		}
+		windows = append(windows, window{schedule: s, duration: duration})
+	}
+	return windows, nil
+}
+
+// parseSchedule parses the fields of a cron schedule, each of which is *, a value, a
+// range, or a comma separated list of them, with an optional step, eg: */15 or 1-5
+func parseSchedule(fields []string) (*schedule, error) {
+	bits := make([]uint64, len(cronFields))
+	for i, field := range fields {
+		for _, item := range strings.Split(field, ",") {
+			b, err := parseCronItem(item, cronFields[i].min, cronFields[i].max)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %v", cronFields[i].name, field, err)
+			}
+			bits[i] |= b
+		}
+	}
+	s := &schedule{minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	// sunday is both 0 and 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseCronItem parses an item of a field of a cron schedule, whose values are between
+// min and max, as bits
+func parseCronItem(item string, min, max int) (uint64, error) {
+	step := 1
+	if i := strings.IndexByte(item, '/'); i >= 0 {
+		var err error
+		if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", item[i+1:])
+		}
+		item = item[:i]
+	}
+	low, high := min, max
+	if item != "*" {
+		var err error
+		bounds := strings.SplitN(item, "-", 2)
+		if low, err = strconv.Atoi(bounds[0]); err != nil {
+			return 0, fmt.Errorf("invalid value %q", bounds[0])
+		}
+		high = low
+		if len(bounds) == 2 {
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[1])
+			}
+		} else if step != 1 {
+			// a value with a step starts a range to the max
+			high = max
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is not within %d-%d", item, min, max)
+		}
+	}
+	var bits uint64
+	for v := low; v <= high; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+// matchDay checks if the day of the time matches the schedule. If both the day of the
+// month and of the week are set, either of them matches, as in cron.
+func (s *schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domStar || s.dowStar:
+		return dom && dow
+	default:
+		return dom || dow
+	}
+}
+
+// next returns the first time after the given time which matches the schedule, at
+// the start of a minute, or zero if none matches within 5 years
+func (s *schedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case s.month&(1<<uint(month)) == 0:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cleaner
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWindows(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		"nights of the working days and the weekends": {
+			value: "0 22 * * 1-5 8h; 0 0 * * 0,6 24h",
+			want:  2,
+		},
+		"steps": {
+			value: "*/15 0-6/2 1 */3 * 5m",
+			want:  1,
+		},
+		"empty windows are ignored": {
+			value: "0 22 * * * 8h;",
+			want:  1,
+		},
+		"missing duration": {
+			value:   "0 22 * * 1-5",
+			wantErr: true,
+		},
+		"invalid duration": {
+			value:   "0 22 * * 1-5 -1h",
+			wantErr: true,
+		},
+		"hour out of range": {
+			value:   "0 24 * * * 1h",
+			wantErr: true,
+		},
+		"invalid range": {
+			value:   "0 6-2 * * * 1h",
+			wantErr: true,
+		},
+		"invalid step": {
+			value:   "*/0 * * * * 1h",
+			wantErr: true,
+		},
+		"invalid value": {
+			value:   "0 22 * * mon 1h",
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			windows, err := parseWindows(test.value)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, windows, test.want)
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 2021-06-02 is a wednesday
+	after := time.Date(2021, 6, 2, 10, 30, 0, 0, time.UTC)
+	tests := map[string]struct {
+		schedule string
+		want     time.Time
+	}{
+		"every minute": {
+			schedule: "* * * * *",
+			want:     time.Date(2021, 6, 2, 10, 31, 0, 0, time.UTC),
+		},
+		"later today": {
+			schedule: "0 22 * * *",
+			want:     time.Date(2021, 6, 2, 22, 0, 0, 0, time.UTC),
+		},
+		"weekend": {
+			schedule: "0 0 * * 0,6",
+			want:     time.Date(2021, 6, 5, 0, 0, 0, 0, time.UTC),
+		},
+		"sunday as 7": {
+			schedule: "30 1 * * 7",
+			want:     time.Date(2021, 6, 6, 1, 30, 0, 0, time.UTC),
+		},
+		"day of the month or of the week": {
+			schedule: "0 0 15 * 5",
+			want:     time.Date(2021, 6, 4, 0, 0, 0, 0, time.UTC),
+		},
+		"next year": {
+			schedule: "0 0 1 1 *",
+			want:     time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"leap day": {
+			schedule: "0 0 29 2 *",
+			want:     time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"never": {
+			schedule: "0 0 31 2 *",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			windows, err := parseWindows(test.schedule + " 1h")
+			require.NoError(t, err)
+			assert.Equal(t, test.want, windows[0].schedule.next(after))
+		})
+	}
+}
+
+func TestCheckWindow(t *testing.T) {
+	// 2021-06-02 is a wednesday
+	now := time.Date(2021, 6, 2, 3, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		annotations    map[string]string
+		defaultWindows string
+		wantOpens      time.Time
+		wantErr        bool
+	}{
+		"no windows": {},
+		"open window of the operator": {
+			defaultWindows: "0 22 * * 1-5 8h",
+		},
+		"closed window of the operator": {
+			defaultWindows: "0 22 * * 1-5 4h",
+			wantOpens:      time.Date(2021, 6, 2, 22, 0, 0, 0, time.UTC),
+		},
+		"first window to open": {
+			defaultWindows: "0 22 * * 1-5 4h; 0 0 * * 0,6 24h; 0 12 * * * 1h",
+			wantOpens:      time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC),
+		},
+		"window of the policy": {
+			annotations:    map[string]string{WindowAnnotation: "0 22 * * 1-5 4h"},
+			defaultWindows: "0 22 * * 1-5 8h",
+			wantOpens:      time.Date(2021, 6, 2, 22, 0, 0, 0, time.UTC),
+		},
+		"window which opens now": {
+			annotations: map[string]string{WindowAnnotation: "0 3 * * * 1m"},
+		},
+		"window which has just closed": {
+			annotations: map[string]string{WindowAnnotation: "59 2 * * * 1m"},
+			wantOpens:   time.Date(2021, 6, 3, 2, 59, 0, 0, time.UTC),
+		},
+		"invalid windows of the operator": {
+			defaultWindows: "0 22 * * 1-5",
+		},
+		"invalid windows of the policy": {
+			annotations: map[string]string{WindowAnnotation: "nightly"},
+			wantErr:     true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if len(test.defaultWindows) != 0 {
+				os.Setenv(EnvCleanupWindows, test.defaultWindows)
+				defer os.Unsetenv(EnvCleanupWindows)
+			}
+			bd := newTestBlockDevice("/dev/sdb", "", test.annotations)
+			err := checkWindow(bd, now)
+			if test.wantErr {
+				require.Error(t, err)
+				assert.NotContains(t, err.Error(), "outside")
+				return
+			}
+			if test.wantOpens.IsZero() {
+				assert.NoError(t, err)
+				return
+			}
+			outside, ok := err.(*OutsideWindowError)
+			require.True(t, ok, "%v", err)
+			assert.Equal(t, test.wantOpens, outside.Opens)
+		})
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/db/kubernetes"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DriveTypeNVMe selects the NVMe devices, which are reported with the SSD drive type
+const DriveTypeNVMe = "nvme"
+
+// ClaimPollInterval is the interval at which a claim is checked while waiting
+// for it to be bound
+var ClaimPollInterval = time.Second
+
+// ClaimOptions are the options of a blockdevice claim created from the command line
+type ClaimOptions struct {
+	// Namespace is the namespace of the claim and the blockdevices
+	Namespace string
+	// Name is the name of the claim, a name is generated if empty
+	Name string
+	// Capacity is the capacity of the blockdevice, eg: 500Gi
+	Capacity string
+	// Node is the node of the blockdevice, any node if empty
+	Node string
+	// DriveType is the drive type of the blockdevice, ssd, hdd or nvme
+	DriveType string
+	// DeviceType is the device type of the blockdevice, eg: disk
+	DeviceType string
+}
+
+// NewClaim returns the claim for a blockdevice with the options. The claims
+// cannot select the blockdevices by the drive type, so if the drive type is
+// given, the smallest unclaimed blockdevice of the drive type with the capacity
+// is selected and claimed by name.
+func NewClaim(c client.Client, opts ClaimOptions) (*apis.BlockDeviceClaim, error) {
+	capacity, err := resource.ParseQuantity(opts.Capacity)
+	if err != nil || capacity.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid capacity %q", opts.Capacity)
+	}
+	name := opts.Name
+	if len(name) == 0 {
+		name = "bdc-" + rand.String(8)
+	}
+
+	bdc := &apis.BlockDeviceClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: opts.Namespace},
+		Spec: apis.DeviceClaimSpec{
+			Resources: apis.DeviceClaimResources{
+				Requests: v1.ResourceList{apis.ResourceStorage: capacity},
+			},
+			DeviceType:                opts.DeviceType,
+			BlockDeviceNodeAttributes: apis.BlockDeviceNodeAttributes{NodeName: opts.Node},
+		},
+	}
+	if len(opts.DriveType) != 0 {
+		bd, err := SelectBlockDevice(c, opts, uint64(capacity.Value()))
+		if err != nil {
+			return nil, err
+		}
+		bdc.Spec.BlockDeviceName = bd.Name
+		bdc.Spec.BlockDeviceNodeAttributes.NodeName = bd.Spec.NodeAttributes.NodeName
+	}
+	return bdc, nil
+}
+
+// SelectBlockDevice returns the smallest blockdevice of the drive type with the
+// capacity, which can be claimed without a selector
+func SelectBlockDevice(c client.Client, opts ClaimOptions, capacity uint64) (*apis.BlockDevice, error) {
+	bdList := &apis.BlockDeviceList{}
+	if err := c.List(context.TODO(), bdList, client.InNamespace(opts.Namespace)); err != nil {
+		return nil, fmt.Errorf("unable to list blockdevices: %v", err)
+	}
+	devices := bdList.Items
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Spec.NodeAttributes.NodeName != devices[j].Spec.NodeAttributes.NodeName {
+			return devices[i].Spec.NodeAttributes.NodeName < devices[j].Spec.NodeAttributes.NodeName
+		}
+		return devices[i].Name < devices[j].Name
+	})
+	var selected *apis.BlockDevice
+	for i, bd := range devices {
+		if len(opts.Node) != 0 && bd.Spec.NodeAttributes.NodeName != opts.Node {
+			continue
+		}
+		if bd.Status.State != apis.BlockDeviceActive || bd.Status.ClaimState != apis.BlockDeviceUnclaimed ||
+			bd.Spec.Unschedulable {
+			continue
+		}
+		if !MatchesDriveType(&bd, opts.DriveType) || bd.Spec.Capacity.Storage < capacity {
+			continue
+		}
+		if len(opts.DeviceType) != 0 && bd.Spec.Details.DeviceType != opts.DeviceType {
+			continue
+		}
+		// sparse and tagged blockdevices are claimed only when asked for explicitly
+		if bd.Spec.Details.DeviceType == blockdevice.SparseBlockDeviceType && opts.DeviceType != blockdevice.SparseBlockDeviceType {
+			continue
+		}
+		if _, ok := bd.Labels[kubernetes.BlockDeviceTagLabel]; ok {
+			continue
+		}
+		if selected == nil || bd.Spec.Capacity.Storage < selected.Spec.Capacity.Storage {
+			selected = &devices[i]
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("no unclaimed %s blockdevice with capacity %s found", opts.DriveType, opts.Capacity)
+	}
+	return selected, nil
+}
+
+// MatchesDriveType returns whether the blockdevice is of the drive type. The
+// NVMe devices are matched by their path.
+func MatchesDriveType(bd *apis.BlockDevice, driveType string) bool {
+	if strings.EqualFold(driveType, DriveTypeNVMe) {
+		return strings.HasPrefix(bd.Spec.Path, "/dev/nvme")
+	}
+	return strings.EqualFold(bd.Spec.Details.DriveType, driveType)
+}
+
+// WaitForClaim waits till the claim is bound, and returns the blockdevice
+// bound to it
+func WaitForClaim(c client.Client, namespace, name string, timeout time.Duration) (*apis.BlockDevice, error) {
+	bdc := &apis.BlockDeviceClaim{}
+	err := wait.PollImmediate(ClaimPollInterval, timeout, func() (bool, error) {
+		if err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: name}, bdc); err != nil {
+			return false, err
+		}
+		return bdc.Status.Phase == apis.BlockDeviceClaimStatusDone && len(bdc.Spec.BlockDeviceName) != 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("blockdeviceclaim %s is not bound after %s, phase %s", name, timeout, OrNone(string(bdc.Status.Phase)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get blockdeviceclaim %s: %v", name, err)
+	}
+	bd := &apis.BlockDevice{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: bdc.Spec.BlockDeviceName}, bd); err != nil {
+		return nil, fmt.Errorf("unable to get blockdevice %s bound to %s: %v", bdc.Spec.BlockDeviceName, name, err)
+	}
+	return bd, nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// completionShells are the shells for which the completions are generated
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// NewCompletionCmd returns the completion command, which prints the completion
+// script of the root command for a shell
+func NewCompletionCmd(root *cobra.Command) *cobra.Command {
+	name := root.Name()
+	return &cobra.Command{
+		Use:   "completion " + strings.Join(completionShells, "|"),
+		Short: "Print the completion script for a shell",
+		Long: fmt.Sprintf(`Print the completion script of %[1]s for bash, zsh, fish or powershell.
+The commands, the flags and the values of the flags like --output are completed`, name),
+		Example: fmt.Sprintf(`  source <(%[1]s completion bash)
+  %[1]s completion zsh > "${fpath[1]}/_%[1]s"
+  %[1]s completion fish > ~/.config/fish/completions/%[1]s.fish`, name),
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: append([]string(nil), completionShells...),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return GenCompletion(root, args[0], os.Stdout)
+		},
+	}
+}
+
+// GenCompletion writes the completion script of the root command for the shell
+func GenCompletion(root *cobra.Command, shell string, out io.Writer) error {
+	switch shell {
+	case "bash":
+		root.BashCompletionFunction = bashCompletionFuncs(root)
+		return root.GenBashCompletion(out)
+	case "zsh":
+		return root.GenZshCompletion(out)
+	case "fish":
+		return genFishCompletion(root, out)
+	case "powershell":
+		return root.GenPowerShellCompletion(out)
+	}
+	return fmt.Errorf("unknown shell %s, must be %s", shell, joinValues(completionShells))
+}
+
+// bashCompletionFunc returns the name of the bash function completing the values
+func bashCompletionFunc(values []string) string {
+	return "__ndm_complete_" + strings.Join(values, "_")
+}
+
+// bashCompletionFuncs returns the bash functions completing the values of the
+// flags of the commands, which are set using SetCompletionValues
+func bashCompletionFuncs(root *cobra.Command) string {
+	funcs := make(map[string]string)
+	visitCommands(root, func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			if values, ok := flag.Annotations[completionValuesAnnotation]; ok {
+				funcs[bashCompletionFunc(values)] = strings.Join(values, " ")
+			}
+		})
+	})
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		fmt.Fprintf(buf, "%s()\n{\n    COMPREPLY=( $( compgen -W \"%s\" -- \"$cur\" ) )\n}\n\n", name, funcs[name])
+	}
+	return buf.String()
+}
+
+// visitCommands calls fn for the command and all its subcommands
+func visitCommands(cmd *cobra.Command, fn func(cmd *cobra.Command)) {
+	fn(cmd)
+	for _, child := range cmd.Commands() {
+		visitCommands(child, fn)
+	}
+}
+
+// genFishCompletion writes the fish completion of the root command. The vendored
+// cobra generates the completions only for bash, zsh and powershell.
+func genFishCompletion(root *cobra.Command, out io.Writer) error {
+	buf := new(bytes.Buffer)
+	name := root.Name()
+	fmt.Fprintf(buf, "# fish completion for %s\n", name)
+	fmt.Fprintf(buf, "complete -c %s -e\n", name)
+	root.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		writeFishFlag(buf, name, "", flag)
+	})
+	writeFishCommand(buf, name, root, nil)
+	_, err := buf.WriteTo(out)
+	return err
+}
+
+// writeFishCommand writes the fish completion of the flags, the arguments and
+// the subcommands of the command, whose subcommand path from the root is given
+func writeFishCommand(buf *bytes.Buffer, name string, cmd *cobra.Command, path []string) {
+	conditions := make([]string, 0, len(path))
+	for _, p := range path {
+		conditions = append(conditions, "__fish_seen_subcommand_from "+p)
+	}
+	condition := strings.Join(conditions, "; and ")
+	if len(path) == 0 {
+		condition = "__fish_use_subcommand"
+	}
+
+	cmd.NonInheritedFlags().VisitAll(func(flag *pflag.Flag) {
+		if len(path) == 0 && cmd.PersistentFlags().Lookup(flag.Name) != nil {
+			return
+		}
+		writeFishFlag(buf, name, condition, flag)
+	})
+	if len(cmd.ValidArgs) != 0 {
+		fmt.Fprintf(buf, "complete -c %s -f -n '%s' -a '%s'\n", name, condition, strings.Join(cmd.ValidArgs, " "))
+	}
+
+	children := make([]*cobra.Command, 0)
+	for _, child := range cmd.Commands() {
+		if child.IsAvailableCommand() {
+			children = append(children, child)
+		}
+	}
+	if len(children) == 0 {
+		return
+	}
+	childCondition := condition
+	if len(path) != 0 {
+		names := make([]string, 0, len(children))
+		for _, child := range children {
+			names = append(names, child.Name())
+		}
+		childCondition += "; and not __fish_seen_subcommand_from " + strings.Join(names, " ")
+	}
+	for _, child := range children {
+		fmt.Fprintf(buf, "complete -c %s -f -n '%s' -a %s -d %s\n", name, childCondition, child.Name(),
+			fishQuote(child.Short))
+	}
+	for _, child := range children {
+		writeFishCommand(buf, name, child, append(path[:len(path):len(path)], child.Name()))
+	}
+}
+
+// writeFishFlag writes the fish completion of the flag, completed when the
+// condition is true
+func writeFishFlag(buf *bytes.Buffer, name, condition string, flag *pflag.Flag) {
+	if flag.Hidden {
+		return
+	}
+	fmt.Fprintf(buf, "complete -c %s", name)
+	if len(condition) != 0 {
+		fmt.Fprintf(buf, " -n '%s'", condition)
+	}
+	if len(flag.Shorthand) != 0 {
+		fmt.Fprintf(buf, " -s %s", flag.Shorthand)
+	}
+	fmt.Fprintf(buf, " -l %s", flag.Name)
+	if flag.Value.Type() != "bool" {
+		if values, ok := flag.Annotations[completionValuesAnnotation]; ok {
+			fmt.Fprintf(buf, " -x -a '%s'", strings.Join(values, " "))
+		} else {
+			buf.WriteString(" -r")
+		}
+	}
+	fmt.Fprintf(buf, " -d %s\n", fishQuote(strings.SplitN(flag.Usage, "\n", 2)[0]))
+}
+
+// fishQuote quotes the string for fish
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
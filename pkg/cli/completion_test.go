@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCompletionTestCmd() *cobra.Command {
+	var socket, output, node string
+	var force bool
+	root := &cobra.Command{Use: "ndmctl"}
+	root.PersistentFlags().StringVar(&socket, "socket", "", "Path of the socket")
+	devices := &cobra.Command{Use: "devices", Short: "List the devices"}
+	list := &cobra.Command{Use: "list", Short: "List the devices, with the filtered devices", Run: func(*cobra.Command, []string) {}}
+	AddOutputFlag(list, &output, OutputText, OutputWide, OutputJSON, OutputYAML)
+	wipe := &cobra.Command{Use: "wipe", Short: "Wipe a device", Run: func(*cobra.Command, []string) {}}
+	wipe.Flags().BoolVar(&force, "force", false, "Don't ask for confirmation")
+	wipe.Flags().StringVarP(&node, "node", "n", "", "Node of the device")
+	devices.AddCommand(list)
+	root.AddCommand(devices, wipe, NewCompletionCmd(root))
+	return root
+}
+
+func TestGenCompletion(t *testing.T) {
+	root := newCompletionTestCmd()
+
+	var out bytes.Buffer
+	require.NoError(t, GenCompletion(root, "fish", &out))
+	assert.Equal(t, `# fish completion for ndmctl
+complete -c ndmctl -e
+complete -c ndmctl -l socket -r -d 'Path of the socket'
+complete -c ndmctl -f -n '__fish_use_subcommand' -a completion -d 'Print the completion script for a shell'
+complete -c ndmctl -f -n '__fish_use_subcommand' -a devices -d 'List the devices'
+complete -c ndmctl -f -n '__fish_use_subcommand' -a wipe -d 'Wipe a device'
+complete -c ndmctl -f -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish powershell'
+complete -c ndmctl -f -n '__fish_seen_subcommand_from devices; and not __fish_seen_subcommand_from list' -a list -d 'List the devices, with the filtered devices'
+complete -c ndmctl -n '__fish_seen_subcommand_from devices; and __fish_seen_subcommand_from list' -s o -l output -x -a 'text wide json yaml' -d 'Output format, text, wide, json or yaml'
+complete -c ndmctl -n '__fish_seen_subcommand_from wipe' -l force -d 'Don\'t ask for confirmation'
+complete -c ndmctl -n '__fish_seen_subcommand_from wipe' -s n -l node -r -d 'Node of the device'
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, GenCompletion(root, "bash", &out))
+	assert.Contains(t, out.String(), `__ndm_complete_text_wide_json_yaml()
+{
+    COMPREPLY=( $( compgen -W "text wide json yaml" -- "$cur" ) )
+}`)
+	assert.Contains(t, out.String(), `flags_completion+=("__ndm_complete_text_wide_json_yaml")`)
+
+	for _, shell := range []string{"zsh", "powershell"} {
+		out.Reset()
+		require.NoError(t, GenCompletion(root, shell, &out))
+		assert.Contains(t, out.String(), "ndmctl")
+	}
+	assert.EqualError(t, GenCompletion(root, "tcsh", &out),
+		"unknown shell tcsh, must be bash, zsh, fish or powershell")
+}
+
+func TestOutput(t *testing.T) {
+	assert.NoError(t, ValidateOutput("yaml", OutputText, OutputJSON, OutputYAML))
+	assert.EqualError(t, ValidateOutput("wide", OutputJSON, OutputYAML), "unknown output format wide, must be json or yaml")
+
+	var out bytes.Buffer
+	v := struct {
+		Name string `json:"name"`
+	}{"sda"}
+	require.NoError(t, PrintObject(&out, OutputJSON, v))
+	assert.Equal(t, "{\n  \"name\": \"sda\"\n}\n", out.String())
+	out.Reset()
+	require.NoError(t, PrintObject(&out, OutputYAML, v))
+	assert.Equal(t, "name: sda\n", out.String())
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// OutputText is the default output format, a table or text to be read
+	OutputText = "text"
+	// OutputWide is a table with additional columns
+	OutputWide = "wide"
+	// OutputJSON is the output format for the tools
+	OutputJSON = "json"
+	// OutputYAML is the output format for the tools
+	OutputYAML = "yaml"
+)
+
+// completionValuesAnnotation is set on a flag with the values to which it is
+// completed by the shell completions
+const completionValuesAnnotation = "ndm_completion_values"
+
+// AddOutputFlag adds the --output, -o flag to the command, which accepts the
+// formats and defaults to the first of them
+func AddOutputFlag(cmd *cobra.Command, output *string, formats ...string) {
+	cmd.Flags().StringVarP(output, "output", "o", formats[0], "Output format, "+joinValues(formats))
+	SetCompletionValues(cmd.Flags(), "output", formats...)
+}
+
+// SetCompletionValues sets the values to which the flag is completed by the
+// shell completions
+func SetCompletionValues(flags *pflag.FlagSet, name string, values ...string) {
+	_ = flags.SetAnnotation(name, completionValuesAnnotation, values)
+	_ = flags.SetAnnotation(name, cobra.BashCompCustom, []string{bashCompletionFunc(values)})
+}
+
+// ValidateOutput returns an error if the output format is not one of the formats
+func ValidateOutput(output string, formats ...string) error {
+	for _, format := range formats {
+		if output == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %s, must be %s", output, joinValues(formats))
+}
+
+// PrintObject prints the object as indented json, or as yaml
+func PrintObject(out io.Writer, output string, v interface{}) error {
+	var data []byte
+	var err error
+	switch output {
+	case OutputJSON:
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	case OutputYAML:
+		data, err = yaml.Marshal(v)
+	default:
+		return fmt.Errorf("unknown output format %s, must be %s", output, joinValues([]string{OutputJSON, OutputYAML}))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to encode the output as %s: %v", output, err)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// joinValues joins the values as "a, b or c"
+func joinValues(values []string) string {
+	if len(values) < 2 {
+		return strings.Join(values, "")
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cli has the helpers shared by the command line tools of NDM, ndmctl
+// and the kubectl-ndm plugin, to print the devices and claims similar to kubectl
+// and to connect to the API server.
+package cli
+
+import (
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// None is printed for the empty values, similar to kubectl
+const None = "<none>"
+
+// NewTabWriter returns a writer which aligns the tab separated columns of a
+// table, similar to kubectl
+func NewTabWriter(out io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+}
+
+// OrNone returns None for the empty values
+func OrNone(value string) string {
+	if len(value) == 0 {
+		return None
+	}
+	return value
+}
+
+// Capacity returns the capacity in binary units if exact, eg: 10Gi, or in
+// bytes otherwise
+func Capacity(bytes uint64) string {
+	if bytes == 0 {
+		return None
+	}
+	return resource.NewQuantity(int64(bytes), resource.BinarySI).String()
+}
+
+// Age returns the time elapsed since the given time in a human readable form,
+// eg: 5m
+func Age(t, now time.Time) string {
+	if t.IsZero() {
+		return None
+	}
+	return duration.HumanDuration(now.Sub(t))
+}
@@ -18,6 +18,8 @@ package blockdevice
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -29,6 +31,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -47,7 +50,15 @@ func Add(mgr manager.Manager) error {
 
 // newReconciler returns a new reconcile.Reconciler
 func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcileBlockDevice{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("blockdevice-controller")}
+	r := &ReconcileBlockDevice{client: mgr.GetClient(), scheme: mgr.GetScheme(), recorder: mgr.GetEventRecorderFor("blockdevice-controller")}
+	// the logs of the cleanup jobs are read using the clientset, for their progress
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		klog.Errorf("unable to create clientset, the progress of the cleanup will not be reported: %v", err)
+	} else {
+		r.logs = cleaner.NewLogReader(clientset)
+	}
+	return r
 }
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
@@ -76,8 +87,14 @@ type ReconcileBlockDevice struct {
 	client   client.Client
 	scheme   *runtime.Scheme
 	recorder record.EventRecorder
+	// logs reads the logs of the cleanup jobs, for their progress
+	logs cleaner.LogReader
 }
 
+// cleanupProgressInterval is the interval at which the progress of the cleanup
+// of a released blockdevice is updated
+var cleanupProgressInterval = 30 * time.Second
+
 // Reconcile reads that state of the cluster for a BlockDevice object and makes changes based on the state read
 // and what is in the BlockDevice.Spec
 // Note:
@@ -107,26 +124,87 @@ func (r *ReconcileBlockDevice) Reconcile(request reconcile.Request) (reconcile.R
 	case openebsv1alpha1.BlockDeviceReleased:
 		klog.V(2).Infof("%s is in Released state", instance.Name)
 		jobController := cleaner.NewJobController(r.client, request.Namespace)
+		skip, source, err := cleaner.GetSkipCleanup(instance)
+		if err != nil {
+			klog.Errorf("Error while cleaning %s: %v", instance.Name, err)
+			r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUp", "CleanUp unsuccessful, due to error: %v", err)
+			break
+		}
+		if skip {
+			r.skipCleanup(instance, source, jobController)
+			break
+		}
+		if retry := cleaner.GetRetry(instance); retry != nil {
+			// the cleanup is retried once the retry annotation is removed
+			if retry.Exhausted() {
+				break
+			}
+			if wait := time.Until(retry.RetryAfter.Time); wait > 0 {
+				return reconcile.Result{RequeueAfter: wait}, nil
+			}
+		}
+		reason, err := jobController.GetFailure(instance.Name, r.logs)
+		if err != nil {
+			klog.Errorf("Unable to get the status of the cleanup of %s: %v", instance.Name, err)
+			return reconcile.Result{}, err
+		}
+		if len(reason) != 0 {
+			return r.retryCleanup(instance, reason, jobController)
+		}
+		// the result of the job is read before the completed job is deleted
+		jobResult, err := jobController.GetJobResult(instance, r.logs)
+		if err != nil {
+			klog.V(4).Infof("unable to get the result of the cleanup of %s: %v", instance.Name, err)
+		} else if jobResult == nil && !jobController.IsCleaningJobRunning(instance.Name) {
+			// a cleanup job which was started before the dry run was set is not affected
+			dryRun, source, err := cleaner.GetDryRun(instance)
+			if err != nil {
+				klog.Errorf("Error while cleaning %s: %v", instance.Name, err)
+				r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUp", "CleanUp unsuccessful, due to error: %v", err)
+				break
+			}
+			if dryRun {
+				r.dryRunCleanup(instance, source, request.Namespace)
+				break
+			}
+		}
 		cleanupTracker := &cleaner.CleanupStatusTracker{JobController: jobController}
 		bdCleaner := cleaner.NewCleaner(r.client, request.Namespace, cleanupTracker)
 		ok, err := bdCleaner.Clean(instance)
+		if queued, isQueued := err.(*cleaner.QueuedError); isQueued {
+			r.setCleanupQueued(instance, "NodeLimitReached", queued)
+			// the job is started once the jobs running on the node complete
+			return reconcile.Result{RequeueAfter: cleanupProgressInterval}, nil
+		}
+		if outside, isOutside := err.(*cleaner.OutsideWindowError); isOutside {
+			r.setCleanupQueued(instance, "OutsideWindow", outside)
+			// the job is started once the next window opens
+			if wait := time.Until(outside.Opens); wait > 0 {
+				return reconcile.Result{RequeueAfter: wait}, nil
+			}
+			return reconcile.Result{RequeueAfter: cleanupProgressInterval}, nil
+		}
 		if err != nil {
 			klog.Errorf("Error while cleaning %s: %v", instance.Name, err)
 			r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUp", "CleanUp unsuccessful, due to error: %v", err)
 			break
 		}
 		if ok {
-			r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceReleased", "CleanUp Completed")
-			// remove the finalizer string from BlockDevice resource
-			instance.Finalizers = util.RemoveString(instance.Finalizers, controllerutil.BlockDeviceFinalizer)
-			klog.Infof("Cleanup completed for %s", instance.Name)
-			err := r.updateBDStatus(openebsv1alpha1.BlockDeviceUnclaimed, instance)
-			if err != nil {
-				klog.Errorf("Failed to mark %s as Unclaimed: %v", instance.Name, err)
+			message := "CleanUp Completed"
+			if jobResult != nil {
+				cleaner.SetResult(instance, jobResult)
+				message += " " + jobResult.Summary()
 			}
-			r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceUnclaimed", "BD now marked as Unclaimed")
+			r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceReleased", "%s", message)
+			// the job completes only if the verification passed, and the verification
+			// is read from the policy before the policy of the claim is removed
+			r.setCleanupVerified(instance)
+			klog.Infof("Cleanup completed for %s", instance.Name)
+			r.unclaim(instance)
 		} else {
-			r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceCleanUpInProgress", "CleanUp is in progress")
+			r.updateCleanupProgress(instance, jobController)
+			// the progress is updated till the cleanup is completed
+			return reconcile.Result{RequeueAfter: cleanupProgressInterval}, nil
 		}
 	case openebsv1alpha1.BlockDeviceClaimed:
 		if !util.Contains(instance.GetFinalizers(), controllerutil.BlockDeviceFinalizer) {
@@ -145,6 +223,227 @@ func (r *ReconcileBlockDevice) Reconcile(request reconcile.Request) (reconcile.R
 	return reconcile.Result{}, nil
 }
 
+// setCleanupQueued sets the CleanupQueued condition of the blockdevice whose cleanup is
+// waiting for the limit of cleanup jobs running on its node, with its position in the
+// queue, or for its maintenance window to open
+func (r *ReconcileBlockDevice) setCleanupQueued(instance *openebsv1alpha1.BlockDevice, reason string, queued error) {
+	message := "Cleanup is " + queued.Error()
+	existing := instance.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupQueued)
+	if existing != nil && existing.Message == message {
+		return
+	}
+	if existing == nil || existing.Reason != reason {
+		klog.Infof("Cleanup of %s queued, %v", instance.Name, queued)
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceCleanUpQueued", "%s", message)
+	}
+	instance.Status.SetCondition(openebsv1alpha1.BlockDeviceCondition{
+		Type:    openebsv1alpha1.BlockDeviceCleanupQueued,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+	if err := r.client.Update(context.TODO(), instance); err != nil {
+		klog.Errorf("Failed to update the queued cleanup of %s: %v", instance.Name, err)
+	}
+}
+
+// skipCleanup marks the released blockdevice as Unclaimed without cleaning it, as its
+// cleanup is skipped by the policy of the source. A cleanup job which was started
+// before the policy was set is cancelled.
+func (r *ReconcileBlockDevice) skipCleanup(instance *openebsv1alpha1.BlockDevice, source string, jobController cleaner.JobController) {
+	if jobController.IsCleaningJobRunning(instance.Name) {
+		if err := jobController.CancelJob(instance.Name); err != nil {
+			klog.Errorf("Failed to cancel the cleanup of %s: %v", instance.Name, err)
+			r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUp",
+				"Unable to cancel the cleanup skipped by the policy of %s, due to error: %v", source, err)
+			return
+		}
+	}
+	klog.Infof("Cleanup of %s skipped by the policy of %s", instance.Name, source)
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceCleanUpSkipped",
+		"CleanUp skipped by the policy of %s", source)
+	instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupVerified)
+	r.unclaim(instance)
+}
+
+// dryRunCleanup records the cleanup which the cleanup job of the released blockdevice
+// would do, and marks the blockdevice as Unclaimed without touching its data, as its
+// cleanup is a dry run by the policy of the source
+func (r *ReconcileBlockDevice) dryRunCleanup(instance *openebsv1alpha1.BlockDevice, source, namespace string) {
+	plan, err := cleaner.NewPlan(instance, namespace)
+	if err != nil {
+		// the blockdevice stays released, as the cleanup would fail
+		klog.Errorf("Error in the dry run of the cleanup of %s: %v", instance.Name, err)
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUp",
+			"CleanUp dry run by the policy of %s unsuccessful, due to error: %v", source, err)
+		return
+	}
+	klog.Infof("Dry run of the cleanup of %s by the policy of %s: would %s, running: %s",
+		instance.Name, source, plan, plan.Command)
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceCleanUpDryRun",
+		"CleanUp dry run by the policy of %s: would %s", source, plan)
+	cleaner.SetResult(instance, plan.Result(instance))
+	instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupVerified)
+	r.unclaim(instance)
+}
+
+// retryCleanup deletes the failed cleanup job of the released blockdevice, so that the
+// cleanup is retried after a backoff. Once all the retries have failed, the CleanupFailed
+// condition is set, and the cleanup is not retried till the retry annotation is removed.
+func (r *ReconcileBlockDevice) retryCleanup(instance *openebsv1alpha1.BlockDevice, reason string, jobController cleaner.JobController) (reconcile.Result, error) {
+	r.setCleanupVerifyFailure(instance, jobController)
+	// the result and the logs of the job are kept on the blockdevice after it is deleted
+	if jobResult, err := jobController.GetJobResult(instance, r.logs); err != nil {
+		klog.V(4).Infof("unable to get the result of the cleanup of %s: %v", instance.Name, err)
+	} else if jobResult != nil {
+		cleaner.SetResult(instance, jobResult)
+	}
+	// the job is deleted before the failure is recorded, so that the failure of
+	// the job is not recorded twice
+	if err := jobController.CancelJob(instance.Name); err != nil {
+		klog.Errorf("Failed to delete the failed cleanup job of %s: %v", instance.Name, err)
+		return reconcile.Result{}, err
+	}
+	retry := cleaner.RecordFailure(instance, time.Now())
+	instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupInProgress)
+	result := reconcile.Result{}
+	if retry.Exhausted() {
+		message := fmt.Sprintf("CleanUp failed after %d attempts: %s", retry.Failures, reason)
+		klog.Errorf("%s of %s", message, instance.Name)
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUpFailed", "%s", message)
+		instance.Status.SetCondition(openebsv1alpha1.BlockDeviceCondition{
+			Type:    openebsv1alpha1.BlockDeviceCleanupFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "RetriesExhausted",
+			Message: message,
+		})
+	} else {
+		wait := time.Until(retry.RetryAfter.Time).Round(time.Second)
+		klog.Warningf("Cleanup attempt %d of %s failed: %s, retrying in %s", retry.Failures, instance.Name, reason, wait)
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUpRetry",
+			"CleanUp attempt %d failed: %s, retrying in %s", retry.Failures, reason, wait)
+		result.RequeueAfter = wait
+	}
+	if err := r.client.Update(context.TODO(), instance); err != nil {
+		klog.Errorf("Failed to record the failed cleanup of %s: %v", instance.Name, err)
+		return reconcile.Result{}, err
+	}
+	return result, nil
+}
+
+// unclaim marks the released blockdevice as Unclaimed, once it is cleaned or its cleanup
+// is skipped, and removes the finalizer, the policy of the claim and the state of the cleanup
+func (r *ReconcileBlockDevice) unclaim(instance *openebsv1alpha1.BlockDevice) {
+	// remove the finalizer string from BlockDevice resource
+	instance.Finalizers = util.RemoveString(instance.Finalizers, controllerutil.BlockDeviceFinalizer)
+	cleaner.ClearClaimPolicy(instance)
+	cleaner.ClearRetry(instance)
+	instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupInProgress)
+	instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupFailed)
+	instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupQueued)
+	err := r.updateBDStatus(openebsv1alpha1.BlockDeviceUnclaimed, instance)
+	if err != nil {
+		klog.Errorf("Failed to mark %s as Unclaimed: %v", instance.Name, err)
+	}
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceUnclaimed", "BD now marked as Unclaimed")
+}
+
+// updateCleanupProgress sets the progress reported by the cleanup job of the blockdevice
+// in its CleanupInProgress condition, and records an event every 10 percent
+func (r *ReconcileBlockDevice) updateCleanupProgress(instance *openebsv1alpha1.BlockDevice, jobController cleaner.JobController) {
+	var progress *cleaner.Progress
+	if r.logs != nil {
+		var err error
+		progress, err = jobController.GetProgress(instance.Name, r.logs)
+		if err != nil {
+			klog.V(4).Infof("unable to get the progress of the cleanup of %s: %v", instance.Name, err)
+		}
+	}
+	message := "Cleanup is in progress"
+	if progress != nil {
+		message = "Cleanup " + progress.String()
+	}
+
+	// the cleanup which failed is being retried, as the retry annotation was removed
+	changed := false
+	if instance.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupFailed) != nil && cleaner.GetRetry(instance) == nil {
+		instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupFailed)
+		changed = true
+	}
+	// the job of the queued cleanup has been started
+	if instance.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupQueued) != nil {
+		instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupQueued)
+		changed = true
+	}
+	existing := instance.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupInProgress)
+	if existing != nil && existing.Message == message && !changed {
+		return
+	}
+	if existing == nil {
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceCleanUpInProgress", "CleanUp is in progress")
+	}
+	if progress != nil {
+		lastPercent := -1
+		if existing != nil {
+			fmt.Sscanf(existing.Message, "Cleanup %d%%", &lastPercent)
+		}
+		if lastPercent < 0 || progress.Percent()/10 != lastPercent/10 {
+			r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceCleanUpProgress", "%s", message)
+		}
+	}
+	instance.Status.SetCondition(openebsv1alpha1.BlockDeviceCondition{
+		Type:    openebsv1alpha1.BlockDeviceCleanupInProgress,
+		Status:  corev1.ConditionTrue,
+		Reason:  "Cleaning",
+		Message: message,
+	})
+	if err := r.client.Update(context.TODO(), instance); err != nil {
+		klog.Errorf("Failed to update the cleanup progress of %s: %v", instance.Name, err)
+	}
+}
+
+// setCleanupVerifyFailure sets the CleanupVerified condition of the blockdevice to false
+// if the verification of its cleanup failed
+func (r *ReconcileBlockDevice) setCleanupVerifyFailure(instance *openebsv1alpha1.BlockDevice, jobController cleaner.JobController) {
+	if r.logs == nil {
+		return
+	}
+	reason, err := jobController.GetVerifyFailure(instance.Name, r.logs)
+	if err != nil {
+		klog.V(4).Infof("unable to get the verification of the cleanup of %s: %v", instance.Name, err)
+		return
+	}
+	if len(reason) == 0 {
+		return
+	}
+	r.recorder.Eventf(instance, corev1.EventTypeWarning, "BlockDeviceCleanUpVerificationFailed",
+		"Verification of the cleanup failed, %s", reason)
+	instance.Status.SetCondition(openebsv1alpha1.BlockDeviceCondition{
+		Type:    openebsv1alpha1.BlockDeviceCleanupVerified,
+		Status:  corev1.ConditionFalse,
+		Reason:  "VerificationFailed",
+		Message: reason,
+	})
+}
+
+// setCleanupVerified sets the CleanupVerified condition of the blockdevice whose cleanup
+// was completed, if the cleanup was verified, and removes it otherwise
+func (r *ReconcileBlockDevice) setCleanupVerified(instance *openebsv1alpha1.BlockDevice) {
+	mode, err := cleaner.GetVerifyMode(instance)
+	if err != nil || mode == cleaner.VerifyNone {
+		instance.Status.RemoveCondition(openebsv1alpha1.BlockDeviceCleanupVerified)
+		return
+	}
+	message := cleaner.VerifiedMessage(instance, mode)
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "BlockDeviceCleanUpVerified", "%s", message)
+	instance.Status.SetCondition(openebsv1alpha1.BlockDeviceCondition{
+		Type:    openebsv1alpha1.BlockDeviceCleanupVerified,
+		Status:  corev1.ConditionTrue,
+		Reason:  "Verified",
+		Message: message,
+	})
+}
+
 func (r *ReconcileBlockDevice) updateBDStatus(state openebsv1alpha1.DeviceClaimState, instance *openebsv1alpha1.BlockDevice) error {
 	instance.Status.ClaimState = state
 	err := r.client.Update(context.TODO(), instance)
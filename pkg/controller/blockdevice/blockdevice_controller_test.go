@@ -21,10 +21,20 @@ import (
 	//"math/rand"
 	//"reflect"
 	"fmt"
+	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	ndm "github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
 	openebsv1alpha1 "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cleaner"
+	controllerutil "github.com/openebs/node-disk-manager/pkg/controller/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -153,3 +163,391 @@ func CreateFakeClient(t *testing.T) (client.Client, *runtime.Scheme) {
 	}
 	return fakeNdmClient, s
 }
+
+// fakeJobController reports the progress and the verification failures of the
+// cleanup jobs from maps
+type fakeJobController struct {
+	progress       map[string]*cleaner.Progress
+	verifyFailures map[string]string
+}
+
+func (c *fakeJobController) IsCleaningJobRunning(bdName string) bool { return true }
+
+func (c *fakeJobController) CancelJob(bdName string) error { return nil }
+
+func (c *fakeJobController) RemoveJob(bdName string) (cleaner.CleanupState, error) {
+	return cleaner.CleanupStateRunning, nil
+}
+
+func (c *fakeJobController) GetProgress(bdName string, logs cleaner.LogReader) (*cleaner.Progress, error) {
+	return c.progress[bdName], nil
+}
+
+func (c *fakeJobController) GetVerifyFailure(bdName string, logs cleaner.LogReader) (string, error) {
+	return c.verifyFailures[bdName], nil
+}
+
+func (c *fakeJobController) GetFailure(bdName string, logs cleaner.LogReader) (string, error) {
+	if reason, ok := c.verifyFailures[bdName]; ok {
+		return "verification failed: " + reason, nil
+	}
+	return "", nil
+}
+
+func (c *fakeJobController) GetJobResult(bd *openebsv1alpha1.BlockDevice, logs cleaner.LogReader) (*cleaner.Result, error) {
+	return nil, nil
+}
+
+func TestUpdateCleanupProgress(t *testing.T) {
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder, logs: cleaner.NewLogReader(nil)}
+	jobController := &fakeJobController{progress: make(map[string]*cleaner.Progress)}
+	key := types.NamespacedName{Name: deviceName, Namespace: namespace}
+	getCondition := func() *openebsv1alpha1.BlockDeviceCondition {
+		bd := &openebsv1alpha1.BlockDevice{}
+		require.NoError(t, cl.Get(context.TODO(), key, bd))
+		return bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupInProgress)
+	}
+	update := func() {
+		bd := &openebsv1alpha1.BlockDevice{}
+		require.NoError(t, cl.Get(context.TODO(), key, bd))
+		r.updateCleanupProgress(bd, jobController)
+	}
+
+	// the job has not reported its progress
+	update()
+	cond := getCondition()
+	require.NotNil(t, cond)
+	assert.Equal(t, "Cleanup is in progress", cond.Message)
+	assert.Equal(t, "Normal BlockDeviceCleanUpInProgress CleanUp is in progress", <-recorder.Events)
+
+	jobController.progress[deviceName] = &cleaner.Progress{Done: 12, Total: 100, Elapsed: 12 * time.Minute}
+	update()
+	assert.Equal(t, "Cleanup 12% complete, about 1h28m remaining", getCondition().Message)
+	assert.Equal(t, "Normal BlockDeviceCleanUpProgress Cleanup 12% complete, about 1h28m remaining", <-recorder.Events)
+
+	// events are recorded every 10 percent
+	jobController.progress[deviceName] = &cleaner.Progress{Done: 15, Total: 100, Elapsed: 15 * time.Minute}
+	update()
+	assert.Equal(t, "Cleanup 15% complete, about 1h25m remaining", getCondition().Message)
+	jobController.progress[deviceName] = &cleaner.Progress{Done: 20, Total: 100, Elapsed: 20 * time.Minute}
+	update()
+	assert.Equal(t, "Normal BlockDeviceCleanUpProgress Cleanup 20% complete, about 1h20m remaining", <-recorder.Events)
+	assert.Empty(t, recorder.Events)
+}
+
+func TestCleanupVerification(t *testing.T) {
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder, logs: cleaner.NewLogReader(nil)}
+	jobController := &fakeJobController{verifyFailures: map[string]string{deviceName: "found signatures ext4"}}
+	key := types.NamespacedName{Name: deviceName, Namespace: namespace}
+	bd := &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), key, bd))
+
+	// the cleanup whose verification failed is retried
+	reason, err := jobController.GetFailure(deviceName, r.logs)
+	require.NoError(t, err)
+	result, err := r.retryCleanup(bd, reason, jobController)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, result.RequeueAfter)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), key, bd))
+	cond := bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupVerified)
+	require.NotNil(t, cond)
+	assert.Equal(t, corev1.ConditionFalse, cond.Status)
+	assert.Equal(t, "found signatures ext4", cond.Message)
+	assert.Equal(t, "Warning BlockDeviceCleanUpVerificationFailed Verification of the cleanup failed, "+
+		"found signatures ext4", <-recorder.Events)
+	assert.Equal(t, "Warning BlockDeviceCleanUpRetry CleanUp attempt 1 failed: verification failed: "+
+		"found signatures ext4, retrying in 1m0s", <-recorder.Events)
+
+	// the cleanup passed the verification
+	bd.Annotations = map[string]string{cleaner.VerifyAnnotation: "signatures"}
+	r.setCleanupVerified(bd)
+	cond = bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupVerified)
+	require.NotNil(t, cond)
+	assert.Equal(t, corev1.ConditionTrue, cond.Status)
+	assert.Equal(t, "No signatures found", cond.Message)
+	assert.Equal(t, "Normal BlockDeviceCleanUpVerified No signatures found", <-recorder.Events)
+
+	// the cleanup was not verified
+	bd.Annotations = nil
+	r.setCleanupVerified(bd)
+	assert.Nil(t, bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupVerified))
+}
+
+func TestSkipCleanup(t *testing.T) {
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: deviceName, Namespace: namespace}}
+
+	bd := &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	cleaner.SetClaimPolicy(bd, &openebsv1alpha1.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{
+		Name: "bdc-encrypted", Annotations: map[string]string{cleaner.SkipAnnotation: "true"}}})
+	bd.Annotations[cleaner.AllowClaimAnnotation] = "dry-run, skip"
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	// the cleanup was started before the policy was set
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-" + deviceName, Namespace: namespace}}
+	require.NoError(t, cl.Create(context.TODO(), job))
+
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	assert.Equal(t, openebsv1alpha1.BlockDeviceUnclaimed, bd.Status.ClaimState)
+	assert.Empty(t, bd.Finalizers)
+	assert.NotContains(t, bd.Annotations, cleaner.ClaimPolicyAnnotation)
+	assert.True(t, errors.IsNotFound(cl.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: namespace}, job)))
+	assert.Equal(t, "Normal BlockDeviceCleanUpSkipped CleanUp skipped by the policy of BlockDeviceClaim bdc-encrypted", <-recorder.Events)
+	assert.Equal(t, "Normal BlockDeviceUnclaimed BD now marked as Unclaimed", <-recorder.Events)
+
+	// the policy of the blockdevice
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	bd.Annotations = map[string]string{cleaner.SkipAnnotation: "yes"}
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	assert.Equal(t, openebsv1alpha1.BlockDeviceReleased, bd.Status.ClaimState)
+	assert.Contains(t, <-recorder.Events, `invalid ndm.io/cleanup-skip "yes" of blockdevice-example in the policy of BlockDevice blockdevice-example`)
+
+	bd.Annotations[cleaner.SkipAnnotation] = "true"
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	assert.Equal(t, openebsv1alpha1.BlockDeviceUnclaimed, bd.Status.ClaimState)
+	assert.Equal(t, "Normal BlockDeviceCleanUpSkipped CleanUp skipped by the policy of BlockDevice blockdevice-example", <-recorder.Events)
+}
+
+func TestRetryCleanup(t *testing.T) {
+	os.Setenv(cleaner.EnvCleanUpJobRetries, "1")
+	defer os.Unsetenv(cleaner.EnvCleanUpJobRetries)
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: deviceName, Namespace: namespace}}
+
+	bd := &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	createFailedJob := func() {
+		deadline := int64(3600)
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-" + deviceName, Namespace: namespace}}
+		job.Spec.ActiveDeadlineSeconds = &deadline
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue,
+			Reason: "DeadlineExceeded", Message: "Job was active longer than specified deadline"}}
+		require.NoError(t, cl.Create(context.TODO(), job))
+	}
+
+	createFailedJob()
+	result, err := r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, result.RequeueAfter)
+	assert.Equal(t, "Warning BlockDeviceCleanUpRetry CleanUp attempt 1 failed: timed out after 1h0m0s, retrying in 1m0s", <-recorder.Events)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	retry := cleaner.GetRetry(bd)
+	require.NotNil(t, retry)
+	assert.Equal(t, 1, retry.Failures)
+	require.NotNil(t, cleaner.GetResult(bd))
+	assert.Equal(t, "Failed using wipefs: timed out after 1h0m0s", cleaner.GetResult(bd).String())
+	assert.True(t, errors.IsNotFound(cl.Get(context.TODO(), types.NamespacedName{Name: "cleanup-" + deviceName, Namespace: namespace}, &batchv1.Job{})))
+
+	// the cleanup is not retried before the backoff
+	result, err = r.Reconcile(req)
+	require.NoError(t, err)
+	assert.True(t, result.RequeueAfter > 0 && result.RequeueAfter <= time.Minute)
+
+	// the retry failed
+	bd.Annotations[cleaner.RetryAnnotation] = `{"failures":1,"retryAfter":"2021-01-01T00:00:00Z"}`
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	createFailedJob()
+	result, err = r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	assert.Equal(t, "Warning BlockDeviceCleanUpFailed CleanUp failed after 2 attempts: timed out after 1h0m0s", <-recorder.Events)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	cond := bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupFailed)
+	require.NotNil(t, cond)
+	assert.Equal(t, corev1.ConditionTrue, cond.Status)
+	assert.Equal(t, "RetriesExhausted", cond.Reason)
+
+	// the failed cleanup is not retried
+	result, err = r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	assert.Empty(t, recorder.Events)
+	assert.Equal(t, openebsv1alpha1.BlockDeviceReleased, bd.Status.ClaimState)
+}
+
+func TestCleanupQueued(t *testing.T) {
+	os.Setenv(cleaner.EnvCleanUpJobNodeLimit, "1")
+	defer os.Unsetenv(cleaner.EnvCleanUpJobNodeLimit)
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: deviceName, Namespace: namespace}}
+
+	bd := &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	bd.Labels[ndm.KubernetesHostNameLabel] = "node1"
+	bd.Spec.NodeAttributes.NodeName = "node1"
+	bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	// the cleanup of another blockdevice is running on the node
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-blockdevice-other", Namespace: namespace,
+		Labels: map[string]string{ndm.KubernetesHostNameLabel: "node1", cleaner.BDLabel: "blockdevice-other"}}}
+	require.NoError(t, cl.Create(context.TODO(), job))
+	require.NoError(t, cl.Create(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}))
+
+	result, err := r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Equal(t, cleanupProgressInterval, result.RequeueAfter)
+	message := "Cleanup is waiting for 1 running cleanup jobs on node node1, position 1 in the queue"
+	assert.Equal(t, "Normal BlockDeviceCleanUpQueued "+message, <-recorder.Events)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	cond := bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupQueued)
+	require.NotNil(t, cond)
+	assert.Equal(t, message, cond.Message)
+
+	// the queued event is recorded once
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Empty(t, recorder.Events)
+
+	// the job is started once the running job completes, and the condition is removed
+	require.NoError(t, cl.Delete(context.TODO(), job))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Equal(t, "Normal BlockDeviceCleanUpInProgress CleanUp is in progress", <-recorder.Events)
+	require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "cleanup-" + deviceName, Namespace: namespace}, &batchv1.Job{}))
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	assert.Nil(t, bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupQueued))
+}
+
+func TestCleanupResult(t *testing.T) {
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: deviceName, Namespace: namespace}}
+
+	bd := &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	start := metav1.NewTime(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(start.Add(5 * time.Minute))
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cleanup-" + deviceName, Namespace: namespace},
+		Status: batchv1.JobStatus{Succeeded: 1, StartTime: &start, CompletionTime: &end}}
+	require.NoError(t, cl.Create(context.TODO(), job))
+
+	// the result of the completed job is kept on the blockdevice after the job is deleted
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Equal(t, "Normal BlockDeviceReleased CleanUp Completed using wipefs in 5m0s", <-recorder.Events)
+	assert.True(t, errors.IsNotFound(cl.Get(context.TODO(), types.NamespacedName{Name: "cleanup-" + deviceName, Namespace: namespace}, &batchv1.Job{})))
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	assert.Equal(t, openebsv1alpha1.BlockDeviceUnclaimed, bd.Status.ClaimState)
+	result := cleaner.GetResult(bd)
+	require.NotNil(t, result)
+	assert.Equal(t, "Succeeded using wipefs in 5m0s", result.String())
+}
+
+func TestDryRunCleanup(t *testing.T) {
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: deviceName, Namespace: namespace}}
+
+	bd := &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	cleaner.SetClaimPolicy(bd, &openebsv1alpha1.BlockDeviceClaim{ObjectMeta: metav1.ObjectMeta{
+		Name: "bdc-staging", Annotations: map[string]string{cleaner.DryRunAnnotation: "true"}}})
+	bd.Annotations[cleaner.AllowClaimAnnotation] = "dry-run"
+	require.NoError(t, cl.Update(context.TODO(), bd))
+
+	_, err := r.Reconcile(req)
+	require.NoError(t, err)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	assert.Equal(t, openebsv1alpha1.BlockDeviceUnclaimed, bd.Status.ClaimState)
+	assert.Empty(t, bd.Finalizers)
+	// no job is created
+	job := &batchv1.Job{}
+	assert.True(t, errors.IsNotFound(cl.Get(context.TODO(), types.NamespacedName{Name: "cleanup-" + deviceName, Namespace: namespace}, job)))
+	assert.Equal(t, "Normal BlockDeviceCleanUpDryRun CleanUp dry run by the policy of BlockDeviceClaim bdc-staging: "+
+		"would clean dev/disk-fake-path using wipefs, verify none, about 1m0s", <-recorder.Events)
+	assert.Equal(t, "Normal BlockDeviceUnclaimed BD now marked as Unclaimed", <-recorder.Events)
+	result := cleaner.GetResult(bd)
+	require.NotNil(t, result)
+	assert.Equal(t, "DryRun using wipefs in 1m0s", result.String())
+	assert.Contains(t, result.Logs, "wipefs -fa dev/disk-fake-path")
+
+	// an invalid policy keeps the blockdevice released, as the cleanup would fail
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	bd.Annotations = map[string]string{cleaner.DryRunAnnotation: "true", cleaner.MethodAnnotation: "shred"}
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	assert.Equal(t, openebsv1alpha1.BlockDeviceReleased, bd.Status.ClaimState)
+	assert.Contains(t, <-recorder.Events, `CleanUp dry run by the policy of BlockDevice blockdevice-example unsuccessful, due to error: invalid cleanup method "shred"`)
+}
+
+func TestCleanupOutsideWindow(t *testing.T) {
+	cl, s := CreateFakeClient(t)
+	recorder := record.NewFakeRecorder(10)
+	r := &ReconcileBlockDevice{client: cl, scheme: s, recorder: recorder}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: deviceName, Namespace: namespace}}
+
+	bd := &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	bd.Labels[ndm.KubernetesHostNameLabel] = "node1"
+	bd.Spec.NodeAttributes.NodeName = "node1"
+	bd.Finalizers = []string{controllerutil.BlockDeviceFinalizer}
+	bd.Status.ClaimState = openebsv1alpha1.BlockDeviceReleased
+	// the window opens at the start of the next year
+	bd.Annotations = map[string]string{cleaner.WindowAnnotation: "0 0 1 1 * 1m"}
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	require.NoError(t, cl.Create(context.TODO(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}))
+
+	result, err := r.Reconcile(req)
+	require.NoError(t, err)
+	assert.True(t, result.RequeueAfter > cleanupProgressInterval)
+	assert.Contains(t, <-recorder.Events, "Normal BlockDeviceCleanUpQueued Cleanup is outside the cleanup windows of "+
+		"BlockDevice blockdevice-example, the next window opens at "+strconv.Itoa(time.Now().Year()+1)+"-01-01T00:00:00")
+	assert.True(t, errors.IsNotFound(cl.Get(context.TODO(), types.NamespacedName{Name: "cleanup-" + deviceName, Namespace: namespace}, &batchv1.Job{})))
+	bd = &openebsv1alpha1.BlockDevice{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bd))
+	cond := bd.Status.GetCondition(openebsv1alpha1.BlockDeviceCleanupQueued)
+	require.NotNil(t, cond)
+	assert.Equal(t, "OutsideWindow", cond.Reason)
+
+	// the job is started in the window
+	bd.Annotations[cleaner.WindowAnnotation] = "0 0 1 1 * 1m; * * * * * 1h"
+	require.NoError(t, cl.Update(context.TODO(), bd))
+	_, err = r.Reconcile(req)
+	require.NoError(t, err)
+	assert.Equal(t, "Normal BlockDeviceCleanUpInProgress CleanUp is in progress", <-recorder.Events)
+	require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: "cleanup-" + deviceName, Namespace: namespace}, &batchv1.Job{}))
+}
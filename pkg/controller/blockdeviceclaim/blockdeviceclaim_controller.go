@@ -19,10 +19,12 @@ package blockdeviceclaim
 import (
 	"context"
 	"fmt"
+	"time"
 
 	ndm "github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
 	"github.com/openebs/node-disk-manager/db/kubernetes"
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/cleaner"
 	controllerutil "github.com/openebs/node-disk-manager/pkg/controller/util"
 	"github.com/openebs/node-disk-manager/pkg/select/blockdevice"
 	"github.com/openebs/node-disk-manager/pkg/select/verify"
@@ -157,6 +159,7 @@ func (r *ReconcileBlockDeviceClaim) claimDeviceForBlockDeviceClaim(instance *api
 		_, err := verify.GetRequestedCapacity(instance.Spec.Resources.Requests)
 		if err != nil {
 			r.recorder.Eventf(instance, corev1.EventTypeWarning, "InvalidCapacity", "Invalid Capacity requested")
+			ClaimBindingFailuresTotal.WithLabelValues(FailureReasonInvalidCapacity).Inc()
 			//Update deviceClaim CR with pending status
 			instance.Status.Phase = apis.BlockDeviceClaimStatusPending
 			err1 := r.updateClaimStatus(instance.Status.Phase, instance)
@@ -175,6 +178,7 @@ func (r *ReconcileBlockDeviceClaim) claimDeviceForBlockDeviceClaim(instance *api
 	// get list of block devices.
 	bdList, err := r.getListofDevices(selector)
 	if err != nil {
+		ClaimBindingFailuresTotal.WithLabelValues(FailureReasonAPIError).Inc()
 		return err
 	}
 
@@ -182,12 +186,14 @@ func (r *ReconcileBlockDeviceClaim) claimDeviceForBlockDeviceClaim(instance *api
 	if err != nil {
 		klog.Errorf("Error selecting device for %s: %v", instance.Name, err)
 		r.recorder.Eventf(instance, corev1.EventTypeWarning, "SelectionFailed", err.Error())
+		ClaimBindingFailuresTotal.WithLabelValues(selectionFailureReason(err)).Inc()
 		instance.Status.Phase = apis.BlockDeviceClaimStatusPending
 	} else {
 		instance.Spec.BlockDeviceName = selectedDevice.Name
 		instance.Status.Phase = apis.BlockDeviceClaimStatusDone
 		err = r.claimBlockDevice(selectedDevice, instance)
 		if err != nil {
+			ClaimBindingFailuresTotal.WithLabelValues(FailureReasonAPIError).Inc()
 			return err
 		}
 		r.recorder.Eventf(selectedDevice, corev1.EventTypeNormal, "BlockDeviceClaimed", "BlockDevice claimed by %v", instance.Name)
@@ -196,9 +202,13 @@ func (r *ReconcileBlockDeviceClaim) claimDeviceForBlockDeviceClaim(instance *api
 
 	err = r.updateClaimStatus(instance.Status.Phase, instance)
 	if err != nil {
+		ClaimBindingFailuresTotal.WithLabelValues(FailureReasonAPIError).Inc()
 		return err
 	}
 
+	if instance.Status.Phase == apis.BlockDeviceClaimStatusDone {
+		observeClaimBound(instance, config, time.Now())
+	}
 	return nil
 }
 
@@ -310,6 +320,8 @@ func (r *ReconcileBlockDeviceClaim) releaseClaimedBlockDevice(
 	dvr := claimedBd.DeepCopy()
 	dvr.Spec.ClaimRef = nil
 	dvr.Status.ClaimState = apis.BlockDeviceReleased
+	// the claim is removed before the cleanup, so its cleanup policy is kept on the blockdevice
+	cleaner.SetClaimPolicy(dvr, instance)
 
 	err = r.client.Update(context.TODO(), dvr)
 	if err != nil {
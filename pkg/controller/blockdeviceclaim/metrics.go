@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdeviceclaim
+
+import (
+	"time"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/select/blockdevice"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// metricsNamespace is the namespace of the claim metrics of the operator
+	metricsNamespace = "ndm"
+
+	// SelectionManual is used for the claims having the name of the blockdevice
+	SelectionManual = "manual"
+	// SelectionAuto is used for the claims in which the blockdevice is selected
+	// by the operator
+	SelectionAuto = "auto"
+
+	// FailureReasonInvalidCapacity is used when the requested capacity is invalid
+	FailureReasonInvalidCapacity = "InvalidCapacity"
+	// FailureReasonNoBlockDevices is used when there are no blockdevices matching
+	// the selector of the claim
+	FailureReasonNoBlockDevices = "NoBlockDevices"
+	// FailureReasonNoMatchingDevices is used when none of the blockdevices match
+	// the criteria of the claim, eg: all of them are claimed or on other nodes
+	FailureReasonNoMatchingDevices = "NoMatchingDevices"
+	// FailureReasonInsufficientCapacity is used when none of the matching
+	// blockdevices have the requested capacity
+	FailureReasonInsufficientCapacity = "InsufficientCapacity"
+	// FailureReasonSelectionFailed is used when the selection failed for any other reason
+	FailureReasonSelectionFailed = "SelectionFailed"
+	// FailureReasonAPIError is used when the blockdevices could not be listed or
+	// the blockdevice or the claim could not be updated
+	FailureReasonAPIError = "APIError"
+)
+
+var (
+	// ClaimBindDuration is the time from the creation of a claim till it is bound
+	// to a blockdevice
+	ClaimBindDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "blockdeviceclaim_bind_duration_seconds",
+			Help:      `Time from the creation of a blockdevice claim till it is bound`,
+			Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600, 21600},
+		},
+		[]string{"selection"},
+	)
+
+	// ClaimBindingFailuresTotal is the no. of attempts to bind a claim that failed.
+	// A pending claim is retried, and each failed attempt is counted.
+	ClaimBindingFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "blockdeviceclaim_binding_failures_total",
+			Help:      `No. of failed attempts to bind a blockdevice claim, by reason`,
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(ClaimBindDuration, ClaimBindingFailuresTotal)
+}
+
+// selection returns whether the blockdevice of the claim is selected manually
+// or by the operator
+func selection(config *blockdevice.Config) string {
+	if config.ManualSelection {
+		return SelectionManual
+	}
+	return SelectionAuto
+}
+
+// selectionFailureReason returns the reason for the error in selecting a blockdevice
+func selectionFailureReason(err error) string {
+	switch err {
+	case blockdevice.ErrNoBlockDevices:
+		return FailureReasonNoBlockDevices
+	case blockdevice.ErrNoMatchingDevices:
+		return FailureReasonNoMatchingDevices
+	case blockdevice.ErrNoMatchingResources:
+		return FailureReasonInsufficientCapacity
+	}
+	return FailureReasonSelectionFailed
+}
+
+// observeClaimBound records the time taken to bind the claim
+func observeClaimBound(bdc *apis.BlockDeviceClaim, config *blockdevice.Config, now time.Time) {
+	ClaimBindDuration.WithLabelValues(selection(config)).
+		Observe(now.Sub(bdc.CreationTimestamp.Time).Seconds())
+}
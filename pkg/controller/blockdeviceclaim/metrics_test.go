@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockdeviceclaim
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/db/kubernetes"
+	openebsv1alpha1 "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"github.com/openebs/node-disk-manager/pkg/select/blockdevice"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestSelectionFailureReason(t *testing.T) {
+	assert.Equal(t, FailureReasonNoBlockDevices, selectionFailureReason(blockdevice.ErrNoBlockDevices))
+	assert.Equal(t, FailureReasonNoMatchingDevices, selectionFailureReason(blockdevice.ErrNoMatchingDevices))
+	assert.Equal(t, FailureReasonInsufficientCapacity, selectionFailureReason(blockdevice.ErrNoMatchingResources))
+	assert.Equal(t, FailureReasonSelectionFailed, selectionFailureReason(errors.New("unknown")))
+}
+
+func TestClaimMetrics(t *testing.T) {
+	ClaimBindDuration.Reset()
+	ClaimBindingFailuresTotal.Reset()
+
+	cl, s := CreateFakeClient()
+	r := &ReconcileBlockDeviceClaim{client: cl, scheme: s, recorder: fakeRecorder}
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{Name: blockDeviceClaimName, Namespace: namespace},
+	}
+
+	bd := GetFakeDeviceObject(deviceName, capacity)
+	bd.Labels[kubernetes.KubernetesHostNameLabel] = fakeHostName
+	require.NoError(t, cl.Create(context.TODO(), bd))
+
+	// the claim requests more than the capacity of the device
+	bdc := GetFakeBlockDeviceClaimObject()
+	bdc.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+	bdc.Spec.Resources.Requests[openebsv1alpha1.ResourceStorage] = resource.MustParse("2048000")
+	require.NoError(t, cl.Create(context.TODO(), bdc))
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(ClaimBindingFailuresTotal.WithLabelValues(FailureReasonInsufficientCapacity)))
+	assert.Equal(t, 0, testutil.CollectAndCount(ClaimBindDuration))
+
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, bdc))
+	bdc.Spec.Resources.Requests[openebsv1alpha1.ResourceStorage] = claimCapacity
+	require.NoError(t, cl.Update(context.TODO(), bdc))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+
+	metric := &dto.Metric{}
+	require.NoError(t, ClaimBindDuration.WithLabelValues(SelectionAuto).(prometheus.Histogram).Write(metric))
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	assert.True(t, metric.GetHistogram().GetSampleSum() >= 60)
+}
@@ -17,14 +17,20 @@ limitations under the License.
 package controller
 
 import (
+	"github.com/openebs/node-disk-manager/pkg/controller/util"
+
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 // AddToManagerFuncs is a list of functions to add all Controllers to the Manager
 var AddToManagerFuncs []func(manager.Manager) error
 
-// AddToManager adds all Controllers to the Manager
+// AddToManager adds all Controllers to the Manager, after adding the indexes
+// of the cache used by them
 func AddToManager(m manager.Manager) error {
+	if err := util.IndexBlockDevicesByNode(m.GetFieldIndexer()); err != nil {
+		return err
+	}
 	for _, f := range AddToManagerFuncs {
 		if err := f(m); err != nil {
 			return err
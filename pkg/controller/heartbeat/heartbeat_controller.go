@@ -0,0 +1,194 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	ndm "github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	controllerutil "github.com/openebs/node-disk-manager/pkg/controller/util"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Add creates a new Heartbeat Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileHeartbeat{client: mgr.GetClient(), recorder: mgr.GetEventRecorderFor("heartbeat-controller")}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("heartbeat-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to the heartbeat leases renewed by the NDM daemons,
+	// the other leases in the cluster are ignored
+	isHeartbeatLease := func(obj interface{ GetLabels() map[string]string }) bool {
+		return obj.GetLabels()[ndm.HeartbeatLeaseLabel] == ndm.TrueString
+	}
+	err = c.Watch(&source.Kind{Type: &coordinationv1.Lease{}}, &handler.EnqueueRequestForObject{},
+		predicate.Funcs{
+			CreateFunc:  func(e event.CreateEvent) bool { return isHeartbeatLease(e.Meta) },
+			UpdateFunc:  func(e event.UpdateEvent) bool { return isHeartbeatLease(e.MetaNew) },
+			DeleteFunc:  func(e event.DeleteEvent) bool { return isHeartbeatLease(e.Meta) },
+			GenericFunc: func(e event.GenericEvent) bool { return isHeartbeatLease(e.Meta) },
+		})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ reconcile.Reconciler = &ReconcileHeartbeat{}
+
+// ReconcileHeartbeat reconciles the heartbeat lease of a NDM daemon
+type ReconcileHeartbeat struct {
+	client   client.Client
+	recorder record.EventRecorder
+	// now is used to get the current time, can be replaced in tests
+	now func() time.Time
+}
+
+// Reconcile checks whether the heartbeat lease has expired. If the lease has expired,
+// the active blockdevices of the node are marked as Unknown, since the daemon is no
+// longer reporting their state. Else the blockdevices marked as Unknown on the expiry
+// of the lease are marked as Active again, and the request is requeued to be checked
+// again when the lease is due to expire.
+func (r *ReconcileHeartbeat) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	if !strings.HasPrefix(request.Name, ndm.HeartbeatLeasePrefix) {
+		return reconcile.Result{}, nil
+	}
+
+	lease := &coordinationv1.Lease{}
+	err := r.client.Get(context.TODO(), request.NamespacedName, lease)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil ||
+		lease.Spec.LeaseDurationSeconds == nil {
+		klog.Warningf("heartbeat lease %s is not initialized", lease.Name)
+		return reconcile.Result{}, nil
+	}
+
+	nodeName := *lease.Spec.HolderIdentity
+	bds, err := controllerutil.ListBlockDevicesOnNode(r.client, nodeName)
+	if err != nil {
+		klog.Errorf("error listing blockdevices of node %s: %v", nodeName, err)
+		return reconcile.Result{}, err
+	}
+
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	if remaining := expiry.Sub(r.currentTime()); remaining > 0 {
+		if err := r.restoreBlockDevices(nodeName, bds); err != nil {
+			return reconcile.Result{}, err
+		}
+		// check again after the lease expires, a renewal of the lease
+		// will also trigger a reconcile
+		return reconcile.Result{RequeueAfter: remaining + time.Second}, nil
+	}
+
+	for i := range bds {
+		bd := &bds[i]
+		if bd.Status.State != ndm.NDMActive {
+			continue
+		}
+		bd.Status.State = ndm.NDMUnknown
+		if bd.Annotations == nil {
+			bd.Annotations = make(map[string]string)
+		}
+		bd.Annotations[ndm.HeartbeatExpiredAnnotation] = expiry.UTC().Format(time.RFC3339)
+		if err := r.client.Update(context.TODO(), bd); err != nil {
+			klog.Errorf("error marking %s as Unknown: %v", bd.Name, err)
+			return reconcile.Result{}, err
+		}
+		r.recorder.Eventf(bd, corev1.EventTypeWarning, "HeartbeatExpired",
+			"NDM on node %s has not reported since %s, BD marked Unknown", nodeName, lease.Spec.RenewTime.String())
+		klog.Infof("eventcode=%s msg=%s rname=%v",
+			"ndm.blockdevice.unknown.success", "Heartbeat expired, marked blockdevice as Unknown", bd.Name)
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// restoreBlockDevices marks the blockdevices which were marked as Unknown on the
+// expiry of the heartbeat lease as Active again, since the daemon is reporting
+// their state again. Only the blockdevices which still have the annotation and
+// are still Unknown are restored. The daemon removes the annotation when the
+// device of a blockdevice is removed, so that the renewal of the lease does not
+// make the blockdevice of a removed device Active. The blockdevices whose state
+// was changed meanwhile are left as is, and only the annotation is removed.
+func (r *ReconcileHeartbeat) restoreBlockDevices(nodeName string, bds []apis.BlockDevice) error {
+	for i := range bds {
+		bd := &bds[i]
+		if _, ok := bd.Annotations[ndm.HeartbeatExpiredAnnotation]; !ok {
+			continue
+		}
+		delete(bd.Annotations, ndm.HeartbeatExpiredAnnotation)
+		restored := bd.Status.State == ndm.NDMUnknown
+		if restored {
+			bd.Status.State = ndm.NDMActive
+		}
+		if err := r.client.Update(context.TODO(), bd); err != nil {
+			klog.Errorf("error marking %s as Active: %v", bd.Name, err)
+			return err
+		}
+		if !restored {
+			continue
+		}
+		r.recorder.Eventf(bd, corev1.EventTypeNormal, "HeartbeatResumed",
+			"NDM on node %s is reporting again, BD marked Active", nodeName)
+		klog.Infof("eventcode=%s msg=%s rname=%v",
+			"ndm.blockdevice.active.success", "Heartbeat resumed, marked blockdevice as Active", bd.Name)
+	}
+	return nil
+}
+
+func (r *ReconcileHeartbeat) currentTime() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package heartbeat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ndm "github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileHeartbeat(t *testing.T) {
+	nodeName := "fake-node"
+	renewTime := metav1.NewMicroTime(time.Now())
+	duration := int32(40)
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ndm.GetHeartbeatLeaseName(nodeName),
+			Namespace: "openebs",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &nodeName,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renewTime,
+		},
+	}
+	bd := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bd-1",
+			Namespace: "openebs",
+			Labels:    map[string]string{ndm.NDMManagedKey: ndm.TrueString},
+		},
+		Spec: apis.DeviceSpec{
+			NodeAttributes: apis.NodeAttribute{NodeName: nodeName},
+		},
+		Status: apis.DeviceStatus{
+			ClaimState: apis.BlockDeviceUnclaimed,
+			State:      ndm.NDMActive,
+		},
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{}, &apis.BlockDeviceList{})
+	now := time.Now()
+	r := &ReconcileHeartbeat{
+		client:   fake.NewFakeClientWithScheme(s, lease, bd),
+		recorder: record.NewFakeRecorder(50),
+		now:      func() time.Time { return now },
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: lease.Name, Namespace: lease.Namespace}}
+
+	// lease is valid, the request is requeued
+	res, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.True(t, res.RequeueAfter > 0)
+	got := &apis.BlockDevice{}
+	assert.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "bd-1", Namespace: "openebs"}, got))
+	assert.Equal(t, ndm.NDMActive, string(got.Status.State))
+
+	// lease has expired, BD is marked unknown
+	now = now.Add(time.Minute)
+	res, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), res.RequeueAfter)
+	assert.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "bd-1", Namespace: "openebs"}, got))
+	assert.Equal(t, ndm.NDMUnknown, string(got.Status.State))
+
+	// lease is renewed, BD is marked active again
+	renewed := &coordinationv1.Lease{}
+	assert.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, renewed))
+	renewTime = metav1.NewMicroTime(now)
+	renewed.Spec.RenewTime = &renewTime
+	assert.NoError(t, r.client.Update(context.TODO(), renewed))
+	res, err = r.Reconcile(req)
+	assert.NoError(t, err)
+	assert.True(t, res.RequeueAfter > 0)
+	got = &apis.BlockDevice{}
+	assert.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "bd-1", Namespace: "openebs"}, got))
+	assert.Equal(t, ndm.NDMActive, string(got.Status.State))
+	assert.NotContains(t, got.Annotations, ndm.HeartbeatExpiredAnnotation)
+}
+
+func TestReconcileHeartbeatKeepsUnknown(t *testing.T) {
+	nodeName := "fake-node"
+	renewTime := metav1.NewMicroTime(time.Now())
+	duration := int32(40)
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ndm.GetHeartbeatLeaseName(nodeName),
+			Namespace: "openebs",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &nodeName,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renewTime,
+		},
+	}
+	// the BD was marked Unknown by the daemon, and not on the expiry of the lease
+	bd := &apis.BlockDevice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "bd-1",
+			Namespace: "openebs",
+			Labels:    map[string]string{ndm.NDMManagedKey: ndm.TrueString},
+		},
+		Spec: apis.DeviceSpec{
+			NodeAttributes: apis.NodeAttribute{NodeName: nodeName},
+		},
+		Status: apis.DeviceStatus{
+			ClaimState: apis.BlockDeviceUnclaimed,
+			State:      ndm.NDMUnknown,
+		},
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{}, &apis.BlockDeviceList{})
+	r := &ReconcileHeartbeat{
+		client:   fake.NewFakeClientWithScheme(s, lease, bd),
+		recorder: record.NewFakeRecorder(50),
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: lease.Name, Namespace: lease.Namespace}}
+
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+	got := &apis.BlockDevice{}
+	assert.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: "bd-1", Namespace: "openebs"}, got))
+	assert.Equal(t, ndm.NDMUnknown, string(got.Status.State))
+}
+
+func TestReconcileHeartbeatKeepsRemoved(t *testing.T) {
+	nodeName := "fake-node"
+	now := time.Now()
+	renewTime := metav1.NewMicroTime(now)
+	duration := int32(40)
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ndm.GetHeartbeatLeaseName(nodeName),
+			Namespace: "openebs",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &nodeName,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renewTime,
+		},
+	}
+	objects := []runtime.Object{lease}
+	for _, name := range []string{"bd-1", "bd-2", "bd-3"} {
+		objects = append(objects, &apis.BlockDevice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "openebs",
+				Labels:    map[string]string{ndm.NDMManagedKey: ndm.TrueString},
+			},
+			Spec: apis.DeviceSpec{
+				NodeAttributes: apis.NodeAttribute{NodeName: nodeName},
+			},
+			Status: apis.DeviceStatus{
+				ClaimState: apis.BlockDeviceUnclaimed,
+				State:      ndm.NDMActive,
+			},
+		})
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{}, &apis.BlockDeviceList{})
+	r := &ReconcileHeartbeat{
+		client:   fake.NewFakeClientWithScheme(s, objects...),
+		recorder: record.NewFakeRecorder(50),
+		now:      func() time.Time { return now },
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Name: lease.Name, Namespace: lease.Namespace}}
+	getBlockDevice := func(name string) *apis.BlockDevice {
+		bd := &apis.BlockDevice{}
+		assert.NoError(t, r.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "openebs"}, bd))
+		return bd
+	}
+
+	// lease has expired, the BDs are marked unknown
+	now = now.Add(time.Minute)
+	_, err := r.Reconcile(req)
+	assert.NoError(t, err)
+
+	// the devices of bd-2 and bd-3 are removed while the node is not reporting,
+	// bd-2 is made Inactive at the end of the removal grace period, and bd-3 is
+	// in the grace period. bd-2 still has the annotation, as set before the
+	// daemon removed it.
+	bd := getBlockDevice("bd-2")
+	bd.Status.State = ndm.NDMInactive
+	assert.NoError(t, r.client.Update(context.TODO(), bd))
+	bd = getBlockDevice("bd-3")
+	delete(bd.Annotations, ndm.HeartbeatExpiredAnnotation)
+	assert.NoError(t, r.client.Update(context.TODO(), bd))
+
+	// lease is renewed, only the BD which is still Unknown with the annotation is restored
+	renewed := &coordinationv1.Lease{}
+	assert.NoError(t, r.client.Get(context.TODO(), req.NamespacedName, renewed))
+	renewTime = metav1.NewMicroTime(now)
+	renewed.Spec.RenewTime = &renewTime
+	assert.NoError(t, r.client.Update(context.TODO(), renewed))
+	_, err = r.Reconcile(req)
+	assert.NoError(t, err)
+
+	bd = getBlockDevice("bd-1")
+	assert.Equal(t, ndm.NDMActive, string(bd.Status.State))
+	assert.NotContains(t, bd.Annotations, ndm.HeartbeatExpiredAnnotation)
+	bd = getBlockDevice("bd-2")
+	assert.Equal(t, ndm.NDMInactive, string(bd.Status.State))
+	assert.NotContains(t, bd.Annotations, ndm.HeartbeatExpiredAnnotation)
+	bd = getBlockDevice("bd-3")
+	assert.Equal(t, ndm.NDMUnknown, string(bd.Status.State))
+}
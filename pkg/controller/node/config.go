@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"os"
+	"time"
+
+	"k8s.io/klog"
+)
+
+const (
+	// EnvNodeGCPolicy is the environment variable used to configure the action
+	// taken on the blockdevices of a node that is removed from the cluster.
+	EnvNodeGCPolicy = "NODE_GC_POLICY"
+	// EnvNodeGCGracePeriod is the environment variable used to configure the
+	// time to wait after a node is removed, before acting on its blockdevices.
+	EnvNodeGCGracePeriod = "NODE_GC_GRACE_PERIOD"
+)
+
+// GCPolicy is the action to be taken on blockdevices of removed nodes
+type GCPolicy string
+
+const (
+	// GCPolicyNone leaves the blockdevices of removed nodes untouched
+	GCPolicyNone GCPolicy = "none"
+	// GCPolicyDeactivate marks the blockdevices of removed nodes as Inactive
+	GCPolicyDeactivate GCPolicy = "deactivate"
+	// GCPolicyDelete deletes the unclaimed blockdevices of removed nodes. Claimed
+	// blockdevices are only deactivated.
+	GCPolicyDelete GCPolicy = "delete"
+)
+
+var (
+	defaultGCPolicy      = GCPolicyDeactivate
+	defaultGCGracePeriod = 5 * time.Minute
+)
+
+// getGCPolicy gets the policy to be used for blockdevices of removed nodes
+func getGCPolicy() GCPolicy {
+	policy := GCPolicy(os.Getenv(EnvNodeGCPolicy))
+	switch policy {
+	case GCPolicyNone, GCPolicyDeactivate, GCPolicyDelete:
+		return policy
+	case "":
+		return defaultGCPolicy
+	default:
+		klog.Warningf("invalid %s: %s, using %s", EnvNodeGCPolicy, policy, defaultGCPolicy)
+		return defaultGCPolicy
+	}
+}
+
+// getGCGracePeriod gets the time to wait before acting on blockdevices of a removed node
+func getGCGracePeriod() time.Duration {
+	val, ok := os.LookupEnv(EnvNodeGCGracePeriod)
+	if !ok {
+		return defaultGCGracePeriod
+	}
+	period, err := time.ParseDuration(val)
+	if err != nil || period < 0 {
+		klog.Warningf("invalid %s: %s, using %v", EnvNodeGCGracePeriod, val, defaultGCGracePeriod)
+		return defaultGCGracePeriod
+	}
+	return period
+}
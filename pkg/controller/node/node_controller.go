@@ -0,0 +1,245 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"context"
+	"time"
+
+	ndm "github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	controllerutil "github.com/openebs/node-disk-manager/pkg/controller/util"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// NodeRemovedAnnotation is the annotation added on blockdevices when the
+	// node to which they belong is found to be removed from the cluster. The
+	// value is the time at which the removal was detected.
+	NodeRemovedAnnotation = "internal.openebs.io/node-removed-at"
+)
+
+// Add creates a new Node Controller and adds it to the Manager. The Manager will set fields on the Controller
+// and Start it when the Manager is Started.
+func Add(mgr manager.Manager) error {
+	return add(mgr, newReconciler(mgr))
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &ReconcileNode{
+		client:      mgr.GetClient(),
+		recorder:    mgr.GetEventRecorderFor("node-controller"),
+		policy:      getGCPolicy(),
+		gracePeriod: getGCGracePeriod(),
+	}
+}
+
+// add adds a new Controller to mgr with r as the reconcile.Reconciler
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	// Create a new controller
+	c, err := controller.New("node-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to Nodes
+	err = c.Watch(&source.Kind{Type: &corev1.Node{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to BlockDevices and enqueue the node to which they belong.
+	// This makes sure that blockdevices of nodes removed while the operator
+	// was not running are also handled.
+	err = c.Watch(&source.Kind{Type: &apis.BlockDevice{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(obj handler.MapObject) []reconcile.Request {
+			bd, ok := obj.Object.(*apis.BlockDevice)
+			if !ok {
+				return nil
+			}
+			nodeName := controllerutil.GetNodeNameOfBlockDevice(bd)
+			if len(nodeName) == 0 {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: nodeName}}}
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ reconcile.Reconciler = &ReconcileNode{}
+
+// ReconcileNode reconciles the blockdevices of a Node
+type ReconcileNode struct {
+	client   client.Client
+	recorder record.EventRecorder
+	// policy is the action to be taken on the blockdevices of a removed node
+	policy GCPolicy
+	// gracePeriod is the time to wait after a node is removed before
+	// taking action on its blockdevices
+	gracePeriod time.Duration
+	// now is used to get the current time, can be replaced in tests
+	now func() time.Time
+}
+
+// Reconcile checks whether the node still exists in the cluster. If the node has been removed,
+// its blockdevices are deactivated or deleted based on the configured policy, once
+// the grace period has expired.
+func (r *ReconcileNode) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	if r.policy == GCPolicyNone {
+		return reconcile.Result{}, nil
+	}
+
+	node := &corev1.Node{}
+	err := r.client.Get(context.TODO(), types.NamespacedName{Name: request.Name}, node)
+	if err != nil && !errors.IsNotFound(err) {
+		return reconcile.Result{}, err
+	}
+	nodeRemoved := errors.IsNotFound(err)
+
+	bds, err := controllerutil.ListBlockDevicesOnNode(r.client, request.Name)
+	if err != nil {
+		klog.Errorf("error listing blockdevices of node %s: %v", request.Name, err)
+		return reconcile.Result{}, err
+	}
+
+	if !nodeRemoved {
+		// the node may have been added back to the cluster
+		return reconcile.Result{}, r.clearNodeRemovedAnnotation(bds)
+	}
+
+	var requeueAfter time.Duration
+	for i := range bds {
+		bd := &bds[i]
+		if bd.Status.State == ndm.NDMInactive && r.policy == GCPolicyDeactivate {
+			continue
+		}
+		removedAt, ok := getNodeRemovedTime(bd)
+		if !ok {
+			removedAt = r.currentTime()
+			if err := r.setNodeRemovedAnnotation(bd, removedAt); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		if remaining := removedAt.Add(r.gracePeriod).Sub(r.currentTime()); remaining > 0 {
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+		if err := r.collectBlockDevice(bd); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// collectBlockDevice performs the configured action on the blockdevice of a removed node
+func (r *ReconcileNode) collectBlockDevice(bd *apis.BlockDevice) error {
+	if r.policy == GCPolicyDelete && bd.Status.ClaimState == apis.BlockDeviceUnclaimed {
+		if err := r.client.Delete(context.TODO(), bd); err != nil && !errors.IsNotFound(err) {
+			klog.Errorf("error deleting %s of removed node: %v", bd.Name, err)
+			return err
+		}
+		klog.Infof("eventcode=%s msg=%s rname=%v",
+			"ndm.blockdevice.gc.success", "Deleted blockdevice of removed node", bd.Name)
+		return nil
+	}
+
+	if bd.Status.State == ndm.NDMInactive {
+		return nil
+	}
+	bd.Status.State = ndm.NDMInactive
+	if err := r.client.Update(context.TODO(), bd); err != nil {
+		klog.Errorf("error deactivating %s of removed node: %v", bd.Name, err)
+		return err
+	}
+	r.recorder.Eventf(bd, corev1.EventTypeWarning, "NodeRemoved", "Node %s removed from cluster, BD marked Inactive",
+		controllerutil.GetNodeNameOfBlockDevice(bd))
+	klog.Infof("eventcode=%s msg=%s rname=%v",
+		"ndm.blockdevice.deactivate.success", "Deactivated blockdevice of removed node", bd.Name)
+	return nil
+}
+
+// setNodeRemovedAnnotation records on the blockdevice the time at which the
+// removal of the node was detected
+func (r *ReconcileNode) setNodeRemovedAnnotation(bd *apis.BlockDevice, removedAt time.Time) error {
+	if bd.Annotations == nil {
+		bd.Annotations = make(map[string]string)
+	}
+	bd.Annotations[NodeRemovedAnnotation] = removedAt.UTC().Format(time.RFC3339)
+	if err := r.client.Update(context.TODO(), bd); err != nil {
+		klog.Errorf("error annotating %s of removed node: %v", bd.Name, err)
+		return err
+	}
+	return nil
+}
+
+// clearNodeRemovedAnnotation removes the node removed annotation from the blockdevices
+func (r *ReconcileNode) clearNodeRemovedAnnotation(bds []apis.BlockDevice) error {
+	for i := range bds {
+		bd := &bds[i]
+		if _, ok := bd.Annotations[NodeRemovedAnnotation]; !ok {
+			continue
+		}
+		delete(bd.Annotations, NodeRemovedAnnotation)
+		if err := r.client.Update(context.TODO(), bd); err != nil {
+			klog.Errorf("error removing annotation %s from %s: %v", NodeRemovedAnnotation, bd.Name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ReconcileNode) currentTime() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// getNodeRemovedTime gets the time at which the node removal was detected
+// from the blockdevice annotation
+func getNodeRemovedTime(bd *apis.BlockDevice) (time.Time, bool) {
+	val, ok := bd.Annotations[NodeRemovedAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	removedAt, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		klog.Warningf("invalid value %s for annotation %s on %s", val, NodeRemovedAnnotation, bd.Name)
+		return time.Time{}, false
+	}
+	return removedAt, true
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ndm "github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	fakeNodeName = "fake-node"
+)
+
+func fakeBlockDevice(name string, claimState apis.DeviceClaimState) *apis.BlockDevice {
+	return &apis.BlockDevice{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       ndm.NDMBlockDeviceKind,
+			APIVersion: ndm.NDMVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				ndm.NDMManagedKey:           ndm.TrueString,
+				ndm.KubernetesHostNameLabel: fakeNodeName,
+			},
+		},
+		Spec: apis.DeviceSpec{
+			NodeAttributes: apis.NodeAttribute{NodeName: fakeNodeName},
+		},
+		Status: apis.DeviceStatus{
+			ClaimState: claimState,
+			State:      ndm.NDMActive,
+		},
+	}
+}
+
+func newFakeReconciler(policy GCPolicy, objs ...runtime.Object) *ReconcileNode {
+	s := scheme.Scheme
+	s.AddKnownTypes(apis.SchemeGroupVersion, &apis.BlockDevice{}, &apis.BlockDeviceList{})
+	return &ReconcileNode{
+		client:      fake.NewFakeClientWithScheme(s, objs...),
+		recorder:    record.NewFakeRecorder(50),
+		policy:      policy,
+		gracePeriod: time.Minute,
+	}
+}
+
+func getBD(t *testing.T, c client.Client, name string) *apis.BlockDevice {
+	bd := &apis.BlockDevice{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name}, bd)
+	if err != nil {
+		t.Fatalf("error getting %s: %v", name, err)
+	}
+	return bd
+}
+
+func TestReconcileRemovedNode(t *testing.T) {
+	tests := map[string]struct {
+		policy        GCPolicy
+		claimState    apis.DeviceClaimState
+		expectDeleted bool
+		expectedState string
+	}{
+		"deactivate policy marks the BD inactive": {
+			policy:        GCPolicyDeactivate,
+			claimState:    apis.BlockDeviceUnclaimed,
+			expectedState: ndm.NDMInactive,
+		},
+		"delete policy deletes unclaimed BD": {
+			policy:        GCPolicyDelete,
+			claimState:    apis.BlockDeviceUnclaimed,
+			expectDeleted: true,
+		},
+		"delete policy only deactivates claimed BD": {
+			policy:        GCPolicyDelete,
+			claimState:    apis.BlockDeviceClaimed,
+			expectedState: ndm.NDMInactive,
+		},
+		"none policy does not touch the BD": {
+			policy:        GCPolicyNone,
+			claimState:    apis.BlockDeviceUnclaimed,
+			expectedState: ndm.NDMActive,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			r := newFakeReconciler(test.policy, fakeBlockDevice("bd-1", test.claimState))
+			r.now = func() time.Time { return now }
+			req := reconcile.Request{NamespacedName: types.NamespacedName{Name: fakeNodeName}}
+
+			// first reconcile only marks the BD, and requeues after grace period
+			res, err := r.Reconcile(req)
+			assert.NoError(t, err)
+			if test.policy != GCPolicyNone {
+				assert.Equal(t, time.Minute, res.RequeueAfter)
+				assert.Equal(t, ndm.NDMActive, string(getBD(t, r.client, "bd-1").Status.State))
+			}
+
+			now = now.Add(2 * time.Minute)
+			_, err = r.Reconcile(req)
+			assert.NoError(t, err)
+
+			bd := &apis.BlockDevice{}
+			err = r.client.Get(context.TODO(), types.NamespacedName{Name: "bd-1"}, bd)
+			if test.expectDeleted {
+				assert.True(t, errors.IsNotFound(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedState, string(bd.Status.State))
+		})
+	}
+}
+
+func TestReconcileExistingNode(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: fakeNodeName}}
+	bd := fakeBlockDevice("bd-1", apis.BlockDeviceUnclaimed)
+	bd.Annotations = map[string]string{NodeRemovedAnnotation: time.Now().UTC().Format(time.RFC3339)}
+	r := newFakeReconciler(GCPolicyDelete, node, bd)
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: fakeNodeName}})
+	assert.NoError(t, err)
+
+	updated := getBD(t, r.client, "bd-1")
+	assert.Equal(t, ndm.NDMActive, string(updated.Status.State))
+	_, ok := updated.Annotations[NodeRemovedAnnotation]
+	assert.False(t, ok)
+}
+
+func TestReconcileRemovedNodeWithHostname(t *testing.T) {
+	// the hostname of the node of the BD is the name of the removed node
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}
+	bd := fakeBlockDevice("bd-1", apis.BlockDeviceUnclaimed)
+	bd.Spec.NodeAttributes.NodeName = "node-2"
+	r := newFakeReconciler(GCPolicyDelete, node, bd)
+	r.gracePeriod = 0
+
+	_, err := r.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: fakeNodeName}})
+	assert.NoError(t, err)
+
+	updated := getBD(t, r.client, "bd-1")
+	assert.Equal(t, ndm.NDMActive, string(updated.Status.State))
+	_, ok := updated.Annotations[NodeRemovedAnnotation]
+	assert.False(t, ok)
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+
+	ndm "github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NodeNameField is the field by which the blockdevices are indexed in the
+// cache of the operator, which is the node name in the blockdevice spec
+const NodeNameField = "spec.nodeAttributes.nodeName"
+
+// IndexBlockDevicesByNode adds the NodeNameField index of the blockdevices to
+// the cache, so that the blockdevices of a node are listed without going over
+// all the blockdevices in the cluster
+func IndexBlockDevicesByNode(indexer client.FieldIndexer) error {
+	return indexer.IndexField(&apis.BlockDevice{}, NodeNameField, func(obj runtime.Object) []string {
+		bd, ok := obj.(*apis.BlockDevice)
+		if !ok || len(bd.Spec.NodeAttributes.NodeName) == 0 {
+			return nil
+		}
+		return []string{bd.Spec.NodeAttributes.NodeName}
+	})
+}
+
+// ListBlockDevicesOnNode lists all the NDM managed blockdevices that belong
+// to the given node, using the NodeNameField index. Only the node name in
+// the blockdevice spec is matched, since the hostname of a node may differ
+// from its name.
+func ListBlockDevicesOnNode(c client.Client, nodeName string) ([]apis.BlockDevice, error) {
+	bdList := &apis.BlockDeviceList{}
+	err := c.List(context.TODO(), bdList,
+		client.MatchingLabels{ndm.NDMManagedKey: ndm.TrueString},
+		client.MatchingFields{NodeNameField: nodeName})
+	if err != nil {
+		return nil, err
+	}
+
+	bds := make([]apis.BlockDevice, 0)
+	for _, bd := range bdList.Items {
+		if GetNodeNameOfBlockDevice(&bd) == nodeName {
+			bds = append(bds, bd)
+		}
+	}
+	return bds, nil
+}
+
+// GetNodeNameOfBlockDevice returns the name of the node to which the
+// blockdevice is attached, which is empty if the blockdevice does not have
+// the node name in its spec
+func GetNodeNameOfBlockDevice(bd *apis.BlockDevice) string {
+	return bd.Spec.NodeAttributes.NodeName
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package diskstats reads the IO statistics of the block devices from
+// /proc/diskstats and computes iostat like rates from them
+package diskstats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sectorSize is the size of a sector in /proc/diskstats, irrespective of the
+// sector size of the device
+const sectorSize = 512
+
+// procDiskStatsPath is the path of the diskstats file
+var procDiskStatsPath = "/proc/diskstats"
+
+// Stats are the cumulative IO statistics of a block device. The counters are
+// reset when the node reboots.
+type Stats struct {
+	ReadsCompleted  uint64
+	ReadsMerged     uint64
+	SectorsRead     uint64
+	ReadTimeMs      uint64
+	WritesCompleted uint64
+	WritesMerged    uint64
+	SectorsWritten  uint64
+	WriteTimeMs     uint64
+	IOsInProgress   uint64
+	IOTimeMs        uint64
+	// WeightedIOTimeMs is the time spent doing IOs, weighted by the no. of IOs in progress
+	WeightedIOTimeMs uint64
+}
+
+// Rates are the IO statistics of a block device over an interval
+type Rates struct {
+	ReadIOPS            float64
+	WriteIOPS           float64
+	ReadBytesPerSecond  float64
+	WriteBytesPerSecond float64
+	// QueueDepth is the average no. of IOs queued to the device
+	QueueDepth float64
+	// ReadAwait and WriteAwait are the average time taken by an IO, including the time in the queue
+	ReadAwait  time.Duration
+	WriteAwait time.Duration
+	// Utilization is the fraction of the interval during which the device was busy
+	Utilization float64
+	// IOsInProgress is the no. of IOs in progress at the end of the interval
+	IOsInProgress uint64
+}
+
+// Read reads the statistics of all the block devices, keyed by the device name
+func Read() (map[string]Stats, error) {
+	f, err := os.Open(procDiskStatsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse parses the statistics in the diskstats format, keyed by the device name
+func Parse(r io.Reader) (map[string]Stats, error) {
+	stats := make(map[string]Stats)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// major, minor, name and the first 11 counters, present in all kernels
+		if len(fields) < 14 {
+			continue
+		}
+		values := make([]uint64, 11)
+		for i := range values {
+			value, err := strconv.ParseUint(fields[i+3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid diskstats of %s: %v", fields[2], err)
+			}
+			values[i] = value
+		}
+		stats[fields[2]] = Stats{
+			ReadsCompleted:   values[0],
+			ReadsMerged:      values[1],
+			SectorsRead:      values[2],
+			ReadTimeMs:       values[3],
+			WritesCompleted:  values[4],
+			WritesMerged:     values[5],
+			SectorsWritten:   values[6],
+			WriteTimeMs:      values[7],
+			IOsInProgress:    values[8],
+			IOTimeMs:         values[9],
+			WeightedIOTimeMs: values[10],
+		}
+	}
+	return stats, scanner.Err()
+}
+
+// delta returns the increase of the counter. A counter which went back, because
+// it wrapped or the device was attached again, is treated as no increase.
+func delta(prev, cur uint64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur - prev)
+}
+
+// ComputeRates computes the rates from the statistics sampled at the start and
+// the end of the interval
+func ComputeRates(prev, cur Stats, interval time.Duration) Rates {
+	rates := Rates{IOsInProgress: cur.IOsInProgress}
+	seconds := interval.Seconds()
+	if seconds <= 0 {
+		return rates
+	}
+	reads := delta(prev.ReadsCompleted, cur.ReadsCompleted)
+	writes := delta(prev.WritesCompleted, cur.WritesCompleted)
+	rates.ReadIOPS = reads / seconds
+	rates.WriteIOPS = writes / seconds
+	rates.ReadBytesPerSecond = delta(prev.SectorsRead, cur.SectorsRead) * sectorSize / seconds
+	rates.WriteBytesPerSecond = delta(prev.SectorsWritten, cur.SectorsWritten) * sectorSize / seconds
+	intervalMs := seconds * 1000
+	rates.QueueDepth = delta(prev.WeightedIOTimeMs, cur.WeightedIOTimeMs) / intervalMs
+	rates.Utilization = delta(prev.IOTimeMs, cur.IOTimeMs) / intervalMs
+	if rates.Utilization > 1 {
+		rates.Utilization = 1
+	}
+	if reads > 0 {
+		rates.ReadAwait = time.Duration(delta(prev.ReadTimeMs, cur.ReadTimeMs) / reads * float64(time.Millisecond))
+	}
+	if writes > 0 {
+		rates.WriteAwait = time.Duration(delta(prev.WriteTimeMs, cur.WriteTimeMs) / writes * float64(time.Millisecond))
+	}
+	return rates
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskstats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	data := `   8       0 sda 1000 10 80000 2000 500 5 40000 3000 2 4000 5000 0 0 0 0 100 50
+   8       1 sda1 900 10 72000 1800 400 5 32000 2500 0 3500 4300
+ 259       0 nvme0n1 10 0 80 1 20 0 160 2 0 3 3
+   7       0 loop0 1 2
+`
+	stats, err := Parse(strings.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(stats))
+	assert.Equal(t, Stats{
+		ReadsCompleted:   1000,
+		ReadsMerged:      10,
+		SectorsRead:      80000,
+		ReadTimeMs:       2000,
+		WritesCompleted:  500,
+		WritesMerged:     5,
+		SectorsWritten:   40000,
+		WriteTimeMs:      3000,
+		IOsInProgress:    2,
+		IOTimeMs:         4000,
+		WeightedIOTimeMs: 5000,
+	}, stats["sda"])
+	assert.Equal(t, uint64(20), stats["nvme0n1"].WritesCompleted)
+
+	_, err = Parse(strings.NewReader("8 0 sda 1 2 x 4 5 6 7 8 9 10 11\n"))
+	assert.Error(t, err)
+}
+
+func TestComputeRates(t *testing.T) {
+	prev := Stats{
+		ReadsCompleted: 1000, SectorsRead: 80000, ReadTimeMs: 2000,
+		WritesCompleted: 500, SectorsWritten: 40000, WriteTimeMs: 3000,
+		IOTimeMs: 4000, WeightedIOTimeMs: 5000,
+	}
+	cur := Stats{
+		ReadsCompleted: 2000, SectorsRead: 100480, ReadTimeMs: 4000,
+		WritesCompleted: 1000, SectorsWritten: 60480, WriteTimeMs: 5500,
+		IOsInProgress: 3, IOTimeMs: 9000, WeightedIOTimeMs: 25000,
+	}
+	rates := ComputeRates(prev, cur, 10*time.Second)
+	assert.Equal(t, Rates{
+		ReadIOPS:            100,
+		WriteIOPS:           50,
+		ReadBytesPerSecond:  1048576,
+		WriteBytesPerSecond: 1048576,
+		QueueDepth:          2,
+		ReadAwait:           2 * time.Millisecond,
+		WriteAwait:          5 * time.Millisecond,
+		Utilization:         0.5,
+		IOsInProgress:       3,
+	}, rates)
+
+	// counters reset, eg: when the device is attached again
+	rates = ComputeRates(cur, prev, 10*time.Second)
+	assert.Equal(t, Rates{}, rates)
+}
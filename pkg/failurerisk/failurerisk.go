@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package failurerisk scores the risk of failure of the devices from the SMART
+// attributes that are known to be reported before a disk fails.
+package failurerisk
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/openebs/node-disk-manager/pkg/smart"
+	"github.com/openebs/node-disk-manager/pkg/util"
+)
+
+// The indicators of the failure of the device, from the raw values of the
+// ATA SMART attributes
+const (
+	ReallocatedSectors    = "reallocated_sectors"
+	ReportedUncorrectable = "reported_uncorrectable"
+	CommandTimeouts       = "command_timeouts"
+	PendingSectors        = "pending_sectors"
+	OfflineUncorrectable  = "offline_uncorrectable"
+	CRCErrors             = "crc_errors"
+)
+
+// attributeIndicators are the indicators keyed by the id of the SMART attribute
+var attributeIndicators = map[uint8]string{
+	5:   ReallocatedSectors,
+	187: ReportedUncorrectable,
+	188: CommandTimeouts,
+	197: PendingSectors,
+	198: OfflineUncorrectable,
+	199: CRCErrors,
+}
+
+// Weights are the risk of failure of a device on which the indicator is not
+// zero, keyed by the indicator. Each weight is between 0 and 1.
+type Weights map[string]float64
+
+// DefaultWeights are the weights used if none are configured. The media errors
+// are weighed higher than the interface errors, which are often caused by the
+// cabling rather than the disk.
+var DefaultWeights = Weights{
+	ReallocatedSectors:    0.3,
+	ReportedUncorrectable: 0.3,
+	CommandTimeouts:       0.1,
+	PendingSectors:        0.3,
+	OfflineUncorrectable:  0.3,
+	CRCErrors:             0.1,
+}
+
+// Indicators returns the indicators of the failure from the SMART attributes. The
+// indicators whose attributes are not reported by the device are not set.
+func Indicators(attributes map[uint8]smart.SMARTAttribute) map[string]uint64 {
+	indicators := make(map[string]uint64)
+	for id, indicator := range attributeIndicators {
+		if attribute, ok := attributes[id]; ok {
+			indicators[indicator] = attribute.Raw
+		}
+	}
+	return indicators
+}
+
+// ParseWeights parses the weights given as flags, eg: pending_sectors=0.5. The
+// default weights are used if none are given.
+func ParseWeights(values map[string]string) (Weights, error) {
+	if len(values) == 0 {
+		return DefaultWeights, nil
+	}
+	weights := make(Weights)
+	for indicator, value := range values {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight %q of %s: %v", value, indicator, err)
+		}
+		weights[indicator] = weight
+	}
+	return weights, weights.Validate()
+}
+
+// Validate checks that the indicators are known and the weights are between 0 and 1
+func (w Weights) Validate() error {
+	known := KnownIndicators()
+	for indicator, weight := range w {
+		if !util.Contains(known, indicator) {
+			return fmt.Errorf("unknown indicator %q, must be one of %v", indicator, known)
+		}
+		if weight < 0 || weight > 1 {
+			return fmt.Errorf("invalid weight %v of %s, must be between 0 and 1", weight, indicator)
+		}
+	}
+	return nil
+}
+
+// Score returns the risk of failure of the device between 0 and 1. Like the
+// Backblaze heuristics, an indicator contributes its weight if its count is not
+// zero, and the weights are combined as the probability of any of them
+// predicting the failure.
+func (w Weights) Score(indicators map[string]uint64) float64 {
+	survival := 1.0
+	for indicator, count := range indicators {
+		if count != 0 {
+			survival *= 1 - w[indicator]
+		}
+	}
+	return 1 - survival
+}
+
+// KnownIndicators returns the names of the indicators in sorted order
+func KnownIndicators() []string {
+	indicators := make([]string, 0, len(attributeIndicators))
+	for _, indicator := range attributeIndicators {
+		indicators = append(indicators, indicator)
+	}
+	sort.Strings(indicators)
+	return indicators
+}
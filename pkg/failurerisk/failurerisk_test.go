@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failurerisk
+
+import (
+	"testing"
+
+	"github.com/openebs/node-disk-manager/pkg/smart"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smartData returns the SMART data with the given raw values of the attributes
+func smartData(raw map[uint8]uint64) []byte {
+	buf := make([]byte, 512)
+	offset := 2
+	for id, value := range raw {
+		entry := buf[offset : offset+12]
+		entry[0] = id
+		entry[3], entry[4] = 100, 100
+		for i := 0; i < 6; i++ {
+			entry[5+i] = byte(value >> (8 * i))
+		}
+		offset += 12
+	}
+	return buf
+}
+
+func TestIndicators(t *testing.T) {
+	attributes := smart.ParseSMARTAttributes(smartData(map[uint8]uint64{
+		5:   8,
+		9:   20000, // power on hours, not an indicator
+		197: 1 << 40,
+		199: 0,
+	}))
+	assert.Equal(t, uint64(20000), attributes[9].Raw)
+	assert.Equal(t, map[string]uint64{
+		ReallocatedSectors: 8,
+		PendingSectors:     1 << 40,
+		CRCErrors:          0,
+	}, Indicators(attributes))
+}
+
+func TestScore(t *testing.T) {
+	weights := Weights{ReallocatedSectors: 0.5, PendingSectors: 0.5, CRCErrors: 0.25}
+
+	assert.Equal(t, float64(0), weights.Score(nil))
+	assert.Equal(t, float64(0), weights.Score(map[string]uint64{ReallocatedSectors: 0}))
+	assert.Equal(t, 0.5, weights.Score(map[string]uint64{ReallocatedSectors: 100}))
+	assert.Equal(t, 0.75, weights.Score(map[string]uint64{ReallocatedSectors: 1, PendingSectors: 1}))
+	assert.Equal(t, 0.8125, weights.Score(map[string]uint64{
+		ReallocatedSectors: 1, PendingSectors: 1, CRCErrors: 1,
+	}))
+	// an indicator without a weight does not contribute to the score
+	assert.Equal(t, float64(0), weights.Score(map[string]uint64{CommandTimeouts: 3}))
+}
+
+func TestParseWeights(t *testing.T) {
+	weights, err := ParseWeights(nil)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultWeights, weights)
+	require.NoError(t, DefaultWeights.Validate())
+
+	weights, err = ParseWeights(map[string]string{PendingSectors: "0.6"})
+	require.NoError(t, err)
+	assert.Equal(t, Weights{PendingSectors: 0.6}, weights)
+
+	for _, values := range []map[string]string{
+		{PendingSectors: "high"},
+		{PendingSectors: "1.5"},
+		{"spin_retries": "0.1"},
+	} {
+		_, err = ParseWeights(values)
+		assert.Error(t, err, values)
+	}
+}
@@ -26,6 +26,7 @@ package features
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/openebs/node-disk-manager/pkg/util"
@@ -43,6 +44,12 @@ const (
 	GPTBasedUUID Feature = "GPTBasedUUID"
 	// APIService feature flag starts the GRPC server which provides functionality to manage block devices
 	APIService Feature = "APIService"
+	// UUIDMigration feature flag is used to migrate blockdevices created with the legacy
+	// UUID algorithm to the GPT based UUID algorithm. Used only if GPTBasedUUID is enabled.
+	UUIDMigration Feature = "UUIDMigration"
+	// NBDDiscovery feature flag is used to discover network block devices. A blockdevice
+	// is created for an nbd while it is connected, and is made inactive on disconnect.
+	NBDDiscovery Feature = "NBDDiscovery"
 )
 
 // supportedFeatures is the list of supported features. This is used while parsing the
@@ -50,12 +57,34 @@ const (
 var supportedFeatures = []Feature{
 	GPTBasedUUID,
 	APIService,
+	UUIDMigration,
+	NBDDiscovery,
+}
+
+// prerelease is the maturity level of a feature
+type prerelease string
+
+const (
+	// Alpha features are experimental and disabled by default
+	Alpha = prerelease("ALPHA")
+	// Beta features are well tested, and may be enabled by default
+	Beta = prerelease("BETA")
+	// GA features are stable and enabled by default
+	GA = prerelease("")
+)
+
+// featureSpec is the default state and maturity level of a feature
+type featureSpec struct {
+	Default    bool
+	PreRelease prerelease
 }
 
 // defaultFeatureGates is the default features that will be applied to the application
-var defaultFeatureGates = map[Feature]bool{
-	GPTBasedUUID: false,
-	APIService:   false,
+var defaultFeatureGates = map[Feature]featureSpec{
+	GPTBasedUUID:  {Default: false, PreRelease: Alpha},
+	APIService:    {Default: false, PreRelease: Alpha},
+	UUIDMigration: {Default: false, PreRelease: Alpha},
+	NBDDiscovery:  {Default: false, PreRelease: Alpha},
 }
 
 // featureFlag is a map representing the flag and its state
@@ -71,7 +100,7 @@ func NewFeatureGate() featureFlag {
 
 	// set the default feature gates
 	for k, v := range defaultFeatureGates {
-		fg[k] = v
+		fg[k] = v.Default
 	}
 
 	return fg
@@ -90,6 +119,10 @@ func (fg featureFlag) SetFeatureFlag(features []string) error {
 	}
 	// iterate through each feature and set its state onto the featureFlag map
 	for _, feature := range features {
+		feature = strings.TrimSpace(feature)
+		if len(feature) == 0 {
+			continue
+		}
 		var f Feature
 		// by default if a feature gate is provided, it is enabled
 		isEnabled := true
@@ -97,11 +130,11 @@ func (fg featureFlag) SetFeatureFlag(features []string) error {
 		// MyFeature=false, the string need to be parsed and
 		// corresponding state to be set on the feature
 		s := strings.Split(feature, "=")
-		f = Feature(s[0])
+		f = Feature(strings.TrimSpace(s[0]))
 		// only if length after splitting =2, we need to check whether the
 		// feature is enabled or disabled
 		if len(s) == 2 {
-			isEnabled = util.CheckTruthy(s[1])
+			isEnabled = util.CheckTruthy(strings.TrimSpace(s[1]))
 		} else if len(s) > 2 {
 			// if length > 2 , there is some error in the format specified
 			return fmt.Errorf("incorrect format. cannot parse feature %s", feature)
@@ -116,3 +149,30 @@ func (fg featureFlag) SetFeatureFlag(features []string) error {
 	}
 	return nil
 }
+
+// String returns the state of all the features in the feature gate, in the
+// same format as that of the feature gates flag
+func (fg featureFlag) String() string {
+	pairs := make([]string, 0, len(fg))
+	for f, isEnabled := range fg {
+		pairs = append(pairs, fmt.Sprintf("%s=%t", f, isEnabled))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// KnownFeatures returns the description of the supported features, which can be
+// used in the help text of the feature gates flag
+func KnownFeatures() []string {
+	known := make([]string, 0, len(supportedFeatures))
+	for _, f := range supportedFeatures {
+		spec := defaultFeatureGates[f]
+		if spec.PreRelease == GA {
+			known = append(known, fmt.Sprintf("%s=true|false (default=%t)", f, spec.Default))
+			continue
+		}
+		known = append(known, fmt.Sprintf("%s=true|false (%s - default=%t)", f, spec.PreRelease, spec.Default))
+	}
+	sort.Strings(known)
+	return known
+}
@@ -118,6 +118,16 @@ func TestSetFeatureFlag(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		"features with spaces around them": {
+			args: args{
+				features: []string{" FeatureGate1 ", "FeatureGate2 = false", ""},
+			},
+			want: featureFlag{
+				F1: true,
+				F2: false,
+			},
+			wantErr: false,
+		},
 		"wrong format in one feature gate": {
 			args: args{
 				features: []string{"FeatureGate1", "FeatureGate2=true=true"},
@@ -142,3 +152,34 @@ func TestSetFeatureFlag(t *testing.T) {
 		})
 	}
 }
+
+func TestFeatureFlagString(t *testing.T) {
+	fg := featureFlag{
+		"FeatureGate2": false,
+		"FeatureGate1": true,
+	}
+	if got := fg.String(); got != "FeatureGate1=true,FeatureGate2=false" {
+		t.Errorf("String() = %v, want %v", got, "FeatureGate1=true,FeatureGate2=false")
+	}
+}
+
+func TestKnownFeatures(t *testing.T) {
+	F1 := Feature("FeatureGate1")
+	F2 := Feature("FeatureGate2")
+	oldSupportedFeatures, oldDefaultFeatureGates := supportedFeatures, defaultFeatureGates
+	defer func() {
+		supportedFeatures, defaultFeatureGates = oldSupportedFeatures, oldDefaultFeatureGates
+	}()
+	supportedFeatures = []Feature{F2, F1}
+	defaultFeatureGates = map[Feature]featureSpec{
+		F1: {Default: false, PreRelease: Alpha},
+		F2: {Default: true, PreRelease: GA},
+	}
+	want := []string{
+		"FeatureGate1=true|false (ALPHA - default=false)",
+		"FeatureGate2=true|false (default=true)",
+	}
+	if got := KnownFeatures(); !reflect.DeepEqual(got, want) {
+		t.Errorf("KnownFeatures() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+
+	"google.golang.org/grpc"
+)
+
+// callTimeout is the max time taken by a probe in the helper
+var callTimeout = 30 * time.Second
+
+// partitionTimeout is the max time taken to create a partition in the helper
+var partitionTimeout = 2 * time.Minute
+
+// Client calls the probes served by the helper
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+// NewClient returns a client of the helper listening on the unix socket at the
+// given path. The connection is made lazily, so the helper may start after the
+// daemon. The calls fail fast while the helper is not reachable, instead of
+// waiting for it to be ready.
+func NewClient(address string) (*Client, error) {
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", addr)
+	}
+	conn, err := grpc.Dial(address,
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(dialer),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// FillBlockDeviceDetails fills the details of the blockdevice using the probe
+// served by the helper
+func (c *Client) FillBlockDeviceDetails(probe string, blockDevice *blockdevice.BlockDevice) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	req := &FillRequest{Probe: probe, BlockDevice: *blockDevice}
+	resp := new(FillResponse)
+	if err := c.conn.Invoke(ctx, fillDetailsFullMethod, req, resp); err != nil {
+		return err
+	}
+	*blockDevice = resp.BlockDevice
+	return nil
+}
+
+// CreatePartition creates a single partition spanning the disk using the helper
+func (c *Client) CreatePartition(devPath string, diskSize, logicalBlockSize uint64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), partitionTimeout)
+	defer cancel()
+
+	req := &PartitionRequest{
+		DevPath:          devPath,
+		DiskSize:         diskSize,
+		LogicalBlockSize: logicalBlockSize,
+	}
+	return c.conn.Invoke(ctx, createPartitionFullMethod, req, new(PartitionResponse))
+}
+
+// EventStream receives the udev events from the helper
+type EventStream struct {
+	stream grpc.ClientStream
+}
+
+// WatchEvents starts watching the udev events received by the helper. The
+// stream is closed when the context is cancelled.
+func (c *Client) WatchEvents(ctx context.Context) (*EventStream, error) {
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], watchEventsFullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&WatchRequest{}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &EventStream{stream: stream}, nil
+}
+
+// Recv blocks till the next event is received from the helper
+func (s *EventStream) Recv() (*Event, error) {
+	event := new(Event)
+	if err := s.stream.RecvMsg(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Close closes the connection to the helper
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helper
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startHelper serves the helper in a temporary directory and returns its client
+func startHelper(t *testing.T, server *Server) (*Client, func()) {
+	dir, err := ioutil.TempDir("", "ndm-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := filepath.Join(dir, "helper.sock")
+	go server.Serve(address)
+	// wait for the socket, as the calls do not wait for the helper to be ready
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(address); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client, err := NewClient(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, func() {
+		client.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// allowDevPaths makes the helper accept any device path in the tests
+func allowDevPaths() func() {
+	orig := validateDevPath
+	validateDevPath = func(string) error { return nil }
+	return func() { validateDevPath = orig }
+}
+
+func TestFillBlockDeviceDetails(t *testing.T) {
+	defer allowDevPaths()()
+	server := NewServer(map[string]Filler{
+		"fake-probe": func(bd *blockdevice.BlockDevice) {
+			bd.DeviceAttributes.FirmwareRevision = "1.0"
+			bd.SMARTInfo.TotalBytesRead = 1024
+		},
+	}, nil, nil)
+	client, cleanup := startHelper(t, server)
+	defer cleanup()
+
+	bd := &blockdevice.BlockDevice{}
+	bd.DevPath = "/dev/sda"
+	err := client.FillBlockDeviceDetails("fake-probe", bd)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/sda", bd.DevPath)
+	assert.Equal(t, "1.0", bd.DeviceAttributes.FirmwareRevision)
+	assert.Equal(t, uint64(1024), bd.SMARTInfo.TotalBytesRead)
+
+	err = client.FillBlockDeviceDetails("unknown-probe", bd)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestCreatePartition(t *testing.T) {
+	defer allowDevPaths()()
+	var got PartitionRequest
+	server := NewServer(nil, func(devPath string, diskSize, logicalBlockSize uint64) error {
+		got = PartitionRequest{DevPath: devPath, DiskSize: diskSize, LogicalBlockSize: logicalBlockSize}
+		if devPath == "/dev/sdb" {
+			return errors.New("partition failed")
+		}
+		return nil
+	}, nil)
+	client, cleanup := startHelper(t, server)
+	defer cleanup()
+
+	err := client.CreatePartition("/dev/sda", 1<<30, 512)
+	assert.NoError(t, err)
+	assert.Equal(t, PartitionRequest{DevPath: "/dev/sda", DiskSize: 1 << 30, LogicalBlockSize: 512}, got)
+
+	err = client.CreatePartition("/dev/sdb", 1<<30, 512)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestWatchEvents(t *testing.T) {
+	server := NewServer(nil, nil, func(ctx context.Context, send func(*Event) error) error {
+		bd := blockdevice.BlockDevice{}
+		bd.DevPath = "/dev/sda"
+		if err := send(&Event{Action: "add", Devices: []blockdevice.BlockDevice{bd}}); err != nil {
+			return err
+		}
+		if err := send(&Event{Rescan: true}); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		return nil
+	})
+	client, cleanup := startHelper(t, server)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.WatchEvents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "add", event.Action)
+	assert.Equal(t, 1, len(event.Devices))
+	assert.Equal(t, "/dev/sda", event.Devices[0].DevPath)
+
+	event, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.True(t, event.Rescan)
+}
+
+func TestHelperNotReachable(t *testing.T) {
+	client, err := NewClient(filepath.Join(os.TempDir(), "ndm-helper-missing.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the call fails fast instead of waiting for the helper to be ready
+	start := time.Now()
+	err = client.FillBlockDeviceDetails("fake-probe", &blockdevice.BlockDevice{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.True(t, time.Since(start) < callTimeout)
+}
+
+func TestValidateDevPath(t *testing.T) {
+	tests := map[string]string{
+		"file outside /dev":  "/etc/passwd",
+		"path escaping /dev": "/dev/../etc/passwd",
+		"character device":   "/dev/null",
+		"missing device":     "/dev/ndm-missing-device",
+		"relative path":      "dev/sda",
+	}
+	for name, devPath := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateDevPath(devPath)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package helper implements the privileged helper of the NDM daemon. The
+// helper runs the probes which need raw access to the devices, and serves
+// them on a unix socket, so that the daemon can run unprivileged.
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog"
+)
+
+const (
+	serviceName               = "ndm.Helper"
+	fillDetailsMethod         = "FillBlockDeviceDetails"
+	fillDetailsFullMethod     = "/" + serviceName + "/" + fillDetailsMethod
+	createPartitionMethod     = "CreatePartition"
+	createPartitionFullMethod = "/" + serviceName + "/" + createPartitionMethod
+	watchEventsMethod         = "WatchEvents"
+	watchEventsFullMethod     = "/" + serviceName + "/" + watchEventsMethod
+)
+
+// DefaultAddress is the default path of the socket of the helper
+const DefaultAddress = "/run/ndm/helper.sock"
+
+// Filler fills the details of the blockdevice, like the FillBlockDeviceDetails
+// method of a probe
+type Filler func(blockDevice *blockdevice.BlockDevice)
+
+// Partitioner creates a single partition spanning the disk
+type Partitioner func(devPath string, diskSize, logicalBlockSize uint64) error
+
+// Watcher sends the udev events received by the helper till the context is
+// done or sending fails
+type Watcher func(ctx context.Context, send func(*Event) error) error
+
+// FillRequest is the request to fill the details of the blockdevice using a probe
+type FillRequest struct {
+	Probe       string                  `json:"probe"`
+	BlockDevice blockdevice.BlockDevice `json:"blockDevice"`
+}
+
+// FillResponse is the blockdevice filled by the probe
+type FillResponse struct {
+	BlockDevice blockdevice.BlockDevice `json:"blockDevice"`
+}
+
+// PartitionRequest is the request to create a single partition on the disk
+type PartitionRequest struct {
+	DevPath          string `json:"devPath"`
+	DiskSize         uint64 `json:"diskSize"`
+	LogicalBlockSize uint64 `json:"logicalBlockSize"`
+}
+
+// PartitionResponse is the response after the partition is created
+type PartitionResponse struct{}
+
+// WatchRequest is the request to watch the udev events received by the helper
+type WatchRequest struct{}
+
+// Event is a udev event received by the helper. If Rescan is set, the event
+// is a request to rescan all the devices on the node.
+type Event struct {
+	Action  string                    `json:"action,omitempty"`
+	Devices []blockdevice.BlockDevice `json:"devices,omitempty"`
+	Rescan  bool                      `json:"rescan,omitempty"`
+}
+
+// helperServer is the server interface of the helper service
+type helperServer interface {
+	FillBlockDeviceDetails(context.Context, *FillRequest) (*FillResponse, error)
+	CreatePartition(context.Context, *PartitionRequest) (*PartitionResponse, error)
+	WatchEvents(*WatchRequest, grpc.ServerStream) error
+}
+
+// Server serves the probes registered in it
+type Server struct {
+	fillers   map[string]Filler
+	partition Partitioner
+	watch     Watcher
+}
+
+// NewServer returns a server for the given probes, keyed by the probe config key.
+// The partitioner and the watcher may be nil, if they are not served.
+func NewServer(fillers map[string]Filler, partition Partitioner, watch Watcher) *Server {
+	return &Server{
+		fillers:   fillers,
+		partition: partition,
+		watch:     watch,
+	}
+}
+
+// validateDevPath checks that the path is a block device node under /dev, so
+// that the helper cannot be used to open arbitrary files on the host. Can be
+// replaced in tests.
+var validateDevPath = func(devPath string) error {
+	path, err := filepath.EvalSymlinks(filepath.Clean(devPath))
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid device path %s: %v", devPath, err)
+	}
+	if !strings.HasPrefix(path, "/dev/") {
+		return status.Errorf(codes.InvalidArgument, "device path %s is not under /dev", devPath)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid device path %s: %v", devPath, err)
+	}
+	if fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 {
+		return status.Errorf(codes.InvalidArgument, "device path %s is not a block device", devPath)
+	}
+	return nil
+}
+
+// FillBlockDeviceDetails fills the blockdevice in the request using the probe
+func (s *Server) FillBlockDeviceDetails(ctx context.Context, req *FillRequest) (*FillResponse, error) {
+	fill, ok := s.fillers[req.Probe]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "probe %s is not served by the helper", req.Probe)
+	}
+	if err := validateDevPath(req.BlockDevice.DevPath); err != nil {
+		return nil, err
+	}
+	blockDevice := req.BlockDevice
+	fill(&blockDevice)
+	return &FillResponse{BlockDevice: blockDevice}, nil
+}
+
+// CreatePartition creates a single partition on the disk in the request
+func (s *Server) CreatePartition(ctx context.Context, req *PartitionRequest) (*PartitionResponse, error) {
+	if s.partition == nil {
+		return nil, status.Error(codes.Unimplemented, "partitioning is not served by the helper")
+	}
+	if err := validateDevPath(req.DevPath); err != nil {
+		return nil, err
+	}
+	if err := s.partition(req.DevPath, req.DiskSize, req.LogicalBlockSize); err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to create partition on %s: %v", req.DevPath, err)
+	}
+	return &PartitionResponse{}, nil
+}
+
+// WatchEvents streams the udev events received by the helper till the
+// client closes the stream
+func (s *Server) WatchEvents(req *WatchRequest, stream grpc.ServerStream) error {
+	if s.watch == nil {
+		return status.Error(codes.Unimplemented, "udev events are not served by the helper")
+	}
+	return s.watch(stream.Context(), func(event *Event) error {
+		return stream.SendMsg(event)
+	})
+}
+
+func fillDetailsHandler(srv interface{}, ctx context.Context, dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(FillRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(helperServer).FillBlockDeviceDetails(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: fillDetailsFullMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(helperServer).FillBlockDeviceDetails(ctx, req.(*FillRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func createPartitionHandler(srv interface{}, ctx context.Context, dec func(interface{}) error,
+	interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := new(PartitionRequest)
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(helperServer).CreatePartition(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: createPartitionFullMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(helperServer).CreatePartition(ctx, req.(*PartitionRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func watchEventsHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(WatchRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(helperServer).WatchEvents(req, stream)
+}
+
+// serviceDesc describes the helper service. It is written by hand as the
+// messages are encoded using the json codec.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*helperServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: fillDetailsMethod,
+			Handler:    fillDetailsHandler,
+		},
+		{
+			MethodName: createPartitionMethod,
+			Handler:    createPartitionHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    watchEventsMethod,
+			Handler:       watchEventsHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+// Register registers the helper service on the grpc server
+func (s *Server) Register(grpcServer *grpc.Server) {
+	grpcServer.RegisterService(&serviceDesc, s)
+}
+
+// Serve serves the helper on the unix socket at the given path. A stale
+// socket left by an earlier run is removed.
+func (s *Server) Serve(address string) error {
+	if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove stale socket %s: %v", address, err)
+	}
+	l, err := net.Listen("unix", address)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %v", address, err)
+	}
+	// only the daemon running as the same user or group can connect
+	if err := os.Chmod(address, 0660); err != nil {
+		l.Close()
+		return fmt.Errorf("unable to set permissions of %s: %v", address, err)
+	}
+
+	grpcServer := grpc.NewServer()
+	s.Register(grpcServer)
+	klog.Infof("Starting privileged helper at : %v", address)
+	return grpcServer.Serve(l)
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logs
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog"
+)
+
+// Field keys used in the structured logs of the discovery of block devices
+const (
+	// ModuleKey is the key of the module which wrote the log
+	ModuleKey = "module"
+	// UUIDKey is the key of the blockdevice UUID
+	UUIDKey = "uuid"
+	// ResourceNameKey is the key of the name of the resource, used along with
+	// the event code of the changes to the resources
+	ResourceNameKey = "rname"
+	// PathKey is the key of the device path
+	PathKey = "path"
+	// NodeKey is the key of the node name
+	NodeKey = "node"
+	// ProbeKey is the key of the probe name
+	ProbeKey = "probe"
+	// ErrorKey is the key of the error
+	ErrorKey = "err"
+	// VerbosityKey is the key of the verbosity of the info messages written
+	// using V
+	VerbosityKey = "v"
+)
+
+// MaxLogLevel is the maximum verbosity that can be set for a module
+const MaxLogLevel = 10
+
+// noOverride is the level of a module which uses the verbosity of klog
+const noOverride = -1
+
+// module is a module which writes logs, and its log level override
+type module struct {
+	// level is the verbosity of the module, or noOverride
+	level int32
+}
+
+// Enabled implements zapcore.LevelEnabler. The info messages written using V(n)
+// have the level -n, so they are enabled if the verbosity is at least n.
+func (m *module) Enabled(level zapcore.Level) bool {
+	return int32(level) >= -m.verbosity()
+}
+
+// verbosity returns the verbosity of the module
+func (m *module) verbosity() int32 {
+	if level := atomic.LoadInt32(&m.level); level != noOverride {
+		return level
+	}
+	return klogVerbosity()
+}
+
+// modules holds the registered modules
+var modules = struct {
+	sync.RWMutex
+	known map[string]*module
+}{
+	known: make(map[string]*module),
+}
+
+// verbosityFlag is the -v flag of klog, which is looked up once it has been
+// registered
+var verbosityFlag atomic.Value
+
+// klogVerbosity returns the verbosity set using the -v flag of klog
+func klogVerbosity() int32 {
+	getter, _ := verbosityFlag.Load().(flag.Getter)
+	if getter == nil {
+		f := flag.Lookup("v")
+		if f == nil {
+			return 0
+		}
+		if getter, _ = f.Value.(flag.Getter); getter == nil {
+			return 0
+		}
+		verbosityFlag.Store(getter)
+	}
+	level, _ := getter.Get().(klog.Level)
+	return int32(level)
+}
+
+// output is the writer of the logs of all the modules
+var output = &switchWriter{w: os.Stderr}
+
+// switchWriter is a writer whose destination can be replaced, eg: in tests
+type switchWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *switchWriter) Sync() error {
+	return nil
+}
+
+// encoderConfig encodes the logs as json, with the time in ISO8601 format
+var encoderConfig = zapcore.EncoderConfig{
+	TimeKey:        "ts",
+	LevelKey:       "level",
+	CallerKey:      "caller",
+	MessageKey:     "msg",
+	LineEnding:     zapcore.DefaultLineEnding,
+	EncodeLevel:    encodeLevel,
+	EncodeTime:     zapcore.ISO8601TimeEncoder,
+	EncodeDuration: zapcore.StringDurationEncoder,
+	EncodeCaller:   zapcore.ShortCallerEncoder,
+}
+
+// encodeLevel encodes the levels of the info messages written using V as info,
+// their verbosity is added as a field
+func encodeLevel(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	if level < zapcore.InfoLevel {
+		level = zapcore.InfoLevel
+	}
+	zapcore.LowercaseLevelEncoder(level, enc)
+}
+
+// Logger writes structured logs of a module using zap. The logs are written as
+// json, along with the module and the fields of the logger. The verbosity of the
+// module can be overridden at runtime using SetModuleLevels.
+type Logger struct {
+	logger *zap.Logger
+}
+
+// Module returns the logger of the given module, and registers the module so
+// that its log level can be overridden
+func Module(name string) Logger {
+	modules.Lock()
+	defer modules.Unlock()
+	m, ok := modules.known[name]
+	if !ok {
+		m = &module{level: noOverride}
+		modules.known[name] = m
+	}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), output, m)
+	// the caller is skipped for the methods of Logger and log
+	return Logger{logger: zap.New(core, zap.AddCaller(), zap.AddCallerSkip(2)).With(zap.String(ModuleKey, name))}
+}
+
+// KnownModules returns the sorted names of the registered modules
+func KnownModules() []string {
+	modules.RLock()
+	defer modules.RUnlock()
+	names := make([]string, 0, len(modules.known))
+	for name := range modules.known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetModuleLevels replaces the log level overrides of the modules. Modules which
+// do not have an override use the verbosity set using the -v flag.
+func SetModuleLevels(levels map[string]int) error {
+	modules.Lock()
+	defer modules.Unlock()
+	for name, level := range levels {
+		if _, ok := modules.known[name]; !ok {
+			return fmt.Errorf("unknown log module %q", name)
+		}
+		if level < 0 || level > MaxLogLevel {
+			return fmt.Errorf("invalid log level %d for module %q, must be between 0 and %d",
+				level, name, MaxLogLevel)
+		}
+	}
+	for name, m := range modules.known {
+		level, ok := levels[name]
+		if !ok {
+			level = noOverride
+		}
+		atomic.StoreInt32(&m.level, int32(level))
+	}
+	return nil
+}
+
+// WithValues returns a logger which adds the given key value pairs to each message
+func (l Logger) WithValues(keysAndValues ...interface{}) Logger {
+	return Logger{logger: l.logger.With(fields(keysAndValues)...)}
+}
+
+// V returns a logger which writes the info messages only if the verbosity of
+// the module is at least the given level
+func (l Logger) V(level int) Verbose {
+	return Verbose{logger: l, level: level}
+}
+
+// Info logs the message along with the fields
+func (l Logger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(zapcore.InfoLevel, msg, fields(keysAndValues))
+}
+
+// Infof logs the formatted message
+func (l Logger) Infof(format string, args ...interface{}) {
+	l.log(zapcore.InfoLevel, fmt.Sprintf(format, args...), nil)
+}
+
+// Warning logs the message as a warning along with the fields
+func (l Logger) Warning(msg string, keysAndValues ...interface{}) {
+	l.log(zapcore.WarnLevel, msg, fields(keysAndValues))
+}
+
+// Warningf logs the formatted message as a warning
+func (l Logger) Warningf(format string, args ...interface{}) {
+	l.log(zapcore.WarnLevel, fmt.Sprintf(format, args...), nil)
+}
+
+// Error logs the error and the message along with the fields
+func (l Logger) Error(err error, msg string, keysAndValues ...interface{}) {
+	f := fields(keysAndValues)
+	if err != nil {
+		f = append(f, zap.NamedError(ErrorKey, err))
+	}
+	l.log(zapcore.ErrorLevel, msg, f)
+}
+
+// Errorf logs the formatted message as an error
+func (l Logger) Errorf(format string, args ...interface{}) {
+	l.log(zapcore.ErrorLevel, fmt.Sprintf(format, args...), nil)
+}
+
+// log writes the message, if the level is enabled for the module
+func (l Logger) log(level zapcore.Level, msg string, f []zap.Field) {
+	if ce := l.logger.Check(level, msg); ce != nil {
+		ce.Write(f...)
+	}
+}
+
+// Verbose is a logger which writes the info messages only if the verbosity of
+// the module is at least its level
+type Verbose struct {
+	logger Logger
+	level  int
+}
+
+// Enabled returns true if the messages will be written
+func (v Verbose) Enabled() bool {
+	return v.logger.logger.Core().Enabled(v.zapLevel())
+}
+
+// Info logs the message along with the fields, if enabled
+func (v Verbose) Info(msg string, keysAndValues ...interface{}) {
+	v.logger.log(v.zapLevel(), msg, append(fields(keysAndValues), zap.Int(VerbosityKey, v.level)))
+}
+
+// Infof logs the formatted message, if enabled
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if !v.Enabled() {
+		return
+	}
+	v.logger.log(v.zapLevel(), fmt.Sprintf(format, args...), []zap.Field{zap.Int(VerbosityKey, v.level)})
+}
+
+// zapLevel returns the zap level of the info messages of the verbosity
+func (v Verbose) zapLevel() zapcore.Level {
+	return zapcore.Level(-v.level)
+}
+
+// fields converts the key value pairs to zap fields. A key without a value is
+// logged with the value "<missing>".
+func fields(keysAndValues []interface{}) []zap.Field {
+	f := make([]zap.Field, 0, (len(keysAndValues)+1)/2+1)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = "<missing>"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		f = append(f, zap.Any(fmt.Sprint(keysAndValues[i]), value))
+	}
+	return f
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// capture returns the json logs written while running f
+func capture(t *testing.T, f func()) []map[string]interface{} {
+	var buf bytes.Buffer
+	output.Lock()
+	output.w = &buf
+	output.Unlock()
+	defer func() {
+		output.Lock()
+		output.w = os.Stderr
+		output.Unlock()
+	}()
+
+	f()
+
+	var entries []map[string]interface{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		entry := make(map[string]interface{})
+		if !assert.NoError(t, decoder.Decode(&entry)) {
+			break
+		}
+		// the time and caller depend on the run
+		delete(entry, "ts")
+		delete(entry, "caller")
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFields(t *testing.T) {
+	logger := Module("test").WithValues(UUIDKey, "blockdevice-123", PathKey, "/dev/sda")
+	tests := map[string]struct {
+		log      func()
+		expected map[string]interface{}
+	}{
+		"message with logger fields": {
+			log: func() { logger.Info("processed") },
+			expected: map[string]interface{}{"level": "info", "module": "test", "msg": "processed",
+				UUIDKey: "blockdevice-123", PathKey: "/dev/sda"},
+		},
+		"message with additional fields": {
+			log: func() { logger.Warning("details filled", ProbeKey, "udev probe", "count", 2) },
+			expected: map[string]interface{}{"level": "warn", "module": "test", "msg": "details filled",
+				UUIDKey: "blockdevice-123", PathKey: "/dev/sda", ProbeKey: "udev probe", "count": float64(2)},
+		},
+		"missing and empty values": {
+			log: func() { logger.Info("failed", NodeKey, "", ErrorKey) },
+			expected: map[string]interface{}{"level": "info", "module": "test", "msg": "failed",
+				UUIDKey: "blockdevice-123", PathKey: "/dev/sda", NodeKey: "", ErrorKey: "<missing>"},
+		},
+		"error": {
+			log: func() { logger.Error(errors.New(`device "sda" busy`), "failed") },
+			expected: map[string]interface{}{"level": "error", "module": "test", "msg": "failed",
+				UUIDKey: "blockdevice-123", PathKey: "/dev/sda", ErrorKey: `device "sda" busy`},
+		},
+		"formatted message": {
+			log: func() { logger.Errorf("unable to open %s: %v", "/dev/sda", errors.New("busy")) },
+			expected: map[string]interface{}{"level": "error", "module": "test", "msg": "unable to open /dev/sda: busy",
+				UUIDKey: "blockdevice-123", PathKey: "/dev/sda"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, []map[string]interface{}{test.expected}, capture(t, test.log))
+		})
+	}
+}
+
+func TestSetModuleLevels(t *testing.T) {
+	logger := Module("test-levels")
+	defer SetModuleLevels(nil)
+
+	assert.Contains(t, KnownModules(), "test-levels")
+	assert.False(t, logger.V(4).Enabled())
+
+	assert.NoError(t, SetModuleLevels(map[string]int{"test-levels": 4}))
+	assert.True(t, logger.V(4).Enabled())
+	assert.False(t, logger.V(5).Enabled())
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "info", "module": "test-levels", "msg": "scanned /dev/sda", VerbosityKey: float64(4)},
+	}, capture(t, func() {
+		logger.V(4).Infof("scanned %s", "/dev/sda")
+		logger.V(5).Info("not written")
+	}))
+
+	// invalid levels are not applied
+	assert.Error(t, SetModuleLevels(map[string]int{"unknown-module": 4}))
+	assert.Error(t, SetModuleLevels(map[string]int{"test-levels": MaxLogLevel + 1}))
+	assert.True(t, logger.V(4).Enabled())
+
+	// modules without an override use the verbosity of klog
+	assert.NoError(t, SetModuleLevels(nil))
+	assert.False(t, logger.V(4).Enabled())
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskstats
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/diskstats"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DiskStatsNamespace is the namespace of the metrics from /proc/diskstats
+	DiskStatsNamespace = "diskstats"
+)
+
+// Metrics is the prometheus metrics of the IO statistics, exposed by the exporter
+type Metrics struct {
+	readIOPS            *prometheus.GaugeVec
+	writeIOPS           *prometheus.GaugeVec
+	readBytesPerSecond  *prometheus.GaugeVec
+	writeBytesPerSecond *prometheus.GaugeVec
+	queueDepth          *prometheus.GaugeVec
+	readAwait           *prometheus.GaugeVec
+	writeAwait          *prometheus.GaugeVec
+	utilization         *prometheus.GaugeVec
+	iosInProgress       *prometheus.GaugeVec
+
+	// errors and rejected requests
+	rejectRequestCount prometheus.Counter
+	errorRequestCount  prometheus.Counter
+}
+
+// newGaugeVec returns a gauge of the IO statistics labelled with the device
+func newGaugeVec(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: DiskStatsNamespace,
+			Name:      name,
+			Help:      help,
+		},
+		labels.DeviceLabelNames(),
+	)
+}
+
+// NewMetrics creates instance of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		readIOPS: newGaugeVec("read_iops",
+			`Reads completed per second over the sampling interval`),
+		writeIOPS: newGaugeVec("write_iops",
+			`Writes completed per second over the sampling interval`),
+		readBytesPerSecond: newGaugeVec("read_bytes_per_second",
+			`Bytes read per second over the sampling interval`),
+		writeBytesPerSecond: newGaugeVec("write_bytes_per_second",
+			`Bytes written per second over the sampling interval`),
+		queueDepth: newGaugeVec("queue_depth",
+			`Average no. of IOs queued to the device over the sampling interval`),
+		readAwait: newGaugeVec("read_await_seconds",
+			`Average time taken by a read, including the time in the queue`),
+		writeAwait: newGaugeVec("write_await_seconds",
+			`Average time taken by a write, including the time in the queue`),
+		utilization: newGaugeVec("utilization_ratio",
+			`Fraction of the sampling interval during which the device was busy`),
+		iosInProgress: newGaugeVec("ios_in_progress",
+			`No. of IOs in progress at the end of the sampling interval`),
+		rejectRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: DiskStatsNamespace,
+				Name:      "reject_request_count",
+				Help:      `No. of requests rejected by the exporter`,
+			}),
+		errorRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: DiskStatsNamespace,
+				Name:      "error_request_count",
+				Help:      `No. of requests errored out by the exporter`,
+			}),
+	}
+}
+
+// gauges returns the gauges of the IO statistics
+func (m *Metrics) gauges() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{m.readIOPS, m.writeIOPS, m.readBytesPerSecond,
+		m.writeBytesPerSecond, m.queueDepth, m.readAwait, m.writeAwait,
+		m.utilization, m.iosInProgress}
+}
+
+// Collectors lists out all the collectors for which the metrics is exposed
+func (m *Metrics) Collectors() []prometheus.Collector {
+	collectors := make([]prometheus.Collector, 0)
+	for _, gauge := range m.gauges() {
+		collectors = append(collectors, gauge)
+	}
+	return append(collectors, m.ErrorCollectors()...)
+}
+
+// ErrorCollectors lists out all collectors for metrics related to error
+func (m *Metrics) ErrorCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.rejectRequestCount,
+		m.errorRequestCount,
+	}
+}
+
+// IncRejectRequestCounter increments the reject request error counter
+func (m *Metrics) IncRejectRequestCounter() {
+	m.rejectRequestCount.Inc()
+}
+
+// IncErrorRequestCounter increments the no of requests errored out.
+func (m *Metrics) IncErrorRequestCounter() {
+	m.errorRequestCount.Inc()
+}
+
+// Reset clears the IO rates of all the devices before they are set again from
+// the diskstats, so that the rates of the removed devices are not exposed. The
+// error counters are kept.
+func (m *Metrics) Reset() {
+	for _, gauge := range m.gauges() {
+		gauge.Reset()
+	}
+}
+
+// SetMetrics sets the IO statistics of the blockdevice to the metrics
+func (m *Metrics) SetMetrics(bd blockdevice.BlockDevice, rates diskstats.Rates) {
+	labelValues := labels.DeviceLabelValues(bd)
+	m.readIOPS.WithLabelValues(labelValues...).Set(rates.ReadIOPS)
+	m.writeIOPS.WithLabelValues(labelValues...).Set(rates.WriteIOPS)
+	m.readBytesPerSecond.WithLabelValues(labelValues...).Set(rates.ReadBytesPerSecond)
+	m.writeBytesPerSecond.WithLabelValues(labelValues...).Set(rates.WriteBytesPerSecond)
+	m.queueDepth.WithLabelValues(labelValues...).Set(rates.QueueDepth)
+	m.readAwait.WithLabelValues(labelValues...).Set(rates.ReadAwait.Seconds())
+	m.writeAwait.WithLabelValues(labelValues...).Set(rates.WriteAwait.Seconds())
+	m.utilization.WithLabelValues(labelValues...).Set(rates.Utilization)
+	m.iosInProgress.WithLabelValues(labelValues...).Set(float64(rates.IOsInProgress))
+}
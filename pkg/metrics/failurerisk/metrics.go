@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failurerisk
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// SMARTNamespace is the namespace of the metrics from the ATA SMART attributes
+	SMARTNamespace = "smart"
+)
+
+// Metrics is the prometheus metrics of the risk of failure of the devices,
+// exposed by the exporter
+type Metrics struct {
+	score     *prometheus.GaugeVec
+	indicator *prometheus.GaugeVec
+
+	// errors and rejected requests
+	rejectRequestCount prometheus.Counter
+	errorRequestCount  prometheus.Counter
+}
+
+// NewMetrics creates instance of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		score: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: SMARTNamespace,
+				Name:      "failure_risk_score",
+				Help:      `Risk of failure of the device between 0 and 1, scored from the failure indicators`,
+			},
+			labels.DeviceLabelNames(),
+		),
+		indicator: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: SMARTNamespace,
+				Name:      "failure_indicator",
+				Help:      `Raw value of the SMART attribute used to predict the failure of the device, by indicator`,
+			},
+			append(labels.DeviceLabelNames(), "indicator"),
+		),
+		rejectRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: SMARTNamespace,
+				Name:      "reject_request_count",
+				Help:      `No. of requests rejected by the exporter`,
+			}),
+		errorRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: SMARTNamespace,
+				Name:      "error_request_count",
+				Help:      `No. of requests errored out by the exporter`,
+			}),
+	}
+}
+
+// Collectors lists out all the collectors for which the metrics is exposed
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.score,
+		m.indicator,
+		m.rejectRequestCount,
+		m.errorRequestCount,
+	}
+}
+
+// ErrorCollectors lists out all collectors for metrics related to error
+func (m *Metrics) ErrorCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.rejectRequestCount,
+		m.errorRequestCount,
+	}
+}
+
+// IncRejectRequestCounter increments the reject request error counter
+func (m *Metrics) IncRejectRequestCounter() {
+	m.rejectRequestCount.Inc()
+}
+
+// IncErrorRequestCounter increments the no of requests errored out.
+func (m *Metrics) IncErrorRequestCounter() {
+	m.errorRequestCount.Inc()
+}
+
+// Reset clears the risk scores and the failure indicators, so that the
+// indicators which are no longer reported by a device are dropped with it
+func (m *Metrics) Reset() {
+	m.score.Reset()
+	m.indicator.Reset()
+}
+
+// SetMetrics sets the failure indicators and the risk of failure of the blockdevice
+func (m *Metrics) SetMetrics(bd blockdevice.BlockDevice, indicators map[string]uint64, score float64) {
+	labelValues := labels.DeviceLabelValues(bd)
+	m.score.WithLabelValues(labelValues...).Set(score)
+	for indicator, value := range indicators {
+		m.indicator.WithLabelValues(append(labelValues, indicator)...).Set(float64(value))
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystem
+
+import (
+	"syscall"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// FilesystemNamespace is the namespace of the metrics of the mounted filesystems
+	FilesystemNamespace = "filesystem"
+
+	// MountPoint is the label of the mountpoint of the filesystem
+	MountPoint = "mountpoint"
+	// FSType is the label of the type of the filesystem
+	FSType = "fstype"
+)
+
+// Usage is the capacity and the inodes of a mounted filesystem
+type Usage struct {
+	SizeBytes  uint64
+	FreeBytes  uint64
+	AvailBytes uint64
+	Inodes     uint64
+	InodesFree uint64
+}
+
+// UsedBytes returns the bytes used in the filesystem
+func (u Usage) UsedBytes() uint64 {
+	return u.SizeBytes - u.FreeBytes
+}
+
+// Statfs returns the usage of the filesystem mounted at the path
+func Statfs(path string) (Usage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return Usage{}, err
+	}
+	blockSize := uint64(stat.Bsize)
+	return Usage{
+		SizeBytes:  uint64(stat.Blocks) * blockSize,
+		FreeBytes:  uint64(stat.Bfree) * blockSize,
+		AvailBytes: uint64(stat.Bavail) * blockSize,
+		Inodes:     uint64(stat.Files),
+		InodesFree: uint64(stat.Ffree),
+	}, nil
+}
+
+// Metrics is the prometheus metrics of the mounted filesystems, exposed by the exporter
+type Metrics struct {
+	sizeBytes  *prometheus.GaugeVec
+	usedBytes  *prometheus.GaugeVec
+	freeBytes  *prometheus.GaugeVec
+	availBytes *prometheus.GaugeVec
+	inodes     *prometheus.GaugeVec
+	inodesFree *prometheus.GaugeVec
+
+	// errors and rejected requests
+	rejectRequestCount prometheus.Counter
+	errorRequestCount  prometheus.Counter
+}
+
+// newGaugeVec returns a gauge of the filesystem labelled with the device, the
+// mountpoint and the filesystem type
+func newGaugeVec(name, help string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: FilesystemNamespace,
+			Name:      name,
+			Help:      help,
+		},
+		append(labels.DeviceLabelNames(), MountPoint, FSType),
+	)
+}
+
+// NewMetrics creates instance of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		sizeBytes: newGaugeVec("size_bytes",
+			`Size of the filesystem in bytes`),
+		usedBytes: newGaugeVec("used_bytes",
+			`Bytes used in the filesystem`),
+		freeBytes: newGaugeVec("free_bytes",
+			`Bytes free in the filesystem`),
+		availBytes: newGaugeVec("avail_bytes",
+			`Bytes free in the filesystem that are available to non-root users`),
+		inodes: newGaugeVec("inodes",
+			`Total no. of inodes in the filesystem`),
+		inodesFree: newGaugeVec("inodes_free",
+			`No. of free inodes in the filesystem`),
+		rejectRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: FilesystemNamespace,
+				Name:      "reject_request_count",
+				Help:      `No. of requests rejected by the exporter`,
+			}),
+		errorRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: FilesystemNamespace,
+				Name:      "error_request_count",
+				Help:      `No. of requests errored out by the exporter`,
+			}),
+	}
+}
+
+// gauges returns the gauges of the filesystems
+func (m *Metrics) gauges() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{m.sizeBytes, m.usedBytes, m.freeBytes,
+		m.availBytes, m.inodes, m.inodesFree}
+}
+
+// Collectors lists out all the collectors for which the metrics is exposed
+func (m *Metrics) Collectors() []prometheus.Collector {
+	collectors := make([]prometheus.Collector, 0)
+	for _, gauge := range m.gauges() {
+		collectors = append(collectors, gauge)
+	}
+	return append(collectors, m.ErrorCollectors()...)
+}
+
+// ErrorCollectors lists out all collectors for metrics related to error
+func (m *Metrics) ErrorCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.rejectRequestCount,
+		m.errorRequestCount,
+	}
+}
+
+// IncRejectRequestCounter increments the reject request error counter
+func (m *Metrics) IncRejectRequestCounter() {
+	m.rejectRequestCount.Inc()
+}
+
+// IncErrorRequestCounter increments the no of requests errored out.
+func (m *Metrics) IncErrorRequestCounter() {
+	m.errorRequestCount.Inc()
+}
+
+// Reset removes the metrics of all the filesystems, so that the metrics of the
+// unmounted filesystems are not exposed
+func (m *Metrics) Reset() {
+	for _, gauge := range m.gauges() {
+		gauge.Reset()
+	}
+}
+
+// SetMetrics sets the usage of the filesystem of the blockdevice to the metrics
+func (m *Metrics) SetMetrics(bd blockdevice.BlockDevice, mountPoint, fsType string, usage Usage) {
+	labelValues := append(labels.DeviceLabelValues(bd), mountPoint, fsType)
+	m.sizeBytes.WithLabelValues(labelValues...).Set(float64(usage.SizeBytes))
+	m.usedBytes.WithLabelValues(labelValues...).Set(float64(usage.UsedBytes()))
+	m.freeBytes.WithLabelValues(labelValues...).Set(float64(usage.FreeBytes))
+	m.availBytes.WithLabelValues(labelValues...).Set(float64(usage.AvailBytes))
+	m.inodes.WithLabelValues(labelValues...).Set(float64(usage.Inodes))
+	m.inodesFree.WithLabelValues(labelValues...).Set(float64(usage.InodesFree))
+}
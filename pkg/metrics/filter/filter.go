@@ -0,0 +1,302 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filter removes metric families and labels from the gathered metrics
+// before they are exposed. It is used to limit the cardinality of the metrics
+// and to avoid exposing values that are considered sensitive, like the serial
+// numbers of the devices.
+package filter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+// hashLength is the no. of hex characters of the hash kept in the label value
+const hashLength = 16
+
+// hashKey is the key of the HMAC with which the label values are hashed
+var hashKey struct {
+	sync.RWMutex
+	key []byte
+}
+
+// Config is the configuration of the metrics that are exposed
+type Config struct {
+	// Include are the regexes of the metric families that are exposed. All
+	// the families are exposed if empty.
+	Include []string
+	// Exclude are the regexes of the metric families that are not exposed.
+	// Takes precedence over Include.
+	Exclude []string
+	// DropLabels are the labels that are removed from all the metrics
+	DropLabels []string
+	// HashLabels are the labels whose values are replaced with their hash
+	HashLabels []string
+	// HashKeyFile is the file having the key of the HMAC with which the serials
+	// and the HashLabels are hashed. The serials are not exposed if empty.
+	HashKeyFile string
+	// MaxDevices is the max no. of devices whose metrics are exposed in each
+	// family. The metrics of the other devices are aggregated. Unlimited if 0.
+	MaxDevices int
+	// DeviceLabels are the labels which identify the device of a metric
+	DeviceLabels []string
+	// MaxLabelValues is the max no. of values of each label in a family. The
+	// metrics with the other values are aggregated.
+	MaxLabelValues map[string]int
+}
+
+// AddFlags adds the flags to set the config to the flag set
+func (c *Config) AddFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(&c.Include, "metrics-include", nil,
+		"Regexes of the metric families that are exposed. All the families are exposed if empty")
+	flags.StringSliceVar(&c.Exclude, "metrics-exclude", nil,
+		"Regexes of the metric families that are not exposed. Takes precedence over --metrics-include")
+	flags.StringSliceVar(&c.DropLabels, "metrics-drop-labels", nil,
+		"Labels that are removed from all the metrics, eg: model,serial_hash")
+	flags.StringSliceVar(&c.HashLabels, "metrics-hash-labels", nil,
+		"Labels whose values are replaced with their hash, eg: blockdevice. Requires --metrics-hash-key-file")
+	flags.StringVar(&c.HashKeyFile, "metrics-hash-key-file", "",
+		"File having the key of the HMAC-SHA256 with which the serials and the --metrics-hash-labels are hashed. "+
+			"The serial_hash label is empty if not set. Use the same key on all the nodes, so that the hashes "+
+			"of a device are the same")
+	flags.IntVar(&c.MaxDevices, "metrics-max-devices", 0,
+		"Max no. of devices whose metrics are exposed in each metric family. The metrics of the other devices are "+
+			"summed into a series with the device labels set to \""+OtherValue+"\". Unlimited if 0")
+	flags.StringSliceVar(&c.DeviceLabels, "metrics-device-labels", DefaultDeviceLabels,
+		"Labels which identify the device of a metric, used for --metrics-max-devices")
+	flags.StringToIntVar(&c.MaxLabelValues, "metrics-max-label-values", nil,
+		"Max no. of values of the labels in each metric family, eg: mountpoint=100. The other values are "+
+			"collapsed into \""+OtherValue+"\" and the metrics are summed")
+}
+
+// Validate checks that the regexes and the labels in the config are valid
+func (c Config) Validate() error {
+	_, err := NewGatherer(nil, c)
+	return err
+}
+
+// Gatherer gathers the metrics from a gatherer and filters them as per the config
+type Gatherer struct {
+	gatherer   prometheus.Gatherer
+	include    []*regexp.Regexp
+	exclude    []*regexp.Regexp
+	dropLabels map[string]bool
+	hashLabels map[string]bool
+	limits     []*limit
+
+	// collisions are the families in which metrics collided after filtering
+	// the labels, so that each family is reported only once
+	mutex      sync.Mutex
+	collisions map[string]bool
+}
+
+// NewGatherer returns a gatherer which filters the metrics of the given
+// gatherer as per the config. The regexes are matched against the whole
+// name of the metric family.
+func NewGatherer(gatherer prometheus.Gatherer, config Config) (*Gatherer, error) {
+	g := &Gatherer{
+		gatherer:   gatherer,
+		dropLabels: make(map[string]bool),
+		hashLabels: make(map[string]bool),
+		collisions: make(map[string]bool),
+	}
+	var err error
+	if g.include, err = compile(config.Include); err != nil {
+		return nil, err
+	}
+	if g.exclude, err = compile(config.Exclude); err != nil {
+		return nil, err
+	}
+	for _, label := range config.DropLabels {
+		g.dropLabels[label] = true
+	}
+	if len(config.HashLabels) != 0 && len(config.HashKeyFile) == 0 {
+		return nil, fmt.Errorf("hash key file is required to hash the labels")
+	}
+	for _, label := range config.HashLabels {
+		if g.dropLabels[label] {
+			return nil, fmt.Errorf("label %s cannot be both dropped and hashed", label)
+		}
+		g.hashLabels[label] = true
+	}
+	if err := g.setLimits(config); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	regexes := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric family regex %q: %v", pattern, err)
+		}
+		regexes = append(regexes, regex)
+	}
+	return regexes, nil
+}
+
+func matchAny(regexes []*regexp.Regexp, name string) bool {
+	for _, regex := range regexes {
+		if regex.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Gather implements the prometheus.Gatherer interface
+func (g *Gatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	filtered := make([]*dto.MetricFamily, 0, len(families))
+	for _, family := range families {
+		name := family.GetName()
+		if len(g.include) != 0 && !matchAny(g.include, name) {
+			continue
+		}
+		if matchAny(g.exclude, name) {
+			continue
+		}
+		g.filterLabels(family)
+		g.limitCardinality(family)
+		if len(family.Metric) == 0 {
+			continue
+		}
+		filtered = append(filtered, family)
+	}
+	return filtered, err
+}
+
+// filterLabels drops and hashes the labels of the metrics of the family. If
+// the metrics are no longer unique after dropping the labels, they are merged
+// like the metrics aggregated over the limits, or dropped if they cannot be
+// summed, and the collision is reported.
+func (g *Gatherer) filterLabels(family *dto.MetricFamily) {
+	if len(g.dropLabels) == 0 && len(g.hashLabels) == 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	collided := false
+	for _, metric := range family.Metric {
+		labels := make([]*dto.LabelPair, 0, len(metric.Label))
+		for _, label := range metric.Label {
+			if g.dropLabels[label.GetName()] {
+				continue
+			}
+			if g.hashLabels[label.GetName()] {
+				// the label pairs are shared with the collected metrics, and are
+				// not changed
+				label = &dto.LabelPair{Name: label.Name, Value: stringPtr(Hash(label.GetValue()))}
+			}
+			labels = append(labels, label)
+		}
+		metric.Label = labels
+
+		key := labelsKey(labels)
+		if seen[key] {
+			collided = true
+		}
+		seen[key] = true
+	}
+	if !collided {
+		return
+	}
+	g.reportCollision(family.GetName())
+	mergeMetrics(family)
+}
+
+// reportCollision logs a warning the first time the metrics of the family
+// collide after filtering the labels
+func (g *Gatherer) reportCollision(name string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.collisions[name] {
+		return
+	}
+	g.collisions[name] = true
+	klog.Warningf("metrics of %s are not unique after dropping or hashing the labels, the duplicate "+
+		"series are summed, or dropped if they are gauges", name)
+}
+
+// labelsKey returns a string which identifies the metric by its labels
+func labelsKey(labels []*dto.LabelPair) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// LoadHashKey reads the key of the HMAC from HashKeyFile. The values are not
+// hashed if the file is not set.
+func (c Config) LoadHashKey() error {
+	if len(c.HashKeyFile) == 0 {
+		SetHashKey(nil)
+		return nil
+	}
+	key, err := ioutil.ReadFile(c.HashKeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to read hash key: %v", err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return fmt.Errorf("hash key file %s is empty", c.HashKeyFile)
+	}
+	SetHashKey(key)
+	return nil
+}
+
+// SetHashKey sets the key of the HMAC with which the label values are hashed
+func SetHashKey(key []byte) {
+	hashKey.Lock()
+	defer hashKey.Unlock()
+	hashKey.key = key
+}
+
+// Hash returns the HMAC-SHA256 of the label value with the configured key, so
+// that the values cannot be found by hashing the possible values. Empty values
+// are not hashed, so that missing values can still be identified, and the hash
+// is empty if no key is configured.
+func Hash(value string) string {
+	hashKey.RLock()
+	defer hashKey.RUnlock()
+	if len(value) == 0 || len(hashKey.key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, hashKey.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,312 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "seachest",
+		Name:      "block_device_current_temperature_celsius",
+		Help:      "Current reported temperature of the blockdevice",
+	}, []string{"blockdevicename", "serial"})
+	temperature.WithLabelValues("bd-1", "S1").Set(30)
+	temperature.WithLabelValues("bd-2", "S2").Set(40)
+	capacity := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "seachest",
+		Name:      "block_device_capacity_bytes",
+		Help:      "Capacity of the blockdevice",
+	}, []string{"blockdevicename"})
+	capacity.WithLabelValues("bd-1").Set(1024)
+	registry.MustRegister(temperature, capacity)
+	return registry
+}
+
+// gather returns the metrics in the text exposition format
+func gather(t *testing.T, config Config) string {
+	gatherer, err := NewGatherer(newTestRegistry(), config)
+	require.NoError(t, err)
+	families, err := gatherer.Gather()
+	require.NoError(t, err)
+	var b strings.Builder
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			b.WriteString(family.GetName())
+			for _, label := range metric.Label {
+				b.WriteString(" " + label.GetName() + "=" + label.GetValue())
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func TestGatherer(t *testing.T) {
+	SetHashKey([]byte("test"))
+	defer SetHashKey(nil)
+	tests := map[string]struct {
+		config Config
+		want   string
+	}{
+		"no filter": {
+			want: `seachest_block_device_capacity_bytes blockdevicename=bd-1
+seachest_block_device_current_temperature_celsius blockdevicename=bd-1 serial=S1
+seachest_block_device_current_temperature_celsius blockdevicename=bd-2 serial=S2
+`,
+		},
+		"include families": {
+			config: Config{Include: []string{".*temperature.*"}},
+			want: `seachest_block_device_current_temperature_celsius blockdevicename=bd-1 serial=S1
+seachest_block_device_current_temperature_celsius blockdevicename=bd-2 serial=S2
+`,
+		},
+		"exclude takes precedence over include": {
+			config: Config{Include: []string{"seachest_.*"}, Exclude: []string{".*temperature.*"}},
+			want: `seachest_block_device_capacity_bytes blockdevicename=bd-1
+`,
+		},
+		"regex matches the whole name": {
+			config: Config{Include: []string{"seachest"}},
+			want:   "",
+		},
+		"hash label": {
+			config: Config{HashLabels: []string{"serial"}, HashKeyFile: "key"},
+			want: `seachest_block_device_capacity_bytes blockdevicename=bd-1
+seachest_block_device_current_temperature_celsius blockdevicename=bd-1 serial=` + Hash("S1") + `
+seachest_block_device_current_temperature_celsius blockdevicename=bd-2 serial=` + Hash("S2") + `
+`,
+		},
+		"drop label": {
+			config: Config{DropLabels: []string{"serial"}},
+			want: `seachest_block_device_capacity_bytes blockdevicename=bd-1
+seachest_block_device_current_temperature_celsius blockdevicename=bd-1
+seachest_block_device_current_temperature_celsius blockdevicename=bd-2
+`,
+		},
+		"duplicate gauges after dropping labels": {
+			config: Config{DropLabels: []string{"blockdevicename", "serial"}},
+			want: `seachest_block_device_capacity_bytes
+`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.want, gather(t, test.config))
+		})
+	}
+}
+
+func TestGathererExposition(t *testing.T) {
+	SetHashKey([]byte("test"))
+	defer SetHashKey(nil)
+	gatherer, err := NewGatherer(newTestRegistry(), Config{
+		Include:     []string{".*temperature.*"},
+		HashLabels:  []string{"serial"},
+		HashKeyFile: "key",
+	})
+	require.NoError(t, err)
+	want := `
+# HELP seachest_block_device_current_temperature_celsius Current reported temperature of the blockdevice
+# TYPE seachest_block_device_current_temperature_celsius gauge
+seachest_block_device_current_temperature_celsius{blockdevicename="bd-1",serial="` + Hash("S1") + `"} 30
+seachest_block_device_current_temperature_celsius{blockdevicename="bd-2",serial="` + Hash("S2") + `"} 40
+`
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(want)))
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{Include: []string{"ndm_.*"}, HashLabels: []string{"serial"}, HashKeyFile: "key"}.Validate())
+	assert.Error(t, Config{Include: []string{"ndm_.*"}, HashLabels: []string{"serial"}}.Validate())
+	assert.Error(t, Config{Exclude: []string{"ndm_("}}.Validate())
+	assert.Error(t, Config{DropLabels: []string{"serial"}, HashLabels: []string{"serial"}, HashKeyFile: "key"}.Validate())
+	assert.NoError(t, Config{MaxDevices: 100, MaxLabelValues: map[string]int{"mountpoint": 10}}.Validate())
+	assert.Error(t, Config{MaxDevices: -1}.Validate())
+	assert.Error(t, Config{MaxLabelValues: map[string]int{"mountpoint": 0}}.Validate())
+}
+
+func TestHash(t *testing.T) {
+	defer SetHashKey(nil)
+	// the serials are not exposed without a key
+	assert.Equal(t, "", Hash("S1"))
+
+	dir, err := ioutil.TempDir("", "ndm-filter")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("key1\n"), 0600))
+	require.NoError(t, Config{HashKeyFile: keyFile}.LoadHashKey())
+	assert.Equal(t, "", Hash(""))
+	assert.Len(t, Hash("S1"), hashLength)
+	assert.Equal(t, Hash("S1"), Hash("S1"))
+	assert.NotEqual(t, Hash("S1"), Hash("S2"))
+
+	// the hash depends on the key
+	hash := Hash("S1")
+	SetHashKey([]byte("key2"))
+	assert.NotEqual(t, hash, Hash("S1"))
+
+	require.NoError(t, ioutil.WriteFile(keyFile, nil, 0600))
+	assert.Error(t, Config{HashKeyFile: keyFile}.LoadHashKey())
+}
+
+func TestGathererCollisions(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	reads := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_block_device_reads_total",
+		Help: "Reads of the blockdevice",
+	}, []string{"blockdevice", "serial"})
+	reads.WithLabelValues("bd-1", "S1").Add(1)
+	reads.WithLabelValues("bd-1", "S2").Add(2)
+	registry.MustRegister(reads)
+
+	gatherer, err := NewGatherer(registry, Config{DropLabels: []string{"serial"}})
+	require.NoError(t, err)
+	want := `
+# HELP node_block_device_reads_total Reads of the blockdevice
+# TYPE node_block_device_reads_total counter
+node_block_device_reads_total{blockdevice="bd-1"} 3
+`
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(want)))
+	assert.True(t, gatherer.collisions["node_block_device_reads_total"])
+}
+
+func TestGathererLimits(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	info := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_block_device_info",
+		Help: "Info of the blockdevice",
+	}, []string{"blockdevice", "node", "path"})
+	info.WithLabelValues("bd-1", "node1", "sda").Set(1)
+	info.WithLabelValues("bd-2", "node1", "sdb").Set(1)
+	info.WithLabelValues("bd-3", "node1", "sdc").Set(1)
+	info.WithLabelValues("bd-4", "node2", "sda").Set(1)
+	reads := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_block_device_reads_total",
+		Help: "Reads of the blockdevice",
+	}, []string{"blockdevice", "mountpoint"})
+	reads.WithLabelValues("bd-1", "/data").Add(1)
+	reads.WithLabelValues("bd-1", "/logs").Add(2)
+	reads.WithLabelValues("bd-1", "/tmp").Add(4)
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "node_block_device_latency_seconds",
+		Help:    "Latency of the blockdevice",
+		Buckets: []float64{1},
+	}, []string{"blockdevice"})
+	latency.WithLabelValues("bd-1").Observe(0.5)
+	latency.WithLabelValues("bd-2").Observe(0.5)
+	latency.WithLabelValues("bd-3").Observe(2)
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_block_device_temperature_celsius",
+		Help: "Temperature of the blockdevice",
+	}, []string{"blockdevice", "node"})
+	temperature.WithLabelValues("bd-1", "node1").Set(30)
+	temperature.WithLabelValues("bd-2", "node1").Set(40)
+	temperature.WithLabelValues("bd-3", "node1").Set(50)
+	temperature.WithLabelValues("bd-4", "node2").Set(60)
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "up", Help: "Exporter is up"})
+	up.Set(1)
+	registry.MustRegister(info, reads, latency, temperature, up)
+
+	gatherer, err := NewGatherer(registry, Config{
+		MaxDevices:     1,
+		MaxLabelValues: map[string]int{"mountpoint": 2},
+	})
+	require.NoError(t, err)
+	want := `
+# HELP node_block_device_info Info of the blockdevice
+# TYPE node_block_device_info gauge
+node_block_device_info{blockdevice="bd-1",node="node1",path="sda"} 1
+node_block_device_info{blockdevice="other",node="node1",path="other"} 2
+node_block_device_info{blockdevice="other",node="node2",path="other"} 1
+# HELP node_block_device_latency_seconds Latency of the blockdevice
+# TYPE node_block_device_latency_seconds histogram
+node_block_device_latency_seconds_bucket{blockdevice="bd-1",le="1"} 1
+node_block_device_latency_seconds_bucket{blockdevice="bd-1",le="+Inf"} 1
+node_block_device_latency_seconds_sum{blockdevice="bd-1"} 0.5
+node_block_device_latency_seconds_count{blockdevice="bd-1"} 1
+node_block_device_latency_seconds_bucket{blockdevice="other",le="1"} 1
+node_block_device_latency_seconds_bucket{blockdevice="other",le="+Inf"} 2
+node_block_device_latency_seconds_sum{blockdevice="other"} 2.5
+node_block_device_latency_seconds_count{blockdevice="other"} 2
+# HELP node_block_device_reads_total Reads of the blockdevice
+# TYPE node_block_device_reads_total counter
+node_block_device_reads_total{blockdevice="bd-1",mountpoint="/data"} 1
+node_block_device_reads_total{blockdevice="bd-1",mountpoint="/logs"} 2
+node_block_device_reads_total{blockdevice="bd-1",mountpoint="other"} 4
+# HELP node_block_device_temperature_celsius Temperature of the blockdevice
+# TYPE node_block_device_temperature_celsius gauge
+node_block_device_temperature_celsius{blockdevice="bd-1",node="node1"} 30
+node_block_device_temperature_celsius{blockdevice="other",node="node2"} 60
+# HELP up Exporter is up
+# TYPE up gauge
+up 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(want)))
+}
+
+func TestGathererLimitsStable(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	reads := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_block_device_reads_total",
+		Help: "Reads of the blockdevice",
+	}, []string{"blockdevice"})
+	reads.WithLabelValues("bd-2").Add(1)
+	reads.WithLabelValues("bd-3").Add(2)
+	registry.MustRegister(reads)
+
+	gatherer, err := NewGatherer(registry, Config{MaxDevices: 1})
+	require.NoError(t, err)
+	want := `
+# HELP node_block_device_reads_total Reads of the blockdevice
+# TYPE node_block_device_reads_total counter
+node_block_device_reads_total{blockdevice="bd-2"} 1
+node_block_device_reads_total{blockdevice="other"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(want)))
+
+	// a new device which sorts first does not replace the device that is kept
+	reads.WithLabelValues("bd-1").Add(4)
+	want = `
+# HELP node_block_device_reads_total Reads of the blockdevice
+# TYPE node_block_device_reads_total counter
+node_block_device_reads_total{blockdevice="bd-2"} 1
+node_block_device_reads_total{blockdevice="other"} 6
+`
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(want)))
+
+	// the next device is kept once the kept device is removed
+	reads.DeleteLabelValues("bd-2")
+	want = `
+# HELP node_block_device_reads_total Reads of the blockdevice
+# TYPE node_block_device_reads_total counter
+node_block_device_reads_total{blockdevice="bd-1"} 4
+node_block_device_reads_total{blockdevice="other"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(gatherer, strings.NewReader(want)))
+}
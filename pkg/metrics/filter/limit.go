@@ -0,0 +1,261 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/klog"
+)
+
+// OtherValue is the value of the labels of the metrics aggregated over the limits
+const OtherValue = "other"
+
+// DefaultDeviceLabels are the labels which identify the device of a metric, same
+// as the device labels of the exporter except the node, so that the devices over
+// the limit are aggregated per node. The legacy blockdevicename label is included,
+// so that the devices are aggregated when the legacy labels are enabled.
+var DefaultDeviceLabels = []string{"blockdevice", "path", "model", "serial_hash", "drive_type", "blockdevicename"}
+
+// limit is the max no. of distinct values of a set of labels in a family
+type limit struct {
+	labels map[string]bool
+	max    int
+
+	// kept are the values of the labels that were kept in the last gather, keyed
+	// by the family, so that the same series are kept as long as they exist
+	mutex sync.Mutex
+	kept  map[string]map[string]bool
+}
+
+// setLimits sets the limits on the cardinality of the metrics from the config
+func (g *Gatherer) setLimits(config Config) error {
+	if config.MaxDevices < 0 {
+		return fmt.Errorf("invalid max devices %d, must not be negative", config.MaxDevices)
+	}
+	if config.MaxDevices > 0 {
+		deviceLabels := config.DeviceLabels
+		if len(deviceLabels) == 0 {
+			deviceLabels = DefaultDeviceLabels
+		}
+		g.limits = append(g.limits, newLimit(deviceLabels, config.MaxDevices))
+	}
+
+	labels := make([]string, 0, len(config.MaxLabelValues))
+	for label := range config.MaxLabelValues {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		max := config.MaxLabelValues[label]
+		if max <= 0 {
+			return fmt.Errorf("invalid max values %d of label %s, must be greater than 0", max, label)
+		}
+		g.limits = append(g.limits, newLimit([]string{label}, max))
+	}
+	return nil
+}
+
+func newLimit(labels []string, max int) *limit {
+	l := &limit{labels: make(map[string]bool), max: max, kept: make(map[string]map[string]bool)}
+	for _, label := range labels {
+		l.labels[label] = true
+	}
+	return l
+}
+
+// limitCardinality collapses the label values of the metrics of the family over
+// the limits, and merges the metrics which are no longer unique
+func (g *Gatherer) limitCardinality(family *dto.MetricFamily) {
+	collapsed := false
+	for _, l := range g.limits {
+		if l.collapse(family) {
+			collapsed = true
+		}
+	}
+	if collapsed {
+		mergeMetrics(family)
+	}
+}
+
+// collapse sets the labels of the limit to OtherValue in the metrics, except
+// in the metrics having the values of the labels that are kept. The values kept
+// in the last gather are kept as long as they exist, and the remaining are
+// filled with the first values in sorted order, so that the kept series do not
+// change when the devices come and go. The metrics without the labels are not
+// changed. It returns true if any of the metrics were changed.
+func (l *limit) collapse(family *dto.MetricFamily) bool {
+	keys := make([]string, len(family.Metric))
+	distinct := make(map[string]bool)
+	for i, metric := range family.Metric {
+		pairs := make([]string, 0, len(l.labels))
+		for _, label := range metric.Label {
+			if l.labels[label.GetName()] {
+				pairs = append(pairs, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+			}
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+		keys[i] = strings.Join(pairs, ",")
+		distinct[keys[i]] = true
+	}
+	if len(distinct) == 0 {
+		return false
+	}
+	kept := l.keep(family.GetName(), distinct)
+	if len(distinct) <= l.max {
+		return false
+	}
+	klog.V(4).Infof("metric %s has %d values of the limited labels, aggregating the metrics over %d",
+		family.GetName(), len(distinct), l.max)
+
+	for i, metric := range family.Metric {
+		if len(keys[i]) == 0 || kept[keys[i]] {
+			continue
+		}
+		// the label pairs are shared with the collected metrics, and are not changed
+		labels := make([]*dto.LabelPair, 0, len(metric.Label))
+		for _, label := range metric.Label {
+			if l.labels[label.GetName()] {
+				label = &dto.LabelPair{Name: label.Name, Value: stringPtr(OtherValue)}
+			}
+			labels = append(labels, label)
+		}
+		metric.Label = labels
+	}
+	return true
+}
+
+// keep returns the values of the labels that are kept in the family, and saves
+// them for the next gather
+func (l *limit) keep(name string, distinct map[string]bool) map[string]bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	kept := make(map[string]bool, l.max)
+	for key := range l.kept[name] {
+		if distinct[key] {
+			kept[key] = true
+		}
+	}
+	if len(kept) < l.max {
+		sorted := make([]string, 0, len(distinct))
+		for key := range distinct {
+			if !kept[key] {
+				sorted = append(sorted, key)
+			}
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			if len(kept) == l.max {
+				break
+			}
+			kept[key] = true
+		}
+	}
+	l.kept[name] = kept
+	return kept
+}
+
+// mergeMetrics merges the metrics of the family having the same labels. The
+// counters, histograms and summaries are summed, except the quantiles of the
+// summaries which cannot be summed, and are removed. The sum of the values of
+// gauges, eg: temperatures, is not meaningful, so the gauges having the same
+// labels are dropped, except the info gauges whose sum is the no. of series.
+func mergeMetrics(family *dto.MetricFamily) {
+	groups := make(map[string][]*dto.Metric)
+	keys := make([]string, 0, len(family.Metric))
+	for _, metric := range family.Metric {
+		key := labelsKey(metric.Label)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], metric)
+	}
+
+	metrics := make([]*dto.Metric, 0, len(keys))
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) == 1 {
+			metrics = append(metrics, group[0])
+			continue
+		}
+		if !isAdditive(family) {
+			klog.V(4).Infof("dropping %d metrics %s{%s} which cannot be summed", len(group), family.GetName(), key)
+			continue
+		}
+		into := group[0]
+		for _, metric := range group[1:] {
+			addMetric(into, metric)
+		}
+		if into.Summary != nil {
+			into.Summary.Quantile = nil
+		}
+		metrics = append(metrics, into)
+	}
+	// the metrics are exposed in the order of their labels, as by the registry
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return labelsKey(metrics[i].Label) < labelsKey(metrics[j].Label)
+	})
+	family.Metric = metrics
+}
+
+// isAdditive returns true if the metrics of the family can be summed
+func isAdditive(family *dto.MetricFamily) bool {
+	switch family.GetType() {
+	case dto.MetricType_COUNTER, dto.MetricType_HISTOGRAM, dto.MetricType_SUMMARY:
+		return true
+	case dto.MetricType_GAUGE:
+		return strings.HasSuffix(family.GetName(), "_info")
+	}
+	return false
+}
+
+// addMetric adds the value of the metric to the value of into
+func addMetric(into, metric *dto.Metric) {
+	switch {
+	case into.Counter != nil && metric.Counter != nil:
+		into.Counter.Value = float64Ptr(into.Counter.GetValue() + metric.Counter.GetValue())
+	case into.Gauge != nil && metric.Gauge != nil:
+		into.Gauge.Value = float64Ptr(into.Gauge.GetValue() + metric.Gauge.GetValue())
+	case into.Summary != nil && metric.Summary != nil:
+		into.Summary.SampleCount = uint64Ptr(into.Summary.GetSampleCount() + metric.Summary.GetSampleCount())
+		into.Summary.SampleSum = float64Ptr(into.Summary.GetSampleSum() + metric.Summary.GetSampleSum())
+	case into.Histogram != nil && metric.Histogram != nil:
+		into.Histogram.SampleCount = uint64Ptr(into.Histogram.GetSampleCount() + metric.Histogram.GetSampleCount())
+		into.Histogram.SampleSum = float64Ptr(into.Histogram.GetSampleSum() + metric.Histogram.GetSampleSum())
+		// the metrics of a family have the same buckets
+		for i, bucket := range into.Histogram.Bucket {
+			if i < len(metric.Histogram.Bucket) {
+				bucket.CumulativeCount = uint64Ptr(bucket.GetCumulativeCount() +
+					metric.Histogram.Bucket[i].GetCumulativeCount())
+			}
+		}
+	}
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func uint64Ptr(u uint64) *uint64 {
+	return &u
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package labels has the labels that are set on the metrics of each device,
+// so that the metrics from the different collectors can be joined with each
+// other, and with the metrics of node exporter and kube-state-metrics.
+package labels
+
+import (
+	"strings"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+)
+
+const (
+	// BlockDevice is the name of the blockdevice resource
+	BlockDevice = "blockdevice"
+	// Node is the name of the kubernetes node to which the device is attached
+	Node = "node"
+	// Path is the device path without /dev/, same as the device label of
+	// the node exporter metrics
+	Path = "path"
+	// Model is the model of the device
+	Model = "model"
+	// SerialHash is the hash of the serial number of the device. The hash is
+	// used so that the serial numbers are not exposed.
+	SerialHash = "serial_hash"
+	// DriveType is the type of the drive, HDD/SSD
+	DriveType = "drive_type"
+)
+
+const (
+	// LegacyBlockDevice, LegacyNode and LegacyHostName are the labels of the
+	// blockdevice, the node name and the hostname on the device metrics of the
+	// earlier releases
+	LegacyBlockDevice = "blockdevicename"
+	LegacyNode        = "nodename"
+	LegacyHostName    = "hostname"
+)
+
+// DeviceLabels are the labels set on the metrics of each device
+var DeviceLabels = []string{BlockDevice, Node, Path, Model, SerialHash, DriveType}
+
+// LegacyDeviceLabels are the labels of the earlier releases which are also set
+// on the metrics of each device if LegacyLabels is enabled
+var LegacyDeviceLabels = []string{LegacyBlockDevice, LegacyNode, LegacyHostName}
+
+// LegacyLabels enables LegacyDeviceLabels, so that the dashboards and alerts
+// using them keep working till they are migrated. Deprecated, the legacy
+// labels will be removed in the next release.
+var LegacyLabels = false
+
+// DeviceLabelNames returns the labels set on the metrics of each device, which
+// are DeviceLabels along with LegacyDeviceLabels if enabled
+func DeviceLabelNames() []string {
+	names := append([]string{}, DeviceLabels...)
+	if LegacyLabels {
+		names = append(names, LegacyDeviceLabels...)
+	}
+	return names
+}
+
+// DeviceLabelValues returns the values of DeviceLabelNames for the blockdevice
+func DeviceLabelValues(bd blockdevice.BlockDevice) []string {
+	nodeName := bd.NodeAttributes[blockdevice.NodeName]
+	hostName := bd.NodeAttributes[blockdevice.HostName]
+	values := []string{
+		bd.UUID,
+		NodeName(nodeName, hostName),
+		DevicePath(bd.DevPath),
+		bd.DeviceAttributes.Model,
+		filter.Hash(bd.DeviceAttributes.Serial),
+		bd.DeviceAttributes.DriveType,
+	}
+	return append(values, LegacyLabelValues(bd.UUID, nodeName, hostName)...)
+}
+
+// LegacyLabelValues returns the values of LegacyDeviceLabels, nil if they are
+// not enabled
+func LegacyLabelValues(uuid, nodeName, hostName string) []string {
+	if !LegacyLabels {
+		return nil
+	}
+	return []string{uuid, nodeName, hostName}
+}
+
+// NodeName returns the name of the node, or the hostname if the node name is not set
+func NodeName(nodeName, hostName string) string {
+	if len(nodeName) != 0 {
+		return nodeName
+	}
+	return hostName
+}
+
+// DevicePath removes /dev from the device path so that the device path is
+// similar to the path given by node exporter
+func DevicePath(path string) string {
+	return strings.ReplaceAll(path, "/dev/", "")
+}
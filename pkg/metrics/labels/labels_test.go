@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package labels
+
+import (
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceLabelValues(t *testing.T) {
+	filter.SetHashKey([]byte("test"))
+	defer filter.SetHashKey(nil)
+	bd := blockdevice.BlockDevice{
+		Identifier: blockdevice.Identifier{
+			UUID:    "blockdevice-1",
+			DevPath: "/dev/nvme0n1",
+		},
+		NodeAttributes: blockdevice.NodeAttribute{
+			blockdevice.HostName: "host-1",
+			blockdevice.NodeName: "node-1",
+		},
+	}
+	bd.DeviceAttributes.Model = "fake-model"
+	bd.DeviceAttributes.Serial = "fake-serial"
+	bd.DeviceAttributes.DriveType = blockdevice.DriveTypeSSD
+
+	serialHash := filter.Hash("fake-serial")
+	assert.NotEmpty(t, serialHash)
+	values := DeviceLabelValues(bd)
+	assert.Len(t, values, len(DeviceLabels))
+	assert.Equal(t, []string{"blockdevice-1", "node-1", "nvme0n1", "fake-model",
+		serialHash, blockdevice.DriveTypeSSD}, values)
+
+	// the legacy labels are set from the node attributes as in the earlier releases
+	LegacyLabels = true
+	defer func() { LegacyLabels = false }()
+	values = DeviceLabelValues(bd)
+	assert.Len(t, values, len(DeviceLabelNames()))
+	assert.Equal(t, []string{"blockdevice-1", "node-1", "host-1"}, values[len(DeviceLabels):])
+
+	// the hostname is used if the node name is not set
+	delete(bd.NodeAttributes, blockdevice.NodeName)
+	assert.Equal(t, "host-1", DeviceLabelValues(bd)[1])
+	assert.Equal(t, "", DeviceLabelValues(bd)[len(DeviceLabels)+1])
+}
+
+func TestDefaultDeviceLabels(t *testing.T) {
+	// the devices over the limit are aggregated by all the device labels, including
+	// the legacy labels, except the node
+	var deviceLabels []string
+	for _, label := range append(DeviceLabels, LegacyDeviceLabels...) {
+		if label != Node && label != LegacyNode && label != LegacyHostName {
+			deviceLabels = append(deviceLabels, label)
+		}
+	}
+	assert.Equal(t, deviceLabels, filter.DefaultDeviceLabels)
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// NVMeNamespace is the namespace of the metrics from the NVMe health log
+	NVMeNamespace = "nvme"
+)
+
+// Metrics is the prometheus metrics of the NVMe health log, exposed by the exporter
+type Metrics struct {
+	criticalWarning         *prometheus.GaugeVec
+	temperature             *prometheus.GaugeVec
+	availableSpare          *prometheus.GaugeVec
+	availableSpareThreshold *prometheus.GaugeVec
+	percentageUsed          *prometheus.GaugeVec
+	readBytes               *prometheus.GaugeVec
+	writtenBytes            *prometheus.GaugeVec
+	powerCycles             *prometheus.GaugeVec
+	powerOnHours            *prometheus.GaugeVec
+	unsafeShutdowns         *prometheus.GaugeVec
+	mediaErrors             *prometheus.GaugeVec
+	errorLogEntries         *prometheus.GaugeVec
+
+	// the results of the device self-tests, by the type of the test
+	selfTestLastResult *prometheus.GaugeVec
+	selfTestHoursSince *prometheus.GaugeVec
+	selfTestProgress   *prometheus.GaugeVec
+
+	// the counters of the errors are kept by the collector, and exposed as
+	// constant metrics, so that the counters of the removed devices are dropped
+	errorLogErrors *prometheus.Desc
+	asyncEvents    *prometheus.Desc
+
+	// errors and rejected requests
+	rejectRequestCount prometheus.Counter
+	errorRequestCount  prometheus.Counter
+}
+
+// newGaugeVec returns a gauge of the NVMe health log labelled with the device,
+// along with the extra labels if any
+func newGaugeVec(name, help string, extraLabels ...string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NVMeNamespace,
+			Name:      name,
+			Help:      help,
+		},
+		append(labels.DeviceLabelNames(), extraLabels...),
+	)
+}
+
+// NewMetrics creates instance of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		criticalWarning: newGaugeVec("critical_warning",
+			`Bitmap of the critical warnings of the controller. 0 if there are no warnings`),
+		temperature: newGaugeVec("temperature_celsius",
+			`Composite temperature of the controller`),
+		availableSpare: newGaugeVec("available_spare_percent",
+			`Percentage of the remaining spare capacity`),
+		availableSpareThreshold: newGaugeVec("available_spare_threshold_percent",
+			`Available spare below which a critical warning is raised`),
+		percentageUsed: newGaugeVec("endurance_used_percent",
+			`Estimate of the percentage of the device life that has been used`),
+		readBytes: newGaugeVec("read_bytes",
+			`No. of bytes read by the host, reset only by the device`),
+		writtenBytes: newGaugeVec("written_bytes",
+			`No. of bytes written by the host, reset only by the device`),
+		powerCycles: newGaugeVec("power_cycles",
+			`No. of power cycles of the controller`),
+		powerOnHours: newGaugeVec("power_on_hours",
+			`No. of power-on hours of the controller`),
+		unsafeShutdowns: newGaugeVec("unsafe_shutdowns",
+			`No. of unsafe shutdowns of the controller`),
+		mediaErrors: newGaugeVec("media_errors",
+			`No. of unrecovered data integrity errors`),
+		errorLogEntries: newGaugeVec("error_log_entries",
+			`No. of error information log entries`),
+		selfTestLastResult: newGaugeVec("selftest_last_result",
+			`1 for the result of the latest device self-test of each type (passed / failed / aborted)`,
+			"test", "result"),
+		selfTestHoursSince: newGaugeVec("selftest_hours_since_last",
+			`Power-on hours since the latest device self-test of each type completed`,
+			"test"),
+		selfTestProgress: newGaugeVec("selftest_progress_percent",
+			`Percentage of the device self-test in progress that is complete`,
+			"test"),
+		errorLogErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(NVMeNamespace, "", "error_log_errors_total"),
+			`No. of errors read from the error information log, by the type of the status code of the error`,
+			append(labels.DeviceLabelNames(), "status_type"), nil),
+		asyncEvents: prometheus.NewDesc(
+			prometheus.BuildFQName(NVMeNamespace, "", "async_events_total"),
+			`No. of asynchronous events reported by the controller since the exporter started, by the type of the event`,
+			append(labels.DeviceLabelNames(), "type"), nil),
+		rejectRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: NVMeNamespace,
+				Name:      "reject_request_count",
+				Help:      `No. of requests rejected by the exporter`,
+			}),
+		errorRequestCount: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: NVMeNamespace,
+				Name:      "error_request_count",
+				Help:      `No. of requests errored out by the exporter`,
+			}),
+	}
+}
+
+// Collectors lists out all the collectors for which the metrics is exposed
+func (m *Metrics) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.criticalWarning,
+		m.temperature,
+		m.availableSpare,
+		m.availableSpareThreshold,
+		m.percentageUsed,
+		m.readBytes,
+		m.writtenBytes,
+		m.powerCycles,
+		m.powerOnHours,
+		m.unsafeShutdowns,
+		m.mediaErrors,
+		m.errorLogEntries,
+		m.selfTestLastResult,
+		m.selfTestHoursSince,
+		m.selfTestProgress,
+		m.rejectRequestCount,
+		m.errorRequestCount,
+	}
+}
+
+// Descs lists out the descriptions of the constant metrics of the errors
+func (m *Metrics) Descs() []*prometheus.Desc {
+	return []*prometheus.Desc{m.errorLogErrors, m.asyncEvents}
+}
+
+// ErrorLogMetrics returns the counters of the errors read from the error
+// information log of the blockdevice, keyed by the type of the status code
+func (m *Metrics) ErrorLogMetrics(bd blockdevice.BlockDevice, errors map[string]uint64) []prometheus.Metric {
+	labelValues := labels.DeviceLabelValues(bd)
+	metrics := make([]prometheus.Metric, 0, len(errors))
+	for statusType, count := range errors {
+		metrics = append(metrics, prometheus.MustNewConstMetric(m.errorLogErrors,
+			prometheus.CounterValue, float64(count), append(labelValues, statusType)...))
+	}
+	return metrics
+}
+
+// AsyncEventMetrics returns the counters of the asynchronous events of the
+// controller of the blockdevice, keyed by the type of the event
+func (m *Metrics) AsyncEventMetrics(bd blockdevice.BlockDevice, events map[string]uint64) []prometheus.Metric {
+	labelValues := labels.DeviceLabelValues(bd)
+	metrics := make([]prometheus.Metric, 0, len(events))
+	for eventType, count := range events {
+		metrics = append(metrics, prometheus.MustNewConstMetric(m.asyncEvents,
+			prometheus.CounterValue, float64(count), append(labelValues, eventType)...))
+	}
+	return metrics
+}
+
+// ErrorCollectors lists out all collectors for metrics related to error
+func (m *Metrics) ErrorCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.rejectRequestCount,
+		m.errorRequestCount,
+	}
+}
+
+// IncRejectRequestCounter increments the reject request error counter
+func (m *Metrics) IncRejectRequestCounter() {
+	m.rejectRequestCount.Inc()
+}
+
+// IncErrorRequestCounter increments the no of requests errored out.
+func (m *Metrics) IncErrorRequestCounter() {
+	m.errorRequestCount.Inc()
+}
+
+// Reset clears the health log and self-test gauges of all the NVMe devices, so
+// that a device whose log could not be read is not exposed with stale values
+func (m *Metrics) Reset() {
+	for _, gauge := range []*prometheus.GaugeVec{m.criticalWarning, m.temperature,
+		m.availableSpare, m.availableSpareThreshold, m.percentageUsed, m.readBytes,
+		m.writtenBytes, m.powerCycles, m.powerOnHours, m.unsafeShutdowns,
+		m.mediaErrors, m.errorLogEntries, m.selfTestLastResult, m.selfTestHoursSince,
+		m.selfTestProgress} {
+		gauge.Reset()
+	}
+}
+
+// SetMetrics sets the health log of the blockdevice to the metrics
+func (m *Metrics) SetMetrics(bd blockdevice.BlockDevice, healthLog nvme.HealthLog) {
+	labelValues := labels.DeviceLabelValues(bd)
+	m.criticalWarning.WithLabelValues(labelValues...).Set(float64(healthLog.CriticalWarning))
+	m.temperature.WithLabelValues(labelValues...).Set(float64(healthLog.TemperatureCelsius()))
+	m.availableSpare.WithLabelValues(labelValues...).Set(float64(healthLog.AvailableSpare))
+	m.availableSpareThreshold.WithLabelValues(labelValues...).Set(float64(healthLog.AvailableSpareThreshold))
+	m.percentageUsed.WithLabelValues(labelValues...).Set(float64(healthLog.PercentageUsed))
+	m.readBytes.WithLabelValues(labelValues...).Set(float64(healthLog.BytesRead()))
+	m.writtenBytes.WithLabelValues(labelValues...).Set(float64(healthLog.BytesWritten()))
+	m.powerCycles.WithLabelValues(labelValues...).Set(float64(healthLog.PowerCycles))
+	m.powerOnHours.WithLabelValues(labelValues...).Set(float64(healthLog.PowerOnHours))
+	m.unsafeShutdowns.WithLabelValues(labelValues...).Set(float64(healthLog.UnsafeShutdowns))
+	m.mediaErrors.WithLabelValues(labelValues...).Set(float64(healthLog.MediaErrors))
+	m.errorLogEntries.WithLabelValues(labelValues...).Set(float64(healthLog.ErrorLogEntries))
+}
+
+// SetSelfTestMetrics sets the results of the latest device self-test of each type
+// of the blockdevice, and the progress of the test in progress. The hours since
+// a test are computed from the current power-on hours of the controller.
+func (m *Metrics) SetSelfTestMetrics(bd blockdevice.BlockDevice, log nvme.SelfTestLog, powerOnHours uint64) {
+	labelValues := labels.DeviceLabelValues(bd)
+	seen := make(map[string]bool)
+	for _, result := range log.Results {
+		test := result.Test()
+		// the results are ordered from the latest to the oldest
+		if seen[test] {
+			continue
+		}
+		seen[test] = true
+		m.selfTestLastResult.WithLabelValues(append(labelValues, test, result.Result())...).Set(1)
+		hours := uint64(0)
+		if powerOnHours > result.PowerOnHours {
+			hours = powerOnHours - result.PowerOnHours
+		}
+		m.selfTestHoursSince.WithLabelValues(append(labelValues, test)...).Set(float64(hours))
+	}
+	if log.InProgress() {
+		m.selfTestProgress.WithLabelValues(append(labelValues, log.CurrentTest())...).
+			Set(float64(log.CurrentCompletion))
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/nvme"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSelfTestMetrics(t *testing.T) {
+	bd := blockdevice.BlockDevice{}
+	bd.UUID = "blockdevice-1"
+	bd.DevPath = "/dev/nvme0n1"
+	bd.NodeAttributes = blockdevice.NodeAttribute{blockdevice.NodeName: "node1"}
+
+	m := NewMetrics()
+	m.SetSelfTestMetrics(bd, nvme.SelfTestLog{
+		CurrentOperation:  1,
+		CurrentCompletion: 30,
+		Results: []nvme.SelfTestResult{
+			{Code: 1, Status: 0, PowerOnHours: 1190},
+			{Code: 2, Status: 7, PowerOnHours: 1000},
+			// older results of a type are not reported
+			{Code: 1, Status: 7, PowerOnHours: 900},
+		},
+	}, 1200)
+
+	labels := `blockdevice="blockdevice-1",drive_type="",model="",node="node1",path="nvme0n1",serial_hash=""`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.selfTestLastResult, m.selfTestHoursSince, m.selfTestProgress)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP nvme_selftest_hours_since_last Power-on hours since the latest device self-test of each type completed
+# TYPE nvme_selftest_hours_since_last gauge
+nvme_selftest_hours_since_last{`+labels+`,test="extended"} 200
+nvme_selftest_hours_since_last{`+labels+`,test="short"} 10
+# HELP nvme_selftest_last_result 1 for the result of the latest device self-test of each type (passed / failed / aborted)
+# TYPE nvme_selftest_last_result gauge
+nvme_selftest_last_result{blockdevice="blockdevice-1",drive_type="",model="",node="node1",path="nvme0n1",result="failed",serial_hash="",test="extended"} 1
+nvme_selftest_last_result{blockdevice="blockdevice-1",drive_type="",model="",node="node1",path="nvme0n1",result="passed",serial_hash="",test="short"} 1
+# HELP nvme_selftest_progress_percent Percentage of the device self-test in progress that is complete
+# TYPE nvme_selftest_progress_percent gauge
+nvme_selftest_progress_percent{`+labels+`,test="short"} 30
+`)))
+
+	m.Reset()
+	assert.Equal(t, 0, testutil.CollectAndCount(m.selfTestLastResult))
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package openmetrics serves the metrics in the OpenMetrics format to the
+// scrapers which accept it, with a _created series for each counter and the
+// exemplars of the histograms. The other scrapers get the metrics in the
+// Prometheus text format as before.
+package openmetrics
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/klog"
+)
+
+const (
+	// TraceIDLabel is the label of the exemplars which links the observation
+	// to the trace of the operation
+	TraceIDLabel = "trace_id"
+
+	// totalSuffix is the suffix of the names of the counters, which is replaced
+	// with createdSuffix in the name of the _created series
+	totalSuffix   = "_total"
+	createdSuffix = "_created"
+)
+
+// ObserveWithTraceID observes the value, with the trace id as the exemplar if
+// it is not empty. The trace id is empty when tracing is disabled.
+func ObserveWithTraceID(observer prometheus.Observer, value float64, traceID string) {
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && len(traceID) != 0 {
+		exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{TraceIDLabel: traceID})
+		return
+	}
+	observer.Observe(value)
+}
+
+// handler serves the metrics of the gatherer in the negotiated format
+type handler struct {
+	gatherer prometheus.Gatherer
+	// fallback serves the metrics to the scrapers which do not accept OpenMetrics
+	fallback http.Handler
+	created  *createdTracker
+}
+
+// HandlerFor returns a handler which serves the metrics of the gatherer in the
+// OpenMetrics format if the scraper accepts it, and in the Prometheus text
+// format otherwise. The counters present when the handler is created are
+// considered to be created at that time.
+func HandlerFor(gatherer prometheus.Gatherer) http.Handler {
+	return &handler{
+		gatherer: gatherer,
+		fallback: promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}),
+		created:  newCreatedTracker(time.Now()),
+	}
+}
+
+// ServeHTTP implements the http.Handler interface
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	if format != expfmt.FmtOpenMetrics {
+		h.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	families, err := h.gatherer.Gather()
+	if err != nil {
+		http.Error(w, "An error has occurred while serving metrics:\n\n"+err.Error(),
+			http.StatusInternalServerError)
+		return
+	}
+	created := h.created.update(families, time.Now())
+
+	w.Header().Set("Content-Type", string(format))
+	out := io.Writer(w)
+	if gzipAccepted(r.Header) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	if err := Write(out, families, created); err != nil {
+		klog.Errorf("error writing metrics: %v", err)
+	}
+}
+
+func gzipAccepted(header http.Header) bool {
+	for _, part := range strings.Split(header.Get("Accept-Encoding"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes the metric families in the OpenMetrics format, followed by the
+// EOF marker. The _created series of a counter is written after the counter
+// if its creation time is present in created, keyed by SeriesKey.
+func Write(w io.Writer, families []*dto.MetricFamily, created map[string]time.Time) error {
+	for _, family := range families {
+		if err := writeFamily(w, family, created); err != nil {
+			return err
+		}
+	}
+	_, err := expfmt.FinalizeOpenMetrics(w)
+	return err
+}
+
+// writeFamily writes the metric family. The encoder does not support the
+// _created series, so they are encoded as a gauge family and the samples of
+// the two families are interleaved.
+func writeFamily(w io.Writer, family *dto.MetricFamily, created map[string]time.Time) error {
+	name := family.GetName()
+	// counters without the _total suffix are exposed as unknown, which do not
+	// have a _created series
+	if family.GetType() != dto.MetricType_COUNTER || !strings.HasSuffix(name, totalSuffix) {
+		_, err := expfmt.MetricFamilyToOpenMetrics(w, family)
+		return err
+	}
+
+	createdFamily := &dto.MetricFamily{
+		Name: stringPtr(strings.TrimSuffix(name, totalSuffix) + createdSuffix),
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	createdSamples := make([]bool, len(family.Metric))
+	for i, metric := range family.Metric {
+		createdAt, ok := created[SeriesKey(name, metric.Label)]
+		if !ok {
+			continue
+		}
+		createdFamily.Metric = append(createdFamily.Metric, &dto.Metric{
+			Label: metric.Label,
+			Gauge: &dto.Gauge{Value: float64Ptr(float64(createdAt.UnixNano()) / 1e9)},
+		})
+		createdSamples[i] = true
+	}
+
+	var counterBuf, createdBuf bytes.Buffer
+	if _, err := expfmt.MetricFamilyToOpenMetrics(&counterBuf, family); err != nil {
+		return err
+	}
+	if len(createdFamily.Metric) != 0 {
+		if _, err := expfmt.MetricFamilyToOpenMetrics(&createdBuf, createdFamily); err != nil {
+			return err
+		}
+	}
+	counterLines, counterSamples := splitSamples(counterBuf.String())
+	_, createdLines := splitSamples(createdBuf.String())
+	if len(counterSamples) != len(family.Metric) {
+		return fmt.Errorf("expected %d samples of %s, got %d", len(family.Metric), name, len(counterSamples))
+	}
+
+	out := bufio.NewWriter(w)
+	for _, line := range counterLines {
+		out.WriteString(line)
+	}
+	for i, line := range counterSamples {
+		out.WriteString(line)
+		if createdSamples[i] {
+			out.WriteString(createdLines[0])
+			createdLines = createdLines[1:]
+		}
+	}
+	return out.Flush()
+}
+
+// splitSamples splits the encoded family into the comment lines and the
+// sample lines, keeping the line endings
+func splitSamples(encoded string) (comments, samples []string) {
+	for _, line := range strings.SplitAfter(encoded, "\n") {
+		switch {
+		case len(line) == 0:
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, line)
+		default:
+			samples = append(samples, line)
+		}
+	}
+	return comments, samples
+}
+
+// SeriesKey returns the key which identifies the series of the metric family
+// by its labels
+func SeriesKey(name string, labels []*dto.LabelPair) string {
+	pairs := make([]string, 0, len(labels))
+	for _, label := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// createdTracker tracks the time at which the counter series are first seen.
+// The library does not record the creation time of the series, so the series
+// seen in the first gather are considered to be created at the start, and the
+// later ones at the time of the gather in which they are first seen.
+type createdTracker struct {
+	sync.Mutex
+	start    time.Time
+	gathered bool
+	created  map[string]time.Time
+}
+
+func newCreatedTracker(start time.Time) *createdTracker {
+	return &createdTracker{
+		start:   start,
+		created: make(map[string]time.Time),
+	}
+}
+
+// update records the counter series of the families which are seen for the
+// first time, and forgets the series which are no longer present, so that they
+// get a new creation time if they reappear. It returns the creation time of
+// the series present in the families.
+func (c *createdTracker) update(families []*dto.MetricFamily, now time.Time) map[string]time.Time {
+	c.Lock()
+	defer c.Unlock()
+	firstSeen := now
+	if !c.gathered {
+		firstSeen = c.start
+		c.gathered = true
+	}
+
+	current := make(map[string]time.Time)
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		for _, metric := range family.Metric {
+			key := SeriesKey(family.GetName(), metric.Label)
+			createdAt, ok := c.created[key]
+			if !ok {
+				createdAt = firstSeen
+			}
+			current[key] = createdAt
+		}
+	}
+	// the map is replaced and not modified, so it can be returned to the caller
+	c.created = current
+	return current
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openmetrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry() (*prometheus.Registry, *prometheus.CounterVec, *prometheus.HistogramVec) {
+	events := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ndm_events_total",
+		Help: "No. of events",
+	}, []string{"action"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ndm_event_duration_seconds",
+		Help:    "Time taken to process the events",
+		Buckets: []float64{1},
+	}, []string{"action"})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(events, duration)
+	return registry, events, duration
+}
+
+func scrape(t *testing.T, handler http.Handler, accept string) (string, string) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	body, err := ioutil.ReadAll(rec.Body)
+	assert.NoError(t, err)
+	return rec.Header().Get("Content-Type"), string(body)
+}
+
+func TestHandlerFor(t *testing.T) {
+	registry, events, duration := newTestRegistry()
+	events.WithLabelValues("add").Inc()
+	ObserveWithTraceID(duration.WithLabelValues("add"), 0.5, "0af7651916cd43dd8448eb211c80319c")
+
+	h := HandlerFor(registry).(*handler)
+	h.created = newCreatedTracker(time.Unix(1600000000, 0))
+
+	// scrapers which do not accept OpenMetrics get the text format
+	contentType, body := scrape(t, h, "text/plain")
+	assert.Equal(t, string(expfmt.FmtText), contentType)
+	assert.NotContains(t, body, "_created")
+	assert.NotContains(t, body, "# EOF")
+
+	contentType, body = scrape(t, h, expfmt.OpenMetricsType)
+	assert.Equal(t, string(expfmt.FmtOpenMetrics), contentType)
+	assert.Contains(t, body, `# TYPE ndm_events counter
+ndm_events_total{action="add"} 1.0
+ndm_events_created{action="add"} 1.6e+09
+`)
+	assert.Contains(t, body,
+		`ndm_event_duration_seconds_bucket{action="add",le="1.0"} 1 # {trace_id="0af7651916cd43dd8448eb211c80319c"} 0.5`)
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+
+	// series created after the first scrape get the time of the scrape in
+	// which they are first seen
+	events.WithLabelValues("remove").Inc()
+	before := time.Now()
+	created := h.created.update(gather(t, registry), time.Now())
+	assert.Equal(t, time.Unix(1600000000, 0), created[`ndm_events_total{action="add"}`])
+	assert.False(t, created[`ndm_events_total{action="remove"}`].Before(before))
+
+	// deleted series are forgotten
+	events.DeleteLabelValues("add")
+	created = h.created.update(gather(t, registry), time.Now())
+	assert.NotContains(t, created, `ndm_events_total{action="add"}`)
+}
+
+func TestObserveWithTraceID(t *testing.T) {
+	registry, _, duration := newTestRegistry()
+	// observations without a trace id do not have an exemplar
+	ObserveWithTraceID(duration.WithLabelValues("add"), 0.5, "")
+
+	h := HandlerFor(registry)
+	_, body := scrape(t, h, expfmt.OpenMetricsType)
+	assert.Contains(t, body, `ndm_event_duration_seconds_bucket{action="add",le="1.0"} 1
+`)
+}
+
+func gather(t *testing.T, registry *prometheus.Registry) []*dto.MetricFamily {
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	return families
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package push periodically pushes the gathered metrics to a remote endpoint,
+// for the clusters in which the exporter cannot be scraped by prometheus, eg: edge
+// nodes behind a NAT. The metrics are pushed using the prometheus remote write
+// protocol or to a pushgateway.
+package push
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+const (
+	// ModeRemoteWrite pushes the metrics using the prometheus remote write protocol
+	ModeRemoteWrite = "remote-write"
+	// ModePushgateway pushes the metrics to a prometheus pushgateway
+	ModePushgateway = "pushgateway"
+
+	// DefaultInterval is the default interval at which the metrics are pushed
+	DefaultInterval = 30 * time.Second
+	// DefaultTimeout is the default timeout of a push request
+	DefaultTimeout = 10 * time.Second
+	// DefaultJob is the default value of the job label of the pushed metrics
+	DefaultJob = "ndm-exporter"
+)
+
+// Config is the configuration of the endpoint to which the metrics are pushed
+type Config struct {
+	// URL of the endpoint. The metrics are not pushed if empty.
+	URL string
+	// Mode is the protocol used to push the metrics, remote-write or pushgateway
+	Mode string
+	// Interval at which the metrics are pushed
+	Interval time.Duration
+	// Timeout of each push request
+	Timeout time.Duration
+	// Job is the value of the job label of the pushed metrics
+	Job string
+	// Labels are added to all the pushed metrics, eg: the name of the cluster.
+	// The labels of the metrics take precedence over these labels. For the
+	// pushgateway, the labels are the grouping key along with the job.
+	Labels map[string]string
+	// BearerTokenFile is the file having the token sent in the Authorization
+	// header of the requests. The file is read on every push, so that the token
+	// can be rotated.
+	BearerTokenFile string
+}
+
+// AddFlags adds the flags to set the config to the flag set
+func (c *Config) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&c.URL, "push-url", "",
+		"URL of the remote write endpoint or the pushgateway to which the metrics are pushed. Not pushed if empty")
+	flags.StringVar(&c.Mode, "push-mode", ModeRemoteWrite,
+		"Protocol used to push the metrics (remote-write / pushgateway)")
+	flags.DurationVar(&c.Interval, "push-interval", DefaultInterval,
+		"Interval at which the metrics are pushed")
+	flags.DurationVar(&c.Timeout, "push-timeout", DefaultTimeout,
+		"Timeout of each push request")
+	flags.StringVar(&c.Job, "push-job", DefaultJob,
+		"Value of the job label of the pushed metrics")
+	flags.StringToStringVar(&c.Labels, "push-labels", nil,
+		"Labels added to all the pushed metrics, eg: cluster=edge-1")
+	flags.StringVar(&c.BearerTokenFile, "push-bearer-token-file", "",
+		"File having the bearer token sent with the push requests")
+}
+
+// Enabled returns true if the metrics are to be pushed
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate checks that the config is valid
+func (c Config) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if c.Mode != ModeRemoteWrite && c.Mode != ModePushgateway {
+		return fmt.Errorf("unknown push mode %q, should be %s or %s", c.Mode, ModeRemoteWrite, ModePushgateway)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("push interval should be greater than 0")
+	}
+	if c.Job == "" {
+		return fmt.Errorf("push job cannot be empty")
+	}
+	return nil
+}
+
+// Sink is the endpoint to which the gathered metrics are pushed
+type Sink interface {
+	Push(families []*dto.MetricFamily) error
+}
+
+// NewSink returns the sink for the mode in the config
+func NewSink(config Config) (Sink, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client := &bearerClient{
+		client:    &http.Client{Timeout: config.Timeout},
+		tokenFile: config.BearerTokenFile,
+	}
+	switch config.Mode {
+	case ModePushgateway:
+		return newPushgatewaySink(config, client), nil
+	default:
+		return newRemoteWriteSink(config, client), nil
+	}
+}
+
+// Pusher gathers the metrics and pushes them to a sink at an interval
+type Pusher struct {
+	gatherer prometheus.Gatherer
+	sink     Sink
+	interval time.Duration
+}
+
+// NewPusher returns a pusher which pushes the metrics of the gatherer as per the config
+func NewPusher(gatherer prometheus.Gatherer, config Config) (*Pusher, error) {
+	sink, err := NewSink(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Pusher{
+		gatherer: gatherer,
+		sink:     sink,
+		interval: config.Interval,
+	}, nil
+}
+
+// Run pushes the metrics at the interval until the stop channel is closed. A
+// failed push is logged and retried at the next interval.
+func (p *Pusher) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Push(); err != nil {
+			klog.Errorf("error pushing metrics: %v", err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push gathers the metrics and pushes them once
+func (p *Pusher) Push() error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		// the metrics that were gathered are pushed, as is done when scraping
+		klog.Warningf("error gathering metrics: %v", err)
+	}
+	if len(families) == 0 {
+		return nil
+	}
+	return p.sink.Push(families)
+}
+
+// bearerClient sends the requests with the bearer token read from a file
+type bearerClient struct {
+	client    *http.Client
+	tokenFile string
+}
+
+// Do implements the HTTPDoer interface of the push package
+func (c *bearerClient) Do(req *http.Request) (*http.Response, error) {
+	if c.tokenFile != "" {
+		token, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading bearer token file %s: %v", c.tokenFile, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return c.client.Do(req)
+}
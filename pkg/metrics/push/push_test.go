@@ -0,0 +1,229 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package push
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// snappyDecode decodes the literals written by snappyEncode
+func snappyDecode(t *testing.T, buf []byte) []byte {
+	length, n := protowire.ConsumeVarint(buf)
+	require.True(t, n > 0)
+	buf = buf[n:]
+	data := make([]byte, 0, length)
+	for len(buf) > 0 {
+		tag := buf[0]
+		require.Equal(t, byte(0), tag&0x03, "not a literal")
+		size := int(tag>>2) + 1
+		buf = buf[1:]
+		switch tag >> 2 {
+		case 60:
+			size = int(buf[0]) + 1
+			buf = buf[1:]
+		case 61:
+			size = int(buf[0]) | int(buf[1])<<8 + 1
+			buf = buf[2:]
+		}
+		data = append(data, buf[:size]...)
+		buf = buf[size:]
+	}
+	require.Equal(t, int(length), len(data))
+	return data
+}
+
+type sample struct {
+	labels    string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes the series of the write request, with the labels
+// of each series joined as name=value,...
+func decodeWriteRequest(t *testing.T, buf []byte) []sample {
+	var samples []sample
+	consume := func(buf []byte, f func(num protowire.Number, typ protowire.Type, value []byte)) {
+		for len(buf) > 0 {
+			num, typ, n := protowire.ConsumeTag(buf)
+			require.True(t, n > 0)
+			buf = buf[n:]
+			n = protowire.ConsumeFieldValue(num, typ, buf)
+			require.True(t, n > 0)
+			f(num, typ, buf[:n])
+			buf = buf[n:]
+		}
+	}
+	consume(buf, func(_ protowire.Number, _ protowire.Type, series []byte) {
+		series, _ = protowire.ConsumeBytes(series)
+		var s sample
+		var labels []string
+		consume(series, func(num protowire.Number, _ protowire.Type, value []byte) {
+			value, _ = protowire.ConsumeBytes(value)
+			switch num {
+			case timeSeriesLabels:
+				var l []string
+				consume(value, func(_ protowire.Number, _ protowire.Type, v []byte) {
+					str, _ := protowire.ConsumeString(v)
+					l = append(l, str)
+				})
+				labels = append(labels, l[0]+"="+l[1])
+			case timeSeriesSamples:
+				consume(value, func(num protowire.Number, _ protowire.Type, v []byte) {
+					if num == sampleValue {
+						bits, _ := protowire.ConsumeFixed64(v)
+						s.value = math.Float64frombits(bits)
+					} else {
+						ts, _ := protowire.ConsumeVarint(v)
+						s.timestamp = int64(ts)
+					}
+				})
+			}
+		})
+		assert.True(t, sort.StringsAreSorted(labels), "labels not sorted: %v", labels)
+		s.labels = strings.Join(labels, ",")
+		samples = append(samples, s)
+	})
+	return samples
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, size := range []int{0, 1, 60, 61, 256, 257, 1 << 16, 1<<16 + 100} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		assert.Equal(t, data, snappyDecode(t, snappyEncode(data)), "size %d", size)
+	}
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_total", Help: "test"},
+		[]string{"node", "path"})
+	counter.WithLabelValues("node1", "sda").Add(3)
+	counter.WithLabelValues("node1", "").Add(1)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds",
+		Help: "test", Buckets: []float64{0.5, 1}})
+	histogram.Observe(0.7)
+	reg.MustRegister(counter, histogram)
+
+	dir, err := ioutil.TempDir("", "ndm-push")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600))
+
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	pusher, err := NewPusher(reg, Config{
+		URL:             server.URL,
+		Mode:            ModeRemoteWrite,
+		Interval:        time.Minute,
+		Job:             "ndm",
+		Labels:          map[string]string{"cluster": "edge", "node": "node2"},
+		BearerTokenFile: tokenFile,
+	})
+	require.NoError(t, err)
+	pusher.sink.(*remoteWriteSink).now = func() time.Time { return time.Unix(10, 0) }
+	require.NoError(t, pusher.Push())
+
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+	assert.Equal(t, "snappy", header.Get("Content-Encoding"))
+	assert.Equal(t, remoteWriteVersion, header.Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, []sample{
+		{"__name__=test_seconds_bucket,cluster=edge,job=ndm,le=0.5,node=node2", 0, 10000},
+		{"__name__=test_seconds_bucket,cluster=edge,job=ndm,le=1,node=node2", 1, 10000},
+		{"__name__=test_seconds_bucket,cluster=edge,job=ndm,le=+Inf,node=node2", 1, 10000},
+		{"__name__=test_seconds_sum,cluster=edge,job=ndm,node=node2", 0.7, 10000},
+		{"__name__=test_seconds_count,cluster=edge,job=ndm,node=node2", 1, 10000},
+		{"__name__=test_total,cluster=edge,job=ndm,node=node1", 1, 10000},
+		{"__name__=test_total,cluster=edge,job=ndm,node=node1,path=sda", 3, 10000},
+	}, decodeWriteRequest(t, snappyDecode(t, body)))
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	})
+	assert.EqualError(t, pusher.Push(),
+		"unexpected status code 400 from "+server.URL+": out of order sample")
+}
+
+func TestPushgatewaySink(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test"})
+	gauge.Set(2)
+	reg.MustRegister(gauge)
+
+	var path, method string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, method = r.URL.Path, r.Method
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pusher, err := NewPusher(reg, Config{
+		URL:      server.URL,
+		Mode:     ModePushgateway,
+		Interval: time.Minute,
+		Job:      "ndm",
+		Labels:   map[string]string{"node": "node1"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, pusher.Push())
+	assert.Equal(t, "/metrics/job/ndm/node/node1", path)
+	assert.Equal(t, http.MethodPut, method)
+	assert.NotEmpty(t, body)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{}.Validate())
+	assert.False(t, Config{}.Enabled())
+
+	config := Config{URL: "http://localhost", Mode: ModeRemoteWrite, Interval: time.Second, Job: "ndm"}
+	assert.NoError(t, config.Validate())
+
+	invalid := config
+	invalid.Mode = "graphite"
+	assert.Error(t, invalid.Validate())
+	invalid = config
+	invalid.Interval = 0
+	assert.Error(t, invalid.Validate())
+	invalid = config
+	invalid.Job = ""
+	assert.Error(t, invalid.Validate())
+}
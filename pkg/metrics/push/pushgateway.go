@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package push
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// pushgatewaySink pushes the metrics to a pushgateway. All the metrics of the
+// grouping key are replaced on every push.
+type pushgatewaySink struct {
+	url    string
+	job    string
+	labels map[string]string
+	client push.HTTPDoer
+}
+
+func newPushgatewaySink(config Config, client push.HTTPDoer) *pushgatewaySink {
+	return &pushgatewaySink{
+		url:    config.URL,
+		job:    config.Job,
+		labels: config.Labels,
+		client: client,
+	}
+}
+
+// Push implements the Sink interface
+func (s *pushgatewaySink) Push(families []*dto.MetricFamily) error {
+	pusher := push.New(s.url, s.job).
+		Client(s.client).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return families, nil
+		}))
+	for name, value := range s.labels {
+		pusher = pusher.Grouping(name, value)
+	}
+	return pusher.Push()
+}
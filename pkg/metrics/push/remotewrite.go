@@ -0,0 +1,238 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// remoteWriteVersion is the version of the remote write protocol
+	remoteWriteVersion = "0.1.0"
+
+	// the field numbers of the messages of the remote write protocol, which are
+	// prometheus.WriteRequest, prometheus.TimeSeries, prometheus.Label and
+	// prometheus.Sample
+	writeRequestTimeSeries protowire.Number = 1
+	timeSeriesLabels       protowire.Number = 1
+	timeSeriesSamples      protowire.Number = 2
+	labelName              protowire.Number = 1
+	labelValue             protowire.Number = 2
+	sampleValue            protowire.Number = 1
+	sampleTimestamp        protowire.Number = 2
+
+	metricNameLabel = "__name__"
+	jobLabel        = "job"
+)
+
+// remoteWriteSink pushes the metrics to an endpoint which accepts the prometheus
+// remote write protocol, like prometheus, cortex or thanos receive.
+type remoteWriteSink struct {
+	url    string
+	labels map[string]string
+	client push.HTTPDoer
+	now    func() time.Time
+}
+
+func newRemoteWriteSink(config Config, client push.HTTPDoer) *remoteWriteSink {
+	labels := map[string]string{jobLabel: config.Job}
+	for name, value := range config.Labels {
+		labels[name] = value
+	}
+	return &remoteWriteSink{
+		url:    config.URL,
+		labels: labels,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// Push implements the Sink interface
+func (s *remoteWriteSink) Push(families []*dto.MetricFamily) error {
+	body := snappyEncode(encodeWriteRequest(families, s.labels, s.now()))
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d from %s: %s", resp.StatusCode, s.url, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// label is a name value pair of a time series
+type label struct {
+	name  string
+	value string
+}
+
+// encodeWriteRequest encodes the metric families as a remote write request.
+// Each counter, gauge and untyped metric is a time series. The summaries and
+// histograms are split into the _sum, _count and the quantile / bucket series,
+// as is done when prometheus scrapes them. The metrics without a timestamp get
+// the given time.
+func encodeWriteRequest(families []*dto.MetricFamily, extLabels map[string]string, now time.Time) []byte {
+	var buf []byte
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	for _, family := range families {
+		name := family.GetName()
+		for _, m := range family.GetMetric() {
+			ts := nowMs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(suffix string, value float64, extra ...label) {
+				labels := seriesLabels(name+suffix, m.GetLabel(), extLabels, extra)
+				buf = protowire.AppendTag(buf, writeRequestTimeSeries, protowire.BytesType)
+				buf = protowire.AppendBytes(buf, encodeTimeSeries(labels, value, ts))
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", m.GetGauge().GetValue())
+			case dto.MetricType_SUMMARY:
+				summary := m.GetSummary()
+				for _, q := range summary.GetQuantile() {
+					add("", q.GetValue(), label{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add("_sum", summary.GetSampleSum())
+				add("_count", float64(summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				histogram := m.GetHistogram()
+				infSeen := false
+				for _, b := range histogram.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						infSeen = true
+					}
+					add("_bucket", float64(b.GetCumulativeCount()), label{"le", formatFloat(b.GetUpperBound())})
+				}
+				if !infSeen {
+					add("_bucket", float64(histogram.GetSampleCount()), label{"le", "+Inf"})
+				}
+				add("_sum", histogram.GetSampleSum())
+				add("_count", float64(histogram.GetSampleCount()))
+			default:
+				add("", m.GetUntyped().GetValue())
+			}
+		}
+	}
+	return buf
+}
+
+// seriesLabels returns the labels of a series sorted by name. The labels of the
+// metric take precedence over the external labels.
+func seriesLabels(name string, pairs []*dto.LabelPair, extLabels map[string]string, extra []label) []label {
+	set := make(map[string]string, len(pairs)+len(extLabels)+len(extra)+1)
+	for n, v := range extLabels {
+		set[n] = v
+	}
+	for _, pair := range pairs {
+		set[pair.GetName()] = pair.GetValue()
+	}
+	for _, l := range extra {
+		set[l.name] = l.value
+	}
+	set[metricNameLabel] = name
+	labels := make([]label, 0, len(set))
+	for n, v := range set {
+		// empty labels are the same as missing labels in prometheus
+		if v != "" {
+			labels = append(labels, label{n, v})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+func encodeTimeSeries(labels []label, value float64, timestampMs int64) []byte {
+	var buf []byte
+	for _, l := range labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, labelName, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, labelValue, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+		buf = protowire.AppendTag(buf, timeSeriesLabels, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, lb)
+	}
+	var sb []byte
+	sb = protowire.AppendTag(sb, sampleValue, protowire.Fixed64Type)
+	sb = protowire.AppendFixed64(sb, math.Float64bits(value))
+	sb = protowire.AppendTag(sb, sampleTimestamp, protowire.VarintType)
+	sb = protowire.AppendVarint(sb, uint64(timestampMs))
+	buf = protowire.AppendTag(buf, timeSeriesSamples, protowire.BytesType)
+	return protowire.AppendBytes(buf, sb)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// snappyEncode encodes the data in the snappy block format, as required by the
+// remote write protocol. The data is written as literals without compressing
+// it, which is valid snappy that any decoder accepts; the requests are small
+// and sent once per interval.
+func snappyEncode(data []byte) []byte {
+	buf := protowire.AppendVarint(nil, uint64(len(data)))
+	// the max. length of a literal is 1<<32, and is split into chunks of 1<<16
+	// bytes for simplicity
+	const chunk = 1 << 16
+	for len(data) > 0 {
+		n := len(data)
+		if n > chunk {
+			n = chunk
+		}
+		if n <= 60 {
+			buf = append(buf, byte(n-1)<<2)
+		} else if n <= 1<<8 {
+			buf = append(buf, 60<<2, byte(n-1))
+		} else {
+			buf = append(buf, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		buf = append(buf, data[:n]...)
+		data = data[n:]
+	}
+	return buf
+}
@@ -17,8 +17,8 @@ limitations under the License.
 package smart
 
 import (
-	"strings"
-
+	"github.com/openebs/node-disk-manager/pkg/metrics/filter"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -58,6 +58,10 @@ type MetricsData struct {
 	// blockDevicePercentEnduranceUsed  is percentage of endurance used by a block device
 	blockDevicePercentEnduranceUsed *prometheus.GaugeVec
 
+	// blockDeviceDaysToWearOut is the estimated no. of days after which the endurance of
+	// a block device will be used up
+	blockDeviceDaysToWearOut *prometheus.GaugeVec
+
 	// errors and rejected requests
 	rejectRequestCount prometheus.Counter
 	errorRequestCount  prometheus.Counter
@@ -65,10 +69,13 @@ type MetricsData struct {
 
 //MetricsLabels are the labels that are available on the prometheus metrics
 type MetricsLabels struct {
-	UUID     string
-	Path     string
-	HostName string
-	NodeName string
+	UUID      string
+	Path      string
+	HostName  string
+	NodeName  string
+	Model     string
+	Serial    string
+	DriveType string
 }
 
 // Metrics defines the metrics data along with the labels present on those metrics.
@@ -99,13 +106,12 @@ func (m *Metrics) Collectors() []prometheus.Collector {
 		m.blockDeviceTotalWrittenBytes,
 		m.blockDeviceUtilizationRate,
 		m.blockDevicePercentEnduranceUsed,
+		m.blockDeviceDaysToWearOut,
 		m.rejectRequestCount,
 		m.errorRequestCount,
 	}
 }
 
-var labels []string = []string{"blockdevicename", "path", "hostname", "nodename"}
-
 // ErrorCollectors lists out all collectors for metrics related to error
 func (m *Metrics) ErrorCollectors() []prometheus.Collector {
 	return []prometheus.Collector{
@@ -133,7 +139,7 @@ func (m *Metrics) WithBlockDeviceCurrentTemperature() *Metrics {
 			Name:      "block_device_current_temperature_celsius",
 			Help:      `Current reported temperature of the blockdevice. -1 if not reported`,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -147,7 +153,7 @@ func (m *Metrics) WithBlockDeviceHighestTemperature() *Metrics {
 			Name:      "block_device_highest_temperature_celsius",
 			Help:      `Highest reported temperature of the blockdevice. -1 if not reported`,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -161,7 +167,7 @@ func (m *Metrics) WithBlockDeviceLowestTemperature() *Metrics {
 			Name:      "block_device_lowest_temperature_celsius",
 			Help:      `Lowest reported temperature of the blockdevice. -1 if not reported`,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -175,7 +181,7 @@ func (m *Metrics) WithBlockDeviceCurrentTemperatureValid() *Metrics {
 			Name:      "block_device_current_temperature_valid",
 			Help:      `Validity of the current temperature data reported. 0 means not valid, 1 means valid`,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -189,7 +195,7 @@ func (m *Metrics) WithBlockDeviceHighestTemperatureValid() *Metrics {
 			Name:      "block_device_highest_temperature_valid",
 			Help:      `Validity of the highest temperature data reported. 0 means not valid, 1 means valid`,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -203,7 +209,7 @@ func (m *Metrics) WithBlockDeviceLowestTemperatureValid() *Metrics {
 			Name:      "block_device_lowest_temperature_valid",
 			Help:      `Validity of the lowest temperature data reported. 0 means not valid, 1 means valid`,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -216,7 +222,7 @@ func (m *Metrics) WithBlockDeviceCapacity() *Metrics {
 			Name:      "block_device_capacity_bytes",
 			Help:      `Capacity of the block device in bytes`,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -229,7 +235,7 @@ func (m *Metrics) WithBlockDeviceTotalBytesRead() *Metrics {
 			Name:      "block_device_total_read_bytes",
 			Help:      `total number of bytes read by a block device in bytes `,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -242,7 +248,7 @@ func (m *Metrics) WithBlockDeviceTotalBytesWritten() *Metrics {
 			Name:      "block_device_total_written_bytes",
 			Help:      `total number of bytes written by a block device in bytes `,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -255,7 +261,7 @@ func (m *Metrics) WithBlockDeviceUtilizationRate() *Metrics {
 			Name:      "block_device_utilization_rate_percent",
 			Help:      `Ratio of actual workload to manufacturer's designed workload for the device `,
 		},
-		labels,
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -268,7 +274,20 @@ func (m *Metrics) WithBlockDevicePercentEnduranceUsed() *Metrics {
 			Name:      "block_device_endurance_used_percent",
 			Help:      `Estimate of the percentage of the device life that has been used `,
 		},
-		labels,
+		labels.DeviceLabelNames(),
+	)
+	return m
+}
+
+// WithBlockDeviceDaysToWearOut declares the estimated no. of days to the wear out of a block device
+func (m *Metrics) WithBlockDeviceDaysToWearOut() *Metrics {
+	m.blockDeviceDaysToWearOut = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: m.CollectorType,
+			Name:      "block_device_days_to_wear_out",
+			Help:      `Estimated no. of days until the endurance of the device is used up, from the trend of the endurance used`,
+		},
+		labels.DeviceLabelNames(),
 	)
 	return m
 }
@@ -304,9 +323,7 @@ func (ml *MetricsLabels) WithBlockDeviceUUID(uuid string) *MetricsLabels {
 
 // WithBlockDevicePath sets the blockdevice path to the metric label
 func (ml *MetricsLabels) WithBlockDevicePath(path string) *MetricsLabels {
-	// remove /dev from the device path so that the device path is similar to the
-	// path given by node exporter
-	ml.Path = strings.ReplaceAll(path, "/dev/", "")
+	ml.Path = labels.DevicePath(path)
 	return ml
 }
 
@@ -322,35 +339,55 @@ func (ml *MetricsLabels) WithBlockDeviceNodeName(nodeName string) *MetricsLabels
 	return ml
 }
 
+// WithBlockDeviceModel sets the blockdevice model to the metric label
+func (ml *MetricsLabels) WithBlockDeviceModel(model string) *MetricsLabels {
+	ml.Model = model
+	return ml
+}
+
+// WithBlockDeviceSerial sets the blockdevice serial number, whose hash is set
+// to the metric label
+func (ml *MetricsLabels) WithBlockDeviceSerial(serial string) *MetricsLabels {
+	ml.Serial = serial
+	return ml
+}
+
+// WithBlockDeviceDriveType sets the blockdevice drive type to the metric label
+func (ml *MetricsLabels) WithBlockDeviceDriveType(driveType string) *MetricsLabels {
+	ml.DriveType = driveType
+	return ml
+}
+
+// labelValues returns the values of the device labels
+func (ml *MetricsLabels) labelValues() []string {
+	values := []string{
+		ml.UUID,
+		labels.NodeName(ml.NodeName, ml.HostName),
+		ml.Path,
+		ml.Model,
+		filter.Hash(ml.Serial),
+		ml.DriveType,
+	}
+	return append(values, labels.LegacyLabelValues(ml.UUID, ml.NodeName, ml.HostName)...)
+}
+
 // SetBlockDeviceCurrentTemperature sets the current temperature value to the metric
 func (m *Metrics) SetBlockDeviceCurrentTemperature(currentTemp int16) *Metrics {
-	m.blockDeviceCurrentTemperature.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceCurrentTemperature.WithLabelValues(m.labelValues()...).
 		Set(float64(currentTemp))
 	return m
 }
 
 // SetBlockDeviceHighestTemperature sets the highest temperature value to the metric
 func (m *Metrics) SetBlockDeviceHighestTemperature(highTemp int16) *Metrics {
-	m.blockDeviceHighestTemperature.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceHighestTemperature.WithLabelValues(m.labelValues()...).
 		Set(float64(highTemp))
 	return m
 }
 
 // SetBlockDeviceLowestTemperature sets the lowest temperature value to the metric
 func (m *Metrics) SetBlockDeviceLowestTemperature(lowTemp int16) *Metrics {
-	m.blockDeviceLowestTemperature.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceLowestTemperature.WithLabelValues(m.labelValues()...).
 		Set(float64(lowTemp))
 	return m
 }
@@ -358,11 +395,7 @@ func (m *Metrics) SetBlockDeviceLowestTemperature(lowTemp int16) *Metrics {
 // SetBlockDeviceCurrentTemperatureValid sets the validity of the exposed current
 // temperature metrics
 func (m *Metrics) SetBlockDeviceCurrentTemperatureValid(valid bool) *Metrics {
-	m.blockDeviceCurrentTemperatureValid.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceCurrentTemperatureValid.WithLabelValues(m.labelValues()...).
 		Set(getTemperatureValidity(valid))
 	return m
 }
@@ -370,11 +403,7 @@ func (m *Metrics) SetBlockDeviceCurrentTemperatureValid(valid bool) *Metrics {
 // SetBlockDeviceHighestTemperatureValid sets the validity of the exposed highest
 // temperature metrics
 func (m *Metrics) SetBlockDeviceHighestTemperatureValid(valid bool) *Metrics {
-	m.blockDeviceCurrentTemperatureValid.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceCurrentTemperatureValid.WithLabelValues(m.labelValues()...).
 		Set(getTemperatureValidity(valid))
 	return m
 }
@@ -382,11 +411,7 @@ func (m *Metrics) SetBlockDeviceHighestTemperatureValid(valid bool) *Metrics {
 // SetBlockDeviceLowestTemperatureValid sets the validity of the exposed lowest
 // temperature metrics
 func (m *Metrics) SetBlockDeviceLowestTemperatureValid(valid bool) *Metrics {
-	m.blockDeviceCurrentTemperatureValid.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceCurrentTemperatureValid.WithLabelValues(m.labelValues()...).
 		Set(getTemperatureValidity(valid))
 	return m
 }
@@ -402,53 +427,46 @@ func getTemperatureValidity(isValid bool) float64 {
 
 // SetBlockDeviceCapacity sets the current block device capacity value to the metric
 func (m *Metrics) SetBlockDeviceCapacity(capacity uint64) *Metrics {
-	m.blockDeviceCapacity.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceCapacity.WithLabelValues(m.labelValues()...).
 		Set(float64(capacity))
 	return m
 }
 
 // SetBlockDeviceTotalBytesRead sets the total bytes read value to the metric
 func (m *Metrics) SetBlockDeviceTotalBytesRead(size uint64) *Metrics {
-	m.blockDeviceTotalReadBytes.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	)
+	m.blockDeviceTotalReadBytes.WithLabelValues(m.labelValues()...)
 	return m
 }
 
 // SetBlockDeviceTotalBytesWritten sets the total bytes written value to the metric
 func (m *Metrics) SetBlockDeviceTotalBytesWritten(size uint64) *Metrics {
-	m.blockDeviceTotalWrittenBytes.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	)
+	m.blockDeviceTotalWrittenBytes.WithLabelValues(m.labelValues()...)
 	return m
 }
 
 // SetBlockDeviceUtilizationRate sets the utilization rate value to the metric
 func (m *Metrics) SetBlockDeviceUtilizationRate(size float64) *Metrics {
-	m.blockDeviceUtilizationRate.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDeviceUtilizationRate.WithLabelValues(m.labelValues()...).
 		Set(float64(size))
 	return m
 }
 
+// SetBlockDeviceDaysToWearOut sets the estimated no. of days to the wear out of a block device to the metric
+func (m *Metrics) SetBlockDeviceDaysToWearOut(days float64) *Metrics {
+	m.blockDeviceDaysToWearOut.WithLabelValues(m.labelValues()...).Set(days)
+	return m
+}
+
+// DeleteBlockDeviceDaysToWearOut removes the estimated days to the wear out of a block device,
+// when it can no longer be estimated
+func (m *Metrics) DeleteBlockDeviceDaysToWearOut() *Metrics {
+	m.blockDeviceDaysToWearOut.DeleteLabelValues(m.labelValues()...)
+	return m
+}
+
 // SetBlockDevicePercentEnduranceUsed sets the percentage of endurance used by a block device to the metric
 func (m *Metrics) SetBlockDevicePercentEnduranceUsed(size float64) *Metrics {
-	m.blockDevicePercentEnduranceUsed.WithLabelValues(m.UUID,
-		m.Path,
-		m.HostName,
-		m.NodeName,
-	).
+	m.blockDevicePercentEnduranceUsed.WithLabelValues(m.labelValues()...).
 		Set(float64(size))
 	return m
 }
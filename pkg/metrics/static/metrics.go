@@ -17,9 +17,8 @@ limitations under the License.
 package static
 
 import (
-	"strings"
-
 	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/pkg/metrics/labels"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -32,6 +31,7 @@ const (
 // Metrics is the prometheus metrics that are exposed by the exporter
 type Metrics struct {
 	blockDeviceState *prometheus.GaugeVec
+	blockDeviceInfo  *prometheus.GaugeVec
 
 	// errors and rejected requests
 	rejectRequestCount prometheus.Counter
@@ -42,6 +42,7 @@ type Metrics struct {
 func NewMetrics() *Metrics {
 	return new(Metrics).
 		withBlockDeviceState().
+		withBlockDeviceInfo().
 		withRejectRequest().
 		withErrorRequest()
 }
@@ -50,6 +51,7 @@ func NewMetrics() *Metrics {
 func (m *Metrics) Collectors() []prometheus.Collector {
 	return []prometheus.Collector{
 		m.blockDeviceState,
+		m.blockDeviceInfo,
 		m.rejectRequestCount,
 		m.errorRequestCount,
 	}
@@ -80,7 +82,23 @@ func (m *Metrics) withBlockDeviceState() *Metrics {
 			Name:      "block_device_state",
 			Help:      `State of BlockDevice (0,1,2) = {Active, Inactive, Unknown}`,
 		},
-		[]string{"blockdevicename", "path", "hostname", "nodename"},
+		labels.DeviceLabelNames(),
+	)
+	return m
+}
+
+// withBlockDeviceInfo declares the info metric of the blockdevices, which has the
+// claim of the blockdevice and the parent of a partition along with the device
+// labels. It is used to join the device metrics with the metrics of the claims
+// and the volumes, and to aggregate the metrics of the partitions of a disk.
+func (m *Metrics) withBlockDeviceInfo() *Metrics {
+	m.blockDeviceInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: NodeNamespace,
+			Name:      "block_device_info",
+			Help:      `Information about the BlockDevice, the value is always 1`,
+		},
+		append(labels.DeviceLabelNames(), "device_type", "parent", "claim_namespace", "claim"),
 	)
 	return m
 }
@@ -107,23 +125,51 @@ func (m *Metrics) withErrorRequest() *Metrics {
 }
 
 // SetMetrics is used to set the prometheus metrics to respective fields
+// The metrics of the blockdevices that no longer exist are removed.
 func (m *Metrics) SetMetrics(blockDevices []blockdevice.BlockDevice) {
+	m.blockDeviceState.Reset()
+	m.blockDeviceInfo.Reset()
+	parents := parentPaths(blockDevices)
 	for _, blockDevice := range blockDevices {
 		// do not report metrics for sparse devices
 		if blockDevice.DeviceAttributes.DeviceType == blockdevice.SparseBlockDeviceType {
 			continue
 		}
-		// remove /dev from the device path so that the device path is similar to the
-		// path given by node exporter
-		path := strings.ReplaceAll(blockDevice.DevPath, "/dev/", "")
-		m.blockDeviceState.WithLabelValues(blockDevice.UUID,
-			path,
-			blockDevice.NodeAttributes[blockdevice.HostName],
-			blockDevice.NodeAttributes[blockdevice.NodeName]).
+		labelValues := labels.DeviceLabelValues(blockDevice)
+		m.blockDeviceState.WithLabelValues(labelValues...).
 			Set(getState(blockDevice.Status.State))
+		m.blockDeviceInfo.WithLabelValues(append(labelValues,
+			blockDevice.DeviceAttributes.DeviceType,
+			parents[partitionKey(blockDevice, blockDevice.DevPath)],
+			blockDevice.Status.ClaimNamespace,
+			blockDevice.Status.ClaimName)...).
+			Set(1)
 	}
 }
 
+// parentPaths returns the paths of the parent disks without /dev/, keyed by the
+// node and the path of the partition. The partitions of a disk are listed on its
+// blockdevice, which is present even if the disk is inactive after being
+// partitioned.
+func parentPaths(blockDevices []blockdevice.BlockDevice) map[string]string {
+	parents := make(map[string]string)
+	for _, bd := range blockDevices {
+		if bd.DeviceAttributes.DeviceType == blockdevice.BlockDeviceTypePartition &&
+			len(bd.DependentDevices.Parent) != 0 {
+			parents[partitionKey(bd, bd.DevPath)] = labels.DevicePath(bd.DependentDevices.Parent)
+		}
+		for _, partition := range bd.DependentDevices.Partitions {
+			parents[partitionKey(bd, partition)] = labels.DevicePath(bd.DevPath)
+		}
+	}
+	return parents
+}
+
+// partitionKey returns the key of the partition on the node of the blockdevice
+func partitionKey(bd blockdevice.BlockDevice, devPath string) string {
+	return bd.NodeAttributes[blockdevice.NodeName] + ":" + devPath
+}
+
 func getState(state string) float64 {
 	switch state {
 	case blockdevice.Active:
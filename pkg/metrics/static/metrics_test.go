@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package static
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBlockDevice(uuid, devPath, nodeName, deviceType string) blockdevice.BlockDevice {
+	bd := blockdevice.BlockDevice{
+		Identifier:     blockdevice.Identifier{UUID: uuid, DevPath: devPath},
+		NodeAttributes: blockdevice.NodeAttribute{blockdevice.NodeName: nodeName},
+	}
+	bd.DeviceAttributes.DeviceType = deviceType
+	bd.Status.State = blockdevice.Active
+	return bd
+}
+
+func TestSetMetricsParent(t *testing.T) {
+	// the disk is inactive after it was partitioned
+	disk := newBlockDevice("blockdevice-1", "/dev/sdb", "node1", blockdevice.BlockDeviceTypeDisk)
+	disk.Status.State = blockdevice.Inactive
+	disk.DependentDevices.Partitions = []string{"/dev/sdb1"}
+	partition := newBlockDevice("blockdevice-2", "/dev/sdb1", "node1", blockdevice.BlockDeviceTypePartition)
+	// the partition with the same path on another node
+	otherPartition := newBlockDevice("blockdevice-3", "/dev/sdb1", "node2", blockdevice.BlockDeviceTypePartition)
+	// the parent is known from the partition, when listed from the node
+	localPartition := newBlockDevice("", "/dev/sdc1", "node3", blockdevice.BlockDeviceTypePartition)
+	localPartition.DependentDevices.Parent = "/dev/sdc"
+
+	m := NewMetrics()
+	m.SetMetrics([]blockdevice.BlockDevice{disk, partition, otherPartition, localPartition})
+
+	expected := `
+# HELP node_block_device_info Information about the BlockDevice, the value is always 1
+# TYPE node_block_device_info gauge
+node_block_device_info{blockdevice="",claim="",claim_namespace="",device_type="partition",drive_type="",model="",node="node3",parent="sdc",path="sdc1",serial_hash=""} 1
+node_block_device_info{blockdevice="blockdevice-1",claim="",claim_namespace="",device_type="disk",drive_type="",model="",node="node1",parent="",path="sdb",serial_hash=""} 1
+node_block_device_info{blockdevice="blockdevice-2",claim="",claim_namespace="",device_type="partition",drive_type="",model="",node="node1",parent="sdb",path="sdb1",serial_hash=""} 1
+node_block_device_info{blockdevice="blockdevice-3",claim="",claim_namespace="",device_type="partition",drive_type="",model="",node="node2",parent="",path="sdb1",serial_hash=""} 1
+`
+	err := testutil.CollectAndCompare(m.blockDeviceInfo, strings.NewReader(expected), "node_block_device_info")
+	assert.NoError(t, err)
+}
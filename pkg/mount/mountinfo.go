@@ -17,7 +17,7 @@ limitations under the License.
 package mount
 
 const (
-	hostMountFilePath = "/host/proc/1/mounts" // hostMountFilePath is the file path mounted inside container
+	HostMountFilePath = "/host/proc/1/mounts" // HostMountFilePath is the file path mounted inside container
 )
 
 // Identifier is an identifier for the mount probe. It will be a devpath like
@@ -40,7 +40,14 @@ type DeviceMountAttr struct {
 // are fetched by parsing a mounts file (/proc/1/mounts) and getting the relevant data. If the
 // device is not mounted, then the function will return an error.
 func (I *Identifier) DeviceBasicMountInfo() (DeviceMountAttr, error) {
-	mountUtil := NewMountUtil(hostMountFilePath, I.DevPath, "")
+	mountUtil := NewMountUtil(HostMountFilePath, I.DevPath, "")
 	mountAttr, err := mountUtil.getDeviceMountAttr(mountUtil.getMountName)
 	return mountAttr, err
 }
+
+// GetDeviceMountAttr gives the mount attributes of the device from the given mounts
+// file, eg: /proc/self/mounts. An error is returned if the device is not mounted.
+func GetDeviceMountAttr(mountsFile, devPath string) (DeviceMountAttr, error) {
+	mountUtil := NewMountUtil(mountsFile, devPath, "")
+	return mountUtil.getDeviceMountAttr(mountUtil.getMountName)
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// aenEnv is the env of the uevent sent by the kernel nvme driver for the
+	// asynchronous events of the controller, eg: NVME_AEN=0x020102
+	aenEnv = "NVME_AEN="
+	// kernelUeventGroup is the netlink group of the uevents sent by the kernel
+	kernelUeventGroup = 1
+	// ueventBufferSize is the max. size of a uevent
+	ueventBufferSize = 64 * 1024
+)
+
+// asyncEventTypes are the names of the types of the asynchronous events, keyed
+// by the type in bits 2:0 of the completion of the Asynchronous Event Request
+var asyncEventTypes = map[uint32]string{
+	0: "error",
+	1: "smart_health",
+	2: "notice",
+	6: "io_command_set",
+	7: "vendor",
+}
+
+// sysBlockPath is the path at which the block devices are present in sysfs
+var sysBlockPath = "/sys/block"
+
+// AsyncEvent is an asynchronous event reported by a NVMe controller, eg: when
+// a SMART / health threshold is crossed or a persistent internal error occurs
+type AsyncEvent struct {
+	// Controller is the name of the controller, eg: nvme0
+	Controller string
+	// Type is the type of the event, eg: error, smart_health
+	Type string
+	// Info is the event information, which identifies the event within its type
+	Info uint8
+	// LogPage is the id of the log page that has the details of the event
+	LogPage uint8
+}
+
+// ParseAsyncEvent parses the completion of an Asynchronous Event Request of
+// the controller
+func ParseAsyncEvent(controller string, result uint32) AsyncEvent {
+	eventType, ok := asyncEventTypes[result&0x7]
+	if !ok {
+		eventType = "reserved"
+	}
+	return AsyncEvent{
+		Controller: controller,
+		Type:       eventType,
+		Info:       uint8(result >> 8),
+		LogPage:    uint8(result >> 16),
+	}
+}
+
+// parseUevent returns the asynchronous event in the uevent sent by the kernel.
+// The uevent has a header followed by the null separated envs, eg:
+// change@/devices/.../nvme/nvme0\0ACTION=change\0...\0DEVNAME=nvme0\0NVME_AEN=0x020102
+func parseUevent(msg []byte) (AsyncEvent, bool) {
+	var controller, result string
+	var subsystem bool
+	for _, field := range bytes.Split(msg, []byte{0}) {
+		env := string(field)
+		switch {
+		case env == "SUBSYSTEM=nvme":
+			subsystem = true
+		case strings.HasPrefix(env, "DEVNAME="):
+			controller = filepath.Base(strings.TrimPrefix(env, "DEVNAME="))
+		case strings.HasPrefix(env, aenEnv):
+			result = strings.TrimPrefix(env, aenEnv)
+		}
+	}
+	if !subsystem || len(controller) == 0 || len(result) == 0 {
+		return AsyncEvent{}, false
+	}
+	value, err := strconv.ParseUint(result, 0, 32)
+	if err != nil {
+		return AsyncEvent{}, false
+	}
+	return ParseAsyncEvent(controller, uint32(value)), true
+}
+
+// AsyncEventCounter counts the asynchronous events of the NVMe controllers on
+// the node. The events are not queued by the controller, so they are counted
+// from the uevents sent by the kernel while the counter is watching.
+type AsyncEventCounter struct {
+	mutex  sync.Mutex
+	counts map[string]map[string]uint64
+}
+
+// NewAsyncEventCounter creates a counter of the asynchronous events
+func NewAsyncEventCounter() *AsyncEventCounter {
+	return &AsyncEventCounter{counts: make(map[string]map[string]uint64)}
+}
+
+// Add counts the event
+func (c *AsyncEventCounter) Add(event AsyncEvent) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.counts[event.Controller] == nil {
+		c.counts[event.Controller] = make(map[string]uint64)
+	}
+	c.counts[event.Controller][event.Type]++
+}
+
+// Counts returns the no. of events of the controller of the NVMe namespace,
+// keyed by the type of the event
+func (c *AsyncEventCounter) Counts(devPath string) (map[string]uint64, error) {
+	controller, err := controllerName(devPath)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counts := make(map[string]uint64, len(c.counts[controller]))
+	for eventType, count := range c.counts[controller] {
+		counts[eventType] = count
+	}
+	return counts, nil
+}
+
+// Watch counts the asynchronous events from the uevents of the kernel till
+// the stop channel is closed. The uevents are received only in the network
+// namespaces which are not owned by a user namespace.
+func (c *AsyncEventCounter) Watch(stopCh <-chan struct{}) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return fmt.Errorf("unable to open uevent socket: %v", err)
+	}
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: kernelUeventGroup}); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("unable to bind uevent socket: %v", err)
+	}
+	go func() {
+		<-stopCh
+		unix.Shutdown(fd, unix.SHUT_RDWR)
+	}()
+	defer unix.Close(fd)
+
+	buf := make([]byte, ueventBufferSize)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		select {
+		case <-stopCh:
+			return nil
+		default:
+		}
+		if err == unix.EINTR || err == unix.ENOBUFS {
+			// the events dropped when the buffer overflows are not counted
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to receive uevent: %v", err)
+		}
+		if event, ok := parseUevent(buf[:n]); ok {
+			c.Add(event)
+		}
+	}
+}
+
+// controllerName returns the name of the controller of the NVMe namespace, eg:
+// nvme0 for /dev/nvme0n1. The device of the namespace in sysfs is the controller.
+func controllerName(devPath string) (string, error) {
+	controllerPath, err := filepath.EvalSymlinks(filepath.Join(sysBlockPath, filepath.Base(devPath), "device"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(controllerPath), nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUevent(t *testing.T) {
+	uevent := func(envs ...string) []byte {
+		return []byte(strings.Join(append([]string{"change@/devices/pci0000:00/0000:00:1d.0/nvme/nvme0"}, envs...), "\x00"))
+	}
+	tests := map[string]struct {
+		msg   []byte
+		event AsyncEvent
+		ok    bool
+	}{
+		"smart / health event": {
+			// temperature threshold crossed, details in the health log page
+			msg:   uevent("ACTION=change", "SUBSYSTEM=nvme", "DEVNAME=nvme0", "NVME_AEN=0x020101"),
+			event: AsyncEvent{Controller: "nvme0", Type: "smart_health", Info: 1, LogPage: 2},
+			ok:    true,
+		},
+		"error event": {
+			msg:   uevent("ACTION=change", "SUBSYSTEM=nvme", "DEVNAME=/dev/nvme1", "NVME_AEN=0x010300"),
+			event: AsyncEvent{Controller: "nvme1", Type: "error", Info: 3, LogPage: 1},
+			ok:    true,
+		},
+		"reserved type": {
+			msg:   uevent("SUBSYSTEM=nvme", "DEVNAME=nvme0", "NVME_AEN=0x000003"),
+			event: AsyncEvent{Controller: "nvme0", Type: "reserved"},
+			ok:    true,
+		},
+		"not an async event": {
+			msg: uevent("ACTION=change", "SUBSYSTEM=nvme", "DEVNAME=nvme0"),
+		},
+		"other subsystem": {
+			msg: uevent("ACTION=change", "SUBSYSTEM=block", "DEVNAME=sda", "NVME_AEN=0x020101"),
+		},
+		"invalid result": {
+			msg: uevent("SUBSYSTEM=nvme", "DEVNAME=nvme0", "NVME_AEN=abc"),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			event, ok := parseUevent(test.msg)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.event, event)
+		})
+	}
+}
+
+func TestAsyncEventCounter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-aen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	oldSysBlockPath := sysBlockPath
+	sysBlockPath = dir
+	defer func() { sysBlockPath = oldSysBlockPath }()
+
+	counter := NewAsyncEventCounter()
+	_, err = counter.Counts("/dev/nvme0n1")
+	assert.Error(t, err, "namespace not in sysfs")
+
+	// the device of the namespace is the controller
+	controllerPath := filepath.Join(dir, "nvme", "nvme0")
+	require.NoError(t, os.MkdirAll(controllerPath, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "nvme0n1"), 0755))
+	require.NoError(t, os.Symlink(controllerPath, filepath.Join(dir, "nvme0n1", "device")))
+
+	counts, err := counter.Counts("/dev/nvme0n1")
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+
+	counter.Add(ParseAsyncEvent("nvme0", 0x020101))
+	counter.Add(ParseAsyncEvent("nvme0", 0x020201))
+	counter.Add(ParseAsyncEvent("nvme0", 0x010300))
+	counter.Add(ParseAsyncEvent("nvme1", 0x010300))
+	counts, err = counter.Counts("/dev/nvme0n1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"smart_health": 2, "error": 1}, counts)
+}
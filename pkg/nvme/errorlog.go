@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// errorLogEntrySize is the size of an entry of the error information log
+	errorLogEntrySize = 64
+	// ErrorLogEntries is the no. of the latest entries of the error information
+	// log that are read. All the controllers support at least one entry.
+	ErrorLogEntries = 16
+)
+
+// Status code types of the errors, from the status field of the error entry
+const (
+	StatusCodeTypeGeneric         = "generic"
+	StatusCodeTypeCommandSpecific = "command_specific"
+	StatusCodeTypeMedia           = "media"
+	StatusCodeTypePath            = "path"
+	StatusCodeTypeVendorSpecific  = "vendor_specific"
+	StatusCodeTypeUnknown         = "unknown"
+)
+
+// ErrorLogEntry is an entry of the error information log of a NVMe controller
+type ErrorLogEntry struct {
+	// ErrorCount is the unique id of the error, incremented for each error
+	// logged by the controller
+	ErrorCount uint64
+	// SubmissionQueueID is the id of the submission queue of the failed command
+	SubmissionQueueID uint16
+	// CommandID is the id of the failed command
+	CommandID uint16
+	// StatusField is the status of the completion of the failed command
+	StatusField uint16
+	// LBA is the first LBA which had the error
+	LBA uint64
+	// NamespaceID is the namespace which had the error
+	NamespaceID uint32
+}
+
+// GetErrorLog gets the latest entries of the error information log of the NVMe
+// device. The entries are ordered from the latest to the oldest.
+func GetErrorLog(devPath string) ([]ErrorLogEntry, error) {
+	buf, err := getLogPage(devPath, logPageError, ErrorLogEntries*errorLogEntrySize)
+	if err != nil {
+		return nil, fmt.Errorf("get error log ioctl failed on %s: %v", devPath, err)
+	}
+	return ParseErrorLog(buf), nil
+}
+
+// ParseErrorLog parses the entries of the error information log page. The
+// unused entries, which have an error count of 0, are skipped.
+func ParseErrorLog(buf []byte) []ErrorLogEntry {
+	le := binary.LittleEndian
+	entries := make([]ErrorLogEntry, 0)
+	for offset := 0; offset+errorLogEntrySize <= len(buf); offset += errorLogEntrySize {
+		entry := buf[offset : offset+errorLogEntrySize]
+		errorCount := le.Uint64(entry[0:8])
+		if errorCount == 0 {
+			continue
+		}
+		entries = append(entries, ErrorLogEntry{
+			ErrorCount:        errorCount,
+			SubmissionQueueID: le.Uint16(entry[8:10]),
+			CommandID:         le.Uint16(entry[10:12]),
+			StatusField:       le.Uint16(entry[12:14]),
+			LBA:               le.Uint64(entry[16:24]),
+			NamespaceID:       le.Uint32(entry[24:28]),
+		})
+	}
+	return entries
+}
+
+// StatusCodeType returns the type of the status code of the error
+func (e ErrorLogEntry) StatusCodeType() string {
+	// bit 0 is the phase tag, bits 1-8 are the status code and bits 9-11
+	// are the status code type
+	switch (e.StatusField >> 9) & 0x7 {
+	case 0:
+		return StatusCodeTypeGeneric
+	case 1:
+		return StatusCodeTypeCommandSpecific
+	case 2:
+		return StatusCodeTypeMedia
+	case 3:
+		return StatusCodeTypePath
+	case 7:
+		return StatusCodeTypeVendorSpecific
+	}
+	return StatusCodeTypeUnknown
+}
+
+// StatusCode returns the status code of the error
+func (e ErrorLogEntry) StatusCode() uint8 {
+	return uint8(e.StatusField >> 1)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErrorLog(t *testing.T) {
+	buf := make([]byte, 3*errorLogEntrySize)
+	le := binary.LittleEndian
+	// a media error, unrecovered read error (status code type 2, status code 0x81)
+	le.PutUint64(buf[0:8], 12)
+	le.PutUint16(buf[8:10], 3)
+	le.PutUint16(buf[10:12], 0x1f)
+	le.PutUint16(buf[12:14], 2<<9|0x81<<1)
+	le.PutUint64(buf[16:24], 4096)
+	le.PutUint32(buf[24:28], 1)
+	// a generic error, invalid field in command
+	le.PutUint64(buf[64:72], 11)
+	le.PutUint16(buf[76:78], 0x02<<1)
+	// the last entry is unused
+
+	entries := ParseErrorLog(buf)
+	assert.Equal(t, []ErrorLogEntry{
+		{
+			ErrorCount:        12,
+			SubmissionQueueID: 3,
+			CommandID:         0x1f,
+			StatusField:       2<<9 | 0x81<<1,
+			LBA:               4096,
+			NamespaceID:       1,
+		},
+		{
+			ErrorCount:  11,
+			StatusField: 0x02 << 1,
+		},
+	}, entries)
+	assert.Equal(t, StatusCodeTypeMedia, entries[0].StatusCodeType())
+	assert.Equal(t, uint8(0x81), entries[0].StatusCode())
+	assert.Equal(t, StatusCodeTypeGeneric, entries[1].StatusCodeType())
+	assert.Equal(t, uint8(0x02), entries[1].StatusCode())
+}
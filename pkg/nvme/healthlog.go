@@ -0,0 +1,175 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nvme reads the SMART / health information, the error information and
+// the device self-test logs of NVMe devices
+package nvme
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"github.com/openebs/node-disk-manager/pkg/smart"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// ioctlAdminCmd is NVME_IOCTL_ADMIN_CMD, _IOWR('N', 0x41, struct nvme_admin_cmd)
+	ioctlAdminCmd = 0xC0484E41
+	// opcodeGetLogPage is the admin command to get a log page
+	opcodeGetLogPage = 0x02
+	// logPageError is the id of the error information log page
+	logPageError = 0x01
+	// logPageHealth is the id of the SMART / health information log page
+	logPageHealth = 0x02
+	// logPageSelfTest is the id of the device self-test log page
+	logPageSelfTest = 0x06
+	// healthLogSize is the size of the SMART / health information log page
+	healthLogSize = 512
+	// allNamespaces is the namespace id used to get the log of the controller
+	allNamespaces = 0xFFFFFFFF
+	// dataUnitSize is the size of a data unit in the log, in bytes. A data unit
+	// is 1000 units of 512 bytes.
+	dataUnitSize = 512 * 1000
+)
+
+// adminCmd is struct nvme_admin_cmd used by the NVME_IOCTL_ADMIN_CMD ioctl
+type adminCmd struct {
+	opcode      uint8
+	flags       uint8
+	rsvd1       uint16
+	nsid        uint32
+	cdw2        uint32
+	cdw3        uint32
+	metadata    uint64
+	addr        uint64
+	metadataLen uint32
+	dataLen     uint32
+	cdw10       uint32
+	cdw11       uint32
+	cdw12       uint32
+	cdw13       uint32
+	cdw14       uint32
+	cdw15       uint32
+	timeoutMs   uint32
+	result      uint32
+}
+
+// HealthLog is the SMART / health information log of a NVMe controller
+type HealthLog struct {
+	// CriticalWarning is a bitmap of the critical warnings of the controller
+	CriticalWarning uint8
+	// Temperature is the composite temperature of the controller in kelvin
+	Temperature uint16
+	// AvailableSpare is the percentage of the remaining spare capacity
+	AvailableSpare uint8
+	// AvailableSpareThreshold is the available spare below which a warning is raised
+	AvailableSpareThreshold uint8
+	// PercentageUsed is the estimate of the percentage of the device life used
+	PercentageUsed uint8
+	// DataUnitsRead is the no. of data units read by the host
+	DataUnitsRead uint64
+	// DataUnitsWritten is the no. of data units written by the host
+	DataUnitsWritten uint64
+	// PowerCycles is the no. of power cycles
+	PowerCycles uint64
+	// PowerOnHours is the no. of power-on hours
+	PowerOnHours uint64
+	// UnsafeShutdowns is the no. of unsafe shutdowns
+	UnsafeShutdowns uint64
+	// MediaErrors is the no. of unrecovered data integrity errors
+	MediaErrors uint64
+	// ErrorLogEntries is the no. of error information log entries
+	ErrorLogEntries uint64
+}
+
+// IsNVMe returns true if the device at the path is a NVMe namespace
+func IsNVMe(devPath string) bool {
+	return strings.HasPrefix(devPath, "/dev/nvme")
+}
+
+// GetHealthLog gets the SMART / health information log of the NVMe device
+func GetHealthLog(devPath string) (HealthLog, error) {
+	buf, err := getLogPage(devPath, logPageHealth, healthLogSize)
+	if err != nil {
+		return HealthLog{}, fmt.Errorf("get health log ioctl failed on %s: %v", devPath, err)
+	}
+	return ParseHealthLog(buf)
+}
+
+// getLogPage gets the log page of the given size from the NVMe device
+func getLogPage(devPath string, logPage uint32, size int) ([]byte, error) {
+	fd, err := unix.Open(devPath, unix.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	buf := make([]byte, size)
+	cmd := adminCmd{
+		opcode:  opcodeGetLogPage,
+		nsid:    allNamespaces,
+		addr:    uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		dataLen: uint32(size),
+		// number of dwords to be read (0's based) and the log page id
+		cdw10: uint32(size/4-1)<<16 | logPage,
+	}
+	if err := smart.Ioctl(uintptr(fd), ioctlAdminCmd, uintptr(unsafe.Pointer(&cmd))); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ParseHealthLog parses the SMART / health information log page. The 128 bit
+// counters are truncated to 64 bits.
+func ParseHealthLog(buf []byte) (HealthLog, error) {
+	if len(buf) < healthLogSize {
+		return HealthLog{}, fmt.Errorf("health log of %d bytes is too short", len(buf))
+	}
+	le := binary.LittleEndian
+	return HealthLog{
+		CriticalWarning:         buf[0],
+		Temperature:             le.Uint16(buf[1:3]),
+		AvailableSpare:          buf[3],
+		AvailableSpareThreshold: buf[4],
+		PercentageUsed:          buf[5],
+		DataUnitsRead:           le.Uint64(buf[32:40]),
+		DataUnitsWritten:        le.Uint64(buf[48:56]),
+		PowerCycles:             le.Uint64(buf[112:120]),
+		PowerOnHours:            le.Uint64(buf[128:136]),
+		UnsafeShutdowns:         le.Uint64(buf[144:152]),
+		MediaErrors:             le.Uint64(buf[160:168]),
+		ErrorLogEntries:         le.Uint64(buf[176:184]),
+	}, nil
+}
+
+// TemperatureCelsius returns the composite temperature in celsius
+func (hl HealthLog) TemperatureCelsius() int {
+	return int(hl.Temperature) - 273
+}
+
+// BytesRead returns the no. of bytes read by the host
+func (hl HealthLog) BytesRead() uint64 {
+	return hl.DataUnitsRead * dataUnitSize
+}
+
+// BytesWritten returns the no. of bytes written by the host
+func (hl HealthLog) BytesWritten() uint64 {
+	return hl.DataUnitsWritten * dataUnitSize
+}
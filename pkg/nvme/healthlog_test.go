@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHealthLog(t *testing.T) {
+	buf := make([]byte, healthLogSize)
+	le := binary.LittleEndian
+	buf[0] = 0x04
+	le.PutUint16(buf[1:3], 310)
+	buf[3] = 100
+	buf[4] = 10
+	buf[5] = 3
+	le.PutUint64(buf[32:40], 2000)
+	le.PutUint64(buf[48:56], 1000)
+	le.PutUint64(buf[112:120], 42)
+	le.PutUint64(buf[128:136], 8760)
+	le.PutUint64(buf[144:152], 5)
+	le.PutUint64(buf[160:168], 1)
+	le.PutUint64(buf[176:184], 7)
+
+	healthLog, err := ParseHealthLog(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, HealthLog{
+		CriticalWarning:         0x04,
+		Temperature:             310,
+		AvailableSpare:          100,
+		AvailableSpareThreshold: 10,
+		PercentageUsed:          3,
+		DataUnitsRead:           2000,
+		DataUnitsWritten:        1000,
+		PowerCycles:             42,
+		PowerOnHours:            8760,
+		UnsafeShutdowns:         5,
+		MediaErrors:             1,
+		ErrorLogEntries:         7,
+	}, healthLog)
+	assert.Equal(t, 37, healthLog.TemperatureCelsius())
+	assert.Equal(t, uint64(1024000000), healthLog.BytesRead())
+	assert.Equal(t, uint64(512000000), healthLog.BytesWritten())
+
+	_, err = ParseHealthLog(buf[:100])
+	assert.Error(t, err)
+}
+
+func TestIsNVMe(t *testing.T) {
+	assert.True(t, IsNVMe("/dev/nvme0n1"))
+	assert.False(t, IsNVMe("/dev/sda"))
+}
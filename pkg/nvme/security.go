@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/openebs/node-disk-manager/pkg/smart"
+
+	"golang.org/x/sys/unix"
+)
+
+// opcodeSecurityReceive is the admin command to receive the data of a security protocol
+const opcodeSecurityReceive = 0x82
+
+// SecurityReceive gets the response of the given size for the security protocol and
+// the protocol specific field from the NVMe controller, eg: the TCG Level 0 Discovery
+func SecurityReceive(devPath string, protocol uint8, specific uint16, size int) ([]byte, error) {
+	fd, err := unix.Open(devPath, unix.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	buf := make([]byte, size)
+	cmd := adminCmd{
+		opcode:  opcodeSecurityReceive,
+		addr:    uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		dataLen: uint32(size),
+		// the security protocol, and the protocol specific field
+		cdw10: uint32(protocol)<<24 | uint32(specific)<<8,
+		// the allocation length
+		cdw11: uint32(size),
+	}
+	if err := smart.Ioctl(uintptr(fd), ioctlAdminCmd, uintptr(unsafe.Pointer(&cmd))); err != nil {
+		return nil, fmt.Errorf("security receive ioctl failed on %s: %v", devPath, err)
+	}
+	return buf, nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// selfTestResults is the no. of results in the device self-test log
+	selfTestResults = 20
+	// selfTestResultSize is the size of a result in the device self-test log
+	selfTestResultSize = 28
+	// selfTestLogSize is the size of the device self-test log, which has the
+	// current operation and the results after a header of 4 bytes
+	selfTestLogSize = 4 + selfTestResults*selfTestResultSize
+	// selfTestResultUnused is the result of the unused entries of the log
+	selfTestResultUnused = 0xf
+)
+
+// Types of the device self-tests, from the self-test code
+const (
+	SelfTestShort          = "short"
+	SelfTestExtended       = "extended"
+	SelfTestVendorSpecific = "vendor_specific"
+	SelfTestUnknown        = "unknown"
+)
+
+// Results of the device self-tests
+const (
+	// SelfTestPassed is the result of a test that completed without error
+	SelfTestPassed = "passed"
+	// SelfTestAborted is the result of a test that was aborted, eg: by a reset
+	// of the controller or by the host
+	SelfTestAborted = "aborted"
+	// SelfTestFailed is the result of a test that completed with a failed
+	// segment or had a fatal error
+	SelfTestFailed = "failed"
+)
+
+// SelfTestLog is the device self-test log of a NVMe controller
+type SelfTestLog struct {
+	// CurrentOperation is the self-test code of the test in progress, 0 if no
+	// test is in progress
+	CurrentOperation uint8
+	// CurrentCompletion is the percentage of the test in progress that is complete
+	CurrentCompletion uint8
+	// Results are the results of the completed tests, from the latest to the oldest
+	Results []SelfTestResult
+}
+
+// SelfTestResult is the result of a completed device self-test
+type SelfTestResult struct {
+	// Code is the self-test code of the test, 1 for short and 2 for extended
+	Code uint8
+	// Status is the result of the test, 0 if the test completed without error
+	Status uint8
+	// PowerOnHours are the power-on hours of the controller when the test completed
+	PowerOnHours uint64
+}
+
+// GetSelfTestLog gets the device self-test log of the NVMe device. The log is
+// supported by the controllers from NVMe 1.3.
+func GetSelfTestLog(devPath string) (SelfTestLog, error) {
+	buf, err := getLogPage(devPath, logPageSelfTest, selfTestLogSize)
+	if err != nil {
+		return SelfTestLog{}, fmt.Errorf("get self-test log ioctl failed on %s: %v", devPath, err)
+	}
+	return ParseSelfTestLog(buf)
+}
+
+// ParseSelfTestLog parses the device self-test log page. The unused results
+// are skipped.
+func ParseSelfTestLog(buf []byte) (SelfTestLog, error) {
+	if len(buf) < selfTestLogSize {
+		return SelfTestLog{}, fmt.Errorf("self-test log of %d bytes is shorter than %d bytes",
+			len(buf), selfTestLogSize)
+	}
+	log := SelfTestLog{
+		CurrentOperation:  buf[0] & 0xf,
+		CurrentCompletion: buf[1] & 0x7f,
+		Results:           make([]SelfTestResult, 0),
+	}
+	for offset := 4; offset+selfTestResultSize <= selfTestLogSize; offset += selfTestResultSize {
+		result := buf[offset : offset+selfTestResultSize]
+		// bits 7-4 are the self-test code and bits 3-0 are the result
+		status := result[0] & 0xf
+		if status == selfTestResultUnused {
+			continue
+		}
+		log.Results = append(log.Results, SelfTestResult{
+			Code:         result[0] >> 4,
+			Status:       status,
+			PowerOnHours: binary.LittleEndian.Uint64(result[4:12]),
+		})
+	}
+	return log, nil
+}
+
+// InProgress returns true if a self-test is in progress
+func (l SelfTestLog) InProgress() bool {
+	return l.CurrentOperation != 0
+}
+
+// CurrentTest returns the type of the test in progress
+func (l SelfTestLog) CurrentTest() string {
+	return selfTestType(l.CurrentOperation)
+}
+
+// Test returns the type of the test
+func (r SelfTestResult) Test() string {
+	return selfTestType(r.Code)
+}
+
+// Result returns whether the test passed, failed or was aborted
+func (r SelfTestResult) Result() string {
+	switch r.Status {
+	case 0:
+		return SelfTestPassed
+	case 5, 6, 7:
+		return SelfTestFailed
+	}
+	return SelfTestAborted
+}
+
+func selfTestType(code uint8) string {
+	switch code {
+	case 1:
+		return SelfTestShort
+	case 2:
+		return SelfTestExtended
+	case 0xe:
+		return SelfTestVendorSpecific
+	}
+	return SelfTestUnknown
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nvme
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelfTestLog(t *testing.T) {
+	_, err := ParseSelfTestLog(make([]byte, 10))
+	assert.Error(t, err)
+
+	buf := make([]byte, selfTestLogSize)
+	// an extended test is 40% complete
+	buf[0], buf[1] = 0x2, 40
+	for i := 0; i < selfTestResults; i++ {
+		buf[4+i*selfTestResultSize] = selfTestResultUnused
+	}
+	result := func(i int, code, status uint8, powerOnHours uint64) {
+		entry := buf[4+i*selfTestResultSize:]
+		entry[0] = code<<4 | status
+		binary.LittleEndian.PutUint64(entry[4:12], powerOnHours)
+	}
+	// a short test with a failed segment, after an extended test aborted by a reset
+	result(0, 0x1, 0x7, 1200)
+	result(1, 0x2, 0x2, 1000)
+	result(2, 0xe, 0x0, 900)
+
+	log, err := ParseSelfTestLog(buf)
+	assert.NoError(t, err)
+	assert.True(t, log.InProgress())
+	assert.Equal(t, SelfTestExtended, log.CurrentTest())
+	assert.Equal(t, uint8(40), log.CurrentCompletion)
+	assert.Equal(t, []SelfTestResult{
+		{Code: 0x1, Status: 0x7, PowerOnHours: 1200},
+		{Code: 0x2, Status: 0x2, PowerOnHours: 1000},
+		{Code: 0xe, Status: 0x0, PowerOnHours: 900},
+	}, log.Results)
+
+	tests := []string{}
+	results := []string{}
+	for _, r := range log.Results {
+		tests = append(tests, r.Test())
+		results = append(results, r.Result())
+	}
+	assert.Equal(t, []string{SelfTestShort, SelfTestExtended, SelfTestVendorSpecific}, tests)
+	assert.Equal(t, []string{SelfTestFailed, SelfTestAborted, SelfTestPassed}, results)
+
+	// no test in progress and no results
+	buf = make([]byte, selfTestLogSize)
+	for i := 0; i < selfTestResults; i++ {
+		buf[4+i*selfTestResultSize] = selfTestResultUnused
+	}
+	log, err = ParseSelfTestLog(buf)
+	assert.NoError(t, err)
+	assert.False(t, log.InProgress())
+	assert.Empty(t, log.Results)
+}
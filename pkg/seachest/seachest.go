@@ -29,6 +29,7 @@ package seachest
 #include "nvme_helper_func.h"
 #include "cmds.h"
 #include "drive_info.h"
+#include "firmware_download.h"
 #include <libudev.h>
 */
 import "C"
@@ -104,6 +105,53 @@ func closeDevice(device *C.tDevice, devPath string) {
 	}
 }
 
+// firmwareSegmentSize is the size of the segments in which the firmware is
+// downloaded, in 512 byte blocks
+const firmwareSegmentSize = 64
+
+// DownloadFirmware downloads the firmware image to the device in segments, and
+// activates the new firmware after the last segment
+func (I *Identifier) DownloadFirmware(image []byte) error {
+	if len(image) == 0 || len(image)%512 != 0 {
+		return fmt.Errorf("size of the firmware image %d is not a multiple of 512 bytes", len(image))
+	}
+
+	var device C.tDevice
+	str := C.CString(I.DevPath)
+	defer C.free(unsafe.Pointer(str))
+
+	err := int(C.get_Device(str, &device))
+	if err != 0 {
+		return fmt.Errorf("unable to get device info for device:%s with error:%s", I.DevPath, SeachestErrors(err))
+	}
+	defer closeDevice(&device, I.DevPath)
+
+	mem := C.CBytes(image)
+	defer C.free(mem)
+	var options C.firmwareUpdateData
+	options.size = C.size_t(unsafe.Sizeof(options))
+	options.version = C.FIRMWARE_UPDATE_DATA_VERSION
+	options.dlMode = C.DL_FW_SEGMENTED
+	options.segmentSize = firmwareSegmentSize
+	options.firmwareFileMem = (*C.uint8_t)(mem)
+	options.firmwareMemoryLength = C.uint32_t(len(image))
+
+	err = int(C.firmware_Download(&device, &options))
+	if err != 0 {
+		return fmt.Errorf("firmware download to device:%s failed with error:%s", I.DevPath, SeachestErrors(err))
+	}
+	return nil
+}
+
+// FirmwareRevision reads the current firmware revision from the device
+func (I *Identifier) FirmwareRevision() (string, error) {
+	driveInfo, err := I.SeachestBasicDiskInfo()
+	if err != 0 {
+		return "", fmt.Errorf("unable to read the firmware revision of device:%s with error:%s", I.DevPath, SeachestErrors(err))
+	}
+	return I.GetFirmwareRevision(driveInfo), nil
+}
+
 func (I *Identifier) GetHostName(driveInfo *C.driveInformationSAS_SATA) string {
 	return ""
 }
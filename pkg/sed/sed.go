@@ -0,0 +1,157 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sed detects the self-encrypting drives (SED) and the TCG Security Subsystem
+// Class, like Opal, which they implement, using the TCG Level 0 Discovery
+package sed
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/openebs/node-disk-manager/pkg/nvme"
+	"github.com/openebs/node-disk-manager/pkg/smart"
+)
+
+const (
+	// protocolTCG is the security protocol of the TCG Storage commands
+	protocolTCG = 0x01
+	// comIDDiscovery is the ComID of the Level 0 Discovery
+	comIDDiscovery = 0x0001
+	// discoverySize is the size of the response of the Level 0 Discovery which is read
+	discoverySize = 2048
+	// discoveryHeaderSize is the size of the header of the response, which is
+	// followed by the feature descriptors
+	discoveryHeaderSize = 48
+	// featureHeaderSize is the size of the header of a feature descriptor
+	featureHeaderSize = 4
+)
+
+// the feature codes of the feature descriptors
+const (
+	featureLocking    = 0x0002
+	featureEnterprise = 0x0100
+	featureOpal       = 0x0200
+	featureOpal2      = 0x0203
+	featureOpalite    = 0x0301
+	featurePyrite     = 0x0302
+	featurePyrite2    = 0x0303
+	featureRuby       = 0x0304
+)
+
+// the Security Subsystem Classes
+const (
+	SSCEnterprise = "Enterprise"
+	SSCOpal       = "Opal"
+	SSCOpal2      = "Opal2"
+	SSCOpalite    = "Opalite"
+	SSCPyrite     = "Pyrite"
+	SSCPyrite2    = "Pyrite2"
+	SSCRuby       = "Ruby"
+)
+
+// sscFeatures are the Security Subsystem Classes of the feature codes
+var sscFeatures = map[uint16]string{
+	featureEnterprise: SSCEnterprise,
+	featureOpal:       SSCOpal,
+	featureOpal2:      SSCOpal2,
+	featureOpalite:    SSCOpalite,
+	featurePyrite:     SSCPyrite,
+	featurePyrite2:    SSCPyrite2,
+	featureRuby:       SSCRuby,
+}
+
+// Discovery is the result of the Level 0 Discovery of a drive
+type Discovery struct {
+	// SSC is the Security Subsystem Class of the drive, the latest one if it
+	// reports more than one
+	SSC string
+	// LockingSupported is set if the drive supports the locking of its ranges
+	LockingSupported bool
+	// LockingEnabled is set if the locking is enabled, ie. the drive is owned
+	LockingEnabled bool
+	// Locked is set if any range of the drive is locked
+	Locked bool
+	// MediaEncryption is set if the drive encrypts the data on its media
+	MediaEncryption bool
+}
+
+// SelfEncrypting returns the Security Subsystem Class of the drive if it encrypts
+// its media, so that the data can be erased by changing the key, or an empty string.
+// Pyrite drives implement the locking without the encryption.
+func (d Discovery) SelfEncrypting() string {
+	if !d.MediaEncryption {
+		return ""
+	}
+	return d.SSC
+}
+
+// Discover runs the Level 0 Discovery on the drive at the path, using the Security
+// Receive command for NVMe drives, and SECURITY PROTOCOL IN for the others
+func Discover(devPath string) (Discovery, error) {
+	var buf []byte
+	var err error
+	if nvme.IsNVMe(devPath) {
+		buf, err = nvme.SecurityReceive(devPath, protocolTCG, comIDDiscovery, discoverySize)
+	} else {
+		d := &smart.SCSIDev{DevName: devPath}
+		if err = d.Open(); err != nil {
+			return Discovery{}, err
+		}
+		defer d.Close()
+		buf, err = d.SecurityProtocolIn(protocolTCG, comIDDiscovery, discoverySize)
+	}
+	if err != nil {
+		return Discovery{}, fmt.Errorf("level 0 discovery failed on %s: %v", devPath, err)
+	}
+	return ParseDiscovery(buf)
+}
+
+// ParseDiscovery parses the response of the Level 0 Discovery, which has a header
+// with its length, followed by the feature descriptors
+func ParseDiscovery(buf []byte) (Discovery, error) {
+	discovery := Discovery{}
+	if len(buf) < discoveryHeaderSize {
+		return discovery, fmt.Errorf("level 0 discovery of %d bytes is too short", len(buf))
+	}
+	// the length excludes its own 4 bytes
+	end := int(binary.BigEndian.Uint32(buf[0:4])) + 4
+	if end <= discoveryHeaderSize {
+		return discovery, fmt.Errorf("level 0 discovery has no features")
+	}
+	if end > len(buf) {
+		end = len(buf)
+	}
+	for offset := discoveryHeaderSize; offset+featureHeaderSize <= end; {
+		code := binary.BigEndian.Uint16(buf[offset:])
+		length := int(buf[offset+3])
+		data := buf[offset+featureHeaderSize:]
+		if len(data) > length {
+			data = data[:length]
+		}
+		if ssc, ok := sscFeatures[code]; ok {
+			discovery.SSC = ssc
+		}
+		if code == featureLocking && len(data) > 0 {
+			discovery.LockingSupported = data[0]&0x01 != 0
+			discovery.LockingEnabled = data[0]&0x02 != 0
+			discovery.Locked = data[0]&0x04 != 0
+			discovery.MediaEncryption = data[0]&0x08 != 0
+		}
+		offset += featureHeaderSize + length
+	}
+	return discovery, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sed
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDiscovery returns the response of a Level 0 Discovery with the features, each
+// given as its code followed by its data
+func newDiscovery(features ...[]byte) []byte {
+	buf := make([]byte, discoveryHeaderSize)
+	for _, feature := range features {
+		descriptor := make([]byte, featureHeaderSize)
+		copy(descriptor, feature[:2])
+		descriptor[2] = 0x10
+		descriptor[3] = byte(len(feature) - 2)
+		buf = append(buf, append(descriptor, feature[2:]...)...)
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	// the response is padded to the allocation length
+	return append(buf, make([]byte, 64)...)
+}
+
+func TestParseDiscovery(t *testing.T) {
+	tper := []byte{0x00, 0x01, 0x11, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	opal2 := []byte{0x02, 0x03, 0x10, 0x01, 0x00, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}
+	tests := map[string]struct {
+		buf     []byte
+		want    Discovery
+		wantSED string
+		wantErr bool
+	}{
+		"opal2 not owned": {
+			buf: newDiscovery(tper,
+				[]byte{0x00, 0x02, 0x09, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+				[]byte{0x02, 0x00, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+				opal2),
+			want:    Discovery{SSC: SSCOpal2, LockingSupported: true, MediaEncryption: true},
+			wantSED: SSCOpal2,
+		},
+		"enterprise locked": {
+			buf:     newDiscovery(tper, []byte{0x00, 0x02, 0x0f, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, []byte{0x01, 0x00, 0, 0, 0, 0}),
+			want:    Discovery{SSC: SSCEnterprise, LockingSupported: true, LockingEnabled: true, Locked: true, MediaEncryption: true},
+			wantSED: SSCEnterprise,
+		},
+		"pyrite without encryption": {
+			buf:  newDiscovery(tper, []byte{0x00, 0x02, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, []byte{0x03, 0x03, 0, 0, 0, 0}),
+			want: Discovery{SSC: SSCPyrite2, LockingSupported: true},
+		},
+		"truncated response": {
+			buf:  newDiscovery(tper, []byte{0x02, 0x03, 0x10})[:discoveryHeaderSize+featureHeaderSize+14],
+			want: Discovery{},
+		},
+		"no features": {
+			buf:     newDiscovery(),
+			wantErr: true,
+		},
+		"too short": {
+			buf:     make([]byte, 16),
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseDiscovery(test.buf)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.wantSED, got.SelfEncrypting())
+		})
+	}
+}
@@ -50,6 +50,8 @@ const (
 	FilterBlockDeviceTag = "filterBlockDeviceTag"
 	// FilterOutLegacyAnnotation is used to filter out devices with legacy annotation
 	FilterOutLegacyAnnotation = "filterOutLegacyAnnotation"
+	// FilterOutUnschedulable is used to filter out the cordoned devices
+	FilterOutUnschedulable = "filterOutUnschedulable"
 )
 
 const (
@@ -71,6 +73,7 @@ var filterFuncMap = map[string]filterFunc{
 	FilterNodeName:              filterNodeName,
 	FilterBlockDeviceTag:        filterBlockDeviceTag,
 	FilterOutLegacyAnnotation:   filterOutLegacyAnnotation,
+	FilterOutUnschedulable:      filterOutUnschedulable,
 }
 
 // ApplyFilters apply the filter specified in the filterkeys on the given BD List,
@@ -327,6 +330,24 @@ func filterOutLegacyAnnotation(originalBD *apis.BlockDeviceList, spec *apis.Devi
 	return filteredBDList
 }
 
+// filterOutUnschedulable removes the blockdevices which are cordoned, so that
+// they are not claimed by new claims
+func filterOutUnschedulable(originalBD *apis.BlockDeviceList, spec *apis.DeviceClaimSpec) *apis.BlockDeviceList {
+	filteredBDList := &apis.BlockDeviceList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "BlockDevice",
+			APIVersion: "openebs.io/v1alpha1",
+		},
+	}
+
+	for _, bd := range originalBD.Items {
+		if !bd.Spec.Unschedulable {
+			filteredBDList.Items = append(filteredBDList.Items, bd)
+		}
+	}
+	return filteredBDList
+}
+
 // isBDTagDoesNotExistSelectorRequired is used to check whether a selector
 // was present on the BDC. It is used to decide whether a `does not exist` selector
 // for the block-device-tag label should be applied or not.
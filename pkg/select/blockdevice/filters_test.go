@@ -203,3 +203,25 @@ func createFakeBlockDevice(name string, label map[string]string) apis.BlockDevic
 	bdAPI.Labels = label
 	return bdAPI
 }
+
+func TestFilterOutUnschedulable(t *testing.T) {
+	bdList := &apis.BlockDeviceList{
+		Items: []apis.BlockDevice{
+			{ObjectMeta: v1.ObjectMeta{Name: "bd1"}},
+			{ObjectMeta: v1.ObjectMeta{Name: "bd2"}, Spec: apis.DeviceSpec{Unschedulable: true}},
+			{ObjectMeta: v1.ObjectMeta{Name: "bd3"}},
+		},
+	}
+
+	filtered := filterOutUnschedulable(bdList, &apis.DeviceClaimSpec{})
+	assert.Equal(t, 2, len(filtered.Items))
+	assert.Equal(t, "bd1", filtered.Items[0].Name)
+	assert.Equal(t, "bd3", filtered.Items[1].Name)
+
+	// a cordoned blockdevice is not claimed even if it is given by name
+	config := &Config{ClaimSpec: &apis.DeviceClaimSpec{BlockDeviceName: "bd2"}, ManualSelection: true}
+	bdList.Items[1].Status.State = "Active"
+	bdList.Items[1].Status.ClaimState = apis.BlockDeviceUnclaimed
+	_, err := config.Filter(bdList)
+	assert.Equal(t, ErrNoMatchingDevices, err)
+}
@@ -21,10 +21,21 @@ import (
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
 )
 
+var (
+	// ErrNoBlockDevices is returned when there are no blockdevices to select from
+	ErrNoBlockDevices = fmt.Errorf("no blockdevices found")
+	// ErrNoMatchingDevices is returned when none of the blockdevices match the
+	// criteria in the claim spec, like the node or the device type
+	ErrNoMatchingDevices = fmt.Errorf("no devices found matching the criteria")
+	// ErrNoMatchingResources is returned when none of the blockdevices matching
+	// the criteria have the requested capacity
+	ErrNoMatchingResources = fmt.Errorf("could not find a device with matching resource requirements")
+)
+
 // Filter selects a single block device from a list of block devices
 func (c *Config) Filter(bdList *apis.BlockDeviceList) (*apis.BlockDevice, error) {
 	if len(bdList.Items) == 0 {
-		return nil, fmt.Errorf("no blockdevices found")
+		return nil, ErrNoBlockDevices
 	}
 
 	candidateDevices, err := c.getCandidateDevices(bdList)
@@ -47,6 +58,8 @@ func (c *Config) getCandidateDevices(bdList *apis.BlockDeviceList) (*apis.BlockD
 		FilterUnclaimed,
 		// do not consider any devices with legacy annotation for claiming
 		FilterOutLegacyAnnotation,
+		// cordoned devices are not claimed, both in manual and auto claiming
+		FilterOutUnschedulable,
 		// remove block devices which do not have the blockdevice tag
 		// if selector is present on the BDC, select only those devices
 		// this applies to both manual and auto claiming.
@@ -71,7 +84,7 @@ func (c *Config) getCandidateDevices(bdList *apis.BlockDeviceList) (*apis.BlockD
 	candidateBD := c.ApplyFilters(bdList, filterKeys...)
 
 	if len(candidateBD.Items) == 0 {
-		return nil, fmt.Errorf("no devices found matching the criteria")
+		return nil, ErrNoMatchingDevices
 	}
 
 	return candidateBD, nil
@@ -90,7 +103,7 @@ func (c *Config) getSelectedDevice(bdList *apis.BlockDeviceList) (*apis.BlockDev
 	selectedDevices := c.ApplyFilters(bdList, filterKeys...)
 
 	if len(selectedDevices.Items) == 0 {
-		return nil, fmt.Errorf("could not find a device with matching resource requirements")
+		return nil, ErrNoMatchingResources
 	}
 
 	// will use the first available block device
@@ -0,0 +1,264 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/klog"
+)
+
+// SecureOptions are the options to serve the http endpoints over TLS and to
+// authenticate the clients. The certificate, key, CA and token files are
+// reloaded when they change on disk, so that they can be rotated without
+// restarting the server.
+type SecureOptions struct {
+	// CertFile and KeyFile are the certificate and private key used for TLS.
+	// The endpoints are served in plaintext if they are empty.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the CA bundle used to verify the client certificates.
+	// If set, the clients should present a certificate signed by the CA.
+	ClientCAFile string
+	// BearerTokenFile is the file having the token which the clients should
+	// send in the Authorization header.
+	BearerTokenFile string
+}
+
+// AddFlags adds the flags to set the secure options to the flag set
+func (o *SecureOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.CertFile, "tls-cert-file", "",
+		"Certificate used to serve the http endpoints over TLS. Served in plaintext if empty")
+	flags.StringVar(&o.KeyFile, "tls-private-key-file", "",
+		"Private key of the certificate set in --tls-cert-file")
+	flags.StringVar(&o.ClientCAFile, "client-ca-file", "",
+		"CA bundle used to verify the client certificates. Clients without a valid certificate are rejected if set")
+	flags.StringVar(&o.BearerTokenFile, "bearer-token-file", "",
+		"File having the bearer token which the clients should send. Requests without the token are rejected if set")
+}
+
+// TLSEnabled returns true if the endpoints are to be served over TLS
+func (o SecureOptions) TLSEnabled() bool {
+	return len(o.CertFile) != 0
+}
+
+// Validate checks that the options can be used together
+func (o SecureOptions) Validate() error {
+	if (len(o.CertFile) == 0) != (len(o.KeyFile) == 0) {
+		return fmt.Errorf("both the tls certificate and private key should be set")
+	}
+	if len(o.ClientCAFile) != 0 && !o.TLSEnabled() {
+		return fmt.Errorf("client certificates can be verified only when tls is enabled")
+	}
+	return nil
+}
+
+// TLSConfig returns the tls config with which the endpoints are served. The
+// certificate and the client CA are read again from the files whenever
+// they are modified.
+func (o SecureOptions) TLSConfig() (*tls.Config, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	certFile := newReloadingFile(o.CertFile)
+	keyFile := newReloadingFile(o.KeyFile)
+	cert := &reloadingCert{}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert.get(certFile, keyFile)
+		},
+	}
+	// load the certificate once, so that invalid files are reported at startup
+	if _, err := cert.get(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	if len(o.ClientCAFile) == 0 {
+		return config, nil
+	}
+
+	caFile := newReloadingFile(o.ClientCAFile)
+	if _, _, err := caFile.read(); err != nil {
+		return nil, err
+	}
+	// the client CA can change between connections, so the verification
+	// is done for each connection with the CA read at that time
+	config.ClientAuth = tls.RequireAnyClientCert
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		ca, _, err := caFile.read()
+		if err != nil {
+			return err
+		}
+		return verifyClientCert(ca, rawCerts)
+	}
+	return config, nil
+}
+
+// verifyClientCert verifies that the certificate chain sent by the client is
+// signed by the CA
+func verifyClientCert(ca []byte, rawCerts [][]byte) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("no certificates found in the client CA")
+	}
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("client certificate not sent")
+	}
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("invalid client certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return err
+}
+
+// Handler wraps the handler so that only the requests having the bearer
+// token are served. The handler is returned as is if no token file is set.
+func (o SecureOptions) Handler(handler http.Handler) http.Handler {
+	if len(o.BearerTokenFile) == 0 {
+		return handler
+	}
+	tokenFile := newReloadingFile(o.BearerTokenFile)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := tokenFile.read()
+		if err != nil {
+			klog.Errorf("error reading bearer token: %v", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		token = bytes.TrimSpace(token)
+		header := r.Header.Get("Authorization")
+		if len(token) == 0 || !strings.HasPrefix(header, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe serves the http server over TLS if enabled, else in plaintext.
+// The handler of the server should already be wrapped using Handler.
+func (o SecureOptions) ListenAndServe(server *http.Server) error {
+	if !o.TLSEnabled() {
+		return server.ListenAndServe()
+	}
+	config, err := o.TLSConfig()
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = config
+	return server.ListenAndServeTLS("", "")
+}
+
+// reloadingFile is a file whose contents are read again when it is modified
+type reloadingFile struct {
+	path    string
+	mutex   sync.Mutex
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+func newReloadingFile(path string) *reloadingFile {
+	return &reloadingFile{path: path}
+}
+
+// read returns the contents of the file, and whether they changed since the
+// last read
+func (f *reloadingFile) read() ([]byte, bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, false, err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.data != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.data, false, nil
+	}
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, false, err
+	}
+	f.data, f.modTime, f.size = data, info.ModTime(), info.Size()
+	return data, true, nil
+}
+
+// reloadingCert is a certificate that is loaded again when its certificate
+// or key file is modified
+type reloadingCert struct {
+	mutex sync.Mutex
+	cert  *tls.Certificate
+	// stale is set if the last reload failed, so that it is tried again
+	stale bool
+}
+
+func (c *reloadingCert) get(certFile, keyFile *reloadingFile) (*tls.Certificate, error) {
+	certPEM, certChanged, err := certFile.read()
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, keyChanged, err := keyFile.read()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cert != nil && !c.stale && !certChanged && !keyChanged {
+		return c.cert, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		// while the files are being rotated, the cert and key may not match
+		// for a while, in which case the last valid certificate is used
+		if c.cert != nil {
+			klog.Errorf("error reloading tls certificate, using the previous one: %v", err)
+			c.stale = true
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil {
+		klog.Infof("reloaded tls certificate from %s", certFile.path)
+	}
+	c.cert, c.stale = &cert, false
+	return c.cert, nil
+}
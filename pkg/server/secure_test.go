@@ -0,0 +1,228 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate along with its PEM encoded key
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate signed by the parent, or a self signed CA if
+// parent is nil
+func newTestCert(t *testing.T, serial int64, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "ndm"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	require.NoError(t, err)
+	return cert
+}
+
+// writeFile writes the data to the file, with a modification time later than the
+// previous write, so that the change is detected
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// serveTLS serves the handler over TLS using the secure options on a random port
+// and returns the address
+func serveTLS(t *testing.T, o SecureOptions, handler http.Handler) string {
+	config, err := o.TLSConfig()
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go http.Serve(tls.NewListener(listener, config), o.Handler(handler))
+	t.Cleanup(func() { listener.Close() })
+	return "https://" + listener.Addr().String()
+}
+
+func TestSecureOptionsValidate(t *testing.T) {
+	tests := map[string]struct {
+		options SecureOptions
+		wantErr bool
+	}{
+		"plaintext": {
+			options: SecureOptions{},
+		},
+		"bearer token without tls": {
+			options: SecureOptions{BearerTokenFile: "/token"},
+		},
+		"tls with client ca": {
+			options: SecureOptions{CertFile: "/cert", KeyFile: "/key", ClientCAFile: "/ca"},
+		},
+		"certificate without key": {
+			options: SecureOptions{CertFile: "/cert"},
+			wantErr: true,
+		},
+		"client ca without tls": {
+			options: SecureOptions{ClientCAFile: "/ca"},
+			wantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.wantErr, test.options.Validate() != nil)
+		})
+	}
+}
+
+func TestSecureOptionsHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-secure")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	writeFile(t, tokenFile, []byte("secret\n"), time.Now())
+
+	handler := SecureOptions{BearerTokenFile: tokenFile}.Handler(http.HandlerFunc(index))
+	tests := map[string]struct {
+		header string
+		want   int
+	}{
+		"no token":    {want: http.StatusUnauthorized},
+		"wrong token": {header: "Bearer other", want: http.StatusUnauthorized},
+		"valid token": {header: "Bearer secret", want: http.StatusOK},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if test.header != "" {
+				req.Header.Set("Authorization", test.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, test.want, rec.Code)
+		})
+	}
+
+	// the rotated token is used without restarting
+	writeFile(t, tokenFile, []byte("rotated"), time.Now().Add(time.Minute))
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer rotated")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestSecureOptionsTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-secure")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, 1, nil, x509.ExtKeyUsageAny)
+	serverCert := newTestCert(t, 2, ca, x509.ExtKeyUsageServerAuth)
+	clientCert := newTestCert(t, 3, ca, x509.ExtKeyUsageClientAuth)
+	otherCA := newTestCert(t, 4, nil, x509.ExtKeyUsageAny)
+	otherClientCert := newTestCert(t, 5, otherCA, x509.ExtKeyUsageClientAuth)
+
+	o := SecureOptions{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	now := time.Now()
+	writeFile(t, o.CertFile, serverCert.certPEM, now)
+	writeFile(t, o.KeyFile, serverCert.keyPEM, now)
+	writeFile(t, o.ClientCAFile, ca.certPEM, now)
+	address := serveTLS(t, o, http.HandlerFunc(index))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(cert *testCert) (*http.Response, error) {
+		config := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			config.Certificates = []tls.Certificate{cert.tlsCertificate(t)}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		return client.Get(address + "/metrics")
+	}
+
+	resp, err := get(clientCert)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, big.NewInt(2), resp.TLS.PeerCertificates[0].SerialNumber)
+
+	_, err = get(nil)
+	assert.Error(t, err, "client without certificate")
+	_, err = get(otherClientCert)
+	assert.Error(t, err, "client certificate signed by another CA")
+
+	// the rotated server certificate is served without restarting
+	rotatedCert := newTestCert(t, 6, ca, x509.ExtKeyUsageServerAuth)
+	writeFile(t, o.CertFile, rotatedCert.certPEM, now.Add(time.Minute))
+	writeFile(t, o.KeyFile, rotatedCert.keyPEM, now.Add(time.Minute))
+	resp, err = get(clientCert)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, big.NewInt(6), resp.TLS.PeerCertificates[0].SerialNumber)
+}
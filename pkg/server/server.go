@@ -28,14 +28,29 @@ type Server struct {
 	ListenPort  string
 	MetricsPath string
 	Handler     http.Handler
+	// Handlers are the additional endpoints served along with the metrics, keyed
+	// by the path
+	Handlers map[string]http.Handler
+	// Secure are the options to serve over TLS and authenticate the clients
+	Secure SecureOptions
 }
 
 // Start boots up the server that runs on the specified port.
 // Returns an error if there is no connection established.
 func (s *Server) Start() error {
-	http.Handle(s.MetricsPath, s.Handler)
-	klog.Info("Starting HTTP server at http://localhost" + s.ListenPort + s.MetricsPath)
-	err := http.ListenAndServe(s.ListenPort, nil)
+	if err := s.Secure.Validate(); err != nil {
+		return err
+	}
+	http.Handle(s.MetricsPath, s.Secure.Handler(s.Handler))
+	for path, handler := range s.Handlers {
+		http.Handle(path, s.Secure.Handler(handler))
+	}
+	scheme := "http"
+	if s.Secure.TLSEnabled() {
+		scheme = "https"
+	}
+	klog.Info("Starting HTTP server at " + scheme + "://localhost" + s.ListenPort + s.MetricsPath)
+	err := s.Secure.ListenAndServe(&http.Server{Addr: s.ListenPort})
 	if err != nil {
 		klog.Error("error starting http server :", err)
 		return err
@@ -28,6 +28,7 @@ const (
 	SCSIReadCapacity16            = 0x9e // read capacity (16) command
 	SCSIReadCapacityServiceAction = 0x10 // read capacity (16) service action
 	SCSIATAPassThru               = 0x85 // ata passthru command
+	SCSISecurityProtocolIn        = 0xa2 // security protocol in command
 )
 
 // SCSI Command Descriptor Block types are the various type of scsi cdbs which are used
@@ -39,6 +40,9 @@ type CDB6 [6]byte
 // CDB10 is an array of 10 byte
 type CDB10 [10]byte
 
+// CDB12 is an array of 12 byte
+type CDB12 [12]byte
+
 // CDB16 is an array of 16 byte
 type CDB16 [16]byte
 
@@ -110,6 +114,23 @@ func (d *SCSIDev) sendSCSICDB(cdb []byte, respBuf *[]byte) error {
 	return d.runSCSIGen(&header)
 }
 
+// SecurityProtocolIn sends a SCSI SECURITY PROTOCOL IN command to the device, and
+// returns the response of the given size for the security protocol and the protocol
+// specific field, eg: the TCG Level 0 Discovery. It is translated to TRUSTED RECEIVE
+// for ATA devices by libata, if libata.allow_tpm is set.
+func (d *SCSIDev) SecurityProtocolIn(protocol uint8, specific uint16, size int) ([]byte, error) {
+	respBuf := make([]byte, size)
+	cdb := CDB12{SCSISecurityProtocolIn}
+	cdb[1] = protocol
+	binary.BigEndian.PutUint16(cdb[2:], specific)
+	binary.BigEndian.PutUint32(cdb[6:], uint32(size))
+
+	if err := d.sendSCSICDB(cdb[:], &respBuf); err != nil {
+		return nil, err
+	}
+	return respBuf, nil
+}
+
 // modeSense function is used to send a SCSI MODE SENSE(6) command to a device.
 // TODO : Implement SCSI MODE SENSE(10) command also
 func (d *SCSIDev) modeSense(pageNo uint8, subPageNo uint8, pageCtrl uint8, disableBlockDesc bool) ([]byte, error) {
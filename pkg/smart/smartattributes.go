@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package smart
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// AtaSMART is the ATA SMART command
+	AtaSMART = 0xb0
+	// ataSMARTReadData is the feature of the SMART command to read the attributes
+	ataSMARTReadData = 0xd0
+
+	// smartAttributesOffset is the offset of the attribute table in the SMART data
+	smartAttributesOffset = 2
+	// smartAttributeSize is the size of an entry in the attribute table
+	smartAttributeSize = 12
+	// smartAttributeCount is the no. of entries in the attribute table
+	smartAttributeCount = 30
+)
+
+// SMARTAttribute is an entry in the attribute table of the ATA SMART data
+type SMARTAttribute struct {
+	// ID is the id of the attribute, eg: 5 for the reallocated sectors count
+	ID uint8
+	// Current is the normalized value of the attribute
+	Current uint8
+	// Worst is the lowest normalized value of the attribute
+	Worst uint8
+	// Raw is the vendor specific raw value of the attribute, which for most of
+	// the error counters is the no. of errors
+	Raw uint64
+}
+
+// ATASMARTAttributes returns the SMART attributes of an ATA device, keyed by the id
+// of the attribute. An error is returned if the device is not an ATA device.
+func (I *Identifier) ATASMARTAttributes() (map[uint8]SMARTAttribute, error) {
+	if err := isConditionSatisfied(I.DevPath); err != nil {
+		return nil, err
+	}
+	d, err := detectSCSIType(I.DevPath)
+	if err != nil {
+		return nil, fmt.Errorf("error in detecting type of SCSI device, Error: %+v", err)
+	}
+	defer d.Close()
+
+	sata, ok := d.(*SATA)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ATA device", I.DevPath)
+	}
+	buf, err := sata.ataSMARTReadData()
+	if err != nil {
+		return nil, err
+	}
+	return ParseSMARTAttributes(buf), nil
+}
+
+// ataSMARTReadData sends the SMART READ DATA command using SCSI_ATA_PASSTHRU_16
+// and returns the 512 bytes of SMART data
+func (d *SATA) ataSMARTReadData() ([]byte, error) {
+	responseBuf := make([]byte, 512)
+
+	cdb16 := CDB16{SCSIATAPassThru}
+	cdb16[1] = 0x08             // ATA protocol (4 << 1, PIO data-in)
+	cdb16[2] = 0x0e             // BYT_BLOK = 1, T_LENGTH = 2, T_DIR = 1
+	cdb16[4] = ataSMARTReadData // features
+	cdb16[6] = 0x01             // sector count
+	cdb16[10] = 0x4f            // lba mid, SMART signature
+	cdb16[12] = 0xc2            // lba high, SMART signature
+	cdb16[14] = AtaSMART        // command
+
+	if err := d.sendSCSICDB(cdb16[:], &responseBuf); err != nil {
+		return nil, fmt.Errorf("error in sending SMART READ DATA to ATA device, Error: %+v", err)
+	}
+	return responseBuf, nil
+}
+
+// ParseSMARTAttributes parses the attribute table from the SMART data. The
+// entries with id 0 are unused and are skipped.
+func ParseSMARTAttributes(buf []byte) map[uint8]SMARTAttribute {
+	attributes := make(map[uint8]SMARTAttribute)
+	for i := 0; i < smartAttributeCount; i++ {
+		offset := smartAttributesOffset + i*smartAttributeSize
+		if offset+smartAttributeSize > len(buf) {
+			break
+		}
+		entry := buf[offset : offset+smartAttributeSize]
+		if entry[0] == 0 {
+			continue
+		}
+		// the raw value is 6 bytes, little endian, after the id, the 2 bytes of
+		// flags, and the current and the worst values
+		raw := make([]byte, 8)
+		copy(raw, entry[5:11])
+		attributes[entry[0]] = SMARTAttribute{
+			ID:      entry[0],
+			Current: entry[3],
+			Worst:   entry[4],
+			Raw:     binary.LittleEndian.Uint64(raw),
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+)
+
+// vpdPageHeaderLength is the length of the header of a SCSI VPD page
+const vpdPageHeaderLength = 4
+
+// ListBlockDevices returns the device paths of the blockdevices in /sys/block,
+// eg: /dev/sda, /dev/nvme0n1. The partitions are not listed, since they are
+// only present within the directory of their parent device.
+func ListBlockDevices() ([]string, error) {
+	files, err := ioutil.ReadDir(sysFSDirectoryPath + BlockSubSystem)
+	if err != nil {
+		return nil, err
+	}
+	devNames := make([]string, 0, len(files))
+	for _, file := range files {
+		devNames = append(devNames, file.Name())
+	}
+	return addDevPrefix(devNames), nil
+}
+
+// GetVendor gets the vendor of the device. Empty if the device does not report it
+func (s Device) GetVendor() string {
+	return s.readDeviceAttribute("vendor")
+}
+
+// GetModel gets the model of the device. Empty if the device does not report it
+func (s Device) GetModel() string {
+	return s.readDeviceAttribute("model")
+}
+
+// GetSerial gets the serial number of the device. NVMe devices report the serial
+// in sysfs, while for SCSI devices it is read from the unit serial number VPD page.
+// Empty if the device does not report it.
+func (s Device) GetSerial() string {
+	if serial := s.readDeviceAttribute("serial"); serial != "" {
+		return serial
+	}
+	page, err := ioutil.ReadFile(s.sysPath + "device/vpd_pg80")
+	if err != nil || len(page) <= vpdPageHeaderLength {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.Trim(page[vpdPageHeaderLength:], "\x00")))
+}
+
+// readDeviceAttribute reads an attribute of the device, eg: model, from the
+// device directory in the syspath.
+func (s Device) readDeviceAttribute(name string) string {
+	value, err := readSysFSFileAsString(s.sysPath + "device/" + name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
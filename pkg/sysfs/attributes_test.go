@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListBlockDevices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sysfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	oldSysFSDirectoryPath := sysFSDirectoryPath
+	sysFSDirectoryPath = dir + "/"
+	defer func() { sysFSDirectoryPath = oldSysFSDirectoryPath }()
+
+	_, err = ListBlockDevices()
+	assert.Error(t, err)
+
+	for _, name := range []string{"nvme0n1", "sda"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "block", name), 0755))
+	}
+	devices, err := ListBlockDevices()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dev/nvme0n1", "/dev/sda"}, devices)
+}
+
+func TestDeviceAttributes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndm-sysfs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(device, name, content string) {
+		path := filepath.Join(dir, device, "device", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	write("sda", "vendor", "ATA     \n")
+	write("sda", "model", "Samsung SSD 860 \n")
+	write("sda", "vpd_pg80", "\x00\x80\x00\x0eS3Z9NB0K123456\x00")
+	write("nvme0n1", "model", "INTEL SSDPE2KX010T8\n")
+	write("nvme0n1", "serial", "  BTLJ123456\n")
+
+	sda := Device{deviceName: "sda", path: "/dev/sda", sysPath: filepath.Join(dir, "sda") + "/"}
+	assert.Equal(t, "ATA", sda.GetVendor())
+	assert.Equal(t, "Samsung SSD 860", sda.GetModel())
+	assert.Equal(t, "S3Z9NB0K123456", sda.GetSerial())
+
+	nvme := Device{deviceName: "nvme0n1", path: "/dev/nvme0n1", sysPath: filepath.Join(dir, "nvme0n1") + "/"}
+	assert.Equal(t, "", nvme.GetVendor())
+	assert.Equal(t, "INTEL SSDPE2KX010T8", nvme.GetModel())
+	assert.Equal(t, "BTLJ123456", nvme.GetSerial())
+
+	empty := Device{deviceName: "sdb", path: "/dev/sdb", sysPath: filepath.Join(dir, "sdb") + "/"}
+	assert.Equal(t, "", empty.GetSerial())
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+/*
+DASDs (Direct Access Storage Devices) are the disks of IBM Z (s390x) systems,
+attached using channel subsystem (ccw) devices. A DASD does not have a WWN or
+serial in udev. It is identified by its UID, which is unique in the storage
+subsystem, and by the bus-id of the ccw device, e.g 0.0.0150.
+
+eg: /sys/devices/css0/0.0.0004/0.0.0150/block/dasda/
+the ccw device is /sys/devices/css0/0.0.0004/0.0.0150/ which has the
+uid, discipline and devtype attributes of the DASD.
+*/
+
+const (
+	// dasdPrefix is the prefix of the kernel names of DASDs, eg: dasda, dasdb1
+	dasdPrefix = "dasd"
+	// DASDDisciplineECKD is the discipline of count key data DASDs
+	DASDDisciplineECKD = "ECKD"
+	// DASDDisciplineFBA is the discipline of fixed block DASDs
+	DASDDisciplineFBA = "FBA"
+	// dasdFormatBlockSize is the block size with which ECKD DASDs are usually formatted
+	dasdFormatBlockSize int64 = 4096
+	// hdioGetGeo is the HDIO_GETGEO ioctl used to get the geometry of a disk
+	hdioGetGeo = 0x0301
+)
+
+// dasdRecordsPerTrack is the number of 4096 byte records in a track of an
+// ECKD DASD, for each device type
+var dasdRecordsPerTrack = map[string]int64{
+	"3380": 10,
+	"3390": 12,
+}
+
+// DASDGeometry is the geometry of an ECKD DASD
+type DASDGeometry struct {
+	Cylinders uint32
+	Heads     uint32
+	// Sectors is the number of records in a track
+	Sectors uint32
+}
+
+// hdGeometry is struct hd_geometry used by the HDIO_GETGEO ioctl
+type hdGeometry struct {
+	heads     uint8
+	sectors   uint8
+	cylinders uint16
+	_         uint32
+	start     uint64
+}
+
+// getHDGeometry gets the geometry of the disk using the HDIO_GETGEO ioctl
+var getHDGeometry = func(devPath string) (DASDGeometry, error) {
+	f, err := os.Open(devPath)
+	if err != nil {
+		return DASDGeometry{}, err
+	}
+	defer f.Close()
+	geo := hdGeometry{}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), hdioGetGeo, uintptr(unsafe.Pointer(&geo)))
+	if errno != 0 {
+		return DASDGeometry{}, fmt.Errorf("HDIO_GETGEO ioctl failed on %s: %v", devPath, errno)
+	}
+	return DASDGeometry{
+		Cylinders: uint32(geo.cylinders),
+		Heads:     uint32(geo.heads),
+		Sectors:   uint32(geo.sectors),
+	}, nil
+}
+
+// IsDASD checks if the device is a DASD or a partition on a DASD
+func (s Device) IsDASD() bool {
+	return strings.HasPrefix(s.deviceName, dasdPrefix)
+}
+
+// readDASDAttribute reads the attribute of the ccw device of the DASD
+func (s Device) readDASDAttribute(attribute string) (string, error) {
+	if !s.IsDASD() {
+		return "", fmt.Errorf("%s is not a dasd", s.path)
+	}
+	value, err := readSysFSFileAsString(s.devicePath() + attribute)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// GetDASDBusID gets the bus-id of the ccw device of the DASD, eg: 0.0.0150
+func (s Device) GetDASDBusID() (string, error) {
+	if !s.IsDASD() {
+		return "", fmt.Errorf("%s is not a dasd", s.path)
+	}
+	devicePath, err := filepath.EvalSymlinks(s.devicePath())
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(devicePath), nil
+}
+
+// GetDASDDiscipline gets the discipline of the DASD, ECKD or FBA. DASDs accessed
+// using z/VM DIAG calls report DIAG.
+func (s Device) GetDASDDiscipline() (string, error) {
+	return s.readDASDAttribute("discipline")
+}
+
+// GetDASDDeviceType gets the device type of the DASD, eg: 3390 for a devtype of 3390/0c
+func (s Device) GetDASDDeviceType() (string, error) {
+	devType, err := s.readDASDAttribute("devtype")
+	if err != nil {
+		return "", err
+	}
+	return strings.Split(devType, "/")[0], nil
+}
+
+// GetDASDUID gets the UID of the DASD, which identifies the DASD in the storage
+// subsystem, eg: IBM.75000000092461.e900.10. The partition number is added to the
+// UID of partitions, eg: IBM.75000000092461.e900.10-part1
+func (s Device) GetDASDUID() (string, error) {
+	uid, err := s.readDASDAttribute("uid")
+	if err != nil {
+		return "", err
+	}
+	if len(uid) == 0 {
+		return "", fmt.Errorf("uid of %s is empty", s.path)
+	}
+	return s.addPartitionSuffix(uid)
+}
+
+// GetDASDGeometry gets the geometry of an ECKD DASD
+func (s Device) GetDASDGeometry() (DASDGeometry, error) {
+	if !s.IsDASD() {
+		return DASDGeometry{}, fmt.Errorf("%s is not a dasd", s.path)
+	}
+	return getHDGeometry(s.path)
+}
+
+// GetDASDCapacityInBytes gets the capacity of the DASD. The size in sysfs is used
+// if the DASD is formatted. An unformatted ECKD DASD reports a size of zero, in which
+// case the capacity after formatting with 4096 byte blocks is calculated from the
+// geometry of the DASD.
+func (s Device) GetDASDCapacityInBytes() (int64, error) {
+	numberOfBlocks, err := readSysFSFileAsInt64(s.sysPath + "size")
+	if err != nil {
+		return 0, err
+	}
+	if numberOfBlocks != 0 {
+		return numberOfBlocks * sectorSize, nil
+	}
+
+	discipline, err := s.GetDASDDiscipline()
+	if err != nil {
+		return 0, err
+	}
+	if discipline != DASDDisciplineECKD {
+		return 0, fmt.Errorf("block count of %s dasd %s reported as zero", discipline, s.path)
+	}
+	devType, err := s.GetDASDDeviceType()
+	if err != nil {
+		return 0, err
+	}
+	recordsPerTrack, ok := dasdRecordsPerTrack[devType]
+	if !ok {
+		return 0, fmt.Errorf("unknown records per track for dasd %s of type %s", s.path, devType)
+	}
+	geometry, err := s.GetDASDGeometry()
+	if err != nil {
+		return 0, err
+	}
+	return int64(geometry.Cylinders) * int64(geometry.Heads) * recordsPerTrack * dasdFormatBlockSize, nil
+}
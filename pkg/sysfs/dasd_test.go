@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createDASDSysfs creates the sysfs entries of a DASD and its partition, and
+// returns the devices
+func createDASDSysfs(t *testing.T, root, size, partitionSize string) (Device, Device) {
+	ccwDevice := filepath.Join(root, "devices/css0/0.0.0004/0.0.0150")
+	disk := filepath.Join(ccwDevice, "block/dasda")
+	partition := filepath.Join(disk, "dasda1")
+	files := map[string]string{
+		filepath.Join(ccwDevice, "uid"):        "IBM.75000000092461.e900.10\n",
+		filepath.Join(ccwDevice, "discipline"): "ECKD\n",
+		filepath.Join(ccwDevice, "devtype"):    "3390/0c\n",
+		filepath.Join(disk, "size"):            size + "\n",
+		filepath.Join(partition, "size"):       partitionSize + "\n",
+		filepath.Join(partition, "partition"):  "1\n",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(ccwDevice, filepath.Join(disk, "device")); err != nil {
+		t.Fatal(err)
+	}
+	return Device{deviceName: "dasda", path: "/dev/dasda", sysPath: disk + "/"},
+		Device{deviceName: "dasda1", path: "/dev/dasda1", sysPath: partition + "/"}
+}
+
+func TestDASD(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs-dasd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	disk, partition := createDASDSysfs(t, root, "14424480", "14424288")
+
+	assert.True(t, disk.IsDASD())
+	assert.True(t, partition.IsDASD())
+	assert.False(t, Device{deviceName: "sda"}.IsDASD())
+
+	busID, err := disk.GetDASDBusID()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0150", busID)
+	busID, err = partition.GetDASDBusID()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0150", busID)
+
+	discipline, err := disk.GetDASDDiscipline()
+	assert.NoError(t, err)
+	assert.Equal(t, DASDDisciplineECKD, discipline)
+
+	devType, err := disk.GetDASDDeviceType()
+	assert.NoError(t, err)
+	assert.Equal(t, "3390", devType)
+
+	id, err := disk.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "IBM.75000000092461.e900.10", id)
+	id, err = partition.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "IBM.75000000092461.e900.10-part1", id)
+
+	capacity, err := disk.GetDASDCapacityInBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(14424480*512), capacity)
+
+	// the platform id is empty for other devices
+	id, err = Device{deviceName: "sda"}.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Empty(t, id)
+}
+
+func TestUnformattedDASDCapacity(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs-dasd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	disk, _ := createDASDSysfs(t, root, "0", "0")
+
+	defer func(f func(string) (DASDGeometry, error)) { getHDGeometry = f }(getHDGeometry)
+	getHDGeometry = func(devPath string) (DASDGeometry, error) {
+		assert.Equal(t, "/dev/dasda", devPath)
+		// a 3390 model 9 DASD
+		return DASDGeometry{Cylinders: 10017, Heads: 15, Sectors: 12}, nil
+	}
+	capacity, err := disk.GetDASDCapacityInBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10017*15*12*4096), capacity)
+}
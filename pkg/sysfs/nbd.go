@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+Network block devices (nbd) are exported by an nbd server and connected to a
+device node by an nbd client. The device nodes, /dev/nbd0, /dev/nbd1 etc, are
+always present. A device node has a size only while it is connected, during
+which the pid attribute of the device is present.
+
+eg: /sys/devices/virtual/block/nbd0/
+the backend attribute is the identifier of the export set by the client while
+connecting, eg: nbd-server.example.com:export1. It is present only on newer kernels.
+*/
+
+const (
+	// nbdPrefix is the prefix of the kernel names of nbds, eg: nbd0, nbd0p1
+	nbdPrefix = "nbd"
+)
+
+// IsNBD checks if the device is a network block device or a partition on it
+func (s Device) IsNBD() bool {
+	return strings.HasPrefix(s.deviceName, nbdPrefix)
+}
+
+// nbdPath returns the sysfs path of the nbd. For partitions, the sysfs
+// path of the parent nbd is returned.
+func (s Device) nbdPath() string {
+	if s.isPartition() {
+		return s.sysPath + "../"
+	}
+	return s.sysPath
+}
+
+// IsNBDConnected checks if the nbd is connected to a server, using the pid
+// attribute which is present only while the nbd is connected
+func (s Device) IsNBDConnected() bool {
+	if !s.IsNBD() {
+		return false
+	}
+	_, err := os.Stat(s.nbdPath() + "pid")
+	return err == nil
+}
+
+// GetNBDBackend gets the identifier of the export to which the nbd is connected
+func (s Device) GetNBDBackend() (string, error) {
+	if !s.IsNBD() {
+		return "", fmt.Errorf("%s is not an nbd", s.path)
+	}
+	backend, err := readSysFSFileAsString(s.nbdPath() + "backend")
+	if err != nil {
+		return "", err
+	}
+	backend = strings.TrimSpace(backend)
+	if len(backend) == 0 {
+		return "", fmt.Errorf("backend of %s is empty", s.path)
+	}
+	return backend, nil
+}
+
+// GetNBDID gets the identifier of the nbd using the identifier of the export,
+// eg: nbd:nbd-server.example.com:export1. The partition number is added to the
+// identifier of partitions.
+func (s Device) GetNBDID() (string, error) {
+	backend, err := s.GetNBDBackend()
+	if err != nil {
+		return "", err
+	}
+	return s.addPartitionSuffix(nbdPrefix + ":" + backend)
+}
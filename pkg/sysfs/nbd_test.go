@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNBD(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs-nbd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	disk := filepath.Join(root, "devices/virtual/block/nbd0")
+	partition := filepath.Join(disk, "nbd0p1")
+	if err := os.MkdirAll(partition, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(partition, "partition"), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nbd0 := Device{deviceName: "nbd0", path: "/dev/nbd0", sysPath: disk + "/"}
+	nbd0p1 := Device{deviceName: "nbd0p1", path: "/dev/nbd0p1", sysPath: partition + "/"}
+
+	assert.True(t, nbd0.IsNBD())
+	assert.True(t, nbd0p1.IsNBD())
+	assert.False(t, Device{deviceName: "sda"}.IsNBD())
+
+	// disconnected
+	assert.False(t, nbd0.IsNBDConnected())
+	assert.False(t, nbd0p1.IsNBDConnected())
+	_, err = nbd0.GetPlatformID()
+	assert.Error(t, err)
+
+	// connected
+	files := map[string]string{
+		"pid":     "1234\n",
+		"backend": "nbd-server.example.com:export1\n",
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(disk, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.True(t, nbd0.IsNBDConnected())
+	assert.True(t, nbd0p1.IsNBDConnected())
+	id, err := nbd0.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "nbd:nbd-server.example.com:export1", id)
+	id, err = nbd0p1.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "nbd:nbd-server.example.com:export1-part1", id)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"os"
+	"strings"
+)
+
+// GetPlatformID gets a stable identifier of the device assigned by the platform,
+// for devices which do not have a WWN. eg: the UID of a DASD on s390x, the open
+// firmware path of a PowerVM virtual SCSI disk, the virtual device number of a
+// xen vbd, the export to which an nbd is connected or the ceph rbd image. An empty
+// string is returned if the platform does not assign an identifier to the device.
+func (s Device) GetPlatformID() (string, error) {
+	switch {
+	case s.IsDASD():
+		return s.GetDASDUID()
+	case s.IsVSCSI():
+		return s.GetVSCSIID()
+	case s.IsXenVBD():
+		return s.GetXenVBDID()
+	case s.IsNBD():
+		return s.GetNBDID()
+	case s.IsRBD():
+		return s.GetRBDID()
+	}
+	return "", nil
+}
+
+// isPartition checks if the device is a partition, using the partition
+// attribute present only for partitions
+func (s Device) isPartition() bool {
+	_, err := os.Stat(s.sysPath + "partition")
+	return err == nil
+}
+
+// devicePath returns the sysfs path of the device backing the disk, eg: the ccw
+// device of a DASD. For partitions, the device of the parent disk is returned.
+func (s Device) devicePath() string {
+	if s.isPartition() {
+		return s.sysPath + "../device/"
+	}
+	return s.sysPath + "device/"
+}
+
+// addPartitionSuffix adds the partition number to the identifier of the disk, if
+// the device is a partition, eg: IBM.75000000092461.e900.10-part1
+func (s Device) addPartitionSuffix(id string) (string, error) {
+	if !s.isPartition() {
+		return id, nil
+	}
+	partition, err := readSysFSFileAsString(s.sysPath + "partition")
+	if err != nil {
+		return "", err
+	}
+	return id + "-part" + strings.TrimSpace(partition), nil
+}
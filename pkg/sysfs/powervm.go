@@ -0,0 +1,199 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+PowerVM virtual SCSI disks are served to the LPAR (logical partition) by one or
+more virtual I/O servers, through vio adapters. The same disk served by two virtual
+I/O servers shows up as two scsi disks with the same wwid, and the serial reported
+by the virtual disk is not unique when the disk is backed by a logical volume.
+
+eg: /sys/devices/vio/30000002/host0/target0:0:1/0:0:1:0/block/sda/
+the vio adapter is /sys/devices/vio/30000002/, whose devspec attribute is the
+open firmware path of the adapter, /vdevice/v-scsi@30000002. The open firmware
+path of the disk is the path of the adapter followed by the LUN of the disk,
+/vdevice/v-scsi@30000002/disk@8100000000000000, which is stable across reboots.
+*/
+
+const (
+	// vioSubSystem is the path in sysfs under which the vio adapters are present
+	vioSubSystem = "/devices/vio/"
+	// deviceTreePath is the path of the open firmware device tree in sysfs
+	deviceTreePath = "firmware/devicetree/base/"
+)
+
+// IsVSCSI checks if the device is a PowerVM virtual SCSI disk or a partition on it
+func (s Device) IsVSCSI() bool {
+	return strings.Contains(s.sysPath, vioSubSystem)
+}
+
+// vioAdapterPath returns the sysfs path of the vio adapter of the disk
+func (s Device) vioAdapterPath() string {
+	index := strings.Index(s.sysPath, vioSubSystem) + len(vioSubSystem)
+	return s.sysPath[:index] + strings.SplitN(s.sysPath[index:], "/", 2)[0] + "/"
+}
+
+// vscsiLUN gets the 64 bit LUN of the disk used by the virtual I/O server,
+// from the scsi address of the disk in sysfs, eg: 0:0:1:0
+func (s Device) vscsiLUN() (uint64, error) {
+	for _, part := range strings.Split(s.sysPath, "/") {
+		address := strings.Split(part, ":")
+		if len(address) != 4 {
+			continue
+		}
+		hctl := make([]uint64, 0, 4)
+		for _, a := range address {
+			n, err := strconv.ParseUint(a, 10, 32)
+			if err != nil {
+				break
+			}
+			hctl = append(hctl, n)
+		}
+		if len(hctl) != 4 {
+			continue
+		}
+		channel, target, lun := hctl[1], hctl[2], hctl[3]
+		// logical unit addressing, as used by the ibmvscsi driver
+		return (0x8000 | (target&0x3f)<<8 | (channel&0x7)<<5 | (lun & 0x1f)) << 48, nil
+	}
+	return 0, fmt.Errorf("scsi address not found for %s", s.path)
+}
+
+// GetOFPath gets the open firmware path of the virtual SCSI disk,
+// eg: /vdevice/v-scsi@30000002/disk@8100000000000000
+func (s Device) GetOFPath() (string, error) {
+	if !s.IsVSCSI() {
+		return "", fmt.Errorf("%s is not a vscsi disk", s.path)
+	}
+	devSpec, err := readSysFSFileAsString(s.vioAdapterPath() + "devspec")
+	if err != nil {
+		return "", err
+	}
+	lun, err := s.vscsiLUN()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/disk@%x", strings.TrimSpace(devSpec), lun), nil
+}
+
+// getPartitionIdentity gets the identity of the LPAR from the device tree, as
+// <system-id>:<partition number>, eg: IBM,0278C2F5W:3. The open firmware path
+// is unique only within an LPAR.
+func getPartitionIdentity() (string, error) {
+	systemID, err := ioutil.ReadFile(sysFSDirectoryPath + deviceTreePath + "system-id")
+	if err != nil {
+		return "", err
+	}
+	partitionNo, err := ioutil.ReadFile(sysFSDirectoryPath + deviceTreePath + "ibm,partition-no")
+	if err != nil {
+		return "", err
+	}
+	if len(partitionNo) != 4 {
+		return "", fmt.Errorf("invalid partition number in device tree: %v", partitionNo)
+	}
+	return fmt.Sprintf("%s:%d", strings.TrimRight(string(systemID), "\x00\n"),
+		binary.BigEndian.Uint32(partitionNo)), nil
+}
+
+// GetVSCSIID gets the identifier of the virtual SCSI disk using the identity
+// of the LPAR and the open firmware path of the disk,
+// eg: IBM,0278C2F5W:3:/vdevice/v-scsi@30000002/disk@8100000000000000. The
+// partition number is added to the identifier of partitions.
+func (s Device) GetVSCSIID() (string, error) {
+	ofPath, err := s.GetOFPath()
+	if err != nil {
+		return "", err
+	}
+	lpar, err := getPartitionIdentity()
+	if err != nil {
+		return "", err
+	}
+	return s.addPartitionSuffix(lpar + ":" + ofPath)
+}
+
+// IsSecondaryVSCSIPath checks if the virtual SCSI disk is a secondary path to a
+// disk served by more than one virtual I/O server. Of all the paths with the same
+// wwid and a non zero size, the one with the lowest open firmware path is the
+// primary path. Partitions are checked using their parent disk.
+func (s Device) IsSecondaryVSCSIPath() (bool, error) {
+	if !s.IsVSCSI() {
+		return false, nil
+	}
+	disk := s
+	if s.isPartition() {
+		disk = Device{
+			deviceName: filepath.Base(filepath.Clean(s.sysPath + "..")),
+			sysPath:    filepath.Clean(s.sysPath+"..") + "/",
+		}
+		disk.path = "/dev/" + disk.deviceName
+	}
+	wwid, err := readSysFSFileAsString(disk.devicePath() + "wwid")
+	if err != nil {
+		return false, err
+	}
+	wwid = strings.TrimSpace(wwid)
+	if len(wwid) == 0 {
+		return false, nil
+	}
+	ofPath, err := disk.GetOFPath()
+	if err != nil {
+		return false, err
+	}
+
+	disks, err := ioutil.ReadDir(sysFSDirectoryPath + "block/")
+	if err != nil {
+		return false, err
+	}
+	for _, d := range disks {
+		if d.Name() == disk.deviceName {
+			continue
+		}
+		sysPath, err := getDeviceSysPath(sysFSDirectoryPath + "block/" + d.Name())
+		if err != nil {
+			continue
+		}
+		peer := Device{deviceName: d.Name(), path: "/dev/" + d.Name(), sysPath: sysPath}
+		if !peer.IsVSCSI() {
+			continue
+		}
+		peerWWID, err := readSysFSFileAsString(peer.devicePath() + "wwid")
+		if err != nil || strings.TrimSpace(peerWWID) != wwid {
+			continue
+		}
+		// a path with zero size is not usable, and is never the primary path
+		if size, err := readSysFSFileAsInt64(peer.sysPath + "size"); err != nil || size == 0 {
+			continue
+		}
+		peerOFPath, err := peer.GetOFPath()
+		if err != nil {
+			continue
+		}
+		if peerOFPath < ofPath {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createVSCSISysfs creates the sysfs entries of a virtual SCSI disk served by
+// the given vio adapter, and links it in /sys/block
+func createVSCSISysfs(t *testing.T, root, adapter, hctl, name, wwid, size string) Device {
+	vio := filepath.Join(root, "devices/vio", adapter)
+	scsiDevice := filepath.Join(vio, "host0/target0:0:1", hctl)
+	disk := filepath.Join(scsiDevice, "block", name)
+	files := map[string]string{
+		filepath.Join(vio, "devspec"):           "/vdevice/v-scsi@" + adapter + "\n",
+		filepath.Join(scsiDevice, "wwid"):       wwid + "\n",
+		filepath.Join(disk, "size"):             size + "\n",
+		filepath.Join(disk, name+"1/size"):      "2048\n",
+		filepath.Join(disk, name+"1/partition"): "1\n",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(scsiDevice, filepath.Join(disk, "device")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(disk, filepath.Join(root, "block", name)); err != nil {
+		t.Fatal(err)
+	}
+	return Device{deviceName: name, path: "/dev/" + name, sysPath: disk + "/"}
+}
+
+func TestVSCSI(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs-vscsi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	oldSysFSDirectoryPath := sysFSDirectoryPath
+	sysFSDirectoryPath = root + "/"
+	defer func() { sysFSDirectoryPath = oldSysFSDirectoryPath }()
+
+	deviceTree := filepath.Join(root, deviceTreePath)
+	if err := os.MkdirAll(deviceTree, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(deviceTree, "system-id"), []byte("IBM,0278C2F5W\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(deviceTree, "ibm,partition-no"), []byte{0, 0, 0, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wwid := "naa.600507680c80810b6000000000000a1c"
+	primary := createVSCSISysfs(t, root, "30000002", "0:0:1:0", "sda", wwid, "2097152")
+	secondary := createVSCSISysfs(t, root, "30000003", "0:0:1:0", "sdb", wwid, "2097152")
+	other := createVSCSISysfs(t, root, "30000004", "0:0:2:1", "sdc", "naa.600507680c80810b6000000000000a1d", "2097152")
+	partition := Device{deviceName: "sdb1", path: "/dev/sdb1", sysPath: secondary.sysPath + "sdb1/"}
+
+	assert.True(t, primary.IsVSCSI())
+	assert.True(t, partition.IsVSCSI())
+	assert.False(t, Device{sysPath: "/sys/devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda/"}.IsVSCSI())
+
+	ofPath, err := primary.GetOFPath()
+	assert.NoError(t, err)
+	assert.Equal(t, "/vdevice/v-scsi@30000002/disk@8100000000000000", ofPath)
+	ofPath, err = other.GetOFPath()
+	assert.NoError(t, err)
+	assert.Equal(t, "/vdevice/v-scsi@30000004/disk@8201000000000000", ofPath)
+
+	id, err := primary.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "IBM,0278C2F5W:3:/vdevice/v-scsi@30000002/disk@8100000000000000", id)
+	id, err = partition.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "IBM,0278C2F5W:3:/vdevice/v-scsi@30000003/disk@8100000000000000-part1", id)
+
+	tests := map[string]struct {
+		device Device
+		want   bool
+	}{
+		"primary path":                {primary, false},
+		"secondary path":              {secondary, true},
+		"partition on secondary path": {partition, true},
+		"disk with a single path":     {other, false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.device.IsSecondaryVSCSIPath()
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	// the secondary path becomes the primary path, if the size of the primary path is zero
+	if err := ioutil.WriteFile(primary.sysPath+"size", []byte("0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := secondary.IsSecondaryVSCSIPath()
+	assert.NoError(t, err)
+	assert.False(t, got)
+}
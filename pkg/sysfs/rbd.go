@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Ceph RBD (rados block device) images are mapped on the node by the rbd kernel
+driver. The device node of a mapped image is named after the id of the mapping,
+eg: /dev/rbd0 for the id 0. The details of the image are present in the rbd bus.
+
+eg: /sys/bus/rbd/devices/0/
+has the pool, pool_ns, name, image_id, snap and cluster_fsid attributes of the
+image mapped to /dev/rbd0. pool_ns, image_id and cluster_fsid are present only
+on newer kernels.
+*/
+
+const (
+	// rbdPrefix is the prefix of the kernel names of rbds, eg: rbd0, rbd0p1
+	rbdPrefix = "rbd"
+	// rbdBusPath is the path in sysfs of the rbd mappings
+	rbdBusPath = "bus/rbd/devices/"
+	// rbdNoSnapshot is the snapshot name of a mapping of the image itself
+	rbdNoSnapshot = "-"
+)
+
+// RBDImage is the ceph rbd image mapped to a device
+type RBDImage struct {
+	// ClusterFSID is the fsid of the ceph cluster
+	ClusterFSID string
+	// Pool is the name of the pool of the image
+	Pool string
+	// Namespace is the namespace of the image in the pool
+	Namespace string
+	// Name is the name of the image
+	Name string
+	// ImageID is the id of the image, which does not change on renaming the image
+	ImageID string
+	// Snapshot is the name of the snapshot, if a snapshot of the image is mapped
+	Snapshot string
+}
+
+// IsRBD checks if the device is a mapped rbd image or a partition on it
+func (s Device) IsRBD() bool {
+	return strings.HasPrefix(s.deviceName, rbdPrefix)
+}
+
+// rbdMappingPath returns the path of the mapping of the rbd in the rbd bus. For
+// partitions, the mapping of the parent rbd is returned.
+func (s Device) rbdMappingPath() string {
+	name := s.deviceName
+	if s.isPartition() {
+		name = filepath.Base(filepath.Clean(s.sysPath + ".."))
+	}
+	return sysFSDirectoryPath + rbdBusPath + strings.TrimPrefix(name, rbdPrefix) + "/"
+}
+
+// readRBDAttribute reads the attribute of the mapping of the rbd
+func (s Device) readRBDAttribute(attribute string) (string, error) {
+	value, err := readSysFSFileAsString(s.rbdMappingPath() + attribute)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// GetRBDImage gets the details of the ceph rbd image mapped to the device
+func (s Device) GetRBDImage() (RBDImage, error) {
+	if !s.IsRBD() {
+		return RBDImage{}, fmt.Errorf("%s is not an rbd", s.path)
+	}
+	image := RBDImage{}
+	var err error
+	if image.Pool, err = s.readRBDAttribute("pool"); err != nil {
+		return RBDImage{}, err
+	}
+	if image.Name, err = s.readRBDAttribute("name"); err != nil {
+		return RBDImage{}, err
+	}
+	// the attributes not present on older kernels are left empty
+	image.Namespace, _ = s.readRBDAttribute("pool_ns")
+	image.ImageID, _ = s.readRBDAttribute("image_id")
+	image.ClusterFSID, _ = s.readRBDAttribute("cluster_fsid")
+	image.Snapshot, _ = s.readRBDAttribute("snap")
+	if image.Snapshot == rbdNoSnapshot {
+		image.Snapshot = ""
+	}
+	return image, nil
+}
+
+// GetRBDID gets the identifier of the rbd using the cluster, pool and the image,
+// eg: 8d0f3e42-3b2a-4c3e-9d1f-6b7a2c1e5f90/rbd/10e5e6b8b4567. The id of the image
+// is used if available, else the name of the image is used. The snapshot name is
+// added for snapshots, and the partition number is added for partitions.
+func (s Device) GetRBDID() (string, error) {
+	image, err := s.GetRBDImage()
+	if err != nil {
+		return "", err
+	}
+	pool := image.Pool
+	if len(image.Namespace) != 0 {
+		pool += "/" + image.Namespace
+	}
+	id := image.ImageID
+	if len(id) == 0 {
+		id = image.Name
+	}
+	id = image.ClusterFSID + "/" + pool + "/" + id
+	if len(image.Snapshot) != 0 {
+		id += "@" + image.Snapshot
+	}
+	return s.addPartitionSuffix(id)
+}
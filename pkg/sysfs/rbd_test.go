@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRBD(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs-rbd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	oldSysFSDirectoryPath := sysFSDirectoryPath
+	sysFSDirectoryPath = root + "/"
+	defer func() { sysFSDirectoryPath = oldSysFSDirectoryPath }()
+
+	disk := filepath.Join(root, "devices/virtual/block/rbd0")
+	partition := filepath.Join(disk, "rbd0p1")
+	mapping := filepath.Join(root, rbdBusPath, "0")
+	files := map[string]string{
+		filepath.Join(partition, "partition"): "1\n",
+		filepath.Join(mapping, "pool"):        "replicapool\n",
+		filepath.Join(mapping, "name"):        "csi-vol-0a1b2c3d\n",
+		filepath.Join(mapping, "snap"):        "-\n",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rbd0 := Device{deviceName: "rbd0", path: "/dev/rbd0", sysPath: disk + "/"}
+	rbd0p1 := Device{deviceName: "rbd0p1", path: "/dev/rbd0p1", sysPath: partition + "/"}
+
+	assert.True(t, rbd0.IsRBD())
+	assert.True(t, rbd0p1.IsRBD())
+	assert.False(t, Device{deviceName: "sda"}.IsRBD())
+
+	// older kernels do not have the namespace, image id and cluster fsid
+	image, err := rbd0p1.GetRBDImage()
+	assert.NoError(t, err)
+	assert.Equal(t, RBDImage{Pool: "replicapool", Name: "csi-vol-0a1b2c3d"}, image)
+	id, err := rbd0.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "/replicapool/csi-vol-0a1b2c3d", id)
+
+	files = map[string]string{
+		"pool_ns":      "tenant1\n",
+		"image_id":     "10e5e6b8b4567\n",
+		"cluster_fsid": "8d0f3e42-3b2a-4c3e-9d1f-6b7a2c1e5f90\n",
+		"snap":         "snap1\n",
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(mapping, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	image, err = rbd0.GetRBDImage()
+	assert.NoError(t, err)
+	assert.Equal(t, RBDImage{
+		ClusterFSID: "8d0f3e42-3b2a-4c3e-9d1f-6b7a2c1e5f90",
+		Pool:        "replicapool",
+		Namespace:   "tenant1",
+		Name:        "csi-vol-0a1b2c3d",
+		ImageID:     "10e5e6b8b4567",
+		Snapshot:    "snap1",
+	}, image)
+	id, err = rbd0p1.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "8d0f3e42-3b2a-4c3e-9d1f-6b7a2c1e5f90/replicapool/tenant1/10e5e6b8b4567@snap1-part1", id)
+
+	// the image of a device which is not mapped cannot be found
+	_, err = Device{deviceName: "rbd1", path: "/dev/rbd1", sysPath: filepath.Join(root, "devices/virtual/block/rbd1") + "/"}.GetRBDImage()
+	assert.Error(t, err)
+}
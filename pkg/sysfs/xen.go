@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openebs/node-disk-manager/pkg/xenstore"
+)
+
+/*
+Xen guests access the virtual block devices (vbd) exported by the backend
+domain using the xen-blkfront driver. The disks do not have a serial or WWN.
+A vbd is identified within the guest by its virtual device number, which is
+fixed in the configuration of the guest, eg: 51712 for xvda.
+
+eg: /sys/devices/vbd-51712/block/xvda/
+the xenbus device is /sys/devices/vbd-51712/, whose nodename attribute is the
+path of the frontend in xenstore, device/vbd/51712.
+
+The virtual device number only identifies the slot of the vbd in the guest, the
+disk is identified by the backend of the vbd in xenstore. The backend path is in
+device/vbd/51712/backend, eg: /local/domain/0/backend/vbd/5/51712, and its params
+are the storage exported to the guest, eg: /dev/vg0/guest-disk.
+*/
+
+const (
+	// xenVBDSubSystem is the path in sysfs of the xenbus devices of the vbds
+	xenVBDSubSystem = "/devices/vbd-"
+	// xenVBDNodePrefix is the prefix of the xenstore path of the vbd frontends
+	xenVBDNodePrefix = "device/vbd/"
+	// xenVBDIDPrefix is the prefix of the identifier of the vbds
+	xenVBDIDPrefix = "xen-vbd:"
+)
+
+// readXenstore reads the values of the xenstore paths in order. The path to read
+// is returned by a function of the value read before it.
+var readXenstore = func(paths ...func(string) string) (string, error) {
+	client, err := xenstore.Open()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	value := ""
+	for _, path := range paths {
+		if value, err = client.Read(path(value)); err != nil {
+			return "", err
+		}
+	}
+	return value, nil
+}
+
+// IsXenVBD checks if the device is a xen virtual block device or a partition on it
+func (s Device) IsXenVBD() bool {
+	return strings.Contains(s.sysPath, xenVBDSubSystem)
+}
+
+// GetXenVirtualDevice gets the virtual device number of the vbd from the xenstore
+// path of the frontend, eg: 51712
+func (s Device) GetXenVirtualDevice() (string, error) {
+	if !s.IsXenVBD() {
+		return "", fmt.Errorf("%s is not a xen vbd", s.path)
+	}
+	nodeName, err := readSysFSFileAsString(s.devicePath() + "nodename")
+	if err != nil {
+		return "", err
+	}
+	nodeName = strings.TrimSpace(nodeName)
+	if !strings.HasPrefix(nodeName, xenVBDNodePrefix) {
+		return "", fmt.Errorf("invalid xenstore node %s for %s", nodeName, s.path)
+	}
+	return strings.TrimPrefix(nodeName, xenVBDNodePrefix), nil
+}
+
+// GetXenVBDID gets the identifier of the vbd from the params of its backend in
+// xenstore, eg: xen-vbd:/dev/vg0/guest-disk, so that the identifier follows the
+// storage exported to the guest and not the slot of the vbd. The partition number
+// is added to the identifier of partitions. An error is returned if the backend
+// cannot be read, eg: if the xenbus device is not available.
+func (s Device) GetXenVBDID() (string, error) {
+	virtualDevice, err := s.GetXenVirtualDevice()
+	if err != nil {
+		return "", err
+	}
+	params, err := readXenstore(
+		func(string) string { return xenVBDNodePrefix + virtualDevice + "/backend" },
+		func(backend string) string { return backend + "/params" },
+	)
+	if err != nil {
+		return "", fmt.Errorf("unable to read xen backend of %s: %v", s.path, err)
+	}
+	if len(params) == 0 {
+		return "", fmt.Errorf("xen backend of %s does not have params", s.path)
+	}
+	return s.addPartitionSuffix(xenVBDIDPrefix + params)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sysfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXenVBD(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs-xen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	oldSysFSDirectoryPath := sysFSDirectoryPath
+	sysFSDirectoryPath = root + "/"
+	defer func() { sysFSDirectoryPath = oldSysFSDirectoryPath }()
+
+	vbd := filepath.Join(root, "devices/vbd-51712")
+	disk := filepath.Join(vbd, "block/xvda")
+	partition := filepath.Join(disk, "xvda1")
+	files := map[string]string{
+		filepath.Join(vbd, "nodename"):        "device/vbd/51712\n",
+		filepath.Join(disk, "size"):           "16777216\n",
+		filepath.Join(partition, "partition"): "1\n",
+	}
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(vbd, filepath.Join(disk, "device")); err != nil {
+		t.Fatal(err)
+	}
+	xvda := Device{deviceName: "xvda", path: "/dev/xvda", sysPath: disk + "/"}
+	xvda1 := Device{deviceName: "xvda1", path: "/dev/xvda1", sysPath: partition + "/"}
+
+	assert.True(t, xvda.IsXenVBD())
+	assert.True(t, xvda1.IsXenVBD())
+	assert.False(t, Device{sysPath: "/sys/devices/virtual/block/loop0/"}.IsXenVBD())
+
+	virtualDevice, err := xvda1.GetXenVirtualDevice()
+	assert.NoError(t, err)
+	assert.Equal(t, "51712", virtualDevice)
+
+	oldReadXenstore := readXenstore
+	defer func() { readXenstore = oldReadXenstore }()
+	xenstoreValues := map[string]string{
+		"device/vbd/51712/backend":                   "/local/domain/0/backend/vbd/5/51712",
+		"/local/domain/0/backend/vbd/5/51712/params": "/dev/vg0/guest-disk",
+	}
+	readXenstore = func(paths ...func(string) string) (string, error) {
+		value := ""
+		for _, path := range paths {
+			var ok bool
+			if value, ok = xenstoreValues[path(value)]; !ok {
+				return "", errors.New("ENOENT")
+			}
+		}
+		return value, nil
+	}
+
+	// the identifier is the storage exported by the backend
+	id, err := xvda.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "xen-vbd:/dev/vg0/guest-disk", id)
+	id, err = xvda1.GetPlatformID()
+	assert.NoError(t, err)
+	assert.Equal(t, "xen-vbd:/dev/vg0/guest-disk-part1", id)
+
+	// no identifier is generated without the backend
+	delete(xenstoreValues, "device/vbd/51712/backend")
+	_, err = xvda.GetPlatformID()
+	assert.Error(t, err)
+}
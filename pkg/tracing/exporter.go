@@ -0,0 +1,275 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var (
+	// QueueSize is the number of ended spans that can be queued for export.
+	// Spans are dropped if the queue is full.
+	QueueSize = 2048
+	// MaxBatchSize is the maximum number of spans exported in a request
+	MaxBatchSize = 256
+	// ExportInterval is the interval at which the queued spans are exported
+	ExportInterval = 5 * time.Second
+	// ExportTimeout is the timeout of a request to the collector
+	ExportTimeout = 10 * time.Second
+)
+
+const (
+	// instrumentationScope is the name of the instrumentation scope of the spans
+	instrumentationScope = "github.com/openebs/node-disk-manager"
+
+	// spanKindInternal is the OTLP kind of the spans, SPAN_KIND_INTERNAL
+	spanKindInternal = 1
+	// statusCodeOK is the OTLP status code of a successful span, STATUS_CODE_OK
+	statusCodeOK = 1
+	// statusCodeError is the OTLP status code of a failed span, STATUS_CODE_ERROR
+	statusCodeError = 2
+)
+
+// exporter batches the ended spans and exports them to the collector
+type exporter struct {
+	endpoint string
+	resource otlpResource
+	client   *http.Client
+	queue    chan *Span
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// newOTLPExporter creates an exporter and starts exporting the spans
+func newOTLPExporter(config Config) *exporter {
+	resource := otlpResource{}
+	if len(config.ServiceName) != 0 {
+		resource.Attributes = append(resource.Attributes, newKeyValue("service.name", config.ServiceName))
+	}
+	keys := make([]string, 0, len(config.Attributes))
+	for key := range config.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes, newKeyValue(key, config.Attributes[key]))
+	}
+
+	e := &exporter{
+		endpoint: config.Endpoint,
+		resource: resource,
+		client:   &http.Client{Timeout: ExportTimeout},
+		queue:    make(chan *Span, QueueSize),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// export queues the span for export. The span is dropped if the queue is
+// full or the exporter is stopped.
+func (e *exporter) export(span *Span) {
+	select {
+	case <-e.stopCh:
+		return
+	default:
+	}
+	select {
+	case e.queue <- span:
+	default:
+		// spans are ended on the event processing path, which should not be
+		// blocked by a slow collector
+		klog.V(4).Infof("tracing queue full, dropping span %s", span.name)
+	}
+}
+
+// stop stops the exporter after exporting the queued spans
+func (e *exporter) stop() {
+	close(e.stopCh)
+	<-e.doneCh
+}
+
+// run exports the queued spans in batches till the exporter is stopped
+func (e *exporter) run() {
+	defer close(e.doneCh)
+	ticker := time.NewTicker(ExportInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, MaxBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			klog.Errorf("unable to export %d spans to %s: %v", len(batch), e.endpoint, err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= MaxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stopCh:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+					if len(batch) >= MaxBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// send exports the spans in a single request
+func (e *exporter) send(spans []*Span) error {
+	request := otlpTraceRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: e.resource,
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: instrumentationScope},
+						Spans: make([]otlpSpan, 0, len(spans)),
+					},
+				},
+			},
+		},
+	}
+	scopeSpans := &request.ResourceSpans[0].ScopeSpans[0]
+	for _, span := range spans {
+		scopeSpans.Spans = append(scopeSpans.Spans, toOTLPSpan(span))
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// toOTLPSpan converts the span to its OTLP json representation
+func toOTLPSpan(span *Span) otlpSpan {
+	span.Lock()
+	defer span.Unlock()
+	s := otlpSpan{
+		TraceID:           hex.EncodeToString(span.traceID[:]),
+		SpanID:            hex.EncodeToString(span.spanID[:]),
+		Name:              span.name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		Status:            otlpStatus{Code: statusCodeOK},
+	}
+	if span.parentSpanID != [8]byte{} {
+		s.ParentSpanID = hex.EncodeToString(span.parentSpanID[:])
+	}
+	keys := make([]string, 0, len(span.attributes))
+	for key := range span.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.Attributes = append(s.Attributes, newKeyValue(key, span.attributes[key]))
+	}
+	if span.err != nil {
+		s.Status = otlpStatus{Code: statusCodeError, Message: span.err.Error()}
+	}
+	return s
+}
+
+// The types below are the json encoding of the OTLP trace export request.
+// Refer https://github.com/open-telemetry/opentelemetry-proto
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func newKeyValue(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing provides spans of the processing of the device events, which
+// are exported to an OpenTelemetry collector using OTLP over HTTP with json
+// encoding. Tracing is disabled till an endpoint is configured, and all the
+// operations on the spans are no-op when it is disabled.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Attribute keys used in the spans
+const (
+	// DevicePathKey is the key of the device path
+	DevicePathKey = "ndm.device.path"
+	// BlockDeviceUUIDKey is the key of the blockdevice uuid
+	BlockDeviceUUIDKey = "ndm.blockdevice.uuid"
+	// ProbeNameKey is the key of the probe name
+	ProbeNameKey = "ndm.probe.name"
+	// FilterNameKey is the key of the filter name
+	FilterNameKey = "ndm.filter.name"
+	// FilterResultKey is the key of the result of the filter
+	FilterResultKey = "ndm.filter.result"
+)
+
+// Config is the config of the tracing
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces endpoint of the collector, eg:
+	// http://otel-collector:4318/v1/traces. Tracing is disabled if empty.
+	Endpoint string
+	// ServiceName is the name of the service in the exported spans
+	ServiceName string
+	// Attributes are the attributes of the resource which generates the spans
+	Attributes map[string]string
+}
+
+// activeExporter is the exporter of the spans, nil if tracing is disabled
+var activeExporter struct {
+	sync.RWMutex
+	exporter *exporter
+}
+
+// Configure enables tracing with the given config, or disables it if the endpoint
+// is empty. The spans of the earlier config are flushed before it is replaced.
+func Configure(config Config) {
+	var newExporter *exporter
+	if len(config.Endpoint) != 0 {
+		newExporter = newOTLPExporter(config)
+	}
+
+	activeExporter.Lock()
+	oldExporter := activeExporter.exporter
+	activeExporter.exporter = newExporter
+	activeExporter.Unlock()
+
+	if oldExporter != nil {
+		oldExporter.stop()
+	}
+}
+
+// Enabled returns true if tracing is enabled
+func Enabled() bool {
+	activeExporter.RLock()
+	defer activeExporter.RUnlock()
+	return activeExporter.exporter != nil
+}
+
+type spanContextKey struct{}
+
+// Span is an operation in the processing of an event. The methods of a nil span
+// are no-op, so that the callers need not check if tracing is enabled.
+type Span struct {
+	sync.Mutex
+	exporter     *exporter
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte
+	name         string
+	start        time.Time
+	end          time.Time
+	attributes   map[string]string
+	err          error
+}
+
+// StartSpan starts a span, which is a child of the span in the context if present.
+// The returned context contains the new span.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return StartSpanAt(ctx, name, time.Now())
+}
+
+// StartSpanAt starts a span at the given time, which is a child of the span in
+// the context if present. The returned context contains the new span.
+func StartSpanAt(ctx context.Context, name string, start time.Time) (context.Context, *Span) {
+	activeExporter.RLock()
+	exp := activeExporter.exporter
+	activeExporter.RUnlock()
+	if exp == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		exporter:   exp,
+		name:       name,
+		start:      start,
+		attributes: make(map[string]string),
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(*Span); ok && parent != nil {
+		span.traceID = parent.traceID
+		span.parentSpanID = parent.spanID
+	} else {
+		_, _ = rand.Read(span.traceID[:])
+	}
+	_, _ = rand.Read(span.spanID[:])
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// TraceID returns the hex encoded id of the trace of the span, empty if the
+// span is nil
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// TraceIDFromContext returns the id of the trace of the span in the context,
+// empty if the context has no span
+func TraceIDFromContext(ctx context.Context) string {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span.TraceID()
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.attributes[key] = fmt.Sprint(value)
+}
+
+// RecordError marks the span as failed with the error, if it is not nil
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.err = err
+}
+
+// End ends the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	s.end = time.Now()
+	s.Unlock()
+	s.exporter.export(s)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpansDisabled(t *testing.T) {
+	Configure(Config{})
+	assert.False(t, Enabled())
+
+	ctx, span := StartSpan(context.Background(), "disabled")
+	assert.Nil(t, span)
+	assert.Equal(t, context.Background(), ctx)
+	// operations on a nil span are no-op
+	span.SetAttribute(ProbeNameKey, "udev probe")
+	span.RecordError(errors.New("failed"))
+	span.End()
+	assert.Empty(t, span.TraceID())
+	assert.Empty(t, TraceIDFromContext(ctx))
+}
+
+func TestExportSpans(t *testing.T) {
+	var lock sync.Mutex
+	var requests []otlpTraceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		var request otlpTraceRequest
+		assert.NoError(t, json.Unmarshal(body, &request))
+		lock.Lock()
+		requests = append(requests, request)
+		lock.Unlock()
+	}))
+	defer collector.Close()
+
+	Configure(Config{
+		Endpoint:    collector.URL,
+		ServiceName: "node-disk-manager",
+		Attributes:  map[string]string{"k8s.node.name": "node1"},
+	})
+	assert.True(t, Enabled())
+
+	start := time.Now().Add(-time.Second)
+	ctx, eventSpan := StartSpanAt(context.Background(), "ndm.event", start)
+	eventSpan.SetAttribute(DevicePathKey, "/dev/sda")
+	probeCtx, probeSpan := StartSpan(ctx, "probe")
+	assert.Equal(t, eventSpan.TraceID(), TraceIDFromContext(probeCtx))
+	probeSpan.SetAttribute(ProbeNameKey, "smart probe")
+	probeSpan.RecordError(errors.New("smart probe timed out"))
+	probeSpan.End()
+	eventSpan.End()
+
+	// disabling the tracing flushes the queued spans
+	Configure(Config{})
+
+	lock.Lock()
+	defer lock.Unlock()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	resourceSpans := requests[0].ResourceSpans[0]
+	assert.Equal(t, []otlpKeyValue{
+		newKeyValue("service.name", "node-disk-manager"),
+		newKeyValue("k8s.node.name", "node1"),
+	}, resourceSpans.Resource.Attributes)
+
+	spans := resourceSpans.ScopeSpans[0].Spans
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	probe, event := spans[0], spans[1]
+	assert.Equal(t, "probe", probe.Name)
+	assert.Equal(t, event.TraceID, probe.TraceID)
+	assert.Equal(t, event.SpanID, probe.ParentSpanID)
+	assert.Equal(t, []otlpKeyValue{newKeyValue(ProbeNameKey, "smart probe")}, probe.Attributes)
+	assert.Equal(t, otlpStatus{Code: statusCodeError, Message: "smart probe timed out"}, probe.Status)
+
+	assert.Equal(t, "ndm.event", event.Name)
+	assert.Empty(t, event.ParentSpanID)
+	assert.Len(t, event.TraceID, 32)
+	assert.Equal(t, eventSpan.TraceID(), event.TraceID)
+	assert.Len(t, event.SpanID, 16)
+	assert.Equal(t, otlpStatus{Code: statusCodeOK}, event.Status)
+	assert.Equal(t, start.UnixNano(), parseInt(t, event.StartTimeUnixNano))
+	assert.True(t, parseInt(t, event.EndTimeUnixNano) >= parseInt(t, probe.EndTimeUnixNano))
+}
+
+func parseInt(t *testing.T, value string) int64 {
+	var i int64
+	if err := json.Unmarshal([]byte(value), &i); err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
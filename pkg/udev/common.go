@@ -52,6 +52,7 @@ const (
 	UDEV_ACTION               = "UDEV_ACTION"          // udev attribute to get monitor device action
 	UDEV_ACTION_ADD           = "add"                  // udev attribute constant for add action
 	UDEV_ACTION_REMOVE        = "remove"               // udev attribute constant for remove action
+	UDEV_ACTION_CHANGE        = "change"               // udev attribute constant for change action
 	UDEV_DEVTYPE              = "DEVTYPE"              // udev attribute to get device device type ie - disk or part
 	UDEV_SOURCE               = "udev"                 // udev source constant
 	UDEV_SYSPATH_PREFIX       = "/sys/dev/block/"      // udev syspath prefix
@@ -67,6 +68,10 @@ const (
 	UDEV_PARTITION_NUMBER     = "ID_PART_ENTRY_NUMBER" // udev attribute to get partition number
 	UDEV_PARTITION_UUID       = "ID_PART_ENTRY_UUID"   // udev attribute to get partition uuid
 	UDEV_PARTITION_TYPE       = "ID_PART_ENTRY_TYPE"   // udev attribute to get partition type
+	UDEV_DM_UUID              = "DM_UUID"              // udev attribute to get the device mapper UUID
+	UDEV_DASD_UID             = "ID_UID"               // udev attribute set by dasdinfo to get the UID of a DASD
+	UDEV_PARTITION_KERNEL_NO  = "PARTN"                // udev attribute to get the partition number assigned by the kernel
+	UDEV_BUS_CCW              = "ccw"                  // bus of the DASDs on s390x
 )
 
 // UdevDiskDetails struct contain different attribute of disk.
@@ -147,6 +152,24 @@ func (device *UdevDevice) GetUid() string {
 	return NDMBlockDevicePrefix + util.Hash(uid)
 }
 
+// GetPlatformID returns the identifier assigned to the device by the platform, for
+// devices which do not have a WWN. For a DASD on s390x, it is the UID set by
+// dasdinfo in the udev rules of the host. The partition number is added for
+// partitions. An empty string is returned for other devices.
+func (device *UdevDevice) GetPlatformID() string {
+	if device.GetPropertyValue(UDEV_BUS) != UDEV_BUS_CCW {
+		return ""
+	}
+	uid := device.GetPropertyValue(UDEV_DASD_UID)
+	if len(uid) == 0 {
+		return ""
+	}
+	if device.IsParitition() {
+		uid += "-part" + device.GetPropertyValue(UDEV_PARTITION_KERNEL_NO)
+	}
+	return uid
+}
+
 // IsDisk returns true if device is a disk
 func (device *UdevDevice) IsDisk() bool {
 	return device.GetDevtype() == UDEV_SYSTEM
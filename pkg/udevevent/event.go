@@ -21,7 +21,6 @@ import (
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
 	"github.com/openebs/node-disk-manager/pkg/sysfs"
 	libudevwrapper "github.com/openebs/node-disk-manager/pkg/udev"
-	"k8s.io/klog"
 )
 
 // event contains EventMessage struct
@@ -29,7 +28,7 @@ type event struct {
 	eventDetails controller.EventMessage
 }
 
-//newEvent returns a copy of event struct
+// newEvent returns a copy of event struct
 func newEvent() *event {
 	event := &event{
 		eventDetails: controller.EventMessage{},
@@ -44,7 +43,7 @@ func (e *event) process(device *libudevwrapper.UdevDevice) {
 	uuid := device.GetUid()
 	path := device.GetPath()
 	action := device.GetAction()
-	klog.Infof("processing new event for (%s) action type %s", path, action)
+	logger.Infof("processing new event for (%s) action type %s", path, action)
 	deviceDetails := &blockdevice.BlockDevice{}
 	deviceDetails.UUID = uuid
 	deviceDetails.SysPath = device.GetSyspath()
@@ -65,21 +64,30 @@ func (e *event) process(device *libudevwrapper.UdevDevice) {
 	deviceDetails.PartitionInfo.PartitionTableUUID = device.GetPropertyValue(libudevwrapper.UDEV_PARTITION_TABLE_UUID)
 	deviceDetails.PartitionInfo.PartitionEntryUUID = device.GetPropertyValue(libudevwrapper.UDEV_PARTITION_UUID)
 	deviceDetails.FSInfo.FileSystemUUID = device.GetPropertyValue(libudevwrapper.UDEV_FS_UUID)
+	deviceDetails.DeviceAttributes.DMUUID = device.GetPropertyValue(libudevwrapper.UDEV_DM_UUID)
+	deviceDetails.DeviceAttributes.PlatformID = device.GetPlatformID()
 
 	// fields used for dependents. dependents cannot be obtained while
 	// removing the device since sysfs entry will be absent
 	if action != libudevwrapper.UDEV_ACTION_REMOVE {
 		sysfsDevice, err := sysfs.NewSysFsDeviceFromDevPath(deviceDetails.DevPath)
 		if err != nil {
-			klog.Errorf("could not get sysfs device for %s, err: %v", deviceDetails.DevPath, err)
+			logger.Errorf("could not get sysfs device for %s, err: %v", deviceDetails.DevPath, err)
 		} else {
 			dependents, err := sysfsDevice.GetDependents()
 			// TODO if error occurs need to do a scan from the beginning
 			if err != nil {
-				klog.Errorf("could not get dependents for %s, %v", deviceDetails.DevPath, err)
+				logger.Errorf("could not get dependents for %s, %v", deviceDetails.DevPath, err)
 			}
 			deviceDetails.DependentDevices = dependents
-			klog.V(4).Infof("Dependents of %s : %+v", deviceDetails.DevPath, dependents)
+			logger.V(4).Infof("Dependents of %s : %+v", deviceDetails.DevPath, dependents)
+			// the platform id is read from sysfs if the udev rules of the host do not set it
+			if len(deviceDetails.DeviceAttributes.PlatformID) == 0 {
+				deviceDetails.DeviceAttributes.PlatformID, err = sysfsDevice.GetPlatformID()
+				if err != nil {
+					logger.V(4).Infof("could not get platform id of %s: %v", deviceDetails.DevPath, err)
+				}
+			}
 		}
 	}
 
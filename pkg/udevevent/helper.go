@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package udevevent
+
+import (
+	"context"
+
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/helper"
+)
+
+// helperSource receives the udev events from the monitor in the privileged helper
+type helperSource struct {
+	client *helper.Client
+	cancel context.CancelFunc
+	stream *helper.EventStream
+}
+
+// setup starts watching the events of the helper. The fd is not used.
+func (h *helperSource) setup() (int, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := h.client.WatchEvents(ctx)
+	if err != nil {
+		cancel()
+		return 0, err
+	}
+	h.cancel = cancel
+	h.stream = stream
+	return 0, nil
+}
+
+// process receives the next event from the helper and sends it to the udev probe.
+// The monitor is reconnected if the stream fails, as the helper may have restarted.
+func (h *helperSource) process(fd int) error {
+	event, err := h.stream.Recv()
+	if err != nil {
+		logger.Error(err, "unable to receive the udev event from the helper")
+		return errMonitorFailed
+	}
+	if event.Rescan {
+		RequestRescan()
+		return nil
+	}
+	msg := controller.EventMessage{Action: event.Action}
+	for i := range event.Devices {
+		msg.Devices = append(msg.Devices, &event.Devices[i])
+	}
+	UdevEventMessageChannel <- msg
+	return nil
+}
+
+// free closes the stream of events
+func (h *helperSource) free() {
+	if h.cancel != nil {
+		h.cancel()
+	}
+}
+
+// MonitorHelper receives the udev events from the monitor in the privileged
+// helper, instead of monitoring the udev source in the daemon
+func MonitorHelper(client *helper.Client) {
+	newEventSource = func() (eventSource, error) {
+		return &helperSource{client: client}, nil
+	}
+	monitorLoop(nil)
+}
+
+// ServeEvents sends the udev events received by the monitor and the rescan
+// requests to the daemon, till the context is done. It is used by the
+// privileged helper, which runs the monitor.
+func ServeEvents(ctx context.Context, send func(*helper.Event) error) error {
+	for {
+		var event *helper.Event
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-UdevEventMessageChannel:
+			event = &helper.Event{Action: msg.Action}
+			for _, bd := range msg.Devices {
+				event.Devices = append(event.Devices, *bd)
+			}
+		case <-RescanRequestChannel:
+			event = &helper.Event{Rescan: true}
+		}
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+}
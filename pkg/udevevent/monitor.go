@@ -18,17 +18,91 @@ package udevevent
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/logs"
 	libudevwrapper "github.com/openebs/node-disk-manager/pkg/udev"
 	"github.com/openebs/node-disk-manager/pkg/util"
-	"k8s.io/klog"
 )
 
+// logger is the structured logger of the udev monitor
+var logger = logs.Module("udev")
+
 // UdevEventMessageChannel used to send event message
 var UdevEventMessageChannel = make(chan controller.EventMessage)
 
+// RescanRequestChannel is used to request a full rescan of the system. A rescan is
+// requested when the monitor is reconnected, since events may have been lost, and
+// on demand to rescan the devices on the node.
+var RescanRequestChannel = make(chan struct{}, 1)
+
+var (
+	// MaxConsecutiveReceiveErrors is the number of consecutive errors while receiving
+	// events after which the monitor is considered as failed and is reconnected
+	MaxConsecutiveReceiveErrors = 5
+
+	// MinReconnectInterval is the initial interval between attempts to reconnect the monitor
+	MinReconnectInterval = time.Second
+
+	// MaxReconnectInterval is the maximum interval between attempts to reconnect the monitor
+	MaxReconnectInterval = 30 * time.Second
+)
+
+// errMonitorFailed is returned when the monitor socket cannot be used anymore
+var errMonitorFailed = errors.New("udev monitor failed")
+
+// monitorState is the connection state of the udev monitor
+var monitorState struct {
+	sync.Mutex
+	connected bool
+	// since is the time since when the monitor is in the current state
+	since time.Time
+	// err is the error due to which the monitor was disconnected
+	err error
+}
+
+// setMonitorState records the connection state of the udev monitor
+func setMonitorState(connected bool, err error) {
+	monitorState.Lock()
+	defer monitorState.Unlock()
+	if monitorState.connected != connected || monitorState.since.IsZero() {
+		monitorState.since = time.Now()
+	}
+	monitorState.connected = connected
+	monitorState.err = err
+}
+
+// MonitorHealthCheck checks if the udev monitor is connected. It can be used
+// as a health check of the controller.
+func MonitorHealthCheck() (string, error) {
+	monitorState.Lock()
+	defer monitorState.Unlock()
+	if monitorState.since.IsZero() {
+		return "", errors.New("udev monitor not started")
+	}
+	since := monitorState.since.Format(time.RFC3339)
+	if !monitorState.connected {
+		return "disconnected since " + since, fmt.Errorf("udev monitor disconnected: %v", monitorState.err)
+	}
+	return "connected since " + since, nil
+}
+
+// eventSource is the source from which udev events are received
+type eventSource interface {
+	setup() (int, error)
+	process(fd int) error
+	free()
+}
+
+// newEventSource creates a new event source, can be replaced in tests
+var newEventSource = func() (eventSource, error) {
+	return newMonitor()
+}
+
 // monitor contains udev and udevmonitor struct
 type monitor struct {
 	udev        *libudevwrapper.Udev
@@ -82,7 +156,14 @@ func (m *monitor) process(fd int) error {
 	fds := &syscall.FdSet{}
 	util.FD_ZERO(fds)
 	util.FD_SET(fds, int(fd))
-	ret, _ := syscall.Select(int(fd)+1, fds, nil, nil, nil)
+	ret, err := syscall.Select(int(fd)+1, fds, nil, nil, nil)
+	if err == syscall.EINTR {
+		return nil
+	}
+	if err != nil {
+		logger.Errorf("select on udev monitor failed: %v", err)
+		return errMonitorFailed
+	}
 	if ret <= 0 {
 		return errors.New("unable to apply select call")
 	}
@@ -104,21 +185,89 @@ func (m *monitor) process(fd int) error {
 	return nil
 }
 
-//Monitor start monitoring on udev source
+// Monitor start monitoring on udev source
 func Monitor() {
-	monitor, err := newMonitor()
-	if err != nil {
-		klog.Error(err)
+	monitorLoop(nil)
+}
+
+// monitorLoop receives events from the udev monitor till the stop channel is closed.
+// If the monitor fails, it is reconnected and a rescan is requested.
+func monitorLoop(stopCh <-chan struct{}) {
+	for {
+		source, fd, ok := connect(stopCh)
+		if !ok {
+			return
+		}
+		stopped := receive(source, fd, stopCh)
+		source.free()
+		if stopped {
+			return
+		}
+		logger.Warning("udev monitor failed, reconnecting")
+		setMonitorState(false, errMonitorFailed)
+		RequestRescan()
 	}
-	defer monitor.free()
-	fd, err := monitor.setup()
-	if err != nil {
-		klog.Error(err)
+}
+
+// connect creates the event source, retrying with backoff till it succeeds
+// or the stop channel is closed
+func connect(stopCh <-chan struct{}) (eventSource, int, bool) {
+	interval := MinReconnectInterval
+	for {
+		source, err := newEventSource()
+		if err == nil {
+			var fd int
+			fd, err = source.setup()
+			if err == nil {
+				setMonitorState(true, nil)
+				return source, fd, true
+			}
+			source.free()
+		}
+		setMonitorState(false, err)
+		logger.Error(err, "unable to setup udev monitor", "retryIn", interval)
+		select {
+		case <-stopCh:
+			return nil, 0, false
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > MaxReconnectInterval {
+			interval = MaxReconnectInterval
+		}
 	}
+}
+
+// receive processes events from the source till it fails. Returns true
+// if it returned because the stop channel was closed.
+func receive(source eventSource, fd int, stopCh <-chan struct{}) bool {
+	consecutiveErrors := 0
 	for {
-		err := monitor.process(fd)
-		if err != nil {
-			klog.Error(err)
+		select {
+		case <-stopCh:
+			return true
+		default:
+		}
+		err := source.process(fd)
+		if err == nil {
+			consecutiveErrors = 0
+			continue
 		}
+		logger.Error(err, "unable to process the udev event")
+		if err == errMonitorFailed {
+			return false
+		}
+		consecutiveErrors++
+		if consecutiveErrors >= MaxConsecutiveReceiveErrors {
+			return false
+		}
+	}
+}
+
+// RequestRescan requests a rescan, if one is not already pending
+func RequestRescan() {
+	select {
+	case RescanRequestChannel <- struct{}{}:
+	default:
 	}
 }
@@ -17,7 +17,13 @@ limitations under the License.
 package udevevent
 
 import (
+	"context"
+	"errors"
 	"testing"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/openebs/node-disk-manager/cmd/ndm_daemonset/controller"
+	"github.com/openebs/node-disk-manager/pkg/helper"
 )
 
 func TestNewMonitor(t *testing.T) {
@@ -48,3 +54,116 @@ func TestSetup(t *testing.T) {
 		t.Errorf("fd value should be greater than 2")
 	}
 }
+
+type fakeEventSource struct {
+	errs  []error
+	freed bool
+}
+
+func (f *fakeEventSource) setup() (int, error) {
+	return 3, nil
+}
+
+func (f *fakeEventSource) process(fd int) error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeEventSource) free() {
+	f.freed = true
+}
+
+func TestMonitorLoopReconnects(t *testing.T) {
+	origNewEventSource := newEventSource
+	defer func() { newEventSource = origNewEventSource }()
+
+	stopCh := make(chan struct{})
+	sources := []*fakeEventSource{
+		{errs: []error{errMonitorFailed}},
+		{errs: []error{
+			errors.New("receive failed"), errors.New("receive failed"),
+			errors.New("receive failed"), errors.New("receive failed"),
+			errors.New("receive failed"),
+		}},
+	}
+	connects := 0
+	newEventSource = func() (eventSource, error) {
+		connects++
+		if connects <= len(sources) {
+			return sources[connects-1], nil
+		}
+		// the third source is used till the loop is stopped
+		close(stopCh)
+		return &fakeEventSource{}, nil
+	}
+
+	// drain any pending rescan request
+	select {
+	case <-RescanRequestChannel:
+	default:
+	}
+
+	monitorLoop(stopCh)
+
+	if connects != 3 {
+		t.Errorf("expected 3 connects, got %d", connects)
+	}
+	for i, source := range sources {
+		if !source.freed {
+			t.Errorf("source %d was not freed", i)
+		}
+	}
+	select {
+	case <-RescanRequestChannel:
+	default:
+		t.Errorf("expected a rescan to be requested")
+	}
+	// the last source was connected successfully
+	if _, err := MonitorHealthCheck(); err != nil {
+		t.Errorf("expected the monitor to be healthy, got %v", err)
+	}
+	setMonitorState(false, errMonitorFailed)
+	if _, err := MonitorHealthCheck(); err == nil {
+		t.Errorf("expected the monitor to be unhealthy")
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	// drain any pending rescan request
+	select {
+	case <-RescanRequestChannel:
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan *helper.Event)
+	done := make(chan error)
+	go func() {
+		done <- ServeEvents(ctx, func(event *helper.Event) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	bd := &blockdevice.BlockDevice{}
+	bd.DevPath = "/dev/sda"
+	UdevEventMessageChannel <- controller.EventMessage{Action: "add", Devices: []*blockdevice.BlockDevice{bd}}
+	event := <-events
+	if event.Action != "add" || len(event.Devices) != 1 || event.Devices[0].DevPath != "/dev/sda" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	RequestRescan()
+	if event := <-events; !event.Rescan {
+		t.Errorf("expected a rescan event, got %+v", event)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
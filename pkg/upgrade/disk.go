@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upgrade
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// diskPrefix is the prefix of the names of the Disk resources. The
+	// rest of the name is the same hash as in the name of the BlockDevice
+	// which replaced the disk.
+	diskPrefix = "disk-"
+	// blockDevicePrefix is the prefix of the names of the BlockDevices
+	blockDevicePrefix = "blockdevice-"
+	// hostNameLabel is the label with the node of the disk
+	hostNameLabel = "kubernetes.io/hostname"
+)
+
+// DiskListGVK is the kind of the list of the Disk resources created by the
+// NDM releases before 0.4, which were replaced by the BlockDevices
+var DiskListGVK = schema.GroupVersionKind{
+	Group:   "openebs.io",
+	Version: "v1alpha1",
+	Kind:    "DiskList",
+}
+
+// DiskMapping is the BlockDevice which replaces a Disk resource
+type DiskMapping struct {
+	// Disk is the name of the Disk resource
+	Disk string `json:"disk"`
+	// NodeName is the node of the disk
+	NodeName string `json:"nodeName"`
+	// Path is the device path of the disk
+	Path string `json:"path"`
+	// BlockDevice is the name of the BlockDevice which replaces the disk
+	BlockDevice string `json:"blockDevice"`
+	// Found is whether the BlockDevice exists
+	Found bool `json:"found"`
+	// Claim is the namespace/name of the BDC which claims the BlockDevice
+	Claim string `json:"claim,omitempty"`
+}
+
+// MapDisks returns the BlockDevices in the namespace which replace the Disk
+// resources, sorted by disk name. An empty list is returned if the Disk
+// resources are not known to the cluster.
+func MapDisks(c client.Client, namespace string) ([]DiskMapping, error) {
+	disks := &unstructured.UnstructuredList{}
+	disks.SetGroupVersionKind(DiskListGVK)
+	if err := c.List(context.TODO(), disks); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	bdList := &apis.BlockDeviceList{}
+	if err := c.List(context.TODO(), bdList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	bds := make(map[string]bool, len(bdList.Items))
+	for _, bd := range bdList.Items {
+		bds[bd.Name] = true
+	}
+
+	bdcList := &apis.BlockDeviceClaimList{}
+	if err := c.List(context.TODO(), bdcList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	claims := make(map[string]string, len(bdcList.Items))
+	for _, bdc := range bdcList.Items {
+		if bdc.Spec.BlockDeviceName != "" {
+			claims[bdc.Spec.BlockDeviceName] = bdc.Namespace + "/" + bdc.Name
+		}
+	}
+
+	mappings := make([]DiskMapping, 0, len(disks.Items))
+	for _, disk := range disks.Items {
+		path, _, _ := unstructured.NestedString(disk.Object, "spec", "path")
+		bdName := blockDevicePrefix + strings.TrimPrefix(disk.GetName(), diskPrefix)
+		mappings = append(mappings, DiskMapping{
+			Disk:        disk.GetName(),
+			NodeName:    disk.GetLabels()[hostNameLabel],
+			Path:        path,
+			BlockDevice: bdName,
+			Found:       bds[bdName],
+			Claim:       claims[bdName],
+		})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Disk < mappings[j].Disk
+	})
+	return mappings, nil
+}
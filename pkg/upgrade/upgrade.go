@@ -16,7 +16,13 @@ limitations under the License.
 
 package upgrade
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/openebs/node-disk-manager/pkg/upgrade/v040_041"
+	"github.com/openebs/node-disk-manager/pkg/upgrade/v041_042"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
 
 // Task interfaces gives a set of methods to be implemented
 // for performing an upgrade
@@ -25,6 +31,38 @@ type Task interface {
 	IsSuccess() error
 }
 
+// Planner is implemented by the tasks which can list the changes
+// they would make, without making them
+type Planner interface {
+	Plan() ([]string, error)
+}
+
+// Tasks returns the upgrade tasks which are run on operator startup
+func Tasks(c client.Client) []Task {
+	return []Task{
+		v040_041.NewUpgradeTask("0.4.0", "0.4.1", c),
+		v041_042.NewUpgradeTask("0.4.1", "0.4.2", c),
+	}
+}
+
+// PlanUpgrade returns the changes which RunUpgrade would make with the
+// given tasks. Tasks which cannot be planned are skipped.
+func PlanUpgrade(tasks ...Task) ([]string, error) {
+	var changes []string
+	for _, task := range tasks {
+		planner, ok := task.(Planner)
+		if !ok {
+			continue
+		}
+		c, err := planner.Plan()
+		if err != nil {
+			return nil, fmt.Errorf("upgrade plan failed. Error : %v", err)
+		}
+		changes = append(changes, c...)
+	}
+	return changes, nil
+}
+
 // RunUpgrade runs all the upgrade tasks required
 func RunUpgrade(tasks ...Task) error {
 	for _, task := range tasks {
@@ -18,6 +18,8 @@ package v040_041
 
 import (
 	"context"
+	"fmt"
+
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
 	"github.com/openebs/node-disk-manager/pkg/util"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -71,6 +73,23 @@ func (p *UpgradeTask) IsSuccess() error {
 	return p.err
 }
 
+// Plan returns the BDCs whose finalizer would be renamed, without updating them
+func (p *UpgradeTask) Plan() ([]string, error) {
+	bdcList := &apis.BlockDeviceClaimList{}
+	if err := p.client.List(context.TODO(), bdcList); err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	for _, bdc := range bdcList.Items {
+		if util.Contains(bdc.Finalizers, oldBDCFinalizer) {
+			changes = append(changes, fmt.Sprintf("BlockDeviceClaim %s/%s: rename finalizer %s to %s",
+				bdc.Namespace, bdc.Name, oldBDCFinalizer, newBDCFinalizer))
+		}
+	}
+	return changes, nil
+}
+
 // renameFinalizer renames the finalizer from old to new in BDC
 func (p *UpgradeTask) renameFinalizer(claim *apis.BlockDeviceClaim) error {
 	if util.Contains(claim.Finalizers, oldBDCFinalizer) {
@@ -18,6 +18,8 @@ package v041_042
 
 import (
 	"context"
+	"fmt"
+
 	apis "github.com/openebs/node-disk-manager/pkg/apis/openebs/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -63,16 +65,39 @@ func (p *UpgradeTask) IsSuccess() error {
 	return p.err
 }
 
+// Plan returns the BDCs whose hostname would be copied, without updating them
+func (p *UpgradeTask) Plan() ([]string, error) {
+	bdcList := &apis.BlockDeviceClaimList{}
+	if err := p.client.List(context.TODO(), bdcList); err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	for _, bdc := range bdcList.Items {
+		if needsHostNameCopy(&bdc) {
+			changes = append(changes, fmt.Sprintf("BlockDeviceClaim %s/%s: copy .spec.hostName %s to .spec.blockDeviceNodeAttributes.hostName",
+				bdc.Namespace, bdc.Name, bdc.Spec.HostName))
+		}
+	}
+	return changes, nil
+}
+
 // copyHostName will copy the hostname string from .spec.hostName to
 // .spec.nodeAttributes.hostName
 func (p *UpgradeTask) copyHostName(claim *apis.BlockDeviceClaim) error {
 	// copy the value only if .spec.hostName is non-empty and nodeAttributes.hostName
 	// is empty. If hostname field is empty, it is not required to copy the value, as
 	// it may be a new BDC.
-	if len(claim.Spec.HostName) != 0 &&
-		len(claim.Spec.BlockDeviceNodeAttributes.HostName) == 0 {
+	if needsHostNameCopy(claim) {
 		claim.Spec.BlockDeviceNodeAttributes.HostName = claim.Spec.HostName
 		return p.client.Update(context.TODO(), claim)
 	}
 	return nil
 }
+
+// needsHostNameCopy returns whether the hostname of the claim has to be copied
+// to the node attributes
+func needsHostNameCopy(claim *apis.BlockDeviceClaim) bool {
+	return len(claim.Spec.HostName) != 0 &&
+		len(claim.Spec.BlockDeviceNodeAttributes.HostName) == 0
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package wear tracks the endurance used by the SSDs over time, to estimate
+// when the devices will wear out.
+package wear
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"k8s.io/klog"
+)
+
+const (
+	// HistoryAnnotation is the annotation on the blockdevice in which the
+	// endurance used samples of the device are persisted
+	HistoryAnnotation = "internal.openebs.io/wear-history"
+
+	// MaxSamples is the no. of samples kept in the history of a device
+	MaxSamples = 32
+
+	// DefaultSampleInterval is the default min. interval between the samples
+	DefaultSampleInterval = 24 * time.Hour
+
+	// minTrendDuration is the min. duration spanned by the samples for the
+	// trend to be estimated
+	minTrendDuration = 24 * time.Hour
+)
+
+// Sample is the percentage of the device life used at a point in time
+type Sample struct {
+	Time        time.Time
+	PercentUsed float64
+}
+
+// History is a ring buffer of the endurance used samples of a device. When the
+// buffer is full, the oldest sample is overwritten.
+type History struct {
+	samples []Sample
+	// start is the index of the oldest sample
+	start int
+}
+
+// ParseHistory parses the history persisted in the annotation. The samples are
+// comma separated, each being the unix time and the percentage used separated
+// by a colon, from the oldest to the latest. eg: 1600000000:12,1600086400:12.5
+func ParseHistory(value string) (*History, error) {
+	h := &History{}
+	if len(value) == 0 {
+		return h, nil
+	}
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.Split(field, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sample %q", field)
+		}
+		seconds, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time in sample %q: %v", field, err)
+		}
+		percentUsed, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentage in sample %q: %v", field, err)
+		}
+		h.push(Sample{Time: time.Unix(seconds, 0), PercentUsed: percentUsed})
+	}
+	return h, nil
+}
+
+// String encodes the history in the format of the annotation
+func (h *History) String() string {
+	fields := make([]string, 0, len(h.samples))
+	for _, s := range h.Samples() {
+		fields = append(fields, strconv.FormatInt(s.Time.Unix(), 10)+":"+
+			strconv.FormatFloat(s.PercentUsed, 'f', -1, 64))
+	}
+	return strings.Join(fields, ",")
+}
+
+// Samples returns the samples from the oldest to the latest
+func (h *History) Samples() []Sample {
+	samples := make([]Sample, 0, len(h.samples))
+	samples = append(samples, h.samples[h.start:]...)
+	return append(samples, h.samples[:h.start]...)
+}
+
+// Latest returns the latest sample, or false if there are no samples
+func (h *History) Latest() (Sample, bool) {
+	if len(h.samples) == 0 {
+		return Sample{}, false
+	}
+	return h.samples[(h.start+len(h.samples)-1)%len(h.samples)], true
+}
+
+// Add adds the sample to the history, if the latest sample is older than the
+// interval. Since the endurance used does not decrease, a lower value means that
+// the device has been replaced or reset, and the history is started afresh.
+// Returns true if the sample was added.
+func (h *History) Add(s Sample, interval time.Duration) bool {
+	latest, ok := h.Latest()
+	switch {
+	case !ok:
+	case s.PercentUsed < latest.PercentUsed:
+		h.samples, h.start = nil, 0
+	case s.Time.Sub(latest.Time) < interval:
+		return false
+	}
+	h.push(s)
+	return true
+}
+
+func (h *History) push(s Sample) {
+	if len(h.samples) < MaxSamples {
+		h.samples = append(h.samples, s)
+		return
+	}
+	h.samples[h.start] = s
+	h.start = (h.start + 1) % MaxSamples
+}
+
+// DaysToWearOut estimates the no. of days after the latest sample at which the
+// endurance used reaches 100%, from the least squares fit of the samples. It
+// returns false if the samples span less than a day, or if the endurance used
+// is not increasing.
+func (h *History) DaysToWearOut() (float64, bool) {
+	samples := h.Samples()
+	if len(samples) < 2 {
+		return 0, false
+	}
+	first, latest := samples[0], samples[len(samples)-1]
+	if latest.PercentUsed >= 100 {
+		return 0, true
+	}
+	if latest.Time.Sub(first.Time) < minTrendDuration {
+		return 0, false
+	}
+
+	// slope of the percentage used per day
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(first.Time).Hours() / 24
+		sumX += x
+		sumY += s.PercentUsed
+		sumXY += x * s.PercentUsed
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope <= 0 || math.IsNaN(slope) {
+		return 0, false
+	}
+	return (100 - latest.PercentUsed) / slope, true
+}
+
+// Annotator sets an annotation on the blockdevice resource
+type Annotator interface {
+	AnnotateBlockDevice(name, key, value string) error
+}
+
+// Tracker records the endurance used samples of the devices. The history of
+// each device is persisted in an annotation on the blockdevice, if an annotator
+// is available, so that it is not lost when the exporter restarts.
+type Tracker struct {
+	annotator Annotator
+	nodeName  string
+	interval  time.Duration
+	histories map[string]*History
+	now       func() time.Time
+}
+
+// NewTracker creates a tracker which samples the endurance used at the interval.
+// Only the devices of the node are tracked, all the devices if the node name is
+// empty. The annotator can be nil, in which case the history is only kept in memory.
+func NewTracker(annotator Annotator, nodeName string, interval time.Duration) *Tracker {
+	return &Tracker{
+		annotator: annotator,
+		nodeName:  nodeName,
+		interval:  interval,
+		histories: make(map[string]*History),
+		now:       time.Now,
+	}
+}
+
+// Record adds the endurance used of the device to its history, and returns the
+// history. The history persisted on the blockdevice is used if the device is
+// not yet tracked. Returns nil if the device is not on the node.
+func (t *Tracker) Record(bd blockdevice.BlockDevice, percentUsed float64) *History {
+	if t.nodeName != "" && bd.NodeAttributes[blockdevice.NodeName] != t.nodeName {
+		return nil
+	}
+	h, ok := t.histories[bd.UUID]
+	if !ok {
+		var err error
+		if h, err = ParseHistory(bd.Annotations[HistoryAnnotation]); err != nil {
+			klog.Warningf("ignoring the wear history of %s. %v", bd.UUID, err)
+			h = &History{}
+		}
+		t.histories[bd.UUID] = h
+	}
+	if !h.Add(Sample{Time: t.now(), PercentUsed: percentUsed}, t.interval) {
+		return h
+	}
+	if t.annotator != nil {
+		if err := t.annotator.AnnotateBlockDevice(bd.UUID, HistoryAnnotation, h.String()); err != nil {
+			klog.Errorf("error persisting the wear history of %s. %v", bd.UUID, err)
+		}
+	}
+	return h
+}
+
+// Retain forgets the histories of the devices that are not in the list
+func (t *Tracker) Retain(uuids map[string]bool) {
+	for uuid := range t.histories {
+		if !uuids[uuid] {
+			delete(t.histories, uuid)
+		}
+	}
+}
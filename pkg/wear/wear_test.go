@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wear
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openebs/node-disk-manager/blockdevice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var day = 24 * time.Hour
+
+func TestParseHistory(t *testing.T) {
+	h, err := ParseHistory("1600000000:12,1600086400:12.5")
+	require.NoError(t, err)
+	assert.Equal(t, []Sample{
+		{Time: time.Unix(1600000000, 0), PercentUsed: 12},
+		{Time: time.Unix(1600086400, 0), PercentUsed: 12.5},
+	}, h.Samples())
+	assert.Equal(t, "1600000000:12,1600086400:12.5", h.String())
+
+	h, err = ParseHistory("")
+	require.NoError(t, err)
+	assert.Empty(t, h.Samples())
+
+	for _, value := range []string{"1600000000", "now:12", "1600000000:twelve"} {
+		_, err = ParseHistory(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestHistoryAdd(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	h := &History{}
+
+	assert.True(t, h.Add(Sample{Time: start, PercentUsed: 10}, day))
+	// the sample is dropped if it is within the interval
+	assert.False(t, h.Add(Sample{Time: start.Add(time.Hour), PercentUsed: 10}, day))
+	assert.True(t, h.Add(Sample{Time: start.Add(day), PercentUsed: 11}, day))
+	assert.Len(t, h.Samples(), 2)
+
+	// a lower value starts the history afresh
+	assert.True(t, h.Add(Sample{Time: start.Add(2 * day), PercentUsed: 1}, day))
+	assert.Equal(t, []Sample{{Time: start.Add(2 * day), PercentUsed: 1}}, h.Samples())
+
+	// the oldest samples are overwritten when the buffer is full
+	h = &History{}
+	for i := 0; i < MaxSamples+3; i++ {
+		h.Add(Sample{Time: start.Add(time.Duration(i) * day), PercentUsed: float64(i)}, day)
+	}
+	samples := h.Samples()
+	assert.Len(t, samples, MaxSamples)
+	assert.Equal(t, float64(3), samples[0].PercentUsed)
+	assert.Equal(t, float64(MaxSamples+2), samples[MaxSamples-1].PercentUsed)
+
+	parsed, err := ParseHistory(h.String())
+	require.NoError(t, err)
+	assert.Equal(t, samples, parsed.Samples())
+}
+
+func TestDaysToWearOut(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	history := func(percents ...float64) *History {
+		h := &History{}
+		for i, p := range percents {
+			h.push(Sample{Time: start.Add(time.Duration(i) * day), PercentUsed: p})
+		}
+		return h
+	}
+
+	days, ok := history(10, 12, 14, 16).DaysToWearOut()
+	assert.True(t, ok)
+	assert.InDelta(t, 42, days, 0.001)
+
+	days, ok = history(99, 100).DaysToWearOut()
+	assert.True(t, ok)
+	assert.Equal(t, float64(0), days)
+
+	_, ok = history(10).DaysToWearOut()
+	assert.False(t, ok, "single sample")
+	_, ok = history(10, 10, 10).DaysToWearOut()
+	assert.False(t, ok, "no wear")
+
+	// samples spanning less than a day
+	h := &History{}
+	h.push(Sample{Time: start, PercentUsed: 10})
+	h.push(Sample{Time: start.Add(time.Hour), PercentUsed: 11})
+	_, ok = h.DaysToWearOut()
+	assert.False(t, ok, "short span")
+}
+
+type fakeAnnotator struct {
+	annotations map[string]string
+	err         error
+}
+
+func (f *fakeAnnotator) AnnotateBlockDevice(name, key, value string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.annotations[name+"/"+key] = value
+	return nil
+}
+
+func TestTracker(t *testing.T) {
+	now := time.Unix(1600086400, 0)
+	annotator := &fakeAnnotator{annotations: make(map[string]string)}
+	tracker := NewTracker(annotator, "node1", day)
+	tracker.now = func() time.Time { return now }
+
+	bd := blockdevice.BlockDevice{
+		Identifier:     blockdevice.Identifier{UUID: "blockdevice-1"},
+		NodeAttributes: blockdevice.NodeAttribute{blockdevice.NodeName: "node1"},
+		Annotations:    map[string]string{HistoryAnnotation: "1600000000:12"},
+	}
+
+	// the persisted history is continued
+	h := tracker.Record(bd, 13)
+	require.NotNil(t, h)
+	assert.Len(t, h.Samples(), 2)
+	assert.Equal(t, "1600000000:12,1600086400:13", annotator.annotations["blockdevice-1/"+HistoryAnnotation])
+
+	// the sample within the interval is not persisted
+	now = now.Add(time.Hour)
+	annotator.err = errors.New("not expected")
+	assert.Len(t, tracker.Record(bd, 13).Samples(), 2)
+
+	// devices of other nodes are not tracked
+	other := bd
+	other.NodeAttributes = blockdevice.NodeAttribute{blockdevice.NodeName: "node2"}
+	assert.Nil(t, tracker.Record(other, 13))
+
+	tracker.Retain(map[string]bool{})
+	assert.Empty(t, tracker.histories)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package xenstore reads the xenstore of a xen guest using the xenbus device,
+// with the xenstore wire protocol
+package xenstore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DevicePath is the path of the xenbus device of the guest, through which the
+// requests are sent to xenstore
+var DevicePath = "/dev/xen/xenbus"
+
+const (
+	// typeRead is the type of the message reading the value of a path
+	typeRead = 2
+	// typeError is the type of the response to a failed request
+	typeError = 16
+	// headerSize is the size of the header of a message
+	headerSize = 16
+	// maxPayloadSize is the maximum size of the payload of a message
+	maxPayloadSize = 4096
+)
+
+// header is the header of a xenstore message. The fields are in the byte order
+// of the guest, which is little endian on the architectures supported by xen.
+type header struct {
+	Type          uint32
+	RequestID     uint32
+	TransactionID uint32
+	Len           uint32
+}
+
+// Client reads the values from xenstore
+type Client struct {
+	rw        io.ReadWriter
+	requestID uint32
+}
+
+// Open opens the xenbus device of the guest
+func Open() (*Client, error) {
+	f, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(f), nil
+}
+
+// NewClient returns a client which sends the requests using the given connection
+func NewClient(rw io.ReadWriter) *Client {
+	return &Client{rw: rw}
+}
+
+// Close closes the connection of the client, if it can be closed
+func (c *Client) Close() error {
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Read reads the value of the path, eg: device/vbd/51712/backend
+func (c *Client) Read(path string) (string, error) {
+	payload := append([]byte(path), 0)
+	if len(payload) > maxPayloadSize {
+		return "", fmt.Errorf("xenstore path %s is too long", path)
+	}
+	c.requestID++
+	request := header{
+		Type:      typeRead,
+		RequestID: c.requestID,
+		Len:       uint32(len(payload)),
+	}
+	// the header and the payload are sent in a single write, as the
+	// xenbus device expects a complete message in each write
+	buf := make([]byte, 0, headerSize+len(payload))
+	buf = appendHeader(buf, request)
+	buf = append(buf, payload...)
+	if _, err := c.rw.Write(buf); err != nil {
+		return "", fmt.Errorf("unable to send xenstore read of %s: %v", path, err)
+	}
+
+	var response header
+	if err := binary.Read(c.rw, binary.LittleEndian, &response); err != nil {
+		return "", fmt.Errorf("unable to read xenstore response for %s: %v", path, err)
+	}
+	if response.Len > maxPayloadSize {
+		return "", fmt.Errorf("invalid xenstore response length %d for %s", response.Len, path)
+	}
+	value := make([]byte, response.Len)
+	if _, err := io.ReadFull(c.rw, value); err != nil {
+		return "", fmt.Errorf("unable to read xenstore response for %s: %v", path, err)
+	}
+	if response.RequestID != request.RequestID {
+		return "", fmt.Errorf("unexpected xenstore response %d for request %d",
+			response.RequestID, request.RequestID)
+	}
+	if response.Type == typeError {
+		return "", fmt.Errorf("unable to read xenstore path %s: %s", path, strings.TrimRight(string(value), "\x00"))
+	}
+	if response.Type != typeRead {
+		return "", fmt.Errorf("unexpected xenstore response type %d for %s", response.Type, path)
+	}
+	return string(value), nil
+}
+
+// appendHeader appends the encoded header to the buffer
+func appendHeader(buf []byte, h header) []byte {
+	for _, field := range []uint32{h.Type, h.RequestID, h.TransactionID, h.Len} {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], field)
+		buf = append(buf, b[:]...)
+	}
+	return buf
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package xenstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConn holds the requests written by the client, and the responses read by it
+type fakeConn struct {
+	requests  bytes.Buffer
+	responses bytes.Buffer
+}
+
+func (f *fakeConn) Write(p []byte) (int, error) {
+	return f.requests.Write(p)
+}
+
+func (f *fakeConn) Read(p []byte) (int, error) {
+	return f.responses.Read(p)
+}
+
+func (f *fakeConn) respond(messageType, requestID uint32, payload string) {
+	f.responses.Write(appendHeader(nil, header{Type: messageType, RequestID: requestID, Len: uint32(len(payload))}))
+	f.responses.WriteString(payload)
+}
+
+func TestRead(t *testing.T) {
+	conn := &fakeConn{}
+	client := NewClient(conn)
+
+	conn.respond(typeRead, 1, "/local/domain/0/backend/vbd/5/51712")
+	value, err := client.Read("device/vbd/51712/backend")
+	assert.NoError(t, err)
+	assert.Equal(t, "/local/domain/0/backend/vbd/5/51712", value)
+	expected := appendHeader(nil, header{Type: typeRead, RequestID: 1, Len: 25})
+	expected = append(expected, "device/vbd/51712/backend\x00"...)
+	assert.Equal(t, expected, conn.requests.Bytes())
+
+	conn.respond(typeError, 2, "ENOENT\x00")
+	_, err = client.Read("device/vbd/51728/backend")
+	assert.EqualError(t, err, "unable to read xenstore path device/vbd/51728/backend: ENOENT")
+
+	// the response of another request is not used
+	conn.respond(typeRead, 2, "/local/domain/0/backend/vbd/5/51712")
+	_, err = client.Read("device/vbd/51712/backend")
+	assert.Error(t, err)
+
+	// no response
+	_, err = client.Read("device/vbd/51712/backend")
+	assert.Error(t, err)
+}